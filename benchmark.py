@@ -8,6 +8,8 @@ Benchmark script to compare Surge against other download tools:
 """
 
 import argparse
+import json
+import os
 import platform
 import shutil
 import subprocess
@@ -51,12 +53,13 @@ class BenchmarkResult:
 # =============================================================================
 # UTILITIES
 # =============================================================================
-def run_command(cmd: List[str], cwd: Optional[str] = None, timeout: int = 3600) -> tuple[bool, str]:
+def run_command(cmd: List[str], cwd: Optional[str] = None, timeout: int = 3600, env: Optional[dict] = None) -> tuple[bool, str]:
     """Run a command and return (success, output)."""
     try:
         result = subprocess.run(
             cmd,
             cwd=cwd,
+            env=env,
             capture_output=True,
             text=True,
             timeout=timeout,
@@ -95,6 +98,25 @@ def parse_go_duration(s: str) -> float:
         total += float(val) * multipliers.get(unit, 0)
     return total
 
+def surge_env(config_dir: Path, network: dict) -> dict:
+    """Environment that points Surge at a separate config dir holding the given network settings."""
+    env = os.environ.copy()
+    system = platform.system()
+    if system == "Windows":
+        env["APPDATA"] = str(config_dir)
+        surge_dir = config_dir / "surge"
+    elif system == "Darwin":
+        env["HOME"] = str(config_dir)
+        surge_dir = config_dir / "Library" / "Application Support" / "surge"
+    else:
+        env["XDG_CONFIG_HOME"] = str(config_dir)
+        env["XDG_STATE_HOME"] = str(config_dir / "state")
+        surge_dir = config_dir / "surge"
+    surge_dir.mkdir(parents=True, exist_ok=True)
+    (surge_dir / "settings.json").write_text(json.dumps({"network": network}))
+    return env
+
+
 def print_box_header(title: str, width: int = 60):
     print(f"┌{'─' * (width - 2)}┐")
     print(f"│ {title:<{width - 4}} │")
@@ -125,7 +147,7 @@ def check_tool(name: str) -> bool:
 # =============================================================================
 # BENCHMARK ENGINE
 # =============================================================================
-def benchmark_surge(executable: Path, url: str, output_dir: Path, label: str = "surge") -> BenchmarkResult:
+def benchmark_surge(executable: Path, url: str, output_dir: Path, label: str = "surge", env: Optional[dict] = None) -> BenchmarkResult:
     """Specialized benchmark for Surge to parse internal duration."""
     if not executable.exists():
         return BenchmarkResult(label, False, 0, 0, f"Binary not found: {executable}")
@@ -140,7 +162,7 @@ def benchmark_surge(executable: Path, url: str, output_dir: Path, label: str = "
         str(executable), "server", "start", url,
         "--output", str(output_dir),
         "--exit-when-done"
-    ])
+    ], env=env)
     elapsed = time.perf_counter() - start
     
     # Parse internal time if available
@@ -283,6 +305,7 @@ def main():
     parser.add_argument("--surge-baseline", type=Path, help="Baseline Surge binary for comparison")
     parser.add_argument("--mirror-suite", action="store_true", help="Run multi-mirror test suite")
     parser.add_argument("--speedtest", action="store_true", help="Run network speedtest-cli")
+    parser.add_argument("--compare-transports", "--compare-http2", dest="compare_transports", action="store_true", help="Compare Surge over HTTP/1.1, multiplexed HTTP/2 and HTTP/3")
     
     # Tool flags
     for tool in ["surge", "aria2", "wget", "curl", "axel"]:
@@ -339,7 +362,7 @@ def main():
 
     else:
         # Standard Single URL Logic
-        specific_request = any(getattr(args, t) for t in ["surge", "aria2", "wget", "curl", "axel"]) or args.surge_exec or args.surge_baseline
+        specific_request = any(getattr(args, t) for t in ["surge", "aria2", "wget", "curl", "axel"]) or args.surge_exec or args.surge_baseline or args.compare_transports
         run_all = not specific_request
 
         # Surge tasks
@@ -349,6 +372,15 @@ def main():
         if args.surge_baseline and args.surge_baseline.exists():
             tasks.append(lambda: benchmark_surge(args.surge_baseline, args.url, download_dir, "Surge (Baseline)"))
 
+        # Same binary with separate configs, so only the transport differs
+        if args.compare_transports and surge_bin:
+            http1_env = surge_env(temp_dir / "config-http1", {"http2_hosts": "", "http3_hosts": ""})
+            http2_env = surge_env(temp_dir / "config-http2", {"http2_hosts": "*", "http3_hosts": ""})
+            http3_env = surge_env(temp_dir / "config-http3", {"http2_hosts": "", "http3_hosts": "*"})
+            tasks.append(lambda: benchmark_surge(surge_bin, args.url, download_dir, "Surge (HTTP/1.1)", http1_env))
+            tasks.append(lambda: benchmark_surge(surge_bin, args.url, download_dir, "Surge (HTTP/2)", http2_env))
+            tasks.append(lambda: benchmark_surge(surge_bin, args.url, download_dir, "Surge (HTTP/3)", http3_env))
+
         # Standard tool tasks
         for name, bin_name, func in standard_tools:
             if (run_all or getattr(args, name)) and check_tool(bin_name):
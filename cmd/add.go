@@ -5,19 +5,35 @@ import (
 	"os"
 
 	"github.com/spf13/cobra"
+	"github.com/surge-downloader/surge/internal/engine/checksum"
+	"github.com/surge-downloader/surge/internal/engine/ratelimit"
+	"github.com/surge-downloader/surge/internal/engine/stream"
+	"github.com/surge-downloader/surge/internal/engine/types"
 )
 
 var addCmd = &cobra.Command{
 	Use:     "add [url]...",
 	Aliases: []string{"get"},
 	Short:   "Add a new download to the running Surge instance",
-	Long:    `Add one or more URLs to the download queue of a running Surge instance.`,
+	Long: `Add one or more URLs to the download queue of a running Surge instance.
+Metalink files (.meta4, .metalink) and URLs to them are expanded into their
+listed files, mirrors and hashes.
+
+HLS playlists (.m3u8) and DASH manifests (.mpd) are downloaded as the video
+they describe, joined into one .ts or .mp4 file. --variant picks the
+rendition: best (the default), worst, a height such as 720p, a resolution
+such as 1280x720, or a bandwidth cap such as 2500k.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		// Initialize Global State (needed for config/paths)
 		initializeGlobalState()
 
 		batchFile, _ := cmd.Flags().GetString("batch")
 		output, _ := cmd.Flags().GetString("output")
+		expectedChecksum, _ := cmd.Flags().GetString("checksum")
+		limit, _ := cmd.Flags().GetString("limit")
+		priorityArg, _ := cmd.Flags().GetString("priority")
+		category, _ := cmd.Flags().GetString("category")
+		variant, _ := cmd.Flags().GetString("variant")
 
 		// Collect URLs
 		var urls []string
@@ -40,6 +56,36 @@ var addCmd = &cobra.Command{
 			return
 		}
 
+		if expectedChecksum != "" {
+			if len(urls) > 1 {
+				fmt.Fprintln(os.Stderr, "Error: --checksum can only be used with a single URL")
+				os.Exit(1)
+			}
+			normalized, err := checksum.Normalize(expectedChecksum)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: invalid checksum: %v\n", err)
+				os.Exit(1)
+			}
+			expectedChecksum = normalized
+		}
+
+		rateLimit, err := ratelimit.ParseRate(limit)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		priority, err := types.ParsePriority(priorityArg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if _, err := stream.ParseVariant(variant); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
 		// Check if Surge is running
 		port := readActivePort()
 		if port == 0 {
@@ -49,7 +95,7 @@ var addCmd = &cobra.Command{
 		}
 
 		// Send downloads to server
-		count := processDownloads(urls, output, port)
+		count := processDownloadsWithOptions(urls, output, port, types.DownloadOptions{Checksum: expectedChecksum, RateLimit: rateLimit, Priority: priority, Category: category, Variant: variant})
 
 		if count > 0 {
 			fmt.Printf("Successfully added %d downloads.\n", count)
@@ -59,6 +105,11 @@ var addCmd = &cobra.Command{
 
 func init() {
 	rootCmd.AddCommand(addCmd)
-	addCmd.Flags().StringP("batch", "b", "", "File containing URLs to download (one per line)")
+	addCmd.Flags().StringP("batch", "b", "", "File containing URLs to download (one per line), or a Metalink file")
 	addCmd.Flags().StringP("output", "o", "", "Output directory")
+	addCmd.Flags().String("checksum", "", "Expected digest of the file as algo:hex (sha256, sha1, md5, sha512)")
+	addCmd.Flags().String("limit", "", "Speed limit for each added download (e.g. 512K, 2M)")
+	addCmd.Flags().String("priority", "", "Queue priority: high, normal, low or a number")
+	addCmd.Flags().String("category", "", "Category to file the download under instead of matching one by the file")
+	addCmd.Flags().String("variant", "", "Rendition of an HLS/DASH stream: best, worst, 720p, 1280x720 or a bandwidth like 2500k")
 }
@@ -0,0 +1,39 @@
+package cmd
+
+import (
+	"github.com/surge-downloader/surge/internal/aria2"
+	"github.com/surge-downloader/surge/internal/auth"
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/core"
+)
+
+// newAria2Server creates the aria2-compatible JSON-RPC endpoint. It takes
+// the API tokens as secrets, and saves to the same places as /download.
+func newAria2Server(tokens *auth.Store, defaultOutputDir string, service core.DownloadService) *aria2.Server {
+	rpc := aria2.NewServer(service, "")
+	rpc.Version = Version
+	rpc.Authorize = func(token, method string) bool {
+		scope, ok := tokens.Authenticate(token)
+		if !ok {
+			return false
+		}
+		switch {
+		case aria2.ReadOnly(method):
+			return scope.Includes(auth.ScopeRead)
+		case method == "aria2.addUri":
+			return scope.Includes(auth.ScopeAdd)
+		}
+		return scope.Includes(auth.ScopeAdmin)
+	}
+	rpc.Settings = func() *config.Settings {
+		settings, err := config.LoadSettings()
+		if err != nil {
+			settings = config.DefaultSettings()
+		}
+		return settings
+	}
+	rpc.ResolveDir = func(dir string) (string, error) {
+		return resolveOutputPath(dir, false, defaultOutputDir, rpc.Settings())
+	}
+	return rpc
+}
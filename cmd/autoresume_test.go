@@ -79,7 +79,7 @@ func TestCmd_AutoResume_Execution(t *testing.T) {
 	GlobalPool = download.NewWorkerPool(GlobalProgressCh, 4)
 
 	// 6. Call the function
-	resumePausedDownloads()
+	resumePausedDownloads(true)
 
 	// 7. Verify
 	// Check if GlobalPool has the download active
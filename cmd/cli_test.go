@@ -143,6 +143,43 @@ func TestReadURLsFromFile_ParsesAndFilters(t *testing.T) {
 	}
 }
 
+func TestExpandDownloadArgs_Metalink(t *testing.T) {
+	tmpDir := t.TempDir()
+	metaFile := filepath.Join(tmpDir, "set.meta4")
+	doc := `<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+  <file name="a.iso"><url>https://one.example.com/a.iso</url><url priority="1">https://two.example.com/a.iso</url></file>
+  <file name="b.iso"><size>10</size><url>https://one.example.com/b.iso</url></file>
+</metalink>`
+	if err := os.WriteFile(metaFile, []byte(doc), 0o644); err != nil {
+		t.Fatalf("failed to write metalink: %v", err)
+	}
+
+	// A metalink batch file is passed through whole
+	batch, err := readURLsFromFile(metaFile)
+	if err != nil || len(batch) != 1 || batch[0] != metaFile {
+		t.Fatalf("readURLsFromFile(metalink) = %v, %v", batch, err)
+	}
+
+	opts := types.DownloadOptions{Checksum: "md5:" + strings.Repeat("0", 32)}
+	reqs := expandDownloadArgs([]string{"https://example.com/c.zip,https://m.example.com/c.zip", metaFile}, "/out", opts)
+	if len(reqs) != 3 {
+		t.Fatalf("expected 3 requests, got %d (%+v)", len(reqs), reqs)
+	}
+
+	if reqs[0].URL != "https://example.com/c.zip" || len(reqs[0].Mirrors) != 2 || reqs[0].Checksum != opts.Checksum {
+		t.Errorf("plain URL request = %+v", reqs[0])
+	}
+	if reqs[1].URL != "https://two.example.com/a.iso" || reqs[1].Filename != "a.iso" || len(reqs[1].Mirrors) != 2 {
+		t.Errorf("metalink request = %+v", reqs[1])
+	}
+	if reqs[1].Checksum != "" {
+		t.Errorf("CLI checksum must not apply to metalink files, got %q", reqs[1].Checksum)
+	}
+	if reqs[2].Filename != "b.iso" || reqs[2].Size != 10 || reqs[2].Path != "/out" {
+		t.Errorf("metalink request = %+v", reqs[2])
+	}
+}
+
 func TestReadURLsFromFile_MissingFile(t *testing.T) {
 	_, err := readURLsFromFile(filepath.Join(t.TempDir(), "missing.txt"))
 	if err == nil {
@@ -440,6 +477,8 @@ func TestProcessDownloads_RemoteAndLocal(t *testing.T) {
 		GlobalProgressCh = make(chan any, 10)
 		GlobalPool = download.NewWorkerPool(GlobalProgressCh, 2)
 		GlobalService = core.NewLocalDownloadService(GlobalPool)
+		// Stop the pool before the state DB is closed; workers save the queue
+		t.Cleanup(GlobalPool.GracefulShutdown)
 
 		count := processDownloads([]string{
 			"https://example.com/local.zip",
@@ -13,10 +13,13 @@ import (
 	"testing"
 	"time"
 
+	"github.com/spf13/cobra"
+	"github.com/surge-downloader/surge/internal/auth"
 	"github.com/surge-downloader/surge/internal/config"
 	"github.com/surge-downloader/surge/internal/core"
 	"github.com/surge-downloader/surge/internal/download"
 	"github.com/surge-downloader/surge/internal/testutil"
+	"github.com/surge-downloader/surge/internal/tlscert"
 )
 
 func init() {
@@ -1153,3 +1156,107 @@ func TestServerCmd_HasSubcommands(t *testing.T) {
 		}
 	}
 }
+
+func TestAuthMiddleware_Scopes(t *testing.T) {
+	tokens := auth.NewStore(t.TempDir())
+	admin, err := tokens.Default()
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, _ := tokens.Create("dashboard", auth.ScopeRead, 0)
+	add, _ := tokens.Create("extension", auth.ScopeAdd, 0)
+
+	handler := authMiddleware(tokens, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+	status := func(method, path, token string) int {
+		req := httptest.NewRequest(method, path, nil)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	tests := []struct {
+		method, path, token string
+		want                int
+	}{
+		{http.MethodGet, "/health", "", http.StatusOK},
+		{http.MethodPost, "/jsonrpc", "", http.StatusOK}, // Checked by the RPC server
+		{http.MethodGet, "/list", "", http.StatusUnauthorized},
+		{http.MethodGet, "/list", "wrong", http.StatusUnauthorized},
+		{http.MethodGet, "/list", read, http.StatusOK},
+		{http.MethodGet, "/download", read, http.StatusOK},
+		{http.MethodPost, "/download", read, http.StatusForbidden},
+		{http.MethodPost, "/download", add, http.StatusOK},
+		{http.MethodPost, "/crawl", add, http.StatusOK},
+		{http.MethodGet, "/events", add, http.StatusOK},
+		{http.MethodPost, "/pause", add, http.StatusForbidden},
+		{http.MethodPost, "/queue", add, http.StatusForbidden},
+		{http.MethodDelete, "/delete", read, http.StatusForbidden},
+		{http.MethodPost, "/pause", admin, http.StatusOK},
+		{http.MethodPost, "/limit", admin, http.StatusOK},
+	}
+	for _, tt := range tests {
+		if got := status(tt.method, tt.path, tt.token); got != tt.want {
+			t.Errorf("%s %s: got %d, want %d", tt.method, tt.path, got, tt.want)
+		}
+	}
+
+	if err := tokens.Revoke("extension"); err != nil {
+		t.Fatal(err)
+	}
+	if got := status(http.MethodPost, "/download", add); got != http.StatusUnauthorized {
+		t.Errorf("revoked token: got %d, want 401", got)
+	}
+}
+
+func TestWrapServerTLS(t *testing.T) {
+	newCmd := func(args ...string) *cobra.Command {
+		c := &cobra.Command{Use: "test"}
+		addTLSFlags(c)
+		if err := c.Flags().Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = inner.Close() }()
+
+	// TLS is off by default
+	ln, fingerprint, err := wrapServerTLS(inner, newCmd())
+	if err != nil || ln != inner || fingerprint != "" {
+		t.Errorf("no flags: %v, %q, %v", ln, fingerprint, err)
+	}
+
+	dir := t.TempDir()
+	cert, err := tlscert.LoadOrCreate(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile := filepath.Join(dir, tlscert.CertFile), filepath.Join(dir, tlscert.KeyFile)
+
+	if _, _, err := wrapServerTLS(inner, newCmd("--tls-cert", certFile)); err == nil {
+		t.Error("--tls-cert without --tls-key should fail")
+	}
+	if _, _, err := wrapServerTLS(inner, newCmd("--tls-cert", certFile, "--tls-key", filepath.Join(dir, "missing.pem"))); err == nil {
+		t.Error("a missing key file should fail")
+	}
+
+	ln, fingerprint, err = wrapServerTLS(inner, newCmd("--tls-cert", certFile, "--tls-key", keyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = ln.Close() }()
+	if _, ok := ln.(*tlscert.Listener); !ok {
+		t.Errorf("listener = %T, want *tlscert.Listener", ln)
+	}
+	if fingerprint != tlscert.CertificateFingerprint(cert) {
+		t.Errorf("fingerprint = %q, want %q", fingerprint, tlscert.CertificateFingerprint(cert))
+	}
+}
@@ -2,6 +2,8 @@ package cmd
 
 import (
 	"context"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"net"
 	"net/url"
@@ -35,6 +37,21 @@ var connectCmd = &cobra.Command{
 			}
 		}
 
+		fingerprintFlag, _ := cmd.Flags().GetString("fingerprint")
+		fingerprint := strings.TrimSpace(fingerprintFlag)
+		if fingerprint == "" {
+			fingerprint = strings.TrimSpace(os.Getenv("SURGE_FINGERPRINT"))
+		}
+		if fingerprint != "" {
+			// A pinned certificate only makes sense over TLS
+			if !strings.Contains(target, "://") {
+				target = "https://" + target
+			} else if !strings.HasPrefix(strings.ToLower(target), "https://") {
+				fmt.Println("--fingerprint requires an https:// target")
+				os.Exit(1)
+			}
+		}
+
 		insecureHTTP, _ := cmd.Flags().GetBool("insecure-http")
 		baseURL, err := resolveConnectBaseURL(target, insecureHTTP)
 		if err != nil {
@@ -51,9 +68,9 @@ var connectCmd = &cobra.Command{
 		}
 		if token == "" {
 			// Only reuse local token for loopback targets.
-			host := target
-			if idx := strings.Index(host, ":"); idx != -1 {
-				host = host[:idx]
+			host := hostnameFromTarget(target)
+			if u, err := url.Parse(baseURL); err == nil {
+				host = u.Hostname()
 			}
 			if isLocalHost(host) {
 				token = ensureAuthToken()
@@ -63,15 +80,25 @@ var connectCmd = &cobra.Command{
 			}
 		}
 
-		fmt.Printf("Connecting to %s...\n", baseURL)
-
 		// Create Remote Service
 		service := core.NewRemoteDownloadService(baseURL, token)
+		if fingerprint != "" {
+			if err := service.PinCertificate(fingerprint); err != nil {
+				fmt.Println(err.Error())
+				os.Exit(1)
+			}
+		}
+
+		fmt.Printf("Connecting to %s...\n", baseURL)
 
 		// Verify connection
 		_, err = service.List()
 		if err != nil {
 			fmt.Printf("Failed to connect: %v\n", err)
+			var unknownAuthority x509.UnknownAuthorityError
+			if errors.As(err, &unknownAuthority) {
+				fmt.Println("The daemon may use a self-signed certificate. Pass its fingerprint, shown by 'surge server status', with --fingerprint.")
+			}
 			os.Exit(1)
 		}
 
@@ -122,6 +149,7 @@ var connectCmd = &cobra.Command{
 func init() {
 	connectCmd.Flags().String("token", "", "Bearer token for remote daemon (or set SURGE_TOKEN)")
 	connectCmd.Flags().Bool("insecure-http", false, "Allow plain HTTP for non-loopback targets")
+	connectCmd.Flags().String("fingerprint", "", "SHA-256 fingerprint of the daemon's TLS certificate to trust (or set SURGE_FINGERPRINT)")
 	rootCmd.AddCommand(connectCmd)
 }
 
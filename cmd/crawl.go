@@ -0,0 +1,275 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/core"
+	"github.com/surge-downloader/surge/internal/crawl"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// CrawlRequest is the body of a POST to /crawl
+type CrawlRequest struct {
+	URL                  string            `json:"url"`
+	Path                 string            `json:"path,omitempty"`
+	RelativeToDefaultDir bool              `json:"relative_to_default_dir,omitempty"`
+	Depth                int               `json:"depth,omitempty"` // 0 means no limit
+	Include              []string          `json:"include,omitempty"`
+	Exclude              []string          `json:"exclude,omitempty"`
+	MinSize              int64             `json:"min_size,omitempty"`
+	MaxSize              int64             `json:"max_size,omitempty"`
+	Headers              map[string]string `json:"headers,omitempty"`
+	DryRun               bool              `json:"dry_run,omitempty"` // List the files without queuing them
+}
+
+// CrawlResponse lists the files a crawl found and the downloads it queued
+type CrawlResponse struct {
+	Files []crawl.File `json:"files"`
+	IDs   []string     `json:"ids,omitempty"`
+	Error string       `json:"error,omitempty"` // Set when the crawl stopped early
+}
+
+var crawlCmd = &cobra.Command{
+	Use:   "crawl <url>",
+	Short: "Download every file below a directory listing",
+	Long: `Walk the directory listing at <url> (Apache, nginx or lighttpd autoindex
+pages) and its subfolders, and queue every file found. The folder layout is
+recreated under the output directory.
+
+Patterns for --include and --exclude are shell globs matched against both
+the file name and its path below <url>, e.g. "*.csv" or "raw/*". Excluded
+folders are not entered.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeGlobalState()
+
+		output, _ := cmd.Flags().GetString("output")
+		depth, _ := cmd.Flags().GetInt("depth")
+		include, _ := cmd.Flags().GetStringSlice("include")
+		exclude, _ := cmd.Flags().GetStringSlice("exclude")
+		minSize, _ := cmd.Flags().GetString("min-size")
+		maxSize, _ := cmd.Flags().GetString("max-size")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+
+		req := CrawlRequest{
+			URL:     args[0],
+			Depth:   depth,
+			Include: include,
+			Exclude: exclude,
+			DryRun:  dryRun,
+		}
+		var err error
+		if req.MinSize, err = parseSizeFlag(minSize); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --min-size: %v\n", err)
+			os.Exit(1)
+		}
+		if req.MaxSize, err = parseSizeFlag(maxSize); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: --max-size: %v\n", err)
+			os.Exit(1)
+		}
+		if output != "" {
+			req.Path = utils.EnsureAbsPath(output)
+		}
+
+		port := readActivePort()
+		if port == 0 {
+			fmt.Println("Error: Surge is not running.")
+			os.Exit(1)
+		}
+
+		result, err := sendCrawl(port, req)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if jsonOutput {
+			data, _ := json.MarshalIndent(result, "", "  ")
+			fmt.Println(string(data))
+			return
+		}
+
+		if dryRun {
+			w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+			_, _ = fmt.Fprintln(w, "PATH\tSIZE")
+			_, _ = fmt.Fprintln(w, "----\t----")
+			for _, f := range result.Files {
+				size := "-"
+				if f.Size >= 0 {
+					size = utils.ConvertBytesToHumanReadable(f.Size)
+				}
+				_, _ = fmt.Fprintf(w, "%s\t%s\n", f.Path, size)
+			}
+			_ = w.Flush()
+			fmt.Printf("%d files found.\n", len(result.Files))
+		} else {
+			fmt.Printf("Queued %d downloads from %s\n", len(result.IDs), args[0])
+		}
+		if result.Error != "" {
+			fmt.Fprintf(os.Stderr, "Warning: crawl stopped early: %s\n", result.Error)
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(crawlCmd)
+	crawlCmd.Flags().StringP("output", "o", "", "Output directory (defaults to the default download directory)")
+	crawlCmd.Flags().Int("depth", 5, "Levels of subfolders to enter (0 for no limit)")
+	crawlCmd.Flags().StringSlice("include", nil, "Only download files matching these globs")
+	crawlCmd.Flags().StringSlice("exclude", nil, "Skip files and folders matching these globs")
+	crawlCmd.Flags().String("min-size", "", "Skip files smaller than this (e.g. 10K)")
+	crawlCmd.Flags().String("max-size", "", "Skip files larger than this (e.g. 2G)")
+	crawlCmd.Flags().Bool("dry-run", false, "List the files without downloading them")
+	crawlCmd.Flags().Bool("json", false, "Output in JSON format")
+}
+
+func parseSizeFlag(raw string) (int64, error) {
+	if raw == "" {
+		return 0, nil
+	}
+	return crawl.ParseSize(raw)
+}
+
+// sendCrawl asks the running instance to crawl a listing
+func sendCrawl(port int, crawlReq CrawlRequest) (*CrawlResponse, error) {
+	body, err := json.Marshal(crawlReq)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://127.0.0.1:%d/crawl", port), bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+ensureAuthToken())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to server: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			utils.Debug("Error closing response body: %v", err)
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("server error: %s - %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var result CrawlResponse
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// handleCrawl crawls the directory listing in a POSTed CrawlRequest and
+// queues every file found, keeping the folder layout under the output path
+func handleCrawl(w http.ResponseWriter, r *http.Request, defaultOutputDir string, service core.DownloadService) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer func() {
+		if err := r.Body.Close(); err != nil {
+			utils.Debug("Error closing body: %v", err)
+		}
+	}()
+
+	var req CrawlRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.URL == "" {
+		http.Error(w, "URL is required", http.StatusBadRequest)
+		return
+	}
+	if strings.Contains(req.Path, "..") {
+		http.Error(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+	if service == nil {
+		http.Error(w, "Service unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	settings, err := config.LoadSettings()
+	if err != nil {
+		settings = config.DefaultSettings()
+	}
+
+	files, err := crawl.Crawl(r.Context(), req.URL, crawl.Options{
+		MaxDepth:  req.Depth,
+		Include:   req.Include,
+		Exclude:   req.Exclude,
+		MinSize:   req.MinSize,
+		MaxSize:   req.MaxSize,
+		UserAgent: settings.Network.UserAgent,
+		Headers:   req.Headers,
+	})
+	resp := CrawlResponse{Files: files}
+	if err != nil {
+		if !errors.Is(err, crawl.ErrTooManyFiles) {
+			http.Error(w, "Crawl failed: "+err.Error(), http.StatusBadGateway)
+			return
+		}
+		resp.Error = err.Error()
+	}
+	if resp.Files == nil {
+		resp.Files = []crawl.File{}
+	}
+
+	if !req.DryRun {
+		outPath, err := resolveOutputPath(req.Path, req.RelativeToDefaultDir, defaultOutputDir, settings)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if resp.IDs, err = queueCrawledFiles(service, files, outPath, req.Headers); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		utils.Debug("Failed to encode response: %v", err)
+	}
+}
+
+// queueCrawledFiles adds a download for each file, in the folder matching
+// its place in the listing. Categories don't move them, so the layout holds
+// even for files at the top of the default directory.
+func queueCrawledFiles(service core.DownloadService, files []crawl.File, outPath string, headers map[string]string) ([]string, error) {
+	ids := make([]string, 0, len(files))
+	for _, f := range files {
+		dir := filepath.Join(outPath, filepath.FromSlash(path.Dir(f.Path)))
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			return ids, fmt.Errorf("Failed to create directory: %w", err)
+		}
+		id, err := service.AddWithOptions(f.URL, dir, path.Base(f.Path), nil, headers, types.DownloadOptions{KeepDir: true})
+		if err != nil {
+			return ids, fmt.Errorf("Failed to add download: %w", err)
+		}
+		atomic.AddInt32(&activeDownloads, 1)
+		ids = append(ids, id)
+	}
+	return ids, nil
+}
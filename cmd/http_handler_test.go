@@ -9,10 +9,14 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/surge-downloader/surge/internal/config"
 	"github.com/surge-downloader/surge/internal/core"
 	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/ratelimit"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
 )
 
 func TestHandleDownload_PathResolution(t *testing.T) {
@@ -173,3 +177,426 @@ func TestHandleDownload_PathResolution(t *testing.T) {
 		})
 	}
 }
+
+func TestHandleDownload_Checksum(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+
+	GlobalPool = download.NewWorkerPool(nil, 1)
+	svc := core.NewLocalDownloadService(GlobalPool)
+
+	post := func(r DownloadRequest) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(r)
+		req := httptest.NewRequest("POST", "/download", bytes.NewBuffer(body))
+		w := httptest.NewRecorder()
+		handleDownload(w, req, tempDir, svc)
+		return w
+	}
+
+	w := post(DownloadRequest{URL: "http://example.com/bad", Checksum: "sha256:nothex", SkipApproval: true})
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for invalid checksum, got %d", w.Code)
+	}
+
+	digest := strings.Repeat("AB", 32)
+	w = post(DownloadRequest{URL: "http://example.com/good", Checksum: "SHA256:" + digest, SkipApproval: true})
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	for _, cfg := range GlobalPool.GetAll() {
+		if cfg.URL == "http://example.com/good" {
+			if want := "sha256:" + strings.ToLower(digest); cfg.Checksum != want {
+				t.Errorf("Checksum = %q, want %q", cfg.Checksum, want)
+			}
+			return
+		}
+	}
+	t.Error("Download with checksum was not queued")
+}
+
+func TestHandleDownload_Metalink(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+
+	GlobalPool = download.NewWorkerPool(nil, 1)
+	svc := core.NewLocalDownloadService(GlobalPool)
+
+	doc := `<?xml version="1.0" encoding="UTF-8"?>
+<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+  <file name="distro.iso">
+    <size>4096</size>
+    <hash type="sha-256">` + strings.Repeat("ab", 32) + `</hash>
+    <url priority="2">http://mirror-b.example.com/distro.iso</url>
+    <url priority="1">http://mirror-a.example.com/distro.iso</url>
+  </file>
+</metalink>`
+
+	req := httptest.NewRequest("POST", "/download", strings.NewReader(doc))
+	req.Header.Set("Content-Type", "application/metalink4+xml")
+	w := httptest.NewRecorder()
+	handleDownload(w, req, tempDir, svc)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	for _, cfg := range GlobalPool.GetAll() {
+		if cfg.URL != "http://mirror-a.example.com/distro.iso" {
+			continue
+		}
+		if cfg.Filename != "distro.iso" {
+			t.Errorf("Filename = %q, want distro.iso", cfg.Filename)
+		}
+		if len(cfg.Mirrors) != 2 || cfg.Mirrors[1] != "http://mirror-b.example.com/distro.iso" {
+			t.Errorf("Mirrors = %v", cfg.Mirrors)
+		}
+		if cfg.Checksum != "sha256:"+strings.Repeat("ab", 32) {
+			t.Errorf("Checksum = %q", cfg.Checksum)
+		}
+		if cfg.ExpectedSize != 4096 {
+			t.Errorf("ExpectedSize = %d, want 4096", cfg.ExpectedSize)
+		}
+		return
+	}
+	t.Error("Metalink download was not queued from its highest-priority URL")
+}
+
+func TestHandleDownload_MetalinkInvalid(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+
+	GlobalPool = download.NewWorkerPool(nil, 1)
+	svc := core.NewLocalDownloadService(GlobalPool)
+
+	req := httptest.NewRequest("POST", "/download", strings.NewReader("<metalink/>"))
+	req.Header.Set("Content-Type", "application/metalink4+xml")
+	w := httptest.NewRecorder()
+	handleDownload(w, req, tempDir, svc)
+
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("Expected 400 for empty metalink, got %d", w.Code)
+	}
+}
+
+func TestHandleCrawl(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+
+	release := make(chan struct{})
+	listing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		switch r.URL.Path {
+		case "/pub/":
+			_, _ = w.Write([]byte(`<pre><a href="../">../</a>
+<a href="sub/">sub/</a>      31-Jan-2024 10:15    -
+<a href="a.bin">a.bin</a>    31-Jan-2024 10:15    10
+</pre>`))
+		case "/pub/sub/":
+			_, _ = w.Write([]byte(`<pre><a href="b.bin">b.bin</a>    31-Jan-2024 10:15    10</pre>`))
+		default:
+			// Keep the queued downloads from finishing while they are checked
+			<-release
+		}
+	}))
+	defer listing.Close()
+	defer close(release)
+
+	GlobalPool = download.NewWorkerPool(nil, 1)
+	svc := core.NewLocalDownloadService(GlobalPool)
+
+	outDir := filepath.Join(tempDir, "out")
+	body, _ := json.Marshal(CrawlRequest{URL: listing.URL + "/pub/", Path: outDir})
+	req := httptest.NewRequest("POST", "/crawl", bytes.NewReader(body))
+	w := httptest.NewRecorder()
+	handleCrawl(w, req, tempDir, svc)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("Expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	var resp CrawlResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Files) != 2 || len(resp.IDs) != 2 {
+		t.Fatalf("Expected 2 files queued, got %+v", resp)
+	}
+
+	want := map[string]string{
+		listing.URL + "/pub/a.bin":     outDir,
+		listing.URL + "/pub/sub/b.bin": filepath.Join(outDir, "sub"),
+	}
+	for _, cfg := range GlobalPool.GetAll() {
+		dir, ok := want[cfg.URL]
+		if !ok {
+			continue
+		}
+		if cfg.OutputPath != dir {
+			t.Errorf("%s queued to %s, want %s", cfg.URL, cfg.OutputPath, dir)
+		}
+		if !cfg.KeepDir {
+			t.Errorf("%s may be moved into a category directory", cfg.URL)
+		}
+		delete(want, cfg.URL)
+	}
+	if len(want) > 0 {
+		t.Errorf("Not queued: %v", want)
+	}
+	if info, err := os.Stat(filepath.Join(outDir, "sub")); err != nil || !info.IsDir() {
+		t.Errorf("Subfolder was not created: %v", err)
+	}
+}
+
+func TestHandleLimit(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	t.Cleanup(func() { ratelimit.Global().SetRate(0) })
+
+	// Server that never answers keeps the download active in the pool
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+
+	GlobalPool = download.NewWorkerPool(nil, 1)
+	svc := core.NewLocalDownloadService(GlobalPool)
+
+	id, err := svc.AddWithOptions(server.URL+"/file.bin", tempDir, "file.bin", nil, nil, types.DownloadOptions{RateLimit: 64 * 1024})
+	if err != nil {
+		t.Fatalf("AddWithOptions failed: %v", err)
+	}
+	if st := GlobalPool.GetStatus(id); st == nil || st.RateLimit != 64*1024 {
+		t.Fatalf("expected initial rate limit of 64K, got %+v", st)
+	}
+
+	limit := func(method, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/limit?"+query, nil)
+		w := httptest.NewRecorder()
+		handleLimit(w, req, svc)
+		return w
+	}
+
+	if w := limit("GET", "rate=1M"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: expected 405, got %d", w.Code)
+	}
+	if w := limit("POST", ""); w.Code != http.StatusBadRequest {
+		t.Errorf("missing rate: expected 400, got %d", w.Code)
+	}
+	if w := limit("POST", "rate=fast"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid rate: expected 400, got %d", w.Code)
+	}
+	if w := limit("POST", "id=missing&rate=1M"); w.Code != http.StatusInternalServerError {
+		t.Errorf("unknown id: expected 500, got %d", w.Code)
+	}
+
+	if w := limit("POST", "rate=2M"); w.Code != http.StatusOK {
+		t.Fatalf("global limit: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := ratelimit.Global().Rate(); got != 2*1024*1024 {
+		t.Errorf("global rate = %d, want %d", got, 2*1024*1024)
+	}
+
+	if w := limit("POST", "id="+id+"&rate=512K"); w.Code != http.StatusOK {
+		t.Fatalf("download limit: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if st := GlobalPool.GetStatus(id); st == nil || st.RateLimit != 512*1024 {
+		t.Errorf("expected rate limit of 512K after update, got %+v", st)
+	}
+}
+
+func TestHandleQueue(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	state.CloseDB()
+	state.Configure(filepath.Join(tempDir, "surge.db"))
+	defer state.CloseDB()
+
+	// Server that never answers keeps the first download running,
+	// so the rest stay queued
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+
+	GlobalPool = download.NewWorkerPool(nil, 1)
+	defer func() {
+		close(release)
+		GlobalPool.GracefulShutdown()
+	}()
+	svc := core.NewLocalDownloadService(GlobalPool)
+
+	var ids []string
+	for _, name := range []string{"running.bin", "a.bin", "b.bin"} {
+		id, err := svc.Add(server.URL+"/"+name, tempDir, name, nil, nil)
+		if err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+		ids = append(ids, id)
+	}
+
+	queue := func(method, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/queue?"+query, nil)
+		w := httptest.NewRecorder()
+		handleQueue(w, req, svc)
+		return w
+	}
+	listQueue := func() []string {
+		w := queue("GET", "")
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET: expected 200, got %d: %s", w.Code, w.Body.String())
+		}
+		var statuses []types.DownloadStatus
+		if err := json.NewDecoder(w.Body).Decode(&statuses); err != nil {
+			t.Fatalf("failed to decode queue: %v", err)
+		}
+		var got []string
+		for _, st := range statuses {
+			got = append(got, st.ID)
+		}
+		return got
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(GlobalPool.Queued()) != 2 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := listQueue(); len(got) != 2 || got[0] != ids[1] || got[1] != ids[2] {
+		t.Fatalf("queue = %v, want %v", got, ids[1:])
+	}
+
+	if w := queue("DELETE", "id="+ids[2]); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("DELETE: expected 405, got %d", w.Code)
+	}
+	if w := queue("POST", "move=top"); w.Code != http.StatusBadRequest {
+		t.Errorf("missing id: expected 400, got %d", w.Code)
+	}
+	if w := queue("POST", "id="+ids[2]); w.Code != http.StatusBadRequest {
+		t.Errorf("missing move: expected 400, got %d", w.Code)
+	}
+	if w := queue("POST", "id="+ids[2]+"&move=sideways"); w.Code != http.StatusBadRequest {
+		t.Errorf("invalid move: expected 400, got %d", w.Code)
+	}
+	if w := queue("POST", "id="+ids[0]+"&move=top"); w.Code != http.StatusConflict {
+		t.Errorf("running download: expected 409, got %d", w.Code)
+	}
+
+	if w := queue("POST", "id="+ids[2]+"&move=top"); w.Code != http.StatusOK {
+		t.Fatalf("move: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := listQueue(); len(got) != 2 || got[0] != ids[2] {
+		t.Errorf("queue after move = %v, want %s first", got, ids[2])
+	}
+
+	if w := queue("POST", "id="+ids[2]+"&priority=low"); w.Code != http.StatusOK {
+		t.Fatalf("priority: expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := listQueue(); len(got) != 2 || got[1] != ids[2] {
+		t.Errorf("queue after lowering priority = %v, want %s last", got, ids[2])
+	}
+	if st := GlobalPool.GetStatus(ids[2]); st == nil || st.Priority != types.PriorityLow {
+		t.Errorf("expected low priority, got %+v", st)
+	}
+}
+
+func TestHandleConcurrency(t *testing.T) {
+	GlobalPool = download.NewWorkerPool(nil, 2)
+	svc := core.NewLocalDownloadService(GlobalPool)
+
+	concurrency := func(method, query string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/concurrency?"+query, nil)
+		w := httptest.NewRecorder()
+		handleConcurrency(w, req, svc)
+		return w
+	}
+
+	if w := concurrency("GET", "max=4"); w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("GET: expected 405, got %d", w.Code)
+	}
+	for _, query := range []string{"", "max=0", "max=many"} {
+		if w := concurrency("POST", query); w.Code != http.StatusBadRequest {
+			t.Errorf("%q: expected 400, got %d", query, w.Code)
+		}
+	}
+
+	if w := concurrency("POST", "max=5"); w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if got := GlobalPool.MaxDownloads(); got != 5 {
+		t.Errorf("MaxDownloads() = %d, want 5", got)
+	}
+}
+
+func TestHandleMetrics(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	state.CloseDB()
+	state.Configure(filepath.Join(tempDir, "surge.db"))
+	defer state.CloseDB()
+
+	// Server that never answers keeps the first download running,
+	// so the second stays queued
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+
+	GlobalPool = download.NewWorkerPool(nil, 1)
+	defer func() {
+		close(release)
+		GlobalPool.GracefulShutdown()
+	}()
+	svc := core.NewLocalDownloadService(GlobalPool)
+	for _, name := range []string{"running.bin", "waiting.bin"} {
+		if _, err := svc.Add(server.URL+"/"+name, tempDir, name, nil, nil); err != nil {
+			t.Fatalf("Add failed: %v", err)
+		}
+	}
+	// The pool starts the first download asynchronously
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		statuses, err := svc.List()
+		if err != nil {
+			t.Fatal(err)
+		}
+		started := false
+		for _, st := range statuses {
+			started = started || st.Status == "downloading"
+		}
+		if started {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("first download never started: %+v", statuses)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/metrics", nil)
+	w := httptest.NewRecorder()
+	handleMetrics(w, req, svc)
+	if w.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST: expected 405, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	handleMetrics(w, httptest.NewRequest(http.MethodGet, "/metrics", nil), svc)
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected 200, got %d: %s", w.Code, w.Body.String())
+	}
+	body := w.Body.String()
+	for _, want := range []string{
+		`surge_build_info{version="` + Version + `"} 1`,
+		`surge_downloads{state="active"} 1`,
+		`surge_downloads{state="queued"} 1`,
+		`surge_downloads{state="error"} 0`,
+		"# TYPE surge_downloaded_bytes_total counter",
+		"# TYPE surge_slow_worker_cancellations_total counter",
+		`surge_probe_duration_seconds_bucket{le="+Inf"}`,
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("metrics missing %q:\n%s", want, body)
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/spf13/cobra"
+	"github.com/surge-downloader/surge/internal/core"
+	"github.com/surge-downloader/surge/internal/engine/ratelimit"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+var limitCmd = &cobra.Command{
+	Use:   "limit [ID] <rate>",
+	Short: "Limit download speed",
+	Long: `Change the bandwidth cap of a running Surge instance.
+With one argument the global cap shared by all downloads is changed.
+With an ID the cap applies to that download only.
+Rates accept K, M and G suffixes (e.g. 512K, 2M); 0 removes the cap.`,
+	Args: cobra.RangeArgs(1, 2),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeGlobalState()
+
+		rateArg := args[len(args)-1]
+		rate, err := ratelimit.ParseRate(rateArg)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		port := readActivePort()
+		if port == 0 {
+			fmt.Println("Error: Surge is not running.")
+			os.Exit(1)
+		}
+
+		query := url.Values{}
+		query.Set("rate", strconv.FormatInt(rate, 10))
+		target := "all downloads"
+		if len(args) == 2 {
+			id, err := resolveDownloadID(args[0])
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+				os.Exit(1)
+			}
+			query.Set("id", id)
+			target = "download " + id[:8]
+		}
+
+		req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://127.0.0.1:%d/limit?%s", port, query.Encode()), nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		req.Header.Set("Authorization", "Bearer "+ensureAuthToken())
+
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error connecting to server: %v\n", err)
+			os.Exit(1)
+		}
+		defer func() {
+			if err := resp.Body.Close(); err != nil {
+				utils.Debug("Error closing response body: %v", err)
+			}
+		}()
+
+		if resp.StatusCode != http.StatusOK {
+			fmt.Fprintf(os.Stderr, "Error: server returned %s\n", resp.Status)
+			os.Exit(1)
+		}
+
+		if rate == 0 {
+			fmt.Printf("Removed speed limit for %s\n", target)
+		} else {
+			fmt.Printf("Limited %s to %s/s\n", target, utils.ConvertBytesToHumanReadable(rate))
+		}
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(limitCmd)
+}
+
+// handleLimit changes a bandwidth cap. "rate" is required and accepts values
+// like "512K"; "id" selects a download, otherwise the global cap is changed.
+func handleLimit(w http.ResponseWriter, r *http.Request, service core.DownloadService) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rateParam := r.URL.Query().Get("rate")
+	if rateParam == "" {
+		http.Error(w, "Missing rate parameter", http.StatusBadRequest)
+		return
+	}
+	rate, err := ratelimit.ParseRate(rateParam)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if service == nil {
+		http.Error(w, "Service unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		err = service.SetGlobalRateLimit(rate)
+	} else {
+		err = service.SetRateLimit(id, rate)
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"status": "limited", "id": id, "rate_limit": rate}); err != nil {
+		utils.Debug("Failed to encode response: %v", err)
+	}
+}
+
+// handleConcurrency changes how many downloads run at once. "max" is required.
+// The change lasts until the next restart; settings.json is not modified.
+func handleConcurrency(w http.ResponseWriter, r *http.Request, service core.DownloadService) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	n, err := strconv.Atoi(r.URL.Query().Get("max"))
+	if err != nil || n < 1 {
+		http.Error(w, "Invalid max parameter", http.StatusBadRequest)
+		return
+	}
+
+	if service == nil {
+		http.Error(w, "Service unavailable", http.StatusInternalServerError)
+		return
+	}
+	if err := service.SetMaxConcurrentDownloads(n); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{"status": "updated", "max_downloads": n}); err != nil {
+		utils.Debug("Failed to encode response: %v", err)
+	}
+}
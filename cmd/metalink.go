@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/core"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/metalink"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// expandDownloadArgs turns CLI arguments into download requests.
+// Plain arguments may carry comma-separated mirrors and get opts applied.
+// Metalink files and URLs expand into one request per described file.
+func expandDownloadArgs(args []string, outputDir string, opts types.DownloadOptions) []DownloadRequest {
+	var requests []DownloadRequest
+	for _, arg := range args {
+		if arg == "" {
+			continue
+		}
+
+		if metalink.IsMetalink(arg) {
+			ml, err := metalink.Load(context.Background(), arg)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Error reading metalink %s: %v\n", arg, err)
+				continue
+			}
+			for _, req := range metalinkRequests(ml, outputDir) {
+				req.RateLimit = opts.RateLimit
+				req.Priority = opts.Priority
+				req.Category = opts.Category
+				requests = append(requests, req)
+			}
+			continue
+		}
+
+		url, mirrors := ParseURLArg(arg)
+		if url == "" {
+			continue
+		}
+		requests = append(requests, DownloadRequest{
+			URL:       url,
+			Mirrors:   mirrors,
+			Path:      outputDir,
+			Checksum:  opts.Checksum,
+			Pieces:    opts.Pieces,
+			Size:      opts.Size,
+			RateLimit: opts.RateLimit,
+			Priority:  opts.Priority,
+			Category:  opts.Category,
+			Variant:   opts.Variant,
+		})
+	}
+	return requests
+}
+
+// metalinkRequests converts each file of a Metalink into a download request
+func metalinkRequests(ml *metalink.Metalink, outputDir string) []DownloadRequest {
+	requests := make([]DownloadRequest, 0, len(ml.Files))
+	for _, f := range ml.Files {
+		mirrors := f.Mirrors()
+		opts := f.Options()
+		requests = append(requests, DownloadRequest{
+			URL:      mirrors[0],
+			Filename: f.Name,
+			Mirrors:  mirrors,
+			Path:     outputDir,
+			Checksum: opts.Checksum,
+			Pieces:   opts.Pieces,
+			Size:     opts.Size,
+		})
+	}
+	return requests
+}
+
+// handleMetalinkDownload queues every file of a Metalink document posted to /download.
+// The destination can be set with the "path" query parameter.
+func handleMetalinkDownload(w http.ResponseWriter, r *http.Request, defaultOutputDir string, settings *config.Settings, service core.DownloadService) {
+	defer func() {
+		if err := r.Body.Close(); err != nil {
+			utils.Debug("Error closing body: %v", err)
+		}
+	}()
+
+	ml, err := metalink.Parse(r.Body)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if service == nil {
+		http.Error(w, "Service unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	reqPath := r.URL.Query().Get("path")
+	if strings.Contains(reqPath, "..") {
+		http.Error(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+	outPath, err := resolveOutputPath(reqPath, r.URL.Query().Get("relative") == "true", defaultOutputDir, settings)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	ids := make([]string, 0, len(ml.Files))
+	for _, req := range metalinkRequests(ml, outPath) {
+		id, err := service.AddWithOptions(req.URL, req.Path, req.Filename, req.Mirrors, nil, req.options())
+		if err != nil {
+			http.Error(w, "Failed to add download: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		atomic.AddInt32(&activeDownloads, 1)
+		ids = append(ids, id)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]interface{}{
+		"status":  "queued",
+		"message": fmt.Sprintf("%d downloads queued from metalink", len(ids)),
+		"id":      ids[0],
+		"ids":     ids,
+	}); err != nil {
+		utils.Debug("Failed to encode response: %v", err)
+	}
+}
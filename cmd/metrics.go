@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"sort"
+
+	"github.com/surge-downloader/surge/internal/core"
+	"github.com/surge-downloader/surge/internal/engine/metrics"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// metricsStates are the download states reported by surge_downloads
+var metricsStates = []string{"active", "queued", "paused", "error", "completed"}
+
+// handleMetrics serves Prometheus metrics: the engine counters, plus gauges
+// computed from the current download list
+func handleMetrics(w http.ResponseWriter, r *http.Request, service core.DownloadService) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if service == nil {
+		http.Error(w, "Service unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	statuses, err := service.List()
+	if err != nil {
+		http.Error(w, "Failed to list downloads: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	counts := make(map[string]float64)
+	hostConns := make(map[string]float64)
+	var speed float64
+	for _, st := range statuses {
+		state := st.Status
+		if state == "downloading" || state == "pausing" {
+			state = "active"
+			speed += st.Speed * 1024 * 1024
+			if u, err := url.Parse(st.URL); err == nil && u.Host != "" && st.Connections > 0 {
+				hostConns[u.Host] += float64(st.Connections)
+			}
+		}
+		counts[state]++
+	}
+
+	stateSamples := make([]metrics.Sample, 0, len(metricsStates))
+	for _, state := range metricsStates {
+		stateSamples = append(stateSamples, metrics.Sample{Labels: map[string]string{"state": state}, Value: counts[state]})
+	}
+	hosts := make([]string, 0, len(hostConns))
+	for host := range hostConns {
+		hosts = append(hosts, host)
+	}
+	sort.Strings(hosts)
+	hostSamples := make([]metrics.Sample, 0, len(hosts))
+	for _, host := range hosts {
+		hostSamples = append(hostSamples, metrics.Sample{Labels: map[string]string{"host": host}, Value: hostConns[host]})
+	}
+
+	var buf bytes.Buffer
+	metrics.WriteGauge(&buf, "surge_build_info", "Version of the running Surge.", metrics.Sample{Labels: map[string]string{"version": Version}, Value: 1})
+	metrics.WriteGauge(&buf, "surge_downloads", "Downloads by state.", stateSamples...)
+	metrics.WriteGauge(&buf, "surge_download_speed_bytes", "Combined speed of active downloads in bytes per second.", metrics.Sample{Value: speed})
+	metrics.WriteGauge(&buf, "surge_host_connections", "Open connections of active downloads by host.", hostSamples...)
+	metrics.WriteEngine(&buf)
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		utils.Debug("Failed to write metrics: %v", err)
+	}
+}
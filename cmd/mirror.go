@@ -0,0 +1,167 @@
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+
+	"github.com/spf13/cobra"
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/core"
+	"github.com/surge-downloader/surge/internal/mirror"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// MirrorRequest is the body of a POST to /mirror
+type MirrorRequest struct {
+	URL                  string `json:"url"`
+	Path                 string `json:"path,omitempty"`
+	RelativeToDefaultDir bool   `json:"relative_to_default_dir,omitempty"`
+	mirror.Options
+}
+
+var mirrorCmd = &cobra.Command{
+	Use:   "mirror <url>",
+	Short: "Copy a small static site for offline use",
+	Long: `Download the page at <url> with the images, stylesheets and scripts it
+needs, and the pages it links to on the same host under the same folder.
+Links are rewritten to point at the local copies, so the site can be browsed
+from disk. Links that are not followed are made absolute.
+
+Every file is queued as a normal download, so progress shows in the TUI and
+in "surge ls". Files are saved under the output directory in a folder per
+host, e.g. example.com/docs/index.html.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeGlobalState()
+
+		output, _ := cmd.Flags().GetString("output")
+		req := MirrorRequest{URL: args[0]}
+		req.MaxDepth, _ = cmd.Flags().GetInt("depth")
+		req.SpanHosts, _ = cmd.Flags().GetBool("span-hosts")
+		req.MaxFiles, _ = cmd.Flags().GetInt("max-files")
+		if output != "" {
+			req.Path = utils.EnsureAbsPath(output)
+		}
+
+		port := readActivePort()
+		if port == 0 {
+			fmt.Println("Error: Surge is not running.")
+			os.Exit(1)
+		}
+
+		id, err := sendMirror(port, req)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		if len(id) > 8 {
+			id = id[:8]
+		}
+		fmt.Printf("Mirroring %s [%s]\n", args[0], id)
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(mirrorCmd)
+	mirrorCmd.Flags().StringP("output", "o", "", "Output directory (defaults to the default download directory)")
+	mirrorCmd.Flags().Int("depth", 5, "Levels of links to follow from the first page (0 for no limit)")
+	mirrorCmd.Flags().Bool("span-hosts", false, "Also fetch images, styles and scripts from other hosts")
+	mirrorCmd.Flags().Int("max-files", mirror.DefaultMaxFiles, "Stop following links after this many files")
+}
+
+// sendMirror asks the running instance to mirror a site and returns its ID
+func sendMirror(port int, mirrorReq MirrorRequest) (string, error) {
+	body, err := json.Marshal(mirrorReq)
+	if err != nil {
+		return "", err
+	}
+	req, err := http.NewRequest(http.MethodPost, fmt.Sprintf("http://127.0.0.1:%d/mirror", port), bytes.NewReader(body))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+ensureAuthToken())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("error connecting to server: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			utils.Debug("Error closing response body: %v", err)
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return "", fmt.Errorf("server error: %s - %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var result map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	return result["id"], nil
+}
+
+// handleMirror starts the site mirror described by a POSTed MirrorRequest
+func handleMirror(w http.ResponseWriter, r *http.Request, defaultOutputDir string, service core.DownloadService) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	defer func() {
+		if err := r.Body.Close(); err != nil {
+			utils.Debug("Error closing body: %v", err)
+		}
+	}()
+
+	var req MirrorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.URL == "" {
+		http.Error(w, "URL is required", http.StatusBadRequest)
+		return
+	}
+	if strings.Contains(req.Path, "..") {
+		http.Error(w, "Invalid path", http.StatusBadRequest)
+		return
+	}
+	if service == nil {
+		http.Error(w, "Service unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	settings, err := config.LoadSettings()
+	if err != nil {
+		settings = config.DefaultSettings()
+	}
+	outPath, err := resolveOutputPath(req.Path, req.RelativeToDefaultDir, defaultOutputDir, settings)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	id, err := service.Mirror(req.URL, outPath, req.Options)
+	if err != nil {
+		http.Error(w, "Failed to start mirror: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	atomic.AddInt32(&activeDownloads, 1)
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(map[string]string{
+		"status":  "queued",
+		"message": "Mirror started",
+		"id":      id,
+	}); err != nil {
+		utils.Debug("Failed to encode response: %v", err)
+	}
+}
@@ -0,0 +1,277 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/surge-downloader/surge/internal/core"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+var queueCmd = &cobra.Command{
+	Use:   "queue",
+	Short: "Show and reorder queued downloads",
+	Long: `List the downloads waiting to start, in the order they will start.
+Higher priority downloads start first; within a priority, the order can be
+changed with "surge queue move". The queue is kept across restarts.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeGlobalState()
+
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+
+		port := readActivePort()
+		if port == 0 {
+			fmt.Println("Error: Surge is not running.")
+			os.Exit(1)
+		}
+
+		resp, err := queueRequest(port, http.MethodGet, nil)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		defer func() {
+			if err := resp.Body.Close(); err != nil {
+				utils.Debug("Error closing response body: %v", err)
+			}
+		}()
+
+		var queued []types.DownloadStatus
+		if err := json.NewDecoder(resp.Body).Decode(&queued); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if jsonOutput {
+			data, _ := json.MarshalIndent(queued, "", "  ")
+			fmt.Println(string(data))
+			return
+		}
+
+		if len(queued) == 0 {
+			fmt.Println("No downloads queued.")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "#\tID\tFILENAME\tPRIORITY\tSIZE")
+		_, _ = fmt.Fprintln(w, "-\t--\t--------\t--------\t----")
+		for _, d := range queued {
+			id := d.ID
+			if len(id) > 8 {
+				id = id[:8]
+			}
+			filename := d.Filename
+			if len(filename) > 25 {
+				filename = filename[:22] + "..."
+			}
+			size := "-"
+			if d.TotalSize > 0 {
+				size = utils.ConvertBytesToHumanReadable(d.TotalSize)
+			}
+			_, _ = fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\n", d.QueuePos, id, filename, priorityName(d.Priority), size)
+		}
+		_ = w.Flush()
+	},
+}
+
+var queueMoveCmd = &cobra.Command{
+	Use:   "move <ID> <top|bottom|up|down>",
+	Short: "Move a queued download",
+	Long: `Move a queued download to the top or bottom of the queue, or one place up or down.
+Moving past downloads of another priority takes on their priority.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeGlobalState()
+
+		move, err := types.ParseQueueMove(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		id := sendQueueChange(args[0], "move", string(move))
+		fmt.Printf("Moved download %s %s\n", id[:8], move)
+	},
+}
+
+var queuePriorityCmd = &cobra.Command{
+	Use:   "priority <ID> <high|normal|low|N>",
+	Short: "Change the priority of a download",
+	Long: `Change the queue priority of a download. Higher priorities start first.
+Downloads that are already running keep the priority for when they are queued again.`,
+	Args: cobra.ExactArgs(2),
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeGlobalState()
+
+		priority, err := types.ParsePriority(args[1])
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		id := sendQueueChange(args[0], "priority", strconv.Itoa(priority))
+		fmt.Printf("Set priority of download %s to %s\n", id[:8], priorityName(priority))
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(queueCmd)
+	queueCmd.AddCommand(queueMoveCmd)
+	queueCmd.AddCommand(queuePriorityCmd)
+	queueCmd.Flags().Bool("json", false, "Output in JSON format")
+}
+
+// sendQueueChange resolves partialID and posts one queue change to the running
+// instance, exiting on failure. Returns the full download ID.
+func sendQueueChange(partialID, key, value string) string {
+	port := readActivePort()
+	if port == 0 {
+		fmt.Println("Error: Surge is not running.")
+		os.Exit(1)
+	}
+
+	id, err := resolveDownloadID(partialID)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+
+	query := url.Values{}
+	query.Set("id", id)
+	query.Set(key, value)
+	resp, err := queueRequest(port, http.MethodPost, query)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	if err := resp.Body.Close(); err != nil {
+		utils.Debug("Error closing response body: %v", err)
+	}
+	return id
+}
+
+// queueRequest calls the /queue endpoint of the running instance
+func queueRequest(port int, method string, query url.Values) (*http.Response, error) {
+	target := fmt.Sprintf("http://127.0.0.1:%d/queue", port)
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+ensureAuthToken())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to server: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("server error: %s - %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// priorityName returns the name of a standard priority, or the number
+func priorityName(p int) string {
+	switch p {
+	case types.PriorityHigh:
+		return "high"
+	case types.PriorityNormal:
+		return "normal"
+	case types.PriorityLow:
+		return "low"
+	}
+	return strconv.Itoa(p)
+}
+
+// handleQueue lists queued downloads in start order on GET. POST changes one
+// download selected by "id": "move" is top, bottom, up or down, and
+// "priority" is high, normal, low or a number.
+func handleQueue(w http.ResponseWriter, r *http.Request, service core.DownloadService) {
+	if service == nil {
+		http.Error(w, "Service unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		statuses, err := service.List()
+		if err != nil {
+			http.Error(w, "Failed to list downloads: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		queued := make([]types.DownloadStatus, 0)
+		for _, s := range statuses {
+			if s.Status == "queued" && s.QueuePos > 0 {
+				queued = append(queued, s)
+			}
+		}
+		sort.Slice(queued, func(i, j int) bool { return queued[i].QueuePos < queued[j].QueuePos })
+
+		w.Header().Set("Content-Type", "application/json")
+		if err := json.NewEncoder(w).Encode(queued); err != nil {
+			utils.Debug("Failed to encode response: %v", err)
+		}
+		return
+	case http.MethodPost:
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := r.URL.Query()
+	id := query.Get("id")
+	if id == "" {
+		http.Error(w, "Missing id parameter", http.StatusBadRequest)
+		return
+	}
+
+	resp := map[string]interface{}{"status": "updated", "id": id}
+	switch {
+	case query.Has("move"):
+		move, err := types.ParseQueueMove(query.Get("move"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := service.Move(id, move); err != nil {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		resp["move"] = move
+	case query.Has("priority"):
+		priority, err := types.ParsePriority(query.Get("priority"))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := service.SetPriority(id, priority); err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		resp["priority"] = priority
+	default:
+		http.Error(w, "Missing move or priority parameter", http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		utils.Debug("Failed to encode response: %v", err)
+	}
+}
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"context"
-	"crypto/subtle"
 	"encoding/json"
 	"fmt"
 	"net"
@@ -15,11 +14,15 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/surge-downloader/surge/internal/auth"
 	"github.com/surge-downloader/surge/internal/config"
 	"github.com/surge-downloader/surge/internal/core"
 	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/checksum"
 	"github.com/surge-downloader/surge/internal/engine/events"
 	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/metalink"
 	"github.com/surge-downloader/surge/internal/tui"
 	"github.com/surge-downloader/surge/internal/utils"
 
@@ -37,6 +40,17 @@ var (
 // activeDownloads tracks the number of currently running downloads in headless mode
 var activeDownloads int32
 
+// finishActiveDownload counts a download as ended. Files a site mirror queues
+// on its own were never counted, so the count stops at zero.
+func finishActiveDownload() {
+	for {
+		n := atomic.LoadInt32(&activeDownloads)
+		if n <= 0 || atomic.CompareAndSwapInt32(&activeDownloads, n, n-1) {
+			return
+		}
+	}
+}
+
 // Command line flags
 var verbose bool
 
@@ -98,6 +112,7 @@ var rootCmd = &cobra.Command{
 				utils.Debug("Error releasing lock: %v", err)
 			}
 		}()
+		requeueInterrupted()
 
 		// Initialize Service
 		GlobalService = core.NewLocalDownloadServiceWithInput(GlobalPool, GlobalProgressCh)
@@ -113,16 +128,27 @@ var rootCmd = &cobra.Command{
 			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 			os.Exit(1)
 		}
+		listener, fingerprint, err := wrapServerTLS(listener, cmd)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
 
 		// Save port for browser extension AND CLI discovery
 		saveActivePort(port)
 		defer removeActivePort()
+		if fingerprint != "" {
+			saveActiveFingerprint(fingerprint)
+			defer removeActiveFingerprint()
+		}
 
 		// Start HTTP server in background (reuse the listener)
 		go startHTTPServer(listener, port, outputDir, GlobalService)
 
 		// Queue initial downloads if any
 		go func() {
+			restoreQueue()
+
 			var urls []string
 			urls = append(urls, args...)
 
@@ -245,14 +271,14 @@ func StartHeadlessConsumer() {
 				}
 				fmt.Printf("Started: %s [%s]\n", m.Filename, id)
 			case events.DownloadCompleteMsg:
-				atomic.AddInt32(&activeDownloads, -1)
+				finishActiveDownload()
 				id := m.DownloadID
 				if len(id) > 8 {
 					id = id[:8]
 				}
 				fmt.Printf("Completed: %s [%s] (in %s)\n", m.Filename, id, m.Elapsed)
 			case events.DownloadErrorMsg:
-				atomic.AddInt32(&activeDownloads, -1)
+				finishActiveDownload()
 				id := m.DownloadID
 				if len(id) > 8 {
 					id = id[:8]
@@ -282,6 +308,22 @@ func StartHeadlessConsumer() {
 					id = id[:8]
 				}
 				fmt.Printf("Removed: %s [%s]\n", m.Filename, id)
+			case events.ExtractDoneMsg:
+				id := m.DownloadID
+				if len(id) > 8 {
+					id = id[:8]
+				}
+				if m.Err != "" {
+					fmt.Printf("Extract failed: %s [%s]: %s\n", m.Filename, id, m.Err)
+				} else {
+					fmt.Printf("Extracted: %s [%s] to %s (%d files)\n", m.Filename, id, m.Dir, m.Files)
+				}
+			case events.MirrorDoneMsg:
+				id := m.MirrorID
+				if len(id) > 8 {
+					id = id[:8]
+				}
+				fmt.Printf("Mirrored: %s [%s] to %s (%d files, %d failed)\n", m.URL, id, m.Index, m.Files, m.Failed)
 			}
 		}
 	}()
@@ -334,7 +376,8 @@ func removeActivePort() {
 
 // startHTTPServer starts the HTTP server using an existing listener
 func startHTTPServer(ln net.Listener, port int, defaultOutputDir string, service core.DownloadService) {
-	authToken := ensureAuthToken()
+	ensureAuthToken() // Created on first start, for local clients to read
+	tokens := tokenStore()
 
 	mux := http.NewServeMux()
 
@@ -393,31 +436,9 @@ func startHTTPServer(ln net.Listener, port int, defaultOutputDir string, service
 					continue
 				}
 
-				// Determine event type name based on struct
-				// Events are in internal/engine/events package
-				eventType := "unknown"
-				switch msg := msg.(type) {
-				case events.DownloadStartedMsg:
-					eventType = "started"
-				case events.DownloadCompleteMsg:
-					eventType = "complete"
-				case events.DownloadErrorMsg:
-					eventType = "error"
-				case events.ProgressMsg:
-					eventType = "progress"
-				case events.DownloadPausedMsg:
-					eventType = "paused"
-				case events.DownloadResumedMsg:
-					eventType = "resumed"
-				case events.DownloadQueuedMsg:
-					eventType = "queued"
-				case events.DownloadRemovedMsg:
-					eventType = "removed"
-				case events.DownloadRequestMsg:
-					eventType = "request"
-				case events.BatchProgressMsg:
+				if batch, ok := msg.(events.BatchProgressMsg); ok {
 					// Unroll batch and send individual progress events
-					for _, p := range msg {
+					for _, p := range batch {
 						data, _ := json.Marshal(p)
 						_, _ = fmt.Fprintf(w, "event: progress\n")
 						_, _ = fmt.Fprintf(w, "data: %s\n\n", data)
@@ -426,6 +447,11 @@ func startHTTPServer(ln net.Listener, port int, defaultOutputDir string, service
 					continue // Skip default send
 				}
 
+				eventType := events.Name(msg)
+				if eventType == "" {
+					eventType = "unknown"
+				}
+
 				// SSE Format:
 				// event: <type>
 				// data: <json>
@@ -511,6 +537,44 @@ func startHTTPServer(ln net.Listener, port int, defaultOutputDir string, service
 		}
 	})
 
+	// Bandwidth limit endpoint (Protected)
+	mux.HandleFunc("/limit", func(w http.ResponseWriter, r *http.Request) {
+		handleLimit(w, r, service)
+	})
+
+	// Concurrent download limit endpoint (Protected)
+	mux.HandleFunc("/concurrency", func(w http.ResponseWriter, r *http.Request) {
+		handleConcurrency(w, r, service)
+	})
+
+	// Queue order endpoint (Protected)
+	mux.HandleFunc("/queue", func(w http.ResponseWriter, r *http.Request) {
+		handleQueue(w, r, service)
+	})
+
+	// Directory listing crawl endpoint (Protected)
+	mux.HandleFunc("/crawl", func(w http.ResponseWriter, r *http.Request) {
+		handleCrawl(w, r, defaultOutputDir, service)
+	})
+
+	// Site mirror endpoint (Protected)
+	mux.HandleFunc("/mirror", func(w http.ResponseWriter, r *http.Request) {
+		handleMirror(w, r, defaultOutputDir, service)
+	})
+
+	// Webhook delivery log endpoint (Protected)
+	mux.HandleFunc("/webhooks", func(w http.ResponseWriter, r *http.Request) {
+		handleWebhooks(w, r, service)
+	})
+
+	// Prometheus metrics endpoint (Protected)
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		handleMetrics(w, r, service)
+	})
+
+	// aria2-compatible JSON-RPC endpoint (checks the token itself)
+	mux.Handle("/jsonrpc", newAria2Server(tokens, defaultOutputDir, service))
+
 	// List endpoint (Protected)
 	mux.HandleFunc("/list", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method != http.MethodGet {
@@ -550,7 +614,7 @@ func startHTTPServer(ln net.Listener, port int, defaultOutputDir string, service
 	})
 
 	// Wrap mux with Auth and CORS (CORS outermost to ensure 401/403 include headers)
-	handler := corsMiddleware(authMiddleware(authToken, mux))
+	handler := corsMiddleware(authMiddleware(tokens, mux))
 
 	server := &http.Server{Handler: handler}
 	if err := server.Serve(ln); err != nil && err != http.ErrServerClosed {
@@ -576,7 +640,25 @@ func corsMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func authMiddleware(token string, next http.Handler) http.Handler {
+// requiredScope returns the token scope needed for a request
+func requiredScope(method, path string) auth.Scope {
+	switch path {
+	case "/list", "/history", "/events", "/webhooks", "/metrics", "/queue":
+		if method == http.MethodGet {
+			return auth.ScopeRead
+		}
+	case "/download":
+		if method == http.MethodGet {
+			return auth.ScopeRead
+		}
+		return auth.ScopeAdd
+	case "/crawl", "/mirror":
+		return auth.ScopeAdd
+	}
+	return auth.ScopeAdmin
+}
+
+func authMiddleware(tokens *auth.Store, next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Allow health check without auth
 		if r.URL.Path == "/health" {
@@ -584,6 +666,12 @@ func authMiddleware(token string, next http.Handler) http.Handler {
 			return
 		}
 
+		// aria2 clients send the token inside each call, which /jsonrpc checks
+		if r.URL.Path == "/jsonrpc" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
 		// Allow OPTIONS for CORS preflight
 		if r.Method == "OPTIONS" {
 			next.ServeHTTP(w, r)
@@ -595,7 +683,11 @@ func authMiddleware(token string, next http.Handler) http.Handler {
 		if authHeader != "" {
 			if strings.HasPrefix(authHeader, "Bearer ") {
 				providedToken := strings.TrimPrefix(authHeader, "Bearer ")
-				if len(providedToken) == len(token) && subtle.ConstantTimeCompare([]byte(providedToken), []byte(token)) == 1 {
+				if scope, ok := tokens.Authenticate(providedToken); ok {
+					if !scope.Includes(requiredScope(r.Method, r.URL.Path)) {
+						http.Error(w, "Forbidden: token scope does not allow this request", http.StatusForbidden)
+						return
+					}
 					next.ServeHTTP(w, r)
 					return
 				}
@@ -606,35 +698,49 @@ func authMiddleware(token string, next http.Handler) http.Handler {
 	})
 }
 
+// ensureAuthToken returns the default API token, creating it on first use
 func ensureAuthToken() string {
-	tokenFile := filepath.Join(config.GetStateDir(), "token")
-	data, err := os.ReadFile(tokenFile)
-	if err == nil {
-		return strings.TrimSpace(string(data))
-	}
-
-	// Generate new token
-	token := uuid.New().String()
-
-	// Ensure directory exists
-	if err := os.MkdirAll(filepath.Dir(tokenFile), 0755); err != nil {
-		utils.Debug("Failed to create token directory: %v", err)
-	}
-	if err := os.WriteFile(tokenFile, []byte(token), 0600); err != nil {
+	token, err := tokenStore().Default()
+	if err != nil {
 		utils.Debug("Failed to write token file: %v", err)
 	}
 	return token
 }
 
+// tokenStore returns the store of the default and named API tokens
+func tokenStore() *auth.Store {
+	return auth.NewStore(config.GetStateDir())
+}
+
 // DownloadRequest represents a download request from the browser extension
 type DownloadRequest struct {
-	URL                  string            `json:"url"`
-	Filename             string            `json:"filename,omitempty"`
-	Path                 string            `json:"path,omitempty"`
-	RelativeToDefaultDir bool              `json:"relative_to_default_dir,omitempty"`
-	Mirrors              []string          `json:"mirrors,omitempty"`
-	SkipApproval         bool              `json:"skip_approval,omitempty"` // Extension validated request, skip TUI prompt
-	Headers              map[string]string `json:"headers,omitempty"`       // Custom HTTP headers from browser (cookies, auth, etc.)
+	URL                  string             `json:"url"`
+	Filename             string             `json:"filename,omitempty"`
+	Path                 string             `json:"path,omitempty"`
+	RelativeToDefaultDir bool               `json:"relative_to_default_dir,omitempty"`
+	Mirrors              []string           `json:"mirrors,omitempty"`
+	SkipApproval         bool               `json:"skip_approval,omitempty"` // Extension validated request, skip TUI prompt
+	Headers              map[string]string  `json:"headers,omitempty"`       // Custom HTTP headers from browser (cookies, auth, etc.)
+	Checksum             string             `json:"checksum,omitempty"`      // Expected digest of the finished file ("algo:hex")
+	Pieces               *types.PieceHashes `json:"pieces,omitempty"`        // Expected per-piece digests
+	Size                 int64              `json:"size,omitempty"`          // Expected file size in bytes
+	RateLimit            int64              `json:"rate_limit,omitempty"`    // Bandwidth cap in bytes/sec
+	Priority             int                `json:"priority,omitempty"`      // Queue priority, higher starts first
+	Category             string             `json:"category,omitempty"`      // Category name, empty to match one by the file
+	Variant              string             `json:"variant,omitempty"`       // Rendition of an HLS/DASH stream, e.g. "720p"
+}
+
+// options returns the per-download options carried by the request
+func (r DownloadRequest) options() types.DownloadOptions {
+	return types.DownloadOptions{
+		Checksum:  r.Checksum,
+		Pieces:    r.Pieces,
+		Size:      r.Size,
+		RateLimit: r.RateLimit,
+		Priority:  r.Priority,
+		Category:  r.Category,
+		Variant:   r.Variant,
+	}
 }
 
 func handleDownload(w http.ResponseWriter, r *http.Request, defaultOutputDir string, service core.DownloadService) {
@@ -677,6 +783,12 @@ func handleDownload(w http.ResponseWriter, r *http.Request, defaultOutputDir str
 		settings = config.DefaultSettings()
 	}
 
+	// Metalink documents describe their own URLs, mirrors and hashes
+	if metalink.IsContentType(r.Header.Get("Content-Type")) {
+		handleMetalinkDownload(w, r, defaultOutputDir, settings, service)
+		return
+	}
+
 	var req DownloadRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid JSON: "+err.Error(), http.StatusBadRequest)
@@ -702,6 +814,23 @@ func handleDownload(w http.ResponseWriter, r *http.Request, defaultOutputDir str
 		return
 	}
 
+	if req.Checksum != "" {
+		normalized, err := checksum.Normalize(req.Checksum)
+		if err != nil {
+			http.Error(w, "Invalid checksum: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+		req.Checksum = normalized
+	}
+	if err := checksum.NormalizePieces(req.Pieces); err != nil {
+		http.Error(w, "Invalid piece hashes: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.RateLimit < 0 {
+		http.Error(w, "Invalid rate limit", http.StatusBadRequest)
+		return
+	}
+
 	utils.Debug("Received download request: URL=%s, Path=%s", req.URL, req.Path)
 
 	downloadID := uuid.New().String()
@@ -711,45 +840,12 @@ func handleDownload(w http.ResponseWriter, r *http.Request, defaultOutputDir str
 	}
 
 	// Prepare output path
-	outPath := req.Path
-	if req.RelativeToDefaultDir && req.Path != "" {
-		// Resolve relative to default download directory
-		baseDir := settings.General.DefaultDownloadDir
-		if baseDir == "" {
-			baseDir = defaultOutputDir
-		}
-		if baseDir == "" {
-			baseDir = "."
-		}
-		outPath = filepath.Join(baseDir, req.Path)
-		if err := os.MkdirAll(outPath, 0o755); err != nil {
-			http.Error(w, "Failed to create directory: "+err.Error(), http.StatusInternalServerError)
-			return
-		}
-
-	} else if outPath == "" {
-		if defaultOutputDir != "" {
-			outPath = defaultOutputDir
-			if err := os.MkdirAll(outPath, 0o755); err != nil {
-				http.Error(w, "Failed to create output directory: "+err.Error(), http.StatusInternalServerError)
-				return
-			}
-		} else {
-			if settings.General.DefaultDownloadDir != "" {
-				outPath = settings.General.DefaultDownloadDir
-				if err := os.MkdirAll(outPath, 0o755); err != nil {
-					http.Error(w, "Failed to create output directory: "+err.Error(), http.StatusInternalServerError)
-					return
-				}
-			} else {
-				outPath = "."
-			}
-		}
+	outPath, err := resolveOutputPath(req.Path, req.RelativeToDefaultDir, defaultOutputDir, settings)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
 	}
 
-	// Enforce absolute path to ensure resume works even if CWD changes
-	outPath = utils.EnsureAbsPath(outPath)
-
 	// Check settings for extension prompt and duplicates
 	// Logic modified to distinguish between ACTIVE (corruption risk) and COMPLETED (overwrite safe)
 	isDuplicate := false
@@ -802,6 +898,7 @@ func handleDownload(w http.ResponseWriter, r *http.Request, defaultOutputDir str
 					Path:     outPath, // Use the path we resolved (default or requested)
 					Mirrors:  mirrorsForAdd,
 					Headers:  req.Headers,
+					Options:  req.options(),
 				}); err != nil {
 					http.Error(w, "Failed to notify TUI: "+err.Error(), http.StatusInternalServerError)
 					return
@@ -836,7 +933,7 @@ func handleDownload(w http.ResponseWriter, r *http.Request, defaultOutputDir str
 	}
 
 	// Add via service
-	newID, err := service.Add(urlForAdd, outPath, req.Filename, mirrorsForAdd, req.Headers)
+	newID, err := service.AddWithOptions(urlForAdd, outPath, req.Filename, mirrorsForAdd, req.Headers, req.options())
 	if err != nil {
 		http.Error(w, "Failed to add download: "+err.Error(), http.StatusInternalServerError)
 		return
@@ -855,21 +952,63 @@ func handleDownload(w http.ResponseWriter, r *http.Request, defaultOutputDir str
 	}
 }
 
+// resolveOutputPath picks the directory a download request is saved to and makes sure it exists
+func resolveOutputPath(reqPath string, relativeToDefaultDir bool, defaultOutputDir string, settings *config.Settings) (string, error) {
+	outPath := reqPath
+	if relativeToDefaultDir && reqPath != "" {
+		// Resolve relative to default download directory
+		baseDir := settings.General.DefaultDownloadDir
+		if baseDir == "" {
+			baseDir = defaultOutputDir
+		}
+		if baseDir == "" {
+			baseDir = "."
+		}
+		outPath = filepath.Join(baseDir, reqPath)
+		if err := os.MkdirAll(outPath, 0o755); err != nil {
+			return "", fmt.Errorf("Failed to create directory: %w", err)
+		}
+
+	} else if outPath == "" {
+		if defaultOutputDir != "" {
+			outPath = defaultOutputDir
+			if err := os.MkdirAll(outPath, 0o755); err != nil {
+				return "", fmt.Errorf("Failed to create output directory: %w", err)
+			}
+		} else {
+			if settings.General.DefaultDownloadDir != "" {
+				outPath = settings.General.DefaultDownloadDir
+				if err := os.MkdirAll(outPath, 0o755); err != nil {
+					return "", fmt.Errorf("Failed to create output directory: %w", err)
+				}
+			} else {
+				outPath = "."
+			}
+		}
+	}
+
+	// Enforce absolute path to ensure resume works even if CWD changes
+	return utils.EnsureAbsPath(outPath), nil
+}
+
 // processDownloads handles the logic of adding downloads either to local pool or remote server
 // Returns the number of successfully added downloads
 func processDownloads(urls []string, outputDir string, port int) int {
+	return processDownloadsWithOptions(urls, outputDir, port, types.DownloadOptions{})
+}
+
+// processDownloadsWithOptions is processDownloads with per-download options applied to every URL.
+// Metalink files and URLs expand into one download per described file and carry their own options.
+func processDownloadsWithOptions(urls []string, outputDir string, port int, opts types.DownloadOptions) int {
 	successCount := 0
+	requests := expandDownloadArgs(urls, outputDir, opts)
 
 	// If port > 0, we are sending to a remote server
 	if port > 0 {
-		for _, arg := range urls {
-			url, mirrors := ParseURLArg(arg)
-			if url == "" {
-				continue
-			}
-			err := sendToServer(url, mirrors, outputDir, port)
+		for _, req := range requests {
+			err := sendRequestToServer(req, port)
 			if err != nil {
-				fmt.Printf("Error adding %s: %v\n", url, err)
+				fmt.Printf("Error adding %s: %v\n", req.URL, err)
 			} else {
 				successCount++
 			}
@@ -888,19 +1027,9 @@ func processDownloads(urls []string, outputDir string, port int) int {
 		settings = config.DefaultSettings()
 	}
 
-	for _, arg := range urls {
-		// Validation
-		if arg == "" {
-			continue
-		}
-
-		url, mirrors := ParseURLArg(arg)
-		if url == "" {
-			continue
-		}
-
+	for _, req := range requests {
 		// Prepare output path
-		outPath := outputDir
+		outPath := req.Path
 		if outPath == "" {
 			if settings.General.DefaultDownloadDir != "" {
 				outPath = settings.General.DefaultDownloadDir
@@ -919,9 +1048,9 @@ func processDownloads(urls []string, outputDir string, port int) int {
 		// But processDownloads is called from QUEUE init routine, primarily for CLI args.
 		// If CLI args provided, user probably wants them added immediately.
 
-		_, err := GlobalService.Add(url, outPath, "", mirrors, nil)
+		_, err := GlobalService.AddWithOptions(req.URL, outPath, req.Filename, req.Mirrors, nil, req.options())
 		if err != nil {
-			fmt.Printf("Error adding %s: %v\n", url, err)
+			fmt.Printf("Error adding %s: %v\n", req.URL, err)
 			continue
 		}
 		atomic.AddInt32(&activeDownloads, 1)
@@ -939,11 +1068,12 @@ func Execute() {
 
 func init() {
 	rootCmd.PersistentFlags().BoolVarP(&verbose, "verbose", "v", false, "Enable verbose logging")
-	rootCmd.Flags().StringP("batch", "b", "", "File containing URLs to download (one per line)")
+	rootCmd.Flags().StringP("batch", "b", "", "File containing URLs to download (one per line), or a Metalink file")
 	rootCmd.Flags().IntP("port", "p", 0, "Port to listen on (default: 8080 or first available)")
 	rootCmd.Flags().StringP("output", "o", "", "Default output directory")
 	rootCmd.Flags().Bool("no-resume", false, "Do not auto-resume paused downloads on startup")
 	rootCmd.Flags().Bool("exit-when-done", false, "Exit when all downloads complete")
+	addTLSFlags(rootCmd)
 	rootCmd.SetVersionTemplate("Surge v{{.Version}}\n")
 }
 
@@ -978,10 +1108,42 @@ func initializeGlobalState() {
 	utils.CleanupLogs(retention)
 }
 
-func resumePausedDownloads() {
+// requeueInterrupted queues the downloads that were running when Surge last
+// died (crash, kill -9, power cut) so they resume from their last checkpoint.
+// Queued downloads start even with --no-resume (see resumePausedDownloads).
+func requeueInterrupted() {
+	n, err := state.RequeueInterrupted()
+	if err != nil {
+		utils.Debug("Failed to requeue interrupted downloads: %v", err)
+	} else if n > 0 {
+		utils.Debug("Requeued %d downloads interrupted by an unclean exit", n)
+	}
+}
+
+// restoreQueue queues the downloads that were waiting when Surge last exited.
+// The saved queue is restored even with --no-resume, since those downloads
+// were never paused.
+func restoreQueue() {
+	local, ok := GlobalService.(*core.LocalDownloadService)
+	if !ok {
+		return
+	}
+	n, err := local.RestoreQueue()
+	if err != nil {
+		utils.Debug("Failed to restore queue: %v", err)
+		return
+	}
+	atomic.AddInt32(&activeDownloads, int32(n))
+}
+
+// resumePausedDownloads starts the downloads left queued, such as those
+// requeued after a crash. Paused ones are resumed too when resumePaused is
+// set and auto_resume is enabled.
+func resumePausedDownloads(resumePaused bool) {
 	settings, err := config.LoadSettings()
 	if err != nil {
-		return // Can't check preference
+		settings = config.DefaultSettings()
+		resumePaused = false // Can't check preference
 	}
 
 	pausedEntries, err := state.LoadPausedDownloads()
@@ -992,12 +1154,15 @@ func resumePausedDownloads() {
 	for _, entry := range pausedEntries {
 		// If entry is explicitly queued, we should start it regardless of AutoResume setting
 		// If entry is paused, we only start it if AutoResume is enabled
-		if entry.Status == "paused" && !settings.General.AutoResume {
+		if entry.Status == "paused" && (!resumePaused || !settings.General.AutoResume) {
 			continue
 		}
 		if GlobalService == nil || entry.ID == "" {
 			continue
 		}
+		if GlobalPool != nil && GlobalPool.GetStatus(entry.ID) != nil {
+			continue // Already restored from the saved queue
+		}
 		if err := GlobalService.Resume(entry.ID); err == nil {
 			atomic.AddInt32(&activeDownloads, 1)
 		}
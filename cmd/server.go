@@ -1,6 +1,7 @@
 package cmd
 
 import (
+	"context"
 	"fmt"
 
 	"os"
@@ -14,6 +15,8 @@ import (
 	"github.com/spf13/cobra"
 	"github.com/surge-downloader/surge/internal/config"
 	"github.com/surge-downloader/surge/internal/core"
+	"github.com/surge-downloader/surge/internal/engine/ratelimit"
+	"github.com/surge-downloader/surge/internal/scheduler"
 	"github.com/surge-downloader/surge/internal/utils"
 )
 
@@ -45,6 +48,7 @@ var serverStartCmd = &cobra.Command{
 				utils.Debug("Error releasing lock: %v", err)
 			}
 		}()
+		requeueInterrupted()
 
 		portFlag, _ := cmd.Flags().GetInt("port")
 		batchFile, _ := cmd.Flags().GetString("batch")
@@ -118,6 +122,9 @@ var serverStatusCmd = &cobra.Command{
 
 		port := readActivePort()
 		fmt.Printf("Surge server is running (PID: %d, Port: %d).\n", pid, port)
+		if fingerprint := readActiveFingerprint(); fingerprint != "" {
+			fmt.Printf("TLS certificate fingerprint (SHA-256): %s\n", fingerprint)
+		}
 	},
 }
 
@@ -132,6 +139,7 @@ func init() {
 	serverStartCmd.Flags().StringP("output", "o", "", "Default output directory")
 	serverStartCmd.Flags().Bool("exit-when-done", false, "Exit when all downloads complete")
 	serverStartCmd.Flags().Bool("no-resume", false, "Do not auto-resume paused downloads on startup")
+	addTLSFlags(serverStartCmd)
 }
 
 func savePID() {
@@ -165,15 +173,39 @@ func startServerLogic(cmd *cobra.Command, args []string, portFlag int, batchFile
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
 	}
+	listener, fingerprint, err := wrapServerTLS(listener, cmd)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
 
 	// Initialize Service
 	GlobalService = core.NewLocalDownloadServiceWithInput(GlobalPool, GlobalProgressCh)
 
 	saveActivePort(port)
 	defer removeActivePort()
+	if fingerprint != "" {
+		saveActiveFingerprint(fingerprint)
+		defer removeActiveFingerprint()
+	}
 
 	go startHTTPServer(listener, port, outputDir, GlobalService)
 
+	// Apply time-of-day bandwidth profiles and download windows.
+	// Settings are re-read on every check so edits apply without a restart.
+	var lastSettings *config.Settings
+	sched := scheduler.New(GlobalPool, ratelimit.Global(), func() *config.Settings {
+		if s, err := config.LoadSettings(); err == nil {
+			lastSettings = s
+		} else {
+			utils.Debug("Scheduler: failed to load settings: %v", err)
+		}
+		return lastSettings
+	})
+	schedCtx, stopScheduler := context.WithCancel(context.Background())
+	defer stopScheduler()
+	go sched.Run(schedCtx)
+
 	// Queue initial downloads
 	go func() {
 		var urls []string
@@ -195,15 +227,20 @@ func startServerLogic(cmd *cobra.Command, args []string, portFlag int, batchFile
 
 	fmt.Printf("Surge %s running in server mode.\n", Version)
 	host := getServerBindHost()
-	fmt.Printf("Serving on %s:%d\n", host, port)
+	if fingerprint != "" {
+		fmt.Printf("Serving on %s:%d (TLS, plain HTTP on loopback only)\n", host, port)
+		fmt.Printf("Certificate fingerprint (SHA-256): %s\n", fingerprint)
+	} else {
+		fmt.Printf("Serving on %s:%d\n", host, port)
+	}
 	fmt.Println("Press Ctrl+C to exit.")
 
 	StartHeadlessConsumer()
 
-	// Auto-resume paused downloads (unless --no-resume)
-	if !noResume {
-		resumePausedDownloads()
-	}
+	restoreQueue()
+
+	// Start queued downloads, and auto-resume paused ones unless --no-resume
+	resumePausedDownloads(!noResume)
 
 	if exitWhenDone {
 		exitWhenDoneCh := make(chan struct{}, 1)
@@ -212,7 +249,8 @@ func startServerLogic(cmd *cobra.Command, args []string, portFlag int, batchFile
 			ticker := time.NewTicker(2 * time.Second)
 			defer ticker.Stop()
 			for range ticker.C {
-				if atomic.LoadInt32(&activeDownloads) == 0 {
+				// Downloads held by the schedule are not done
+				if atomic.LoadInt32(&activeDownloads) == 0 && !sched.Holding() {
 					if GlobalPool != nil && GlobalPool.ActiveCount() == 0 {
 						select {
 						case exitWhenDoneCh <- struct{}{}:
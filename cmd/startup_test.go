@@ -36,14 +36,14 @@ func TestServer_Startup_HandlesResume(t *testing.T) {
 	GlobalService = core.NewLocalDownloadServiceWithInput(GlobalPool, GlobalProgressCh)
 
 	// 4. Run Resume Logic (Simulate Server Start)
-	resumePausedDownloads()
+	resumePausedDownloads(true)
 
 	// 5. Verify Download is in GlobalPool
 	status := GlobalPool.GetStatus(testID)
 	// GetStatus checks active downloads. If it returned non-nil, it's active!
 	if status == nil {
 		// Check if it's in queued map (GetStatus checks both active and queued internal maps)
-		// Wait, GetStatus implementation in pool.go checks p.downloads and p.queued
+		// Wait, GetStatus implementation in pool.go checks p.downloads and p.queue
 		t.Fatal("Download not found in GlobalPool after resumePausedDownloads()")
 	}
 
@@ -52,6 +52,39 @@ func TestServer_Startup_HandlesResume(t *testing.T) {
 	}
 }
 
+// TestServer_Startup_NoResumeStartsQueued verifies that --no-resume keeps
+// paused downloads paused but still starts queued ones, such as downloads
+// requeued after a crash
+func TestServer_Startup_NoResumeStartsQueued(t *testing.T) {
+	tmpDir := t.TempDir()
+	setupTestEnv(t, tmpDir)
+
+	settings := config.DefaultSettings()
+	settings.General.AutoResume = true
+	if err := config.SaveSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+
+	seedDownload(t, "interrupted-id", "http://example.com/interrupted.zip", filepath.Join(tmpDir, "interrupted.zip"), "downloading")
+	seedDownload(t, "paused-id", "http://example.com/paused.zip", filepath.Join(tmpDir, "paused.zip"), "paused")
+	if n, err := state.RequeueInterrupted(); err != nil || n != 1 {
+		t.Fatalf("RequeueInterrupted = %d, %v; want 1", n, err)
+	}
+
+	GlobalProgressCh = make(chan any, 10)
+	GlobalPool = download.NewWorkerPool(GlobalProgressCh, 3)
+	GlobalService = core.NewLocalDownloadServiceWithInput(GlobalPool, GlobalProgressCh)
+
+	resumePausedDownloads(false)
+
+	if GlobalPool.GetStatus("interrupted-id") == nil {
+		t.Error("interrupted download should start even with --no-resume")
+	}
+	if GlobalPool.GetStatus("paused-id") != nil {
+		t.Error("paused download should stay paused with --no-resume")
+	}
+}
+
 // Helper: Setup XDG_CONFIG_HOME and Settings
 func setupTestEnv(t *testing.T, tmpDir string) {
 	originalXDG := os.Getenv("XDG_CONFIG_HOME")
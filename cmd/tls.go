@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"crypto/tls"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/tlscert"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// addTLSFlags registers the flags enabling TLS on the daemon API
+func addTLSFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.Bool("tls", false, "Serve the API over TLS with a self-signed certificate (plain HTTP stays available on loopback)")
+	flags.String("tls-cert", "", "TLS certificate file (PEM), instead of the self-signed one")
+	flags.String("tls-key", "", "TLS private key file (PEM), used with --tls-cert")
+}
+
+// loadServerTLS returns the certificate to serve from the TLS flags, or nil
+// when TLS is off
+func loadServerTLS(cmd *cobra.Command) (*tls.Certificate, error) {
+	flags := cmd.Flags()
+	enabled, _ := flags.GetBool("tls")
+	certFile, _ := flags.GetString("tls-cert")
+	keyFile, _ := flags.GetString("tls-key")
+	certFile, keyFile = strings.TrimSpace(certFile), strings.TrimSpace(keyFile)
+
+	if (certFile == "") != (keyFile == "") {
+		return nil, fmt.Errorf("--tls-cert and --tls-key must be used together")
+	}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load TLS certificate: %w", err)
+		}
+		return &cert, nil
+	}
+	if !enabled {
+		return nil, nil
+	}
+	cert, err := tlscert.LoadOrCreate(config.GetStateDir())
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare self-signed certificate: %w", err)
+	}
+	return &cert, nil
+}
+
+// wrapServerTLS makes ln serve TLS when the flags ask for it. It returns the
+// listener to serve and the certificate fingerprint, empty without TLS.
+func wrapServerTLS(ln net.Listener, cmd *cobra.Command) (net.Listener, string, error) {
+	cert, err := loadServerTLS(cmd)
+	if err != nil || cert == nil {
+		return ln, "", err
+	}
+	tlsConfig := &tls.Config{
+		MinVersion:   tls.VersionTLS12,
+		Certificates: []tls.Certificate{*cert},
+	}
+	return tlscert.NewListener(ln, tlsConfig), tlscert.CertificateFingerprint(*cert), nil
+}
+
+// saveActiveFingerprint writes the TLS fingerprint next to the port file,
+// for "surge server status"
+func saveActiveFingerprint(fingerprint string) {
+	path := filepath.Join(config.GetRuntimeDir(), "fingerprint")
+	if err := os.WriteFile(path, []byte(fingerprint), 0o644); err != nil {
+		utils.Debug("Error writing fingerprint file: %v", err)
+	}
+}
+
+// removeActiveFingerprint cleans up the fingerprint file on exit
+func removeActiveFingerprint() {
+	path := filepath.Join(config.GetRuntimeDir(), "fingerprint")
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		utils.Debug("Error removing fingerprint file: %v", err)
+	}
+}
+
+// readActiveFingerprint returns the TLS fingerprint of the running daemon,
+// empty if it serves plain HTTP
+func readActiveFingerprint() string {
+	data, err := os.ReadFile(filepath.Join(config.GetRuntimeDir(), "fingerprint"))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
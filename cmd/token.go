@@ -1,20 +1,142 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
 
 	"github.com/spf13/cobra"
+	"github.com/surge-downloader/surge/internal/auth"
 )
 
 var tokenCmd = &cobra.Command{
 	Use:   "token",
 	Short: "Print the auth token used by the Surge daemon",
+	Long: `Print the default API token, which has full rights.
+Use the subcommands to manage named tokens with a narrower scope:
+read (list and follow downloads), add (also queue new ones) or admin.`,
+	Args: cobra.NoArgs,
 	Run: func(cmd *cobra.Command, args []string) {
 		token := ensureAuthToken()
 		fmt.Println(token)
 	},
 }
 
+var tokenCreateCmd = &cobra.Command{
+	Use:   "create <name>",
+	Short: "Create a named token",
+	Long: `Create a named token and print it. The token is shown only once.
+A running Surge accepts it right away.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		scopeFlag, _ := cmd.Flags().GetString("scope")
+		expiresFlag, _ := cmd.Flags().GetString("expires")
+
+		scope, err := auth.ParseScope(scopeFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		ttl, err := auth.ParseTTL(expiresFlag)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		secret, err := tokenStore().Create(args[0], scope, ttl)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(secret)
+	},
+}
+
+var tokenListCmd = &cobra.Command{
+	Use:   "list",
+	Short: "List API tokens",
+	Args:  cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		tokens, err := tokenStore().List()
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		now := time.Now()
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "NAME\tSCOPE\tCREATED\tEXPIRES")
+		_, _ = fmt.Fprintln(w, "----\t-----\t-------\t-------")
+		_, _ = fmt.Fprintf(w, "%s\t%s\t-\tnever\n", auth.DefaultName, auth.ScopeAdmin)
+		for _, t := range tokens {
+			expires := "never"
+			if t.ExpiresAt != 0 {
+				expires = time.Unix(t.ExpiresAt, 0).Format("2006-01-02 15:04")
+				if t.Expired(now) {
+					expires += " (expired)"
+				}
+			}
+			created := time.Unix(t.CreatedAt, 0).Format("2006-01-02 15:04")
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", t.Name, t.Scope, created, expires)
+		}
+		_ = w.Flush()
+	},
+}
+
+var tokenRevokeCmd = &cobra.Command{
+	Use:   "revoke <name>",
+	Short: "Revoke a named token",
+	Long: `Delete a named token. A running Surge rejects it right away.
+The default token cannot be revoked; rotate it instead.`,
+	Args: cobra.ExactArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		if args[0] == auth.DefaultName {
+			fmt.Fprintln(os.Stderr, "Error: the default token cannot be revoked, use 'surge token rotate'")
+			os.Exit(1)
+		}
+		if err := tokenStore().Revoke(args[0]); err != nil {
+			if errors.Is(err, auth.ErrNotFound) {
+				err = fmt.Errorf("no token named %q", args[0])
+			}
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Printf("Revoked token %s\n", args[0])
+	},
+}
+
+var tokenRotateCmd = &cobra.Command{
+	Use:   "rotate [name]",
+	Short: "Replace a token with a new one",
+	Long: `Give a token a new value and print it, keeping its scope and expiry.
+Without a name, the default token is rotated. The old value stops working
+right away, so clients using it need the new one.`,
+	Args: cobra.MaximumNArgs(1),
+	Run: func(cmd *cobra.Command, args []string) {
+		var secret string
+		var err error
+		if len(args) == 0 || args[0] == auth.DefaultName {
+			secret, err = tokenStore().RotateDefault()
+		} else {
+			secret, err = tokenStore().Rotate(args[0])
+			if errors.Is(err, auth.ErrNotFound) {
+				err = fmt.Errorf("no token named %q", args[0])
+			}
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		fmt.Println(secret)
+	},
+}
+
 func init() {
 	rootCmd.AddCommand(tokenCmd)
+	tokenCmd.AddCommand(tokenCreateCmd, tokenListCmd, tokenRevokeCmd, tokenRotateCmd)
+
+	tokenCreateCmd.Flags().String("scope", string(auth.ScopeRead), "What the token may do: read, add or admin")
+	tokenCreateCmd.Flags().String("expires", "", "Lifetime of the token, e.g. 30d or 12h (default never)")
 }
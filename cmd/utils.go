@@ -14,6 +14,8 @@ import (
 	"github.com/surge-downloader/surge/internal/config"
 	"github.com/surge-downloader/surge/internal/engine/state"
 	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/metalink"
+	"github.com/surge-downloader/surge/internal/multipart"
 	"github.com/surge-downloader/surge/internal/utils"
 )
 
@@ -29,8 +31,17 @@ func readActivePort() int {
 	return port
 }
 
-// readURLsFromFile reads URLs from a file, one per line
+// readURLsFromFile reads URLs from a file, one per line, keeping the volumes
+// of multi-part archives together and in order.
+// A Metalink file is returned as-is so it expands into its own downloads.
 func readURLsFromFile(filepath string) ([]string, error) {
+	if metalink.IsMetalink(filepath) {
+		if _, err := os.Stat(filepath); err != nil {
+			return nil, fmt.Errorf("failed to open file: %w", err)
+		}
+		return []string{filepath}, nil
+	}
+
 	file, err := os.Open(filepath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open file: %w", err)
@@ -45,7 +56,10 @@ func readURLsFromFile(filepath string) ([]string, error) {
 			urls = append(urls, line)
 		}
 	}
-	return urls, scanner.Err()
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return multipart.OrderURLs(urls), nil
 }
 
 // ParseURLArg parses a command line argument that might contain comma-separated mirrors
@@ -66,11 +80,15 @@ func ParseURLArg(arg string) (string, []string) {
 
 // sendToServer sends a download request to a running surge server
 func sendToServer(url string, mirrors []string, outPath string, port int) error {
-	reqBody := DownloadRequest{
+	return sendRequestToServer(DownloadRequest{
 		URL:     url,
 		Mirrors: mirrors,
 		Path:    outPath,
-	}
+	}, port)
+}
+
+// sendRequestToServer posts a fully populated download request to the running server
+func sendRequestToServer(reqBody DownloadRequest, port int) error {
 	jsonData, err := json.Marshal(reqBody)
 	if err != nil {
 		return fmt.Errorf("failed to marshal request: %w", err)
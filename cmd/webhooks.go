@@ -0,0 +1,134 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/surge-downloader/surge/internal/core"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+var webhooksCmd = &cobra.Command{
+	Use:   "webhooks",
+	Short: "Show recent webhook deliveries",
+	Long: `List the most recent events sent to the webhooks in settings.json,
+oldest first, with the number of attempts and the last error of each.`,
+	Args: cobra.NoArgs,
+	Run: func(cmd *cobra.Command, args []string) {
+		initializeGlobalState()
+
+		jsonOutput, _ := cmd.Flags().GetBool("json")
+
+		port := readActivePort()
+		if port == 0 {
+			fmt.Println("Error: Surge is not running.")
+			os.Exit(1)
+		}
+
+		deliveries, err := fetchWebhookDeliveries(port)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+
+		if jsonOutput {
+			data, _ := json.MarshalIndent(deliveries, "", "  ")
+			fmt.Println(string(data))
+			return
+		}
+
+		if len(deliveries) == 0 {
+			fmt.Println("No webhook deliveries.")
+			return
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		_, _ = fmt.Fprintln(w, "TIME\tEVENT\tDOWNLOAD\tURL\tATTEMPTS\tRESULT")
+		_, _ = fmt.Fprintln(w, "----\t-----\t--------\t---\t--------\t------")
+		for _, d := range deliveries {
+			id := d.DownloadID
+			if len(id) > 8 {
+				id = id[:8]
+			}
+			target := d.URL
+			if len(target) > 40 {
+				target = target[:37] + "..."
+			}
+			result := "delivered"
+			if !d.Delivered {
+				result = d.Error
+			}
+			when := time.Unix(d.Time, 0).Format("15:04:05")
+			_, _ = fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%d\t%s\n", when, d.Event, id, target, d.Attempts, result)
+		}
+		_ = w.Flush()
+	},
+}
+
+func init() {
+	rootCmd.AddCommand(webhooksCmd)
+	webhooksCmd.Flags().Bool("json", false, "Output in JSON format")
+}
+
+// fetchWebhookDeliveries reads the delivery log of the running instance
+func fetchWebhookDeliveries(port int) ([]types.WebhookDelivery, error) {
+	req, err := http.NewRequest(http.MethodGet, fmt.Sprintf("http://127.0.0.1:%d/webhooks", port), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+ensureAuthToken())
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to server: %w", err)
+	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			utils.Debug("Error closing response body: %v", err)
+		}
+	}()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("server error: %s - %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+
+	var deliveries []types.WebhookDelivery
+	if err := json.NewDecoder(resp.Body).Decode(&deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
+// handleWebhooks returns the webhook delivery log on GET
+func handleWebhooks(w http.ResponseWriter, r *http.Request, service core.DownloadService) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if service == nil {
+		http.Error(w, "Service unavailable", http.StatusInternalServerError)
+		return
+	}
+
+	deliveries, err := service.WebhookDeliveries()
+	if err != nil {
+		http.Error(w, "Failed to read webhook deliveries: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if deliveries == nil {
+		deliveries = []types.WebhookDelivery{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(deliveries); err != nil {
+		utils.Debug("Failed to encode response: %v", err)
+	}
+}
@@ -0,0 +1,558 @@
+package aria2
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/surge-downloader/surge/internal/engine/checksum"
+	"github.com/surge-downloader/surge/internal/engine/ratelimit"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+type method func(s *Server, p args) (interface{}, *rpcError)
+
+// methods lists the aria2 methods Surge answers, without the system ones
+var methods = map[string]method{
+	"aria2.addUri":             (*Server).addURI,
+	"aria2.remove":             (*Server).remove,
+	"aria2.forceRemove":        (*Server).remove,
+	"aria2.pause":              (*Server).pause,
+	"aria2.forcePause":         (*Server).pause,
+	"aria2.pauseAll":           (*Server).pauseAll,
+	"aria2.forcePauseAll":      (*Server).pauseAll,
+	"aria2.unpause":            (*Server).unpause,
+	"aria2.unpauseAll":         (*Server).unpauseAll,
+	"aria2.tellStatus":         (*Server).tellStatus,
+	"aria2.getUris":            (*Server).getURIs,
+	"aria2.getFiles":           (*Server).getFiles,
+	"aria2.tellActive":         (*Server).tellActive,
+	"aria2.tellWaiting":        (*Server).tellWaiting,
+	"aria2.tellStopped":        (*Server).tellStopped,
+	"aria2.changePosition":     (*Server).changePosition,
+	"aria2.getOption":          (*Server).getOption,
+	"aria2.changeOption":       (*Server).changeOption,
+	"aria2.getGlobalOption":    (*Server).getGlobalOption,
+	"aria2.changeGlobalOption": (*Server).changeGlobalOption,
+	"aria2.getGlobalStat":      (*Server).getGlobalStat,
+	"aria2.getVersion":         (*Server).getVersion,
+}
+
+// ReadOnly reports whether method only reads the state of downloads
+func ReadOnly(method string) bool {
+	switch method {
+	case "aria2.tellStatus", "aria2.getUris", "aria2.getFiles", "aria2.tellActive",
+		"aria2.tellWaiting", "aria2.tellStopped", "aria2.getOption",
+		"aria2.getGlobalOption", "aria2.getGlobalStat", "aria2.getVersion":
+		return true
+	}
+	return false
+}
+
+func methodNames() []string {
+	names := []string{"system.multicall", "system.listMethods", "system.listNotifications"}
+	for name := range methods {
+		names = append(names, name)
+	}
+	sort.Strings(names[3:])
+	return names
+}
+
+// args are the parameters of a call, after the token
+type args []json.RawMessage
+
+func (p args) has(i int) bool {
+	return i < len(p) && string(p[i]) != "null"
+}
+
+func (p args) string(i int) (string, *rpcError) {
+	var v string
+	if !p.has(i) || json.Unmarshal(p[i], &v) != nil {
+		return "", invalidParams("parameter %d must be a string", i+1)
+	}
+	return v, nil
+}
+
+// int reads an integer parameter, which aria2 clients send as a number or a string
+func (p args) int(i int) (int, *rpcError) {
+	if !p.has(i) {
+		return 0, invalidParams("parameter %d must be an integer", i+1)
+	}
+	var n int
+	if json.Unmarshal(p[i], &n) == nil {
+		return n, nil
+	}
+	var s string
+	if json.Unmarshal(p[i], &s) == nil {
+		if n, err := strconv.Atoi(s); err == nil {
+			return n, nil
+		}
+	}
+	return 0, invalidParams("parameter %d must be an integer", i+1)
+}
+
+func (p args) strings(i int) ([]string, *rpcError) {
+	if !p.has(i) {
+		return nil, nil
+	}
+	var v []string
+	if json.Unmarshal(p[i], &v) != nil {
+		return nil, invalidParams("parameter %d must be an array of strings", i+1)
+	}
+	return v, nil
+}
+
+// options reads an aria2 options struct. Values are strings, except
+// "header" which may also be an array.
+func (p args) options(i int) (map[string]interface{}, *rpcError) {
+	if !p.has(i) {
+		return map[string]interface{}{}, nil
+	}
+	var v map[string]interface{}
+	if json.Unmarshal(p[i], &v) != nil {
+		return nil, invalidParams("parameter %d must be an options struct", i+1)
+	}
+	return v, nil
+}
+
+func optionString(opts map[string]interface{}, key string) string {
+	switch v := opts[key].(type) {
+	case string:
+		return v
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	}
+	return ""
+}
+
+// addURI queues the first URI, with the others as mirrors of the same file.
+// Supported options: dir, out, header, user-agent, referer, checksum and
+// max-download-limit. Others are ignored, as AriaNg sends many by default.
+func (s *Server) addURI(p args) (interface{}, *rpcError) {
+	uris, err := p.strings(0)
+	if err != nil {
+		return nil, err
+	}
+	if len(uris) == 0 || uris[0] == "" {
+		return nil, invalidParams("no URI to download")
+	}
+	opts, err := p.options(1)
+	if err != nil {
+		return nil, err
+	}
+
+	dir, filename := optionString(opts, "dir"), optionString(opts, "out")
+	if strings.Contains(dir, "..") || strings.Contains(filename, "..") ||
+		strings.ContainsAny(filename, `/\`) {
+		return nil, failed("invalid dir or out option")
+	}
+	outPath, dirErr := s.ResolveDir(dir)
+	if dirErr != nil {
+		return nil, failed("%v", dirErr)
+	}
+
+	headers := make(map[string]string)
+	var lines []string
+	switch v := opts["header"].(type) {
+	case string:
+		lines = []string{v}
+	case []interface{}:
+		for _, h := range v {
+			if h, ok := h.(string); ok {
+				lines = append(lines, h)
+			}
+		}
+	}
+	for _, line := range lines {
+		name, value, ok := strings.Cut(line, ":")
+		if !ok || strings.TrimSpace(name) == "" {
+			return nil, failed("invalid header %q", line)
+		}
+		headers[strings.TrimSpace(name)] = strings.TrimSpace(value)
+	}
+	if ua := optionString(opts, "user-agent"); ua != "" {
+		headers["User-Agent"] = ua
+	}
+	if ref := optionString(opts, "referer"); ref != "" {
+		headers["Referer"] = ref
+	}
+
+	var dlOpts types.DownloadOptions
+	if sum := optionString(opts, "checksum"); sum != "" {
+		// aria2 writes "sha-256=<hex>"
+		normalized, err := checksum.Normalize(strings.Replace(sum, "=", ":", 1))
+		if err != nil {
+			return nil, failed("invalid checksum: %v", err)
+		}
+		dlOpts.Checksum = normalized
+	}
+	if limit := optionString(opts, "max-download-limit"); limit != "" {
+		rate, err := ratelimit.ParseRate(limit)
+		if err != nil {
+			return nil, failed("%v", err)
+		}
+		dlOpts.RateLimit = rate
+	}
+	for key := range opts {
+		switch key {
+		case "dir", "out", "header", "user-agent", "referer", "checksum", "max-download-limit":
+		default:
+			utils.Debug("aria2.addUri: ignoring unsupported option %q", key)
+		}
+	}
+
+	if len(headers) == 0 {
+		headers = nil
+	}
+	id, addErr := s.service.AddWithOptions(uris[0], outPath, filename, uris[1:], headers, dlOpts)
+	if addErr != nil {
+		return nil, failed("%v", addErr)
+	}
+
+	// Only the front of the queue is honoured; other positions keep the end
+	if p.has(2) {
+		if pos, err := p.int(2); err == nil && pos == 0 {
+			if err := s.service.Move(id, types.MoveTop); err != nil {
+				utils.Debug("aria2.addUri: failed to move %s to the front: %v", id, err)
+			}
+		}
+	}
+	return GID(id), nil
+}
+
+// control runs fn on the download named by the first parameter and returns its GID
+func (s *Server) control(p args, fn func(id string) error) (interface{}, *rpcError) {
+	gid, err := p.string(0)
+	if err != nil {
+		return nil, err
+	}
+	st, err := s.find(gid)
+	if err != nil {
+		return nil, err
+	}
+	if err := fn(st.ID); err != nil {
+		return nil, failed("%v", err)
+	}
+	return GID(st.ID), nil
+}
+
+func (s *Server) remove(p args) (interface{}, *rpcError) {
+	return s.control(p, s.service.Delete)
+}
+
+func (s *Server) pause(p args) (interface{}, *rpcError) {
+	return s.control(p, s.service.Pause)
+}
+
+func (s *Server) unpause(p args) (interface{}, *rpcError) {
+	return s.control(p, s.service.Resume)
+}
+
+func (s *Server) pauseAll(args) (interface{}, *rpcError) {
+	statuses, err := s.byState("active", "waiting")
+	if err != nil {
+		return nil, err
+	}
+	for _, st := range statuses {
+		if err := s.service.Pause(st.ID); err != nil {
+			utils.Debug("aria2.pauseAll: failed to pause %s: %v", st.ID, err)
+		}
+	}
+	return "OK", nil
+}
+
+func (s *Server) unpauseAll(args) (interface{}, *rpcError) {
+	statuses, err := s.byState("paused")
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(statuses))
+	for _, st := range statuses {
+		ids = append(ids, st.ID)
+	}
+	for i, err := range s.service.ResumeBatch(ids) {
+		if err != nil {
+			utils.Debug("aria2.unpauseAll: failed to resume %s: %v", ids[i], err)
+		}
+	}
+	return "OK", nil
+}
+
+func (s *Server) tellStatus(p args) (interface{}, *rpcError) {
+	gid, err := p.string(0)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := p.strings(1)
+	if err != nil {
+		return nil, err
+	}
+	st, err := s.find(gid)
+	if err != nil {
+		return nil, err
+	}
+	return statusStruct(*st, keys), nil
+}
+
+func (s *Server) getURIs(p args) (interface{}, *rpcError) {
+	return s.fileField(p, "uris")
+}
+
+func (s *Server) getFiles(p args) (interface{}, *rpcError) {
+	return s.fileField(p, "")
+}
+
+// fileField returns the files of a download, or one field of its only file
+func (s *Server) fileField(p args, field string) (interface{}, *rpcError) {
+	gid, err := p.string(0)
+	if err != nil {
+		return nil, err
+	}
+	st, err := s.find(gid)
+	if err != nil {
+		return nil, err
+	}
+	files := statusStruct(*st, []string{"files"})["files"].([]map[string]interface{})
+	if field == "" {
+		return files, nil
+	}
+	return files[0][field], nil
+}
+
+func (s *Server) tellActive(p args) (interface{}, *rpcError) {
+	keys, err := p.strings(0)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := s.byState("active")
+	if err != nil {
+		return nil, err
+	}
+	return statusStructs(statuses, keys), nil
+}
+
+func (s *Server) tellWaiting(p args) (interface{}, *rpcError) {
+	return s.tellRange(p, "waiting", "paused")
+}
+
+func (s *Server) tellStopped(p args) (interface{}, *rpcError) {
+	return s.tellRange(p, "complete", "error")
+}
+
+// tellRange answers the (offset, num, keys) listing methods
+func (s *Server) tellRange(p args, states ...string) (interface{}, *rpcError) {
+	offset, err := p.int(0)
+	if err != nil {
+		return nil, err
+	}
+	num, err := p.int(1)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := p.strings(2)
+	if err != nil {
+		return nil, err
+	}
+	statuses, err := s.byState(states...)
+	if err != nil {
+		return nil, err
+	}
+	return statusStructs(window(statuses, offset, num), keys), nil
+}
+
+// changePosition maps what the Surge queue can do: the front, the end,
+// or one step from the current place
+func (s *Server) changePosition(p args) (interface{}, *rpcError) {
+	pos, err := p.int(1)
+	if err != nil {
+		return nil, err
+	}
+	how, err := p.string(2)
+	if err != nil {
+		return nil, err
+	}
+
+	var move types.QueueMove
+	switch {
+	case how == "POS_SET" && pos == 0:
+		move = types.MoveTop
+	case how == "POS_END" && pos == 0:
+		move = types.MoveBottom
+	case how == "POS_CUR" && pos == -1:
+		move = types.MoveUp
+	case how == "POS_CUR" && pos == 1:
+		move = types.MoveDown
+	default:
+		return nil, failed("only POS_SET 0, POS_END 0 and POS_CUR -1/1 are supported")
+	}
+
+	gid, err := p.string(0)
+	if err != nil {
+		return nil, err
+	}
+	st, err := s.find(gid)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.service.Move(st.ID, move); err != nil {
+		return nil, failed("%v", err)
+	}
+
+	// aria2 answers with the new 0-based position
+	newPos := 0
+	if st, err := s.find(gid); err == nil && st.QueuePos > 0 {
+		newPos = st.QueuePos - 1
+	}
+	return newPos, nil
+}
+
+func (s *Server) getOption(p args) (interface{}, *rpcError) {
+	gid, err := p.string(0)
+	if err != nil {
+		return nil, err
+	}
+	st, err := s.find(gid)
+	if err != nil {
+		return nil, err
+	}
+	dir := statusStruct(*st, []string{"dir"})["dir"]
+	return map[string]interface{}{
+		"dir":                dir,
+		"out":                st.Filename,
+		"max-download-limit": strconv.FormatInt(st.RateLimit, 10),
+	}, nil
+}
+
+// changeOption supports max-download-limit. Other options fail rather than
+// appear to change.
+func (s *Server) changeOption(p args) (interface{}, *rpcError) {
+	opts, err := p.options(1)
+	if err != nil {
+		return nil, err
+	}
+	if err := onlyOptions(opts, "max-download-limit"); err != nil {
+		return nil, err
+	}
+	if _, ok := opts["max-download-limit"]; !ok {
+		return "OK", nil
+	}
+	rate, rateErr := ratelimit.ParseRate(optionString(opts, "max-download-limit"))
+	if rateErr != nil {
+		return nil, failed("%v", rateErr)
+	}
+	if _, err := s.control(p, func(id string) error { return s.service.SetRateLimit(id, rate) }); err != nil {
+		return nil, err
+	}
+	return "OK", nil
+}
+
+func (s *Server) getGlobalOption(args) (interface{}, *rpcError) {
+	settings := s.Settings()
+	opts := map[string]interface{}{
+		"dir":                        settings.General.DefaultDownloadDir,
+		"max-concurrent-downloads":   strconv.Itoa(settings.Network.MaxConcurrentDownloads),
+		"max-overall-download-limit": strconv.FormatInt(settings.Network.GlobalRateLimit, 10),
+		"max-connection-per-server":  strconv.Itoa(settings.Network.MaxConnectionsPerHost),
+		"user-agent":                 settings.Network.UserAgent,
+	}
+	s.mu.Lock()
+	for k, v := range s.globalOptions {
+		opts[k] = v
+	}
+	s.mu.Unlock()
+	return opts, nil
+}
+
+// changeGlobalOption supports max-overall-download-limit and
+// max-concurrent-downloads. Changes last until Surge restarts.
+func (s *Server) changeGlobalOption(p args) (interface{}, *rpcError) {
+	opts, err := p.options(0)
+	if err != nil {
+		return nil, err
+	}
+	if err := onlyOptions(opts, "max-overall-download-limit", "max-concurrent-downloads"); err != nil {
+		return nil, err
+	}
+
+	changed := make(map[string]string)
+	if _, ok := opts["max-overall-download-limit"]; ok {
+		rate, err := ratelimit.ParseRate(optionString(opts, "max-overall-download-limit"))
+		if err != nil {
+			return nil, failed("%v", err)
+		}
+		if err := s.service.SetGlobalRateLimit(rate); err != nil {
+			return nil, failed("%v", err)
+		}
+		changed["max-overall-download-limit"] = strconv.FormatInt(rate, 10)
+	}
+	if _, ok := opts["max-concurrent-downloads"]; ok {
+		n, err := strconv.Atoi(optionString(opts, "max-concurrent-downloads"))
+		if err != nil || n < 1 {
+			return nil, failed("max-concurrent-downloads must be a positive integer")
+		}
+		if err := s.service.SetMaxConcurrentDownloads(n); err != nil {
+			return nil, failed("%v", err)
+		}
+		changed["max-concurrent-downloads"] = strconv.Itoa(n)
+	}
+
+	s.mu.Lock()
+	for k, v := range changed {
+		s.globalOptions[k] = v
+	}
+	s.mu.Unlock()
+	return "OK", nil
+}
+
+// onlyOptions fails on any option not in supported
+func onlyOptions(opts map[string]interface{}, supported ...string) *rpcError {
+	for key := range opts {
+		found := false
+		for _, s := range supported {
+			if key == s {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return failed("option %q is not supported by Surge", key)
+		}
+	}
+	return nil
+}
+
+func (s *Server) getGlobalStat(args) (interface{}, *rpcError) {
+	statuses, err := s.service.List()
+	if err != nil {
+		return nil, failed("%v", err)
+	}
+	var speed int64
+	counts := make(map[string]int)
+	for _, st := range statuses {
+		state := ariaStatus(st.Status)
+		if state == "paused" {
+			state = "waiting"
+		}
+		counts[state]++
+		speed += int64(st.Speed * 1024 * 1024)
+	}
+	stopped := strconv.Itoa(counts["complete"] + counts["error"])
+	return map[string]string{
+		"downloadSpeed":   strconv.FormatInt(speed, 10),
+		"uploadSpeed":     "0",
+		"numActive":       strconv.Itoa(counts["active"]),
+		"numWaiting":      strconv.Itoa(counts["waiting"]),
+		"numStopped":      stopped,
+		"numStoppedTotal": stopped,
+	}, nil
+}
+
+func (s *Server) getVersion(args) (interface{}, *rpcError) {
+	return map[string]interface{}{
+		"version":         fmt.Sprintf("surge-%s", s.Version),
+		"enabledFeatures": []string{"HTTPS", "Message Digest", "Metalink", "SFTP"},
+	}, nil
+}
@@ -0,0 +1,130 @@
+package aria2
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+var notificationNames = []string{
+	"aria2.onDownloadStart",
+	"aria2.onDownloadPause",
+	"aria2.onDownloadStop",
+	"aria2.onDownloadComplete",
+	"aria2.onDownloadError",
+}
+
+// notification returns the aria2 notification for a download event, if any
+func notification(msg interface{}) (string, string) {
+	switch m := msg.(type) {
+	case events.DownloadStartedMsg:
+		return "aria2.onDownloadStart", m.DownloadID
+	case events.DownloadResumedMsg:
+		return "aria2.onDownloadStart", m.DownloadID
+	case events.DownloadPausedMsg:
+		return "aria2.onDownloadPause", m.DownloadID
+	case events.DownloadRemovedMsg:
+		return "aria2.onDownloadStop", m.DownloadID
+	case events.DownloadCompleteMsg:
+		return "aria2.onDownloadComplete", m.DownloadID
+	case events.DownloadErrorMsg:
+		return "aria2.onDownloadError", m.DownloadID
+	}
+	return "", ""
+}
+
+// wsConn serialises writes to a WebSocket shared by responses and notifications
+type wsConn struct {
+	ws *websocket.Conn
+	mu sync.Mutex
+	// authorized is set once a call on the connection passes the token
+	// check. Notifications are only sent after that.
+	authorized atomic.Bool
+}
+
+func (c *wsConn) send(data []byte) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return websocket.Message.Send(c.ws, string(data))
+}
+
+func (s *Server) serveWebSocket(w http.ResponseWriter, r *http.Request) {
+	sess := &session{bearer: bearerToken(r)}
+	server := websocket.Server{
+		// aria2 clients connect from any page or none, and every call
+		// carries the token, so the Origin is not checked
+		Handshake: func(*websocket.Config, *http.Request) error { return nil },
+		Handler: func(ws *websocket.Conn) {
+			conn := &wsConn{ws: ws}
+			s.handleConn(r.Context(), conn, sess)
+		},
+	}
+	server.ServeHTTP(w, r)
+}
+
+// handleConn answers calls on conn and forwards notifications until it closes
+func (s *Server) handleConn(ctx context.Context, conn *wsConn, sess *session) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, cleanup, err := s.service.StreamEvents(ctx)
+	if err != nil {
+		utils.Debug("aria2: failed to subscribe to events: %v", err)
+		return
+	}
+	defer cleanup()
+	go s.forwardNotifications(ctx, conn, stream)
+
+	for {
+		var msg []byte
+		if err := websocket.Message.Receive(conn.ws, &msg); err != nil {
+			return
+		}
+		out := s.handleMessage(msg, sess)
+		if sess.authorized {
+			conn.authorized.Store(true)
+		}
+		if out == nil {
+			continue
+		}
+		if err := conn.send(out); err != nil {
+			return
+		}
+	}
+}
+
+func (s *Server) forwardNotifications(ctx context.Context, conn *wsConn, stream <-chan interface{}) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case msg, ok := <-stream:
+			if !ok {
+				return
+			}
+			method, id := notification(msg)
+			if method == "" || !conn.authorized.Load() {
+				continue
+			}
+			data, err := json.Marshal(map[string]interface{}{
+				"jsonrpc": "2.0",
+				"method":  method,
+				"params":  []map[string]string{{"gid": GID(id)}},
+			})
+			if err != nil {
+				continue
+			}
+			if err := conn.send(data); err != nil {
+				_ = conn.ws.Close()
+				return
+			}
+		}
+	}
+}
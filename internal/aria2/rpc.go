@@ -0,0 +1,278 @@
+// Package aria2 serves an aria2-compatible JSON-RPC interface on top of a
+// core.DownloadService, so tools written for aria2 (AriaNg, scripts, dashboards)
+// can drive Surge without changes.
+package aria2
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/core"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// maxBodySize bounds a JSON-RPC request body
+const maxBodySize = 1 << 20
+
+// JSON-RPC error codes. aria2 reports failures of a method as code 1.
+const (
+	codeFailed         = 1
+	codeParseError     = -32700
+	codeInvalidRequest = -32600
+	codeMethodNotFound = -32601
+	codeInvalidParams  = -32602
+)
+
+// rpcError is the error member of a JSON-RPC response
+type rpcError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *rpcError) Error() string { return e.Message }
+
+func failed(format string, args ...interface{}) *rpcError {
+	return &rpcError{Code: codeFailed, Message: fmt.Sprintf(format, args...)}
+}
+
+func invalidParams(format string, args ...interface{}) *rpcError {
+	return &rpcError{Code: codeInvalidParams, Message: fmt.Sprintf(format, args...)}
+}
+
+var errUnauthorized = &rpcError{Code: codeFailed, Message: "Unauthorized"}
+
+// session is the caller of a message: bearer is the token of its HTTP
+// request, if any, and authorized is set once a call passes the check
+type session struct {
+	bearer     string
+	authorized bool
+}
+
+type request struct {
+	JSONRPC string            `json:"jsonrpc"`
+	ID      json.RawMessage   `json:"id"`
+	Method  string            `json:"method"`
+	Params  []json.RawMessage `json:"params"`
+}
+
+type response struct {
+	JSONRPC string          `json:"jsonrpc"`
+	ID      json.RawMessage `json:"id"`
+	Result  interface{}     `json:"result,omitempty"`
+	Error   *rpcError       `json:"error,omitempty"`
+}
+
+// Server answers aria2 JSON-RPC calls over HTTP POST and WebSocket.
+// Calls authenticate with "token:<secret>" as their first parameter, as
+// with aria2's --rpc-secret, or with the Bearer token of the Surge API.
+type Server struct {
+	service core.DownloadService
+	secret  string
+
+	// Version is reported by aria2.getVersion
+	Version string
+	// ResolveDir maps the "dir" option of aria2.addUri to an output
+	// directory. It is called with "" when the option is not given.
+	ResolveDir func(dir string) (string, error)
+	// Settings returns the settings reported by aria2.getGlobalOption
+	Settings func() *config.Settings
+	// Authorize, when set, decides whether token may call method,
+	// instead of comparing it with the secret
+	Authorize func(token, method string) bool
+
+	mu            sync.Mutex
+	globalOptions map[string]string // Changed by changeGlobalOption until restart
+}
+
+// NewServer creates a Server for service. secret is the token clients must send.
+func NewServer(service core.DownloadService, secret string) *Server {
+	return &Server{
+		service:       service,
+		secret:        secret,
+		Version:       "dev",
+		ResolveDir:    func(dir string) (string, error) { return dir, nil },
+		Settings:      config.DefaultSettings,
+		globalOptions: make(map[string]string),
+	}
+}
+
+// ServeHTTP handles JSON-RPC over POST, or upgrades to a WebSocket that
+// also receives aria2 notifications
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if strings.EqualFold(r.Header.Get("Upgrade"), "websocket") {
+		s.serveWebSocket(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize))
+	if err != nil {
+		http.Error(w, "Failed to read body", http.StatusBadRequest)
+		return
+	}
+	out := s.handleMessage(body, &session{bearer: bearerToken(r)})
+	if out == nil {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json-rpc")
+	if _, err := w.Write(out); err != nil {
+		utils.Debug("Failed to write aria2 response: %v", err)
+	}
+}
+
+// bearerToken returns the Bearer token of r, if any
+func bearerToken(r *http.Request) string {
+	token, _ := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return token
+}
+
+// authorized reports whether token may call method
+func (s *Server) authorized(token, method string) bool {
+	if token == "" {
+		return false
+	}
+	if s.Authorize != nil {
+		return s.Authorize(token, method)
+	}
+	return s.secret != "" && len(token) == len(s.secret) && subtle.ConstantTimeCompare([]byte(token), []byte(s.secret)) == 1
+}
+
+// handleMessage answers a single request or a batch. Returns nil when
+// there is nothing to send back (notifications only).
+func (s *Server) handleMessage(body []byte, sess *session) []byte {
+	body = []byte(strings.TrimSpace(string(body)))
+	var out interface{}
+	if len(body) > 0 && body[0] == '[' {
+		var batch []json.RawMessage
+		if err := json.Unmarshal(body, &batch); err != nil {
+			out = response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: codeParseError, Message: "Parse error"}}
+		} else {
+			var resps []response
+			for _, raw := range batch {
+				if resp, ok := s.handleRequest(raw, sess); ok {
+					resps = append(resps, resp)
+				}
+			}
+			if len(resps) == 0 {
+				return nil
+			}
+			out = resps
+		}
+	} else {
+		resp, ok := s.handleRequest(body, sess)
+		if !ok {
+			return nil
+		}
+		out = resp
+	}
+
+	data, err := json.Marshal(out)
+	if err != nil {
+		utils.Debug("Failed to encode aria2 response: %v", err)
+		return nil
+	}
+	return data
+}
+
+// handleRequest answers one request. The bool is false for a
+// notification, which gets no response.
+func (s *Server) handleRequest(raw []byte, sess *session) (response, bool) {
+	var req request
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return response{JSONRPC: "2.0", ID: json.RawMessage("null"), Error: &rpcError{Code: codeParseError, Message: "Parse error"}}, true
+	}
+	if req.ID == nil {
+		_, _ = s.call(req.Method, req.Params, sess)
+		return response{}, false
+	}
+	if req.Method == "" {
+		return response{JSONRPC: "2.0", ID: req.ID, Error: &rpcError{Code: codeInvalidRequest, Message: "Invalid Request"}}, true
+	}
+
+	result, err := s.call(req.Method, req.Params, sess)
+	resp := response{JSONRPC: "2.0", ID: req.ID}
+	if err != nil {
+		resp.Error = err
+	} else {
+		resp.Result = result
+	}
+	return resp, true
+}
+
+// call runs method after checking the token in its first parameter
+func (s *Server) call(method string, params []json.RawMessage, sess *session) (interface{}, *rpcError) {
+	switch method {
+	case "system.listMethods":
+		return methodNames(), nil
+	case "system.listNotifications":
+		return notificationNames, nil
+	case "system.multicall":
+		return s.multicall(params, sess)
+	}
+
+	fn, ok := methods[method]
+	if !ok {
+		return nil, &rpcError{Code: codeMethodNotFound, Message: "Method not found"}
+	}
+
+	token := sess.bearer
+	if len(params) > 0 {
+		var first string
+		if json.Unmarshal(params[0], &first) == nil {
+			if secret, ok := cutToken(first); ok {
+				token = secret
+				params = params[1:]
+			}
+		}
+	}
+	if !s.authorized(token, method) {
+		return nil, errUnauthorized
+	}
+	sess.authorized = true
+	return fn(s, args(params))
+}
+
+// cutToken returns the secret of a "token:<secret>" parameter
+func cutToken(param string) (string, bool) {
+	return strings.CutPrefix(param, "token:")
+}
+
+// multicall runs several calls, each with its own token, and returns
+// [result] or an error struct for each
+func (s *Server) multicall(params []json.RawMessage, sess *session) (interface{}, *rpcError) {
+	if len(params) != 1 {
+		return nil, invalidParams("system.multicall takes one array of calls")
+	}
+	var calls []struct {
+		MethodName string            `json:"methodName"`
+		Params     []json.RawMessage `json:"params"`
+	}
+	if err := json.Unmarshal(params[0], &calls); err != nil {
+		return nil, invalidParams("system.multicall takes one array of calls")
+	}
+
+	results := make([]interface{}, 0, len(calls))
+	for _, c := range calls {
+		if c.MethodName == "system.multicall" {
+			results = append(results, failed("Recursive system.multicall forbidden."))
+			continue
+		}
+		result, err := s.call(c.MethodName, c.Params, sess)
+		if err != nil {
+			results = append(results, err)
+		} else {
+			results = append(results, []interface{}{result})
+		}
+	}
+	return results, nil
+}
@@ -0,0 +1,393 @@
+package aria2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"golang.org/x/net/websocket"
+
+	"github.com/surge-downloader/surge/internal/core"
+	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+const testSecret = "s3cret"
+
+type added struct {
+	url, path, filename string
+	mirrors             []string
+	headers             map[string]string
+	opts                types.DownloadOptions
+}
+
+// fakeService records calls. Methods the tests do not use panic through
+// the nil embedded interface.
+type fakeService struct {
+	core.DownloadService
+
+	mu         sync.Mutex
+	statuses   []types.DownloadStatus
+	added      []added
+	calls      []string
+	rateLimits map[string]int64
+	events     chan interface{}
+}
+
+func (f *fakeService) record(call string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, call)
+	return nil
+}
+
+func (f *fakeService) List() ([]types.DownloadStatus, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]types.DownloadStatus(nil), f.statuses...), nil
+}
+
+func (f *fakeService) AddWithOptions(url, path, filename string, mirrors []string, headers map[string]string, opts types.DownloadOptions) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.added = append(f.added, added{url, path, filename, mirrors, headers, opts})
+	id := "0123abcd-4567-89ef-0123-456789abcdef"
+	f.statuses = append(f.statuses, types.DownloadStatus{ID: id, URL: url, Status: "queued", QueuePos: 1})
+	return id, nil
+}
+
+func (f *fakeService) Pause(id string) error  { return f.record("pause " + id) }
+func (f *fakeService) Resume(id string) error { return f.record("resume " + id) }
+func (f *fakeService) Delete(id string) error { return f.record("delete " + id) }
+
+func (f *fakeService) Move(id string, move types.QueueMove) error {
+	return f.record("move " + id + " " + string(move))
+}
+
+func (f *fakeService) SetRateLimit(id string, rate int64) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.rateLimits[id] = rate
+	return nil
+}
+
+func (f *fakeService) SetGlobalRateLimit(rate int64) error {
+	return f.SetRateLimit("", rate)
+}
+
+func (f *fakeService) SetMaxConcurrentDownloads(n int) error {
+	return f.record("concurrency " + strconv.Itoa(n))
+}
+
+func (f *fakeService) StreamEvents(ctx context.Context) (<-chan interface{}, func(), error) {
+	return f.events, func() {}, nil
+}
+
+func (f *fakeService) recorded() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]string(nil), f.calls...)
+}
+
+func newTestServer() (*Server, *fakeService) {
+	f := &fakeService{rateLimits: make(map[string]int64), events: make(chan interface{}, 10)}
+	s := NewServer(f, testSecret)
+	s.ResolveDir = func(dir string) (string, error) {
+		if dir == "" {
+			return "/downloads", nil
+		}
+		return dir, nil
+	}
+	return s, f
+}
+
+// rpc POSTs one call and decodes the response
+func rpc(t *testing.T, s *Server, method string, params ...interface{}) response {
+	t.Helper()
+	body, _ := json.Marshal(map[string]interface{}{"jsonrpc": "2.0", "id": "1", "method": method, "params": params})
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/jsonrpc", bytes.NewReader(body)))
+	var resp response
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatalf("%s: bad response %q: %v", method, rec.Body.String(), err)
+	}
+	return resp
+}
+
+func TestServer_AddURI(t *testing.T) {
+	s, f := newTestServer()
+
+	resp := rpc(t, s, "aria2.addUri", "token:"+testSecret,
+		[]string{"http://a.example/file.iso", "http://b.example/file.iso"},
+		map[string]interface{}{
+			"dir":                "/data",
+			"out":                "disk.iso",
+			"header":             []string{"X-Token: abc"},
+			"referer":            "http://a.example/",
+			"checksum":           "sha-256=" + strings.Repeat("ab", 32),
+			"max-download-limit": "1M",
+			"split":              "16", // Ignored
+		}, 0)
+	if resp.Error != nil {
+		t.Fatalf("addUri failed: %v", resp.Error)
+	}
+	if resp.Result != "0123abcd456789ef" {
+		t.Errorf("gid = %v, want 0123abcd456789ef", resp.Result)
+	}
+
+	got := f.added[0]
+	if got.url != "http://a.example/file.iso" || !reflect.DeepEqual(got.mirrors, []string{"http://b.example/file.iso"}) {
+		t.Errorf("url = %s, mirrors = %v", got.url, got.mirrors)
+	}
+	if got.path != "/data" || got.filename != "disk.iso" {
+		t.Errorf("path = %s, filename = %s", got.path, got.filename)
+	}
+	if got.headers["X-Token"] != "abc" || got.headers["Referer"] != "http://a.example/" {
+		t.Errorf("headers = %v", got.headers)
+	}
+	if got.opts.Checksum != "sha256:"+strings.Repeat("ab", 32) || got.opts.RateLimit != 1024*1024 {
+		t.Errorf("opts = %+v", got.opts)
+	}
+	if calls := f.recorded(); len(calls) != 1 || calls[0] != "move 0123abcd-4567-89ef-0123-456789abcdef top" {
+		t.Errorf("calls = %v, want a move to the front", calls)
+	}
+
+	resp = rpc(t, s, "aria2.addUri", "token:"+testSecret, []string{"http://a.example/x"}, map[string]string{"out": "../x"})
+	if resp.Error == nil {
+		t.Error("expected an out option with .. to be rejected")
+	}
+}
+
+func TestServer_Token(t *testing.T) {
+	s, _ := newTestServer()
+
+	if resp := rpc(t, s, "aria2.getGlobalStat", "token:wrong"); resp.Error == nil || resp.Error.Message != "Unauthorized" {
+		t.Errorf("wrong token: error = %v, want Unauthorized", resp.Error)
+	}
+	if resp := rpc(t, s, "aria2.getGlobalStat"); resp.Error == nil {
+		t.Error("missing token should be rejected")
+	}
+
+	// The Surge API token works as a Bearer header too
+	body := `{"jsonrpc":"2.0","id":1,"method":"aria2.getVersion","params":[]}`
+	req := httptest.NewRequest(http.MethodPost, "/jsonrpc", strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+testSecret)
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, req)
+	if !strings.Contains(rec.Body.String(), `"version":"surge-dev"`) {
+		t.Errorf("Bearer call: %s", rec.Body.String())
+	}
+
+	// listMethods needs no token
+	if resp := rpc(t, s, "system.listMethods"); resp.Error != nil {
+		t.Errorf("listMethods failed: %v", resp.Error)
+	}
+}
+
+func TestServer_TellStatus(t *testing.T) {
+	s, f := newTestServer()
+	f.statuses = []types.DownloadStatus{
+		{ID: "aaaaaaaa-0000-0000-0000-000000000001", URL: "http://x/a", DestPath: "/d/a.bin", Status: "downloading",
+			TotalSize: 1000, Downloaded: 250, Speed: 1, Connections: 4},
+		{ID: "bbbbbbbb-0000-0000-0000-000000000002", Status: "error", Error: "boom", DestPath: "/d/b.bin"},
+	}
+
+	resp := rpc(t, s, "aria2.tellStatus", "token:"+testSecret, "aaaaaaaa00000000")
+	if resp.Error != nil {
+		t.Fatalf("tellStatus failed: %v", resp.Error)
+	}
+	st := resp.Result.(map[string]interface{})
+	want := map[string]string{"gid": "aaaaaaaa00000000", "status": "active", "totalLength": "1000",
+		"completedLength": "250", "downloadSpeed": "1048576", "connections": "4", "dir": "/d"}
+	for k, v := range want {
+		if st[k] != v {
+			t.Errorf("%s = %v, want %s", k, st[k], v)
+		}
+	}
+	file := st["files"].([]interface{})[0].(map[string]interface{})
+	if file["path"] != "/d/a.bin" || file["uris"].([]interface{})[0].(map[string]interface{})["uri"] != "http://x/a" {
+		t.Errorf("files = %v", st["files"])
+	}
+
+	// keys limits the fields; the full Surge ID is accepted as a GID
+	resp = rpc(t, s, "aria2.tellStatus", "token:"+testSecret, "bbbbbbbb-0000-0000-0000-000000000002", []string{"status", "errorMessage"})
+	if !reflect.DeepEqual(resp.Result, map[string]interface{}{"status": "error", "errorMessage": "boom"}) {
+		t.Errorf("filtered status = %v", resp.Result)
+	}
+
+	if resp := rpc(t, s, "aria2.tellStatus", "token:"+testSecret, "ffffffffffffffff"); resp.Error == nil {
+		t.Error("unknown GID should fail")
+	}
+}
+
+func TestServer_TellWaiting(t *testing.T) {
+	s, f := newTestServer()
+	f.statuses = []types.DownloadStatus{
+		{ID: "p", Status: "paused"},
+		{ID: "q2", Status: "queued", QueuePos: 2},
+		{ID: "done", Status: "completed"},
+		{ID: "q1", Status: "queued", QueuePos: 1},
+	}
+	gids := func(result interface{}) []string {
+		var out []string
+		for _, st := range result.([]interface{}) {
+			out = append(out, st.(map[string]interface{})["gid"].(string))
+		}
+		return out
+	}
+
+	resp := rpc(t, s, "aria2.tellWaiting", "token:"+testSecret, 0, 10, []string{"gid"})
+	if got, want := gids(resp.Result), []string{GID("q1"), GID("q2"), GID("p")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tellWaiting = %v, want %v", got, want)
+	}
+	// A negative offset counts from the end, walking backwards
+	resp = rpc(t, s, "aria2.tellWaiting", "token:"+testSecret, -1, 2, []string{"gid"})
+	if got, want := gids(resp.Result), []string{GID("p"), GID("q2")}; !reflect.DeepEqual(got, want) {
+		t.Errorf("tellWaiting(-1, 2) = %v, want %v", got, want)
+	}
+	resp = rpc(t, s, "aria2.tellStopped", "token:"+testSecret, 0, 10)
+	if got := gids(resp.Result); !reflect.DeepEqual(got, []string{GID("done")}) {
+		t.Errorf("tellStopped = %v", got)
+	}
+	resp = rpc(t, s, "aria2.tellActive", "token:"+testSecret)
+	if got := resp.Result.([]interface{}); len(got) != 0 {
+		t.Errorf("tellActive = %v, want empty", got)
+	}
+
+	resp = rpc(t, s, "aria2.getGlobalStat", "token:"+testSecret)
+	stat := resp.Result.(map[string]interface{})
+	if stat["numWaiting"] != "3" || stat["numStopped"] != "1" || stat["numActive"] != "0" {
+		t.Errorf("getGlobalStat = %v", stat)
+	}
+}
+
+func TestServer_Control(t *testing.T) {
+	s, f := newTestServer()
+	f.statuses = []types.DownloadStatus{{ID: "aaaaaaaa-0000-0000-0000-000000000001", Status: "downloading"}}
+	gid := "aaaaaaaa00000000"
+
+	for _, method := range []string{"aria2.pause", "aria2.unpause", "aria2.remove"} {
+		if resp := rpc(t, s, method, "token:"+testSecret, gid); resp.Error != nil || resp.Result != gid {
+			t.Errorf("%s = %v, %v", method, resp.Result, resp.Error)
+		}
+	}
+	id := f.statuses[0].ID
+	if got, want := f.recorded(), []string{"pause " + id, "resume " + id, "delete " + id}; !reflect.DeepEqual(got, want) {
+		t.Errorf("calls = %v, want %v", got, want)
+	}
+
+	if resp := rpc(t, s, "aria2.changeOption", "token:"+testSecret, gid, map[string]string{"max-download-limit": "512K"}); resp.Error != nil {
+		t.Fatalf("changeOption failed: %v", resp.Error)
+	}
+	if f.rateLimits[id] != 512*1024 {
+		t.Errorf("rate limit = %d, want 512K", f.rateLimits[id])
+	}
+	if resp := rpc(t, s, "aria2.changeOption", "token:"+testSecret, gid, map[string]string{"split": "4"}); resp.Error == nil {
+		t.Error("unsupported option should fail rather than be ignored")
+	}
+
+	resp := rpc(t, s, "aria2.changeGlobalOption", "token:"+testSecret,
+		map[string]string{"max-overall-download-limit": "2M", "max-concurrent-downloads": "5"})
+	if resp.Error != nil {
+		t.Fatalf("changeGlobalOption failed: %v", resp.Error)
+	}
+	if f.rateLimits[""] != 2*1024*1024 {
+		t.Errorf("global limit = %d, want 2M", f.rateLimits[""])
+	}
+	opts := rpc(t, s, "aria2.getGlobalOption", "token:"+testSecret).Result.(map[string]interface{})
+	if opts["max-concurrent-downloads"] != "5" || opts["max-overall-download-limit"] != "2097152" {
+		t.Errorf("getGlobalOption = %v", opts)
+	}
+}
+
+func TestServer_BatchAndMulticall(t *testing.T) {
+	s, _ := newTestServer()
+
+	body := `[{"jsonrpc":"2.0","id":1,"method":"aria2.getVersion","params":["token:` + testSecret + `"]},` +
+		`{"jsonrpc":"2.0","id":2,"method":"aria2.nope","params":[]},` +
+		`{"jsonrpc":"2.0","method":"aria2.getVersion","params":[]}]`
+	rec := httptest.NewRecorder()
+	s.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/jsonrpc", strings.NewReader(body)))
+	var batch []response
+	if err := json.Unmarshal(rec.Body.Bytes(), &batch); err != nil {
+		t.Fatalf("bad batch response %q: %v", rec.Body.String(), err)
+	}
+	if len(batch) != 2 || batch[0].Error != nil || batch[1].Error == nil || batch[1].Error.Code != codeMethodNotFound {
+		t.Errorf("batch = %+v, want a result and a method-not-found error", batch)
+	}
+
+	resp := rpc(t, s, "system.multicall", []map[string]interface{}{
+		{"methodName": "aria2.getVersion", "params": []string{"token:" + testSecret}},
+		{"methodName": "aria2.getVersion", "params": []string{"token:wrong"}},
+	})
+	results := resp.Result.([]interface{})
+	if _, ok := results[0].([]interface{}); !ok {
+		t.Errorf("first multicall result = %v, want [result]", results[0])
+	}
+	if e, ok := results[1].(map[string]interface{}); !ok || e["message"] != "Unauthorized" {
+		t.Errorf("second multicall result = %v, want Unauthorized", results[1])
+	}
+}
+
+func TestServer_WebSocketNotifications(t *testing.T) {
+	s, f := newTestServer()
+	srv := httptest.NewServer(s)
+	defer srv.Close()
+
+	ws, err := websocket.Dial("ws"+strings.TrimPrefix(srv.URL, "http"), "", srv.URL)
+	if err != nil {
+		t.Fatalf("dial failed: %v", err)
+	}
+	defer ws.Close()
+	_ = ws.SetDeadline(time.Now().Add(10 * time.Second))
+
+	call := `{"jsonrpc":"2.0","id":"v","method":"aria2.getVersion","params":["token:` + testSecret + `"]}`
+	if err := websocket.Message.Send(ws, call); err != nil {
+		t.Fatal(err)
+	}
+	var reply map[string]interface{}
+	if err := websocket.JSON.Receive(ws, &reply); err != nil || reply["id"] != "v" {
+		t.Fatalf("reply = %v, %v", reply, err)
+	}
+
+	f.events <- events.DownloadCompleteMsg{DownloadID: "aaaaaaaa-0000-0000-0000-000000000001"}
+	var note struct {
+		Method string              `json:"method"`
+		Params []map[string]string `json:"params"`
+	}
+	if err := websocket.JSON.Receive(ws, &note); err != nil {
+		t.Fatal(err)
+	}
+	if note.Method != "aria2.onDownloadComplete" || note.Params[0]["gid"] != "aaaaaaaa00000000" {
+		t.Errorf("notification = %+v", note)
+	}
+}
+
+func TestServer_Authorize(t *testing.T) {
+	s, f := newTestServer()
+	f.statuses = []types.DownloadStatus{{ID: "aaaaaaaa-0000-0000-0000-000000000001", Status: "downloading"}}
+	s.Authorize = func(token, method string) bool {
+		return token == "reader" && ReadOnly(method)
+	}
+
+	if resp := rpc(t, s, "aria2.tellActive", "token:reader"); resp.Error != nil {
+		t.Errorf("read call failed: %v", resp.Error)
+	}
+	if resp := rpc(t, s, "aria2.pause", "token:reader", "aaaaaaaa00000000"); resp.Error == nil || resp.Error.Message != "Unauthorized" {
+		t.Errorf("pause with a read token: error = %v, want Unauthorized", resp.Error)
+	}
+	if resp := rpc(t, s, "aria2.tellActive", "token:"+testSecret); resp.Error == nil {
+		t.Error("Authorize replaces the secret check")
+	}
+	if len(f.recorded()) != 0 {
+		t.Errorf("calls = %v, want none", f.recorded())
+	}
+}
@@ -0,0 +1,166 @@
+package aria2
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// GID returns the aria2 GID of a Surge download: 16 hex digits. For the
+// usual UUID IDs it is their start, so both are easy to match by eye.
+func GID(id string) string {
+	hexID := strings.ReplaceAll(id, "-", "")
+	if len(hexID) >= 16 {
+		if _, err := hex.DecodeString(hexID[:16]); err == nil {
+			return strings.ToLower(hexID[:16])
+		}
+	}
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:8])
+}
+
+// ariaStatus maps a Surge status to aria2's
+func ariaStatus(status string) string {
+	switch status {
+	case "downloading", "pausing":
+		return "active"
+	case "queued":
+		return "waiting"
+	case "paused":
+		return "paused"
+	case "completed":
+		return "complete"
+	case "error":
+		return "error"
+	}
+	return "waiting"
+}
+
+// find returns the download whose GID or Surge ID is gid
+func (s *Server) find(gid string) (*types.DownloadStatus, *rpcError) {
+	statuses, err := s.service.List()
+	if err != nil {
+		return nil, failed("%v", err)
+	}
+	gid = strings.ToLower(gid)
+	for i := range statuses {
+		if GID(statuses[i].ID) == gid || statuses[i].ID == gid {
+			return &statuses[i], nil
+		}
+	}
+	return nil, failed("GID %s is not found", gid)
+}
+
+// byState returns the downloads in the given aria2 states. Waiting ones
+// are in queue order, followed by paused ones.
+func (s *Server) byState(states ...string) ([]types.DownloadStatus, *rpcError) {
+	statuses, err := s.service.List()
+	if err != nil {
+		return nil, failed("%v", err)
+	}
+	var out []types.DownloadStatus
+	for _, st := range statuses {
+		for _, want := range states {
+			if ariaStatus(st.Status) == want {
+				out = append(out, st)
+				break
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return waitRank(out[i]) < waitRank(out[j])
+	})
+	return out, nil
+}
+
+// waitRank orders queued downloads by their place in the queue, ahead of the rest
+func waitRank(st types.DownloadStatus) int {
+	if st.Status == "queued" && st.QueuePos > 0 {
+		return st.QueuePos
+	}
+	return math.MaxInt
+}
+
+// window applies aria2's offset and num to a list. A negative offset
+// counts from the end and walks the list backwards.
+func window(items []types.DownloadStatus, offset, num int) []types.DownloadStatus {
+	if num <= 0 {
+		return nil
+	}
+	if offset >= 0 {
+		if offset >= len(items) {
+			return nil
+		}
+		return items[offset:min(offset+num, len(items))]
+	}
+	var out []types.DownloadStatus
+	for i := len(items) + offset; i >= 0 && len(out) < num; i-- {
+		out = append(out, items[i])
+	}
+	return out
+}
+
+// statusStruct renders a download as aria2's tellStatus does. All numbers
+// are strings. keys, when given, limits the fields returned.
+func statusStruct(st types.DownloadStatus, keys []string) map[string]interface{} {
+	dir, path := "", st.DestPath
+	if path == "" && st.Filename != "" {
+		path = st.Filename
+	}
+	if path != "" {
+		dir = filepath.Dir(path)
+	}
+	completed := st.Downloaded
+	if st.Status == "completed" && st.TotalSize > 0 {
+		completed = st.TotalSize
+	}
+
+	full := map[string]interface{}{
+		"gid":             GID(st.ID),
+		"status":          ariaStatus(st.Status),
+		"totalLength":     strconv.FormatInt(st.TotalSize, 10),
+		"completedLength": strconv.FormatInt(completed, 10),
+		"uploadLength":    "0",
+		"downloadSpeed":   strconv.FormatInt(int64(st.Speed*1024*1024), 10),
+		"uploadSpeed":     "0",
+		"connections":     strconv.Itoa(st.Connections),
+		"dir":             dir,
+		"files": []map[string]interface{}{{
+			"index":           "1",
+			"path":            path,
+			"length":          strconv.FormatInt(st.TotalSize, 10),
+			"completedLength": strconv.FormatInt(completed, 10),
+			"selected":        "true",
+			"uris":            []map[string]string{{"uri": st.URL, "status": "used"}},
+		}},
+	}
+	if st.Status == "error" {
+		full["errorCode"] = "1"
+		full["errorMessage"] = st.Error
+	}
+
+	if len(keys) == 0 {
+		return full
+	}
+	filtered := make(map[string]interface{}, len(keys))
+	for _, k := range keys {
+		if v, ok := full[k]; ok {
+			filtered[k] = v
+		}
+	}
+	return filtered
+}
+
+func statusStructs(statuses []types.DownloadStatus, keys []string) []map[string]interface{} {
+	out := make([]map[string]interface{}, 0, len(statuses))
+	for _, st := range statuses {
+		out = append(out, statusStruct(st, keys))
+	}
+	return out
+}
@@ -0,0 +1,331 @@
+// Package auth manages the API tokens of the Surge daemon: the default
+// token, which has full rights, and named tokens limited to a scope.
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Scope limits what a token may do. Each scope includes the ones before it.
+type Scope string
+
+const (
+	// ScopeRead can list downloads and follow their progress
+	ScopeRead Scope = "read"
+	// ScopeAdd can also queue new downloads
+	ScopeAdd Scope = "add"
+	// ScopeAdmin can do everything
+	ScopeAdmin Scope = "admin"
+)
+
+var scopeRank = map[Scope]int{ScopeRead: 1, ScopeAdd: 2, ScopeAdmin: 3}
+
+// ParseScope validates a scope name
+func ParseScope(s string) (Scope, error) {
+	scope := Scope(strings.ToLower(strings.TrimSpace(s)))
+	if _, ok := scopeRank[scope]; !ok {
+		return "", fmt.Errorf("unknown scope %q (want read, add or admin)", s)
+	}
+	return scope, nil
+}
+
+// Includes reports whether s grants everything other does
+func (s Scope) Includes(other Scope) bool {
+	return scopeRank[s] > 0 && scopeRank[s] >= scopeRank[other]
+}
+
+// DefaultName is how the default token is shown. It cannot be used for a named token.
+const DefaultName = "default"
+
+var validName = regexp.MustCompile(`^[A-Za-z0-9._-]{1,64}$`)
+
+// ErrNotFound is returned for a token name that does not exist
+var ErrNotFound = errors.New("token not found")
+
+// Token is a named token. Only a hash of its secret is kept.
+type Token struct {
+	Name      string `json:"name"`
+	Scope     Scope  `json:"scope"`
+	Hash      string `json:"hash"`                 // Hex SHA-256 of the secret
+	CreatedAt int64  `json:"created_at"`           // Unix timestamp
+	ExpiresAt int64  `json:"expires_at,omitempty"` // Unix timestamp, 0 if it never expires
+}
+
+// Expired reports whether the token has expired at now
+func (t Token) Expired(now time.Time) bool {
+	return t.ExpiresAt != 0 && now.Unix() >= t.ExpiresAt
+}
+
+// cachedFile is a file read by the Store, reread when it changes on disk
+type cachedFile struct {
+	modTime time.Time
+	size    int64
+	data    []byte
+}
+
+// Store keeps tokens in a directory: the default token in "token" and the
+// named ones in "tokens.json". Changes made by another process, such as
+// "surge token revoke" while the daemon runs, are picked up on the next check.
+type Store struct {
+	dir string
+
+	mu    sync.Mutex
+	files map[string]*cachedFile
+}
+
+// NewStore creates a Store for the tokens in dir
+func NewStore(dir string) *Store {
+	return &Store{dir: dir, files: make(map[string]*cachedFile)}
+}
+
+func (s *Store) defaultPath() string { return filepath.Join(s.dir, "token") }
+func (s *Store) namedPath() string   { return filepath.Join(s.dir, "tokens.json") }
+
+// read returns the contents of path, from the cache if it has not changed
+func (s *Store) read(path string) ([]byte, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		delete(s.files, path)
+		return nil, err
+	}
+	if f, ok := s.files[path]; ok && f.modTime.Equal(info.ModTime()) && f.size == info.Size() {
+		return f.data, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	s.files[path] = &cachedFile{modTime: info.ModTime(), size: info.Size(), data: data}
+	return data, nil
+}
+
+// write replaces path atomically, readable by the owner only
+func (s *Store) write(path string, data []byte) error {
+	if err := os.MkdirAll(s.dir, 0o755); err != nil {
+		return fmt.Errorf("failed to create token directory: %w", err)
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o600); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	delete(s.files, path)
+	return nil
+}
+
+// Default returns the default token, creating it on first use
+func (s *Store) Default() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := s.read(s.defaultPath())
+	if err == nil {
+		return strings.TrimSpace(string(data)), nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+	token := uuid.New().String()
+	return token, s.write(s.defaultPath(), []byte(token))
+}
+
+// RotateDefault replaces the default token and returns the new one
+func (s *Store) RotateDefault() (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token := uuid.New().String()
+	return token, s.write(s.defaultPath(), []byte(token))
+}
+
+func (s *Store) load() ([]Token, error) {
+	data, err := s.read(s.namedPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var tokens []Token
+	if err := json.Unmarshal(data, &tokens); err != nil {
+		return nil, fmt.Errorf("invalid %s: %w", s.namedPath(), err)
+	}
+	return tokens, nil
+}
+
+func (s *Store) save(tokens []Token) error {
+	sort.Slice(tokens, func(i, j int) bool { return tokens[i].Name < tokens[j].Name })
+	data, err := json.MarshalIndent(tokens, "", "  ")
+	if err != nil {
+		return err
+	}
+	return s.write(s.namedPath(), data)
+}
+
+// List returns the named tokens, sorted by name
+func (s *Store) List() ([]Token, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	tokens, err := s.load()
+	return append([]Token(nil), tokens...), err
+}
+
+// Create adds a named token and returns its secret, which is not stored.
+// A ttl of 0 means it never expires.
+func (s *Store) Create(name string, scope Scope, ttl time.Duration) (string, error) {
+	if !validName.MatchString(name) || name == DefaultName {
+		return "", fmt.Errorf("invalid token name %q (use letters, digits, '.', '_' or '-')", name)
+	}
+	if _, ok := scopeRank[scope]; !ok {
+		return "", fmt.Errorf("unknown scope %q", scope)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	for _, t := range tokens {
+		if t.Name == name {
+			return "", fmt.Errorf("token %q already exists", name)
+		}
+	}
+
+	secret, err := newSecret()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	t := Token{Name: name, Scope: scope, Hash: hashSecret(secret), CreatedAt: now.Unix()}
+	if ttl > 0 {
+		t.ExpiresAt = now.Add(ttl).Unix()
+	}
+	return secret, s.save(append(tokens, t))
+}
+
+// Revoke deletes a named token
+func (s *Store) Revoke(name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens, err := s.load()
+	if err != nil {
+		return err
+	}
+	for i, t := range tokens {
+		if t.Name == name {
+			return s.save(append(tokens[:i:i], tokens[i+1:]...))
+		}
+	}
+	return ErrNotFound
+}
+
+// Rotate gives a named token a new secret, keeping its scope and expiry,
+// and returns the secret. The old one stops working.
+func (s *Store) Rotate(name string) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	tokens, err := s.load()
+	if err != nil {
+		return "", err
+	}
+	for i := range tokens {
+		if tokens[i].Name == name {
+			secret, err := newSecret()
+			if err != nil {
+				return "", err
+			}
+			tokens[i].Hash = hashSecret(secret)
+			return secret, s.save(tokens)
+		}
+	}
+	return "", ErrNotFound
+}
+
+// Authenticate returns the scope of secret. The default token has
+// ScopeAdmin; unknown and expired tokens are rejected.
+func (s *Store) Authenticate(secret string) (Scope, bool) {
+	if secret == "" {
+		return "", false
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if data, err := s.read(s.defaultPath()); err == nil {
+		def := strings.TrimSpace(string(data))
+		if def != "" && len(def) == len(secret) && subtle.ConstantTimeCompare([]byte(def), []byte(secret)) == 1 {
+			return ScopeAdmin, true
+		}
+	}
+
+	tokens, err := s.load()
+	if err != nil {
+		return "", false
+	}
+	hash := []byte(hashSecret(secret))
+	now := time.Now()
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare(hash, []byte(t.Hash)) == 1 {
+			if t.Expired(now) {
+				return "", false
+			}
+			return t.Scope, true
+		}
+	}
+	return "", false
+}
+
+func newSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return "surge_" + hex.EncodeToString(b), nil
+}
+
+func hashSecret(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseTTL parses an expiry such as "30d", "12h" or "90m". "" or "0" never expires.
+func ParseTTL(s string) (time.Duration, error) {
+	s = strings.TrimSpace(s)
+	if s == "" || s == "0" {
+		return 0, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		var n int
+		if _, err := fmt.Sscanf(days, "%d", &n); err != nil || n <= 0 || fmt.Sprint(n) != days {
+			return 0, fmt.Errorf("invalid expiry %q", s)
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid expiry %q", s)
+	}
+	return d, nil
+}
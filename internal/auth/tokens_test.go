@@ -0,0 +1,165 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestStore_Default(t *testing.T) {
+	dir := t.TempDir()
+	s := NewStore(dir)
+
+	token, err := s.Default()
+	if err != nil || token == "" {
+		t.Fatalf("Default() = %q, %v", token, err)
+	}
+	if again, _ := s.Default(); again != token {
+		t.Errorf("Default() changed: %q then %q", token, again)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "token")); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("token file: %v, %v", info, err)
+	}
+	if scope, ok := s.Authenticate(token); !ok || scope != ScopeAdmin {
+		t.Errorf("Authenticate(default) = %q, %v; want admin", scope, ok)
+	}
+
+	rotated, err := s.RotateDefault()
+	if err != nil || rotated == token {
+		t.Fatalf("RotateDefault() = %q, %v", rotated, err)
+	}
+	if _, ok := s.Authenticate(token); ok {
+		t.Error("old default token still accepted after rotation")
+	}
+	if _, ok := s.Authenticate(rotated); !ok {
+		t.Error("rotated default token rejected")
+	}
+}
+
+func TestStore_NamedTokens(t *testing.T) {
+	dir := t.TempDir()
+	s := NewStore(dir)
+
+	secret, err := s.Create("dashboard", ScopeRead, 0)
+	if err != nil {
+		t.Fatalf("Create failed: %v", err)
+	}
+	if scope, ok := s.Authenticate(secret); !ok || scope != ScopeRead {
+		t.Errorf("Authenticate = %q, %v; want read", scope, ok)
+	}
+	if _, err := s.Create("dashboard", ScopeAdmin, 0); err == nil {
+		t.Error("duplicate name should fail")
+	}
+	for _, name := range []string{"", DefaultName, "has space", "a/b"} {
+		if _, err := s.Create(name, ScopeRead, 0); err == nil {
+			t.Errorf("Create(%q) should fail", name)
+		}
+	}
+
+	// Only a hash of the secret is written
+	data, _ := os.ReadFile(filepath.Join(dir, "tokens.json"))
+	if strings.Contains(string(data), secret) {
+		t.Error("tokens.json contains the secret")
+	}
+
+	rotated, err := s.Rotate("dashboard")
+	if err != nil {
+		t.Fatalf("Rotate failed: %v", err)
+	}
+	if _, ok := s.Authenticate(secret); ok {
+		t.Error("old secret accepted after rotation")
+	}
+	if scope, ok := s.Authenticate(rotated); !ok || scope != ScopeRead {
+		t.Errorf("rotated secret: %q, %v; want read", scope, ok)
+	}
+
+	if err := s.Revoke("dashboard"); err != nil {
+		t.Fatalf("Revoke failed: %v", err)
+	}
+	if _, ok := s.Authenticate(rotated); ok {
+		t.Error("revoked token accepted")
+	}
+	if err := s.Revoke("dashboard"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("second Revoke = %v, want ErrNotFound", err)
+	}
+	if _, err := s.Rotate("missing"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Rotate(missing) = %v, want ErrNotFound", err)
+	}
+}
+
+func TestStore_Expiry(t *testing.T) {
+	s := NewStore(t.TempDir())
+	secret, err := s.Create("ci", ScopeAdd, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tokens, _ := s.List()
+	if len(tokens) != 1 || tokens[0].ExpiresAt == 0 || tokens[0].Expired(time.Now()) {
+		t.Fatalf("tokens = %+v", tokens)
+	}
+	if !tokens[0].Expired(time.Now().Add(2 * time.Hour)) {
+		t.Error("token should expire after its lifetime")
+	}
+
+	// Backdate it, as if the hour had passed
+	tokens[0].ExpiresAt = time.Now().Add(-time.Minute).Unix()
+	data, _ := json.Marshal(tokens)
+	if err := os.WriteFile(filepath.Join(s.dir, "tokens.json"), data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := s.Authenticate(secret); ok {
+		t.Error("expired token accepted")
+	}
+}
+
+func TestStore_SeesOtherProcessChanges(t *testing.T) {
+	dir := t.TempDir()
+	daemon := NewStore(dir)
+	cli := NewStore(dir)
+
+	secret, err := cli.Create("ext", ScopeAdd, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := daemon.Authenticate(secret); !ok {
+		t.Fatal("daemon rejected a token created by another store")
+	}
+	if err := cli.Revoke("ext"); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := daemon.Authenticate(secret); ok {
+		t.Error("daemon still accepts a token revoked by another store")
+	}
+}
+
+func TestScope(t *testing.T) {
+	if !ScopeAdmin.Includes(ScopeAdd) || !ScopeAdd.Includes(ScopeRead) || ScopeRead.Includes(ScopeAdd) || ScopeAdd.Includes(ScopeAdmin) {
+		t.Error("scopes should be ordered read < add < admin")
+	}
+	if Scope("bogus").Includes(ScopeRead) {
+		t.Error("an unknown scope includes nothing")
+	}
+	if s, err := ParseScope(" Admin "); err != nil || s != ScopeAdmin {
+		t.Errorf("ParseScope = %q, %v", s, err)
+	}
+	if _, err := ParseScope("write"); err == nil {
+		t.Error("ParseScope(write) should fail")
+	}
+}
+
+func TestParseTTL(t *testing.T) {
+	for in, want := range map[string]time.Duration{"": 0, "0": 0, "30d": 30 * 24 * time.Hour, "12h": 12 * time.Hour, "90m": 90 * time.Minute} {
+		if got, err := ParseTTL(in); err != nil || got != want {
+			t.Errorf("ParseTTL(%q) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"d", "-1d", "1.5d", "soon", "-5m"} {
+		if _, err := ParseTTL(in); err == nil {
+			t.Errorf("ParseTTL(%q) should fail", in)
+		}
+	}
+}
@@ -0,0 +1,108 @@
+package config
+
+import (
+	"path"
+	"strings"
+)
+
+// Category groups downloads of one kind. A download belongs to the first
+// category with a rule matching its file extension, MIME type or URL host.
+type Category struct {
+	Name           string `json:"name"`
+	Dir            string `json:"dir,omitempty"`             // Output directory, empty keeps the default download directory
+	MaxConnections int    `json:"max_connections,omitempty"` // Connections per host, 0 uses max_connections_per_host
+	Extensions     string `json:"extensions,omitempty"`      // Comma-separated file extensions, e.g. "mp4, mkv"
+	MimeTypes      string `json:"mime_types,omitempty"`      // Comma-separated MIME types, "video/*" wildcards
+	Hosts          string `json:"hosts,omitempty"`           // Comma-separated URL hosts, "*.example.com" wildcards
+	OnComplete     string `json:"on_complete,omitempty"`     // Replaces on_complete_command for this category
+	OnError        string `json:"on_error,omitempty"`        // Replaces on_error_command for this category
+}
+
+// DefaultCategories returns the built-in categories. They have no directory,
+// so they only label downloads until one is set.
+func DefaultCategories() []Category {
+	return []Category{
+		{
+			Name:       "Video",
+			Extensions: "mp4, mkv, webm, avi, mov, m4v, wmv, flv",
+			MimeTypes:  "video/*",
+		},
+		{
+			Name:       "Music",
+			Extensions: "mp3, flac, wav, ogg, opus, m4a, aac",
+			MimeTypes:  "audio/*",
+		},
+		{
+			Name:       "ISOs",
+			Extensions: "iso, img, dmg",
+			MimeTypes:  "application/x-iso9660-image",
+		},
+		{
+			Name:       "Archives",
+			Extensions: "zip, rar, 7z, tar, gz, tgz, bz2, xz, zst",
+			MimeTypes:  "application/zip, application/x-7z-compressed, application/vnd.rar, application/gzip, application/x-tar, application/x-xz",
+		},
+		{
+			Name:       "Documents",
+			Extensions: "pdf, epub, doc, docx, odt, xls, xlsx, ods, ppt, pptx, txt",
+			MimeTypes:  "application/pdf, application/epub+zip",
+		},
+		{
+			Name:       "Programs",
+			Extensions: "exe, msi, deb, rpm, apk, appimage, pkg",
+			MimeTypes:  "application/vnd.microsoft.portable-executable, application/x-msdownload, application/vnd.debian.binary-package, application/vnd.android.package-archive",
+		},
+	}
+}
+
+// Matches reports whether any rule of the category matches the download.
+// contentType may carry parameters ("text/plain; charset=utf-8").
+func (c Category) Matches(filename, contentType, host string) bool {
+	if ext := strings.TrimPrefix(strings.ToLower(path.Ext(filename)), "."); ext != "" {
+		for _, e := range splitList(c.Extensions) {
+			if strings.TrimPrefix(strings.ToLower(e), ".") == ext {
+				return true
+			}
+		}
+	}
+
+	mime, _, _ := strings.Cut(contentType, ";")
+	if mime = strings.ToLower(strings.TrimSpace(mime)); mime != "" {
+		for _, pattern := range splitList(c.MimeTypes) {
+			pattern = strings.ToLower(pattern)
+			if pattern == mime || (strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mime, pattern[:len(pattern)-1])) {
+				return true
+			}
+		}
+	}
+
+	if host = strings.ToLower(host); host != "" {
+		for _, pattern := range splitList(c.Hosts) {
+			pattern = strings.ToLower(pattern)
+			if pattern == host || (strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:])) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// MatchCategory returns the first category matching the download, or nil
+func MatchCategory(categories []Category, filename, contentType, host string) *Category {
+	for i := range categories {
+		if categories[i].Matches(filename, contentType, host) {
+			return &categories[i]
+		}
+	}
+	return nil
+}
+
+// FindCategory returns the category with the given name (case-insensitive), or nil
+func FindCategory(categories []Category, name string) *Category {
+	for i := range categories {
+		if strings.EqualFold(categories[i].Name, name) {
+			return &categories[i]
+		}
+	}
+	return nil
+}
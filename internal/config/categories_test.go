@@ -0,0 +1,100 @@
+package config
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestCategoryMatches(t *testing.T) {
+	c := Category{
+		Name:       "Video",
+		Extensions: "mp4, .MKV",
+		MimeTypes:  "video/*, application/x-matroska",
+		Hosts:      "videos.example.com, *.cdn.example.net",
+	}
+
+	tests := []struct {
+		filename, contentType, host string
+		want                        bool
+	}{
+		{"movie.mp4", "", "", true},
+		{"Movie.MKV", "", "", true},
+		{"movie", "video/webm", "", true},
+		{"movie", "Video/MP4; codecs=avc1", "", true},
+		{"movie", "application/x-matroska", "", true},
+		{"file.bin", "", "videos.example.com", true},
+		{"file.bin", "", "eu.cdn.example.net", true},
+		{"file.bin", "", "cdn.example.net", false}, // Wildcards need a subdomain
+		{"file.bin", "application/octet-stream", "example.com", false},
+		{"mp4", "", "", false}, // No extension
+		{"", "", "", false},
+	}
+	for _, tt := range tests {
+		if got := c.Matches(tt.filename, tt.contentType, tt.host); got != tt.want {
+			t.Errorf("Matches(%q, %q, %q) = %v, want %v", tt.filename, tt.contentType, tt.host, got, tt.want)
+		}
+	}
+}
+
+func TestMatchCategory(t *testing.T) {
+	categories := []Category{
+		{Name: "Work", Hosts: "files.example.com"},
+		{Name: "Video", Extensions: "mp4"},
+	}
+
+	// The first matching category wins
+	if c := MatchCategory(categories, "talk.mp4", "", "files.example.com"); c == nil || c.Name != "Work" {
+		t.Errorf("MatchCategory = %+v, want Work", c)
+	}
+	if c := MatchCategory(categories, "talk.mp4", "", "other.com"); c == nil || c.Name != "Video" {
+		t.Errorf("MatchCategory = %+v, want Video", c)
+	}
+	if c := MatchCategory(categories, "notes.txt", "text/plain", "other.com"); c != nil {
+		t.Errorf("MatchCategory = %+v, want nil", c)
+	}
+
+	if c := FindCategory(categories, "video"); c == nil || c.Name != "Video" {
+		t.Errorf("FindCategory(video) = %+v, want Video", c)
+	}
+	if c := FindCategory(categories, "music"); c != nil {
+		t.Errorf("FindCategory(music) = %+v, want nil", c)
+	}
+}
+
+func TestDefaultCategories(t *testing.T) {
+	categories := DefaultCategories()
+	for _, c := range categories {
+		if c.Name == "" || c.Dir != "" {
+			t.Errorf("default category %+v should have a name and no directory", c)
+		}
+	}
+	if c := MatchCategory(categories, "ubuntu.iso", "", ""); c == nil || c.Name != "ISOs" {
+		t.Errorf("ubuntu.iso matched %+v, want ISOs", c)
+	}
+	if c := MatchCategory(categories, "download", "audio/mpeg", ""); c == nil || c.Name != "Music" {
+		t.Errorf("audio/mpeg matched %+v, want Music", c)
+	}
+}
+
+func TestSettingsCategories_SavedListReplacesDefaults(t *testing.T) {
+	settings := DefaultSettings()
+	data := []byte(`{"categories": [{"name": "ISOs", "dir": "~/ISOs", "max_connections": 8, "extensions": "iso"}]}`)
+	if err := json.Unmarshal(data, settings); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if len(settings.Categories) != 1 {
+		t.Fatalf("got %d categories, want 1: %+v", len(settings.Categories), settings.Categories)
+	}
+	if c := settings.Categories[0]; c.Dir != "~/ISOs" || c.MaxConnections != 8 || c.MimeTypes != "" {
+		t.Errorf("category = %+v", c)
+	}
+
+	// Files without the key keep the defaults
+	settings = DefaultSettings()
+	if err := json.Unmarshal([]byte(`{"general": {"auto_resume": true}}`), settings); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if len(settings.Categories) != len(DefaultCategories()) {
+		t.Errorf("got %d categories, want the %d defaults", len(settings.Categories), len(DefaultCategories()))
+	}
+}
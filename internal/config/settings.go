@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -12,6 +13,8 @@ type Settings struct {
 	General     GeneralSettings     `json:"general"`
 	Network     NetworkSettings     `json:"network"`
 	Performance PerformanceSettings `json:"performance"`
+	Categories  []Category          `json:"categories"`
+	Webhooks    []Webhook           `json:"webhooks,omitempty"`
 }
 
 // GeneralSettings contains application behavior settings.
@@ -25,6 +28,14 @@ type GeneralSettings struct {
 	ClipboardMonitor  bool `json:"clipboard_monitor"`
 	Theme             int  `json:"theme"`
 	LogRetentionCount int  `json:"log_retention_count"`
+
+	OnCompleteCommand string        `json:"on_complete_command"` // Shell command run when a download finishes
+	OnErrorCommand    string        `json:"on_error_command"`    // Shell command run when a download fails
+	HookTimeout       time.Duration `json:"hook_timeout"`        // Hooks still running after this are killed, 0 = no limit
+
+	ExtractArchives      bool   `json:"extract_archives"`       // Unpack finished zip, tar and 7z downloads
+	ExtractDir           string `json:"extract_dir"`            // Parent of the extracted folders, empty = next to the archive
+	ExtractDeleteArchive bool   `json:"extract_delete_archive"` // Remove the archive once it is unpacked
 }
 
 const (
@@ -42,6 +53,13 @@ type NetworkSettings struct {
 	SequentialDownload     bool   `json:"sequential_download"`
 	MinChunkSize           int64  `json:"min_chunk_size"`
 	WorkerBufferSize       int    `json:"worker_buffer_size"`
+	GlobalRateLimit        int64  `json:"global_rate_limit"` // Bytes/sec shared by all downloads, 0 = unlimited
+	Schedule               string `json:"schedule"`          // Time-of-day rules applied by the server, see scheduler.Parse
+	SSHKeyFiles            string `json:"ssh_key_files"`     // Comma-separated private keys for sftp:// URLs, empty = ~/.ssh defaults
+	SSHKnownHosts          string `json:"ssh_known_hosts"`   // known_hosts file for verifying SFTP servers, empty = ~/.ssh/known_hosts
+	HTTP2Hosts             string `json:"http2_hosts"`       // Comma-separated hosts fetched over multiplexed HTTP/2, "*" for all
+	HTTP3Hosts             string `json:"http3_hosts"`       // Comma-separated hosts fetched over HTTP/3 (QUIC), matched like HTTP2Hosts
+	HTTP2Connections       int    `json:"http2_connections"` // Connections per HTTP/2 or HTTP/3 host, shared by all workers as streams
 }
 
 // UnmarshalJSON implements custom JSON unmarshalling for Settings.
@@ -50,6 +68,15 @@ type NetworkSettings struct {
 func (s *Settings) UnmarshalJSON(data []byte) error {
 	// Use an alias to avoid infinite recursion (alias has no methods)
 	type Alias Settings
+
+	// A saved category list replaces the defaults instead of merging into them
+	var saved struct {
+		Categories json.RawMessage `json:"categories"`
+	}
+	if err := json.Unmarshal(data, &saved); err == nil && saved.Categories != nil {
+		s.Categories = nil
+	}
+
 	if err := json.Unmarshal(data, (*Alias)(s)); err != nil {
 		return err
 	}
@@ -81,6 +108,7 @@ type PerformanceSettings struct {
 	SlowWorkerGracePeriod time.Duration `json:"slow_worker_grace_period"`
 	StallTimeout          time.Duration `json:"stall_timeout"`
 	SpeedEmaAlpha         float64       `json:"speed_ema_alpha"`
+	CheckpointInterval    time.Duration `json:"checkpoint_interval"`
 }
 
 // SettingMeta provides metadata for a single setting (for UI rendering).
@@ -104,15 +132,28 @@ func GetSettingsMetadata() map[string][]SettingMeta {
 			{Key: "clipboard_monitor", Label: "Clipboard Monitor", Description: "Watch clipboard for URLs and prompt to download them.", Type: "bool"},
 			{Key: "theme", Label: "App Theme", Description: "UI Theme (System, Light, Dark).", Type: "int"},
 			{Key: "log_retention_count", Label: "Log Retention Count", Description: "Number of recent log files to keep.", Type: "int"},
+			{Key: "on_complete_command", Label: "On Complete Command", Description: "Shell command run when a download finishes. Details are passed in SURGE_* environment variables (SURGE_PATH, SURGE_ID, SURGE_URL, SURGE_SIZE, SURGE_HASH).", Type: "string"},
+			{Key: "on_error_command", Label: "On Error Command", Description: "Shell command run when a download fails. SURGE_ERROR holds the error.", Type: "string"},
+			{Key: "hook_timeout", Label: "Hook Timeout", Description: "Kill hook commands still running after this long (e.g., 300s). 0 means no limit.", Type: "duration"},
+			{Key: "extract_archives", Label: "Extract Archives", Description: "Unpack finished zip, tar (gz, bz2, xz, zst) and 7z downloads into a folder named after the archive.", Type: "bool"},
+			{Key: "extract_dir", Label: "Extract Dir", Description: "Directory the extracted folders are created in. Leave empty to extract next to the archive.", Type: "string"},
+			{Key: "extract_delete_archive", Label: "Delete After Extract", Description: "Delete the archive once it has been extracted.", Type: "bool"},
 		},
 		"Network": {
 			{Key: "max_connections_per_host", Label: "Max Connections/Host", Description: "Maximum concurrent connections per host (1-64).", Type: "int"},
-			{Key: "max_concurrent_downloads", Label: "Max Concurrent Downloads", Description: "Maximum number of downloads running at once (1-10). Requires restart.", Type: "int"},
+			{Key: "max_concurrent_downloads", Label: "Max Concurrent Downloads", Description: "Maximum number of downloads running at once (1-10).", Type: "int"},
 			{Key: "user_agent", Label: "User Agent", Description: "Custom User-Agent string for HTTP requests. Leave empty for default.", Type: "string"},
 			{Key: "proxy_url", Label: "Proxy URL", Description: "HTTP/HTTPS proxy URL (e.g. http://127.0.0.1:1700). Leave empty to use system default.", Type: "string"},
 			{Key: "sequential_download", Label: "Sequential Download", Description: "Download pieces in order (Streaming Mode). May be slower.", Type: "bool"},
 			{Key: "min_chunk_size", Label: "Min Chunk Size", Description: "Minimum download chunk size in MB (e.g., 2).", Type: "int64"},
 			{Key: "worker_buffer_size", Label: "Worker Buffer Size", Description: "I/O buffer size per worker in KB (e.g., 512).", Type: "int"},
+			{Key: "global_rate_limit", Label: "Global Speed Limit", Description: "Total bandwidth cap for all downloads in KB/s. 0 means unlimited.", Type: "int64"},
+			{Key: "schedule", Label: "Schedule", Description: "Server time rules, first match wins (e.g. mon-fri 09:00-18:00 pause; 01:00-07:00 unlimited; 2M).", Type: "string"},
+			{Key: "http2_hosts", Label: "HTTP/2 Hosts", Description: "Comma-separated HTTPS hosts to download over multiplexed HTTP/2 streams (e.g. cdn.example.com, *.akamaized.net, or * for all). Others use one HTTP/1.1 connection per worker.", Type: "string"},
+			{Key: "http3_hosts", Label: "HTTP/3 Hosts", Description: "Comma-separated HTTPS hosts to download over HTTP/3 (QUIC), matched like HTTP/2 hosts. Takes precedence over HTTP/2; hosts that don't answer over QUIC fall back to TCP.", Type: "string"},
+			{Key: "http2_connections", Label: "HTTP/2 Connections", Description: "Connections per HTTP/2 or HTTP/3 host. Workers are spread across them as streams (1-16).", Type: "int"},
+			{Key: "ssh_key_files", Label: "SSH Key Files", Description: "Comma-separated private keys for SFTP. Leave empty to use ssh-agent and ~/.ssh/id_*.", Type: "string"},
+			{Key: "ssh_known_hosts", Label: "SSH Known Hosts", Description: "known_hosts file used to verify SFTP servers. Leave empty for ~/.ssh/known_hosts.", Type: "string"},
 		},
 		"Performance": {
 			{Key: "max_task_retries", Label: "Max Task Retries", Description: "Number of times to retry a failed chunk before giving up.", Type: "int"},
@@ -120,6 +161,7 @@ func GetSettingsMetadata() map[string][]SettingMeta {
 			{Key: "slow_worker_grace_period", Label: "Slow Worker Grace", Description: "Grace period before checking worker speed (e.g., 5s).", Type: "duration"},
 			{Key: "stall_timeout", Label: "Stall Timeout", Description: "Restart workers with no data for this duration (e.g., 5s).", Type: "duration"},
 			{Key: "speed_ema_alpha", Label: "Speed EMA Alpha", Description: "Exponential moving average smoothing factor (0.0-1.0).", Type: "float64"},
+			{Key: "checkpoint_interval", Label: "Checkpoint Interval", Description: "Save the progress of active downloads this often, so a crash or power cut resumes from there (e.g., 5s).", Type: "duration"},
 		},
 	}
 }
@@ -165,6 +207,7 @@ func DefaultSettings() *Settings {
 			ClipboardMonitor:  true,
 			Theme:             ThemeAdaptive,
 			LogRetentionCount: 5,
+			HookTimeout:       5 * time.Minute,
 		},
 		Network: NetworkSettings{
 			MaxConnectionsPerHost:  32,
@@ -173,6 +216,7 @@ func DefaultSettings() *Settings {
 			SequentialDownload:     false,
 			MinChunkSize:           2 * MB,
 			WorkerBufferSize:       512 * KB,
+			HTTP2Connections:       2,
 		},
 		Performance: PerformanceSettings{
 			MaxTaskRetries:        3,
@@ -180,7 +224,9 @@ func DefaultSettings() *Settings {
 			SlowWorkerGracePeriod: 5 * time.Second,
 			StallTimeout:          3 * time.Second,
 			SpeedEmaAlpha:         0.3,
+			CheckpointInterval:    5 * time.Second,
 		},
+		Categories: DefaultCategories(),
 	}
 }
 
@@ -247,6 +293,14 @@ type RuntimeConfig struct {
 	SlowWorkerGracePeriod time.Duration
 	StallTimeout          time.Duration
 	SpeedEmaAlpha         float64
+	CheckpointInterval    time.Duration
+	SSHKeyFiles           []string
+	SSHKnownHosts         string
+	HTTP2Hosts            []string
+	HTTP3Hosts            []string
+	HTTP2Connections      int
+	DefaultDownloadDir    string
+	Categories            []Category
 }
 
 // ToRuntimeConfig creates a RuntimeConfig from user Settings
@@ -263,5 +317,24 @@ func (s *Settings) ToRuntimeConfig() *RuntimeConfig {
 		SlowWorkerGracePeriod: s.Performance.SlowWorkerGracePeriod,
 		StallTimeout:          s.Performance.StallTimeout,
 		SpeedEmaAlpha:         s.Performance.SpeedEmaAlpha,
+		CheckpointInterval:    s.Performance.CheckpointInterval,
+		SSHKeyFiles:           splitList(s.Network.SSHKeyFiles),
+		SSHKnownHosts:         strings.TrimSpace(s.Network.SSHKnownHosts),
+		HTTP2Hosts:            splitList(s.Network.HTTP2Hosts),
+		HTTP3Hosts:            splitList(s.Network.HTTP3Hosts),
+		HTTP2Connections:      s.Network.HTTP2Connections,
+		DefaultDownloadDir:    s.General.DefaultDownloadDir,
+		Categories:            s.Categories,
+	}
+}
+
+// splitList splits a comma-separated setting, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
 }
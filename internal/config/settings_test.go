@@ -306,6 +306,24 @@ func TestToRuntimeConfig(t *testing.T) {
 	}
 }
 
+func TestToRuntimeConfig_SSHSettings(t *testing.T) {
+	settings := DefaultSettings()
+	settings.Network.SSHKeyFiles = " ~/.ssh/work_key, ,/keys/backup "
+	settings.Network.SSHKnownHosts = " /etc/ssh/known_hosts "
+
+	runtime := settings.ToRuntimeConfig()
+	want := []string{"~/.ssh/work_key", "/keys/backup"}
+	if len(runtime.SSHKeyFiles) != len(want) || runtime.SSHKeyFiles[0] != want[0] || runtime.SSHKeyFiles[1] != want[1] {
+		t.Errorf("SSHKeyFiles = %q, want %q", runtime.SSHKeyFiles, want)
+	}
+	if runtime.SSHKnownHosts != "/etc/ssh/known_hosts" {
+		t.Errorf("SSHKnownHosts = %q", runtime.SSHKnownHosts)
+	}
+	if DefaultSettings().ToRuntimeConfig().SSHKeyFiles != nil {
+		t.Error("empty ssh_key_files should leave the default key list")
+	}
+}
+
 func TestGetSettingsMetadata(t *testing.T) {
 	metadata := GetSettingsMetadata()
 
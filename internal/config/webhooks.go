@@ -0,0 +1,32 @@
+package config
+
+import "strings"
+
+// WebhookEvents are the download events that can be sent to webhooks
+var WebhookEvents = []string{"queued", "started", "paused", "resumed", "complete", "error", "removed"}
+
+// Webhook is an HTTP endpoint that receives download events as JSON POSTs
+type Webhook struct {
+	URL    string `json:"url"`
+	Secret string `json:"secret,omitempty"` // Signs each body with HMAC-SHA256, empty sends unsigned
+	Events string `json:"events,omitempty"` // Comma-separated event names, empty for all WebhookEvents
+}
+
+// Wants reports whether the webhook subscribes to event
+func (w Webhook) Wants(event string) bool {
+	names := splitList(w.Events)
+	if len(names) == 0 {
+		for _, e := range WebhookEvents {
+			if e == event {
+				return true
+			}
+		}
+		return false
+	}
+	for _, name := range names {
+		if strings.EqualFold(name, event) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,23 @@
+package config
+
+import "testing"
+
+func TestWebhookWants(t *testing.T) {
+	all := Webhook{URL: "http://example.com"}
+	for _, event := range WebhookEvents {
+		if !all.Wants(event) {
+			t.Errorf("webhook without events should want %q", event)
+		}
+	}
+	if all.Wants("progress") {
+		t.Error("webhook without events should not want progress")
+	}
+
+	some := Webhook{URL: "http://example.com", Events: "complete, Error"}
+	if !some.Wants("complete") || !some.Wants("error") {
+		t.Error("webhook should want its listed events")
+	}
+	if some.Wants("started") {
+		t.Error("webhook should not want unlisted events")
+	}
+}
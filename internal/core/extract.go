@@ -0,0 +1,67 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/extract"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// extractArchive unpacks a finished download into a folder named after it and
+// returns that folder, or "" if the file is not an archive or extraction
+// failed. files holds the archive, or every volume of a multi-part archive
+// with the first one first. It blocks, so it runs on the download's
+// post-processing goroutine.
+func (s *LocalDownloadService) extractArchive(settings *config.Settings, id, filename string, files []string) string {
+	path := files[0]
+	format, err := extract.Detect(path)
+	if err != nil || format == "" {
+		return ""
+	}
+	if len(files) > 1 && format != extract.SevenZip {
+		// Only 7z volumes can be read as one archive
+		utils.Debug("Not extracting %s: multi-part %s archives are not supported", filename, format)
+		return ""
+	}
+
+	parent := filepath.Dir(path)
+	if settings.General.ExtractDir != "" {
+		parent = utils.EnsureAbsPath(utils.ExpandHome(settings.General.ExtractDir))
+	}
+	name := filename
+	if name == "" {
+		name = filepath.Base(path)
+	}
+	dest := filepath.Join(parent, extract.DirName(name))
+	utils.Debug("Extracting %s (%s) to %s", path, format, dest)
+
+	var lastReport time.Time
+	count, err := extract.Extract(s.ctx, path, dest, format, func(done, total int64) {
+		if time.Since(lastReport) < ReportInterval {
+			return
+		}
+		lastReport = time.Now()
+		s.broadcast(events.ExtractProgressMsg{DownloadID: id, Filename: filename, Extracted: done, Total: total})
+	})
+
+	result := events.ExtractDoneMsg{DownloadID: id, Filename: filename, Dir: dest, Files: count}
+	if err != nil {
+		utils.Debug("Extracting %s failed: %v", path, err)
+		result.Err = err.Error()
+		s.broadcast(result)
+		return ""
+	}
+	if settings.General.ExtractDeleteArchive {
+		for _, file := range files {
+			if err := os.Remove(file); err != nil {
+				utils.Debug("Failed to delete extracted archive %s: %v", file, err)
+			}
+		}
+	}
+	s.broadcast(result)
+	return dest
+}
@@ -0,0 +1,134 @@
+package core
+
+import (
+	"os"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/engine/checksum"
+	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/hooks"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// postProcess extracts a finished archive, if enabled, and starts the hook
+// configured for a finished or failed download. Both run in the background;
+// hooks still running when the service shuts down are killed. Files of a site
+// mirror also have their links rewritten.
+func (s *LocalDownloadService) postProcess(msg interface{}) {
+	var ev hooks.Event
+	switch m := msg.(type) {
+	case events.DownloadRemovedMsg:
+		if s.mirrors != nil {
+			go s.mirrors.Failed(m.DownloadID)
+		}
+		s.forgetSet(m.DownloadID)
+		return
+	case events.DownloadCompleteMsg:
+		ev = hooks.Event{Kind: hooks.EventComplete, ID: m.DownloadID, Filename: m.Filename, Size: m.Total}
+	case events.DownloadErrorMsg:
+		ev = hooks.Event{Kind: hooks.EventError, ID: m.DownloadID, Filename: m.Filename}
+		if m.Err != nil {
+			ev.Error = m.Err.Error()
+		}
+	default:
+		return
+	}
+
+	s.settingsMu.RLock()
+	settings := s.settings
+	s.settingsMu.RUnlock()
+	if settings == nil {
+		return
+	}
+
+	// The rest of the details were saved when the download ended
+	if entry, err := state.GetDownload(ev.ID); err == nil && entry != nil {
+		ev.URL = entry.URL
+		ev.Path = entry.DestPath
+		ev.Hash = entry.Checksum
+		ev.Category = entry.Category
+		if ev.Filename == "" {
+			ev.Filename = entry.Filename
+		}
+		if ev.Size == 0 {
+			ev.Size = entry.TotalSize
+		}
+	}
+
+	// Queuing the files a mirrored page links to raises events, so this
+	// must not block the event loop
+	if s.mirrors != nil {
+		if ev.Kind == hooks.EventComplete {
+			go s.mirrors.Completed(ev.ID, ev.Path)
+		} else {
+			go s.mirrors.Failed(ev.ID)
+		}
+	}
+
+	command := hookCommand(settings, ev)
+	extracting := ev.Kind == hooks.EventComplete && settings.General.ExtractArchives && ev.Path != ""
+	if command == "" && !extracting {
+		return
+	}
+	timeout := settings.General.HookTimeout
+
+	go func() {
+		// A multi-part archive is post-processed once, when its last volume
+		// finishes. Finding its volumes reads the history, so not on the
+		// event loop.
+		var parts []string
+		if ev.Kind == hooks.EventComplete && ev.Path != "" {
+			name, setParts, ready := s.partSet(ev.ID, ev.Path)
+			if !ready {
+				return
+			}
+			if len(setParts) > 0 {
+				parts = setParts
+				ev.Path = parts[0]
+				ev.Filename = name
+				ev.Size = 0
+				for _, part := range parts {
+					if info, err := os.Stat(part); err == nil {
+						ev.Size += info.Size()
+					}
+				}
+			}
+		}
+
+		// Hash before extraction, which may delete the archive
+		if command != "" && ev.Kind == hooks.EventComplete && ev.Hash == "" && ev.Path != "" && parts == nil {
+			if sum, err := checksum.Sum(ev.Path, "sha256"); err == nil {
+				ev.Hash = "sha256:" + sum
+			}
+		}
+		if extracting {
+			archive := parts
+			if archive == nil {
+				archive = []string{ev.Path}
+			}
+			ev.ExtractDir = s.extractArchive(settings, ev.ID, ev.Filename, archive)
+		}
+		if command == "" {
+			return
+		}
+		if err := hooks.Run(s.ctx, command, ev, timeout); err != nil {
+			utils.Debug("Hook %s for %s: %v", ev.Kind, ev.ID, err)
+		}
+	}()
+}
+
+// hookCommand returns the command for the event, preferring the download's category
+func hookCommand(settings *config.Settings, ev hooks.Event) string {
+	cat := config.FindCategory(settings.Categories, ev.Category)
+	if ev.Kind == hooks.EventError {
+		if cat != nil && cat.OnError != "" {
+			return cat.OnError
+		}
+		return settings.General.OnErrorCommand
+	}
+	if cat != nil && cat.OnComplete != "" {
+		return cat.OnComplete
+	}
+	return settings.General.OnCompleteCommand
+}
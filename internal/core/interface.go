@@ -4,6 +4,7 @@ import (
 	"context"
 
 	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/mirror"
 )
 
 // DownloadService defines the interface for interacting with the download engine.
@@ -19,6 +20,13 @@ type DownloadService interface {
 	// Add queues a new download.
 	Add(url string, path string, filename string, mirrors []string, headers map[string]string) (string, error)
 
+	// AddWithOptions queues a new download with optional per-download parameters.
+	AddWithOptions(url string, path string, filename string, mirrors []string, headers map[string]string, opts types.DownloadOptions) (string, error)
+
+	// Mirror queues a page to be copied for offline use with the assets and
+	// pages it links to. Returns the download ID of the first page.
+	Mirror(url string, path string, opts mirror.Options) (string, error)
+
 	// Pause pauses an active download.
 	Pause(id string) error
 
@@ -31,6 +39,25 @@ type DownloadService interface {
 	// Delete cancels and removes a download.
 	Delete(id string) error
 
+	// SetRateLimit changes the bandwidth cap of a download in bytes/sec (0 = unlimited).
+	SetRateLimit(id string, bytesPerSec int64) error
+
+	// SetGlobalRateLimit changes the bandwidth cap shared by all downloads in bytes/sec (0 = unlimited).
+	SetGlobalRateLimit(bytesPerSec int64) error
+
+	// SetMaxConcurrentDownloads changes how many downloads run at once.
+	// Running downloads are not interrupted when it is lowered.
+	SetMaxConcurrentDownloads(n int) error
+
+	// Move reorders a queued download (top, bottom, up or down).
+	Move(id string, move types.QueueMove) error
+
+	// SetPriority changes the queue priority of a download. Higher starts first.
+	SetPriority(id string, priority int) error
+
+	// WebhookDeliveries returns the most recent webhook deliveries, oldest first.
+	WebhookDeliveries() ([]types.WebhookDelivery, error)
+
 	// StreamEvents returns a channel that receives real-time download events.
 	// For local mode, this is a direct channel.
 	// For remote mode, this is sourced from SSE.
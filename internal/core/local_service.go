@@ -1,6 +1,7 @@
 package core
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"os"
@@ -11,10 +12,15 @@ import (
 	"github.com/google/uuid"
 	"github.com/surge-downloader/surge/internal/config"
 	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/checksum"
 	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/ratelimit"
 	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/stream"
 	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/mirror"
 	"github.com/surge-downloader/surge/internal/utils"
+	"github.com/surge-downloader/surge/internal/webhook"
 )
 
 func completedSpeedMBps(entry types.DownloadEntry) float64 {
@@ -30,18 +36,53 @@ func completedSpeedMBps(entry types.DownloadEntry) float64 {
 	return 0
 }
 
-// ReloadSettings reloads settings from disk
+// ReloadSettings reloads settings from disk. The global speed limit and the
+// number of concurrent downloads are applied only when they changed, so values
+// set live through the API survive unrelated edits.
 func (s *LocalDownloadService) ReloadSettings() error {
 	settings, err := config.LoadSettings()
 	if err != nil {
 		return err
 	}
 	s.settingsMu.Lock()
+	old := s.settings
 	s.settings = settings
 	s.settingsMu.Unlock()
+
+	if old == nil || settings.Network.GlobalRateLimit != old.Network.GlobalRateLimit {
+		ratelimit.Global().SetRate(settings.Network.GlobalRateLimit)
+	}
+	if s.Pool != nil && (old == nil || settings.Network.MaxConcurrentDownloads != old.Network.MaxConcurrentDownloads) {
+		s.Pool.SetMaxDownloads(settings.Network.MaxConcurrentDownloads)
+	}
 	return nil
 }
 
+// watchSettings reloads the settings whenever settings.json differs from
+// last, whether edited by hand or saved by a TUI. The file is small, so it is
+// compared whole: two quick saves can share a modification time and size.
+func (s *LocalDownloadService) watchSettings(last []byte) {
+	path := config.GetSettingsPath()
+
+	ticker := time.NewTicker(SettingsCheckInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		data, _ := os.ReadFile(path)
+		if bytes.Equal(data, last) {
+			continue
+		}
+		last = data
+		if err := s.ReloadSettings(); err != nil {
+			utils.Debug("Failed to reload settings: %v", err)
+		}
+	}
+}
+
 // LocalDownloadService implements DownloadService for the local embedded engine.
 type LocalDownloadService struct {
 	Pool    *download.WorkerPool
@@ -63,11 +104,19 @@ type LocalDownloadService struct {
 	// Settings Cache
 	settings   *config.Settings
 	settingsMu sync.RWMutex
+
+	webhooks *webhook.Dispatcher
+	mirrors  *mirror.Manager
+
+	// Volume IDs of the multi-part sets last post-processed, by multipart.Key
+	handledSets map[string]string
+	setsMu      sync.Mutex
 }
 
 const (
-	SpeedSmoothingAlpha = 0.3
-	ReportInterval      = 150 * time.Millisecond
+	SpeedSmoothingAlpha   = 0.3
+	ReportInterval        = 150 * time.Millisecond
+	SettingsCheckInterval = 2 * time.Second // How often settings.json is checked for edits
 )
 
 // NewLocalDownloadService creates a new specific service instance.
@@ -87,16 +136,33 @@ func NewLocalDownloadServiceWithInput(pool *download.WorkerPool, inputCh chan in
 		listeners: make([]chan interface{}, 0),
 	}
 
-	// Load initial settings
+	// Load initial settings. The file is read first so that an edit made
+	// before the watcher starts is still seen as a change.
+	settingsData, _ := os.ReadFile(config.GetSettingsPath())
 	if s.settings, _ = config.LoadSettings(); s.settings == nil {
 		s.settings = config.DefaultSettings()
 	}
+	ratelimit.Global().SetRate(s.settings.Network.GlobalRateLimit)
+	s.webhooks = webhook.NewDispatcher(func() []config.Webhook {
+		s.settingsMu.RLock()
+		defer s.settingsMu.RUnlock()
+		return s.settings.Webhooks
+	})
 
 	// Lifecycle
 	ctx, cancel := context.WithCancel(context.Background())
 	s.ctx = ctx
 	s.cancel = cancel
 
+	s.mirrors = mirror.NewManager(func(rawurl, dir, filename string) (string, error) {
+		if s.ctx.Err() != nil {
+			return "", s.ctx.Err()
+		}
+		return s.AddWithOptions(rawurl, dir, filename, nil, nil, types.DownloadOptions{Overwrite: true})
+	}, func(r mirror.Result) {
+		s.broadcast(events.MirrorDoneMsg{MirrorID: r.ID, URL: r.URL, Index: r.Index, Files: r.Files, Failed: r.Failed})
+	})
+
 	// Start broadcaster
 	go s.broadcastLoop()
 
@@ -104,6 +170,7 @@ func NewLocalDownloadServiceWithInput(pool *download.WorkerPool, inputCh chan in
 	if pool != nil {
 		s.reportTicker = time.NewTicker(ReportInterval)
 		go s.reportProgressLoop()
+		go s.watchSettings(settingsData)
 	}
 
 	return s
@@ -111,33 +178,9 @@ func NewLocalDownloadServiceWithInput(pool *download.WorkerPool, inputCh chan in
 
 func (s *LocalDownloadService) broadcastLoop() {
 	for msg := range s.InputCh {
-		s.listenerMu.Lock()
-		for _, ch := range s.listeners {
-			// Check message type
-			isProgress := false
-			switch msg.(type) {
-			case events.ProgressMsg:
-				isProgress = true
-			}
-
-			if isProgress {
-				// Non-blocking send for progress updates
-				select {
-				case ch <- msg:
-				default:
-					// Drop progress message if channel is full
-				}
-			} else {
-				// Blocking send with timeout for critical state changes
-				// We don't want to drop these, but we also don't want to block forever if a client is dead
-				select {
-				case ch <- msg:
-				case <-time.After(1 * time.Second):
-					utils.Debug("Dropped critical event due to slow client")
-				}
-			}
-		}
-		s.listenerMu.Unlock()
+		s.postProcess(msg)
+		s.webhooks.Send(msg)
+		s.broadcast(msg)
 	}
 	// Close all listeners when input closes
 	s.listenerMu.Lock()
@@ -150,6 +193,41 @@ func (s *LocalDownloadService) broadcastLoop() {
 	if s.reportTicker != nil {
 		s.reportTicker.Stop()
 	}
+
+	s.webhooks.Close()
+}
+
+// broadcast fans msg out to every listener. Events raised off the broadcast
+// loop, such as extraction progress, are sent here directly; once the
+// listeners are closed they are dropped.
+func (s *LocalDownloadService) broadcast(msg interface{}) {
+	s.listenerMu.Lock()
+	defer s.listenerMu.Unlock()
+	for _, ch := range s.listeners {
+		// Check message type
+		isProgress := false
+		switch msg.(type) {
+		case events.ProgressMsg, events.ExtractProgressMsg:
+			isProgress = true
+		}
+
+		if isProgress {
+			// Non-blocking send for progress updates
+			select {
+			case ch <- msg:
+			default:
+				// Drop progress message if channel is full
+			}
+		} else {
+			// Blocking send with timeout for critical state changes
+			// We don't want to drop these, but we also don't want to block forever if a client is dead
+			select {
+			case ch <- msg:
+			case <-time.After(1 * time.Second):
+				utils.Debug("Dropped critical event due to slow client")
+			}
+		}
+	}
 }
 
 func (s *LocalDownloadService) reportProgressLoop() {
@@ -324,16 +402,27 @@ func (s *LocalDownloadService) List() ([]types.DownloadStatus, error) {
 
 	// 1. Get active downloads from pool
 	if s.Pool != nil {
+		queuePos := make(map[string]int)
+		for i, cfg := range s.Pool.Queued() {
+			queuePos[cfg.ID] = i + 1
+		}
+
 		activeConfigs := s.Pool.GetAll()
 		for _, cfg := range activeConfigs {
 			status := types.DownloadStatus{
-				ID:       cfg.ID,
-				URL:      cfg.URL,
-				Filename: cfg.Filename,
-				Status:   "downloading",
+				ID:        cfg.ID,
+				URL:       cfg.URL,
+				Filename:  cfg.Filename,
+				Status:    "downloading",
+				RateLimit: cfg.Limiter.Rate(),
+				Priority:  cfg.Priority,
+				Category:  cfg.Category,
 			}
 
-			if cfg.State != nil {
+			if pos := queuePos[cfg.ID]; pos > 0 {
+				status.Status = "queued"
+				status.QueuePos = pos
+			} else if cfg.State != nil {
 				// Calculate progress and speed (thread-safe)
 				downloaded, totalSize, _, sessionElapsed, connections, sessionStart := cfg.State.GetProgress()
 
@@ -342,6 +431,9 @@ func (s *LocalDownloadService) List() ([]types.DownloadStatus, error) {
 				if dp := cfg.State.GetDestPath(); dp != "" {
 					status.DestPath = dp
 				}
+				if c := cfg.State.GetCategory(); c != "" {
+					status.Category = c
+				}
 
 				if status.TotalSize > 0 {
 					status.Progress = float64(status.Downloaded) * 100 / float64(status.TotalSize)
@@ -414,6 +506,7 @@ func (s *LocalDownloadService) List() ([]types.DownloadStatus, error) {
 				Connections: 0,
 				TimeTaken:   d.TimeTaken,
 				AvgSpeed:    d.AvgSpeed,
+				Category:    d.Category,
 			})
 		}
 	}
@@ -423,10 +516,29 @@ func (s *LocalDownloadService) List() ([]types.DownloadStatus, error) {
 
 // Add queues a new download.
 func (s *LocalDownloadService) Add(url string, path string, filename string, mirrors []string, headers map[string]string) (string, error) {
+	return s.AddWithOptions(url, path, filename, mirrors, headers, types.DownloadOptions{})
+}
+
+// AddWithOptions queues a new download with optional per-download parameters.
+func (s *LocalDownloadService) AddWithOptions(url string, path string, filename string, mirrors []string, headers map[string]string, opts types.DownloadOptions) (string, error) {
 	if s.Pool == nil {
 		return "", fmt.Errorf("worker pool not initialized")
 	}
 
+	expectedChecksum, err := checksum.Normalize(opts.Checksum)
+	if err != nil {
+		return "", fmt.Errorf("invalid checksum: %w", err)
+	}
+	if err := checksum.NormalizePieces(opts.Pieces); err != nil {
+		return "", fmt.Errorf("invalid piece hashes: %w", err)
+	}
+	if opts.RateLimit < 0 {
+		return "", fmt.Errorf("invalid rate limit: %d", opts.RateLimit)
+	}
+	if _, err := stream.ParseVariant(opts.Variant); err != nil {
+		return "", err
+	}
+
 	s.settingsMu.RLock()
 	settings := s.settings
 	s.settingsMu.RUnlock()
@@ -449,15 +561,24 @@ func (s *LocalDownloadService) Add(url string, path string, filename string, mir
 	state.DestPath = filepath.Join(outPath, filename) // Best guess until download starts
 
 	cfg := types.DownloadConfig{
-		URL:        url,
-		Mirrors:    mirrors,
-		OutputPath: outPath,
-		ID:         id,
-		Filename:   filename, // If empty, will be auto-detected
-		ProgressCh: s.InputCh,
-		State:      state,
-		Runtime:    types.ConvertRuntimeConfig(settings.ToRuntimeConfig()),
-		Headers:    headers,
+		URL:          url,
+		Mirrors:      mirrors,
+		OutputPath:   outPath,
+		ID:           id,
+		Filename:     filename, // If empty, will be auto-detected
+		ProgressCh:   s.InputCh,
+		State:        state,
+		Runtime:      types.ConvertRuntimeConfig(settings.ToRuntimeConfig()),
+		Headers:      headers,
+		Checksum:     expectedChecksum,
+		Pieces:       opts.Pieces,
+		ExpectedSize: opts.Size,
+		Limiter:      ratelimit.New(opts.RateLimit),
+		Priority:     opts.Priority,
+		Category:     opts.Category,
+		Overwrite:    opts.Overwrite,
+		KeepDir:      opts.KeepDir,
+		Variant:      opts.Variant,
 	}
 
 	s.Pool.Add(cfg)
@@ -465,6 +586,25 @@ func (s *LocalDownloadService) Add(url string, path string, filename string, mir
 	return id, nil
 }
 
+// Mirror queues a page to be copied for offline use with the assets and
+// pages it links to. Returns the download ID of the first page.
+func (s *LocalDownloadService) Mirror(url string, path string, opts mirror.Options) (string, error) {
+	if s.Pool == nil {
+		return "", fmt.Errorf("worker pool not initialized")
+	}
+
+	outPath := path
+	if outPath == "" {
+		s.settingsMu.RLock()
+		outPath = s.settings.General.DefaultDownloadDir
+		s.settingsMu.RUnlock()
+		if outPath == "" {
+			outPath = "."
+		}
+	}
+	return s.mirrors.Start(url, utils.EnsureAbsPath(outPath), opts)
+}
+
 // Pause pauses an active download.
 func (s *LocalDownloadService) Pause(id string) error {
 	if s.Pool == nil {
@@ -500,6 +640,8 @@ func (s *LocalDownloadService) Resume(id string) error {
 
 	if st := s.Pool.GetStatus(id); st != nil && st.Status == "pausing" {
 		return fmt.Errorf("download is still pausing, try again in a moment")
+	} else if st != nil && st.Status == "queued" {
+		return nil // Already waiting to start
 	}
 
 	// Try pool resume first
@@ -508,13 +650,31 @@ func (s *LocalDownloadService) Resume(id string) error {
 	}
 
 	// Cold Resume Logic
+	cfg, err := s.coldResumeConfig(id)
+	if err != nil {
+		return err
+	}
+
+	s.Pool.Add(cfg)
+	if s.InputCh != nil {
+		s.InputCh <- events.DownloadResumedMsg{
+			DownloadID: id,
+			Filename:   cfg.Filename,
+		}
+	}
+	return nil
+}
+
+// coldResumeConfig rebuilds the config of a paused download that is no
+// longer in the pool from its saved state
+func (s *LocalDownloadService) coldResumeConfig(id string) (types.DownloadConfig, error) {
 	entry, err := state.GetDownload(id)
 	if err != nil || entry == nil {
-		return fmt.Errorf("download not found")
+		return types.DownloadConfig{}, fmt.Errorf("download not found")
 	}
 
 	if entry.Status == "completed" {
-		return fmt.Errorf("download already completed")
+		return types.DownloadConfig{}, fmt.Errorf("download already completed")
 	}
 
 	s.settingsMu.RLock()
@@ -571,16 +731,13 @@ func (s *LocalDownloadService) Resume(id string) error {
 		SavedState: savedState, // Pass loaded state to avoid re-query
 		Runtime:    types.ConvertRuntimeConfig(settings.ToRuntimeConfig()),
 		Mirrors:    mirrorURLs,
+		Checksum:   entry.Checksum,
+		Category:   entry.Category,
 	}
-
-	s.Pool.Add(cfg)
-	if s.InputCh != nil {
-		s.InputCh <- events.DownloadResumedMsg{
-			DownloadID: id,
-			Filename:   entry.Filename,
-		}
+	if savedState != nil {
+		cfg.Limiter = ratelimit.New(savedState.RateLimit)
 	}
-	return nil
+	return cfg, nil
 }
 
 // ResumeBatch resumes multiple paused downloads efficiently.
@@ -602,6 +759,8 @@ func (s *LocalDownloadService) ResumeBatch(ids []string) []error {
 		if st := s.Pool.GetStatus(id); st != nil && st.Status == "pausing" {
 			errs[i] = fmt.Errorf("download is still pausing, try again in a moment")
 			continue
+		} else if st != nil && st.Status == "queued" {
+			continue // Already waiting to start
 		}
 
 		if s.Pool.Resume(id) {
@@ -681,6 +840,9 @@ func (s *LocalDownloadService) ResumeBatch(ids []string) []error {
 			SavedState: savedState, // Pass loaded state to avoid re-query
 			Runtime:    types.ConvertRuntimeConfig(settings.ToRuntimeConfig()),
 			Mirrors:    mirrorURLs,
+			Checksum:   savedState.Checksum,
+			Limiter:    ratelimit.New(savedState.RateLimit),
+			Category:   savedState.Category,
 		}
 
 		s.Pool.Add(cfg)
@@ -690,6 +852,136 @@ func (s *LocalDownloadService) ResumeBatch(ids []string) []error {
 	return errs
 }
 
+// SetRateLimit changes the bandwidth cap of a download.
+// Running downloads pick up the new cap immediately; paused ones keep it for resume.
+func (s *LocalDownloadService) SetRateLimit(id string, bytesPerSec int64) error {
+	if s.Pool == nil {
+		return fmt.Errorf("worker pool not initialized")
+	}
+	if bytesPerSec < 0 {
+		return fmt.Errorf("invalid rate limit: %d", bytesPerSec)
+	}
+
+	inPool := s.Pool.SetRateLimit(id, bytesPerSec)
+	// Keep the persisted cap in sync for downloads that have been paused before
+	if err := state.UpdateRateLimit(id, bytesPerSec); err != nil && !inPool {
+		return fmt.Errorf("download not found")
+	}
+	return nil
+}
+
+// SetGlobalRateLimit changes the bandwidth cap shared by all downloads.
+// The change lasts until settings are reloaded.
+func (s *LocalDownloadService) SetGlobalRateLimit(bytesPerSec int64) error {
+	if bytesPerSec < 0 {
+		return fmt.Errorf("invalid rate limit: %d", bytesPerSec)
+	}
+	ratelimit.Global().SetRate(bytesPerSec)
+	return nil
+}
+
+// SetMaxConcurrentDownloads changes how many downloads run at once.
+func (s *LocalDownloadService) SetMaxConcurrentDownloads(n int) error {
+	if s.Pool == nil {
+		return fmt.Errorf("worker pool not initialized")
+	}
+	if n < 1 {
+		return fmt.Errorf("invalid concurrent download limit: %d", n)
+	}
+	s.Pool.SetMaxDownloads(n)
+	return nil
+}
+
+// Move reorders a queued download.
+func (s *LocalDownloadService) Move(id string, move types.QueueMove) error {
+	if s.Pool == nil {
+		return fmt.Errorf("worker pool not initialized")
+	}
+	if _, err := types.ParseQueueMove(string(move)); err != nil {
+		return err
+	}
+	if !s.Pool.Move(id, move) {
+		return fmt.Errorf("download is not queued")
+	}
+	return nil
+}
+
+// SetPriority changes the queue priority of a download.
+// Downloads that already started keep it for when they are queued again.
+func (s *LocalDownloadService) SetPriority(id string, priority int) error {
+	if s.Pool == nil {
+		return fmt.Errorf("worker pool not initialized")
+	}
+	if !s.Pool.SetPriority(id, priority) {
+		return fmt.Errorf("download not found")
+	}
+	return nil
+}
+
+// RestoreQueue queues the downloads that were waiting when Surge last exited,
+// in their saved order. Downloads that had started before resume from their
+// saved progress. Returns the number of downloads queued.
+func (s *LocalDownloadService) RestoreQueue() (int, error) {
+	if s.Pool == nil {
+		return 0, fmt.Errorf("worker pool not initialized")
+	}
+	entries, err := state.LoadQueue()
+	if err != nil {
+		return 0, err
+	}
+
+	s.settingsMu.RLock()
+	settings := s.settings
+	s.settingsMu.RUnlock()
+
+	restored := 0
+	for _, e := range entries {
+		if s.Pool.GetStatus(e.ID) != nil {
+			continue // Already in the pool
+		}
+
+		if entry, err := state.GetDownload(e.ID); err == nil && entry != nil {
+			// Paused before it was queued again. It is added with its saved
+			// priority so it lands at its saved position, as the others do.
+			cfg, err := s.coldResumeConfig(e.ID)
+			if err != nil {
+				utils.Debug("RestoreQueue: failed to resume %s: %v", e.ID, err)
+				continue
+			}
+			cfg.Priority = e.Priority
+			cfg.Limiter = ratelimit.New(e.RateLimit) // Saved with the queue, so newer than the download's state
+			s.Pool.Add(cfg)
+			if s.InputCh != nil {
+				s.InputCh <- events.DownloadResumedMsg{DownloadID: e.ID, Filename: cfg.Filename}
+			}
+			restored++
+			continue
+		}
+
+		dmState := types.NewProgressState(e.ID, 0)
+		dmState.DestPath = filepath.Join(e.OutputPath, e.Filename)
+		s.Pool.Add(types.DownloadConfig{
+			URL:          e.URL,
+			Mirrors:      e.Mirrors,
+			OutputPath:   e.OutputPath,
+			ID:           e.ID,
+			Filename:     e.Filename,
+			ProgressCh:   s.InputCh,
+			State:        dmState,
+			Runtime:      types.ConvertRuntimeConfig(settings.ToRuntimeConfig()),
+			Checksum:     e.Checksum,
+			Pieces:       e.Pieces,
+			ExpectedSize: e.Size,
+			Limiter:      ratelimit.New(e.RateLimit),
+			Priority:     e.Priority,
+			Category:     e.Category,
+			Variant:      e.Variant,
+		})
+		restored++
+	}
+	return restored, nil
+}
+
 // Delete cancels and removes a download.
 func (s *LocalDownloadService) Delete(id string) error {
 	if s.Pool == nil {
@@ -759,6 +1051,7 @@ func (s *LocalDownloadService) GetStatus(id string) (*types.DownloadStatus, erro
 			Status:     entry.Status,
 			TimeTaken:  entry.TimeTaken,
 			AvgSpeed:   entry.AvgSpeed,
+			Category:   entry.Category,
 		}
 		return &status, nil
 	}
@@ -771,3 +1064,8 @@ func (s *LocalDownloadService) History() ([]types.DownloadEntry, error) {
 	// For local service, we can directly access the state DB
 	return state.LoadCompletedDownloads()
 }
+
+// WebhookDeliveries returns the most recent webhook deliveries, oldest first.
+func (s *LocalDownloadService) WebhookDeliveries() ([]types.WebhookDelivery, error) {
+	return s.webhooks.Deliveries(), nil
+}
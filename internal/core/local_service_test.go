@@ -1,18 +1,25 @@
 package core
 
 import (
+	"archive/zip"
 	"context"
+	"errors"
 	"net/http"
 	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/surge-downloader/surge/internal/config"
 	"github.com/surge-downloader/surge/internal/download"
 	"github.com/surge-downloader/surge/internal/engine/events"
 	"github.com/surge-downloader/surge/internal/engine/state"
 	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/mirror"
 	"github.com/surge-downloader/surge/internal/testutil"
 )
 
@@ -308,3 +315,504 @@ func TestLocalDownloadService_ResumeRejectedWhilePausing(t *testing.T) {
 		t.Fatal("expected resume to fail while download is still pausing")
 	}
 }
+
+func TestLocalDownloadService_RestoreQueue(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	state.CloseDB()
+	state.Configure(filepath.Join(tempDir, "surge.db"))
+	defer state.CloseDB()
+
+	// Server that never answers keeps the first download running,
+	// so the rest stay queued
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+
+	saved := []types.QueueEntry{
+		{ID: "running", URL: server.URL + "/running.bin", OutputPath: tempDir, Filename: "running.bin", Priority: types.PriorityHigh},
+		{ID: "a", URL: server.URL + "/a.bin", OutputPath: tempDir, Filename: "a.bin", RateLimit: 1024},
+		{ID: "b", URL: server.URL + "/b.bin", OutputPath: tempDir, Filename: "b.bin"},
+		{ID: "c", URL: server.URL + "/c.bin", OutputPath: tempDir, Filename: "c.bin", Priority: types.PriorityLow},
+	}
+	if err := state.SaveQueue(saved); err != nil {
+		t.Fatalf("SaveQueue failed: %v", err)
+	}
+
+	ch := make(chan interface{}, 100)
+	pool := download.NewWorkerPool(ch, 1)
+	svc := NewLocalDownloadServiceWithInput(pool, ch)
+	defer func() {
+		close(release)
+		_ = svc.Shutdown()
+	}()
+
+	n, err := svc.RestoreQueue()
+	if err != nil {
+		t.Fatalf("RestoreQueue failed: %v", err)
+	}
+	if n != len(saved) {
+		t.Fatalf("restored %d downloads, want %d", n, len(saved))
+	}
+
+	queueOrder := func() []string {
+		var ids []string
+		for _, cfg := range pool.Queued() {
+			ids = append(ids, cfg.ID)
+		}
+		return ids
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for len(pool.Queued()) != 3 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if got := queueOrder(); !slices.Equal(got, []string{"a", "b", "c"}) {
+		t.Fatalf("restored queue = %v, want [a b c]", got)
+	}
+	if st := pool.GetStatus("a"); st == nil || st.RateLimit != 1024 {
+		t.Errorf("restored download lost its rate limit: %+v", st)
+	}
+
+	if err := svc.Move("c", types.MoveTop); err != nil {
+		t.Fatalf("Move failed: %v", err)
+	}
+	if got := queueOrder(); !slices.Equal(got, []string{"c", "a", "b"}) {
+		t.Errorf("queue after move = %v, want [c a b]", got)
+	}
+	if err := svc.Move("running", types.MoveTop); err == nil {
+		t.Error("expected Move to fail for a running download")
+	}
+
+	if err := svc.SetPriority("b", types.PriorityHigh); err != nil {
+		t.Fatalf("SetPriority failed: %v", err)
+	}
+	if got := queueOrder(); !slices.Equal(got, []string{"b", "c", "a"}) {
+		t.Errorf("queue after priority change = %v, want [b c a]", got)
+	}
+	if err := svc.SetPriority("missing", types.PriorityHigh); err == nil {
+		t.Error("expected SetPriority to fail for an unknown download")
+	}
+
+	statuses, err := svc.List()
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	for _, st := range statuses {
+		if st.ID == "a" && (st.Status != "queued" || st.QueuePos != 3) {
+			t.Errorf("List reported %s as %s at position %d, want queued at 3", st.ID, st.Status, st.QueuePos)
+		}
+	}
+}
+
+func TestLocalDownloadService_RunsHooks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	state.CloseDB()
+	state.Configure(filepath.Join(tempDir, "surge.db"))
+	defer state.CloseDB()
+
+	destPath := filepath.Join(tempDir, "movie.mkv")
+	if err := os.WriteFile(destPath, []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.AddToMasterList(types.DownloadEntry{
+		ID: "done", URL: "https://example.com/movie.mkv", DestPath: destPath, Filename: "movie.mkv",
+		Status: "completed", TotalSize: 5, Category: "Video",
+	}); err != nil {
+		t.Fatalf("AddToMasterList failed: %v", err)
+	}
+
+	completeOut := filepath.Join(tempDir, "complete.txt")
+	errorOut := filepath.Join(tempDir, "error.txt")
+	t.Setenv("COMPLETE_OUT", completeOut)
+	t.Setenv("ERROR_OUT", errorOut)
+
+	svc := NewLocalDownloadServiceWithInput(nil, nil)
+	defer func() { _ = svc.Shutdown() }()
+	svc.settings = config.DefaultSettings()
+	svc.settings.General.OnCompleteCommand = `echo global > "$COMPLETE_OUT"`
+	svc.settings.General.OnErrorCommand = `printf '%s|%s' "$SURGE_ID" "$SURGE_ERROR" > "$ERROR_OUT"`
+	svc.settings.Categories = []config.Category{
+		{Name: "Video", OnComplete: `printf '%s|%s|%s|%s' "$SURGE_PATH" "$SURGE_SIZE" "$SURGE_HASH" "$SURGE_CATEGORY" > "$COMPLETE_OUT"`},
+	}
+
+	_ = svc.Publish(events.DownloadCompleteMsg{DownloadID: "done", Filename: "movie.mkv", Total: 5})
+	_ = svc.Publish(events.DownloadErrorMsg{DownloadID: "failed", Filename: "x.bin", Err: errors.New("connection reset")})
+
+	// The category hook replaces the global one; the hash is computed when none was recorded
+	want := destPath + "|5|sha256:2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824|Video"
+	waitForFile(t, completeOut, want)
+	waitForFile(t, errorOut, "failed|connection reset")
+}
+
+func TestLocalDownloadService_ExtractsArchives(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	state.CloseDB()
+	state.Configure(filepath.Join(tempDir, "surge.db"))
+	defer state.CloseDB()
+
+	archive := filepath.Join(tempDir, "photos.zip")
+	f, err := os.Create(archive)
+	if err != nil {
+		t.Fatal(err)
+	}
+	zw := zip.NewWriter(f)
+	w, _ := zw.Create("album/one.txt")
+	_, _ = w.Write([]byte("one"))
+	_ = zw.Close()
+	_ = f.Close()
+	if err := state.AddToMasterList(types.DownloadEntry{
+		ID: "zip", URL: "https://example.com/photos.zip", DestPath: archive, Filename: "photos.zip", Status: "completed",
+	}); err != nil {
+		t.Fatalf("AddToMasterList failed: %v", err)
+	}
+
+	extractDir := filepath.Join(tempDir, "extracted")
+	hookOut := filepath.Join(tempDir, "hook.txt")
+	t.Setenv("HOOK_OUT", hookOut)
+
+	svc := NewLocalDownloadServiceWithInput(nil, nil)
+	defer func() { _ = svc.Shutdown() }()
+	svc.settings = config.DefaultSettings()
+	svc.settings.General.ExtractArchives = true
+	svc.settings.General.ExtractDir = extractDir
+	svc.settings.General.ExtractDeleteArchive = true
+	svc.settings.General.OnCompleteCommand = `printf '%s' "$SURGE_EXTRACT_DIR" > "$HOOK_OUT"`
+
+	stream, cleanup, err := svc.StreamEvents(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	_ = svc.Publish(events.DownloadCompleteMsg{DownloadID: "zip", Filename: "photos.zip", Total: 1})
+
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case msg := <-stream:
+			done, ok := msg.(events.ExtractDoneMsg)
+			if !ok {
+				continue
+			}
+			if done.Err != "" || done.Files != 1 || done.Dir != filepath.Join(extractDir, "photos") {
+				t.Fatalf("unexpected result %+v", done)
+			}
+			data, err := os.ReadFile(filepath.Join(done.Dir, "album", "one.txt"))
+			if err != nil || string(data) != "one" {
+				t.Errorf("extracted file = %q (%v)", data, err)
+			}
+			if _, err := os.Stat(archive); !os.IsNotExist(err) {
+				t.Error("archive should be deleted after extraction")
+			}
+			if runtime.GOOS != "windows" {
+				waitForFile(t, hookOut, done.Dir)
+			}
+			return
+		case <-timeout:
+			t.Fatal("timed out waiting for extraction")
+		}
+	}
+}
+
+func TestLocalDownloadService_WaitsForWholePartSet(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	state.CloseDB()
+	state.Configure(filepath.Join(tempDir, "surge.db"))
+	defer state.CloseDB()
+
+	part1 := filepath.Join(tempDir, "movie.7z.001")
+	part2 := filepath.Join(tempDir, "movie.7z.002")
+	for _, p := range []string{part1, part2} {
+		if err := os.WriteFile(p, []byte("part"), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	add := func(id, path, status string) {
+		t.Helper()
+		var completedAt int64
+		if status == "completed" {
+			completedAt = time.Now().Unix()
+		}
+		if err := state.AddToMasterList(types.DownloadEntry{
+			ID: id, URL: "https://example.com/" + filepath.Base(path), DestPath: path,
+			Filename: filepath.Base(path), Status: status, TotalSize: 4, CompletedAt: completedAt,
+		}); err != nil {
+			t.Fatalf("AddToMasterList failed: %v", err)
+		}
+	}
+	add("p1", part1, "completed")
+	add("p2", part2, "downloading")
+
+	hookOut := filepath.Join(tempDir, "hook.txt")
+	t.Setenv("HOOK_OUT", hookOut)
+
+	svc := NewLocalDownloadServiceWithInput(nil, nil)
+	defer func() { _ = svc.Shutdown() }()
+	svc.settings = config.DefaultSettings()
+	svc.settings.General.OnCompleteCommand = `printf '%s|%s|%s;' "$SURGE_PATH" "$SURGE_FILENAME" "$SURGE_SIZE" >> "$HOOK_OUT"`
+
+	// The first volume finishes while the second is still downloading
+	_ = svc.Publish(events.DownloadCompleteMsg{DownloadID: "p1", Filename: "movie.7z.001", Total: 4})
+	time.Sleep(200 * time.Millisecond)
+	if _, err := os.Stat(hookOut); !os.IsNotExist(err) {
+		t.Fatal("hook ran before every volume finished")
+	}
+
+	add("p2", part2, "completed")
+	_ = svc.Publish(events.DownloadCompleteMsg{DownloadID: "p2", Filename: "movie.7z.002", Total: 4})
+	// A repeated event must not run the set's hook again
+	_ = svc.Publish(events.DownloadCompleteMsg{DownloadID: "p2", Filename: "movie.7z.002", Total: 4})
+
+	waitForFile(t, hookOut, part1+"|movie.7z|8;")
+	time.Sleep(200 * time.Millisecond)
+	waitForFile(t, hookOut, part1+"|movie.7z|8;")
+
+	// Downloading the set again into the same directory runs the hook again,
+	// once, with each volume counted once
+	add("q1", part1, "completed")
+	add("q2", part2, "completed")
+	_ = svc.Publish(events.DownloadCompleteMsg{DownloadID: "q1", Filename: "movie.7z.001", Total: 4})
+	_ = svc.Publish(events.DownloadCompleteMsg{DownloadID: "q2", Filename: "movie.7z.002", Total: 4})
+	want := part1 + "|movie.7z|8;" + part1 + "|movie.7z|8;"
+	waitForFile(t, hookOut, want)
+	time.Sleep(200 * time.Millisecond)
+	waitForFile(t, hookOut, want)
+
+	// Removing a volume forgets the set
+	_ = svc.Publish(events.DownloadRemovedMsg{DownloadID: "q1"})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		svc.setsMu.Lock()
+		n := len(svc.handledSets)
+		svc.setsMu.Unlock()
+		if n == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d sets still remembered after removing a volume", n)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func waitForFile(t *testing.T, path, want string) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		data, err := os.ReadFile(path)
+		if err == nil && string(data) == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%s = %q (%v), want %q", filepath.Base(path), data, err, want)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+func TestLocalDownloadService_MirrorsSite(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	state.CloseDB()
+	state.Configure(filepath.Join(tempDir, "surge.db"))
+	defer state.CloseDB()
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/docs/":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<html><body><img src="/img/logo.png"><a href="guide">Guide</a></body></html>`))
+		case "/docs/guide":
+			w.Header().Set("Content-Type", "text/html")
+			_, _ = w.Write([]byte(`<html><body><a href="./">Back</a></body></html>`))
+		case "/img/logo.png":
+			w.Header().Set("Content-Type", "image/png")
+			_, _ = w.Write([]byte("png"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	ch := make(chan interface{}, 100)
+	pool := download.NewWorkerPool(ch, 2)
+	svc := NewLocalDownloadServiceWithInput(pool, ch)
+	defer func() { _ = svc.Shutdown() }()
+
+	stream, cleanup, err := svc.StreamEvents(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cleanup()
+
+	outDir := filepath.Join(tempDir, "site")
+	host := strings.ReplaceAll(strings.TrimPrefix(ts.URL, "http://"), ":", "_")
+	index := filepath.Join(outDir, host, "docs", "index.html")
+	// A copy from an earlier run is replaced, not kept next to the new one
+	if err := os.MkdirAll(filepath.Dir(index), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(index, []byte("old"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := svc.Mirror(ts.URL+"/docs/", outDir, mirror.Options{})
+	if err != nil {
+		t.Fatalf("Mirror failed: %v", err)
+	}
+
+	timeout := time.After(10 * time.Second)
+	for {
+		select {
+		case msg := <-stream:
+			done, ok := msg.(events.MirrorDoneMsg)
+			if !ok {
+				continue
+			}
+			if done.MirrorID != id || done.Files != 3 || done.Failed != 0 || done.Index != index {
+				t.Fatalf("unexpected result %+v", done)
+			}
+			data, err := os.ReadFile(index)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if page := string(data); !strings.Contains(page, `src="../img/logo.png"`) || !strings.Contains(page, `href="guide.html"`) {
+				t.Errorf("index.html links not rewritten:\n%s", page)
+			}
+			if _, err := os.Stat(filepath.Join(outDir, host, "docs", "index(1).html")); err == nil {
+				t.Error("index.html from the earlier run was kept")
+			}
+			for _, f := range []string{"docs/guide.html", "img/logo.png"} {
+				if _, err := os.Stat(filepath.Join(outDir, host, filepath.FromSlash(f))); err != nil {
+					t.Errorf("missing %s: %v", f, err)
+				}
+			}
+			return
+		case <-timeout:
+			t.Fatal("timeout waiting for the mirror to finish")
+		}
+	}
+}
+
+func TestLocalDownloadService_ReloadsSettings(t *testing.T) {
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+
+	pool := download.NewWorkerPool(nil, 1)
+	svc := NewLocalDownloadServiceWithInput(pool, make(chan interface{}, 10))
+	defer func() { _ = svc.Shutdown() }()
+
+	settings := config.DefaultSettings()
+	settings.Network.MaxConcurrentDownloads = 4
+	if err := config.SaveSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.ReloadSettings(); err != nil {
+		t.Fatal(err)
+	}
+	if got := pool.MaxDownloads(); got != 4 {
+		t.Fatalf("MaxDownloads = %d after reload, want 4", got)
+	}
+
+	// A live change survives edits to other settings
+	if err := svc.SetMaxConcurrentDownloads(2); err != nil {
+		t.Fatal(err)
+	}
+	settings.Network.UserAgent = "test-agent"
+	if err := config.SaveSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	if err := svc.ReloadSettings(); err != nil {
+		t.Fatal(err)
+	}
+	if got := pool.MaxDownloads(); got != 2 {
+		t.Fatalf("MaxDownloads = %d after an unrelated edit, want 2", got)
+	}
+
+	// Saving the file is enough for the service to pick it up
+	settings.Network.MaxConcurrentDownloads = 5
+	if err := config.SaveSettings(settings); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(3 * SettingsCheckInterval)
+	for pool.MaxDownloads() != 5 {
+		if time.Now().After(deadline) {
+			t.Fatalf("MaxDownloads = %d, settings.json edit not picked up", pool.MaxDownloads())
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestLocalDownloadService_RestoreQueueKeepsPausedInPlace(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", tempDir)
+	state.CloseDB()
+	state.Configure(filepath.Join(tempDir, "surge.db"))
+	defer state.CloseDB()
+
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+
+	entry := func(id string, priority int) types.QueueEntry {
+		return types.QueueEntry{ID: id, URL: server.URL + "/" + id, OutputPath: tempDir, Filename: id + ".bin", Priority: priority}
+	}
+	saved := []types.QueueEntry{
+		entry("running", types.PriorityHigh),
+		entry("p1", types.PriorityHigh),
+		entry("a", types.PriorityNormal),
+		{ID: "p2", URL: server.URL + "/p2", OutputPath: tempDir, Filename: "p2.bin", RateLimit: 2048},
+		entry("b", types.PriorityNormal),
+		entry("p3", types.PriorityLow),
+	}
+	// p1-p3 were paused, then resumed and waiting when Surge stopped
+	for _, id := range []string{"p1", "p2", "p3"} {
+		if err := state.AddToMasterList(types.DownloadEntry{
+			ID: id, URL: server.URL + "/" + id, DestPath: filepath.Join(tempDir, id+".bin"), Filename: id + ".bin", Status: "paused", TotalSize: 100,
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := state.SaveQueue(saved); err != nil {
+		t.Fatal(err)
+	}
+
+	ch := make(chan interface{}, 100)
+	pool := download.NewWorkerPool(ch, 1)
+	svc := NewLocalDownloadServiceWithInput(pool, ch)
+	defer func() {
+		close(release)
+		_ = svc.Shutdown()
+	}()
+
+	if n, err := svc.RestoreQueue(); err != nil || n != len(saved) {
+		t.Fatalf("RestoreQueue = %d, %v", n, err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for len(pool.Queued()) != 5 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	var got []string
+	for _, cfg := range pool.Queued() {
+		got = append(got, cfg.ID)
+	}
+	if want := []string{"p1", "a", "p2", "b", "p3"}; !slices.Equal(got, want) {
+		t.Errorf("restored queue = %v, want %v", got, want)
+	}
+	if st := pool.GetStatus("p2"); st == nil || st.RateLimit != 2048 {
+		t.Errorf("restored paused download lost its rate limit: %+v", st)
+	}
+}
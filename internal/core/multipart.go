@@ -0,0 +1,148 @@
+package core
+
+import (
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/multipart"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// partSet finds the multi-part archive a finished download belongs to. It
+// returns the set name and its volumes, first volume first, once every
+// volume in the same directory has finished; ready is false while others are
+// still to come or when these volumes were already handled. Downloads that
+// are not part of a set return ready with no parts.
+func (s *LocalDownloadService) partSet(id, path string) (name string, parts []string, ready bool) {
+	part, ok := multipart.Parse(filepath.Base(path))
+	if !ok {
+		return "", nil, true
+	}
+	dir := filepath.Dir(path)
+
+	type volume struct {
+		id        string
+		path      string
+		index     int
+		completed int64
+	}
+	// By path: a set downloaded again into the same directory leaves the
+	// earlier downloads of its volumes in the history
+	volumes := map[string]volume{path: {id: id, path: path, index: part.Index}}
+	pending := 0
+
+	member := func(dir2, filename string) (int, bool) {
+		if filename == "" || !sameDir(dir, dir2) {
+			return 0, false
+		}
+		p, ok := multipart.Parse(filename)
+		if !ok || !strings.EqualFold(p.Set, part.Set) {
+			return 0, false
+		}
+		return p.Index, true
+	}
+
+	entries, err := state.ListAllDownloads()
+	if err != nil {
+		utils.Debug("Multi-part set %s: %v", part.Set, err)
+		return "", nil, false
+	}
+	counted := make(map[string]bool)
+	for _, e := range entries {
+		if e.ID == id || e.DestPath == "" {
+			continue
+		}
+		index, ok := member(filepath.Dir(e.DestPath), filepath.Base(e.DestPath))
+		if !ok {
+			continue
+		}
+		counted[e.ID] = true
+		if e.Status != "completed" {
+			pending++
+			continue
+		}
+		if v, ok := volumes[e.DestPath]; ok && (v.id == id || v.completed > e.CompletedAt) {
+			continue
+		}
+		volumes[e.DestPath] = volume{id: e.ID, path: e.DestPath, index: index, completed: e.CompletedAt}
+	}
+
+	// Running and queued downloads not in the history yet are not finished.
+	// One that has just finished is saved as completed before its worker
+	// lets go of it, so the history decides for those listed there.
+	if s.Pool != nil {
+		for _, cfg := range s.Pool.GetAll() {
+			if cfg.ID == id || counted[cfg.ID] {
+				continue
+			}
+			dest, filename := cfg.DestPath, cfg.Filename
+			if filename == "" {
+				filename = multipart.URLFilename(cfg.URL)
+			}
+			if dest == "" {
+				dest = filepath.Join(cfg.OutputPath, filename)
+			}
+			if _, ok := member(filepath.Dir(dest), filename); ok {
+				pending++
+			}
+		}
+	}
+
+	if pending == 0 && len(volumes) < 2 {
+		// A lone .rar or .zip, or a single numbered file
+		return "", nil, true
+	}
+	if pending > 0 {
+		utils.Debug("Multi-part set %s: waiting for %d more parts", part.Set, pending)
+		return "", nil, false
+	}
+
+	sorted := make([]volume, 0, len(volumes))
+	ids := make([]string, 0, len(volumes))
+	for _, v := range volumes {
+		sorted = append(sorted, v)
+		ids = append(ids, v.id)
+	}
+	sort.Strings(ids)
+
+	// The last volumes of a set can finish together, each seeing the others
+	// done. The set is handled once for these volumes; downloading it again
+	// brings new ones.
+	key := multipart.Key(utils.EnsureAbsPath(dir), part.Set)
+	handled := strings.Join(ids, ",")
+	s.setsMu.Lock()
+	if s.handledSets == nil {
+		s.handledSets = make(map[string]string)
+	}
+	if s.handledSets[key] == handled {
+		s.setsMu.Unlock()
+		return "", nil, false
+	}
+	s.handledSets[key] = handled
+	s.setsMu.Unlock()
+
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].index < sorted[j].index })
+	for _, v := range sorted {
+		parts = append(parts, v.path)
+	}
+	return part.Set, parts, true
+}
+
+// forgetSet drops what is remembered about the set a removed download was a
+// volume of
+func (s *LocalDownloadService) forgetSet(id string) {
+	s.setsMu.Lock()
+	defer s.setsMu.Unlock()
+	for key, ids := range s.handledSets {
+		if slices.Contains(strings.Split(ids, ","), id) {
+			delete(s.handledSets, key)
+		}
+	}
+}
+
+func sameDir(a, b string) bool {
+	return utils.EnsureAbsPath(a) == utils.EnsureAbsPath(b)
+}
@@ -9,11 +9,14 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/surge-downloader/surge/internal/engine/events"
 	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/mirror"
+	"github.com/surge-downloader/surge/internal/tlscert"
 )
 
 // RemoteDownloadService implements DownloadService for a remote daemon.
@@ -39,6 +42,21 @@ func NewRemoteDownloadService(baseURL string, token string) *RemoteDownloadServi
 	}
 }
 
+// PinCertificate makes the service trust only a daemon whose TLS certificate
+// has the given SHA-256 fingerprint, such as its self-signed one
+func (s *RemoteDownloadService) PinCertificate(fingerprint string) error {
+	config, err := tlscert.PinnedConfig(fingerprint)
+	if err != nil {
+		return err
+	}
+	for _, client := range []*http.Client{s.Client, s.SSEClient} {
+		transport := http.DefaultTransport.(*http.Transport).Clone()
+		transport.TLSClientConfig = config
+		client.Transport = transport
+	}
+	return nil
+}
+
 func (s *RemoteDownloadService) doRequest(method, path string, body interface{}) (*http.Response, error) {
 	var bodyReader io.Reader
 	if body != nil {
@@ -104,6 +122,21 @@ func (s *RemoteDownloadService) History() ([]types.DownloadEntry, error) {
 	return history, nil
 }
 
+// WebhookDeliveries returns the most recent webhook deliveries, oldest first.
+func (s *RemoteDownloadService) WebhookDeliveries() ([]types.WebhookDelivery, error) {
+	resp, err := s.doRequest("GET", "/webhooks", nil)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var deliveries []types.WebhookDelivery
+	if err := json.NewDecoder(resp.Body).Decode(&deliveries); err != nil {
+		return nil, err
+	}
+	return deliveries, nil
+}
+
 // GetStatus returns a status for a single download by id.
 func (s *RemoteDownloadService) GetStatus(id string) (*types.DownloadStatus, error) {
 	resp, err := s.doRequest("GET", "/download?id="+url.QueryEscape(id), nil)
@@ -121,6 +154,11 @@ func (s *RemoteDownloadService) GetStatus(id string) (*types.DownloadStatus, err
 
 // Add queues a new download.
 func (s *RemoteDownloadService) Add(url string, path string, filename string, mirrors []string, headers map[string]string) (string, error) {
+	return s.AddWithOptions(url, path, filename, mirrors, headers, types.DownloadOptions{})
+}
+
+// AddWithOptions queues a new download with optional per-download parameters.
+func (s *RemoteDownloadService) AddWithOptions(url string, path string, filename string, mirrors []string, headers map[string]string, opts types.DownloadOptions) (string, error) {
 	req := map[string]interface{}{
 		"url":           url,
 		"path":          path,
@@ -129,6 +167,27 @@ func (s *RemoteDownloadService) Add(url string, path string, filename string, mi
 		"headers":       headers,
 		"skip_approval": true,
 	}
+	if opts.Checksum != "" {
+		req["checksum"] = opts.Checksum
+	}
+	if opts.Pieces != nil {
+		req["pieces"] = opts.Pieces
+	}
+	if opts.Size > 0 {
+		req["size"] = opts.Size
+	}
+	if opts.RateLimit > 0 {
+		req["rate_limit"] = opts.RateLimit
+	}
+	if opts.Priority != 0 {
+		req["priority"] = opts.Priority
+	}
+	if opts.Category != "" {
+		req["category"] = opts.Category
+	}
+	if opts.Variant != "" {
+		req["variant"] = opts.Variant
+	}
 
 	resp, err := s.doRequest("POST", "/download", req)
 	if err != nil {
@@ -143,6 +202,30 @@ func (s *RemoteDownloadService) Add(url string, path string, filename string, mi
 	return result["id"], nil
 }
 
+// Mirror queues a page to be copied for offline use with the assets and
+// pages it links to. Returns the download ID of the first page.
+func (s *RemoteDownloadService) Mirror(url string, path string, opts mirror.Options) (string, error) {
+	req := map[string]interface{}{
+		"url":        url,
+		"path":       path,
+		"max_depth":  opts.MaxDepth,
+		"span_hosts": opts.SpanHosts,
+		"max_files":  opts.MaxFiles,
+	}
+
+	resp, err := s.doRequest("POST", "/mirror", req)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	var result map[string]string
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		return "", err
+	}
+	return result["id"], nil
+}
+
 // Pause pauses an active download.
 func (s *RemoteDownloadService) Pause(id string) error {
 	resp, err := s.doRequest("POST", "/pause?id="+url.QueryEscape(id), nil)
@@ -184,6 +267,56 @@ func (s *RemoteDownloadService) Delete(id string) error {
 	return nil
 }
 
+// SetRateLimit changes the bandwidth cap of a download.
+func (s *RemoteDownloadService) SetRateLimit(id string, bytesPerSec int64) error {
+	resp, err := s.doRequest("POST", "/limit?id="+url.QueryEscape(id)+"&rate="+strconv.FormatInt(bytesPerSec, 10), nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	return nil
+}
+
+// SetGlobalRateLimit changes the bandwidth cap shared by all downloads.
+func (s *RemoteDownloadService) SetGlobalRateLimit(bytesPerSec int64) error {
+	resp, err := s.doRequest("POST", "/limit?rate="+strconv.FormatInt(bytesPerSec, 10), nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	return nil
+}
+
+// SetMaxConcurrentDownloads changes how many downloads run at once.
+func (s *RemoteDownloadService) SetMaxConcurrentDownloads(n int) error {
+	resp, err := s.doRequest("POST", "/concurrency?max="+strconv.Itoa(n), nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	return nil
+}
+
+// Move reorders a queued download.
+func (s *RemoteDownloadService) Move(id string, move types.QueueMove) error {
+	resp, err := s.doRequest("POST", "/queue?id="+url.QueryEscape(id)+"&move="+url.QueryEscape(string(move)), nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	return nil
+}
+
+// SetPriority changes the queue priority of a download.
+func (s *RemoteDownloadService) SetPriority(id string, priority int) error {
+	resp, err := s.doRequest("POST", "/queue?id="+url.QueryEscape(id)+"&priority="+strconv.Itoa(priority), nil)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	return nil
+}
+
 // Shutdown stops the service.
 func (s *RemoteDownloadService) Shutdown() error {
 	s.cancel()
@@ -350,6 +483,24 @@ func (s *RemoteDownloadService) connectSSE(ctx context.Context, ch chan interfac
 				continue
 			}
 			msg = m
+		case "extract_progress":
+			var m events.ExtractProgressMsg
+			if err := json.Unmarshal([]byte(jsonData), &m); err != nil {
+				continue
+			}
+			msg = m
+		case "extract_done":
+			var m events.ExtractDoneMsg
+			if err := json.Unmarshal([]byte(jsonData), &m); err != nil {
+				continue
+			}
+			msg = m
+		case "mirror_done":
+			var m events.MirrorDoneMsg
+			if err := json.Unmarshal([]byte(jsonData), &m); err != nil {
+				continue
+			}
+			msg = m
 		default:
 			continue
 		}
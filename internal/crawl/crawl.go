@@ -0,0 +1,381 @@
+// Package crawl walks the directory listings that web servers generate for
+// folders without an index page (Apache mod_autoindex, nginx autoindex,
+// lighttpd mod_dirlisting) and lists the files below a URL.
+package crawl
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+const (
+	// DefaultMaxFiles stops runaway crawls of huge or looping trees
+	DefaultMaxFiles = 10000
+
+	maxPageSize  = 16 << 20 // Listings of very large folders run to a few MB
+	fetchTimeout = 30 * time.Second
+)
+
+// ErrTooManyFiles is returned when a crawl finds more files than allowed
+var ErrTooManyFiles = errors.New("too many files")
+
+// Options narrows down what a crawl returns
+type Options struct {
+	MaxDepth  int      // Levels of subfolders to enter; 0 means no limit
+	Include   []string // Glob patterns; if set, a file must match one
+	Exclude   []string // Glob patterns for files and folders to skip
+	MinSize   int64    // Skip files smaller than this; 0 means no limit
+	MaxSize   int64    // Skip files larger than this; 0 means no limit
+	MaxFiles  int      // 0 means DefaultMaxFiles
+	UserAgent string
+	Headers   map[string]string
+}
+
+// File is a file found in a listing
+type File struct {
+	URL  string `json:"url"`
+	Path string `json:"path"` // Relative to the crawled folder, slash-separated
+	Size int64  `json:"size"` // -1 when the listing does not show it
+}
+
+// Crawl lists the files in the folder at root and, up to opts.MaxDepth, its
+// subfolders. Only links to entries directly inside each folder are
+// followed, so parent, sort-order and off-site links are ignored. Folders
+// that fail to load are skipped; only a failure on root is returned.
+func Crawl(ctx context.Context, root string, opts Options) ([]File, error) {
+	u, err := url.Parse(root)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid url %q", root)
+	}
+	u.Fragment = ""
+	if !strings.HasSuffix(u.Path, "/") {
+		u.Path += "/"
+		u.RawPath = ""
+	}
+	maxFiles := opts.MaxFiles
+	if maxFiles <= 0 {
+		maxFiles = DefaultMaxFiles
+	}
+
+	c := &crawler{opts: opts, client: http.DefaultClient}
+	type folder struct {
+		url   *url.URL
+		rel   string
+		depth int
+	}
+	queue := []folder{{url: u}}
+	visited := map[string]bool{u.Path: true}
+	var files []File
+
+	for len(queue) > 0 {
+		dir := queue[0]
+		queue = queue[1:]
+
+		base, entries, err := c.list(ctx, dir.url)
+		if err != nil {
+			if dir.rel == "" {
+				return nil, err
+			}
+			utils.Debug("Crawl: skipping %s: %v", dir.url, err)
+			continue
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if base.Path != dir.url.Path {
+			// Redirected, e.g. by a symlink, possibly back up the tree
+			if visited[base.Path] {
+				continue
+			}
+			visited[base.Path] = true
+		}
+
+		for _, e := range entries {
+			rel := path.Join(dir.rel, e.name)
+			if !filepath.IsLocal(filepath.FromSlash(rel)) {
+				continue
+			}
+			if matchAny(opts.Exclude, e.name, rel) {
+				continue
+			}
+			target := base.ResolveReference(e.ref)
+
+			if e.dir {
+				if opts.MaxDepth > 0 && dir.depth >= opts.MaxDepth {
+					continue
+				}
+				if visited[target.Path] {
+					continue
+				}
+				visited[target.Path] = true
+				queue = append(queue, folder{url: target, rel: rel, depth: dir.depth + 1})
+				continue
+			}
+
+			if len(opts.Include) > 0 && !matchAny(opts.Include, e.name, rel) {
+				continue
+			}
+			size := e.size
+			if size < 0 && (opts.MinSize > 0 || opts.MaxSize > 0) {
+				size = c.contentLength(ctx, target)
+			}
+			if size >= 0 && (size < opts.MinSize || (opts.MaxSize > 0 && size > opts.MaxSize)) {
+				continue
+			}
+			if len(files) >= maxFiles {
+				return files, fmt.Errorf("%w: more than %d in %s", ErrTooManyFiles, maxFiles, root)
+			}
+			files = append(files, File{URL: target.String(), Path: rel, Size: size})
+		}
+	}
+	return files, nil
+}
+
+// matchAny reports whether any pattern matches the entry's name or its
+// path below the crawled folder
+func matchAny(patterns []string, name, rel string) bool {
+	for _, p := range patterns {
+		if ok, _ := path.Match(p, name); ok {
+			return true
+		}
+		if ok, _ := path.Match(p, rel); ok {
+			return true
+		}
+	}
+	return false
+}
+
+type crawler struct {
+	opts   Options
+	client *http.Client
+}
+
+func (c *crawler) request(ctx context.Context, method string, u *url.URL) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range c.opts.Headers {
+		req.Header.Set(k, v)
+	}
+	if c.opts.UserAgent != "" {
+		req.Header.Set("User-Agent", c.opts.UserAgent)
+	}
+	return c.client.Do(req)
+}
+
+// list loads a folder's listing. It returns the URL the listing was served
+// from, after redirects, which links are resolved against.
+func (c *crawler) list(ctx context.Context, u *url.URL) (*url.URL, []entry, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	resp, err := c.request(ctx, http.MethodGet, u)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch listing: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, fmt.Errorf("failed to fetch listing %s: unexpected status %d", u, resp.StatusCode)
+	}
+	if mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type")); mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return nil, nil, fmt.Errorf("%s is not a directory listing (%s)", u, resp.Header.Get("Content-Type"))
+	}
+
+	base := resp.Request.URL
+	if !strings.HasSuffix(base.Path, "/") {
+		// Redirected to a file, or the folder was asked for without a slash
+		base = base.ResolveReference(&url.URL{Path: path.Base(base.Path) + "/"})
+	}
+	entries, err := parseListing(io.LimitReader(resp.Body, maxPageSize), base)
+	if err != nil {
+		return nil, nil, err
+	}
+	return base, entries, nil
+}
+
+// contentLength asks the server for a file's size, or returns -1
+func (c *crawler) contentLength(ctx context.Context, u *url.URL) int64 {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	resp, err := c.request(ctx, http.MethodHead, u)
+	if err != nil {
+		return -1
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return -1
+	}
+	return resp.ContentLength
+}
+
+// entry is a link in a listing to something directly inside the folder
+type entry struct {
+	ref  *url.URL // Relative to the folder
+	name string
+	dir  bool
+	size int64
+}
+
+// parseListing collects the links in a listing page that point directly
+// into base, with the size shown next to each if there is one. Every
+// supported server puts the size after the link, in the same table row or
+// line of preformatted text, so it is read from the text up to the next link.
+func parseListing(r io.Reader, base *url.URL) ([]entry, error) {
+	var entries []entry
+	seen := make(map[string]bool)
+	current := -1 // Entry whose trailing text is being read
+	var trailing strings.Builder
+
+	finish := func() {
+		if current >= 0 {
+			entries[current].size = sizeIn(trailing.String())
+		}
+		current = -1
+		trailing.Reset()
+	}
+
+	z := html.NewTokenizer(r)
+	for {
+		switch z.Next() {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return nil, fmt.Errorf("invalid listing: %w", err)
+			}
+			finish()
+			return entries, nil
+		case html.TextToken:
+			if current >= 0 {
+				trailing.Write(z.Text())
+				trailing.WriteByte(' ')
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			name, hasAttr := z.TagName()
+			switch string(name) {
+			case "a":
+				finish()
+				if !hasAttr {
+					continue
+				}
+				e, ok := linkEntry(z, base)
+				if !ok || seen[e.name] {
+					continue
+				}
+				seen[e.name] = true
+				entries = append(entries, e)
+				current = len(entries) - 1
+			case "tr":
+				finish()
+			}
+		case html.EndTagToken:
+			if name, _ := z.TagName(); string(name) == "tr" || string(name) == "pre" || string(name) == "table" {
+				finish()
+			}
+		}
+	}
+}
+
+// linkEntry reads the href of an <a> tag and keeps it if it names an entry
+// directly inside base
+func linkEntry(z *html.Tokenizer, base *url.URL) (entry, bool) {
+	var href string
+	for {
+		key, val, more := z.TagAttr()
+		if string(key) == "href" {
+			href = strings.TrimSpace(string(val))
+		}
+		if !more {
+			break
+		}
+	}
+	if href == "" || strings.HasPrefix(href, "#") || strings.HasPrefix(href, "?") {
+		return entry{}, false
+	}
+
+	ref, err := url.Parse(href)
+	if err != nil || ref.RawQuery != "" {
+		return entry{}, false
+	}
+	target := base.ResolveReference(ref)
+	if target.Scheme != base.Scheme || target.Host != base.Host {
+		return entry{}, false
+	}
+	rest, ok := strings.CutPrefix(target.EscapedPath(), base.EscapedPath())
+	if !ok || rest == "" {
+		return entry{}, false
+	}
+	isDir := strings.HasSuffix(rest, "/")
+	rest = strings.TrimSuffix(rest, "/")
+	if rest == "" || strings.Contains(rest, "/") {
+		return entry{}, false
+	}
+	name, err := url.PathUnescape(rest)
+	if err != nil || name == "." || name == ".." || strings.ContainsAny(name, `/\`) {
+		return entry{}, false
+	}
+
+	if isDir {
+		rest += "/"
+	}
+	ref, err = url.Parse(rest)
+	if err != nil {
+		return entry{}, false
+	}
+	return entry{ref: ref, name: name, dir: isDir, size: -1}, true
+}
+
+// sizeIn picks the file size out of the text after a link, e.g. the "1.2K"
+// in "2024-01-31 10:15  1.2K". Dates and times are skipped; folders show
+// "-" and get -1.
+func sizeIn(text string) int64 {
+	fields := strings.Fields(text)
+	for i := len(fields) - 1; i >= 0; i-- {
+		f := fields[i]
+		if strings.ContainsAny(f, ":-/") {
+			continue
+		}
+		if size, err := ParseSize(f); err == nil {
+			return size
+		}
+	}
+	return -1
+}
+
+// ParseSize parses a size such as "1.2K", "350M", "4GB" or "12345" into
+// bytes. Units are binary (K = 1024), as in autoindex listings.
+func ParseSize(raw string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(raw))
+	s = strings.TrimSuffix(s, "B")
+	s = strings.TrimSuffix(s, "I")
+	if s == "" || s[0] < '0' || s[0] > '9' {
+		return 0, fmt.Errorf("invalid size %q", raw)
+	}
+
+	multiplier := int64(1)
+	if i := strings.IndexByte("KMGTP", s[len(s)-1]); i >= 0 {
+		multiplier = int64(1) << (10 * (i + 1))
+		s = s[:len(s)-1]
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid size %q", raw)
+	}
+	return int64(value * float64(multiplier)), nil
+}
@@ -0,0 +1,206 @@
+package crawl
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// Listings as generated by each server, trimmed to the parts that matter
+var listings = map[string]string{
+	// Apache mod_autoindex, FancyIndexing with HTMLTable
+	"/data/": `<!DOCTYPE HTML PUBLIC "-//W3C//DTD HTML 3.2 Final//EN">
+<html><head><title>Index of /data</title></head><body>
+<h1>Index of /data</h1>
+<table>
+<tr><th valign="top"><img src="/icons/blank.gif" alt="[ICO]"></th><th><a href="?C=N;O=D">Name</a></th><th><a href="?C=M;O=A">Last modified</a></th><th><a href="?C=S;O=A">Size</a></th><th><a href="?C=D;O=A">Description</a></th></tr>
+<tr><th colspan="5"><hr></th></tr>
+<tr><td valign="top"><img src="/icons/back.gif" alt="[PARENTDIR]"></td><td><a href="/">Parent Directory</a></td><td>&nbsp;</td><td align="right">  - </td><td>&nbsp;</td></tr>
+<tr><td valign="top"><img src="/icons/folder.gif" alt="[DIR]"></td><td><a href="images/">images/</a></td><td align="right">2024-01-31 10:15  </td><td align="right">  - </td><td>&nbsp;</td></tr>
+<tr><td valign="top"><img src="/icons/folder.gif" alt="[DIR]"></td><td><a href="logs/">logs/</a></td><td align="right">2024-01-31 10:15  </td><td align="right">  - </td><td>&nbsp;</td></tr>
+<tr><td valign="top"><img src="/icons/text.gif" alt="[TXT]"></td><td><a href="README.txt">README.txt</a></td><td align="right">2024-01-31 10:15  </td><td align="right">1.5K</td><td>&nbsp;</td></tr>
+<tr><td valign="top"><img src="/icons/compressed.gif" alt="[   ]"></td><td><a href="set%201.tar.gz">set 1.tar.gz</a></td><td align="right">2024-01-31 10:15  </td><td align="right">2.0M</td><td>&nbsp;</td></tr>
+<tr><th colspan="5"><hr></th></tr>
+</table>
+<address>Apache/2.4.58 (Ubuntu) Server at example.com Port 80</address>
+</body></html>`,
+
+	// nginx autoindex
+	"/data/images/": `<html>
+<head><title>Index of /data/images/</title></head>
+<body>
+<h1>Index of /data/images/</h1><hr><pre><a href="../">../</a>
+<a href="raw/">raw/</a>                                               31-Jan-2024 10:15                   -
+<a href="a.png">a.png</a>                                              31-Jan-2024 10:15                2048
+<a href="b.jpg">b.jpg</a>                                              31-Jan-2024 10:15              500000
+<a href="https://elsewhere.example/c.png">c.png</a>                    31-Jan-2024 10:15                  10
+</pre><hr></body>
+</html>`,
+
+	// lighttpd mod_dirlisting
+	"/data/images/raw/": `<!DOCTYPE html>
+<html><head><title>Index of /data/images/raw/</title></head><body>
+<h2>Index of /data/images/raw/</h2>
+<div class="list"><table summary="Directory Listing" cellpadding="0" cellspacing="0">
+<thead><tr><th class="n">Name</th><th class="m">Last Modified</th><th class="s">Size</th><th class="t">Type</th></tr></thead>
+<tbody>
+<tr class="d"><td class="n"><a href="../">..</a>/</td><td class="m">&nbsp;</td><td class="s">- &nbsp;</td><td class="t">Directory</td></tr>
+<tr><td class="n"><a href="d.raw">d.raw</a></td><td class="m">2024-Jan-31 10:15:00</td><td class="s">3.0M</td><td class="t">application/octet-stream</td></tr>
+</tbody></table></div>
+<div class="foot">lighttpd/1.4.73</div>
+</body></html>`,
+
+	"/data/logs/": `<html><body><pre><a href="../">../</a>
+<a href="today.log">today.log</a>    31-Jan-2024 10:15    12
+<a href="loop/">loop/</a>            31-Jan-2024 10:15    -
+</pre></body></html>`,
+}
+
+func newServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if page, ok := listings[r.URL.Path]; ok {
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			_, _ = w.Write([]byte(page))
+			return
+		}
+		if r.URL.Path == "/data/logs/loop/" {
+			// Symlink back up the tree
+			http.Redirect(w, r, "/data/logs/", http.StatusFound)
+			return
+		}
+		if strings.HasSuffix(r.URL.Path, "/") {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Length", "100")
+		w.Header().Set("Content-Type", "application/octet-stream")
+	})
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	return server
+}
+
+func paths(files []File) []string {
+	var out []string
+	for _, f := range files {
+		out = append(out, f.Path)
+	}
+	sort.Strings(out)
+	return out
+}
+
+func TestCrawl(t *testing.T) {
+	server := newServer(t)
+
+	files, err := Crawl(context.Background(), server.URL+"/data", Options{})
+	if err != nil {
+		t.Fatalf("Crawl failed: %v", err)
+	}
+	want := []string{
+		"README.txt",
+		"images/a.png",
+		"images/b.jpg",
+		"images/raw/d.raw",
+		"logs/today.log",
+		"set 1.tar.gz",
+	}
+	// logs/loop/ redirects back to logs/ and must not be listed twice
+	if got := paths(files); !reflect.DeepEqual(got, want) {
+		t.Errorf("paths = %v, want %v", got, want)
+	}
+
+	sizes := make(map[string]File)
+	for _, f := range files {
+		sizes[f.Path] = f
+	}
+	if f := sizes["README.txt"]; f.Size != 1536 || f.URL != server.URL+"/data/README.txt" {
+		t.Errorf("README.txt = %+v", f)
+	}
+	if f := sizes["set 1.tar.gz"]; f.Size != 2<<20 || f.URL != server.URL+"/data/set%201.tar.gz" {
+		t.Errorf("set 1.tar.gz = %+v", f)
+	}
+	if f := sizes["images/b.jpg"]; f.Size != 500000 {
+		t.Errorf("nginx size = %d, want 500000", f.Size)
+	}
+	if f := sizes["images/raw/d.raw"]; f.Size != 3<<20 {
+		t.Errorf("lighttpd size = %d, want %d", f.Size, 3<<20)
+	}
+}
+
+func TestCrawlFilters(t *testing.T) {
+	server := newServer(t)
+
+	tests := []struct {
+		name string
+		opts Options
+		want []string
+	}{
+		{"depth", Options{MaxDepth: 1, Exclude: []string{"logs"}}, []string{"README.txt", "images/a.png", "images/b.jpg", "set 1.tar.gz"}},
+		{"include", Options{Include: []string{"*.png", "*.raw"}, Exclude: []string{"logs"}}, []string{"images/a.png", "images/raw/d.raw"}},
+		{"include path", Options{Include: []string{"images/*"}}, []string{"images/a.png", "images/b.jpg"}},
+		{"exclude folder", Options{Exclude: []string{"images", "logs"}}, []string{"README.txt", "set 1.tar.gz"}},
+		{"min size", Options{MinSize: 100 << 10, Exclude: []string{"logs"}}, []string{"images/b.jpg", "images/raw/d.raw", "set 1.tar.gz"}},
+		{"max size", Options{MaxSize: 4096, Exclude: []string{"logs"}}, []string{"README.txt", "images/a.png"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			files, err := Crawl(context.Background(), server.URL+"/data/", tt.opts)
+			if err != nil {
+				t.Fatalf("Crawl failed: %v", err)
+			}
+			if got := paths(files); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("paths = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCrawlErrors(t *testing.T) {
+	server := newServer(t)
+
+	if _, err := Crawl(context.Background(), server.URL+"/missing/", Options{}); err == nil {
+		t.Error("expected an error for a missing folder")
+	}
+	if _, err := Crawl(context.Background(), server.URL+"/data/README.txt", Options{}); err == nil {
+		t.Error("expected an error for a file")
+	}
+	if _, err := Crawl(context.Background(), "ftp://example.com/", Options{}); err == nil {
+		t.Error("expected an error for a non-http url")
+	}
+
+	files, err := Crawl(context.Background(), server.URL+"/data/", Options{MaxFiles: 2})
+	if !errors.Is(err, ErrTooManyFiles) {
+		t.Errorf("err = %v, want ErrTooManyFiles", err)
+	}
+	if len(files) != 2 {
+		t.Errorf("got %d files, want the first 2", len(files))
+	}
+}
+
+func TestParseSize(t *testing.T) {
+	tests := map[string]int64{
+		"12345": 12345,
+		"1.5K":  1536,
+		"2M":    2 << 20,
+		"1G":    1 << 30,
+		"4GB":   4 << 30,
+		"3KiB":  3072,
+	}
+	for in, want := range tests {
+		if got, err := ParseSize(in); err != nil || got != want {
+			t.Errorf("ParseSize(%q) = %d, %v; want %d", in, got, err, want)
+		}
+	}
+	for _, in := range []string{"", "-", "Inf", "abc", "Directory"} {
+		if _, err := ParseSize(in); err == nil {
+			t.Errorf("ParseSize(%q) should fail", in)
+		}
+	}
+}
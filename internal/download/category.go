@@ -0,0 +1,71 @@
+package download
+
+import (
+	"net/url"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/engine"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// categorize returns the category name of a fresh download and its rules.
+// A category named in the config wins; an unknown name only labels the
+// download. Otherwise the first category matching the file is used.
+func categorize(cfg *types.DownloadConfig, probe *engine.ProbeResult) (string, *config.Category) {
+	var categories []config.Category
+	if cfg.Runtime != nil {
+		categories = cfg.Runtime.Categories
+	}
+
+	if cfg.Category != "" {
+		if cat := config.FindCategory(categories, cfg.Category); cat != nil {
+			return cat.Name, cat
+		}
+		return cfg.Category, nil
+	}
+
+	filename := cfg.Filename
+	if filename == "" {
+		filename = probe.Filename
+	}
+	var host string
+	if u, err := url.Parse(cfg.URL); err == nil {
+		host = u.Hostname()
+	}
+	if cat := config.MatchCategory(categories, filename, probe.ContentType, host); cat != nil {
+		return cat.Name, cat
+	}
+	return "", nil
+}
+
+// lookupCategory returns the rules of a category recorded on a paused download, or nil
+func lookupCategory(cfg *types.DownloadConfig, name string) *config.Category {
+	if name == "" || cfg.Runtime == nil {
+		return nil
+	}
+	return config.FindCategory(cfg.Runtime.Categories, name)
+}
+
+// categoryOutputPath moves a download headed for the default download directory
+// into its category's directory. Downloads given an explicit directory, or
+// asked to keep theirs, stay put.
+func categoryOutputPath(cfg *types.DownloadConfig, cat *config.Category) string {
+	if cat == nil || cat.Dir == "" || cfg.Runtime == nil || cfg.KeepDir {
+		return cfg.OutputPath
+	}
+	if utils.EnsureAbsPath(cfg.OutputPath) != utils.EnsureAbsPath(utils.ExpandHome(cfg.Runtime.DefaultDownloadDir)) {
+		return cfg.OutputPath
+	}
+	return utils.EnsureAbsPath(utils.ExpandHome(cat.Dir))
+}
+
+// categoryRuntime applies the category's connection limit to a copy of rt
+func categoryRuntime(rt *types.RuntimeConfig, cat *config.Category) *types.RuntimeConfig {
+	if rt == nil || cat == nil || cat.MaxConnections <= 0 {
+		return rt
+	}
+	capped := *rt
+	capped.MaxConnectionsPerHost = cat.MaxConnections
+	return &capped
+}
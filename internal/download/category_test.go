@@ -0,0 +1,114 @@
+package download_test
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/testutil"
+)
+
+// runCategoryDownload downloads a small file served as contentType into
+// outputPath, with defaultDir as the default download directory
+func runCategoryDownload(t *testing.T, outputPath, defaultDir, contentType, category string, categories []config.Category, keepDir bool) (*types.DownloadConfig, events.DownloadStartedMsg) {
+	t.Helper()
+	fileSize := int64(64 * types.KB)
+	server := testutil.NewMockServerT(t,
+		testutil.WithFileSize(fileSize),
+		testutil.WithRangeSupport(true),
+		testutil.WithContentType(contentType),
+	)
+	t.Cleanup(server.Close)
+
+	id := "category-" + t.Name()
+	progressCh := make(chan any, 100)
+	cfg := &types.DownloadConfig{
+		URL:        server.URL(),
+		OutputPath: outputPath,
+		Filename:   "clip",
+		ID:         id,
+		ProgressCh: progressCh,
+		State:      types.NewProgressState(id, fileSize),
+		Category:   category,
+		KeepDir:    keepDir,
+		Runtime: &types.RuntimeConfig{
+			MaxConnectionsPerHost: 4,
+			DefaultDownloadDir:    defaultDir,
+			Categories:            categories,
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := download.TUIDownload(ctx, cfg); err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+
+	for {
+		select {
+		case msg := <-progressCh:
+			if started, ok := msg.(events.DownloadStartedMsg); ok {
+				return cfg, started
+			}
+		default:
+			t.Fatal("no DownloadStartedMsg sent")
+		}
+	}
+}
+
+func TestTUIDownload_CategoryRouting(t *testing.T) {
+	tmpDir := setupChecksumTest(t)
+	defaultDir := filepath.Join(tmpDir, "downloads")
+	videoDir := filepath.Join(tmpDir, "videos")
+	categories := []config.Category{
+		{Name: "Video", Dir: videoDir, MaxConnections: 2, MimeTypes: "video/*"},
+		{Name: "Music", MimeTypes: "audio/*"},
+	}
+
+	// Downloads for the default directory move to the category's directory
+	cfg, started := runCategoryDownload(t, defaultDir, defaultDir, "video/mp4", "", categories, false)
+	if want := filepath.Join(videoDir, "clip"); started.DestPath != want {
+		t.Errorf("DestPath = %s, want %s", started.DestPath, want)
+	}
+	if !testutil.FileExists(filepath.Join(videoDir, "clip")) {
+		t.Error("file not saved in the category directory")
+	}
+	if started.Category != "Video" || cfg.State.GetCategory() != "Video" {
+		t.Errorf("category = %q / %q, want Video", started.Category, cfg.State.GetCategory())
+	}
+	entry, err := state.GetDownload(cfg.ID)
+	if err != nil || entry == nil || entry.Category != "Video" {
+		t.Errorf("saved entry = %+v (%v), want category Video", entry, err)
+	}
+
+	// A download given its own directory stays there but is still labelled
+	otherDir := filepath.Join(tmpDir, "elsewhere")
+	_, started = runCategoryDownload(t, otherDir, defaultDir, "video/mp4", "", categories, false)
+	if want := filepath.Join(otherDir, "clip"); started.DestPath != want || started.Category != "Video" {
+		t.Errorf("explicit dir: DestPath = %s, category = %q, want %s and Video", started.DestPath, started.Category, want)
+	}
+
+	// A category chosen by the user wins over matching
+	_, started = runCategoryDownload(t, otherDir, defaultDir, "video/mp4", "music", categories, false)
+	if started.Category != "Music" {
+		t.Errorf("chosen category = %q, want Music", started.Category)
+	}
+
+	// Nothing matches
+	_, started = runCategoryDownload(t, defaultDir, defaultDir, "application/octet-stream", "", categories, false)
+	if want := filepath.Join(defaultDir, "clip"); started.DestPath != want || started.Category != "" {
+		t.Errorf("no match: DestPath = %s, category = %q, want %s and none", started.DestPath, started.Category, want)
+	}
+
+	// A download asked to keep its directory stays in the default one
+	_, started = runCategoryDownload(t, defaultDir, defaultDir, "video/mp4", "", categories, true)
+	if filepath.Dir(started.DestPath) != defaultDir || started.Category != "Video" {
+		t.Errorf("kept dir: DestPath = %s, category = %q, want it in %s and Video", started.DestPath, started.Category, defaultDir)
+	}
+}
@@ -0,0 +1,99 @@
+package download_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/testutil"
+)
+
+func setupChecksumTest(t *testing.T) string {
+	t.Helper()
+	tmpDir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	if _, err := state.GetDB(); err != nil {
+		t.Fatalf("Failed to init DB: %v", err)
+	}
+	t.Cleanup(state.CloseDB)
+	return tmpDir
+}
+
+func runChecksumDownload(t *testing.T, tmpDir string, rangeSupport bool, expected string) (string, error) {
+	t.Helper()
+	fileSize := int64(256 * types.KB)
+	server := testutil.NewMockServerT(t,
+		testutil.WithFileSize(fileSize),
+		testutil.WithRangeSupport(rangeSupport),
+	)
+	t.Cleanup(server.Close)
+
+	id := "checksum-" + t.Name()
+	cfg := types.DownloadConfig{
+		URL:        server.URL(),
+		OutputPath: tmpDir,
+		Filename:   "data.bin",
+		ID:         id,
+		ProgressCh: make(chan any, 100),
+		State:      types.NewProgressState(id, fileSize),
+		Runtime:    &types.RuntimeConfig{MaxConnectionsPerHost: 4},
+		Checksum:   expected,
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return filepath.Join(tmpDir, "data.bin"), download.TUIDownload(ctx, &cfg)
+}
+
+func zeroDigest(size int) string {
+	sum := sha256.Sum256(make([]byte, size))
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func TestTUIDownload_ChecksumMatch(t *testing.T) {
+	for _, rangeSupport := range []bool{true, false} {
+		tmpDir := setupChecksumTest(t)
+		destPath, err := runChecksumDownload(t, tmpDir, rangeSupport, zeroDigest(256*types.KB))
+		if err != nil {
+			t.Fatalf("range=%v: download failed: %v", rangeSupport, err)
+		}
+		if !testutil.FileExists(destPath) {
+			t.Errorf("range=%v: expected final file at %s", rangeSupport, destPath)
+		}
+	}
+}
+
+func TestTUIDownload_ChecksumMismatch(t *testing.T) {
+	for _, rangeSupport := range []bool{true, false} {
+		tmpDir := setupChecksumTest(t)
+		expected := "sha256:" + strings.Repeat("0", 64)
+		destPath, err := runChecksumDownload(t, tmpDir, rangeSupport, expected)
+		if !errors.Is(err, types.ErrChecksumMismatch) {
+			t.Fatalf("range=%v: expected ErrChecksumMismatch, got %v", rangeSupport, err)
+		}
+		if _, statErr := os.Stat(destPath); !os.IsNotExist(statErr) {
+			t.Errorf("range=%v: final file must not exist after a mismatch", rangeSupport)
+		}
+
+		entry, getErr := state.GetDownload("checksum-" + t.Name())
+		if getErr != nil || entry == nil {
+			t.Fatalf("range=%v: expected persisted entry, got %v (%v)", rangeSupport, entry, getErr)
+		}
+		if entry.Status != "error" {
+			t.Errorf("range=%v: status = %q, want error", rangeSupport, entry.Status)
+		}
+		if entry.Checksum != expected {
+			t.Errorf("range=%v: recorded checksum = %q, want %q", rangeSupport, entry.Checksum, expected)
+		}
+	}
+}
@@ -4,17 +4,22 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 
+	"github.com/surge-downloader/surge/internal/config"
 	"github.com/surge-downloader/surge/internal/engine"
 	"github.com/surge-downloader/surge/internal/engine/concurrent"
 	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/ftp"
+	"github.com/surge-downloader/surge/internal/engine/sftp"
 	"github.com/surge-downloader/surge/internal/engine/single"
 	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/stream"
 	"github.com/surge-downloader/surge/internal/engine/types"
 	"github.com/surge-downloader/surge/internal/utils"
 )
@@ -82,38 +87,37 @@ func uniqueFilePath(path string) string {
 func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 	// Probe server once to get all metadata
 	utils.Debug("TUIDownload: Probing server... %s", cfg.URL)
-	probe, err := engine.ProbeServer(ctx, cfg.URL, cfg.Filename, cfg.Headers)
+	var (
+		probe     *engine.ProbeResult
+		sshSource *sftp.Source
+		err       error
+	)
+	if sftp.IsSFTP(cfg.URL) {
+		// The connection made for the probe is kept for the download
+		if sshSource, err = sftp.Open(ctx, cfg.URL, cfg.Runtime); err == nil {
+			defer func() { _ = sshSource.Close() }()
+			probe, err = engine.ProbeSFTP(sshSource, cfg.Filename)
+		}
+	} else {
+		probe, err = engine.ProbeServer(ctx, cfg.URL, cfg.Filename, cfg.Headers)
+	}
 	if err != nil {
 		utils.Debug("TUIDownload: Probe failed: %v\n", err)
 		return err
 	}
 	utils.Debug("TUIDownload: Probe success %d", probe.FileSize)
 
+	// A known size (e.g. from a Metalink) that disagrees with the server means the wrong file
+	if cfg.ExpectedSize > 0 && probe.FileSize > 0 && cfg.ExpectedSize != probe.FileSize {
+		return fmt.Errorf("size mismatch: expected %d bytes, server reports %d", cfg.ExpectedSize, probe.FileSize)
+	}
+
 	// Start download timer (exclude probing time)
 	start := time.Now()
 	defer func() {
 		utils.Debug("Download %s completed in %v", cfg.URL, time.Since(start))
 	}()
 
-	// Construct proper output path
-	destPath := cfg.OutputPath
-
-	// Auto-create output directory if it doesn't exist
-	if _, err := os.Stat(cfg.OutputPath); os.IsNotExist(err) {
-		if mkErr := os.MkdirAll(cfg.OutputPath, 0o755); mkErr != nil {
-			utils.Debug("Failed to create output directory: %v", mkErr)
-		}
-	}
-
-	if info, err := os.Stat(cfg.OutputPath); err == nil && info.IsDir() {
-		// Use cfg.Filename if TUI provided one, otherwise use probe.Filename
-		filename := probe.Filename
-		if cfg.Filename != "" {
-			filename = cfg.Filename
-		}
-		destPath = filepath.Join(cfg.OutputPath, filename)
-	}
-
 	// Local mirrors slice to avoid modifying config (race condition)
 	mirrors := make([]string, len(cfg.Mirrors))
 	copy(mirrors, cfg.Mirrors)
@@ -149,10 +153,92 @@ func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 	}
 	isResume := cfg.IsResume && savedState != nil && savedState.DestPath != ""
 
+	// Partial data from another version of the file would splice two versions together
+	remoteChanged := isResume && savedState.Changed(probe.Validators)
+	if remoteChanged {
+		utils.Debug("TUIDownload: %v since pause (was %q, now %q), restarting %s",
+			types.ErrRemoteChanged, savedState.IfRange(), probe.Validators.IfRange(), cfg.ID)
+		discardPartial(cfg, savedState)
+	}
+
+	// An HLS playlist or DASH manifest is downloaded as the stream it describes,
+	// in the rendition chosen when it was added
+	var (
+		media   *stream.Media
+		variant = cfg.Variant
+	)
+	if sshSource == nil && !ftp.IsFTP(cfg.URL) && stream.IsStream(cfg.URL, probe.ContentType) {
+		if variant == "" && savedState != nil {
+			variant = savedState.Variant
+		}
+		if media, err = stream.Load(ctx, cfg.URL, cfg.Headers, cfg.Runtime.GetUserAgent(), variant); err != nil {
+			utils.Debug("TUIDownload: Stream manifest failed: %v", err)
+			return err
+		}
+		probe.Filename = stream.Filename(probe.Filename, media.Ext)
+		probe.ContentType = media.ContentType
+		probe.FileSize = media.EstimatedSize()
+		probe.Checksum = "" // Describes the manifest, not the joined file
+	}
+
+	// Expected digest: explicit config wins, then whatever was recorded at pause time,
+	// then a whole-file digest advertised by the server
+	expectedChecksum := cfg.Checksum
+	if expectedChecksum == "" && savedState != nil && !remoteChanged {
+		expectedChecksum = savedState.Checksum
+	}
+	if expectedChecksum == "" {
+		expectedChecksum = probe.Checksum
+	}
+	pieces := cfg.Pieces
+	if pieces == nil && savedState != nil && !remoteChanged {
+		pieces = savedState.Pieces
+	}
+
+	// Fresh downloads are sorted into a category; resumes keep the one saved at pause
+	var (
+		categoryName string
+		category     *config.Category
+	)
+	outputPath := cfg.OutputPath
+	if isResume {
+		categoryName = savedState.Category
+		category = lookupCategory(cfg, categoryName)
+	} else {
+		categoryName, category = categorize(cfg, probe)
+		outputPath = categoryOutputPath(cfg, category)
+	}
+	runtime := categoryRuntime(cfg.Runtime, category)
+
+	// Construct proper output path
+	destPath := outputPath
+
+	// Auto-create output directory if it doesn't exist
+	if _, err := os.Stat(outputPath); os.IsNotExist(err) {
+		if mkErr := os.MkdirAll(outputPath, 0o755); mkErr != nil {
+			utils.Debug("Failed to create output directory: %v", mkErr)
+		}
+	}
+
+	if info, err := os.Stat(outputPath); err == nil && info.IsDir() {
+		// Use cfg.Filename if TUI provided one, otherwise use probe.Filename
+		filename := probe.Filename
+		if cfg.Filename != "" {
+			filename = cfg.Filename
+		}
+		if media != nil {
+			filename = stream.Filename(filename, media.Ext)
+		}
+		destPath = filepath.Join(outputPath, filename)
+	}
+
 	if isResume {
 		// Resume: use saved destination path directly (don't generate new unique name)
 		destPath = savedState.DestPath
 		utils.Debug("Resuming download, using saved destPath: %s", destPath)
+	} else if cfg.Overwrite {
+		// Stale partial data from an earlier attempt must not be resumed into the new file
+		_ = os.Remove(destPath + types.IncompleteSuffix)
 	} else {
 		// Fresh download without TUI-provided filename: generate unique filename if file already exists
 		destPath = uniqueFilePath(destPath)
@@ -167,6 +253,7 @@ func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 	if cfg.State != nil {
 		cfg.State.SetFilename(finalFilename)
 		cfg.State.SetDestPath(destPath)
+		cfg.State.SetCategory(categoryName)
 	}
 
 	// Send download started message
@@ -177,6 +264,7 @@ func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 			Filename:   finalFilename,
 			Total:      probe.FileSize,
 			DestPath:   destPath,
+			Category:   categoryName,
 			State:      cfg.State,
 		}
 	}
@@ -186,9 +274,51 @@ func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 		cfg.State.SetTotalSize(probe.FileSize)
 	}
 
+	// FTP ranges and streams are read over logins the source keeps between them
+	var ftpSource *ftp.Source
+	if ftp.IsFTP(cfg.URL) {
+		if ftpSource, err = ftp.NewSource(cfg.URL); err != nil {
+			return err
+		}
+		defer func() { _ = ftpSource.Close() }()
+	}
+
 	// Choose downloader based on probe results
 	var downloadErr error
-	if probe.SupportsRange && probe.FileSize > 0 {
+	if media != nil {
+		utils.Debug("Using stream downloader for %s", media.Variant)
+		d := stream.NewDownloader(cfg.ID, cfg.ProgressCh, cfg.State, runtime)
+		d.Headers = cfg.Headers // Forward custom headers from browser extension
+		d.Checksum = expectedChecksum
+		d.Category = categoryName
+		d.Limiter = cfg.Limiter
+		d.Validators = probe.Validators
+		d.Variant = variant
+		downloadErr = d.Download(ctx, cfg.URL, media, destPath)
+		if info, err := os.Stat(destPath); downloadErr == nil && err == nil {
+			probe.FileSize = info.Size() // The estimate gives way to what was joined
+		}
+	} else if ftpSource != nil && probe.SupportsRange && probe.FileSize > 0 {
+		utils.Debug("Using concurrent downloader over FTP")
+		d := concurrent.NewConcurrentDownloader(cfg.ID, cfg.ProgressCh, cfg.State, ftp.CapConnections(runtime))
+		d.Source = ftpSource
+		d.Checksum = expectedChecksum
+		d.Pieces = pieces
+		d.Category = categoryName
+		d.Limiter = cfg.Limiter
+		d.Validators = probe.Validators
+		downloadErr = d.Download(ctx, cfg.URL, nil, nil, destPath, probe.FileSize)
+	} else if sshSource != nil {
+		utils.Debug("Using concurrent downloader over SFTP")
+		d := concurrent.NewConcurrentDownloader(cfg.ID, cfg.ProgressCh, cfg.State, sftp.CapConnections(runtime))
+		d.Source = sshSource
+		d.Checksum = expectedChecksum
+		d.Pieces = pieces
+		d.Category = categoryName
+		d.Limiter = cfg.Limiter
+		d.Validators = probe.Validators
+		downloadErr = d.Download(ctx, cfg.URL, nil, nil, destPath, probe.FileSize)
+	} else if probe.SupportsRange && probe.FileSize > 0 {
 		utils.Debug("Using concurrent downloader")
 
 		// We probe all candidate mirrors (mirrors) to filter out invalid ones
@@ -213,15 +343,29 @@ func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 			utils.Debug("Found %d active mirrors from %d candidates", len(activeMirrors), len(mirrors))
 		}
 
-		d := concurrent.NewConcurrentDownloader(cfg.ID, cfg.ProgressCh, cfg.State, cfg.Runtime)
+		d := concurrent.NewConcurrentDownloader(cfg.ID, cfg.ProgressCh, cfg.State, runtime)
 		d.Headers = cfg.Headers // Forward custom headers from browser extension
+		d.Checksum = expectedChecksum
+		d.Pieces = pieces
+		d.Category = categoryName
+		d.Limiter = cfg.Limiter
+		d.Validators = probe.Validators
 		utils.Debug("Calling Download with mirrors: %v", mirrors)
 		downloadErr = d.Download(ctx, cfg.URL, mirrors, activeMirrors, destPath, probe.FileSize)
 	} else {
 		// Fallback to single-threaded downloader
 		utils.Debug("Using single-threaded downloader")
-		d := single.NewSingleDownloader(cfg.ID, cfg.ProgressCh, cfg.State, cfg.Runtime)
+		d := single.NewSingleDownloader(cfg.ID, cfg.ProgressCh, cfg.State, runtime)
+		if ftpSource != nil {
+			d.Client = &http.Client{Transport: ftpSource} // Streams the file over FTP without REST
+		}
 		d.Headers = cfg.Headers // Forward custom headers from browser extension
+		d.Checksum = expectedChecksum
+		d.Pieces = pieces
+		d.Category = categoryName
+		d.Limiter = cfg.Limiter
+		d.SupportsRange = probe.SupportsRange // Unknown size but resumable
+		d.Validators = probe.Validators
 		downloadErr = d.Download(ctx, cfg.URL, destPath, probe.FileSize, probe.Filename)
 	}
 
@@ -261,6 +405,8 @@ func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 			CompletedAt: time.Now().Unix(),
 			TimeTaken:   elapsed.Milliseconds(),
 			AvgSpeed:    avgSpeed,
+			Checksum:    expectedChecksum,
+			Category:    categoryName,
 		}); err != nil {
 			utils.Debug("Failed to persist completed download: %v", err)
 		}
@@ -281,6 +427,17 @@ func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 			return nil
 		}
 
+		// The file changed mid-download; what we have can't be resumed
+		if errors.Is(downloadErr, types.ErrRemoteChanged) {
+			_ = state.DeleteState(cfg.ID, cfg.URL, destPath)
+			_ = os.Remove(destPath + types.IncompleteSuffix)
+		}
+
+		var downloaded int64
+		if cfg.State != nil {
+			downloaded = cfg.State.Downloaded.Load()
+		}
+
 		// Persist error state
 		if err := state.AddToMasterList(types.DownloadEntry{
 			ID:         cfg.ID,
@@ -290,7 +447,9 @@ func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 			Filename:   finalFilename,
 			Status:     "error",
 			TotalSize:  probe.FileSize,
-			Downloaded: cfg.State.Downloaded.Load(),
+			Downloaded: downloaded,
+			Checksum:   expectedChecksum,
+			Category:   categoryName,
 		}); err != nil {
 			utils.Debug("Failed to persist error state: %v", err)
 		}
@@ -299,6 +458,20 @@ func TUIDownload(ctx context.Context, cfg *types.DownloadConfig) error {
 	return downloadErr
 }
 
+// discardPartial drops saved progress and partial data so the download starts over
+func discardPartial(cfg *types.DownloadConfig, saved *types.DownloadState) {
+	_ = state.DeleteState(saved.ID, saved.URL, saved.DestPath)
+	if err := os.Remove(saved.DestPath + types.IncompleteSuffix); err != nil && !os.IsNotExist(err) {
+		utils.Debug("Failed to remove partial file: %v", err)
+	}
+	if cfg.State != nil {
+		cfg.State.Downloaded.Store(0)
+		cfg.State.VerifiedProgress.Store(0)
+		cfg.State.SetSavedElapsed(0)
+		cfg.State.SyncSessionStart()
+	}
+}
+
 // Download is the CLI entry point (non-TUI) - convenience wrapper
 func Download(ctx context.Context, url string, outPath string, progressCh chan<- any, id string) error {
 	cfg := types.DownloadConfig{
@@ -2,6 +2,9 @@ package download
 
 import (
 	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"net/http"
 	"os"
@@ -348,6 +351,56 @@ func TestProbeServer_ContentType(t *testing.T) {
 	}
 }
 
+func TestProbeServer_ReprDigest(t *testing.T) {
+	data := make([]byte, 1024)
+	sum := sha256.Sum256(data)
+
+	server := testutil.NewHTTPServerT(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Repr-Digest", "sha-256=:"+base64.StdEncoding.EncodeToString(sum[:])+":")
+		w.Header().Set("Content-Range", "bytes 0-0/1024")
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write(data[:1])
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := engine.ProbeServer(ctx, server.URL, "", nil)
+	if err != nil {
+		t.Fatalf("probeServer failed: %v", err)
+	}
+
+	want := "sha256:" + hex.EncodeToString(sum[:])
+	if result.Checksum != want {
+		t.Errorf("Expected Checksum %q, got %q", want, result.Checksum)
+	}
+}
+
+func TestProbeServer_Validators(t *testing.T) {
+	server := testutil.NewHTTPServerT(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v42"`)
+		w.Header().Set("Last-Modified", "Wed, 21 Oct 2015 07:28:00 GMT")
+		w.Header().Set("Content-Range", "bytes 0-0/1024")
+		w.WriteHeader(http.StatusPartialContent)
+		_, _ = w.Write([]byte{0})
+	}))
+	defer server.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	result, err := engine.ProbeServer(ctx, server.URL, "", nil)
+	if err != nil {
+		t.Fatalf("probeServer failed: %v", err)
+	}
+
+	want := types.Validators{ETag: `"v42"`, LastModified: "Wed, 21 Oct 2015 07:28:00 GMT"}
+	if result.Validators != want {
+		t.Errorf("Expected validators %+v, got %+v", want, result.Validators)
+	}
+}
+
 func TestProbeServer_InvalidURL(t *testing.T) {
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 	defer cancel()
@@ -3,10 +3,12 @@ package download
 import (
 	"context"
 	"os"
+	"slices"
 	"sync"
 	"time"
 
 	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/ratelimit"
 	"github.com/surge-downloader/surge/internal/engine/state"
 	"github.com/surge-downloader/surge/internal/engine/types"
 	"github.com/surge-downloader/surge/internal/utils"
@@ -15,17 +17,22 @@ import (
 // activeDownload tracks a download that's currently running
 type activeDownload struct {
 	config types.DownloadConfig
+	ctx    context.Context
 	cancel context.CancelFunc
 }
 
 type WorkerPool struct {
-	taskChan     chan types.DownloadConfig
+	queue        []types.DownloadConfig // Downloads waiting for a worker, highest priority first
+	wake         chan struct{}          // Signals an idle worker that the queue has work
+	closed       bool                   // Set on shutdown so queued downloads aren't started
+	held         bool                   // Set during a scheduled pause window so queued downloads wait
 	progressCh   chan<- any
-	downloads    map[string]*activeDownload      // Track active downloads for pause/resume
-	queued       map[string]types.DownloadConfig // Track queued downloads
+	downloads    map[string]*activeDownload // Track active downloads for pause/resume
 	mu           sync.RWMutex
+	persistMu    sync.Mutex     // Serializes queue writes to the state DB
 	wg           sync.WaitGroup // We use this to wait for all active downloads to pause before exiting the program
 	maxDownloads int
+	workers      int // Worker goroutines alive; above maxDownloads while extra workers retire
 }
 
 func NewWorkerPool(progressCh chan<- any, maxDownloads int) *WorkerPool {
@@ -33,23 +40,70 @@ func NewWorkerPool(progressCh chan<- any, maxDownloads int) *WorkerPool {
 		maxDownloads = 3 // Default to 3 if invalid
 	}
 	pool := &WorkerPool{
-		taskChan:     make(chan types.DownloadConfig, 100), // We make it buffered to avoid blocking add
-		progressCh:   progressCh,
-		downloads:    make(map[string]*activeDownload),
-		queued:       make(map[string]types.DownloadConfig),
-		maxDownloads: maxDownloads,
-	}
-	for i := 0; i < maxDownloads; i++ {
-		go pool.worker()
+		wake:       make(chan struct{}, 1),
+		progressCh: progressCh,
+		downloads:  make(map[string]*activeDownload),
 	}
+	pool.SetMaxDownloads(maxDownloads)
 	return pool
 }
 
-// Add adds a new download task to the pool
+// SetMaxDownloads changes how many downloads run at once. Growing starts
+// queued downloads right away; shrinking lets running downloads finish and
+// retires their workers as they become free.
+func (p *WorkerPool) SetMaxDownloads(n int) {
+	if n < 1 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.maxDownloads = n
+	for p.workers < n {
+		p.workers++
+		go p.worker()
+	}
+	if p.workers > n {
+		p.signal() // Wake an idle worker to retire
+	}
+}
+
+// Hold keeps queued downloads from starting while on is true, as during a
+// scheduled pause window. Releasing it starts them again.
+func (p *WorkerPool) Hold(on bool) {
+	p.mu.Lock()
+	changed := p.held != on
+	p.held = on
+	p.mu.Unlock()
+	if changed && !on {
+		p.signal()
+	}
+}
+
+// MaxDownloads returns how many downloads run at once
+func (p *WorkerPool) MaxDownloads() int {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return p.maxDownloads
+}
+
+// Add adds a new download task to the pool. It is queued after every download
+// of the same or higher priority. Adding a download that is already queued
+// replaces it in place.
 func (p *WorkerPool) Add(cfg types.DownloadConfig) {
+	// Every download gets a limiter so its cap can be changed while it runs
+	if cfg.Limiter == nil {
+		cfg.Limiter = ratelimit.New(0)
+	}
+
 	p.mu.Lock()
-	p.queued[cfg.ID] = cfg
+	if i := p.queueIndex(cfg.ID); i >= 0 {
+		p.queue[i] = cfg
+	} else {
+		p.insert(cfg)
+	}
 	p.mu.Unlock()
+	p.persistQueue()
 
 	if p.progressCh != nil && !cfg.IsResume {
 		p.progressCh <- events.DownloadQueuedMsg{
@@ -58,7 +112,130 @@ func (p *WorkerPool) Add(cfg types.DownloadConfig) {
 		}
 	}
 
-	p.taskChan <- cfg
+	p.signal()
+}
+
+// insert places cfg after the last queued download with the same or higher priority.
+// Caller must hold p.mu.
+func (p *WorkerPool) insert(cfg types.DownloadConfig) {
+	i := len(p.queue)
+	for i > 0 && p.queue[i-1].Priority < cfg.Priority {
+		i--
+	}
+	p.queue = slices.Insert(p.queue, i, cfg)
+}
+
+// queueIndex returns the position of a queued download, or -1.
+// Caller must hold p.mu.
+func (p *WorkerPool) queueIndex(downloadID string) int {
+	return slices.IndexFunc(p.queue, func(cfg types.DownloadConfig) bool {
+		return cfg.ID == downloadID
+	})
+}
+
+// signal wakes an idle worker without blocking
+func (p *WorkerPool) signal() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Move reorders a queued download. The queue stays sorted by priority, so a
+// download moved past others takes on their priority. Returns false if the
+// download is not queued.
+func (p *WorkerPool) Move(downloadID string, move types.QueueMove) bool {
+	p.mu.Lock()
+	i := p.queueIndex(downloadID)
+	if i < 0 {
+		p.mu.Unlock()
+		return false
+	}
+
+	cfg := p.queue[i]
+	last := len(p.queue) - 1
+	target := i
+	switch move {
+	case types.MoveTop:
+		target = 0
+	case types.MoveBottom:
+		target = last
+	case types.MoveUp:
+		target = max(i-1, 0)
+	case types.MoveDown:
+		target = min(i+1, last)
+	}
+	if target < i {
+		cfg.Priority = max(cfg.Priority, p.queue[target].Priority)
+	} else if target > i {
+		cfg.Priority = min(cfg.Priority, p.queue[target].Priority)
+	}
+
+	p.queue = slices.Delete(p.queue, i, i+1)
+	p.queue = slices.Insert(p.queue, target, cfg)
+	p.mu.Unlock()
+
+	p.persistQueue()
+	return true
+}
+
+// SetPriority changes the priority of a download. A queued download moves
+// behind the others of its new priority; a running or paused one keeps the
+// priority for when it is queued again. Returns false if the download is not in the pool.
+func (p *WorkerPool) SetPriority(downloadID string, priority int) bool {
+	p.mu.Lock()
+	if i := p.queueIndex(downloadID); i >= 0 {
+		cfg := p.queue[i]
+		cfg.Priority = priority
+		p.queue = slices.Delete(p.queue, i, i+1)
+		p.insert(cfg)
+		p.mu.Unlock()
+		p.persistQueue()
+		return true
+	}
+	ad, ok := p.downloads[downloadID]
+	if ok {
+		ad.config.Priority = priority
+	}
+	p.mu.Unlock()
+	return ok
+}
+
+// Queued returns the downloads waiting to start, first to start first
+func (p *WorkerPool) Queued() []types.DownloadConfig {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	return slices.Clone(p.queue)
+}
+
+// persistQueue saves the queue order so it survives a restart
+func (p *WorkerPool) persistQueue() {
+	p.persistMu.Lock()
+	defer p.persistMu.Unlock()
+
+	p.mu.RLock()
+	entries := make([]types.QueueEntry, len(p.queue))
+	for i, cfg := range p.queue {
+		entries[i] = types.QueueEntry{
+			ID:         cfg.ID,
+			URL:        cfg.URL,
+			OutputPath: cfg.OutputPath,
+			Filename:   cfg.Filename,
+			Mirrors:    cfg.Mirrors,
+			Checksum:   cfg.Checksum,
+			Pieces:     cfg.Pieces,
+			Size:       cfg.ExpectedSize,
+			RateLimit:  cfg.Limiter.Rate(),
+			Priority:   cfg.Priority,
+			Category:   cfg.Category,
+			Variant:    cfg.Variant,
+		}
+	}
+	p.mu.RUnlock()
+
+	if err := state.SaveQueue(entries); err != nil {
+		utils.Debug("WorkerPool: failed to save queue: %v", err)
+	}
 }
 
 // HasDownload checks if a download with the given URL already exists
@@ -96,7 +273,7 @@ func (p *WorkerPool) ActiveCount() int {
 		}
 	}
 	// Also count queued
-	count += len(p.queued)
+	count += len(p.queue)
 	return count
 }
 
@@ -125,10 +302,29 @@ func (p *WorkerPool) GetAll() []types.DownloadConfig {
 		}
 		configs = append(configs, cfg)
 	}
-	for _, cfg := range p.queued {
-		configs = append(configs, cfg)
+	return append(configs, p.queue...)
+}
+
+// SetRateLimit changes the bandwidth cap of a queued, active or paused download.
+// Returns false if the download is not in the pool.
+func (p *WorkerPool) SetRateLimit(downloadID string, bytesPerSec int64) bool {
+	p.mu.RLock()
+	if ad, ok := p.downloads[downloadID]; ok && ad.config.Limiter != nil {
+		ad.config.Limiter.SetRate(bytesPerSec)
+		p.mu.RUnlock()
+		return true
+	}
+	i := p.queueIndex(downloadID)
+	if i >= 0 {
+		p.queue[i].Limiter.SetRate(bytesPerSec)
 	}
-	return configs
+	p.mu.RUnlock()
+
+	if i < 0 {
+		return false
+	}
+	p.persistQueue()
+	return true
 }
 
 // Pause pauses a specific download by ID. Returns true if found and pause initiated (or already paused), false otherwise.
@@ -186,6 +382,23 @@ func (p *WorkerPool) PauseAll() {
 // Cancel cancels and removes a download by ID
 func (p *WorkerPool) Cancel(downloadID string) {
 	p.mu.Lock()
+	if i := p.queueIndex(downloadID); i >= 0 {
+		cfg := p.queue[i]
+		p.queue = slices.Delete(p.queue, i, i+1)
+		// A paused download that was resumed is queued but still tracked
+		// as paused until a worker picks it up
+		delete(p.downloads, downloadID)
+		p.mu.Unlock()
+		p.persistQueue()
+
+		if p.progressCh != nil {
+			p.progressCh <- events.DownloadRemovedMsg{
+				DownloadID: downloadID,
+				Filename:   cfg.Filename,
+			}
+		}
+		return
+	}
 	ad, exists := p.downloads[downloadID]
 	if exists {
 		delete(p.downloads, downloadID)
@@ -272,83 +485,127 @@ func (p *WorkerPool) Resume(downloadID string) bool {
 	return true
 }
 
-func (p *WorkerPool) worker() {
-	for cfg := range p.taskChan {
-		p.wg.Add(1)
-		// Create cancellable context
-		ctx, cancel := context.WithCancel(context.Background())
-
-		// Register active download
-		ad := &activeDownload{
-			config: cfg,
-			cancel: cancel,
-		}
-		p.mu.Lock()
-		delete(p.queued, cfg.ID)
-		p.downloads[cfg.ID] = ad
+// next takes the first queued download and registers it as active.
+// Returns nil if the queue is empty or held, the pool is shutting down or
+// the calling worker should retire.
+func (p *WorkerPool) next() *activeDownload {
+	p.mu.Lock()
+	if p.closed || p.held || len(p.queue) == 0 || p.workers > p.maxDownloads {
 		p.mu.Unlock()
+		return nil
+	}
+	cfg := p.queue[0]
+	p.queue = slices.Delete(p.queue, 0, 1)
+	if len(p.queue) > 0 {
+		p.signal() // Hand the rest to another idle worker
+	}
 
-		err := TUIDownload(ctx, &ad.config)
+	// Create cancellable context
+	ctx, cancel := context.WithCancel(context.Background())
 
-		// Logic:
-		// 1. If Pause() was called: State.IsPaused() is true. We keep the task in p.downloads (so it can be resumed).
-		// 2. If finished/error: We remove from p.downloads.
+	// Register active download
+	ad := &activeDownload{
+		config: cfg,
+		cancel: cancel,
+		ctx:    ctx,
+	}
+	p.downloads[cfg.ID] = ad
+	p.wg.Add(1)
+	p.mu.Unlock()
 
-		isPaused := ad.config.State != nil && ad.config.State.IsPaused()
+	p.persistQueue()
+	return ad
+}
 
-		// Clear "Pausing" transition state now that worker has exited
-		if ad.config.State != nil {
-			ad.config.State.SetPausing(false)
+func (p *WorkerPool) worker() {
+	for range p.wake {
+		for ad := p.next(); ad != nil; ad = p.next() {
+			p.run(ad)
+		}
+		if p.retire() {
+			return
 		}
+	}
+}
 
-		if isPaused {
-			utils.Debug("WorkerPool: Download %s paused cleanly", cfg.ID)
-			// If paused, we keep it in downloads map for potential resume
-		} else if err != nil {
-			if cfg.State != nil {
-				cfg.State.SetError(err)
-			}
-			if p.progressCh != nil {
-				p.progressCh <- events.DownloadErrorMsg{
-					DownloadID: cfg.ID,
-					Filename:   cfg.Filename,
-					Err:        err,
-				}
-			}
-			// Clean up errored download from tracking (don't save to .surge)
-			p.mu.Lock()
-			delete(p.downloads, cfg.ID)
-			p.mu.Unlock()
-
-		} else if !isPaused {
-			// Only mark as done if not paused
-			if cfg.State != nil {
-				cfg.State.Done.Store(true)
+// retire reports whether the calling worker is no longer needed after
+// SetMaxDownloads lowered the limit, and if so stops counting it
+func (p *WorkerPool) retire() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.workers <= p.maxDownloads {
+		return false
+	}
+	p.workers--
+	if p.workers > p.maxDownloads || len(p.queue) > 0 {
+		p.signal() // Pass on to the next idle worker
+	}
+	return true
+}
+
+// run downloads one file and updates tracking when it stops
+func (p *WorkerPool) run(ad *activeDownload) {
+	cfg := ad.config
+	err := TUIDownload(ad.ctx, &ad.config)
+
+	// Logic:
+	// 1. If Pause() was called: State.IsPaused() is true. We keep the task in p.downloads (so it can be resumed).
+	// 2. If finished/error: We remove from p.downloads.
+
+	isPaused := ad.config.State != nil && ad.config.State.IsPaused()
+
+	// Clear "Pausing" transition state now that worker has exited
+	if ad.config.State != nil {
+		ad.config.State.SetPausing(false)
+	}
+
+	if isPaused {
+		utils.Debug("WorkerPool: Download %s paused cleanly", cfg.ID)
+		// If paused, we keep it in downloads map for potential resume
+	} else if err != nil {
+		if cfg.State != nil {
+			cfg.State.SetError(err)
+		}
+		if p.progressCh != nil {
+			p.progressCh <- events.DownloadErrorMsg{
+				DownloadID: cfg.ID,
+				Filename:   cfg.Filename,
+				Err:        err,
 			}
-			// Note: DownloadCompleteMsg is sent by the progress reporter when it detects Done=true
+		}
+		// Clean up errored download from tracking (don't save to .surge)
+		p.mu.Lock()
+		delete(p.downloads, cfg.ID)
+		p.mu.Unlock()
 
-			// Clean up from tracking
-			p.mu.Lock()
-			delete(p.downloads, cfg.ID)
-			p.mu.Unlock()
+	} else if !isPaused {
+		// Only mark as done if not paused
+		if cfg.State != nil {
+			cfg.State.Done.Store(true)
 		}
-		// If paused, we keep it in downloads map for potential resume
-		p.wg.Done()
+		// Note: DownloadCompleteMsg is sent by the progress reporter when it detects Done=true
+
+		// Clean up from tracking
+		p.mu.Lock()
+		delete(p.downloads, cfg.ID)
+		p.mu.Unlock()
 	}
+	// If paused, we keep it in downloads map for potential resume
+	p.wg.Done()
 }
 
 // GetStatus returns the status of an active download
 func (p *WorkerPool) GetStatus(id string) *types.DownloadStatus {
 	p.mu.RLock()
 	ad, exists := p.downloads[id]
-	qCfg, qExists := p.queued[id]
-	p.mu.RUnlock()
-
-	if !exists && !qExists {
-		return nil
+	qIndex := p.queueIndex(id)
+	var qCfg types.DownloadConfig
+	if qIndex >= 0 {
+		qCfg = p.queue[qIndex]
 	}
+	p.mu.RUnlock()
 
-	if qExists {
+	if qIndex >= 0 {
 		return &types.DownloadStatus{
 			ID:         id,
 			URL:        qCfg.URL,
@@ -356,8 +613,15 @@ func (p *WorkerPool) GetStatus(id string) *types.DownloadStatus {
 			Status:     "queued",
 			Downloaded: 0,
 			TotalSize:  0, // Metadata not yet fetched
+			RateLimit:  qCfg.Limiter.Rate(),
+			Priority:   qCfg.Priority,
+			QueuePos:   qIndex + 1,
+			Category:   qCfg.Category,
 		}
 	}
+	if !exists {
+		return nil
+	}
 
 	state := ad.config.State
 	if state == nil {
@@ -373,6 +637,12 @@ func (p *WorkerPool) GetStatus(id string) *types.DownloadStatus {
 	// Calculate progress and speed (thread-safe)
 	downloaded, totalSize, _, sessionElapsed, _, sessionStart := state.GetProgress()
 
+	// The category is settled once the download starts
+	category := ad.config.Category
+	if str := state.GetCategory(); str != "" {
+		category = str
+	}
+
 	status := &types.DownloadStatus{
 		ID:         id,
 		URL:        ad.config.URL,
@@ -380,6 +650,8 @@ func (p *WorkerPool) GetStatus(id string) *types.DownloadStatus {
 		TotalSize:  totalSize,
 		Downloaded: downloaded,
 		Status:     "downloading",
+		RateLimit:  ad.config.Limiter.Rate(),
+		Category:   category,
 	}
 
 	if ad.config.State.IsPausing() {
@@ -414,7 +686,11 @@ func (p *WorkerPool) GetStatus(id string) *types.DownloadStatus {
 
 // GracefulShutdown pauses all downloads and waits for them to save state
 func (p *WorkerPool) GracefulShutdown() {
-	// ... existing implementation
+	// Stop workers from starting queued downloads; the queue is already saved
+	p.mu.Lock()
+	p.closed = true
+	p.mu.Unlock()
+
 	p.PauseAll()
 
 	// Wait for any downloads in "Pausing" state to finish transitioning
@@ -0,0 +1,237 @@
+package download
+
+import (
+	"path/filepath"
+	"slices"
+	"testing"
+
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// newIdlePool returns a pool without workers, so queued downloads stay queued
+func newIdlePool(t *testing.T) *WorkerPool {
+	t.Helper()
+	state.CloseDB()
+	state.Configure(filepath.Join(t.TempDir(), "surge.db"))
+	t.Cleanup(state.CloseDB)
+	return &WorkerPool{downloads: make(map[string]*activeDownload)}
+}
+
+func queueIDs(p *WorkerPool) []string {
+	var ids []string
+	for _, cfg := range p.Queued() {
+		ids = append(ids, cfg.ID)
+	}
+	return ids
+}
+
+func savedIDs(t *testing.T) []string {
+	t.Helper()
+	entries, err := state.LoadQueue()
+	if err != nil {
+		t.Fatalf("LoadQueue failed: %v", err)
+	}
+	var ids []string
+	for _, e := range entries {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func assertQueue(t *testing.T, p *WorkerPool, want ...string) {
+	t.Helper()
+	if got := queueIDs(p); !slices.Equal(got, want) {
+		t.Errorf("queue = %v, want %v", got, want)
+	}
+	if got := savedIDs(t); !slices.Equal(got, want) {
+		t.Errorf("saved queue = %v, want %v", got, want)
+	}
+}
+
+func TestWorkerPool_Add_OrdersByPriority(t *testing.T) {
+	p := newIdlePool(t)
+
+	p.Add(types.DownloadConfig{ID: "a", URL: "http://example.com/a"})
+	p.Add(types.DownloadConfig{ID: "b", URL: "http://example.com/b"})
+	p.Add(types.DownloadConfig{ID: "low", URL: "http://example.com/low", Priority: types.PriorityLow})
+	p.Add(types.DownloadConfig{ID: "high", URL: "http://example.com/high", Priority: types.PriorityHigh})
+	p.Add(types.DownloadConfig{ID: "c", URL: "http://example.com/c"})
+
+	assertQueue(t, p, "high", "a", "b", "c", "low")
+
+	if st := p.GetStatus("b"); st == nil || st.Status != "queued" || st.QueuePos != 3 {
+		t.Errorf("GetStatus(b) = %+v, want queued at position 3", st)
+	}
+
+	// Adding a queued download again keeps its place
+	p.Add(types.DownloadConfig{ID: "a", URL: "http://example.com/a", Filename: "renamed"})
+	assertQueue(t, p, "high", "a", "b", "c", "low")
+}
+
+func TestWorkerPool_Move(t *testing.T) {
+	p := newIdlePool(t)
+	for _, id := range []string{"a", "b", "c", "d"} {
+		p.Add(types.DownloadConfig{ID: id, URL: "http://example.com/" + id})
+	}
+
+	tests := []struct {
+		id   string
+		move types.QueueMove
+		want []string
+	}{
+		{"c", types.MoveTop, []string{"c", "a", "b", "d"}},
+		{"c", types.MoveDown, []string{"a", "c", "b", "d"}},
+		{"a", types.MoveBottom, []string{"c", "b", "d", "a"}},
+		{"d", types.MoveUp, []string{"c", "d", "b", "a"}},
+		{"c", types.MoveUp, []string{"c", "d", "b", "a"}}, // Already first
+	}
+	for _, tt := range tests {
+		if !p.Move(tt.id, tt.move) {
+			t.Fatalf("Move(%s, %s) returned false", tt.id, tt.move)
+		}
+		assertQueue(t, p, tt.want...)
+	}
+
+	if p.Move("missing", types.MoveTop) {
+		t.Error("Move should fail for a download that is not queued")
+	}
+}
+
+func TestWorkerPool_MoveAcrossPriorities(t *testing.T) {
+	p := newIdlePool(t)
+	p.Add(types.DownloadConfig{ID: "high", URL: "http://example.com/high", Priority: types.PriorityHigh})
+	p.Add(types.DownloadConfig{ID: "normal", URL: "http://example.com/normal"})
+	p.Add(types.DownloadConfig{ID: "low", URL: "http://example.com/low", Priority: types.PriorityLow})
+
+	// Moving to the top raises the priority so the order holds for later adds
+	p.Move("low", types.MoveTop)
+	if st := p.GetStatus("low"); st.Priority != types.PriorityHigh {
+		t.Errorf("priority after move to top = %d, want %d", st.Priority, types.PriorityHigh)
+	}
+	p.Add(types.DownloadConfig{ID: "new", URL: "http://example.com/new", Priority: types.PriorityHigh})
+	assertQueue(t, p, "low", "high", "new", "normal")
+
+	p.Move("high", types.MoveBottom)
+	if st := p.GetStatus("high"); st.Priority != types.PriorityNormal {
+		t.Errorf("priority after move to bottom = %d, want %d", st.Priority, types.PriorityNormal)
+	}
+}
+
+func TestWorkerPool_SetPriority(t *testing.T) {
+	p := newIdlePool(t)
+	for _, id := range []string{"a", "b", "c"} {
+		p.Add(types.DownloadConfig{ID: id, URL: "http://example.com/" + id})
+	}
+
+	if !p.SetPriority("c", types.PriorityHigh) {
+		t.Fatal("SetPriority returned false for a queued download")
+	}
+	assertQueue(t, p, "c", "a", "b")
+
+	if !p.SetPriority("c", types.PriorityLow) {
+		t.Fatal("SetPriority returned false for a queued download")
+	}
+	assertQueue(t, p, "a", "b", "c")
+
+	if saved, _ := state.LoadQueue(); saved[2].Priority != types.PriorityLow {
+		t.Errorf("saved priority = %d, want %d", saved[2].Priority, types.PriorityLow)
+	}
+
+	if p.SetPriority("missing", types.PriorityHigh) {
+		t.Error("SetPriority should fail for an unknown download")
+	}
+}
+
+func TestWorkerPool_Cancel_RemovesQueued(t *testing.T) {
+	p := newIdlePool(t)
+	ch := make(chan any, 10)
+	p.progressCh = ch
+	p.Add(types.DownloadConfig{ID: "a", URL: "http://example.com/a"})
+	p.Add(types.DownloadConfig{ID: "b", URL: "http://example.com/b"})
+
+	p.Cancel("a")
+	assertQueue(t, p, "b")
+}
+
+func TestWorkerPool_QueueStartsInOrder(t *testing.T) {
+	p := newIdlePool(t)
+	p.wake = make(chan struct{}, 1)
+	p.Add(types.DownloadConfig{ID: "a", URL: "http://example.com/a"})
+	p.Add(types.DownloadConfig{ID: "b", URL: "http://example.com/b"})
+	p.Add(types.DownloadConfig{ID: "c", URL: "http://example.com/c"})
+	p.Move("c", types.MoveTop)
+
+	// Take downloads the way a worker does, without running them
+	var started []string
+	for ad := p.next(); ad != nil; ad = p.next() {
+		started = append(started, ad.config.ID)
+		ad.cancel()
+		p.wg.Done()
+	}
+	if !slices.Equal(started, []string{"c", "a", "b"}) {
+		t.Errorf("started %v, want [c a b]", started)
+	}
+	if saved := savedIDs(t); len(saved) != 0 {
+		t.Errorf("started downloads still saved in queue: %v", saved)
+	}
+}
+
+func TestWorkerPool_ClosedPoolStartsNothing(t *testing.T) {
+	p := newIdlePool(t)
+	p.Add(types.DownloadConfig{ID: "a", URL: "http://example.com/a"})
+	p.GracefulShutdown()
+
+	if ad := p.next(); ad != nil {
+		t.Errorf("next() = %s after shutdown, want nil", ad.config.ID)
+	}
+	// The queue is kept for the next start
+	assertQueue(t, p, "a")
+}
+
+func TestWorkerPool_HoldStartsNothing(t *testing.T) {
+	p := newIdlePool(t)
+	p.wake = make(chan struct{}, 1)
+	p.Add(types.DownloadConfig{ID: "a", URL: "http://example.com/a"})
+
+	p.Hold(true)
+	if ad := p.next(); ad != nil {
+		t.Fatalf("next() = %s while held, want nil", ad.config.ID)
+	}
+	assertQueue(t, p, "a")
+
+	<-p.wake // Drain the signal from Add
+	p.Hold(false)
+	select {
+	case <-p.wake:
+	default:
+		t.Error("releasing the hold should wake a worker")
+	}
+	ad := p.next()
+	if ad == nil || ad.config.ID != "a" {
+		t.Fatalf("next() after release = %v, want a", ad)
+	}
+	ad.cancel()
+	p.wg.Done()
+}
+
+func TestWorkerPool_Cancel_ResumedPaused(t *testing.T) {
+	p := newIdlePool(t)
+	st := types.NewProgressState("a", 1000)
+	st.Pause()
+	p.downloads["a"] = &activeDownload{config: types.DownloadConfig{ID: "a", URL: "http://example.com/a", State: st}}
+
+	if !p.Resume("a") {
+		t.Fatal("Resume failed")
+	}
+	assertQueue(t, p, "a")
+
+	p.Cancel("a")
+	assertQueue(t, p)
+	if st := p.GetStatus("a"); st != nil {
+		t.Errorf("cancelled download still reported as %s", st.Status)
+	}
+	if all := p.GetAll(); len(all) != 0 {
+		t.Errorf("GetAll = %d downloads after cancel, want 0", len(all))
+	}
+}
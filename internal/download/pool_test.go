@@ -2,13 +2,17 @@ package download
 
 import (
 	"context"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
 
 	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/state"
 	"github.com/surge-downloader/surge/internal/engine/types"
 )
 
@@ -20,8 +24,8 @@ func TestNewWorkerPool(t *testing.T) {
 		t.Fatal("Expected non-nil WorkerPool")
 	}
 
-	if pool.taskChan == nil {
-		t.Error("Expected taskChan to be initialized")
+	if pool.wake == nil {
+		t.Error("Expected wake channel to be initialized")
 	}
 
 	if pool.progressCh != ch {
@@ -556,10 +560,8 @@ func TestWorkerPool_Resume_ClearsPausedFlag(t *testing.T) {
 func TestWorkerPool_Resume_UsesResolvedStatePathAndFilename(t *testing.T) {
 	ch := make(chan any, 10)
 	pool := &WorkerPool{
-		taskChan:   make(chan types.DownloadConfig, 10),
 		progressCh: ch,
 		downloads:  make(map[string]*activeDownload),
-		queued:     make(map[string]types.DownloadConfig),
 	}
 
 	state := types.NewProgressState("test-id", 1000)
@@ -597,17 +599,16 @@ func TestWorkerPool_Resume_UsesResolvedStatePathAndFilename(t *testing.T) {
 		t.Fatalf("Filename not propagated from state: got=%q", ad.config.Filename)
 	}
 
-	select {
-	case queued := <-pool.taskChan:
-		if queued.DestPath != "/tmp/final-name.bin" {
-			t.Fatalf("queued DestPath mismatch: got=%q", queued.DestPath)
-		}
-		if queued.Filename != "final-name.bin" {
-			t.Fatalf("queued Filename mismatch: got=%q", queued.Filename)
-		}
-	default:
+	queue := pool.Queued()
+	if len(queue) != 1 {
 		t.Fatal("expected resumed config to be queued")
 	}
+	if queue[0].DestPath != "/tmp/final-name.bin" {
+		t.Fatalf("queued DestPath mismatch: got=%q", queue[0].DestPath)
+	}
+	if queue[0].Filename != "final-name.bin" {
+		t.Fatalf("queued Filename mismatch: got=%q", queue[0].Filename)
+	}
 }
 
 func TestWorkerPool_Resume_SendsResumedMessage(t *testing.T) {
@@ -628,7 +629,7 @@ func TestWorkerPool_Resume_SendsResumedMessage(t *testing.T) {
 
 	pool.Resume("test-id")
 
-	// We can't reliably read from pool.taskChan because worker goroutines may consume the config before us. Just verify the resumed message was sent.
+	// We can't reliably read the queue because worker goroutines may take the config before us. Just verify the resumed message was sent.
 	// Check for resumed message
 	select {
 	case msg := <-ch:
@@ -666,8 +667,8 @@ func TestWorkerPool_Resume_RequeuesDownload(t *testing.T) {
 
 	pool.Resume("test-id")
 
-	// Note: We can't reliably read from pool.taskChan because worker goroutines
-	// may consume the config before us. Instead, verify Resume cleared the paused
+	// Note: We can't reliably read the queue because worker goroutines
+	// may take the config before us. Instead, verify Resume cleared the paused
 	// flag and sent the resumed message.
 
 	if state.IsPaused() {
@@ -873,3 +874,107 @@ func TestWorkerPool_PauseResume_Idempotency(t *testing.T) {
 		// OK
 	}
 }
+
+func TestWorkerPool_SetMaxDownloads(t *testing.T) {
+	state.CloseDB()
+	state.Configure(filepath.Join(t.TempDir(), "surge.db"))
+	defer state.CloseDB()
+
+	// Server that holds each download's requests until it is released
+	release := map[string]chan struct{}{}
+	for _, id := range []string{"a", "b", "c", "d"} {
+		release[id] = make(chan struct{})
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release[strings.TrimPrefix(r.URL.Path, "/")]
+	}))
+	defer server.Close()
+
+	pool := NewWorkerPool(nil, 1)
+	defer pool.GracefulShutdown()
+	defer func() {
+		for _, ch := range release {
+			select {
+			case <-ch:
+			default:
+				close(ch)
+			}
+		}
+	}()
+
+	outputDir := t.TempDir()
+	add := func(id string) {
+		pool.Add(types.DownloadConfig{
+			ID:         id,
+			URL:        server.URL + "/" + id,
+			OutputPath: outputDir,
+			Filename:   id + ".bin",
+			State:      types.NewProgressState(id, 0),
+			Runtime:    &types.RuntimeConfig{},
+		})
+	}
+	waitFor := func(desc string, cond func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !cond() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", desc)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	running := func() []*activeDownload {
+		pool.mu.RLock()
+		defer pool.mu.RUnlock()
+		var ads []*activeDownload
+		for _, ad := range pool.downloads {
+			ads = append(ads, ad)
+		}
+		return ads
+	}
+
+	add("a")
+	add("b")
+	add("c")
+	waitFor("one download to start", func() bool { return len(pool.Queued()) == 2 })
+
+	// Growing starts queued downloads right away
+	pool.SetMaxDownloads(3)
+	waitFor("queued downloads to start", func() bool { return len(pool.Queued()) == 0 })
+	if got := len(running()); got != 3 {
+		t.Fatalf("running downloads = %d, want 3", got)
+	}
+
+	// Shrinking leaves running downloads alone and holds new ones back
+	pool.SetMaxDownloads(1)
+	add("d")
+	time.Sleep(100 * time.Millisecond)
+	for _, ad := range running() {
+		if ad.ctx.Err() != nil {
+			t.Errorf("download %s was interrupted by lowering the limit", ad.config.ID)
+		}
+	}
+	if got := len(pool.Queued()); got != 1 {
+		t.Errorf("queued downloads = %d, want 1 while over the limit", got)
+	}
+
+	// Workers freed while over the limit retire instead of starting d
+	workers := func() int {
+		pool.mu.RLock()
+		defer pool.mu.RUnlock()
+		return pool.workers
+	}
+	close(release["a"])
+	close(release["b"])
+	waitFor("extra workers to retire", func() bool { return workers() == 1 })
+	if got := len(pool.Queued()); got != 1 {
+		t.Errorf("queued downloads = %d, want 1 while c is still running", got)
+	}
+
+	// The last worker picks d up once c ends
+	close(release["c"])
+	waitFor("the queued download to start", func() bool { return len(pool.Queued()) == 0 })
+	if got := pool.MaxDownloads(); got != 1 {
+		t.Errorf("MaxDownloads() = %d, want 1", got)
+	}
+}
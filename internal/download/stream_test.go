@@ -0,0 +1,98 @@
+package download_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestTUIDownload_HLSPlaylist(t *testing.T) {
+	tmpDir := setupChecksumTest(t)
+
+	var joined []byte
+	var playlist strings.Builder
+	playlist.WriteString("#EXTM3U\n#EXT-X-TARGETDURATION:4\n")
+	segments := make(map[string][]byte)
+	for i := 0; i < 6; i++ {
+		data := bytes.Repeat([]byte{byte('0' + i)}, 4096+i)
+		joined = append(joined, data...)
+		name := fmt.Sprintf("/s%d.ts", i)
+		segments[name] = data
+		playlist.WriteString("#EXTINF:4,\n" + name[1:] + "\n")
+	}
+	playlist.WriteString("#EXT-X-ENDLIST\n")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/live/index.m3u8" {
+			w.Header().Set("Content-Type", "application/vnd.apple.mpegurl")
+			_, _ = w.Write([]byte(playlist.String()))
+			return
+		}
+		data, ok := segments[strings.TrimPrefix(r.URL.Path, "/live")]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write(data)
+	}))
+	defer server.Close()
+
+	videoDir := filepath.Join(tmpDir, "videos")
+	progressCh := make(chan any, 100)
+	cfg := &types.DownloadConfig{
+		URL:        server.URL + "/live/index.m3u8",
+		OutputPath: tmpDir,
+		ID:         "hls-test",
+		ProgressCh: progressCh,
+		State:      types.NewProgressState("hls-test", 0),
+		Runtime: &types.RuntimeConfig{
+			MaxConnectionsPerHost: 3,
+			DefaultDownloadDir:    tmpDir,
+			Categories:            []config.Category{{Name: "Video", Dir: videoDir, MimeTypes: "video/*"}},
+		},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := download.TUIDownload(ctx, cfg); err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+
+	destPath := filepath.Join(videoDir, "index.ts")
+	got, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatalf("joined file missing: %v", err)
+	}
+	if !bytes.Equal(got, joined) {
+		t.Errorf("joined file is %d bytes, want the %d bytes of the segments", len(got), len(joined))
+	}
+
+	var started *events.DownloadStartedMsg
+	var complete *events.DownloadCompleteMsg
+	for len(progressCh) > 0 {
+		switch msg := (<-progressCh).(type) {
+		case events.DownloadStartedMsg:
+			started = &msg
+		case events.DownloadCompleteMsg:
+			complete = &msg
+		}
+	}
+	if started == nil || started.Filename != "index.ts" || started.DestPath != destPath || started.Category != "Video" {
+		t.Errorf("started = %+v", started)
+	}
+	if complete == nil || complete.Total != int64(len(joined)) {
+		t.Errorf("complete = %+v, want Total %d", complete, len(joined))
+	}
+}
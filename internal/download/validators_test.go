@@ -0,0 +1,84 @@
+package download_test
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/testutil"
+)
+
+func TestTUIDownload_ResumeAfterRemoteChangeRestarts(t *testing.T) {
+	tmpDir := setupChecksumTest(t)
+
+	fileSize := int64(1 * types.MB)
+	current := make([]byte, fileSize)
+	for i := range current {
+		current[i] = byte(i % 253)
+	}
+	server := testutil.NewHTTPServerT(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v2"`)
+		http.ServeContent(w, r, "data.bin", time.Time{}, bytes.NewReader(current))
+	}))
+	defer server.Close()
+
+	// Half of an older version was downloaded before the pause
+	destPath := filepath.Join(tmpDir, "data.bin")
+	stale := bytes.Repeat([]byte{0xFF}, int(fileSize))
+	if err := os.WriteFile(destPath+types.IncompleteSuffix, stale, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	id := "changed-remote"
+	if err := state.SaveState(server.URL, destPath, &types.DownloadState{
+		ID:         id,
+		URL:        server.URL,
+		DestPath:   destPath,
+		TotalSize:  fileSize,
+		Downloaded: fileSize / 2,
+		Tasks:      []types.Task{{Offset: fileSize / 2, Length: fileSize / 2}},
+		Filename:   "data.bin",
+		Validators: types.Validators{ETag: `"v1"`},
+	}); err != nil {
+		t.Fatalf("SaveState failed: %v", err)
+	}
+	saved, err := state.LoadState(server.URL, destPath)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+
+	progState := types.NewProgressState(id, fileSize)
+	progState.Downloaded.Store(fileSize / 2)
+	cfg := types.DownloadConfig{
+		URL:        server.URL,
+		OutputPath: tmpDir,
+		DestPath:   destPath,
+		Filename:   "data.bin",
+		ID:         id,
+		IsResume:   true,
+		SavedState: saved,
+		ProgressCh: make(chan any, 100),
+		State:      progState,
+		Runtime:    &types.RuntimeConfig{MaxConnectionsPerHost: 4},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := download.TUIDownload(ctx, &cfg); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+
+	got, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, current) {
+		t.Fatal("resumed file mixes data from the old version")
+	}
+}
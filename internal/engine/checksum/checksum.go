@@ -0,0 +1,154 @@
+package checksum
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// Supported digest algorithms
+const (
+	SHA256 = "sha256"
+	SHA1   = "sha1"
+	MD5    = "md5"
+	SHA512 = "sha512"
+)
+
+// Checksum is an expected digest for a file
+type Checksum struct {
+	Algorithm string
+	Hex       string
+}
+
+// String returns the canonical "algo:hex" form
+func (c Checksum) String() string {
+	return c.Algorithm + ":" + c.Hex
+}
+
+// Parse parses an "algo:hex" digest string.
+// A bare hex string is accepted and its algorithm inferred from the length.
+func Parse(s string) (Checksum, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return Checksum{}, fmt.Errorf("empty checksum")
+	}
+
+	algo, digest, found := strings.Cut(s, ":")
+	if !found {
+		digest = algo
+		algo = inferAlgorithm(digest)
+		if algo == "" {
+			return Checksum{}, fmt.Errorf("cannot infer algorithm for checksum of length %d", len(digest))
+		}
+	}
+
+	algo = normalizeAlgorithm(algo)
+	h := New(algo)
+	if h == nil {
+		return Checksum{}, fmt.Errorf("unsupported checksum algorithm %q", algo)
+	}
+
+	digest = strings.ToLower(strings.TrimSpace(digest))
+	if _, err := hex.DecodeString(digest); err != nil {
+		return Checksum{}, fmt.Errorf("invalid %s checksum: not hex", algo)
+	}
+	if len(digest) != h.Size()*2 {
+		return Checksum{}, fmt.Errorf("invalid %s checksum: expected %d hex characters, got %d", algo, h.Size()*2, len(digest))
+	}
+
+	return Checksum{Algorithm: algo, Hex: digest}, nil
+}
+
+// Normalize validates a checksum string and returns it in canonical form.
+// An empty input is returned unchanged.
+func Normalize(s string) (string, error) {
+	if strings.TrimSpace(s) == "" {
+		return "", nil
+	}
+	c, err := Parse(s)
+	if err != nil {
+		return "", err
+	}
+	return c.String(), nil
+}
+
+// New returns a hash for the given algorithm, or nil if it is not supported
+func New(algo string) hash.Hash {
+	switch normalizeAlgorithm(algo) {
+	case SHA256:
+		return sha256.New()
+	case SHA1:
+		return sha1.New()
+	case MD5:
+		return md5.New()
+	case SHA512:
+		return sha512.New()
+	}
+	return nil
+}
+
+// Sum computes the digest of a file using the given algorithm
+func Sum(path string, algo string) (string, error) {
+	h := New(algo)
+	if h == nil {
+		return "", fmt.Errorf("unsupported checksum algorithm %q", algo)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifyFile hashes the file at path and compares it against expected.
+// A mismatch returns an error wrapping types.ErrChecksumMismatch.
+func VerifyFile(path string, expected string) error {
+	c, err := Parse(expected)
+	if err != nil {
+		return err
+	}
+
+	actual, err := Sum(path, c.Algorithm)
+	if err != nil {
+		return fmt.Errorf("failed to hash file: %w", err)
+	}
+
+	if actual != c.Hex {
+		return fmt.Errorf("%w: expected %s, got %s:%s", types.ErrChecksumMismatch, c, c.Algorithm, actual)
+	}
+	return nil
+}
+
+func normalizeAlgorithm(algo string) string {
+	algo = strings.ToLower(strings.TrimSpace(algo))
+	return strings.ReplaceAll(algo, "-", "")
+}
+
+func inferAlgorithm(digest string) string {
+	switch len(strings.TrimSpace(digest)) {
+	case md5.Size * 2:
+		return MD5
+	case sha1.Size * 2:
+		return SHA1
+	case sha256.Size * 2:
+		return SHA256
+	case sha512.Size * 2:
+		return SHA512
+	}
+	return ""
+}
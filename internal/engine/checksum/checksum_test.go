@@ -0,0 +1,198 @@
+package checksum
+
+import (
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestParse(t *testing.T) {
+	sha256Hex := strings.Repeat("ab", 32)
+
+	tests := []struct {
+		name    string
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"prefixed sha256", "sha256:" + sha256Hex, "sha256:" + sha256Hex, false},
+		{"uppercase algo and digest", "SHA-256:" + strings.ToUpper(sha256Hex), "sha256:" + sha256Hex, false},
+		{"bare sha256 inferred", sha256Hex, "sha256:" + sha256Hex, false},
+		{"bare md5 inferred", strings.Repeat("0", 32), "md5:" + strings.Repeat("0", 32), false},
+		{"sha1", "sha1:" + strings.Repeat("1", 40), "sha1:" + strings.Repeat("1", 40), false},
+		{"sha512", "sha512:" + strings.Repeat("f", 128), "sha512:" + strings.Repeat("f", 128), false},
+		{"empty", "", "", true},
+		{"unknown algorithm", "crc32:deadbeef", "", true},
+		{"wrong length", "sha256:abcd", "", true},
+		{"not hex", "md5:" + strings.Repeat("z", 32), "", true},
+		{"bare unknown length", "abcdef", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Parse(tt.input)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("Parse(%q) expected error, got %v", tt.input, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Parse(%q) unexpected error: %v", tt.input, err)
+			}
+			if got.String() != tt.want {
+				t.Errorf("Parse(%q) = %q, want %q", tt.input, got.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalize_Empty(t *testing.T) {
+	got, err := Normalize("  ")
+	if err != nil || got != "" {
+		t.Errorf("Normalize(blank) = %q, %v; want empty, nil", got, err)
+	}
+}
+
+func TestVerifyFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "file.bin")
+	content := []byte("surge checksum test")
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	sum := sha256.Sum256(content)
+	good := "sha256:" + hex.EncodeToString(sum[:])
+
+	if err := VerifyFile(path, good); err != nil {
+		t.Errorf("VerifyFile with matching digest failed: %v", err)
+	}
+
+	bad := "sha256:" + strings.Repeat("0", 64)
+	err := VerifyFile(path, bad)
+	if !errors.Is(err, types.ErrChecksumMismatch) {
+		t.Errorf("VerifyFile with wrong digest = %v, want ErrChecksumMismatch", err)
+	}
+}
+
+func TestVerifyFile_MissingFile(t *testing.T) {
+	err := VerifyFile(filepath.Join(t.TempDir(), "missing"), "md5:"+strings.Repeat("0", 32))
+	if err == nil {
+		t.Fatal("expected error for missing file")
+	}
+	if errors.Is(err, types.ErrChecksumMismatch) {
+		t.Error("missing file should not be reported as a checksum mismatch")
+	}
+}
+
+func TestParseHTTPDigest(t *testing.T) {
+	content := []byte("hello")
+	sum := sha256.Sum256(content)
+	b64 := base64.StdEncoding.EncodeToString(sum[:])
+	wantHex := hex.EncodeToString(sum[:])
+
+	tests := []struct {
+		name  string
+		value string
+	}{
+		{"rfc9530", "sha-256=:" + b64 + ":"},
+		{"rfc9530 with unknown member", "unixsum=:AAAA:, sha-256=:" + b64 + ":"},
+		{"rfc3230", "SHA-256=" + b64},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sums := ParseHTTPDigest(tt.value)
+			c, ok := Strongest(sums)
+			if !ok {
+				t.Fatalf("no digest parsed from %q", tt.value)
+			}
+			if c.Algorithm != SHA256 || c.Hex != wantHex {
+				t.Errorf("got %s, want sha256:%s", c, wantHex)
+			}
+		})
+	}
+
+	if sums := ParseHTTPDigest("sha-256=:bm90IGEgZGlnZXN0:"); len(sums) != 0 {
+		t.Errorf("digest with wrong length should be rejected, got %v", sums)
+	}
+}
+
+func TestParseContentMD5(t *testing.T) {
+	sum := md5.Sum([]byte("hello"))
+	c, ok := ParseContentMD5(base64.StdEncoding.EncodeToString(sum[:]))
+	if !ok {
+		t.Fatal("failed to parse Content-MD5")
+	}
+	if c.Algorithm != MD5 || c.Hex != hex.EncodeToString(sum[:]) {
+		t.Errorf("got %s", c)
+	}
+	if _, ok := ParseContentMD5("garbage!"); ok {
+		t.Error("invalid Content-MD5 should not parse")
+	}
+}
+
+func TestVerifyPieces(t *testing.T) {
+	data := []byte("0123456789abcdefXYZ") // 19 bytes: two 8-byte pieces and a short tail
+	pieces := &types.PieceHashes{Algorithm: "SHA-256", Length: 8}
+	for off := 0; off < len(data); off += 8 {
+		end := min(off+8, len(data))
+		sum := sha256.Sum256(data[off:end])
+		pieces.Hashes = append(pieces.Hashes, strings.ToUpper(hex.EncodeToString(sum[:])))
+	}
+	if err := NormalizePieces(pieces); err != nil {
+		t.Fatalf("NormalizePieces: %v", err)
+	}
+	if pieces.Algorithm != SHA256 {
+		t.Errorf("Algorithm = %q, want %q", pieces.Algorithm, SHA256)
+	}
+
+	bad, err := VerifyPieces(strings.NewReader(string(data)), int64(len(data)), pieces)
+	if err != nil {
+		t.Fatalf("VerifyPieces: %v", err)
+	}
+	if len(bad) != 0 {
+		t.Fatalf("expected no bad pieces, got %v", bad)
+	}
+
+	corrupt := []byte(string(data))
+	corrupt[17] = '!'
+	bad, err = VerifyPieces(strings.NewReader(string(corrupt)), int64(len(corrupt)), pieces)
+	if err != nil {
+		t.Fatalf("VerifyPieces: %v", err)
+	}
+	if len(bad) != 1 || bad[0] != (types.Task{Offset: 16, Length: 3}) {
+		t.Errorf("expected tail piece to be bad, got %v", bad)
+	}
+
+	if _, err := VerifyPieces(strings.NewReader(string(data)), 100, pieces); err == nil {
+		t.Error("expected error when piece count does not cover the file")
+	}
+}
+
+func TestNormalizePieces_Invalid(t *testing.T) {
+	tests := []struct {
+		name   string
+		pieces types.PieceHashes
+	}{
+		{"zero length", types.PieceHashes{Algorithm: MD5, Length: 0, Hashes: []string{strings.Repeat("0", 32)}}},
+		{"no hashes", types.PieceHashes{Algorithm: MD5, Length: 1}},
+		{"unknown algorithm", types.PieceHashes{Algorithm: "crc32", Length: 1, Hashes: []string{"00000000"}}},
+		{"wrong digest length", types.PieceHashes{Algorithm: MD5, Length: 1, Hashes: []string{"abcd"}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := NormalizePieces(&tt.pieces); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package checksum
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// httpAlgorithms maps HTTP digest algorithm tokens (RFC 3230 / RFC 9530) to our names
+var httpAlgorithms = map[string]string{
+	"sha-512": SHA512,
+	"sha-256": SHA256,
+	"sha":     SHA1,
+	"md5":     MD5,
+}
+
+// algorithmStrength orders algorithms from strongest to weakest
+var algorithmStrength = []string{SHA512, SHA256, SHA1, MD5}
+
+// ParseHTTPDigest parses a Digest (RFC 3230), Repr-Digest or Content-Digest
+// (RFC 9530) header value. Unknown algorithms and malformed members are skipped.
+func ParseHTTPDigest(value string) []Checksum {
+	var out []Checksum
+	for _, member := range strings.Split(value, ",") {
+		name, encoded, found := strings.Cut(strings.TrimSpace(member), "=")
+		if !found {
+			continue
+		}
+		algo, ok := httpAlgorithms[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			continue
+		}
+
+		// RFC 9530 wraps the value as a byte sequence (:base64:), RFC 3230 does not
+		encoded = strings.TrimSpace(encoded)
+		if params := strings.IndexByte(encoded, ';'); params != -1 {
+			encoded = encoded[:params]
+		}
+		encoded = strings.TrimSuffix(strings.TrimPrefix(encoded, ":"), ":")
+
+		if c, ok := fromBase64(algo, encoded); ok {
+			out = append(out, c)
+		}
+	}
+	return out
+}
+
+// ParseContentMD5 parses a Content-MD5 header value (RFC 1864)
+func ParseContentMD5(value string) (Checksum, bool) {
+	return fromBase64(MD5, strings.TrimSpace(value))
+}
+
+// Strongest returns the checksum using the strongest supported algorithm
+func Strongest(sums []Checksum) (Checksum, bool) {
+	for _, algo := range algorithmStrength {
+		for _, c := range sums {
+			if c.Algorithm == algo {
+				return c, true
+			}
+		}
+	}
+	return Checksum{}, false
+}
+
+func fromBase64(algo, encoded string) (Checksum, bool) {
+	raw, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return Checksum{}, false
+	}
+	if h := New(algo); h == nil || len(raw) != h.Size() {
+		return Checksum{}, false
+	}
+	return Checksum{Algorithm: algo, Hex: hex.EncodeToString(raw)}, true
+}
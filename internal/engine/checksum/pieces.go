@@ -0,0 +1,74 @@
+package checksum
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// NormalizePieces validates piece hashes and rewrites them in canonical form.
+// A nil value is valid and means no piece verification.
+func NormalizePieces(p *types.PieceHashes) error {
+	if p == nil {
+		return nil
+	}
+	if p.Length <= 0 {
+		return fmt.Errorf("invalid piece length %d", p.Length)
+	}
+	if len(p.Hashes) == 0 {
+		return fmt.Errorf("no piece hashes")
+	}
+
+	algo := normalizeAlgorithm(p.Algorithm)
+	h := New(algo)
+	if h == nil {
+		return fmt.Errorf("unsupported piece hash algorithm %q", p.Algorithm)
+	}
+	p.Algorithm = algo
+
+	for i, digest := range p.Hashes {
+		digest = strings.ToLower(strings.TrimSpace(digest))
+		if _, err := hex.DecodeString(digest); err != nil || len(digest) != h.Size()*2 {
+			return fmt.Errorf("invalid %s hash for piece %d", algo, i)
+		}
+		p.Hashes[i] = digest
+	}
+	return nil
+}
+
+// VerifyPieces hashes each piece of r and returns the byte ranges whose
+// digest does not match. size is the total file size.
+func VerifyPieces(r io.ReaderAt, size int64, p *types.PieceHashes) ([]types.Task, error) {
+	if p == nil {
+		return nil, nil
+	}
+	if want := (size + p.Length - 1) / p.Length; int64(len(p.Hashes)) != want {
+		return nil, fmt.Errorf("expected %d piece hashes for %d bytes, got %d", want, size, len(p.Hashes))
+	}
+
+	h := New(p.Algorithm)
+	if h == nil {
+		return nil, fmt.Errorf("unsupported piece hash algorithm %q", p.Algorithm)
+	}
+
+	var bad []types.Task
+	for i, expected := range p.Hashes {
+		offset := int64(i) * p.Length
+		length := p.Length
+		if offset+length > size {
+			length = size - offset
+		}
+
+		h.Reset()
+		if _, err := io.Copy(h, io.NewSectionReader(r, offset, length)); err != nil {
+			return nil, fmt.Errorf("failed to read piece %d: %w", i, err)
+		}
+		if hex.EncodeToString(h.Sum(nil)) != expected {
+			bad = append(bad, types.Task{Offset: offset, Length: length})
+		}
+	}
+	return bad, nil
+}
@@ -0,0 +1,145 @@
+package concurrent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// runCheckpoints periodically persists the download's outstanding work until ctx ends.
+// Returns whether a checkpoint was written, so a cancelled download can clean it up.
+func (d *ConcurrentDownloader) runCheckpoints(ctx context.Context, queue *TaskQueue, file *os.File, destPath string, fileSize int64, mirrors []string, startTime time.Time) bool {
+	ticker := time.NewTicker(d.Runtime.GetCheckpointInterval())
+	defer ticker.Stop()
+
+	saved := false
+	for {
+		select {
+		case <-ctx.Done():
+			return saved
+		case <-ticker.C:
+			if err := d.checkpoint(queue, file, destPath, fileSize, mirrors, startTime); err != nil {
+				utils.Debug("Checkpoint failed: %v", err)
+				continue
+			}
+			saved = true
+		}
+	}
+}
+
+// checkpoint saves the work still outstanding as a resumable state.
+// The snapshot is taken before the file is synced: every byte it counts as
+// done was written before it, so the sync makes those bytes durable before
+// the state that relies on them is committed.
+func (d *ConcurrentDownloader) checkpoint(queue *TaskQueue, file *os.File, destPath string, fileSize int64, mirrors []string, startTime time.Time) error {
+	remaining := d.outstandingTasks(queue)
+	if len(remaining) == 0 {
+		return nil // Finishing; the completion path takes over
+	}
+	var remainingBytes int64
+	for _, task := range remaining {
+		remainingBytes += task.Length
+	}
+
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+
+	var elapsed time.Duration
+	if d.State != nil {
+		elapsed = d.State.GetSavedElapsed()
+	}
+	elapsed += time.Since(startTime)
+
+	s := d.resumeState(destPath, fileSize, fileSize-remainingBytes, remaining, elapsed, mirrors)
+	return state.SaveCheckpoint(d.URL, destPath, s)
+}
+
+// outstandingTasks returns every range not yet written: queued tasks, the
+// unfinished part of active ones, and claimed tasks no worker has active.
+// Both locks are held together so no task can be in transit between them.
+// Overlaps (hedged duplicates, requeued ranges) are merged.
+func (d *ConcurrentDownloader) outstandingTasks(queue *TaskQueue) []types.Task {
+	d.activeMu.Lock()
+	defer d.activeMu.Unlock()
+
+	pending, claimed := queue.Snapshot()
+	tasks := pending
+	for id, active := range d.activeTasks {
+		delete(claimed, id)
+		if atomic.LoadInt32(&active.Verifying) != 0 {
+			// Nothing of a range is kept until its digest matches
+			stopAt := atomic.LoadInt64(&active.StopAt)
+			tasks = append(tasks, types.Task{Offset: active.Task.Offset, Length: stopAt - active.Task.Offset})
+			continue
+		}
+		if remaining := active.RemainingTask(); remaining != nil {
+			tasks = append(tasks, *remaining)
+		}
+	}
+	for _, task := range claimed {
+		tasks = append(tasks, task)
+	}
+	return coalesceTasks(tasks)
+}
+
+// coalesceTasks sorts tasks by offset and merges the ones that overlap or touch
+func coalesceTasks(tasks []types.Task) []types.Task {
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].Offset < tasks[j].Offset })
+
+	var merged []types.Task
+	for _, task := range tasks {
+		if task.Length <= 0 {
+			continue
+		}
+		if n := len(merged); n > 0 {
+			last := &merged[n-1]
+			if task.Offset <= last.Offset+last.Length {
+				if end := task.Offset + task.Length; end > last.Offset+last.Length {
+					last.Length = end - last.Offset
+				}
+				continue
+			}
+		}
+		merged = append(merged, task)
+	}
+	return merged
+}
+
+// resumeState builds the state a later run resumes from
+func (d *ConcurrentDownloader) resumeState(destPath string, fileSize, downloaded int64, tasks []types.Task, elapsed time.Duration, mirrors []string) *types.DownloadState {
+	var chunkBitmap []byte
+	var actualChunkSize int64
+	if d.State != nil {
+		bitmap, _, _, chunkSize, _ := d.State.GetBitmap()
+		chunkBitmap = bitmap
+		actualChunkSize = chunkSize
+	}
+
+	return &types.DownloadState{
+		URL:             d.URL,
+		ID:              d.ID,
+		DestPath:        destPath,
+		TotalSize:       fileSize,
+		Downloaded:      downloaded,
+		Tasks:           tasks,
+		Filename:        filepath.Base(destPath),
+		Elapsed:         elapsed.Nanoseconds(),
+		Mirrors:         mirrors,
+		ChunkBitmap:     chunkBitmap,
+		ActualChunkSize: actualChunkSize,
+		Checksum:        d.Checksum,
+		Pieces:          d.Pieces,
+		Category:        d.Category,
+		RateLimit:       d.Limiter.Rate(),
+		Validators:      d.Validators,
+	}
+}
@@ -0,0 +1,246 @@
+package concurrent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+func TestCoalesceTasks(t *testing.T) {
+	got := coalesceTasks([]types.Task{
+		{Offset: 500, Length: 100},
+		{Offset: 0, Length: 100},
+		{Offset: 50, Length: 100}, // Overlaps the first
+		{Offset: 150, Length: 50}, // Touches it
+		{Offset: 520, Length: 10}, // Inside another (hedged duplicate)
+		{Offset: 300, Length: 0},
+	})
+	want := []types.Task{{Offset: 0, Length: 200}, {Offset: 500, Length: 100}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("coalesceTasks = %+v, want %+v", got, want)
+	}
+}
+
+// trickleServer serves data with range support, a few KB at a time.
+// While hold is open, responses stop once holdAfter bytes were served in total.
+type trickleServer struct {
+	*httptest.Server
+	data      []byte
+	hold      chan struct{}
+	holdAfter int64
+	served    atomic.Int64
+
+	mu     sync.Mutex
+	ranges []string
+}
+
+func newTrickleServer(t *testing.T, size int, holdAfter int64) *trickleServer {
+	s := &trickleServer{data: make([]byte, size), hold: make(chan struct{}), holdAfter: holdAfter}
+	rand.New(rand.NewSource(1)).Read(s.data)
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.ranges = append(s.ranges, r.Header.Get("Range"))
+		s.mu.Unlock()
+		http.ServeContent(&trickleWriter{ResponseWriter: w, s: s}, r, "file.bin", time.Time{}, bytes.NewReader(s.data))
+	}))
+	t.Cleanup(s.Close)
+	t.Cleanup(s.release) // Runs first, unblocking held handlers
+	return s
+}
+
+func (s *trickleServer) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.hold:
+	default:
+		close(s.hold)
+	}
+}
+
+func (s *trickleServer) requestedRanges() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.ranges...)
+}
+
+type trickleWriter struct {
+	http.ResponseWriter
+	s *trickleServer
+}
+
+func (w *trickleWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		if w.s.holdAfter > 0 && w.s.served.Load() >= w.s.holdAfter {
+			if f, ok := w.ResponseWriter.(http.Flusher); ok {
+				f.Flush()
+			}
+			<-w.s.hold
+		}
+		n := min(len(p), 4096)
+		m, err := w.ResponseWriter.Write(p[:n])
+		written += m
+		w.s.served.Add(int64(m))
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+		time.Sleep(2 * time.Millisecond)
+	}
+	return written, nil
+}
+
+func TestConcurrentDownloader_ResumeFromCheckpoint(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	srv := newTrickleServer(t, 2*int(types.MB), 512*types.KB)
+	fileSize := int64(len(srv.data))
+	destPath := filepath.Join(tmpDir, "crash.bin")
+	workingPath := destPath + types.IncompleteSuffix
+	runtime := &types.RuntimeConfig{
+		MaxConnectionsPerHost: 4,
+		MinChunkSize:          256 * types.KB,
+		WorkerBufferSize:      16 * types.KB, // Small reads, so held responses still advance
+		CheckpointInterval:    20 * time.Millisecond,
+	}
+	if _, err := state.GetDB(); err != nil { // Open it before the downloader and the test poll it
+		t.Fatal(err)
+	}
+
+	d := NewConcurrentDownloader("crash-id", nil, types.NewProgressState("crash-id", fileSize), runtime)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() { errCh <- d.Download(ctx, srv.URL, nil, nil, destPath, fileSize) }()
+
+	// Wait for a checkpoint past the start of the file while the server holds
+	// every response, then capture what a crash at this point would leave on disk
+	var saved *types.DownloadState
+	deadline := time.Now().Add(20 * time.Second)
+	for saved == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("no checkpoint was saved")
+		}
+		select {
+		case err := <-errCh:
+			t.Fatalf("download ended before a checkpoint was seen: %v", err)
+		default:
+		}
+		if s, err := state.LoadState(srv.URL, destPath); err == nil && len(s.Tasks) > 0 && s.Tasks[0].Offset > 0 {
+			saved = s
+		}
+		time.Sleep(time.Millisecond)
+	}
+	partial, err := os.ReadFile(workingPath)
+	if err != nil {
+		t.Fatalf("failed to read working file: %v", err)
+	}
+	if saved.Downloaded <= 0 || saved.Downloaded >= fileSize {
+		t.Fatalf("checkpoint Downloaded = %d, want partial progress", saved.Downloaded)
+	}
+	if dl, _ := state.GetDownload("crash-id"); dl == nil || dl.Status != "downloading" {
+		t.Errorf("checkpointed entry = %+v, want status 'downloading'", dl)
+	}
+
+	// A plain cancel removes the download, checkpoint included
+	cancel()
+	if err := <-errCh; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if _, err := state.LoadState(srv.URL, destPath); err == nil {
+		t.Error("checkpoint should be removed when the download is cancelled")
+	}
+
+	// Restore the crash leftovers and restart, as the next Surge run would
+	srv.release()
+	if err := os.WriteFile(workingPath, partial, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.SaveCheckpoint(srv.URL, destPath, saved); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := state.RequeueInterrupted(); err != nil || n != 1 {
+		t.Fatalf("RequeueInterrupted = %d, %v; want 1", n, err)
+	}
+
+	before := len(srv.requestedRanges())
+	resumed := NewConcurrentDownloader("crash-id", nil, types.NewProgressState("crash-id", fileSize), runtime)
+	if err := resumed.Download(context.Background(), srv.URL, nil, nil, destPath, fileSize); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+
+	got, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatalf("failed to read result: %v", err)
+	}
+	if !bytes.Equal(got, srv.data) {
+		t.Fatal("resumed file differs from the served data")
+	}
+	for _, r := range srv.requestedRanges()[before:] {
+		if strings.HasPrefix(r, "bytes=0-") {
+			t.Errorf("resume refetched the start of the file (%s), already covered by the checkpoint", r)
+		}
+	}
+	if _, err := state.LoadState(srv.URL, destPath); err == nil {
+		t.Error("state should be deleted after completion")
+	}
+}
+
+func TestConcurrentDownloader_NoCheckpointAfterCompletion(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	srv := newTrickleServer(t, 512*int(types.KB), 0)
+	fileSize := int64(len(srv.data))
+	destPath := filepath.Join(tmpDir, "done.bin")
+	runtime := &types.RuntimeConfig{MaxConnectionsPerHost: 2, CheckpointInterval: time.Millisecond}
+	if _, err := state.GetDB(); err != nil {
+		t.Fatal(err)
+	}
+
+	var checkpoints atomic.Int32
+	stop := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-stop:
+				return
+			case <-time.After(time.Millisecond):
+				if _, err := state.LoadState(srv.URL, destPath); err == nil {
+					checkpoints.Add(1)
+				}
+			}
+		}
+	}()
+	d := NewConcurrentDownloader("done-id", nil, types.NewProgressState("done-id", fileSize), runtime)
+	err := d.Download(context.Background(), srv.URL, nil, nil, destPath, fileSize)
+	close(stop)
+	if err != nil {
+		t.Fatalf("download failed: %v", err)
+	}
+	if checkpoints.Load() == 0 {
+		t.Error("expected a checkpoint while the download ran")
+	}
+
+	// The checkpointer is stopped before the state is deleted, so none comes back
+	time.Sleep(20 * time.Millisecond)
+	if _, err := state.LoadState(srv.URL, destPath); err == nil {
+		t.Error("checkpoint saved after the download completed")
+	}
+}
@@ -4,15 +4,18 @@ import (
 	"context"
 	"crypto/tls"
 	"fmt"
+	"io"
 	"math"
 	"net"
 	"net/http"
 	"net/url"
 	"os"
-	"path/filepath"
 	"sync"
 	"time"
 
+	"github.com/surge-downloader/surge/internal/engine/checksum"
+	"github.com/surge-downloader/surge/internal/engine/metrics"
+	"github.com/surge-downloader/surge/internal/engine/ratelimit"
 	"github.com/surge-downloader/surge/internal/engine/state"
 	"github.com/surge-downloader/surge/internal/engine/types"
 	"github.com/surge-downloader/surge/internal/utils"
@@ -29,7 +32,30 @@ type ConcurrentDownloader struct {
 	DestPath     string // For pause/resume
 	Runtime      *types.RuntimeConfig
 	bufPool      sync.Pool
-	Headers      map[string]string // Custom HTTP headers from browser (cookies, auth, etc.)
+	Headers      map[string]string  // Custom HTTP headers from browser (cookies, auth, etc.)
+	Checksum     string             // Expected digest of the finished file ("algo:hex"), optional
+	Pieces       *types.PieceHashes // Expected per-piece digests, optional
+	Category     string             // Category name saved with the pause state, optional
+	Limiter      *ratelimit.Limiter // Per-download bandwidth cap shared by all workers, optional
+	Validators   types.Validators   // Version of the file being downloaded, sent as If-Range to the primary URL
+	Source       RangeSource        // Transport for non-HTTP URLs, optional; nil fetches ranges over HTTP
+
+	// Per-range integrity tracking
+	integrityMu   sync.Mutex
+	corruptRanges map[types.Task]int // Integrity failures per range
+	repairPasses  int                // Piece verification passes that found corruption
+	fatalErr      error              // First unrecoverable worker error
+
+	tlsConfig *tls.Config // Client TLS settings, overridden in tests
+}
+
+// RangeSource reads byte ranges of a remote file over a transport other than HTTP.
+// Workers use it in place of Range requests, keeping the task queue, work
+// stealing, health checks and pause state of the HTTP path.
+type RangeSource interface {
+	// OpenRange returns a reader for length bytes starting at offset.
+	// Cancelling ctx must unblock a pending Read.
+	OpenRange(ctx context.Context, offset, length int64) (io.ReadCloser, error)
 }
 
 // NewConcurrentDownloader creates a new concurrent downloader with all required parameters
@@ -113,6 +139,9 @@ func (d *ConcurrentDownloader) ReportMirrorError(url string) {
 	}
 
 	if changed {
+		if len(mirrors) > 1 {
+			metrics.MirrorFailures.Inc()
+		}
 		d.State.SetMirrors(mirrors)
 	}
 }
@@ -226,10 +255,12 @@ func (d *ConcurrentDownloader) newConcurrentClient(numConns int) *http.Client {
 			Timeout:   types.DialTimeout,
 			KeepAlive: types.KeepAliveDuration,
 		}).DialContext,
+
+		TLSClientConfig: d.tlsConfig,
 	}
 
 	return &http.Client{
-		Transport: transport,
+		Transport: newHostRouter(transport, d.Runtime),
 		// Preserve headers on redirects for authenticated downloads
 		// By default, Go strips sensitive headers (Cookie, Authorization) on cross-domain redirects.
 		// Since these headers were explicitly provided by the browser for this download, we forward them.
@@ -437,6 +468,15 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 				// Ensure queue is empty (no pending retries) before considering byte count.
 				// This protects against cutting off active retries even if byte count seems high (due to overlaps etc).
 				if queue.Len() == 0 && (int(queue.IdleWorkers()) == numConns || d.State.Downloaded.Load() >= fileSize) {
+					if d.Pieces != nil {
+						// Wait for in-flight writes before hashing, then refetch anything corrupt
+						if int(queue.IdleWorkers()) != numConns {
+							continue
+						}
+						if d.requeueBadPieces(outFile, queue, fileSize) {
+							continue
+						}
+					}
 					queue.Close()
 					return
 				}
@@ -497,6 +537,18 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 		}(i)
 	}
 
+	// Checkpointer: persist progress so a crash resumes from the last checkpoint
+	checkpointCtx, stopCheckpoints := context.WithCancel(downloadCtx)
+	defer stopCheckpoints()
+	checkpointDone := make(chan bool, 1)
+	go func() {
+		if d.ID == "" {
+			checkpointDone <- false // No download row to keep up to date
+			return
+		}
+		checkpointDone <- d.runCheckpoints(checkpointCtx, queue, outFile, destPath, fileSize, candidateMirrors, startTime)
+	}()
+
 	// Wait for all workers to complete
 	go func() {
 		wg.Wait()
@@ -512,6 +564,10 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 		}
 	}
 
+	// No checkpoint may land after the pause state or the cleanup below
+	stopCheckpoints()
+	checkpointed := <-checkpointDone
+
 	// Handle pause: state saved
 	if d.State != nil && d.State.IsPaused() {
 		// 1. Collect active tasks as remaining work FIRST
@@ -536,35 +592,16 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 		computedDownloaded := fileSize - remainingBytes
 
 		// Calculate total elapsed time
-		var totalElapsed time.Duration
-		var chunkBitmap []byte
-		var actualChunkSize int64
-
+		totalElapsed := time.Since(startTime)
 		if d.State != nil {
-			totalElapsed = d.State.GetSavedElapsed() + time.Since(startTime)
-			// Get persisted bitmap data
-			bitmap, _, _, chunkSize, _ := d.State.GetBitmap()
-			chunkBitmap = bitmap
-			actualChunkSize = chunkSize
-			// Keep in-memory state aligned with the persisted snapshot.
-			d.State.FinalizePause(computedDownloaded, totalElapsed)
-		} else {
-			totalElapsed = time.Since(startTime)
+			totalElapsed += d.State.GetSavedElapsed()
 		}
 
 		// Save state for resume (use computed value for consistency)
-		s := &types.DownloadState{
-			URL:             d.URL,
-			ID:              d.ID,
-			DestPath:        destPath,
-			TotalSize:       fileSize,
-			Downloaded:      computedDownloaded,
-			Tasks:           remainingTasks,
-			Filename:        filepath.Base(destPath),
-			Elapsed:         totalElapsed.Nanoseconds(),
-			Mirrors:         candidateMirrors,
-			ChunkBitmap:     chunkBitmap,
-			ActualChunkSize: actualChunkSize,
+		s := d.resumeState(destPath, fileSize, computedDownloaded, remainingTasks, totalElapsed, candidateMirrors)
+		if d.State != nil {
+			// Keep in-memory state aligned with the persisted snapshot.
+			d.State.FinalizePause(computedDownloaded, totalElapsed)
 		}
 		if err := state.SaveState(d.URL, destPath, s); err != nil {
 			utils.Debug("Failed to save pause state: %v", err)
@@ -578,6 +615,10 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 	// Handle cancel: context was cancelled but not via Pause()
 	// Propagate cancellation so callers don't treat this as a successful completion.
 	if downloadCtx.Err() == context.Canceled {
+		// The download was removed; don't leave a checkpoint that would bring it back
+		if checkpointed {
+			_ = state.DeleteState(d.ID, d.URL, destPath)
+		}
 		return context.Canceled
 	}
 
@@ -585,6 +626,10 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 		return downloadErr
 	}
 
+	if err := d.fatalError(); err != nil {
+		return err
+	}
+
 	// Final sync
 	if err := outFile.Sync(); err != nil {
 		return fmt.Errorf("failed to sync file: %w", err)
@@ -593,6 +638,14 @@ func (d *ConcurrentDownloader) Download(ctx context.Context, rawurl string, cand
 	// Close file before renaming
 	_ = outFile.Close()
 
+	// Verify the finished file before it is exposed under its final name
+	if d.Checksum != "" {
+		if err := checksum.VerifyFile(workingPath, d.Checksum); err != nil {
+			_ = state.DeleteState(d.ID, d.URL, destPath)
+			return err
+		}
+	}
+
 	// Rename from .surge to final destination
 	if err := os.Rename(workingPath, destPath); err != nil {
 		// Check for race condition: did someone else already rename it?
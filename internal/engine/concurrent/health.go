@@ -4,6 +4,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/surge-downloader/surge/internal/engine/metrics"
 	"github.com/surge-downloader/surge/internal/utils"
 )
 
@@ -54,6 +55,7 @@ func (d *ConcurrentDownloader) checkWorkerHealth() {
 
 	// Second pass: check for slow and stalled workers
 	stallTimeout := d.Runtime.GetStallTimeout()
+	limited := d.bandwidthLimited()
 	for workerID, active := range d.activeTasks {
 
 		// timeSinceActivity := now.Sub(lastTime)
@@ -65,6 +67,11 @@ func (d *ConcurrentDownloader) checkWorkerHealth() {
 			continue
 		}
 
+		// A worker waiting on the bandwidth cap is idle by design
+		if atomic.LoadInt32(&active.Throttled) == 1 {
+			continue
+		}
+
 		// Check for absolute stall: no data received for StallTimeout
 		// This catches dead connections that the relative speed check misses
 		lastActivity := atomic.LoadInt64(&active.LastActivity)
@@ -73,6 +80,7 @@ func (d *ConcurrentDownloader) checkWorkerHealth() {
 			if timeSinceData >= stallTimeout {
 				utils.Debug("Health: Worker %d stalled (no data for %v), cancelling",
 					workerID, timeSinceData.Truncate(time.Millisecond))
+				metrics.WorkerStalls.Inc()
 				if active.Cancel != nil {
 					active.Cancel()
 				}
@@ -81,8 +89,9 @@ func (d *ConcurrentDownloader) checkWorkerHealth() {
 		}
 
 		// Check for slow worker (relative speed)
-		// Only cancel if: below threshold
-		if meanSpeed > 0 {
+		// Only cancel if: below threshold. Under a bandwidth cap speeds reflect
+		// the limiter, not the connection, so they are not compared.
+		if meanSpeed > 0 && !limited {
 			workerSpeed := active.GetSpeed()
 			threshold := d.Runtime.GetSlowWorkerThreshold()
 			isBelowThreshold := workerSpeed > 0 && workerSpeed < threshold*meanSpeed
@@ -90,6 +99,7 @@ func (d *ConcurrentDownloader) checkWorkerHealth() {
 			if isBelowThreshold {
 				utils.Debug("Health: Worker %d slow (%.2f KB/s vs mean %.2f KB/s), cancelling",
 					workerID, workerSpeed/1024, meanSpeed/1024)
+				metrics.SlowWorkers.Inc()
 				if active.Cancel != nil {
 					active.Cancel()
 				}
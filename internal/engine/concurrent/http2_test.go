@@ -0,0 +1,174 @@
+package concurrent
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/quic-go/quic-go/http3"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// tlsServer serves data over TLS with HTTP/2 enabled and counts TCP
+// connections and the protocol of each request
+type tlsServer struct {
+	*httptest.Server
+	conns atomic.Int64
+
+	mu     sync.Mutex
+	protos map[int]int // Requests by HTTP major version
+}
+
+func newTLSServer(t *testing.T, data []byte) *tlsServer {
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("tcp4 listener unavailable: %v", err)
+	}
+	s := &tlsServer{protos: make(map[int]int)}
+	handler := newDigestServer(data, false, func(int64) bool { return false })
+	s.Server = &httptest.Server{
+		Listener: ln,
+		Config: &http.Server{
+			Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				s.mu.Lock()
+				s.protos[r.ProtoMajor]++
+				s.mu.Unlock()
+				handler.ServeHTTP(w, r)
+			}),
+			ConnState: func(_ net.Conn, state http.ConnState) {
+				if state == http.StateNew {
+					s.conns.Add(1)
+				}
+			},
+		},
+		EnableHTTP2: true,
+	}
+	s.StartTLS()
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *tlsServer) requests(proto int) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.protos[proto]
+}
+
+func downloadOverTLS(t *testing.T, srv *tlsServer, runtime *types.RuntimeConfig, data []byte) {
+	t.Helper()
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	destPath := filepath.Join(tmpDir, "file.bin")
+	d := NewConcurrentDownloader("h2-id", nil, types.NewProgressState("h2-id", int64(len(data))), runtime)
+	d.tlsConfig = srv.Client().Transport.(*http.Transport).TLSClientConfig
+	if err := d.Download(context.Background(), srv.URL, nil, nil, destPath, int64(len(data))); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	got, err := os.ReadFile(destPath)
+	if err != nil || !bytes.Equal(got, data) {
+		t.Fatalf("downloaded file differs (err=%v)", err)
+	}
+}
+
+func TestConcurrentDownloader_HTTP2Multiplexed(t *testing.T) {
+	data := testPattern(8 * types.MB)
+	srv := newTLSServer(t, data)
+
+	downloadOverTLS(t, srv, &types.RuntimeConfig{
+		MinChunkSize:     512 * types.KB,
+		HTTP2Hosts:       []string{"127.0.0.1"},
+		HTTP2Connections: 1,
+	}, data)
+
+	if n := srv.requests(1); n != 0 {
+		t.Errorf("%d requests used HTTP/1.1, want all over HTTP/2", n)
+	}
+	if n := srv.requests(2); n < 2 {
+		t.Errorf("%d HTTP/2 requests, want parallel streams", n)
+	}
+	if n := srv.conns.Load(); n != 1 {
+		t.Errorf("%d TCP connections, want all streams on 1", n)
+	}
+}
+
+func TestConcurrentDownloader_HTTP1ByDefault(t *testing.T) {
+	data := testPattern(8 * types.MB)
+	srv := newTLSServer(t, data)
+
+	downloadOverTLS(t, srv, &types.RuntimeConfig{
+		MinChunkSize: 512 * types.KB,
+		HTTP2Hosts:   []string{"cdn.example.com"},
+	}, data)
+
+	if n := srv.requests(2); n != 0 {
+		t.Errorf("%d requests used HTTP/2 for an unlisted host", n)
+	}
+	if n := srv.conns.Load(); n < 2 {
+		t.Errorf("%d TCP connections, want one per worker", n)
+	}
+}
+
+// serveHTTP3 serves srv's handler over QUIC with its certificate and
+// returns the URL to reach it
+func serveHTTP3(t *testing.T, srv *tlsServer) string {
+	conn, err := net.ListenPacket("udp4", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("udp4 listener unavailable: %v", err)
+	}
+	h3 := &http3.Server{
+		Handler:   srv.Config.Handler,
+		TLSConfig: http3.ConfigureTLSConfig(&tls.Config{Certificates: srv.TLS.Certificates}),
+	}
+	go func() { _ = h3.Serve(conn) }()
+	t.Cleanup(func() {
+		_ = h3.Close()
+		_ = conn.Close()
+	})
+	return fmt.Sprintf("https://%s/", conn.LocalAddr())
+}
+
+func TestConcurrentDownloader_HTTP3(t *testing.T) {
+	data := testPattern(8 * types.MB)
+	srv := newTLSServer(t, data)
+	srv.URL = serveHTTP3(t, srv)
+
+	downloadOverTLS(t, srv, &types.RuntimeConfig{
+		MinChunkSize:     512 * types.KB,
+		HTTP2Hosts:       []string{"127.0.0.1"},
+		HTTP3Hosts:       []string{"127.0.0.1"},
+		HTTP2Connections: 1,
+	}, data)
+
+	if n := srv.requests(1) + srv.requests(2); n != 0 {
+		t.Errorf("%d requests used TCP, want all over HTTP/3", n)
+	}
+	if n := srv.requests(3); n < 2 {
+		t.Errorf("%d HTTP/3 requests, want parallel streams", n)
+	}
+}
+
+func TestConcurrentDownloader_HTTP3FallsBackToTCP(t *testing.T) {
+	data := testPattern(4 * types.MB)
+	srv := newTLSServer(t, data)
+
+	// Nothing answers over QUIC on the server's port
+	downloadOverTLS(t, srv, &types.RuntimeConfig{
+		MinChunkSize: 512 * types.KB,
+		HTTP3Hosts:   []string{"127.0.0.1"},
+	}, data)
+
+	if n := srv.requests(1); n == 0 {
+		t.Error("no requests fell back to HTTP/1.1")
+	}
+}
@@ -0,0 +1,87 @@
+package concurrent
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"net/http"
+
+	"github.com/surge-downloader/surge/internal/engine/checksum"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// errCorruptRange is returned by downloadTask when a range fails its integrity check
+var errCorruptRange = errors.New("range failed integrity check")
+
+// rangeVerifier hashes the body of a single range response and compares it
+// against the digest the server advertised for that body
+type rangeVerifier struct {
+	expected checksum.Checksum
+	hash     hash.Hash
+}
+
+// newRangeVerifier returns a verifier for the response body, or nil if the
+// server did not advertise a digest that covers exactly this body.
+// Content-Digest and Content-MD5 describe the bytes sent. Repr-Digest and
+// Digest describe the whole file, so they only apply to full-body responses.
+func newRangeVerifier(header http.Header, fullBody bool) *rangeVerifier {
+	var sums []checksum.Checksum
+	sums = append(sums, checksum.ParseHTTPDigest(header.Get("Content-Digest"))...)
+	if c, ok := checksum.ParseContentMD5(header.Get("Content-MD5")); ok {
+		sums = append(sums, c)
+	}
+	if fullBody {
+		sums = append(sums, checksum.ParseHTTPDigest(header.Get("Repr-Digest"))...)
+		sums = append(sums, checksum.ParseHTTPDigest(header.Get("Digest"))...)
+	}
+
+	expected, ok := checksum.Strongest(sums)
+	if !ok {
+		return nil
+	}
+	return &rangeVerifier{expected: expected, hash: checksum.New(expected.Algorithm)}
+}
+
+// Write feeds body bytes into the running hash
+func (v *rangeVerifier) Write(p []byte) {
+	_, _ = v.hash.Write(p)
+}
+
+// Verify compares the running hash against the advertised digest
+func (v *rangeVerifier) Verify(task types.Task) error {
+	actual := hex.EncodeToString(v.hash.Sum(nil))
+	if actual != v.expected.Hex {
+		return fmt.Errorf("%w: bytes %d-%d expected %s, got %s:%s",
+			errCorruptRange, task.Offset, task.Offset+task.Length-1, v.expected, v.expected.Algorithm, actual)
+	}
+	return nil
+}
+
+// recordCorruption counts integrity failures for a range and reports whether
+// it has exceeded the retry budget
+func (d *ConcurrentDownloader) recordCorruption(task types.Task) (exceeded bool) {
+	d.integrityMu.Lock()
+	defer d.integrityMu.Unlock()
+	if d.corruptRanges == nil {
+		d.corruptRanges = make(map[types.Task]int)
+	}
+	d.corruptRanges[task]++
+	return d.corruptRanges[task] > d.Runtime.GetMaxTaskRetries()
+}
+
+// fail records a fatal error that aborts the download once workers drain
+func (d *ConcurrentDownloader) fail(err error) {
+	d.integrityMu.Lock()
+	defer d.integrityMu.Unlock()
+	if d.fatalErr == nil {
+		d.fatalErr = err
+	}
+}
+
+// fatalError returns the first fatal error recorded by a worker
+func (d *ConcurrentDownloader) fatalError() error {
+	d.integrityMu.Lock()
+	defer d.integrityMu.Unlock()
+	return d.fatalErr
+}
@@ -0,0 +1,231 @@
+package concurrent
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/testutil"
+)
+
+// newDigestServer serves data with a Content-MD5 per range response when digest is set.
+// corrupt decides whether a response for the given range start should be mangled.
+func newDigestServer(data []byte, digest bool, corrupt func(start int64) bool) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		size := int64(len(data))
+		start, end := int64(0), size-1
+		if rh := r.Header.Get("Range"); rh != "" {
+			if _, err := fmt.Sscanf(rh, "bytes=%d-%d", &start, &end); err != nil {
+				http.Error(w, "bad range", http.StatusRequestedRangeNotSatisfiable)
+				return
+			}
+			if end >= size {
+				end = size - 1
+			}
+		}
+
+		body := data[start : end+1]
+		sum := md5.Sum(body)
+		if corrupt(start) {
+			body = bytes.Repeat([]byte{0xFF}, len(body))
+		}
+
+		w.Header().Set("Accept-Ranges", "bytes")
+		if digest {
+			w.Header().Set("Content-MD5", base64.StdEncoding.EncodeToString(sum[:]))
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		if r.Header.Get("Range") != "" {
+			w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, size))
+			w.WriteHeader(http.StatusPartialContent)
+		}
+		_, _ = w.Write(body)
+	})
+}
+
+func testPattern(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	return data
+}
+
+func TestConcurrentDownloader_RefetchesCorruptRange(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	fileSize := int64(256 * types.KB)
+	data := testPattern(int(fileSize))
+
+	// Corrupt only the first response for the range starting at 0
+	var firstRangeHits atomic.Int32
+	server := testutil.NewHTTPServerT(t, newDigestServer(data, true, func(start int64) bool {
+		return start == 0 && firstRangeHits.Add(1) == 1
+	}))
+	defer server.Close()
+
+	destPath := filepath.Join(tmpDir, "corrupt_range.bin")
+	progState := types.NewProgressState("corrupt-range", fileSize)
+	runtime := &types.RuntimeConfig{
+		MaxConnectionsPerHost: 4,
+		MinChunkSize:          32 * types.KB,
+	}
+	downloader := NewConcurrentDownloader("corrupt-range", nil, progState, runtime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := downloader.Download(ctx, server.URL, nil, nil, destPath, fileSize); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	got, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("downloaded file does not match source after refetch")
+	}
+	if downloaded := progState.Downloaded.Load(); downloaded != fileSize {
+		t.Errorf("Downloaded = %d, want %d (corrupt bytes must not be counted)", downloaded, fileSize)
+	}
+	if hits := firstRangeHits.Load(); hits < 2 {
+		t.Errorf("expected the corrupt range to be refetched, got %d requests for it", hits)
+	}
+}
+
+func TestConcurrentDownloader_GivesUpOnPersistentCorruption(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	fileSize := int64(128 * types.KB)
+	data := testPattern(int(fileSize))
+
+	server := testutil.NewHTTPServerT(t, newDigestServer(data, true, func(start int64) bool { return start == 0 }))
+	defer server.Close()
+
+	destPath := filepath.Join(tmpDir, "always_corrupt.bin")
+	progState := types.NewProgressState("always-corrupt", fileSize)
+	runtime := &types.RuntimeConfig{
+		MaxConnectionsPerHost: 2,
+		MinChunkSize:          32 * types.KB,
+		MaxTaskRetries:        2,
+	}
+	downloader := NewConcurrentDownloader("always-corrupt", nil, progState, runtime)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	err := downloader.Download(ctx, server.URL, nil, nil, destPath, fileSize)
+	if err == nil {
+		t.Fatal("expected download to fail on persistently corrupt range")
+	}
+	if !errors.Is(err, errCorruptRange) {
+		t.Errorf("expected errCorruptRange, got %v", err)
+	}
+	if _, statErr := os.Stat(destPath); !os.IsNotExist(statErr) {
+		t.Error("corrupt download should not be finalized")
+	}
+}
+
+func TestConcurrentDownloader_RefetchesCorruptPieces(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	fileSize := int64(256 * types.KB)
+	pieceLength := int64(16 * types.KB)
+	data := testPattern(int(fileSize))
+
+	pieces := &types.PieceHashes{Algorithm: "sha1", Length: pieceLength}
+	for off := int64(0); off < fileSize; off += pieceLength {
+		sum := sha1.Sum(data[off : off+pieceLength])
+		pieces.Hashes = append(pieces.Hashes, hex.EncodeToString(sum[:]))
+	}
+
+	// No server digest: the first response starting at 0 is silently corrupt
+	var firstRangeHits atomic.Int32
+	server := testutil.NewHTTPServerT(t, newDigestServer(data, false, func(start int64) bool {
+		return start == 0 && firstRangeHits.Add(1) == 1
+	}))
+	defer server.Close()
+
+	destPath := filepath.Join(tmpDir, "corrupt_pieces.bin")
+	progState := types.NewProgressState("corrupt-pieces", fileSize)
+	runtime := &types.RuntimeConfig{
+		MaxConnectionsPerHost: 4,
+		MinChunkSize:          32 * types.KB,
+	}
+	downloader := NewConcurrentDownloader("corrupt-pieces", nil, progState, runtime)
+	downloader.Pieces = pieces
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	if err := downloader.Download(ctx, server.URL, nil, nil, destPath, fileSize); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+
+	got, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("downloaded file does not match source after piece repair")
+	}
+	if hits := firstRangeHits.Load(); hits < 2 {
+		t.Errorf("expected corrupt pieces to be refetched, got %d requests from offset 0", hits)
+	}
+	if downloaded := progState.Downloaded.Load(); downloaded != fileSize {
+		t.Errorf("Downloaded = %d, want %d", downloaded, fileSize)
+	}
+}
+
+func TestConcurrentDownloader_PersistentPieceCorruption(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	fileSize := int64(128 * types.KB)
+	data := testPattern(int(fileSize))
+
+	pieces := &types.PieceHashes{Algorithm: "md5", Length: fileSize}
+	sum := md5.Sum(data)
+	pieces.Hashes = []string{hex.EncodeToString(sum[:])}
+
+	server := testutil.NewHTTPServerT(t, newDigestServer(data, false, func(start int64) bool { return start == 0 }))
+	defer server.Close()
+
+	destPath := filepath.Join(tmpDir, "bad_pieces.bin")
+	progState := types.NewProgressState("bad-pieces", fileSize)
+	runtime := &types.RuntimeConfig{
+		MaxConnectionsPerHost: 2,
+		MinChunkSize:          32 * types.KB,
+		MaxTaskRetries:        2,
+	}
+	downloader := NewConcurrentDownloader("bad-pieces", nil, progState, runtime)
+	downloader.Pieces = pieces
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	err := downloader.Download(ctx, server.URL, nil, nil, destPath, fileSize)
+	if !errors.Is(err, types.ErrChecksumMismatch) {
+		t.Fatalf("expected ErrChecksumMismatch, got %v", err)
+	}
+	if _, statErr := os.Stat(destPath); !os.IsNotExist(statErr) {
+		t.Error("corrupt download should not be finalized")
+	}
+}
@@ -0,0 +1,49 @@
+package concurrent
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/surge-downloader/surge/internal/engine/checksum"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// requeueBadPieces verifies the working file against the expected piece hashes
+// and pushes corrupt pieces back onto the queue. Reports whether work was queued.
+func (d *ConcurrentDownloader) requeueBadPieces(file *os.File, queue *TaskQueue, fileSize int64) bool {
+	bad, err := checksum.VerifyPieces(file, fileSize, d.Pieces)
+	if err != nil {
+		d.fail(fmt.Errorf("piece verification failed: %w", err))
+		return false
+	}
+	if len(bad) == 0 {
+		return false
+	}
+
+	d.integrityMu.Lock()
+	d.repairPasses++
+	passes := d.repairPasses
+	d.integrityMu.Unlock()
+
+	if passes > d.Runtime.GetMaxTaskRetries() {
+		d.fail(fmt.Errorf("%w: %d pieces still corrupt after %d repair passes", types.ErrChecksumMismatch, len(bad), passes-1))
+		return false
+	}
+
+	var badBytes int64
+	for _, task := range bad {
+		badBytes += task.Length
+		if d.State != nil {
+			d.State.UpdateChunkStatus(task.Offset, task.Length, types.ChunkPending)
+		}
+	}
+	if d.State != nil {
+		d.State.Downloaded.Add(-badBytes)
+	}
+
+	utils.Debug("Piece verification: refetching %d corrupt pieces (%s), pass %d",
+		len(bad), utils.ConvertBytesToHumanReadable(badBytes), passes)
+	queue.PushMultiple(bad)
+	return true
+}
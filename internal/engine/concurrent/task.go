@@ -28,6 +28,12 @@ type ActiveTask struct {
 
 	// Hedged request tracking
 	Hedged int32 // Atomic: 1 if an idle worker is already racing this task
+
+	// Integrity tracking
+	Verifying int32 // Atomic: 1 if the range is being hashed against a server digest (not stealable)
+
+	// Bandwidth limiting
+	Throttled int32 // Atomic: 1 while the worker is waiting on a rate limiter
 }
 
 // RemainingBytes returns the number of bytes left for this task
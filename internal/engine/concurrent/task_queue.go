@@ -14,11 +14,12 @@ type TaskQueue struct {
 	mu          sync.Mutex
 	cond        *sync.Cond
 	done        bool
-	idleWorkers int64 // Atomic counter for idle workers
+	idleWorkers int64              // Atomic counter for idle workers
+	claimed     map[int]types.Task // Tasks taken by Claim and not yet released, by worker
 }
 
 func NewTaskQueue() *TaskQueue {
-	tq := &TaskQueue{}
+	tq := &TaskQueue{claimed: make(map[int]types.Task)}
 	tq.cond = sync.NewCond(&tq.mu)
 	return tq
 }
@@ -41,6 +42,24 @@ func (q *TaskQueue) PushMultiple(tasks []types.Task) {
 }
 
 func (q *TaskQueue) Pop() (types.Task, bool) {
+	return q.pop(-1)
+}
+
+// Claim pops a task for a worker and keeps it on record until Release, so a
+// Snapshot still counts it while the worker is between attempts or has not
+// registered it as active yet.
+func (q *TaskQueue) Claim(workerID int) (types.Task, bool) {
+	return q.pop(workerID)
+}
+
+// Release drops the worker's claim once its task is done or pushed back
+func (q *TaskQueue) Release(workerID int) {
+	q.mu.Lock()
+	delete(q.claimed, workerID)
+	q.mu.Unlock()
+}
+
+func (q *TaskQueue) pop(workerID int) (types.Task, bool) {
 	// Mark as idle while waiting
 	atomic.AddInt64(&q.idleWorkers, 1)
 
@@ -66,6 +85,9 @@ func (q *TaskQueue) Pop() (types.Task, bool) {
 		q.tasks = q.tasks[q.head:]
 		q.head = 0
 	}
+	if workerID >= 0 {
+		q.claimed[workerID] = t
+	}
 	return t, true
 }
 
@@ -86,6 +108,19 @@ func (q *TaskQueue) IdleWorkers() int64 {
 	return atomic.LoadInt64(&q.idleWorkers)
 }
 
+// Snapshot returns copies of the queued tasks and the claimed ones, leaving the queue as is
+func (q *TaskQueue) Snapshot() ([]types.Task, map[int]types.Task) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	pending := append([]types.Task(nil), q.tasks[q.head:]...)
+	claimed := make(map[int]types.Task, len(q.claimed))
+	for id, t := range q.claimed {
+		claimed[id] = t
+	}
+	return pending, claimed
+}
+
 // DrainRemaining returns all remaining tasks in the queue (used for pause/resume)
 func (q *TaskQueue) DrainRemaining() []types.Task {
 	q.mu.Lock()
@@ -85,6 +85,41 @@ func TestTaskQueue_DrainRemaining(t *testing.T) {
 	}
 }
 
+func TestTaskQueue_ClaimSnapshot(t *testing.T) {
+	q := NewTaskQueue()
+	q.PushMultiple([]types.Task{
+		{Offset: 0, Length: 100},
+		{Offset: 100, Length: 100},
+	})
+
+	got, ok := q.Claim(3)
+	if !ok || got.Offset != 0 {
+		t.Fatalf("Claim = %+v, %v", got, ok)
+	}
+
+	pending, claimed := q.Snapshot()
+	if len(pending) != 1 || pending[0].Offset != 100 {
+		t.Errorf("pending = %+v, want the unclaimed task", pending)
+	}
+	if c, ok := claimed[3]; !ok || c != got {
+		t.Errorf("claimed = %+v, want worker 3 holding %+v", claimed, got)
+	}
+	if q.Len() != 1 {
+		t.Errorf("Snapshot should leave the queue as is, Len = %d", q.Len())
+	}
+
+	q.Release(3)
+	if _, claimed := q.Snapshot(); len(claimed) != 0 {
+		t.Errorf("claimed after Release = %+v", claimed)
+	}
+
+	// Pop takes work without a claim
+	q.Pop()
+	if _, claimed := q.Snapshot(); len(claimed) != 0 {
+		t.Errorf("Pop left a claim: %+v", claimed)
+	}
+}
+
 func TestAlignedSplitSize(t *testing.T) {
 	tests := []struct {
 		remaining int64
@@ -0,0 +1,39 @@
+package concurrent
+
+import (
+	"context"
+	"sync/atomic"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/ratelimit"
+)
+
+// bandwidthLimited reports whether the global or per-download cap is in effect
+func (d *ConcurrentDownloader) bandwidthLimited() bool {
+	return ratelimit.Global().Limited() || d.Limiter.Limited()
+}
+
+// readSize caps a read so a single read stays short under the active caps
+func (d *ConcurrentDownloader) readSize(n int) int {
+	return d.Limiter.ChunkSize(ratelimit.Global().ChunkSize(n))
+}
+
+// throttle blocks until the global and per-download caps allow n more bytes.
+// The task is marked throttled while waiting so the health monitor does not
+// mistake the wait for a stalled connection.
+func (d *ConcurrentDownloader) throttle(ctx context.Context, activeTask *ActiveTask, n int) error {
+	if !d.bandwidthLimited() {
+		return nil
+	}
+
+	atomic.StoreInt32(&activeTask.Throttled, 1)
+	defer func() {
+		atomic.StoreInt64(&activeTask.LastActivity, time.Now().UnixNano())
+		atomic.StoreInt32(&activeTask.Throttled, 0)
+	}()
+
+	if err := ratelimit.Global().WaitN(ctx, n); err != nil {
+		return err
+	}
+	return d.Limiter.WaitN(ctx, n)
+}
@@ -0,0 +1,92 @@
+package concurrent
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/ratelimit"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/testutil"
+)
+
+func TestConcurrentDownloader_RateLimit(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	fileSize := int64(256 * types.KB)
+	data := testPattern(int(fileSize))
+
+	server := testutil.NewHTTPServerT(t, newDigestServer(data, false, func(int64) bool { return false }))
+	defer server.Close()
+
+	destPath := filepath.Join(tmpDir, "limited.bin")
+	progState := types.NewProgressState("limited", fileSize)
+	runtime := &types.RuntimeConfig{
+		MaxConnectionsPerHost: 4,
+		MinChunkSize:          32 * types.KB,
+	}
+	downloader := NewConcurrentDownloader("limited", nil, progState, runtime)
+	// All four connections share 512KB/s, so 256KB needs about half a second
+	downloader.Limiter = ratelimit.New(512 * types.KB)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+
+	start := time.Now()
+	if err := downloader.Download(ctx, server.URL, nil, nil, destPath, fileSize); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	elapsed := time.Since(start)
+
+	if elapsed < 350*time.Millisecond {
+		t.Errorf("download finished in %v, limit of 512KB/s not enforced", elapsed)
+	}
+
+	got, err := os.ReadFile(destPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("rate-limited download does not match source")
+	}
+}
+
+func TestConcurrentDownloader_RateLimitRaisedLive(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	fileSize := int64(256 * types.KB)
+	data := testPattern(int(fileSize))
+
+	server := testutil.NewHTTPServerT(t, newDigestServer(data, false, func(int64) bool { return false }))
+	defer server.Close()
+
+	destPath := filepath.Join(tmpDir, "raised.bin")
+	progState := types.NewProgressState("raised", fileSize)
+	runtime := &types.RuntimeConfig{
+		MaxConnectionsPerHost: 2,
+		MinChunkSize:          32 * types.KB,
+	}
+	downloader := NewConcurrentDownloader("raised", nil, progState, runtime)
+	// At 8KB/s this would take over 30 seconds
+	downloader.Limiter = ratelimit.New(8 * types.KB)
+
+	go func() {
+		time.Sleep(200 * time.Millisecond)
+		downloader.Limiter.SetRate(0)
+	}()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := downloader.Download(ctx, server.URL, nil, nil, destPath, fileSize); err != nil {
+		t.Fatalf("Download failed after removing the limit: %v", err)
+	}
+	if downloaded := progState.Downloaded.Load(); downloaded != fileSize {
+		t.Errorf("Downloaded = %d, want %d", downloaded, fileSize)
+	}
+}
@@ -0,0 +1,108 @@
+package concurrent
+
+import (
+	"crypto/tls"
+	"net/http"
+	"sync"
+	"sync/atomic"
+
+	"github.com/quic-go/quic-go/http3"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// hostRouter picks the transport for each request by host. Hosts listed in
+// HTTP2Hosts share a few multiplexed HTTP/2 connections, one stream per
+// worker, for CDNs that throttle each TCP connection but allow many streams.
+// Hosts listed in HTTP3Hosts do the same over QUIC connections. Everything
+// else gets one HTTP/1.1 connection per worker.
+type hostRouter struct {
+	http1   *http.Transport
+	http2   []*http.Transport  // Each pinned to one connection per host
+	http3   []*http3.Transport // Each keeps one QUIC connection per host
+	runtime *types.RuntimeConfig
+	next    atomic.Uint32
+
+	noHTTP3 sync.Map // Hosts that failed over QUIC, fetched over TCP from then on
+}
+
+// newHostRouter wraps base, the HTTP/1.1 transport, adding HTTP/2 and HTTP/3
+// transports when any host is configured for them
+func newHostRouter(base *http.Transport, runtime *types.RuntimeConfig) http.RoundTripper {
+	if runtime == nil || (len(runtime.HTTP2Hosts) == 0 && len(runtime.HTTP3Hosts) == 0) {
+		return base
+	}
+
+	r := &hostRouter{http1: base, runtime: runtime}
+	for i := 0; i < runtime.GetHTTP2Connections(); i++ {
+		if len(runtime.HTTP2Hosts) > 0 {
+			t := base.Clone()
+			t.ForceAttemptHTTP2 = true
+			t.TLSNextProto = nil // Let net/http set up HTTP/2 over TLS
+			t.MaxConnsPerHost = 1
+			t.MaxIdleConnsPerHost = 1
+			r.http2 = append(r.http2, t)
+		}
+		if len(runtime.HTTP3Hosts) > 0 {
+			tlsConfig := &tls.Config{}
+			if base.TLSClientConfig != nil {
+				tlsConfig = base.TLSClientConfig.Clone()
+			}
+			r.http3 = append(r.http3, &http3.Transport{
+				TLSClientConfig:    tlsConfig,
+				DisableCompression: base.DisableCompression,
+			})
+		}
+	}
+	return r
+}
+
+// RoundTrip spreads multiplexed requests across the pinned connections in
+// turn. HTTP/2 and HTTP/3 are only negotiated over TLS, so plain http://
+// hosts stay on HTTP/1.1. HTTP/3 is skipped behind a proxy, which can't carry
+// QUIC, and for hosts that didn't answer over it.
+func (r *hostRouter) RoundTrip(req *http.Request) (*http.Response, error) {
+	host := req.URL.Hostname()
+	if req.URL.Scheme == "https" && r.useHTTP3(req) {
+		t := r.http3[int(r.next.Add(1)-1)%len(r.http3)]
+		resp, err := t.RoundTrip(req)
+		if err == nil || req.Context().Err() != nil || (req.Body != nil && req.Body != http.NoBody) {
+			return resp, err
+		}
+		utils.Debug("HTTP/3 to %s failed, falling back to TCP: %v", host, err)
+		r.noHTTP3.Store(host, true)
+	}
+	if req.URL.Scheme == "https" && r.runtime.UseHTTP2(host) {
+		t := r.http2[int(r.next.Add(1)-1)%len(r.http2)]
+		return t.RoundTrip(req)
+	}
+	return r.http1.RoundTrip(req)
+}
+
+func (r *hostRouter) useHTTP3(req *http.Request) bool {
+	host := req.URL.Hostname()
+	if !r.runtime.UseHTTP3(host) {
+		return false
+	}
+	if _, failed := r.noHTTP3.Load(host); failed {
+		return false
+	}
+	if r.http1.Proxy != nil {
+		if proxy, err := r.http1.Proxy(req); err != nil || proxy != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// CloseIdleConnections closes idle connections on every transport
+func (r *hostRouter) CloseIdleConnections() {
+	r.http1.CloseIdleConnections()
+	for _, t := range r.http2 {
+		t.CloseIdleConnections()
+	}
+	for _, t := range r.http3 {
+		t.CloseIdleConnections()
+	}
+}
@@ -0,0 +1,70 @@
+package concurrent
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/testutil"
+)
+
+// versionedServer serves data with an ETag; http.ServeContent applies If-Range
+func versionedServer(data []byte, etag string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", etag)
+		http.ServeContent(w, r, "data.bin", time.Time{}, bytes.NewReader(data))
+	})
+}
+
+func TestConcurrentDownloader_IfRangeMatch(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	fileSize := int64(256 * types.KB)
+	data := testPattern(int(fileSize))
+	server := testutil.NewHTTPServerT(t, versionedServer(data, `"v1"`))
+	defer server.Close()
+
+	destPath := filepath.Join(tmpDir, "same.bin")
+	runtime := &types.RuntimeConfig{MaxConnectionsPerHost: 4, MinChunkSize: 32 * types.KB}
+	downloader := NewConcurrentDownloader("same", nil, types.NewProgressState("same", fileSize), runtime)
+	downloader.Validators = types.Validators{ETag: `"v1"`}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := downloader.Download(ctx, server.URL, nil, nil, destPath, fileSize); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+}
+
+func TestConcurrentDownloader_RemoteChanged(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	// Large enough to be split into ranges; a single full-file request may take a 200
+	fileSize := int64(4 * types.MB)
+	data := testPattern(int(fileSize))
+	// The server now has a different version than the one being downloaded
+	server := testutil.NewHTTPServerT(t, versionedServer(data, `"v2"`))
+	defer server.Close()
+
+	destPath := filepath.Join(tmpDir, "changed.bin")
+	runtime := &types.RuntimeConfig{MaxConnectionsPerHost: 4, MinChunkSize: 32 * types.KB}
+	downloader := NewConcurrentDownloader("changed", nil, types.NewProgressState("changed", fileSize), runtime)
+	downloader.Validators = types.Validators{ETag: `"v1"`}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	err := downloader.Download(ctx, server.URL, nil, nil, destPath, fileSize)
+	if !errors.Is(err, types.ErrRemoteChanged) {
+		t.Fatalf("expected ErrRemoteChanged, got %v", err)
+	}
+	if testutil.FileExists(destPath) {
+		t.Error("final file must not exist when the remote changed")
+	}
+}
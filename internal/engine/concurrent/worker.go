@@ -2,6 +2,7 @@ package concurrent
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -9,6 +10,7 @@ import (
 	"sync/atomic"
 	"time"
 
+	"github.com/surge-downloader/surge/internal/engine/metrics"
 	"github.com/surge-downloader/surge/internal/engine/types"
 	"github.com/surge-downloader/surge/internal/utils"
 )
@@ -28,7 +30,7 @@ func (d *ConcurrentDownloader) worker(ctx context.Context, id int, mirrors []str
 
 	for {
 		// Get next task
-		task, ok := queue.Pop()
+		task, ok := queue.Claim(id)
 
 		if !ok {
 			return nil // Queue closed, no more work
@@ -43,6 +45,7 @@ func (d *ConcurrentDownloader) worker(ctx context.Context, id int, mirrors []str
 		maxRetries := d.Runtime.GetMaxTaskRetries()
 		for attempt := 0; attempt < maxRetries; attempt++ {
 			if attempt > 0 {
+				metrics.WorkerRetries.Inc()
 
 				if len(mirrors) == 1 {
 					time.Sleep(time.Duration(1<<attempt) * types.RetryBaseDelay) // Exponential backoff incase of failure
@@ -138,6 +141,32 @@ func (d *ConcurrentDownloader) worker(ctx context.Context, id int, mirrors []str
 			delete(d.activeTasks, id)
 			d.activeMu.Unlock()
 
+			// Corrupted range: nothing from it was counted, so requeue the whole range
+			// and let the next worker fetch it from a different mirror
+			if errors.Is(lastErr, errCorruptRange) {
+				utils.Debug("Worker %d: %v (mirror %s)", id, lastErr, currentURL)
+				d.ReportMirrorError(currentURL)
+				currentMirrorIdx = (currentMirrorIdx + 1) % len(mirrors)
+
+				if d.recordCorruption(task) {
+					d.fail(fmt.Errorf("giving up after repeated corruption: %w", lastErr))
+					queue.Close()
+				} else {
+					queue.Push(task)
+				}
+				lastErr = nil
+				break
+			}
+
+			// Remote file changed: no range of it can be combined with what we have
+			if errors.Is(lastErr, types.ErrRemoteChanged) {
+				utils.Debug("Worker %d: %v", id, lastErr)
+				d.fail(lastErr)
+				queue.Close()
+				lastErr = nil
+				break
+			}
+
 			if lastErr == nil {
 				// Check if we stopped early due to stealing
 				stopAt := atomic.LoadInt64(&activeTask.StopAt)
@@ -170,57 +199,37 @@ func (d *ConcurrentDownloader) worker(ctx context.Context, id int, mirrors []str
 			queue.Push(task)
 			utils.Debug("task at offset %d failed after %d retries: %v", task.Offset, maxRetries, lastErr)
 		}
+		queue.Release(id)
 	}
 }
 
 // downloadTask downloads a single byte range and writes to file at offset
 func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string, file *os.File, activeTask *ActiveTask, buf []byte, client *http.Client, totalSize int64) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
-	if err != nil {
-		return err
-	}
-
 	task := activeTask.Task
 
-	// Apply custom headers first (from browser extension: cookies, auth, referer, etc.)
-	for key, val := range d.Headers {
-		// Skip Range header - we set it ourselves for parallel downloads
-		if key != "Range" {
-			req.Header.Set(key, val)
-		}
+	var (
+		body     io.ReadCloser
+		verifier *rangeVerifier
+		err      error
+	)
+	if d.Source != nil {
+		body, err = d.Source.OpenRange(ctx, task.Offset, task.Length)
+	} else {
+		body, verifier, err = d.openHTTPRange(ctx, rawurl, task, client, totalSize)
 	}
-
-	// Set User-Agent from config only if not provided in custom headers
-	if req.Header.Get("User-Agent") == "" {
-		req.Header.Set("User-Agent", d.Runtime.GetUserAgent())
-	}
-	// Range header is always set for partial downloads (overrides any browser Range header)
-	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", task.Offset, task.Offset+task.Length-1))
-
-	resp, err := client.Do(req)
 	if err != nil {
 		return err
 	}
 	defer func() {
-		if err := resp.Body.Close(); err != nil {
+		if err := body.Close(); err != nil {
 			utils.Debug("Error closing response body: %v", err)
 		}
 	}()
 
-	// Handle rate limiting explicitly
-	if resp.StatusCode == http.StatusTooManyRequests {
-		return fmt.Errorf("rate limited (429)")
-	}
-
-	// Validate status code
-	if resp.StatusCode == http.StatusOK {
-		// Valid only if we requested the full file
-		// If we wanted a partial range but got the whole file (200), that's an error because we can't handle the full stream at a non-zero offset
-		if task.Offset != 0 || task.Length != totalSize {
-			return fmt.Errorf("server indicated success (200) but ignored range request (expected 206)")
-		}
-	} else if resp.StatusCode != http.StatusPartialContent {
-		return fmt.Errorf("unexpected status: %d", resp.StatusCode)
+	// With a digest, progress is held back until it matches so a corrupt range is never counted.
+	keep := verifier == nil
+	if verifier != nil {
+		atomic.StoreInt32(&activeTask.Verifying, 1)
 	}
 
 	// Batching State
@@ -244,8 +253,15 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 			lastUpdate = time.Now()
 		}
 	}
-	// Ensure we flush whatever we have on exit
-	defer flushUpdates()
+	// Ensure we flush whatever we have on exit. Unverified bytes are discarded
+	// and the offset rewound so the whole range is fetched again.
+	defer func() {
+		if keep {
+			flushUpdates()
+			return
+		}
+		atomic.StoreInt64(&activeTask.CurrentOffset, task.Offset)
+	}()
 
 	// Read and write at offset
 	offset := task.Offset
@@ -254,6 +270,7 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 		stopAt := atomic.LoadInt64(&activeTask.StopAt)
 		if offset >= stopAt {
 			// Stealing happened, stop here
+			keep = true
 			return nil
 		}
 
@@ -263,10 +280,11 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 		// Limit by remaining length to stopAt
 		remaining := stopAt - offset
 		if remaining <= 0 {
+			keep = true
 			return nil
 		}
 
-		readSize := int64(len(buf))
+		readSize := int64(d.readSize(len(buf)))
 		if readSize > remaining {
 			readSize = remaining
 		}
@@ -275,7 +293,7 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 		var readErr error
 
 		for readSoFar < int(readSize) {
-			n, err := resp.Body.Read(buf[readSoFar:readSize])
+			n, err := body.Read(buf[readSoFar:readSize])
 			if n > 0 {
 				readSoFar += n
 			}
@@ -297,10 +315,15 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 			if offset+int64(readSoFar) > currentStopAt {
 				readSoFar = int(currentStopAt - offset)
 				if readSoFar <= 0 {
+					keep = true
 					return nil // stolen completely
 				}
 			}
 
+			if verifier != nil {
+				verifier.Write(buf[:readSoFar])
+			}
+
 			_, writeErr := file.WriteAt(buf[:readSoFar], offset)
 			if writeErr != nil {
 				return fmt.Errorf("write error: %w", writeErr)
@@ -311,6 +334,7 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 			offset += int64(readSoFar)
 			atomic.StoreInt64(&activeTask.CurrentOffset, offset)
 			atomic.AddInt64(&activeTask.WindowBytes, int64(readSoFar))
+			metrics.BytesDownloaded.Add(int64(readSoFar))
 			atomic.StoreInt64(&activeTask.LastActivity, now.UnixNano())
 
 			// Calculate effective contribution (clamping to StopAt is done above via readSoFar truncation)
@@ -322,7 +346,7 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 			pendingBytes += int64(readSoFar)
 
 			// Check thresholds
-			if pendingBytes >= batchSizeThreshold || now.Sub(lastUpdate) >= batchTimeThreshold {
+			if verifier == nil && (pendingBytes >= batchSizeThreshold || now.Sub(lastUpdate) >= batchTimeThreshold) {
 				flushUpdates()
 			}
 
@@ -352,11 +376,93 @@ func (d *ConcurrentDownloader) downloadTask(ctx context.Context, rawurl string,
 		if readErr != nil {
 			return fmt.Errorf("read error: %w", readErr)
 		}
+
+		// Hold the connection back while over the bandwidth cap
+		if err := d.throttle(ctx, activeTask, readSoFar); err != nil {
+			return err
+		}
 	}
 
+	if verifier != nil {
+		if offset < task.Offset+task.Length {
+			if offset < atomic.LoadInt64(&activeTask.StopAt) {
+				return fmt.Errorf("read error: %w", io.ErrUnexpectedEOF)
+			}
+			// Range was split while in flight; the digest covers bytes we didn't fetch
+			utils.Debug("Range %d-%d split during verification, accepting unverified", task.Offset, offset)
+		} else if err := verifier.Verify(task); err != nil {
+			return err
+		}
+	}
+
+	keep = true
 	return nil
 }
 
+// openHTTPRange requests task from rawurl and checks the response covers it.
+// If the server advertised a digest for the body, the returned verifier hashes it as it arrives.
+func (d *ConcurrentDownloader) openHTTPRange(ctx context.Context, rawurl string, task types.Task, client *http.Client, totalSize int64) (io.ReadCloser, *rangeVerifier, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Apply custom headers first (from browser extension: cookies, auth, referer, etc.)
+	for key, val := range d.Headers {
+		// Skip Range header - we set it ourselves for parallel downloads
+		if key != "Range" {
+			req.Header.Set(key, val)
+		}
+	}
+
+	// Set User-Agent from config only if not provided in custom headers
+	if req.Header.Get("User-Agent") == "" {
+		req.Header.Set("User-Agent", d.Runtime.GetUserAgent())
+	}
+	// Range header is always set for partial downloads (overrides any browser Range header)
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", task.Offset, task.Offset+task.Length-1))
+	// Mirrors have their own validators, so only the primary URL is pinned to a version
+	ifRange := ""
+	if rawurl == d.URL {
+		ifRange = d.Validators.IfRange()
+	}
+	if ifRange != "" {
+		req.Header.Set("If-Range", ifRange)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, nil, err
+	}
+	fail := func(err error) (io.ReadCloser, *rangeVerifier, error) {
+		_ = resp.Body.Close()
+		return nil, nil, err
+	}
+
+	// Handle rate limiting explicitly
+	if resp.StatusCode == http.StatusTooManyRequests {
+		return fail(fmt.Errorf("rate limited (429)"))
+	}
+
+	// Validate status code
+	fullBody := resp.StatusCode == http.StatusOK
+	if resp.StatusCode == http.StatusOK {
+		// Valid only if we requested the full file
+		// If we wanted a partial range but got the whole file (200), that's an error because we can't handle the full stream at a non-zero offset
+		if task.Offset != 0 || task.Length != totalSize {
+			if ifRange != "" {
+				// If-Range failed: the server is sending a different version of the file
+				return fail(fmt.Errorf("%w: %s no longer matches", types.ErrRemoteChanged, ifRange))
+			}
+			return fail(fmt.Errorf("server indicated success (200) but ignored range request (expected 206)"))
+		}
+	} else if resp.StatusCode != http.StatusPartialContent {
+		return fail(fmt.Errorf("unexpected status: %d", resp.StatusCode))
+	}
+
+	return resp.Body, newRangeVerifier(resp.Header, fullBody), nil
+}
+
 // StealWork tries to split an active task from a busy worker
 // It greedily targets the worker with the MOST remaining work.
 func (d *ConcurrentDownloader) StealWork(queue *TaskQueue) bool {
@@ -369,6 +475,10 @@ func (d *ConcurrentDownloader) StealWork(queue *TaskQueue) bool {
 
 	// Find the worker with the MOST remaining work
 	for id, active := range d.activeTasks {
+		// Splitting a verified range would leave its digest uncheckable
+		if atomic.LoadInt32(&active.Verifying) != 0 {
+			continue
+		}
 		remaining := active.RemainingBytes()
 		if remaining > types.MinChunk && remaining > maxRemaining {
 			maxRemaining = remaining
@@ -38,16 +38,48 @@ type DownloadErrorMsg struct {
 	Err        error
 }
 
+// Error codes carried alongside the error string so that well-known
+// failures survive the JSON round trip to remote clients.
+const (
+	ErrorCodeChecksumMismatch = "checksum_mismatch"
+)
+
+// codedErrors maps error codes back to their sentinel errors
+var codedErrors = map[string]error{
+	ErrorCodeChecksumMismatch: types.ErrChecksumMismatch,
+}
+
+// Code returns the well-known error code for this message, if any
+func (m DownloadErrorMsg) Code() string {
+	for code, sentinel := range codedErrors {
+		if errors.Is(m.Err, sentinel) {
+			return code
+		}
+	}
+	return ""
+}
+
+// decodedError preserves a sentinel error across JSON decoding
+type decodedError struct {
+	msg   string
+	cause error
+}
+
+func (e *decodedError) Error() string { return e.msg }
+func (e *decodedError) Unwrap() error { return e.cause }
+
 func (m DownloadErrorMsg) MarshalJSON() ([]byte, error) {
 	type encoded struct {
 		DownloadID string `json:"DownloadID"`
 		Filename   string `json:"Filename,omitempty"`
 		Err        string `json:"Err,omitempty"`
+		Code       string `json:"Code,omitempty"`
 	}
 
 	out := encoded{
 		DownloadID: m.DownloadID,
 		Filename:   m.Filename,
+		Code:       m.Code(),
 	}
 	if m.Err != nil {
 		out.Err = m.Err.Error()
@@ -61,6 +93,7 @@ func (m *DownloadErrorMsg) UnmarshalJSON(data []byte) error {
 		DownloadID string          `json:"DownloadID"`
 		Filename   string          `json:"Filename"`
 		Err        json.RawMessage `json:"Err"`
+		Code       string          `json:"Code"`
 	}
 	if err := json.Unmarshal(data, &aux); err != nil {
 		return err
@@ -78,7 +111,11 @@ func (m *DownloadErrorMsg) UnmarshalJSON(data []byte) error {
 	var errStr string
 	if err := json.Unmarshal(aux.Err, &errStr); err == nil {
 		if errStr != "" {
-			m.Err = errors.New(errStr)
+			if sentinel, ok := codedErrors[aux.Code]; ok {
+				m.Err = &decodedError{msg: errStr, cause: sentinel}
+			} else {
+				m.Err = errors.New(errStr)
+			}
 		}
 		return nil
 	}
@@ -98,6 +135,7 @@ type DownloadStartedMsg struct {
 	Filename   string
 	Total      int64
 	DestPath   string               // Full path to the destination file
+	Category   string               // Category the download was sorted into
 	State      *types.ProgressState `json:"-"`
 }
 
@@ -122,6 +160,32 @@ type DownloadRemovedMsg struct {
 	Filename   string
 }
 
+// ExtractProgressMsg reports how far the extraction of a finished archive has got
+type ExtractProgressMsg struct {
+	DownloadID string
+	Filename   string
+	Extracted  int64 // Bytes done so far
+	Total      int64 // 0 if unknown
+}
+
+// ExtractDoneMsg signals that extraction of a finished archive has ended
+type ExtractDoneMsg struct {
+	DownloadID string
+	Filename   string
+	Dir        string // Directory the files were extracted into
+	Files      int
+	Err        string `json:",omitempty"` // Empty on success
+}
+
+// MirrorDoneMsg signals that every file of a site mirror has finished or failed
+type MirrorDoneMsg struct {
+	MirrorID string // Download ID of the mirror's first page
+	URL      string
+	Index    string // Local copy of the first page
+	Files    int
+	Failed   int
+}
+
 // BatchProgressMsg represents a batch of progress updates to reduce TUI render calls
 type BatchProgressMsg []ProgressMsg
 
@@ -134,4 +198,37 @@ type DownloadRequestMsg struct {
 	Path     string
 	Mirrors  []string
 	Headers  map[string]string
+	Options  types.DownloadOptions
+}
+
+// Name returns the event type used on the SSE stream and in webhooks,
+// or "" for messages without one
+func Name(msg interface{}) string {
+	switch msg.(type) {
+	case DownloadStartedMsg:
+		return "started"
+	case DownloadCompleteMsg:
+		return "complete"
+	case DownloadErrorMsg:
+		return "error"
+	case ProgressMsg:
+		return "progress"
+	case DownloadPausedMsg:
+		return "paused"
+	case DownloadResumedMsg:
+		return "resumed"
+	case DownloadQueuedMsg:
+		return "queued"
+	case DownloadRemovedMsg:
+		return "removed"
+	case DownloadRequestMsg:
+		return "request"
+	case ExtractProgressMsg:
+		return "extract_progress"
+	case ExtractDoneMsg:
+		return "extract_done"
+	case MirrorDoneMsg:
+		return "mirror_done"
+	}
+	return ""
 }
@@ -1,11 +1,14 @@
 package events
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"reflect"
 	"testing"
 	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
 )
 
 func TestDownloadPausedMsg_Creation(t *testing.T) {
@@ -140,6 +143,52 @@ func TestDownloadErrorMsg_ChannelCommunication(t *testing.T) {
 	}
 }
 
+func TestDownloadErrorMsg_ChecksumMismatchRoundTrip(t *testing.T) {
+	sent := DownloadErrorMsg{
+		DownloadID: "checksum-error",
+		Filename:   "file.iso",
+		Err:        fmt.Errorf("%w: expected sha256:aa, got sha256:bb", types.ErrChecksumMismatch),
+	}
+
+	data, err := json.Marshal(sent)
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	var received DownloadErrorMsg
+	if err := json.Unmarshal(data, &received); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+
+	if !errors.Is(received.Err, types.ErrChecksumMismatch) {
+		t.Errorf("Decoded error should wrap ErrChecksumMismatch, got %v", received.Err)
+	}
+	if received.Err.Error() != sent.Err.Error() {
+		t.Errorf("Error message = %q, want %q", received.Err.Error(), sent.Err.Error())
+	}
+	if received.Code() != ErrorCodeChecksumMismatch {
+		t.Errorf("Code = %q, want %q", received.Code(), ErrorCodeChecksumMismatch)
+	}
+}
+
+func TestDownloadErrorMsg_PlainErrorHasNoCode(t *testing.T) {
+	data, err := json.Marshal(DownloadErrorMsg{DownloadID: "plain", Err: errors.New("boom")})
+	if err != nil {
+		t.Fatalf("Marshal failed: %v", err)
+	}
+
+	var received DownloadErrorMsg
+	if err := json.Unmarshal(data, &received); err != nil {
+		t.Fatalf("Unmarshal failed: %v", err)
+	}
+	if received.Code() != "" {
+		t.Errorf("Expected no code, got %q", received.Code())
+	}
+	if errors.Is(received.Err, types.ErrChecksumMismatch) {
+		t.Error("Plain error should not match ErrChecksumMismatch")
+	}
+}
+
 // =============================================================================
 // Edge Cases and Special Characters
 // =============================================================================
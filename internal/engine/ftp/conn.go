@@ -0,0 +1,92 @@
+// Package ftp reads files from FTP and FTPS servers. When the server
+// supports REST, ranges start at an offset on their own connections so the
+// concurrent downloader can fetch several parts of the file at once.
+package ftp
+
+import (
+	"context"
+	"crypto/tls"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	goftp "github.com/jlaffaye/ftp"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// Schemes handled by this package. "ftps" is implicit TLS (port 990),
+// "ftpes" upgrades a plain connection with AUTH TLS (port 21).
+var Schemes = map[string]bool{"ftp": true, "ftps": true, "ftpes": true}
+
+const (
+	// MaxConnections caps parallel connections; many FTP servers limit logins per client
+	MaxConnections = 4
+
+	// shutTimeout bounds the wait for the end-of-transfer reply on the control connection
+	shutTimeout = 10 * time.Second
+
+	anonymousUser     = "anonymous"
+	anonymousPassword = "anonymous@"
+)
+
+// IsFTP reports whether rawurl uses one of the FTP schemes
+func IsFTP(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	return err == nil && Schemes[strings.ToLower(u.Scheme)]
+}
+
+// dial connects and logs in. Credentials come from the URL, defaulting to anonymous.
+// ctx bounds the connection attempt only.
+func dial(ctx context.Context, u *url.URL) (*goftp.ServerConn, error) {
+	scheme := strings.ToLower(u.Scheme)
+	port := u.Port()
+	if port == "" {
+		port = "21"
+		if scheme == "ftps" {
+			port = "990"
+		}
+	}
+	addr := net.JoinHostPort(u.Hostname(), port)
+
+	opts := []goftp.DialOption{
+		goftp.DialWithContext(ctx),
+		goftp.DialWithTimeout(types.DialTimeout),
+		goftp.DialWithShutTimeout(shutTimeout),
+	}
+	tlsConfig := &tls.Config{ServerName: u.Hostname()}
+	switch scheme {
+	case "ftps":
+		opts = append(opts, goftp.DialWithTLS(tlsConfig))
+	case "ftpes":
+		opts = append(opts, goftp.DialWithExplicitTLS(tlsConfig))
+	}
+
+	c, err := goftp.Dial(addr, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("ftp connect failed: %w", err)
+	}
+
+	user, password := anonymousUser, anonymousPassword
+	if u.User != nil {
+		user = u.User.Username()
+		if p, ok := u.User.Password(); ok {
+			password = p
+		}
+	}
+	if err := c.Login(user, password); err != nil {
+		_ = c.Quit()
+		return nil, fmt.Errorf("ftp login failed: %w", err)
+	}
+	return c, nil
+}
+
+// remotePath returns the file path on the server for u
+func remotePath(u *url.URL) string {
+	if u.Path == "" {
+		return "/"
+	}
+	return u.Path
+}
@@ -0,0 +1,469 @@
+package ftp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/concurrent"
+	"github.com/surge-downloader/surge/internal/engine/single"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/testutil"
+)
+
+func initTestState(t *testing.T) (string, func()) {
+	state.CloseDB() // Ensure any previous DB is closed
+
+	tmpDir, cleanup, err := testutil.TempDir("surge-ftp-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+
+	return tmpDir, func() {
+		state.CloseDB()
+		cleanup()
+	}
+}
+
+// fakeServer is a minimal FTP server serving one file over EPSV data connections
+type fakeServer struct {
+	data      []byte
+	modTime   time.Time
+	noRest    bool          // Reject REST like a server without resume support
+	delay     time.Duration // Pause between 4KB writes
+	dropAfter int64         // Abort the first transfer after this many bytes, 0 = never
+
+	ln net.Listener
+
+	mu      sync.Mutex
+	active  int // Logged-in sessions
+	peak    int // Most sessions logged in at once
+	logins  int
+	retrs   int
+	offsets []int64
+}
+
+func newFakeServer(t *testing.T, data []byte) *fakeServer {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	s := &fakeServer{data: data, modTime: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), ln: ln}
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	t.Cleanup(func() { _ = ln.Close() })
+	return s
+}
+
+func (s *fakeServer) URL(path string) string {
+	return "ftp://" + s.ln.Addr().String() + path
+}
+
+func (s *fakeServer) serve(conn net.Conn) {
+	defer func() { _ = conn.Close() }()
+
+	var (
+		dataLn net.Listener
+		offset int64
+	)
+	defer func() {
+		if dataLn != nil {
+			_ = dataLn.Close()
+		}
+	}()
+
+	reply := func(format string, args ...any) {
+		_, _ = fmt.Fprintf(conn, format+"\r\n", args...)
+	}
+	reply("220 fake ftp")
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd, arg, _ := strings.Cut(strings.TrimSpace(line), " ")
+
+		switch strings.ToUpper(cmd) {
+		case "USER":
+			reply("331 password required")
+		case "PASS":
+			s.mu.Lock()
+			s.active++
+			s.logins++
+			s.peak = max(s.peak, s.active)
+			s.mu.Unlock()
+			defer func() {
+				s.mu.Lock()
+				s.active--
+				s.mu.Unlock()
+			}()
+			reply("230 logged in")
+		case "FEAT":
+			reply("211-Features:\r\n MDTM\r\n SIZE\r\n REST STREAM\r\n211 End")
+		case "TYPE":
+			reply("200 type set")
+		case "SIZE":
+			reply("213 %d", len(s.data))
+		case "MDTM":
+			reply("213 %s", s.modTime.Format("20060102150405"))
+		case "EPSV":
+			if dataLn != nil {
+				_ = dataLn.Close()
+			}
+			if dataLn, err = net.Listen("tcp", "127.0.0.1:0"); err != nil {
+				reply("425 can't open data connection")
+				continue
+			}
+			reply("229 Entering Extended Passive Mode (|||%d|)", dataLn.Addr().(*net.TCPAddr).Port)
+		case "REST":
+			if s.noRest {
+				reply("502 command not implemented")
+				continue
+			}
+			offset, _ = strconv.ParseInt(arg, 10, 64)
+			reply("350 restarting at %d", offset)
+		case "RETR":
+			if dataLn == nil {
+				reply("425 use EPSV first")
+				continue
+			}
+			reply("150 opening data connection")
+			if s.send(dataLn, offset) {
+				reply("226 transfer complete")
+			} else {
+				reply("426 transfer aborted")
+			}
+			_ = dataLn.Close()
+			dataLn, offset = nil, 0
+		case "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 command not implemented")
+		}
+	}
+}
+
+// send writes the file from offset over one data connection and reports whether it finished
+func (s *fakeServer) send(dataLn net.Listener, offset int64) bool {
+	dc, err := dataLn.Accept()
+	if err != nil {
+		return false
+	}
+	defer func() { _ = dc.Close() }()
+
+	s.mu.Lock()
+	s.retrs++
+	first := s.retrs == 1
+	s.offsets = append(s.offsets, offset)
+	s.mu.Unlock()
+
+	for pos := offset; pos < int64(len(s.data)); pos += 4096 {
+		if first && s.dropAfter > 0 && pos-offset >= s.dropAfter {
+			return false
+		}
+		end := min(pos+4096, int64(len(s.data)))
+		if _, err := dc.Write(s.data[pos:end]); err != nil {
+			return false
+		}
+		if s.delay > 0 {
+			time.Sleep(s.delay)
+		}
+	}
+	return true
+}
+
+func (s *fakeServer) stats() (peak int, offsets []int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.peak, append([]int64(nil), s.offsets...)
+}
+
+func (s *fakeServer) loginCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.logins
+}
+
+func testData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i * 7 % 251)
+	}
+	return data
+}
+
+func assertFile(t *testing.T, path string, want []byte) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read downloaded file: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("downloaded file differs: got %d bytes, want %d", len(got), len(want))
+	}
+}
+
+func TestIsFTP(t *testing.T) {
+	tests := map[string]bool{
+		"ftp://example.com/file.iso":       true,
+		"FTPS://example.com/file.iso":      true,
+		"ftpes://user:pw@example.com/file": true,
+		"http://example.com/file.iso":      false,
+		"sftp://example.com/file.iso":      false,
+		"not a url":                        false,
+	}
+	for rawurl, want := range tests {
+		if got := IsFTP(rawurl); got != want {
+			t.Errorf("IsFTP(%q) = %v, want %v", rawurl, got, want)
+		}
+	}
+}
+
+func TestProbe(t *testing.T) {
+	srv := newFakeServer(t, testData(300*1024))
+
+	r, err := Probe(context.Background(), srv.URL("/pub/file.bin"))
+	if err != nil {
+		t.Fatalf("Probe failed: %v", err)
+	}
+	if r.FileSize != int64(len(srv.data)) || r.Filename != "file.bin" || !r.SupportsRest {
+		t.Errorf("Probe = %+v, want size %d, file.bin, REST", r, len(srv.data))
+	}
+	if want := "Tue, 02 Jan 2024 03:04:05 GMT"; r.LastModified() != want {
+		t.Errorf("LastModified = %q, want %q", r.LastModified(), want)
+	}
+
+	srv = newFakeServer(t, testData(300*1024))
+	srv.noRest = true
+	r, err = Probe(context.Background(), srv.URL("/pub/file.bin"))
+	if err != nil {
+		t.Fatalf("Probe failed: %v", err)
+	}
+	if r.SupportsRest {
+		t.Error("SupportsRest should be false when REST is rejected")
+	}
+}
+
+func TestCapConnections(t *testing.T) {
+	if got := CapConnections(&types.RuntimeConfig{MaxConnectionsPerHost: 32}).MaxConnectionsPerHost; got != MaxConnections {
+		t.Errorf("capped = %d, want %d", got, MaxConnections)
+	}
+	if got := CapConnections(&types.RuntimeConfig{MaxConnectionsPerHost: 2}).MaxConnectionsPerHost; got != 2 {
+		t.Errorf("lower limit = %d, want it kept", got)
+	}
+}
+
+func readRange(t *testing.T, src *Source, offset, length int64) ([]byte, error) {
+	t.Helper()
+	r, err := src.OpenRange(context.Background(), offset, length)
+	if err != nil {
+		t.Fatalf("OpenRange(%d, %d) failed: %v", offset, length, err)
+	}
+	defer func() { _ = r.Close() }()
+	return io.ReadAll(r)
+}
+
+func TestSource_OpenRange(t *testing.T) {
+	srv := newFakeServer(t, testData(300*1024))
+	src, err := NewSource(srv.URL("/file.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = src.Close() }()
+	size := int64(len(srv.data))
+
+	got, err := readRange(t, src, 1000, 5000)
+	if err != nil || !bytes.Equal(got, srv.data[1000:6000]) {
+		t.Fatalf("range 1000+5000 = %d bytes, %v", len(got), err)
+	}
+
+	// Ranges running to the end of the file close cleanly and share a login
+	logins := srv.loginCount()
+	for i := 0; i < 2; i++ {
+		got, err = readRange(t, src, size-5000, 5000)
+		if err != nil || !bytes.Equal(got, srv.data[size-5000:]) {
+			t.Fatalf("last 5000 bytes = %d bytes, %v", len(got), err)
+		}
+	}
+	if n := srv.loginCount() - logins; n > 1 {
+		t.Errorf("%d logins for two ranges, want the connection reused", n)
+	}
+	if _, offsets := srv.stats(); offsets[0] != 1000 || offsets[len(offsets)-1] != size-5000 {
+		t.Errorf("transfers started at %v", offsets)
+	}
+}
+
+func TestSource_ShortTransfer(t *testing.T) {
+	srv := newFakeServer(t, testData(300*1024))
+	srv.dropAfter = 64 * 1024
+	src, err := NewSource(srv.URL("/file.bin"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = src.Close() }()
+
+	got, err := readRange(t, src, 0, 200*1024)
+	if !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("transfer cut at %d bytes: err = %v, want io.ErrUnexpectedEOF", len(got), err)
+	}
+}
+
+func TestConcurrentDownload_OverFTP(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	srv := newFakeServer(t, testData(16*1024*1024+123))
+	rawurl := srv.URL("/file.bin")
+	src, err := NewSource(rawurl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = src.Close() }()
+
+	destPath := filepath.Join(tmpDir, "file.bin")
+	size := int64(len(srv.data))
+	d := concurrent.NewConcurrentDownloader("ftp-id", nil, types.NewProgressState("ftp-id", size), CapConnections(&types.RuntimeConfig{}))
+	d.Source = src
+	if err := d.Download(context.Background(), rawurl, nil, nil, destPath, size); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	assertFile(t, destPath, srv.data)
+
+	if peak, offsets := srv.stats(); peak < 2 || peak > MaxConnections || len(offsets) < 2 {
+		t.Errorf("peak connections = %d, transfers at %v; want parallel ranges within %d", peak, offsets, MaxConnections)
+	}
+}
+
+func TestConcurrentDownload_ReconnectsAfterDrop(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	srv := newFakeServer(t, testData(256*1024))
+	srv.dropAfter = 100 * 1024
+	rawurl := srv.URL("/file.bin")
+	src, err := NewSource(rawurl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = src.Close() }()
+
+	destPath := filepath.Join(tmpDir, "file.bin")
+	size := int64(len(srv.data))
+	d := concurrent.NewConcurrentDownloader("ftp-id", nil, types.NewProgressState("ftp-id", size), CapConnections(&types.RuntimeConfig{}))
+	d.Source = src
+	if err := d.Download(context.Background(), rawurl, nil, nil, destPath, size); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	assertFile(t, destPath, srv.data)
+
+	if _, offsets := srv.stats(); len(offsets) != 2 || offsets[0] != 0 || offsets[1] != srv.dropAfter {
+		t.Errorf("expected a fresh transfer then REST %d, got offsets %v", srv.dropAfter, offsets)
+	}
+}
+
+func TestConcurrentDownload_PauseAndResume(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	srv := newFakeServer(t, testData(4*1024*1024))
+	srv.delay = time.Millisecond
+	destPath := filepath.Join(tmpDir, "file.bin")
+	rawurl := srv.URL("/file.bin")
+	size := int64(len(srv.data))
+	runtime := CapConnections(&types.RuntimeConfig{MinChunkSize: 1024 * 1024})
+
+	src, err := NewSource(rawurl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	st := types.NewProgressState("ftp-id", size)
+	d := concurrent.NewConcurrentDownloader("ftp-id", nil, st, runtime)
+	d.Source = src
+	go func() {
+		for st.Downloaded.Load() < 256*1024 {
+			time.Sleep(time.Millisecond)
+		}
+		st.Pause()
+	}()
+
+	err = d.Download(context.Background(), rawurl, nil, nil, destPath, size)
+	_ = src.Close()
+	if !errors.Is(err, types.ErrPaused) {
+		t.Fatalf("expected ErrPaused, got %v", err)
+	}
+
+	saved, err := state.LoadState(rawurl, destPath)
+	if err != nil {
+		t.Fatalf("pause state not saved: %v", err)
+	}
+	if len(saved.Tasks) == 0 || saved.Downloaded <= 0 || saved.Downloaded >= size {
+		t.Fatalf("saved state = %d tasks, %d bytes; want partial progress", len(saved.Tasks), saved.Downloaded)
+	}
+
+	// Resume with new connections, as after a restart
+	src, err = NewSource(rawurl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = src.Close() }()
+	d = concurrent.NewConcurrentDownloader("ftp-id", nil, types.NewProgressState("ftp-id", size), runtime)
+	d.Source = src
+	if err := d.Download(context.Background(), rawurl, nil, nil, destPath, size); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+	assertFile(t, destPath, srv.data)
+
+	if _, err := state.LoadState(rawurl, destPath); err == nil {
+		t.Error("state should be deleted after completion")
+	}
+}
+
+func TestSingleDownload_NoRest(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	srv := newFakeServer(t, testData(1024*1024))
+	srv.noRest = true
+	rawurl := srv.URL("/file.bin")
+	src, err := NewSource(rawurl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer func() { _ = src.Close() }()
+
+	destPath := filepath.Join(tmpDir, "file.bin")
+	d := single.NewSingleDownloader("ftp-id", nil, types.NewProgressState("ftp-id", 0), &types.RuntimeConfig{})
+	d.Client = &http.Client{Transport: src}
+	if err := d.Download(context.Background(), rawurl, destPath, int64(len(srv.data)), "file.bin"); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	assertFile(t, destPath, srv.data)
+
+	if peak, offsets := srv.stats(); peak != 1 || len(offsets) != 1 {
+		t.Errorf("expected one connection and one transfer, got %d connections, offsets %v", peak, offsets)
+	}
+}
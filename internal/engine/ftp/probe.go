@@ -0,0 +1,87 @@
+package ftp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// ProbeResult describes a remote file
+type ProbeResult struct {
+	FileSize     int64     // From SIZE, 0 if the server doesn't report it
+	ModTime      time.Time // From MDTM, zero if unsupported
+	SupportsRest bool      // Transfers can start at an offset, so the file can be segmented and resumed
+	Filename     string
+}
+
+// LastModified formats ModTime like an HTTP Last-Modified header, or "" if unknown
+func (r *ProbeResult) LastModified() string {
+	if r.ModTime.IsZero() {
+		return ""
+	}
+	return r.ModTime.UTC().Format(http.TimeFormat)
+}
+
+// Probe logs in and asks the server for the size and modification time of the file.
+// REST support is checked by starting a one-byte transfer near the end of the file.
+func Probe(ctx context.Context, rawurl string) (*ProbeResult, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ftp url: %w", err)
+	}
+
+	c, err := dial(ctx, u)
+	if err != nil {
+		return nil, err
+	}
+	// Closing the control connection unblocks any command waiting on the server
+	stop := context.AfterFunc(ctx, func() { _ = c.Quit() })
+	defer func() {
+		if stop() {
+			_ = c.Quit()
+		}
+	}()
+
+	remote := remotePath(u)
+	result := &ProbeResult{Filename: path.Base(remote)}
+
+	if size, err := c.FileSize(remote); err == nil {
+		result.FileSize = size
+	} else {
+		utils.Debug("FTP SIZE failed for %s: %v", remote, err)
+	}
+	if c.IsGetTimeSupported() {
+		if t, err := c.GetTime(remote); err == nil {
+			result.ModTime = t
+		}
+	}
+
+	if result.FileSize > 1 {
+		resp, err := c.RetrFrom(remote, uint64(result.FileSize-1))
+		if err == nil {
+			_, err = io.ReadFull(resp, make([]byte, 1))
+			_ = resp.Close()
+		}
+		result.SupportsRest = err == nil
+		if err != nil {
+			utils.Debug("FTP REST not supported for %s: %v", remote, err)
+		}
+	} else if result.FileSize == 0 {
+		// Without SIZE the file can't be segmented; make sure it exists at all
+		resp, err := c.Retr(remote)
+		if err != nil {
+			return nil, fmt.Errorf("ftp retrieve failed: %w", err)
+		}
+		_ = resp.Close()
+	}
+
+	utils.Debug("FTP probe complete - filename: %s, size: %d, rest: %v",
+		result.Filename, result.FileSize, result.SupportsRest)
+	return result, nil
+}
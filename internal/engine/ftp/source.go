@@ -0,0 +1,195 @@
+package ftp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	goftp "github.com/jlaffaye/ftp"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// Source reads one remote file over FTP. It implements
+// concurrent.RangeSource, starting each range with REST on a logged-in
+// connection. Connections are kept for the next range when the server
+// closes a transfer cleanly.
+type Source struct {
+	url  *url.URL
+	path string
+
+	mu     sync.Mutex
+	idle   []*goftp.ServerConn
+	closed bool
+}
+
+// NewSource returns a source for the file in rawurl. Connections are made
+// when ranges are opened.
+func NewSource(rawurl string) (*Source, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ftp url: %w", err)
+	}
+	return &Source{url: u, path: remotePath(u)}, nil
+}
+
+// CapConnections returns a copy of runtime with connections limited to MaxConnections
+func CapConnections(runtime *types.RuntimeConfig) *types.RuntimeConfig {
+	capped := types.RuntimeConfig{}
+	if runtime != nil {
+		capped = *runtime
+	}
+	if capped.GetMaxConnectionsPerHost() > MaxConnections {
+		capped.MaxConnectionsPerHost = MaxConnections
+	}
+	return &capped
+}
+
+// OpenRange starts a transfer at offset and returns a reader for length bytes
+func (s *Source) OpenRange(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	return s.retrieve(ctx, offset, length)
+}
+
+// RoundTrip answers a GET for the file with the whole file, ignoring Range.
+// It lets the single downloader stream from a server without REST support.
+func (s *Source) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return nil, fmt.Errorf("ftp: unsupported method %s", req.Method)
+	}
+	r, err := s.retrieve(req.Context(), 0, -1)
+	if err != nil {
+		return nil, err
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        make(http.Header),
+		Body:          r,
+		ContentLength: -1,
+		Request:       req,
+	}, nil
+}
+
+// retrieve starts a transfer at offset on a pooled or new connection.
+// length is -1 to read to the end of the file.
+func (s *Source) retrieve(ctx context.Context, offset, length int64) (*rangeReader, error) {
+	c, err := s.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Closing the connections fails any command or read waiting on the server
+	var resp atomic.Pointer[goftp.Response]
+	stop := context.AfterFunc(ctx, func() {
+		if r := resp.Load(); r != nil {
+			_ = r.SetDeadline(time.Now())
+		}
+		_ = c.Quit()
+	})
+
+	r, err := c.RetrFrom(s.path, uint64(offset))
+	if err != nil {
+		if stop() {
+			_ = c.Quit()
+		}
+		return nil, fmt.Errorf("ftp retrieve at offset %d failed: %w", offset, err)
+	}
+	resp.Store(r)
+	if err := ctx.Err(); err != nil {
+		// Cancelled before the response could be interrupted
+		_ = r.SetDeadline(time.Now())
+	}
+	return &rangeReader{src: s, conn: c, resp: r, stop: stop, left: length}, nil
+}
+
+// get returns an idle connection or logs in a new one
+func (s *Source) get(ctx context.Context) (*goftp.ServerConn, error) {
+	s.mu.Lock()
+	if n := len(s.idle); n > 0 {
+		c := s.idle[n-1]
+		s.idle = s.idle[:n-1]
+		s.mu.Unlock()
+		return c, nil
+	}
+	s.mu.Unlock()
+	return dial(ctx, s.url)
+}
+
+// put keeps c for the next range, or logs out once the source is closed
+func (s *Source) put(c *goftp.ServerConn) {
+	s.mu.Lock()
+	if !s.closed {
+		s.idle = append(s.idle, c)
+		c = nil
+	}
+	s.mu.Unlock()
+	if c != nil {
+		_ = c.Quit()
+	}
+}
+
+// Close logs out of the idle connections. Ranges still open are logged out
+// when they are closed.
+func (s *Source) Close() error {
+	s.mu.Lock()
+	idle := s.idle
+	s.idle, s.closed = nil, true
+	s.mu.Unlock()
+
+	for _, c := range idle {
+		_ = c.Quit()
+	}
+	return nil
+}
+
+// rangeReader reads one transfer and returns its connection to the pool when done
+type rangeReader struct {
+	src  *Source
+	conn *goftp.ServerConn
+	resp *goftp.Response
+	stop func() bool
+	left int64 // Bytes still to read, -1 for the rest of the file
+}
+
+// Read reads up to the end of the range. A transfer closed before then is
+// reported as io.ErrUnexpectedEOF, so the range is fetched again.
+func (r *rangeReader) Read(p []byte) (int, error) {
+	if r.left == 0 {
+		return 0, io.EOF
+	}
+	if r.left > 0 && int64(len(p)) > r.left {
+		p = p[:r.left]
+	}
+	n, err := r.resp.Read(p)
+	if r.left > 0 {
+		r.left -= int64(n)
+		if err == io.EOF && r.left > 0 {
+			err = io.ErrUnexpectedEOF
+		}
+	}
+	return n, err
+}
+
+// Close ends the transfer. Stopping before the end of the file aborts it,
+// and servers differ in how they report that, so the connection is only
+// reused after a clean close.
+func (r *rangeReader) Close() error {
+	if !r.stop() {
+		_ = r.resp.Close()
+		return nil // Cancelled; the connection is already closed
+	}
+	if err := r.resp.Close(); err != nil {
+		_ = r.conn.Quit()
+		return nil
+	}
+	r.src.put(r.conn)
+	return nil
+}
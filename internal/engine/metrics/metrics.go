@@ -0,0 +1,179 @@
+// Package metrics keeps process-wide engine counters and writes them, with
+// any other samples, in the Prometheus text exposition format.
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Counter is a value that only goes up
+type Counter struct {
+	v atomic.Int64
+}
+
+// Add increases the counter by n. Negative values are ignored.
+func (c *Counter) Add(n int64) {
+	if n > 0 {
+		c.v.Add(n)
+	}
+}
+
+// Inc increases the counter by one
+func (c *Counter) Inc() {
+	c.v.Add(1)
+}
+
+// Value returns the current count
+func (c *Counter) Value() int64 {
+	return c.v.Load()
+}
+
+// Histogram counts observations into cumulative buckets
+type Histogram struct {
+	mu      sync.Mutex
+	bounds  []float64 // Upper bounds, ascending
+	buckets []uint64  // Observations <= each bound
+	count   uint64
+	sum     float64
+}
+
+// NewHistogram creates a histogram with the given ascending upper bounds.
+// The +Inf bucket is implicit.
+func NewHistogram(bounds ...float64) *Histogram {
+	return &Histogram{bounds: bounds, buckets: make([]uint64, len(bounds))}
+}
+
+// Observe records one value
+func (h *Histogram) Observe(v float64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	for i, b := range h.bounds {
+		if v <= b {
+			h.buckets[i]++
+		}
+	}
+	h.count++
+	h.sum += v
+}
+
+// ObserveSince records the seconds elapsed since start
+func (h *Histogram) ObserveSince(start time.Time) {
+	h.Observe(time.Since(start).Seconds())
+}
+
+// Engine counters, shared by every download in the process
+var (
+	// BytesDownloaded counts bytes received and written by all downloaders
+	BytesDownloaded = &Counter{}
+	// WorkerRetries counts ranges fetched again after a failed attempt
+	WorkerRetries = &Counter{}
+	// WorkerStalls counts workers cancelled by the health monitor for receiving nothing
+	WorkerStalls = &Counter{}
+	// SlowWorkers counts workers cancelled by the health monitor for being slow
+	SlowWorkers = &Counter{}
+	// MirrorFailures counts mirrors found failing, by a probe or during a download
+	MirrorFailures = &Counter{}
+	// ProbeLatency is how long server probes take, in seconds
+	ProbeLatency = NewHistogram(0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10)
+)
+
+// Sample is one value of a metric with its labels
+type Sample struct {
+	Labels map[string]string
+	Value  float64
+}
+
+// WriteCounter writes a counter metric
+func WriteCounter(w io.Writer, name, help string, value float64) {
+	writeHeader(w, name, help, "counter")
+	writeSample(w, name, nil, value)
+}
+
+// WriteGauge writes a gauge metric with one or more samples
+func WriteGauge(w io.Writer, name, help string, samples ...Sample) {
+	writeHeader(w, name, help, "gauge")
+	for _, s := range samples {
+		writeSample(w, name, s.Labels, s.Value)
+	}
+}
+
+// WriteHistogram writes h as a histogram metric
+func WriteHistogram(w io.Writer, name, help string, h *Histogram) {
+	h.mu.Lock()
+	bounds := h.bounds
+	buckets := append([]uint64(nil), h.buckets...)
+	count, sum := h.count, h.sum
+	h.mu.Unlock()
+
+	writeHeader(w, name, help, "histogram")
+	for i, b := range bounds {
+		writeSample(w, name+"_bucket", map[string]string{"le": formatValue(b)}, float64(buckets[i]))
+	}
+	writeSample(w, name+"_bucket", map[string]string{"le": "+Inf"}, float64(count))
+	writeSample(w, name+"_sum", nil, sum)
+	writeSample(w, name+"_count", nil, float64(count))
+}
+
+// WriteEngine writes the engine counters
+func WriteEngine(w io.Writer) {
+	WriteCounter(w, "surge_downloaded_bytes_total", "Bytes received and written by all downloads.", float64(BytesDownloaded.Value()))
+	WriteCounter(w, "surge_worker_retries_total", "Ranges fetched again after a failed attempt.", float64(WorkerRetries.Value()))
+	WriteCounter(w, "surge_worker_stalls_total", "Workers cancelled for receiving no data.", float64(WorkerStalls.Value()))
+	WriteCounter(w, "surge_slow_worker_cancellations_total", "Workers cancelled for being much slower than the others.", float64(SlowWorkers.Value()))
+	WriteCounter(w, "surge_mirror_failures_total", "Mirrors found failing by a probe or during a download.", float64(MirrorFailures.Value()))
+	WriteHistogram(w, "surge_probe_duration_seconds", "Time taken to probe a server before downloading.", ProbeLatency)
+}
+
+func writeHeader(w io.Writer, name, help, kind string) {
+	_, _ = fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, escapeHelp(help), name, kind)
+}
+
+func writeSample(w io.Writer, name string, labels map[string]string, value float64) {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		keys := make([]string, 0, len(labels))
+		for k := range labels {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		b.WriteByte('{')
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(k)
+			b.WriteString(`="`)
+			b.WriteString(escapeLabel(labels[k]))
+			b.WriteByte('"')
+		}
+		b.WriteByte('}')
+	}
+	b.WriteByte(' ')
+	b.WriteString(formatValue(value))
+	b.WriteByte('\n')
+	_, _ = io.WriteString(w, b.String())
+}
+
+func formatValue(v float64) string {
+	if math.IsInf(v, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram(0.1, 1)
+	for _, v := range []float64{0.05, 0.5, 0.7, 3} {
+		h.Observe(v)
+	}
+
+	var buf bytes.Buffer
+	WriteHistogram(&buf, "probe_seconds", "Probe time.", h)
+	want := `# HELP probe_seconds Probe time.
+# TYPE probe_seconds histogram
+probe_seconds_bucket{le="0.1"} 1
+probe_seconds_bucket{le="1"} 3
+probe_seconds_bucket{le="+Inf"} 4
+probe_seconds_sum 4.25
+probe_seconds_count 4
+`
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestWriteGauge_Labels(t *testing.T) {
+	var buf bytes.Buffer
+	WriteGauge(&buf, "conns", "Connections\nby host.",
+		Sample{Labels: map[string]string{"host": `a"b\c`, "kind": "x"}, Value: 3},
+		Sample{Value: 1.5},
+	)
+	want := `# HELP conns Connections\nby host.
+# TYPE conns gauge
+conns{host="a\"b\\c",kind="x"} 3
+conns 1.5
+`
+	if buf.String() != want {
+		t.Errorf("got:\n%s\nwant:\n%s", buf.String(), want)
+	}
+}
+
+func TestCounter_IgnoresNegative(t *testing.T) {
+	var c Counter
+	c.Add(5)
+	c.Add(-3)
+	c.Inc()
+	if c.Value() != 6 {
+		t.Errorf("Value() = %d, want 6", c.Value())
+	}
+}
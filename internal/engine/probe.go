@@ -10,6 +10,10 @@ import (
 	"sync"
 	"time"
 
+	"github.com/surge-downloader/surge/internal/engine/checksum"
+	"github.com/surge-downloader/surge/internal/engine/ftp"
+	"github.com/surge-downloader/surge/internal/engine/metrics"
+	"github.com/surge-downloader/surge/internal/engine/sftp"
 	"github.com/surge-downloader/surge/internal/engine/types"
 	"github.com/surge-downloader/surge/internal/utils"
 )
@@ -24,12 +28,19 @@ type ProbeResult struct {
 	SupportsRange bool
 	Filename      string
 	ContentType   string
+	Checksum      string           // Whole-file digest advertised by the server ("algo:hex"), if any
+	Validators    types.Validators // ETag and Last-Modified of the probed version
 }
 
 // ProbeServer sends GET with Range: bytes=0-0 to determine server capabilities
 // headers is optional - pass nil for non-authenticated probes
 func ProbeServer(ctx context.Context, rawurl string, filenameHint string, headers map[string]string) (*ProbeResult, error) {
 	utils.Debug("Probing server: %s", rawurl)
+	defer metrics.ProbeLatency.ObserveSince(time.Now())
+
+	if ftp.IsFTP(rawurl) {
+		return probeFTP(ctx, rawurl, filenameHint)
+	}
 
 	var resp *http.Response
 	var err error
@@ -169,6 +180,17 @@ func ProbeServer(ctx context.Context, rawurl string, filenameHint string, header
 	}
 
 	result.ContentType = resp.Header.Get("Content-Type")
+	result.Validators = types.Validators{
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+	}
+
+	// Repr-Digest and Digest describe the full representation regardless of Range
+	sums := checksum.ParseHTTPDigest(resp.Header.Get("Repr-Digest"))
+	sums = append(sums, checksum.ParseHTTPDigest(resp.Header.Get("Digest"))...)
+	if c, ok := checksum.Strongest(sums); ok {
+		result.Checksum = c.String()
+	}
 
 	utils.Debug("Probe complete - filename: %s, size: %d, range: %v",
 		result.Filename, result.FileSize, result.SupportsRange)
@@ -176,6 +198,49 @@ func ProbeServer(ctx context.Context, rawurl string, filenameHint string, header
 	return result, nil
 }
 
+// probeFTP maps SIZE, MDTM and REST support onto a ProbeResult
+func probeFTP(ctx context.Context, rawurl string, filenameHint string) (*ProbeResult, error) {
+	probeCtx, cancel := context.WithTimeout(ctx, types.ProbeTimeout)
+	defer cancel()
+
+	r, err := ftp.Probe(probeCtx, rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("probe request failed: %w", err)
+	}
+
+	result := &ProbeResult{
+		FileSize:      r.FileSize,
+		SupportsRange: r.SupportsRest,
+		Filename:      r.Filename,
+		Validators:    types.Validators{LastModified: r.LastModified()},
+	}
+	if filenameHint != "" {
+		result.Filename = filenameHint
+	}
+	return result, nil
+}
+
+// ProbeSFTP stats the file behind an open SFTP source. SFTP reads at any offset,
+// so the result always supports ranges.
+func ProbeSFTP(src *sftp.Source, filenameHint string) (*ProbeResult, error) {
+	info, err := src.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("probe request failed: %w", err)
+	}
+
+	result := &ProbeResult{
+		FileSize:      info.Size(),
+		SupportsRange: true,
+		Filename:      info.Name(),
+		Validators:    types.Validators{LastModified: info.ModTime().UTC().Format(http.TimeFormat)},
+	}
+	if filenameHint != "" {
+		result.Filename = filenameHint
+	}
+	utils.Debug("SFTP probe complete - filename: %s, size: %d", result.Filename, result.FileSize)
+	return result, nil
+}
+
 // ProbeMirrors concurrently checks a list of mirrors and returns valid ones and errors
 func ProbeMirrors(ctx context.Context, mirrors []string) (valid []string, errors map[string]error) {
 	// Deduplicate
@@ -212,6 +277,7 @@ func ProbeMirrors(ctx context.Context, mirrors []string) (valid []string, errors
 
 			if err != nil {
 				errors[target] = err
+				metrics.MirrorFailures.Inc()
 				return
 			}
 
@@ -219,6 +285,7 @@ func ProbeMirrors(ctx context.Context, mirrors []string) (valid []string, errors
 				valid = append(valid, target)
 			} else {
 				errors[target] = fmt.Errorf("does not support ranges")
+				metrics.MirrorFailures.Inc()
 			}
 		}(url)
 	}
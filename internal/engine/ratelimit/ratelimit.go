@@ -0,0 +1,168 @@
+// Package ratelimit provides a token-bucket bandwidth limiter that can be
+// shared by every connection of a download, or by all downloads.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// minChunk is the smallest read size suggested while limited
+	minChunk = 4 * 1024
+	// chunkInterval is roughly how much transfer time a single read may take while limited
+	chunkInterval = 100 * time.Millisecond
+)
+
+// Limiter is a token bucket measured in bytes per second.
+// A nil Limiter or a rate of 0 means unlimited. The rate can be changed at
+// any time; goroutines currently waiting pick up the new rate immediately.
+type Limiter struct {
+	mu      sync.Mutex
+	rate    int64 // Bytes per second, 0 = unlimited
+	tokens  float64
+	last    time.Time
+	changed chan struct{} // Closed and replaced whenever the rate changes
+}
+
+// New creates a limiter allowing bytesPerSec bytes per second (0 = unlimited)
+func New(bytesPerSec int64) *Limiter {
+	l := &Limiter{changed: make(chan struct{})}
+	l.SetRate(bytesPerSec)
+	return l
+}
+
+var global = New(0)
+
+// Global returns the limiter shared by all downloads
+func Global() *Limiter {
+	return global
+}
+
+// SetRate changes the limit. Zero or a negative value removes it.
+func (l *Limiter) SetRate(bytesPerSec int64) {
+	if bytesPerSec < 0 {
+		bytesPerSec = 0
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.rate = bytesPerSec
+	l.tokens = 0
+	l.last = time.Now()
+	close(l.changed)
+	l.changed = make(chan struct{})
+}
+
+// Rate returns the current limit in bytes per second (0 = unlimited)
+func (l *Limiter) Rate() int64 {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.rate
+}
+
+// Limited reports whether a limit is currently in effect
+func (l *Limiter) Limited() bool {
+	return l.Rate() > 0
+}
+
+// WaitN accounts for n bytes that were just transferred and blocks until the
+// limit allows them. It returns early with ctx.Err() if ctx is cancelled.
+func (l *Limiter) WaitN(ctx context.Context, n int) error {
+	if l == nil || n <= 0 {
+		return nil
+	}
+
+	for {
+		l.mu.Lock()
+		if l.rate <= 0 {
+			l.mu.Unlock()
+			return nil
+		}
+
+		// Refill, allowing at most one second of burst
+		now := time.Now()
+		l.tokens += now.Sub(l.last).Seconds() * float64(l.rate)
+		if burst := float64(l.rate); l.tokens > burst {
+			l.tokens = burst
+		}
+		l.last = now
+
+		// Reserve the bytes; a negative balance is debt paid off by waiting
+		l.tokens -= float64(n)
+		wait := time.Duration(-l.tokens / float64(l.rate) * float64(time.Second))
+		changed := l.changed
+		l.mu.Unlock()
+
+		if wait <= 0 {
+			return nil
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+			return nil
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-changed:
+			// The bucket was reset for a new rate; reserve again against it
+			timer.Stop()
+		}
+	}
+}
+
+// ChunkSize caps a read of n bytes so that a single read takes no longer
+// than about 100ms at the current rate. Unlimited limiters return n.
+func (l *Limiter) ChunkSize(n int) int {
+	rate := l.Rate()
+	if rate <= 0 {
+		return n
+	}
+	chunk := int(rate * int64(chunkInterval) / int64(time.Second))
+	if chunk < minChunk {
+		chunk = minChunk
+	}
+	if chunk < n {
+		return chunk
+	}
+	return n
+}
+
+// ParseRate parses a rate such as "512K", "1.5M", "2MB" or "800000" into
+// bytes per second. Units are binary (K = 1024). "0" or "" means unlimited.
+func ParseRate(raw string) (int64, error) {
+	s := strings.ToUpper(strings.TrimSpace(raw))
+	s = strings.TrimSuffix(s, "/S")
+	s = strings.TrimSuffix(s, "B")
+	if s == "" {
+		return 0, nil
+	}
+
+	multiplier := int64(1)
+	switch s[len(s)-1] {
+	case 'K':
+		multiplier = 1024
+	case 'M':
+		multiplier = 1024 * 1024
+	case 'G':
+		multiplier = 1024 * 1024 * 1024
+	}
+	if multiplier > 1 {
+		s = s[:len(s)-1]
+	}
+
+	value, err := strconv.ParseFloat(strings.TrimSpace(s), 64)
+	if err != nil || value < 0 {
+		return 0, fmt.Errorf("invalid rate %q", raw)
+	}
+	return int64(value * float64(multiplier)), nil
+}
@@ -0,0 +1,125 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLimiter_Unlimited(t *testing.T) {
+	var nilLimiter *Limiter
+	if err := nilLimiter.WaitN(context.Background(), 1<<30); err != nil {
+		t.Fatalf("nil limiter should never block: %v", err)
+	}
+	if nilLimiter.Limited() {
+		t.Error("nil limiter should not be limited")
+	}
+
+	l := New(0)
+	start := time.Now()
+	for i := 0; i < 100; i++ {
+		if err := l.WaitN(context.Background(), 1<<20); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("unlimited limiter blocked for %v", elapsed)
+	}
+	if got := l.ChunkSize(512 * 1024); got != 512*1024 {
+		t.Errorf("ChunkSize = %d, want unchanged", got)
+	}
+}
+
+func TestLimiter_EnforcesRate(t *testing.T) {
+	l := New(100 * 1024)
+
+	start := time.Now()
+	// 30KB at 100KB/s should take about 300ms
+	for i := 0; i < 30; i++ {
+		if err := l.WaitN(context.Background(), 1024); err != nil {
+			t.Fatal(err)
+		}
+	}
+	elapsed := time.Since(start)
+	if elapsed < 250*time.Millisecond || elapsed > 1500*time.Millisecond {
+		t.Errorf("30KB at 100KB/s took %v, want ~300ms", elapsed)
+	}
+}
+
+func TestLimiter_ContextCancel(t *testing.T) {
+	l := New(1024)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	err := l.WaitN(ctx, 1024*1024)
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected deadline exceeded, got %v", err)
+	}
+}
+
+func TestLimiter_SetRateWakesWaiters(t *testing.T) {
+	l := New(1024)
+
+	done := make(chan error, 1)
+	go func() {
+		// Would take ~1000s at 1KB/s
+		done <- l.WaitN(context.Background(), 1024*1024)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	l.SetRate(0)
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("waiter was not released when the limit was removed")
+	}
+}
+
+func TestLimiter_ChunkSize(t *testing.T) {
+	l := New(1024 * 1024)
+	if got := l.ChunkSize(512 * 1024); got >= 512*1024 || got < minChunk {
+		t.Errorf("ChunkSize at 1MB/s = %d, want a fraction of the buffer", got)
+	}
+
+	l.SetRate(1)
+	if got := l.ChunkSize(512 * 1024); got != minChunk {
+		t.Errorf("ChunkSize at 1B/s = %d, want %d", got, minChunk)
+	}
+}
+
+func TestParseRate(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    int64
+		wantErr bool
+	}{
+		{"", 0, false},
+		{"0", 0, false},
+		{"800000", 800000, false},
+		{"512K", 512 * 1024, false},
+		{"512k", 512 * 1024, false},
+		{"1.5M", 1536 * 1024, false},
+		{"2MB", 2 * 1024 * 1024, false},
+		{"5MB/s", 5 * 1024 * 1024, false},
+		{"1G", 1024 * 1024 * 1024, false},
+		{"fast", 0, true},
+		{"-5K", 0, true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseRate(tt.input)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("ParseRate(%q) error = %v, wantErr %v", tt.input, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseRate(%q) = %d, want %d", tt.input, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,200 @@
+// Package sftp reads files from SSH servers over the SFTP subsystem. A single
+// SSH connection carries one channel per range so the concurrent downloader
+// can fetch several parts of the file at once.
+package sftp
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+	"golang.org/x/crypto/ssh/knownhosts"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// Schemes handled by this package. SCP has no way to read a byte range, so
+// scp:// URLs are fetched over SFTP, which servers offering SCP almost always allow.
+var Schemes = map[string]bool{"sftp": true, "scp": true}
+
+// MaxChannels caps parallel channels on one connection. OpenSSH refuses
+// more than 10 sessions per connection by default (MaxSessions).
+const MaxChannels = 8
+
+// defaultKeyFiles are tried when no key files are configured, like ssh(1)
+var defaultKeyFiles = []string{"id_ed25519", "id_ecdsa", "id_rsa"}
+
+// IsSFTP reports whether rawurl uses one of the SSH schemes
+func IsSFTP(rawurl string) bool {
+	u, err := url.Parse(rawurl)
+	return err == nil && Schemes[strings.ToLower(u.Scheme)]
+}
+
+// CapConnections returns a copy of runtime with connections limited to MaxChannels
+func CapConnections(runtime *types.RuntimeConfig) *types.RuntimeConfig {
+	capped := types.RuntimeConfig{}
+	if runtime != nil {
+		capped = *runtime
+	}
+	if capped.GetMaxConnectionsPerHost() > MaxChannels {
+		capped.MaxConnectionsPerHost = MaxChannels
+	}
+	return &capped
+}
+
+// dial opens an authenticated SSH connection for u. The server's host key
+// must be listed in the known_hosts file.
+func dial(ctx context.Context, u *url.URL, runtime *types.RuntimeConfig) (*ssh.Client, error) {
+	port := u.Port()
+	if port == "" {
+		port = "22"
+	}
+	addr := net.JoinHostPort(u.Hostname(), port)
+
+	hostKeys, err := hostKeyCallback(runtime)
+	if err != nil {
+		return nil, err
+	}
+	auth, closeAgent := authMethods(u, runtime)
+	defer closeAgent()
+
+	config := &ssh.ClientConfig{
+		User:            username(u),
+		Auth:            auth,
+		HostKeyCallback: hostKeys,
+		Timeout:         types.DialTimeout,
+	}
+
+	dialer := net.Dialer{Timeout: types.DialTimeout}
+	conn, err := dialer.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("ssh connect failed: %w", err)
+	}
+
+	// The handshake doesn't take a context; closing the socket aborts it
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	c, chans, reqs, err := ssh.NewClientConn(conn, addr, config)
+	stop()
+	if err != nil {
+		_ = conn.Close()
+		var keyErr *knownhosts.KeyError
+		if errors.As(err, &keyErr) {
+			if len(keyErr.Want) == 0 {
+				return nil, fmt.Errorf("ssh host key for %s is not in %s", addr, knownHostsPath(runtime))
+			}
+			return nil, fmt.Errorf("ssh host key for %s does not match %s", addr, knownHostsPath(runtime))
+		}
+		return nil, fmt.Errorf("ssh handshake failed: %w", err)
+	}
+	return ssh.NewClient(c, chans, reqs), nil
+}
+
+// username returns the login from the URL, or the local user like ssh(1)
+func username(u *url.URL) string {
+	if u.User != nil && u.User.Username() != "" {
+		return u.User.Username()
+	}
+	if current, err := user.Current(); err == nil {
+		return current.Username
+	}
+	return os.Getenv("USER")
+}
+
+// authMethods offers the URL password, then keys from ssh-agent and the key files.
+// The returned func closes the agent connection once the handshake is done.
+func authMethods(u *url.URL, runtime *types.RuntimeConfig) ([]ssh.AuthMethod, func()) {
+	var methods []ssh.AuthMethod
+	closeAgent := func() {}
+
+	if u.User != nil {
+		if password, ok := u.User.Password(); ok {
+			methods = append(methods, ssh.Password(password))
+		}
+	}
+
+	var agentClient agent.ExtendedAgent
+	if sock := os.Getenv("SSH_AUTH_SOCK"); sock != "" {
+		if conn, err := net.Dial("unix", sock); err == nil {
+			agentClient = agent.NewClient(conn)
+			closeAgent = func() { _ = conn.Close() }
+		} else {
+			utils.Debug("SSH agent unavailable: %v", err)
+		}
+	}
+	fileSigners := loadKeyFiles(runtime)
+
+	if agentClient != nil || len(fileSigners) > 0 {
+		methods = append(methods, ssh.PublicKeysCallback(func() ([]ssh.Signer, error) {
+			var signers []ssh.Signer
+			if agentClient != nil {
+				if agentSigners, err := agentClient.Signers(); err == nil {
+					signers = append(signers, agentSigners...)
+				}
+			}
+			return append(signers, fileSigners...), nil
+		}))
+	}
+	return methods, closeAgent
+}
+
+// loadKeyFiles parses the configured private keys, or the default ones in ~/.ssh.
+// Keys protected by a passphrase are skipped; load them into ssh-agent instead.
+func loadKeyFiles(runtime *types.RuntimeConfig) []ssh.Signer {
+	var paths []string
+	explicit := runtime != nil && len(runtime.SSHKeyFiles) > 0
+	if explicit {
+		for _, p := range runtime.SSHKeyFiles {
+			paths = append(paths, utils.ExpandHome(p))
+		}
+	} else if home, err := os.UserHomeDir(); err == nil {
+		for _, name := range defaultKeyFiles {
+			paths = append(paths, filepath.Join(home, ".ssh", name))
+		}
+	}
+
+	var signers []ssh.Signer
+	for _, p := range paths {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			if explicit || !os.IsNotExist(err) {
+				utils.Debug("SSH key %s unreadable: %v", p, err)
+			}
+			continue
+		}
+		signer, err := ssh.ParsePrivateKey(data)
+		if err != nil {
+			utils.Debug("SSH key %s skipped: %v", p, err)
+			continue
+		}
+		signers = append(signers, signer)
+	}
+	return signers
+}
+
+// hostKeyCallback verifies servers against the known_hosts file
+func hostKeyCallback(runtime *types.RuntimeConfig) (ssh.HostKeyCallback, error) {
+	path := knownHostsPath(runtime)
+	callback, err := knownhosts.New(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read known_hosts: %w", err)
+	}
+	return callback, nil
+}
+
+// knownHostsPath returns the configured known_hosts file or ~/.ssh/known_hosts
+func knownHostsPath(runtime *types.RuntimeConfig) string {
+	if runtime != nil && runtime.SSHKnownHosts != "" {
+		return utils.ExpandHome(runtime.SSHKnownHosts)
+	}
+	home, _ := os.UserHomeDir()
+	return filepath.Join(home, ".ssh", "known_hosts")
+}
@@ -0,0 +1,290 @@
+package sftp
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/agent"
+
+	"github.com/surge-downloader/surge/internal/engine/concurrent"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/testutil"
+)
+
+func initTestState(t *testing.T) string {
+	state.CloseDB() // Ensure any previous DB is closed
+
+	tmpDir := t.TempDir()
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+	t.Cleanup(state.CloseDB)
+	return tmpDir
+}
+
+// writeRemote creates the file served over SFTP and returns its data and URL
+func writeRemote(t *testing.T, srv *testutil.SSHServer, size int) ([]byte, string) {
+	t.Helper()
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i * 7 % 251)
+	}
+	path := filepath.Join(t.TempDir(), "remote.bin")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("failed to write remote file: %v", err)
+	}
+	return data, "sftp://tester@" + srv.Addr + filepath.ToSlash(path)
+}
+
+func testRuntime(srv *testutil.SSHServer) *types.RuntimeConfig {
+	return &types.RuntimeConfig{
+		MinChunkSize:  1024 * 1024,
+		SSHKeyFiles:   []string{srv.KeyFile},
+		SSHKnownHosts: srv.KnownHosts,
+	}
+}
+
+func assertFile(t *testing.T, path string, want []byte) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read downloaded file: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("downloaded file differs: got %d bytes, want %d", len(got), len(want))
+	}
+}
+
+func TestIsSFTP(t *testing.T) {
+	tests := map[string]bool{
+		"sftp://host/file.iso":           true,
+		"SFTP://user@host:2222/file.iso": true,
+		"scp://host/file.iso":            true,
+		"ftp://host/file.iso":            false,
+		"https://host/file.iso":          false,
+	}
+	for rawurl, want := range tests {
+		if got := IsSFTP(rawurl); got != want {
+			t.Errorf("IsSFTP(%q) = %v, want %v", rawurl, got, want)
+		}
+	}
+}
+
+func TestCapConnections(t *testing.T) {
+	if got := CapConnections(nil).GetMaxConnectionsPerHost(); got != MaxChannels {
+		t.Errorf("default connections = %d, want %d", got, MaxChannels)
+	}
+	if got := CapConnections(&types.RuntimeConfig{MaxConnectionsPerHost: 2}).MaxConnectionsPerHost; got != 2 {
+		t.Errorf("lower limit changed to %d", got)
+	}
+}
+
+func TestSource_StatAndRange(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	srv := testutil.NewSSHServerT(t)
+	data, rawurl := writeRemote(t, srv, 64*1024)
+
+	src, err := Open(context.Background(), rawurl, testRuntime(srv))
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = src.Close() }()
+
+	info, err := src.Stat()
+	if err != nil {
+		t.Fatalf("Stat failed: %v", err)
+	}
+	if info.Size() != int64(len(data)) || info.Name() != "remote.bin" {
+		t.Errorf("Stat = %s, %d bytes; want remote.bin, %d bytes", info.Name(), info.Size(), len(data))
+	}
+
+	r, err := src.OpenRange(context.Background(), 1000, 5000)
+	if err != nil {
+		t.Fatalf("OpenRange failed: %v", err)
+	}
+	got, err := io.ReadAll(r)
+	_ = r.Close()
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if !bytes.Equal(got, data[1000:6000]) {
+		t.Errorf("range returned %d bytes that don't match the file", len(got))
+	}
+}
+
+func TestOpen_UnknownHostKey(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	srv := testutil.NewSSHServerT(t)
+	_, rawurl := writeRemote(t, srv, 1024)
+
+	runtime := testRuntime(srv)
+	runtime.SSHKnownHosts = filepath.Join(t.TempDir(), "known_hosts")
+	if err := os.WriteFile(runtime.SSHKnownHosts, nil, 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err := Open(context.Background(), rawurl, runtime)
+	if err == nil || !strings.Contains(err.Error(), "not in") {
+		t.Fatalf("expected an unknown host key error, got %v", err)
+	}
+}
+
+func TestOpen_PasswordAuth(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	srv := testutil.NewSSHServerT(t)
+	_, rawurl := writeRemote(t, srv, 1024)
+
+	runtime := testRuntime(srv)
+	runtime.SSHKeyFiles = []string{filepath.Join(t.TempDir(), "missing")}
+
+	if _, err := Open(context.Background(), rawurl, runtime); err == nil {
+		t.Fatal("expected login without credentials to fail")
+	}
+
+	withPassword := strings.Replace(rawurl, "tester@", "tester:"+srv.Password+"@", 1)
+	src, err := Open(context.Background(), withPassword, runtime)
+	if err != nil {
+		t.Fatalf("password login failed: %v", err)
+	}
+	_ = src.Close()
+}
+
+func TestOpen_AgentAuth(t *testing.T) {
+	srv := testutil.NewSSHServerT(t)
+	_, rawurl := writeRemote(t, srv, 1024)
+
+	keyring := agent.NewKeyring()
+	key, err := ssh.ParseRawPrivateKey(mustRead(t, srv.KeyFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := keyring.Add(agent.AddedKey{PrivateKey: key}); err != nil {
+		t.Fatal(err)
+	}
+
+	sock := filepath.Join(t.TempDir(), "agent.sock")
+	ln, err := net.Listen("unix", sock)
+	if err != nil {
+		t.Skipf("unix sockets unavailable: %v", err)
+	}
+	defer func() { _ = ln.Close() }()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() { _ = agent.ServeAgent(keyring, conn) }()
+		}
+	}()
+	t.Setenv("SSH_AUTH_SOCK", sock)
+
+	runtime := testRuntime(srv)
+	runtime.SSHKeyFiles = []string{filepath.Join(t.TempDir(), "missing")}
+	src, err := Open(context.Background(), rawurl, runtime)
+	if err != nil {
+		t.Fatalf("agent login failed: %v", err)
+	}
+	_ = src.Close()
+}
+
+func mustRead(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestConcurrentDownload_OverSFTP(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	tmpDir := initTestState(t)
+	srv := testutil.NewSSHServerT(t)
+	data, rawurl := writeRemote(t, srv, 9*1024*1024)
+
+	runtime := CapConnections(testRuntime(srv))
+	src, err := Open(context.Background(), rawurl, runtime)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = src.Close() }()
+
+	destPath := filepath.Join(tmpDir, "remote.bin")
+	d := concurrent.NewConcurrentDownloader("sftp-id", nil, types.NewProgressState("sftp-id", int64(len(data))), runtime)
+	d.Source = src
+	if err := d.Download(context.Background(), rawurl, nil, nil, destPath, int64(len(data))); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	assertFile(t, destPath, data)
+
+	if logins := srv.Logins.Load(); logins != 1 {
+		t.Errorf("logins = %d, want all channels on one connection", logins)
+	}
+	if peak := srv.PeakChannels.Load(); peak < 2 || peak > MaxChannels {
+		t.Errorf("peak channels = %d, want parallel ranges within %d", peak, MaxChannels)
+	}
+}
+
+func TestConcurrentDownload_PauseAndResume(t *testing.T) {
+	t.Setenv("SSH_AUTH_SOCK", "")
+	tmpDir := initTestState(t)
+	srv := testutil.NewSSHServerT(t, testutil.WithSSHWriteDelay(time.Millisecond))
+	data, rawurl := writeRemote(t, srv, 4*1024*1024)
+	size := int64(len(data))
+	destPath := filepath.Join(tmpDir, "remote.bin")
+	runtime := CapConnections(testRuntime(srv))
+
+	src, err := Open(context.Background(), rawurl, runtime)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	st := types.NewProgressState("sftp-id", size)
+	d := concurrent.NewConcurrentDownloader("sftp-id", nil, st, runtime)
+	d.Source = src
+	go func() {
+		for st.Downloaded.Load() < 256*1024 {
+			time.Sleep(time.Millisecond)
+		}
+		st.Pause()
+	}()
+
+	err = d.Download(context.Background(), rawurl, nil, nil, destPath, size)
+	_ = src.Close()
+	if !errors.Is(err, types.ErrPaused) {
+		t.Fatalf("expected ErrPaused, got %v", err)
+	}
+
+	saved, err := state.LoadState(rawurl, destPath)
+	if err != nil {
+		t.Fatalf("pause state not saved: %v", err)
+	}
+	if len(saved.Tasks) == 0 || saved.Downloaded <= 0 || saved.Downloaded >= size {
+		t.Fatalf("saved state = %d tasks, %d bytes; want partial progress", len(saved.Tasks), saved.Downloaded)
+	}
+
+	// Resume on a new connection, as after a restart
+	src, err = Open(context.Background(), rawurl, runtime)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	defer func() { _ = src.Close() }()
+	d = concurrent.NewConcurrentDownloader("sftp-id", nil, types.NewProgressState("sftp-id", size), runtime)
+	d.Source = src
+	if err := d.Download(context.Background(), rawurl, nil, nil, destPath, size); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+	assertFile(t, destPath, data)
+
+	if _, err := state.LoadState(rawurl, destPath); err == nil {
+		t.Error("state should be deleted after completion")
+	}
+}
@@ -0,0 +1,98 @@
+package sftp
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+
+	gosftp "github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// Source reads one remote file over an SSH connection. It implements
+// concurrent.RangeSource, opening a separate SFTP channel for each range.
+type Source struct {
+	client *ssh.Client
+	path   string
+}
+
+// Open connects and authenticates to the server in rawurl
+func Open(ctx context.Context, rawurl string, runtime *types.RuntimeConfig) (*Source, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, fmt.Errorf("invalid sftp url: %w", err)
+	}
+	if u.Path == "" || u.Path == "/" {
+		return nil, fmt.Errorf("sftp url has no file path: %s", rawurl)
+	}
+
+	client, err := dial(ctx, u, runtime)
+	if err != nil {
+		return nil, err
+	}
+	return &Source{client: client, path: u.Path}, nil
+}
+
+// Stat returns the size and modification time of the remote file
+func (s *Source) Stat() (os.FileInfo, error) {
+	c, err := gosftp.NewClient(s.client)
+	if err != nil {
+		return nil, fmt.Errorf("sftp session failed: %w", err)
+	}
+	defer func() { _ = c.Close() }()
+
+	info, err := c.Stat(s.path)
+	if err != nil {
+		return nil, fmt.Errorf("sftp stat failed: %w", err)
+	}
+	if info.IsDir() {
+		return nil, fmt.Errorf("sftp path is a directory: %s", s.path)
+	}
+	return info, nil
+}
+
+// OpenRange opens a new channel and returns a reader for length bytes from offset
+func (s *Source) OpenRange(ctx context.Context, offset, length int64) (io.ReadCloser, error) {
+	c, err := gosftp.NewClient(s.client)
+	if err != nil {
+		return nil, fmt.Errorf("sftp session failed: %w", err)
+	}
+	// Closing the channel fails any read waiting on the server
+	stop := context.AfterFunc(ctx, func() { _ = c.Close() })
+
+	f, err := c.Open(s.path)
+	if err != nil {
+		stop()
+		_ = c.Close()
+		return nil, fmt.Errorf("sftp open failed: %w", err)
+	}
+	return &rangeReader{
+		Reader: io.NewSectionReader(f, offset, length),
+		file:   f,
+		client: c,
+		stop:   stop,
+	}, nil
+}
+
+// Close closes the SSH connection and every channel on it
+func (s *Source) Close() error {
+	return s.client.Close()
+}
+
+// rangeReader reads a section of a remote file and closes its channel when done
+type rangeReader struct {
+	io.Reader
+	file   *gosftp.File
+	client *gosftp.Client
+	stop   func() bool
+}
+
+func (r *rangeReader) Close() error {
+	r.stop()
+	_ = r.file.Close()
+	return r.client.Close()
+}
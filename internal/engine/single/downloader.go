@@ -2,26 +2,56 @@ package single
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"time"
 
+	"github.com/surge-downloader/surge/internal/engine/checksum"
+	"github.com/surge-downloader/surge/internal/engine/metrics"
+	"github.com/surge-downloader/surge/internal/engine/ratelimit"
+	"github.com/surge-downloader/surge/internal/engine/state"
 	"github.com/surge-downloader/surge/internal/engine/types"
 	"github.com/surge-downloader/surge/internal/utils"
 )
 
-// SingleDownloader handles single-threaded downloads for servers that don't support range requests.
-// NOTE: Pause/resume is NOT supported because this downloader is only used when
-// the server doesn't support Range headers. If interrupted, the download must restart.
+// SingleDownloader streams a file over one connection. It is used when the
+// server doesn't support range requests or doesn't report a size.
+// When the server honours Range, progress is saved on pause or failure and
+// checkpointed while running, and an interrupted transfer continues with
+// "Range: bytes=N-". Otherwise an interruption restarts the download from the
+// beginning.
 type SingleDownloader struct {
-	Client       *http.Client
-	ProgressChan chan<- any           // Channel for events (start/complete/error)
-	ID           string               // Download ID
-	State        *types.ProgressState // Shared state for TUI polling
-	Runtime      *types.RuntimeConfig
-	Headers      map[string]string // Custom HTTP headers (cookies, auth, etc.)
+	Client        *http.Client
+	ProgressChan  chan<- any           // Channel for events (start/complete/error)
+	ID            string               // Download ID
+	State         *types.ProgressState // Shared state for TUI polling
+	Runtime       *types.RuntimeConfig
+	Headers       map[string]string  // Custom HTTP headers (cookies, auth, etc.)
+	Checksum      string             // Expected digest of the finished file ("algo:hex"), optional
+	Pieces        *types.PieceHashes // Expected per-piece digests, optional
+	Category      string             // Category name saved with the pause state, optional
+	Limiter       *ratelimit.Limiter // Per-download bandwidth cap, optional
+	SupportsRange bool               // Server answered the probe with 206, so the download can resume
+	Validators    types.Validators   // Version of the file being downloaded, sent as If-Range on resume
+}
+
+// transfer tracks the position of one streaming download across reconnects
+type transfer struct {
+	file     *os.File
+	url      string
+	destPath string
+	offset   int64     // Bytes written to the working file
+	total    int64     // Full size, 0 if the server doesn't say
+	start    time.Time // When this run began
+
+	lastCheckpoint time.Time
+	checkpointed   bool // A checkpoint was saved, so a cancel has a row to clean up
 }
 
 // NewSingleDownloader creates a new single-threaded downloader with all required parameters
@@ -36,10 +66,120 @@ func NewSingleDownloader(id string, progressCh chan<- any, state *types.Progress
 }
 
 // Download downloads a file using a single connection.
-// This is used for servers that don't support Range requests.
-// If interrupted, the download cannot be resumed and must restart from the beginning.
+// fileSize may be 0 when the server doesn't report it (chunked or "bytes 0-0/*").
 func (d *SingleDownloader) Download(ctx context.Context, rawurl, destPath string, fileSize int64, filename string) error {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
+	// Use .surge extension for incomplete file
+	workingPath := destPath + types.IncompleteSuffix
+	offset := d.restoreOffset(rawurl, destPath, workingPath, fileSize)
+
+	outFile, err := os.OpenFile(workingPath, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return err
+	}
+
+	// Track whether the working file should survive for cleanup
+	keep := false
+	defer func() {
+		_ = outFile.Close()
+		if !keep {
+			_ = os.Remove(workingPath)
+		}
+	}()
+
+	start := time.Now()
+	t := &transfer{file: outFile, url: rawurl, destPath: destPath, offset: offset, total: fileSize, start: start, lastCheckpoint: start}
+
+	for attempt := 0; ; attempt++ {
+		err := d.stream(ctx, t)
+		if err == nil {
+			break
+		}
+
+		if ctx.Err() != nil {
+			if d.SupportsRange && d.State != nil && d.State.IsPaused() {
+				d.savePauseState(t)
+				keep = true
+				return types.ErrPaused
+			}
+			// The download was removed; don't leave a checkpoint that would bring it back
+			if t.checkpointed {
+				d.deleteState(rawurl, destPath)
+			}
+			// Without range support a paused download restarts from the beginning
+			return ctx.Err()
+		}
+
+		if !d.SupportsRange || errors.Is(err, errResumeMismatch) {
+			return err
+		}
+		if attempt >= d.Runtime.GetMaxTaskRetries() {
+			// Keep what arrived so a later resume continues from it
+			if t.offset > 0 {
+				d.savePauseState(t)
+				keep = true
+			}
+			return err
+		}
+
+		utils.Debug("Single download interrupted at %d bytes, reconnecting: %v", t.offset, err)
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Duration(1<<attempt) * types.RetryBaseDelay):
+		}
+	}
+
+	if err := outFile.Sync(); err != nil {
+		return fmt.Errorf("sync error: %w", err)
+	}
+	if err := outFile.Close(); err != nil {
+		return fmt.Errorf("close error: %w", err)
+	}
+
+	// Verify the finished file before it is exposed under its final name
+	if d.Checksum != "" {
+		if err := checksum.VerifyFile(workingPath, d.Checksum); err != nil {
+			d.deleteState(rawurl, destPath)
+			return err
+		}
+	}
+	// A single stream can't refetch one corrupt piece on its own
+	if d.Pieces != nil {
+		if err := verifyPieces(workingPath, t.offset, d.Pieces); err != nil {
+			d.deleteState(rawurl, destPath)
+			return err
+		}
+	}
+
+	// Rename .surge file to final destination
+	if err := os.Rename(workingPath, destPath); err != nil {
+		// Fallback: copy if rename fails (cross-device)
+		if copyErr := copyFile(workingPath, destPath); copyErr != nil {
+			return fmt.Errorf("failed to finalize file: %w", copyErr)
+		}
+		_ = os.Remove(workingPath)
+	}
+
+	keep = true // Working file is gone, nothing left to clean up
+	d.deleteState(rawurl, destPath)
+
+	elapsed := time.Since(start)
+	speed := float64(t.offset) / elapsed.Seconds()
+	utils.Debug("\nDownloaded %s in %s (%s/s)\n",
+		destPath,
+		elapsed.Round(time.Second),
+		utils.ConvertBytesToHumanReadable(int64(speed)),
+	)
+
+	return nil
+}
+
+// errResumeMismatch means the server answered a resume with a different range
+var errResumeMismatch = errors.New("server resumed at an unexpected offset")
+
+// stream opens the URL at t.offset and copies the body to the working file.
+// A server that ignores Range sends the whole file, so the transfer starts over.
+func (d *SingleDownloader) stream(ctx context.Context, t *transfer) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, t.url, nil)
 	if err != nil {
 		return err
 	}
@@ -48,6 +188,12 @@ func (d *SingleDownloader) Download(ctx context.Context, rawurl, destPath string
 		req.Header.Set(key, val)
 	}
 	req.Header.Set("User-Agent", d.Runtime.GetUserAgent())
+	if t.offset > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-", t.offset))
+		if ifRange := d.Validators.IfRange(); ifRange != "" {
+			req.Header.Set("If-Range", ifRange)
+		}
+	}
 
 	resp, err := d.Client.Do(req)
 	if err != nil {
@@ -59,49 +205,59 @@ func (d *SingleDownloader) Download(ctx context.Context, rawurl, destPath string
 		}
 	}()
 
-	if resp.StatusCode != http.StatusOK {
-		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
-	}
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		if t.offset > 0 {
+			// Range ignored, or If-Range failed because the file changed
+			utils.Debug("Server sent the whole file instead of resuming at %d bytes, restarting", t.offset)
+			d.restart(t)
+		}
+		if t.total <= 0 && resp.ContentLength > 0 {
+			d.setTotal(t, resp.ContentLength)
+		}
 
-	// Use .surge extension for incomplete file
-	workingPath := destPath + types.IncompleteSuffix
-	outFile, err := os.Create(workingPath)
-	if err != nil {
-		return err
-	}
+	case resp.StatusCode == http.StatusPartialContent && t.offset > 0:
+		first, total, ok := parseContentRange(resp.Header.Get("Content-Range"))
+		if !ok || first != t.offset {
+			return fmt.Errorf("%w: asked for %d, got %q", errResumeMismatch, t.offset, resp.Header.Get("Content-Range"))
+		}
+		if t.total <= 0 && total > 0 {
+			d.setTotal(t, total)
+		}
 
-	// Track whether we completed successfully for cleanup
-	success := false
-	defer func() {
-		_ = outFile.Close()
-		if !success {
-			_ = os.Remove(workingPath)
+	case resp.StatusCode == http.StatusRequestedRangeNotSatisfiable && t.offset > 0:
+		if t.total > 0 && t.offset == t.total {
+			return nil // Everything arrived before the interruption
 		}
-	}()
+		utils.Debug("Server rejected resume at %d bytes, restarting from the beginning", t.offset)
+		d.restart(t)
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
 
-	start := time.Now()
+	default:
+		return fmt.Errorf("unexpected status code: %d", resp.StatusCode)
+	}
 
-	// Copy response body to file with context cancellation support
-	var written int64
-	buf := make([]byte, d.Runtime.GetWorkerBufferSize())
+	// Drop anything past the confirmed offset and continue from there
+	if err := t.file.Truncate(t.offset); err != nil {
+		return fmt.Errorf("truncate error: %w", err)
+	}
+	if _, err := t.file.Seek(t.offset, io.SeekStart); err != nil {
+		return fmt.Errorf("seek error: %w", err)
+	}
 
+	buf := make([]byte, d.Runtime.GetWorkerBufferSize())
 	for {
-		// Check for context cancellation (allows clean shutdown)
-		select {
-		case <-ctx.Done():
-			// Can't resume - server doesn't support Range requests
-			return ctx.Err()
-		default:
-		}
-
-		nr, readErr := resp.Body.Read(buf)
+		// Keep reads short under a bandwidth cap so throttling stays smooth
+		readLen := d.Limiter.ChunkSize(ratelimit.Global().ChunkSize(len(buf)))
+		nr, readErr := resp.Body.Read(buf[:readLen])
 		if nr > 0 {
-			nw, writeErr := outFile.Write(buf[0:nr])
+			nw, writeErr := t.file.Write(buf[0:nr])
 			if nw > 0 {
-				written += int64(nw)
+				t.offset += int64(nw)
+				metrics.BytesDownloaded.Add(int64(nw))
 				if d.State != nil {
-					d.State.Downloaded.Store(written)
-					d.State.VerifiedProgress.Store(written)
+					d.State.Downloaded.Store(t.offset)
+					d.State.VerifiedProgress.Store(t.offset)
 				}
 			}
 			if writeErr != nil {
@@ -110,6 +266,13 @@ func (d *SingleDownloader) Download(ctx context.Context, rawurl, destPath string
 			if nr != nw {
 				return io.ErrShortWrite
 			}
+			if err := ratelimit.Global().WaitN(ctx, nr); err != nil {
+				return err
+			}
+			if err := d.Limiter.WaitN(ctx, nr); err != nil {
+				return err
+			}
+			d.checkpoint(t)
 		}
 		if readErr != nil {
 			if readErr == io.EOF {
@@ -119,33 +282,156 @@ func (d *SingleDownloader) Download(ctx context.Context, rawurl, destPath string
 		}
 	}
 
-	if err := outFile.Sync(); err != nil {
-		return fmt.Errorf("sync error: %w", err)
+	if t.total > 0 && t.offset < t.total {
+		return fmt.Errorf("read error: %w after %d of %d bytes", io.ErrUnexpectedEOF, t.offset, t.total)
 	}
-	if err := outFile.Close(); err != nil {
-		return fmt.Errorf("close error: %w", err)
+	return nil
+}
+
+// restart discards progress so the next request starts from the beginning
+func (d *SingleDownloader) restart(t *transfer) {
+	t.offset = 0
+	if d.State != nil {
+		d.State.Downloaded.Store(0)
+		d.State.VerifiedProgress.Store(0)
+		d.State.SyncSessionStart()
 	}
+}
 
-	// Rename .surge file to final destination
-	if err := os.Rename(workingPath, destPath); err != nil {
-		// Fallback: copy if rename fails (cross-device)
-		if copyErr := copyFile(workingPath, destPath); copyErr != nil {
-			return fmt.Errorf("failed to finalize file: %w", copyErr)
-		}
-		_ = os.Remove(workingPath)
+// setTotal records a size learned from the response when the probe didn't have one
+func (d *SingleDownloader) setTotal(t *transfer, total int64) {
+	t.total = total
+	if d.State != nil {
+		d.State.SetTotalSize(total)
 	}
+}
 
-	success = true // Mark successful so defer doesn't clean up
+// restoreOffset returns where a paused download left off, or 0 to start fresh.
+// Saved progress is only trusted when the working file still holds it.
+func (d *SingleDownloader) restoreOffset(rawurl, destPath, workingPath string, fileSize int64) int64 {
+	if !d.SupportsRange {
+		return 0
+	}
 
-	elapsed := time.Since(start)
-	speed := float64(written) / elapsed.Seconds()
-	utils.Debug("\nDownloaded %s in %s (%s/s)\n",
-		destPath,
-		elapsed.Round(time.Second),
-		utils.ConvertBytesToHumanReadable(int64(speed)),
-	)
+	saved, err := state.LoadState(rawurl, destPath)
+	if err != nil || saved == nil || saved.Downloaded <= 0 || len(saved.Tasks) > 0 {
+		return 0
+	}
+	if fileSize > 0 && saved.TotalSize > 0 && saved.TotalSize != fileSize {
+		utils.Debug("Remote size changed from %d to %d, restarting", saved.TotalSize, fileSize)
+		return 0
+	}
+	info, err := os.Stat(workingPath)
+	if err != nil || info.Size() < saved.Downloaded {
+		utils.Debug("Working file is missing or shorter than saved progress, restarting")
+		return 0
+	}
 
-	return nil
+	if d.State != nil {
+		d.State.Downloaded.Store(saved.Downloaded)
+		d.State.VerifiedProgress.Store(saved.Downloaded)
+		d.State.SetSavedElapsed(time.Duration(saved.Elapsed))
+		d.State.SyncSessionStart()
+	}
+	utils.Debug("Resuming single download from %d bytes", saved.Downloaded)
+	return saved.Downloaded
+}
+
+// savePauseState persists the offset so the download can continue later,
+// after a pause or once reconnecting has given up
+func (d *SingleDownloader) savePauseState(t *transfer) {
+	if err := t.file.Sync(); err != nil {
+		utils.Debug("Failed to sync before saving state: %v", err)
+	}
+
+	elapsed := d.elapsed(t)
+	if d.State != nil {
+		d.State.FinalizePause(t.offset, elapsed)
+	}
+	if err := state.SaveState(t.url, t.destPath, d.resumeState(t, elapsed)); err != nil {
+		utils.Debug("Failed to save pause state: %v", err)
+	}
+	utils.Debug("Single download stopped, state saved (Downloaded=%d)", t.offset)
+}
+
+// checkpoint saves the offset of a running download every checkpoint
+// interval, so it resumes from there after a crash. The file is synced first
+// so every byte the checkpoint counts is on disk.
+func (d *SingleDownloader) checkpoint(t *transfer) {
+	if !d.SupportsRange || d.ID == "" || time.Since(t.lastCheckpoint) < d.Runtime.GetCheckpointInterval() {
+		return
+	}
+	t.lastCheckpoint = time.Now()
+
+	if err := t.file.Sync(); err != nil {
+		utils.Debug("Checkpoint failed: %v", err)
+		return
+	}
+	if err := state.SaveCheckpoint(t.url, t.destPath, d.resumeState(t, d.elapsed(t))); err != nil {
+		utils.Debug("Checkpoint failed: %v", err)
+		return
+	}
+	t.checkpointed = true
+}
+
+// elapsed returns the time spent on the download, earlier sessions included
+func (d *SingleDownloader) elapsed(t *transfer) time.Duration {
+	elapsed := time.Since(t.start)
+	if d.State != nil {
+		elapsed += d.State.GetSavedElapsed()
+	}
+	return elapsed
+}
+
+// resumeState builds the state a later run resumes from
+func (d *SingleDownloader) resumeState(t *transfer, elapsed time.Duration) *types.DownloadState {
+	return &types.DownloadState{
+		URL:        t.url,
+		ID:         d.ID,
+		DestPath:   t.destPath,
+		TotalSize:  t.total,
+		Downloaded: t.offset,
+		Filename:   filepath.Base(t.destPath),
+		Elapsed:    elapsed.Nanoseconds(),
+		Checksum:   d.Checksum,
+		Pieces:     d.Pieces,
+		Category:   d.Category,
+		RateLimit:  d.Limiter.Rate(),
+		Validators: d.Validators,
+	}
+}
+
+// deleteState drops saved progress once it can no longer be used
+func (d *SingleDownloader) deleteState(rawurl, destPath string) {
+	if d.SupportsRange {
+		_ = state.DeleteState(d.ID, rawurl, destPath)
+	}
+}
+
+// parseContentRange reads "bytes first-last/total"; total is 0 when it is "*"
+func parseContentRange(header string) (first, total int64, ok bool) {
+	spec, found := strings.CutPrefix(header, "bytes ")
+	if !found {
+		return 0, 0, false
+	}
+	rng, size, found := strings.Cut(spec, "/")
+	if !found {
+		return 0, 0, false
+	}
+	from, _, found := strings.Cut(rng, "-")
+	if !found {
+		return 0, 0, false
+	}
+	first, err := strconv.ParseInt(from, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	if size != "*" {
+		if total, err = strconv.ParseInt(size, 10, 64); err != nil {
+			return 0, 0, false
+		}
+	}
+	return first, total, true
 }
 
 // copyFile copies a file from src to dst (fallback when rename fails)
@@ -176,3 +462,21 @@ func copyFile(src, dst string) error {
 	}
 	return out.Sync()
 }
+
+// verifyPieces checks the file against per-piece digests
+func verifyPieces(path string, size int64, pieces *types.PieceHashes) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open file for piece verification: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+
+	bad, err := checksum.VerifyPieces(f, size, pieces)
+	if err != nil {
+		return err
+	}
+	if len(bad) > 0 {
+		return fmt.Errorf("%w: %d of %d pieces corrupt", types.ErrChecksumMismatch, len(bad), len(pieces.Hashes))
+	}
+	return nil
+}
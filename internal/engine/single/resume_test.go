@@ -0,0 +1,364 @@
+package single
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/testutil"
+)
+
+func initTestState(t *testing.T) (string, func()) {
+	state.CloseDB() // Ensure any previous DB is closed
+
+	tmpDir, cleanup, err := testutil.TempDir("surge-single-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+
+	return tmpDir, func() {
+		state.CloseDB()
+		cleanup()
+	}
+}
+
+// streamServer serves data without a Content-Length, like a server that
+// answers the probe with "bytes 0-0/*". It records the Range of each request.
+type streamServer struct {
+	data        []byte
+	ignoreRange bool          // Answer every request with the whole file
+	dropAfter   int64         // Abort the first response after this many bytes, 0 = never
+	dropAll     bool          // Abort every response at dropAfter, not only the first
+	delay       time.Duration // Pause between 4KB writes
+
+	mu     sync.Mutex
+	ranges []string
+}
+
+func (s *streamServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.ranges = append(s.ranges, r.Header.Get("Range"))
+	drop := (len(s.ranges) == 1 || s.dropAll) && s.dropAfter > 0
+	delay := s.delay
+	s.mu.Unlock()
+
+	start := int64(0)
+	if rng := r.Header.Get("Range"); rng != "" && !s.ignoreRange {
+		start, _ = strconv.ParseInt(strings.TrimSuffix(strings.TrimPrefix(rng, "bytes="), "-"), 10, 64)
+		w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/*", start, len(s.data)-1))
+		w.WriteHeader(http.StatusPartialContent)
+	} else {
+		w.WriteHeader(http.StatusOK)
+	}
+
+	flusher := w.(http.Flusher)
+	for pos := start; pos < int64(len(s.data)); pos += 4096 {
+		if drop && pos >= s.dropAfter {
+			panic(http.ErrAbortHandler) // Cut the connection mid-stream
+		}
+		end := min(pos+4096, int64(len(s.data)))
+		if _, err := w.Write(s.data[pos:end]); err != nil {
+			return
+		}
+		flusher.Flush()
+		if delay > 0 {
+			time.Sleep(delay)
+		}
+	}
+}
+
+// update changes the server's behaviour for the requests that follow
+func (s *streamServer) update(f func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f()
+}
+
+func (s *streamServer) requests() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string(nil), s.ranges...)
+}
+
+func testData(size int) []byte {
+	data := make([]byte, size)
+	for i := range data {
+		data[i] = byte(i * 7 % 251)
+	}
+	return data
+}
+
+func newTestDownloader(supportsRange bool) *SingleDownloader {
+	st := types.NewProgressState("single-id", 0)
+	d := NewSingleDownloader("single-id", nil, st, &types.RuntimeConfig{})
+	d.SupportsRange = supportsRange
+	return d
+}
+
+func assertFile(t *testing.T, path string, want []byte) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read downloaded file: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("downloaded file differs: got %d bytes, want %d", len(got), len(want))
+	}
+}
+
+func TestSingleDownloader_ReconnectsAfterDrop(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	srv := &streamServer{data: testData(256 * 1024), dropAfter: 100 * 1024}
+	server := testutil.NewHTTPServerT(t, srv)
+	defer server.Close()
+
+	destPath := filepath.Join(tmpDir, "stream.bin")
+	if err := newTestDownloader(true).Download(context.Background(), server.URL, destPath, 0, "stream.bin"); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	assertFile(t, destPath, srv.data)
+
+	reqs := srv.requests()
+	if len(reqs) != 2 || reqs[0] != "" || !strings.HasPrefix(reqs[1], "bytes=") || reqs[1] == "bytes=0-" {
+		t.Errorf("expected a fresh request then a resume, got %q", reqs)
+	}
+}
+
+func TestSingleDownloader_RangeIgnoredRestarts(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	srv := &streamServer{data: testData(256 * 1024), dropAfter: 100 * 1024, ignoreRange: true}
+	server := testutil.NewHTTPServerT(t, srv)
+	defer server.Close()
+
+	destPath := filepath.Join(tmpDir, "stream.bin")
+	if err := newTestDownloader(true).Download(context.Background(), server.URL, destPath, 0, "stream.bin"); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	// The second response starts at byte 0 and must not be appended to the partial data
+	assertFile(t, destPath, srv.data)
+}
+
+func TestSingleDownloader_NoRangeDoesNotRetry(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	srv := &streamServer{data: testData(256 * 1024), dropAfter: 100 * 1024}
+	server := testutil.NewHTTPServerT(t, srv)
+	defer server.Close()
+
+	destPath := filepath.Join(tmpDir, "stream.bin")
+	if err := newTestDownloader(false).Download(context.Background(), server.URL, destPath, 0, "stream.bin"); err == nil {
+		t.Fatal("expected the interrupted download to fail")
+	}
+	if n := len(srv.requests()); n != 1 {
+		t.Errorf("expected 1 request, got %d", n)
+	}
+	if testutil.FileExists(destPath + types.IncompleteSuffix) {
+		t.Error("working file should be removed when the download can't resume")
+	}
+}
+
+func TestSingleDownloader_FailureKeepsProgress(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	srv := &streamServer{data: testData(256 * 1024), dropAfter: 100 * 1024, dropAll: true}
+	server := testutil.NewHTTPServerT(t, srv)
+	defer server.Close()
+	destPath := filepath.Join(tmpDir, "stream.bin")
+
+	d := newTestDownloader(true)
+	d.Runtime.MaxTaskRetries = 1
+	if err := d.Download(context.Background(), server.URL, destPath, 0, "stream.bin"); err == nil {
+		t.Fatal("expected the download to fail once retries run out")
+	}
+
+	saved, err := state.LoadState(server.URL, destPath)
+	if err != nil {
+		t.Fatalf("state not saved after the failure: %v", err)
+	}
+	if saved.Downloaded < 100*1024 || saved.Downloaded >= int64(len(srv.data)) {
+		t.Fatalf("saved offset = %d, want the bytes received before the drop", saved.Downloaded)
+	}
+	if info, err := os.Stat(destPath + types.IncompleteSuffix); err != nil || info.Size() < saved.Downloaded {
+		t.Fatalf("working file should keep the saved progress: %v", err)
+	}
+
+	// Once the server recovers the download picks up where it failed
+	srv.update(func() { srv.dropAll = false })
+	if err := newTestDownloader(true).Download(context.Background(), server.URL, destPath, 0, "stream.bin"); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+	assertFile(t, destPath, srv.data)
+
+	reqs := srv.requests()
+	if want := fmt.Sprintf("bytes=%d-", saved.Downloaded); reqs[len(reqs)-1] != want {
+		t.Errorf("resume request Range = %q, want %q", reqs[len(reqs)-1], want)
+	}
+}
+
+func TestSingleDownloader_PauseAndResume(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	srv := &streamServer{data: testData(512 * 1024), delay: 2 * time.Millisecond}
+	server := testutil.NewHTTPServerT(t, srv)
+	defer server.Close()
+	destPath := filepath.Join(tmpDir, "stream.bin")
+
+	d := newTestDownloader(true)
+	ctx, cancel := context.WithCancel(context.Background())
+	d.State.SetCancelFunc(cancel)
+	go func() {
+		for d.State.Downloaded.Load() < 64*1024 {
+			time.Sleep(time.Millisecond)
+		}
+		d.State.Pause()
+	}()
+
+	err := d.Download(ctx, server.URL, destPath, 0, "stream.bin")
+	if !errors.Is(err, types.ErrPaused) {
+		t.Fatalf("expected ErrPaused, got %v", err)
+	}
+
+	saved, err := state.LoadState(server.URL, destPath)
+	if err != nil {
+		t.Fatalf("pause state not saved: %v", err)
+	}
+	if saved.Downloaded <= 0 || saved.Downloaded >= int64(len(srv.data)) {
+		t.Fatalf("saved offset = %d, want partial progress", saved.Downloaded)
+	}
+	if info, err := os.Stat(destPath + types.IncompleteSuffix); err != nil || info.Size() < saved.Downloaded {
+		t.Fatalf("working file should keep the saved progress: %v", err)
+	}
+
+	// Resume with a fresh downloader, as after a restart
+	srv.update(func() { srv.delay = 0 })
+	if err := newTestDownloader(true).Download(context.Background(), server.URL, destPath, 0, "stream.bin"); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+	assertFile(t, destPath, srv.data)
+
+	reqs := srv.requests()
+	if want := fmt.Sprintf("bytes=%d-", saved.Downloaded); reqs[len(reqs)-1] != want {
+		t.Errorf("resume request Range = %q, want %q", reqs[len(reqs)-1], want)
+	}
+	if _, err := state.LoadState(server.URL, destPath); err == nil {
+		t.Error("state should be deleted after completion")
+	}
+}
+
+func TestSingleDownloader_ResumeFromCheckpoint(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	srv := &streamServer{data: testData(512 * 1024), delay: 2 * time.Millisecond}
+	server := testutil.NewHTTPServerT(t, srv)
+	defer server.Close()
+	destPath := filepath.Join(tmpDir, "stream.bin")
+	workingPath := destPath + types.IncompleteSuffix
+	if _, err := state.GetDB(); err != nil { // Open it before the downloader and the test poll it
+		t.Fatal(err)
+	}
+
+	d := newTestDownloader(true)
+	d.Runtime.CheckpointInterval = 20 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() { errCh <- d.Download(ctx, server.URL, destPath, 0, "stream.bin") }()
+
+	// Capture what a crash right after a checkpoint would leave on disk
+	var saved *types.DownloadState
+	deadline := time.Now().Add(20 * time.Second)
+	for saved == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("no checkpoint was saved")
+		}
+		select {
+		case err := <-errCh:
+			t.Fatalf("download ended before a checkpoint was seen: %v", err)
+		default:
+		}
+		if s, err := state.LoadState(server.URL, destPath); err == nil && s.Downloaded > 0 {
+			saved = s
+		}
+		time.Sleep(time.Millisecond)
+	}
+	partial, err := os.ReadFile(workingPath)
+	if err != nil {
+		t.Fatalf("failed to read working file: %v", err)
+	}
+	if saved.Downloaded >= int64(len(srv.data)) || int64(len(partial)) < saved.Downloaded {
+		t.Fatalf("checkpoint Downloaded = %d with %d bytes on disk, want partial progress", saved.Downloaded, len(partial))
+	}
+	if dl, _ := state.GetDownload("single-id"); dl == nil || dl.Status != "downloading" {
+		t.Errorf("checkpointed entry = %+v, want status 'downloading'", dl)
+	}
+
+	// A plain cancel removes the download, checkpoint included
+	cancel()
+	if err := <-errCh; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if _, err := state.LoadState(server.URL, destPath); err == nil {
+		t.Error("checkpoint should be removed when the download is cancelled")
+	}
+
+	// Restore the crash leftovers and restart, as the next Surge run would
+	if err := os.WriteFile(workingPath, partial, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.SaveCheckpoint(server.URL, destPath, saved); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := state.RequeueInterrupted(); err != nil || n != 1 {
+		t.Fatalf("RequeueInterrupted = %d, %v; want 1", n, err)
+	}
+
+	if err := newTestDownloader(true).Download(context.Background(), server.URL, destPath, 0, "stream.bin"); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+	assertFile(t, destPath, srv.data)
+
+	reqs := srv.requests()
+	if want := fmt.Sprintf("bytes=%d-", saved.Downloaded); reqs[len(reqs)-1] != want {
+		t.Errorf("resume request Range = %q, want %q", reqs[len(reqs)-1], want)
+	}
+}
+
+func TestParseContentRange(t *testing.T) {
+	tests := []struct {
+		header      string
+		first, size int64
+		ok          bool
+	}{
+		{"bytes 100-199/200", 100, 200, true},
+		{"bytes 100-199/*", 100, 0, true},
+		{"bytes */200", 0, 0, false},
+		{"items 0-1/2", 0, 0, false},
+		{"", 0, 0, false},
+	}
+	for _, tt := range tests {
+		first, size, ok := parseContentRange(tt.header)
+		if ok != tt.ok || first != tt.first || size != tt.size {
+			t.Errorf("parseContentRange(%q) = %d, %d, %v; want %d, %d, %v", tt.header, first, size, ok, tt.first, tt.size, tt.ok)
+		}
+	}
+}
@@ -39,9 +39,10 @@ func initDB() error {
 
 	// Ensure directory exists - caller should perhaps do this, but safe to do here if path is provided
 
-	// Open database
+	// Open database. Downloads checkpoint while the UI and other downloads
+	// read and write, so connections wait for a lock instead of failing.
 	var err error
-	db, err = sql.Open("sqlite", dbPath)
+	db, err = sql.Open("sqlite", dbPath+"?_pragma=busy_timeout(5000)")
 	if err != nil {
 		return fmt.Errorf("failed to open database: %w", err)
 	}
@@ -70,6 +71,21 @@ func initDB() error {
 		length INTEGER,
 		FOREIGN KEY(download_id) REFERENCES downloads(id) ON DELETE CASCADE
 	);
+
+	CREATE TABLE IF NOT EXISTS queue (
+		download_id TEXT PRIMARY KEY,
+		position INTEGER NOT NULL,
+		priority INTEGER NOT NULL DEFAULT 0,
+		url TEXT NOT NULL,
+		output_path TEXT,
+		filename TEXT,
+		mirrors TEXT,
+		checksum TEXT,
+		piece_hashes TEXT,
+		size INTEGER,
+		rate_limit INTEGER,
+		category TEXT
+	);
 	`
 
 	if _, err := db.Exec(query); err != nil {
@@ -89,6 +105,28 @@ func initDB() error {
 	// Migration: Add file_hash for integrity verification of paused downloads
 	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN file_hash TEXT")
 
+	// Migration: Add checksum for verifying completed downloads
+	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN checksum TEXT")
+
+	// Migration: Add per-piece hashes (JSON) for piece verification on resume
+	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN piece_hashes TEXT")
+
+	// Migration: Add per-download bandwidth cap (bytes/sec) so it survives pause
+	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN rate_limit INTEGER")
+
+	// Migration: Add ETag and Last-Modified for resume validation
+	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN etag TEXT")
+	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN last_modified TEXT")
+
+	// Migration: Add download category
+	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN category TEXT")
+	_, _ = db.Exec("ALTER TABLE queue ADD COLUMN category TEXT")
+
+	// Migration: Add HLS/DASH rendition and joined segment count
+	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN variant TEXT")
+	_, _ = db.Exec("ALTER TABLE downloads ADD COLUMN segments INTEGER")
+	_, _ = db.Exec("ALTER TABLE queue ADD COLUMN variant TEXT")
+
 	return nil
 }
 
@@ -0,0 +1,87 @@
+package state
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// SaveQueue replaces the saved queue with entries, in order
+func SaveQueue(entries []types.QueueEntry) error {
+	return withTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec("DELETE FROM queue"); err != nil {
+			return fmt.Errorf("failed to clear queue: %w", err)
+		}
+		if len(entries) == 0 {
+			return nil
+		}
+
+		stmt, err := tx.Prepare(`
+			INSERT INTO queue (download_id, position, priority, url, output_path, filename, mirrors, checksum, piece_hashes, size, rate_limit, category, variant)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		`)
+		if err != nil {
+			return fmt.Errorf("failed to prepare queue insert: %w", err)
+		}
+		defer func() { _ = stmt.Close() }()
+
+		for i, e := range entries {
+			if _, err := stmt.Exec(e.ID, i, e.Priority, e.URL, e.OutputPath, e.Filename,
+				strings.Join(e.Mirrors, ","), e.Checksum, encodePieces(e.Pieces), e.Size, e.RateLimit, e.Category, e.Variant); err != nil {
+				return fmt.Errorf("failed to save queue entry: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
+// LoadQueue returns the saved queue, first to start first
+func LoadQueue() ([]types.QueueEntry, error) {
+	db := getDBHelper()
+	if db == nil {
+		return nil, fmt.Errorf("database not initialized")
+	}
+
+	rows, err := db.Query(`
+		SELECT download_id, priority, url, output_path, filename, mirrors, checksum, piece_hashes, size, rate_limit, category, variant
+		FROM queue
+		ORDER BY position
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query queue: %w", err)
+	}
+	defer func() {
+		if err := rows.Close(); err != nil {
+			utils.Debug("Error closing rows: %v", err)
+		}
+	}()
+
+	var entries []types.QueueEntry
+	for rows.Next() {
+		var e types.QueueEntry
+		var outputPath, filename, mirrors, checksum, pieces, category, variant sql.NullString
+		var size, rateLimit sql.NullInt64
+
+		if err := rows.Scan(&e.ID, &e.Priority, &e.URL, &outputPath, &filename, &mirrors, &checksum, &pieces, &size, &rateLimit, &category, &variant); err != nil {
+			return nil, err
+		}
+
+		e.OutputPath = outputPath.String
+		e.Filename = filename.String
+		if mirrors.Valid && mirrors.String != "" {
+			e.Mirrors = strings.Split(mirrors.String, ",")
+		}
+		e.Checksum = checksum.String
+		e.Pieces = decodePieces(pieces)
+		e.Size = size.Int64
+		e.RateLimit = rateLimit.Int64
+		e.Category = category.String
+		e.Variant = variant.String
+
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
@@ -4,6 +4,7 @@ import (
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"io"
 	"os"
@@ -24,6 +25,18 @@ func URLHash(url string) string {
 
 // SaveState saves download state to SQLite
 func SaveState(url string, destPath string, state *types.DownloadState) error {
+	return saveState(url, destPath, state, "paused")
+}
+
+// SaveCheckpoint persists the progress of a download that is still running.
+// The row stays "downloading" and carries no file hash, since the .surge file
+// keeps changing; RequeueInterrupted picks it up if Surge dies before the
+// download pauses or finishes.
+func SaveCheckpoint(url string, destPath string, state *types.DownloadState) error {
+	return saveState(url, destPath, state, "downloading")
+}
+
+func saveState(url string, destPath string, state *types.DownloadState, status string) error {
 	// Ensure ID is set
 	if state.ID == "" {
 		// Try to find existing ID using StateHash equivalent or just generate new
@@ -40,15 +53,17 @@ func SaveState(url string, destPath string, state *types.DownloadState) error {
 
 	return withTx(func(tx *sql.Tx) error {
 		// Compute file hash for integrity verification
-		surgePath := state.DestPath + types.IncompleteSuffix
-		fileHash, _ := computeFileHash(surgePath)
-		state.FileHash = fileHash
+		state.FileHash = ""
+		if status == "paused" {
+			surgePath := state.DestPath + types.IncompleteSuffix
+			state.FileHash, _ = computeFileHash(surgePath)
+		}
 
 		// 1. Upsert into downloads table
 		_, err := tx.Exec(`
 			INSERT INTO downloads (
-				id, url, dest_path, filename, status, total_size, downloaded, url_hash, created_at, paused_at, time_taken, mirrors, chunk_bitmap, actual_chunk_size, file_hash
-			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+				id, url, dest_path, filename, status, total_size, downloaded, url_hash, created_at, paused_at, time_taken, mirrors, chunk_bitmap, actual_chunk_size, file_hash, checksum, piece_hashes, rate_limit, etag, last_modified, category, variant, segments
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 			ON CONFLICT(id) DO UPDATE SET
 				url=excluded.url,
 				dest_path=excluded.dest_path,
@@ -62,8 +77,16 @@ func SaveState(url string, destPath string, state *types.DownloadState) error {
 				mirrors=excluded.mirrors,
 				chunk_bitmap=excluded.chunk_bitmap,
 				actual_chunk_size=excluded.actual_chunk_size,
-				file_hash=excluded.file_hash
-		`, state.ID, state.URL, state.DestPath, state.Filename, "paused", state.TotalSize, state.Downloaded, state.URLHash, state.CreatedAt, state.PausedAt, state.Elapsed/1e6, strings.Join(state.Mirrors, ","), state.ChunkBitmap, state.ActualChunkSize, state.FileHash)
+				file_hash=excluded.file_hash,
+				checksum=excluded.checksum,
+				piece_hashes=excluded.piece_hashes,
+				rate_limit=excluded.rate_limit,
+				etag=excluded.etag,
+				last_modified=excluded.last_modified,
+				category=COALESCE(NULLIF(excluded.category, ''), downloads.category),
+				variant=excluded.variant,
+				segments=excluded.segments
+		`, state.ID, state.URL, state.DestPath, state.Filename, status, state.TotalSize, state.Downloaded, state.URLHash, state.CreatedAt, state.PausedAt, state.Elapsed/1e6, strings.Join(state.Mirrors, ","), state.ChunkBitmap, state.ActualChunkSize, state.FileHash, state.Checksum, encodePieces(state.Pieces), state.RateLimit, state.ETag, state.LastModified, state.Category, state.Variant, state.Segments)
 		if err != nil {
 			return fmt.Errorf("failed to upsert download: %w", err)
 		}
@@ -140,12 +163,12 @@ func LoadState(url string, destPath string) (*types.DownloadState, error) {
 	}
 
 	var state types.DownloadState
-	var timeTaken, createdAt, pausedAt, actualChunkSize sql.NullInt64 // handle null
-	var mirrors, fileHash sql.NullString                              // handle null mirrors/hash
+	var timeTaken, createdAt, pausedAt, actualChunkSize, rateLimit, segments sql.NullInt64        // handle null
+	var mirrors, fileHash, checksum, pieces, etag, lastModified, category, variant sql.NullString // handle null mirrors/hash
 	var chunkBitmap []byte
 
 	row := db.QueryRow(`
-		SELECT id, url, dest_path, filename, total_size, downloaded, url_hash, created_at, paused_at, time_taken, mirrors, chunk_bitmap, actual_chunk_size, file_hash
+		SELECT id, url, dest_path, filename, total_size, downloaded, url_hash, created_at, paused_at, time_taken, mirrors, chunk_bitmap, actual_chunk_size, file_hash, checksum, piece_hashes, rate_limit, etag, last_modified, category, variant, segments
 		FROM downloads 
 		WHERE url = ? AND dest_path = ? AND status != 'completed'
 		ORDER BY paused_at DESC LIMIT 1
@@ -154,7 +177,7 @@ func LoadState(url string, destPath string) (*types.DownloadState, error) {
 	err := row.Scan(
 		&state.ID, &state.URL, &state.DestPath, &state.Filename,
 		&state.TotalSize, &state.Downloaded, &state.URLHash,
-		&createdAt, &pausedAt, &timeTaken, &mirrors, &chunkBitmap, &actualChunkSize, &fileHash,
+		&createdAt, &pausedAt, &timeTaken, &mirrors, &chunkBitmap, &actualChunkSize, &fileHash, &checksum, &pieces, &rateLimit, &etag, &lastModified, &category, &variant, &segments,
 	)
 	if err != nil {
 		if err == sql.ErrNoRows {
@@ -183,6 +206,18 @@ func LoadState(url string, destPath string) (*types.DownloadState, error) {
 	if fileHash.Valid {
 		state.FileHash = fileHash.String
 	}
+	if checksum.Valid {
+		state.Checksum = checksum.String
+	}
+	state.Pieces = decodePieces(pieces)
+	if rateLimit.Valid {
+		state.RateLimit = rateLimit.Int64
+	}
+	state.ETag = etag.String
+	state.LastModified = lastModified.String
+	state.Category = category.String
+	state.Variant = variant.String
+	state.Segments = int(segments.Int64)
 
 	// Load tasks
 	rows, err := db.Query("SELECT offset, length FROM tasks WHERE download_id = ?", state.ID)
@@ -255,7 +290,7 @@ func LoadMasterList() (*types.MasterList, error) {
 	}
 
 	rows, err := db.Query(`
-		SELECT id, url, dest_path, filename, status, total_size, downloaded, completed_at, time_taken, url_hash, mirrors, avg_speed 
+		SELECT id, url, dest_path, filename, status, total_size, downloaded, completed_at, time_taken, url_hash, mirrors, avg_speed, checksum, category
 		FROM downloads
 	`)
 	if err != nil {
@@ -270,13 +305,13 @@ func LoadMasterList() (*types.MasterList, error) {
 	var list types.MasterList
 	for rows.Next() {
 		var e types.DownloadEntry
-		var completedAt, timeTaken sql.NullInt64      // handle nulls
-		var filename, urlHash, mirrors sql.NullString // handle nulls
-		var avgSpeed sql.NullFloat64                  // handle null avg_speed
+		var completedAt, timeTaken sql.NullInt64                          // handle nulls
+		var filename, urlHash, mirrors, checksum, category sql.NullString // handle nulls
+		var avgSpeed sql.NullFloat64                                      // handle null avg_speed
 
 		if err := rows.Scan(
 			&e.ID, &e.URL, &e.DestPath, &filename, &e.Status, &e.TotalSize, &e.Downloaded,
-			&completedAt, &timeTaken, &urlHash, &mirrors, &avgSpeed,
+			&completedAt, &timeTaken, &urlHash, &mirrors, &avgSpeed, &checksum, &category,
 		); err != nil {
 			return nil, err
 		}
@@ -299,6 +334,10 @@ func LoadMasterList() (*types.MasterList, error) {
 		if avgSpeed.Valid {
 			e.AvgSpeed = avgSpeed.Float64
 		}
+		if checksum.Valid {
+			e.Checksum = checksum.String
+		}
+		e.Category = category.String
 
 		list.Downloads = append(list.Downloads, e)
 	}
@@ -321,8 +360,8 @@ func AddToMasterList(entry types.DownloadEntry) error {
 	return withTx(func(tx *sql.Tx) error {
 		_, err := tx.Exec(`
 			INSERT INTO downloads (
-				id, url, dest_path, filename, status, total_size, downloaded, completed_at, time_taken, url_hash, mirrors, avg_speed
-			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+				id, url, dest_path, filename, status, total_size, downloaded, completed_at, time_taken, url_hash, mirrors, avg_speed, checksum, category
+			) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
 			ON CONFLICT(id) DO UPDATE SET
 				url=excluded.url,
 				dest_path=excluded.dest_path,
@@ -334,10 +373,12 @@ func AddToMasterList(entry types.DownloadEntry) error {
 				time_taken=excluded.time_taken,
 				url_hash=excluded.url_hash,
 				mirrors=excluded.mirrors,
-				avg_speed=excluded.avg_speed
+				avg_speed=excluded.avg_speed,
+				checksum=excluded.checksum,
+				category=COALESCE(NULLIF(excluded.category, ''), downloads.category)
 		`,
 			entry.ID, entry.URL, entry.DestPath, entry.Filename, entry.Status, entry.TotalSize, entry.Downloaded,
-			entry.CompletedAt, entry.TimeTaken, entry.URLHash, strings.Join(entry.Mirrors, ","), entry.AvgSpeed)
+			entry.CompletedAt, entry.TimeTaken, entry.URLHash, strings.Join(entry.Mirrors, ","), entry.AvgSpeed, entry.Checksum, entry.Category)
 
 		return err
 	})
@@ -363,18 +404,18 @@ func GetDownload(id string) (*types.DownloadEntry, error) {
 
 	var e types.DownloadEntry
 	var completedAt, timeTaken sql.NullInt64
-	var urlHash, filename, mirrors sql.NullString
+	var urlHash, filename, mirrors, checksum, category sql.NullString
 	var avgSpeed sql.NullFloat64
 
 	row := db.QueryRow(`
-		SELECT id, url, dest_path, filename, status, total_size, downloaded, completed_at, time_taken, url_hash, mirrors, avg_speed 
+		SELECT id, url, dest_path, filename, status, total_size, downloaded, completed_at, time_taken, url_hash, mirrors, avg_speed, checksum, category
 		FROM downloads
 		WHERE id = ?
 	`, id)
 
 	if err := row.Scan(
 		&e.ID, &e.URL, &e.DestPath, &filename, &e.Status, &e.TotalSize, &e.Downloaded,
-		&completedAt, &timeTaken, &urlHash, &mirrors, &avgSpeed,
+		&completedAt, &timeTaken, &urlHash, &mirrors, &avgSpeed, &checksum, &category,
 	); err != nil {
 		if err == sql.ErrNoRows {
 			return nil, nil // Not found
@@ -400,6 +441,10 @@ func GetDownload(id string) (*types.DownloadEntry, error) {
 	if avgSpeed.Valid {
 		e.AvgSpeed = avgSpeed.Float64
 	}
+	if checksum.Valid {
+		e.Checksum = checksum.String
+	}
+	e.Category = category.String
 
 	return &e, nil
 }
@@ -474,6 +519,26 @@ func UpdateStatus(id string, status string) error {
 	return nil
 }
 
+// UpdateRateLimit updates the saved bandwidth cap (bytes/sec) of a download by ID
+func UpdateRateLimit(id string, bytesPerSec int64) error {
+	db := getDBHelper()
+	if db == nil {
+		return fmt.Errorf("database not initialized")
+	}
+
+	result, err := db.Exec("UPDATE downloads SET rate_limit = ? WHERE id = ?", bytesPerSec, id)
+	if err != nil {
+		return fmt.Errorf("failed to update rate limit: %w", err)
+	}
+
+	rows, _ := result.RowsAffected()
+	if rows == 0 {
+		return fmt.Errorf("download not found: %s", id)
+	}
+
+	return nil
+}
+
 // PauseAllDownloads pauses all non-completed downloads
 func PauseAllDownloads() error {
 	db := getDBHelper()
@@ -496,6 +561,22 @@ func ResumeAllDownloads() error {
 	return err
 }
 
+// RequeueInterrupted queues the downloads that were still running when Surge
+// last exited without pausing them, so they resume from their last checkpoint.
+// Only the instance holding the lock may call it.
+func RequeueInterrupted() (int64, error) {
+	db := getDBHelper()
+	if db == nil {
+		return 0, fmt.Errorf("database not initialized")
+	}
+
+	result, err := db.Exec("UPDATE downloads SET status = 'queued' WHERE status = 'downloading'")
+	if err != nil {
+		return 0, fmt.Errorf("failed to requeue interrupted downloads: %w", err)
+	}
+	return result.RowsAffected()
+}
+
 // ListAllDownloads returns all downloads
 func ListAllDownloads() ([]types.DownloadEntry, error) {
 	list, err := LoadMasterList()
@@ -543,7 +624,7 @@ func LoadStates(ids []string) (map[string]*types.DownloadState, error) {
 
 	// 1. Load Downloads
 	query := fmt.Sprintf(`
-		SELECT id, url, dest_path, filename, total_size, downloaded, url_hash, created_at, paused_at, time_taken, mirrors, chunk_bitmap, actual_chunk_size
+		SELECT id, url, dest_path, filename, total_size, downloaded, url_hash, created_at, paused_at, time_taken, mirrors, chunk_bitmap, actual_chunk_size, checksum, piece_hashes, rate_limit, etag, last_modified, category, variant, segments
 		FROM downloads
 		WHERE id IN (%s) AND status != 'completed'
 	`, inClause)
@@ -563,14 +644,14 @@ func LoadStates(ids []string) (map[string]*types.DownloadState, error) {
 
 	for rows.Next() {
 		var state types.DownloadState
-		var timeTaken, createdAt, pausedAt, actualChunkSize sql.NullInt64
-		var mirrors sql.NullString
+		var timeTaken, createdAt, pausedAt, actualChunkSize, rateLimit, segments sql.NullInt64
+		var mirrors, checksum, pieces, etag, lastModified, category, variant sql.NullString
 		var chunkBitmap []byte
 
 		if err := rows.Scan(
 			&state.ID, &state.URL, &state.DestPath, &state.Filename,
 			&state.TotalSize, &state.Downloaded, &state.URLHash,
-			&createdAt, &pausedAt, &timeTaken, &mirrors, &chunkBitmap, &actualChunkSize,
+			&createdAt, &pausedAt, &timeTaken, &mirrors, &chunkBitmap, &actualChunkSize, &checksum, &pieces, &rateLimit, &etag, &lastModified, &category, &variant, &segments,
 		); err != nil {
 			return nil, err
 		}
@@ -591,6 +672,18 @@ func LoadStates(ids []string) (map[string]*types.DownloadState, error) {
 			state.ActualChunkSize = actualChunkSize.Int64
 		}
 		state.ChunkBitmap = chunkBitmap
+		if checksum.Valid {
+			state.Checksum = checksum.String
+		}
+		state.Pieces = decodePieces(pieces)
+		if rateLimit.Valid {
+			state.RateLimit = rateLimit.Int64
+		}
+		state.ETag = etag.String
+		state.LastModified = lastModified.String
+		state.Category = category.String
+		state.Variant = variant.String
+		state.Segments = int(segments.Int64)
 
 		states[state.ID] = &state
 	}
@@ -712,3 +805,29 @@ func ValidateIntegrity() (int, error) {
 
 	return removed, nil
 }
+
+// encodePieces serializes piece hashes for the piece_hashes column
+func encodePieces(p *types.PieceHashes) sql.NullString {
+	if p == nil {
+		return sql.NullString{}
+	}
+	data, err := json.Marshal(p)
+	if err != nil {
+		utils.Debug("Failed to encode piece hashes: %v", err)
+		return sql.NullString{}
+	}
+	return sql.NullString{String: string(data), Valid: true}
+}
+
+// decodePieces parses the piece_hashes column, returning nil if unset or invalid
+func decodePieces(s sql.NullString) *types.PieceHashes {
+	if !s.Valid || s.String == "" {
+		return nil
+	}
+	var p types.PieceHashes
+	if err := json.Unmarshal([]byte(s.String), &p); err != nil {
+		utils.Debug("Failed to decode piece hashes: %v", err)
+		return nil
+	}
+	return &p
+}
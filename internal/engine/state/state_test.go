@@ -444,6 +444,72 @@ func TestResumeAllDownloads(t *testing.T) {
 	}
 }
 
+func TestSaveCheckpoint_RequeueInterrupted(t *testing.T) {
+	tmpDir := setupTestDB(t)
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+	defer CloseDB()
+
+	destPath := filepath.Join(tmpDir, "running.bin")
+	surgePath := destPath + types.IncompleteSuffix
+	if err := os.WriteFile(surgePath, []byte("partial"), 0o644); err != nil {
+		t.Fatalf("Failed to create .surge file: %v", err)
+	}
+
+	url := "https://example.com/running.bin"
+	if err := SaveCheckpoint(url, destPath, &types.DownloadState{
+		ID:         "running-id",
+		URL:        url,
+		DestPath:   destPath,
+		Filename:   "running.bin",
+		TotalSize:  1000,
+		Downloaded: 400,
+		Tasks:      []types.Task{{Offset: 400, Length: 600}},
+	}); err != nil {
+		t.Fatalf("SaveCheckpoint failed: %v", err)
+	}
+
+	dl, _ := GetDownload("running-id")
+	if dl == nil || dl.Status != "downloading" {
+		t.Fatalf("checkpointed entry = %+v, want status 'downloading'", dl)
+	}
+	loaded, err := LoadState(url, destPath)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if loaded.Downloaded != 400 || len(loaded.Tasks) != 1 || loaded.Tasks[0].Offset != 400 {
+		t.Errorf("loaded = %d bytes, tasks %+v", loaded.Downloaded, loaded.Tasks)
+	}
+
+	// The file keeps changing after the checkpoint; it must not count as tampering
+	if err := os.WriteFile(surgePath, []byte("more partial data"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := RequeueInterrupted()
+	if err != nil {
+		t.Fatalf("RequeueInterrupted failed: %v", err)
+	}
+	if n != 1 {
+		t.Errorf("RequeueInterrupted = %d, want 1", n)
+	}
+	dl, _ = GetDownload("running-id")
+	if dl == nil || dl.Status != "queued" {
+		t.Fatalf("interrupted entry = %+v, want status 'queued'", dl)
+	}
+
+	if removed, err := ValidateIntegrity(); err != nil || removed != 0 {
+		t.Errorf("ValidateIntegrity = %d, %v; want the requeued download kept", removed, err)
+	}
+	if _, err := os.Stat(surgePath); err != nil {
+		t.Errorf(".surge file should be kept: %v", err)
+	}
+
+	// Nothing is left to requeue
+	if n, _ := RequeueInterrupted(); n != 0 {
+		t.Errorf("second RequeueInterrupted = %d, want 0", n)
+	}
+}
+
 // =============================================================================
 // ListAllDownloads Tests
 // =============================================================================
@@ -613,6 +679,189 @@ func TestMirrorsPersistence(t *testing.T) {
 	}
 }
 
+func TestPiecesPersistence(t *testing.T) {
+	tmpDir := setupTestDB(t)
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+	defer CloseDB()
+
+	testURL := "https://example.com/pieces.iso"
+	testDestPath := filepath.Join(tmpDir, "pieces.iso")
+	pieces := &types.PieceHashes{
+		Algorithm: "sha1",
+		Length:    262144,
+		Hashes:    []string{"da39a3ee5e6b4b0d3255bfef95601890afd80709", "0000000000000000000000000000000000000000"},
+	}
+
+	state := &types.DownloadState{
+		ID:        "pieces-state-id",
+		URL:       testURL,
+		DestPath:  testDestPath,
+		TotalSize: 400000,
+		Filename:  "pieces.iso",
+		Pieces:    pieces,
+	}
+	if err := SaveState(testURL, testDestPath, state); err != nil {
+		t.Fatalf("SaveState failed: %v", err)
+	}
+
+	loaded, err := LoadState(testURL, testDestPath)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if loaded.Pieces == nil {
+		t.Fatal("Pieces not restored")
+	}
+	if loaded.Pieces.Algorithm != "sha1" || loaded.Pieces.Length != 262144 || len(loaded.Pieces.Hashes) != 2 {
+		t.Errorf("Pieces mismatch: %+v", loaded.Pieces)
+	}
+
+	batch, err := LoadStates([]string{"pieces-state-id"})
+	if err != nil {
+		t.Fatalf("LoadStates failed: %v", err)
+	}
+	if s := batch["pieces-state-id"]; s == nil || s.Pieces == nil || s.Pieces.Hashes[1] != pieces.Hashes[1] {
+		t.Errorf("LoadStates did not restore pieces: %+v", s)
+	}
+}
+
+func TestRateLimitPersistence(t *testing.T) {
+	tmpDir := setupTestDB(t)
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+	defer CloseDB()
+
+	testURL := "https://example.com/limited.iso"
+	testDestPath := filepath.Join(tmpDir, "limited.iso")
+
+	state := &types.DownloadState{
+		ID:        "limited-state-id",
+		URL:       testURL,
+		DestPath:  testDestPath,
+		TotalSize: 400000,
+		Filename:  "limited.iso",
+		RateLimit: 512 * 1024,
+	}
+	if err := SaveState(testURL, testDestPath, state); err != nil {
+		t.Fatalf("SaveState failed: %v", err)
+	}
+
+	loaded, err := LoadState(testURL, testDestPath)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if loaded.RateLimit != 512*1024 {
+		t.Errorf("RateLimit = %d, want %d", loaded.RateLimit, 512*1024)
+	}
+
+	if err := UpdateRateLimit("limited-state-id", 64*1024); err != nil {
+		t.Fatalf("UpdateRateLimit failed: %v", err)
+	}
+	batch, err := LoadStates([]string{"limited-state-id"})
+	if err != nil {
+		t.Fatalf("LoadStates failed: %v", err)
+	}
+	if s := batch["limited-state-id"]; s == nil || s.RateLimit != 64*1024 {
+		t.Errorf("LoadStates did not restore updated rate limit: %+v", s)
+	}
+
+	if err := UpdateRateLimit("missing-id", 1024); err == nil {
+		t.Error("expected error for unknown download")
+	}
+}
+
+func TestValidatorsPersistence(t *testing.T) {
+	tmpDir := setupTestDB(t)
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+	defer CloseDB()
+
+	testURL := "https://example.com/versioned.iso"
+	testDestPath := filepath.Join(tmpDir, "versioned.iso")
+	validators := types.Validators{ETag: `"abc123"`, LastModified: "Wed, 21 Oct 2015 07:28:00 GMT"}
+
+	state := &types.DownloadState{
+		ID:         "versioned-state-id",
+		URL:        testURL,
+		DestPath:   testDestPath,
+		TotalSize:  400000,
+		Filename:   "versioned.iso",
+		Validators: validators,
+	}
+	if err := SaveState(testURL, testDestPath, state); err != nil {
+		t.Fatalf("SaveState failed: %v", err)
+	}
+
+	loaded, err := LoadState(testURL, testDestPath)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if loaded.Validators != validators {
+		t.Errorf("LoadState validators = %+v, want %+v", loaded.Validators, validators)
+	}
+
+	batch, err := LoadStates([]string{"versioned-state-id"})
+	if err != nil {
+		t.Fatalf("LoadStates failed: %v", err)
+	}
+	if s := batch["versioned-state-id"]; s == nil || s.Validators != validators {
+		t.Errorf("LoadStates validators = %+v, want %+v", s, validators)
+	}
+}
+
+func TestCategoryPersistence(t *testing.T) {
+	tmpDir := setupTestDB(t)
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+	defer CloseDB()
+
+	testURL := "https://example.com/movie.mkv"
+	testDestPath := filepath.Join(tmpDir, "movie.mkv")
+
+	state := &types.DownloadState{
+		ID:        "category-state-id",
+		URL:       testURL,
+		DestPath:  testDestPath,
+		TotalSize: 400000,
+		Filename:  "movie.mkv",
+		Category:  "Video",
+	}
+	if err := SaveState(testURL, testDestPath, state); err != nil {
+		t.Fatalf("SaveState failed: %v", err)
+	}
+
+	loaded, err := LoadState(testURL, testDestPath)
+	if err != nil {
+		t.Fatalf("LoadState failed: %v", err)
+	}
+	if loaded.Category != "Video" {
+		t.Errorf("LoadState category = %q, want Video", loaded.Category)
+	}
+	batch, err := LoadStates([]string{"category-state-id"})
+	if err != nil {
+		t.Fatalf("LoadStates failed: %v", err)
+	}
+	if s := batch["category-state-id"]; s == nil || s.Category != "Video" {
+		t.Errorf("LoadStates category = %+v, want Video", s)
+	}
+
+	// Status updates that don't carry a category keep the recorded one
+	if err := AddToMasterList(types.DownloadEntry{ID: "category-state-id", URL: testURL, DestPath: testDestPath, Status: "completed"}); err != nil {
+		t.Fatalf("AddToMasterList failed: %v", err)
+	}
+	entry, err := GetDownload("category-state-id")
+	if err != nil || entry == nil {
+		t.Fatalf("GetDownload failed: %v", err)
+	}
+	if entry.Category != "Video" {
+		t.Errorf("GetDownload category = %q, want Video", entry.Category)
+	}
+
+	list, err := LoadMasterList()
+	if err != nil {
+		t.Fatalf("LoadMasterList failed: %v", err)
+	}
+	if len(list.Downloads) != 1 || list.Downloads[0].Category != "Video" {
+		t.Errorf("LoadMasterList = %+v, want one Video download", list.Downloads)
+	}
+}
+
 // =============================================================================
 // ValidateIntegrity Tests
 // =============================================================================
@@ -857,3 +1106,55 @@ func TestAvgSpeedPersistence(t *testing.T) {
 		t.Error("Entry not found in master list")
 	}
 }
+
+func TestQueuePersistence(t *testing.T) {
+	tmpDir := setupTestDB(t)
+	defer func() { _ = os.RemoveAll(tmpDir) }()
+	defer CloseDB()
+
+	pieces := &types.PieceHashes{Algorithm: "sha256", Length: 1024, Hashes: []string{"aa", "bb"}}
+	entries := []types.QueueEntry{
+		{ID: "first", URL: "https://example.com/a.iso", OutputPath: tmpDir, Priority: types.PriorityHigh, RateLimit: 1024, Category: "ISOs"},
+		{ID: "second", URL: "https://example.com/b.iso", OutputPath: tmpDir, Filename: "b.iso",
+			Mirrors: []string{"https://m1/b.iso", "https://m2/b.iso"}, Checksum: "sha256:abcd", Pieces: pieces, Size: 2048},
+		{ID: "third", URL: "https://example.com/c.iso", Priority: types.PriorityLow},
+	}
+	if err := SaveQueue(entries); err != nil {
+		t.Fatalf("SaveQueue failed: %v", err)
+	}
+
+	loaded, err := LoadQueue()
+	if err != nil {
+		t.Fatalf("LoadQueue failed: %v", err)
+	}
+	if len(loaded) != 3 || loaded[0].ID != "first" || loaded[1].ID != "second" || loaded[2].ID != "third" {
+		t.Fatalf("LoadQueue order = %+v", loaded)
+	}
+	if loaded[0].Priority != types.PriorityHigh || loaded[0].RateLimit != 1024 || loaded[0].OutputPath != tmpDir || loaded[0].Category != "ISOs" {
+		t.Errorf("first entry = %+v", loaded[0])
+	}
+	second := loaded[1]
+	if second.Filename != "b.iso" || len(second.Mirrors) != 2 || second.Checksum != "sha256:abcd" || second.Size != 2048 ||
+		second.Pieces == nil || second.Pieces.Hashes[1] != "bb" {
+		t.Errorf("second entry = %+v", second)
+	}
+
+	// Saving again replaces the whole queue
+	if err := SaveQueue([]types.QueueEntry{entries[2], entries[0]}); err != nil {
+		t.Fatalf("SaveQueue failed: %v", err)
+	}
+	loaded, err = LoadQueue()
+	if err != nil {
+		t.Fatalf("LoadQueue failed: %v", err)
+	}
+	if len(loaded) != 2 || loaded[0].ID != "third" || loaded[1].ID != "first" {
+		t.Errorf("reordered queue = %+v", loaded)
+	}
+
+	if err := SaveQueue(nil); err != nil {
+		t.Fatalf("SaveQueue(nil) failed: %v", err)
+	}
+	if loaded, _ := LoadQueue(); len(loaded) != 0 {
+		t.Errorf("queue should be empty, got %d entries", len(loaded))
+	}
+}
@@ -0,0 +1,417 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// mpd is the part of a DASH manifest (ISO/IEC 23009-1) needed to list segments
+type mpd struct {
+	Type     string      `xml:"type,attr"`
+	Duration string      `xml:"mediaPresentationDuration,attr"`
+	BaseURL  string      `xml:"BaseURL"`
+	Periods  []mpdPeriod `xml:"Period"`
+}
+
+type mpdPeriod struct {
+	Duration string          `xml:"duration,attr"`
+	BaseURL  string          `xml:"BaseURL"`
+	Sets     []adaptationSet `xml:"AdaptationSet"`
+}
+
+type adaptationSet struct {
+	MimeType        string           `xml:"mimeType,attr"`
+	ContentType     string           `xml:"contentType,attr"`
+	BaseURL         string           `xml:"BaseURL"`
+	Template        *segmentTemplate `xml:"SegmentTemplate"`
+	List            *segmentList     `xml:"SegmentList"`
+	Representations []representation `xml:"Representation"`
+}
+
+type representation struct {
+	ID        string           `xml:"id,attr"`
+	Bandwidth int64            `xml:"bandwidth,attr"`
+	Width     int              `xml:"width,attr"`
+	Height    int              `xml:"height,attr"`
+	MimeType  string           `xml:"mimeType,attr"`
+	Codecs    string           `xml:"codecs,attr"`
+	BaseURL   string           `xml:"BaseURL"`
+	Template  *segmentTemplate `xml:"SegmentTemplate"`
+	List      *segmentList     `xml:"SegmentList"`
+}
+
+type segmentTemplate struct {
+	Media          string `xml:"media,attr"`
+	Initialization string `xml:"initialization,attr"`
+	StartNumber    *int64 `xml:"startNumber,attr"`
+	Timescale      *int64 `xml:"timescale,attr"`
+	Duration       *int64 `xml:"duration,attr"`
+	Timeline       *struct {
+		S []struct {
+			T *int64 `xml:"t,attr"`
+			D int64  `xml:"d,attr"`
+			R int64  `xml:"r,attr"`
+		} `xml:"S"`
+	} `xml:"SegmentTimeline"`
+}
+
+type segmentList struct {
+	Initialization *struct {
+		SourceURL string `xml:"sourceURL,attr"`
+		Range     string `xml:"range,attr"`
+	} `xml:"Initialization"`
+	URLs []struct {
+		Media      string `xml:"media,attr"`
+		MediaRange string `xml:"mediaRange,attr"`
+	} `xml:"SegmentURL"`
+}
+
+// maxSegments stops a bad template from expanding without end
+const maxSegments = 1 << 20
+
+var (
+	templateVar = regexp.MustCompile(`\$(RepresentationID|Number|Bandwidth|Time)(%0(\d+)d)?\$`)
+	isoDuration = regexp.MustCompile(`^P(?:([\d.]+)Y)?(?:([\d.]+)M)?(?:([\d.]+)W)?(?:([\d.]+)D)?(?:T(?:([\d.]+)H)?(?:([\d.]+)M)?(?:([\d.]+)S)?)?$`)
+)
+
+// looksLikeMPD sniffs a manifest served without a telling URL or type
+func looksLikeMPD(data []byte) bool {
+	head := data
+	if len(head) > 1024 {
+		head = head[:1024]
+	}
+	return bytes.Contains(head, []byte("<MPD"))
+}
+
+// loadDASH picks a representation from the video adaptation set, or the
+// audio one for audio-only streams, and lists its segments
+func loadDASH(data []byte, base *url.URL, spec VariantSpec) (*Media, error) {
+	var m mpd
+	if err := xml.Unmarshal(data, &m); err != nil {
+		return nil, fmt.Errorf("%w: invalid DASH manifest: %v", ErrUnsupported, err)
+	}
+	if m.Type == "dynamic" {
+		return nil, ErrLive
+	}
+	if len(m.Periods) != 1 {
+		return nil, fmt.Errorf("%w: manifest with %d periods", ErrUnsupported, len(m.Periods))
+	}
+	period := m.Periods[0]
+
+	durationAttr := period.Duration
+	if durationAttr == "" {
+		durationAttr = m.Duration
+	}
+	var duration time.Duration
+	if durationAttr != "" {
+		var err error
+		if duration, err = parseISODuration(durationAttr); err != nil {
+			return nil, err
+		}
+	}
+
+	set, others := chooseSet(period.Sets)
+	if set == nil {
+		return nil, fmt.Errorf("%w: no representations in manifest", ErrUnsupported)
+	}
+	if others {
+		utils.Debug("DASH: other adaptation sets (e.g. audio) are not included")
+	}
+
+	variants := make([]Variant, len(set.Representations))
+	for i, r := range set.Representations {
+		variants[i] = Variant{URL: r.ID, Bandwidth: r.Bandwidth, Width: r.Width, Height: r.Height, Codecs: r.Codecs}
+	}
+	i := pick(variants, spec)
+	rep := set.Representations[i]
+
+	for _, b := range []string{m.BaseURL, period.BaseURL, set.BaseURL, rep.BaseURL} {
+		if b = strings.TrimSpace(b); b == "" {
+			continue
+		}
+		next, err := base.Parse(b)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BaseURL %q", b)
+		}
+		base = next
+	}
+
+	media := &Media{Variant: variants[i], Duration: duration, Ext: dashExt(rep.MimeType, set.MimeType, set.ContentType)}
+	var err error
+	switch {
+	case rep.List != nil || set.List != nil:
+		list := rep.List
+		if list == nil {
+			list = set.List
+		}
+		media.Init, media.Segments, err = listSegments(list, base)
+	case rep.Template != nil || set.Template != nil:
+		tmpl := mergeTemplates(set.Template, rep.Template)
+		media.Init, media.Segments, err = templateSegments(tmpl, rep, base, duration)
+	default:
+		// SegmentBase or nothing: the representation is one whole file
+		media.Segments = []Segment{{URL: base.String()}}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return media, nil
+}
+
+// chooseSet returns the first adaptation set with video, else with audio,
+// else the first with representations. others reports whether sets were left out.
+func chooseSet(sets []adaptationSet) (set *adaptationSet, others bool) {
+	kind := func(s adaptationSet) string {
+		mime := s.MimeType
+		if mime == "" && len(s.Representations) > 0 {
+			mime = s.Representations[0].MimeType
+		}
+		if s.ContentType != "" {
+			return s.ContentType
+		}
+		kind, _, _ := strings.Cut(mime, "/")
+		return kind
+	}
+
+	var usable []int
+	for i := range sets {
+		if len(sets[i].Representations) > 0 && kind(sets[i]) != "text" {
+			usable = append(usable, i)
+		}
+	}
+	for _, want := range []string{"video", "audio", ""} {
+		for _, i := range usable {
+			if want == "" || kind(sets[i]) == want {
+				return &sets[i], len(usable) > 1
+			}
+		}
+	}
+	return nil, false
+}
+
+// dashExt picks the joined file's extension from the first MIME type given
+func dashExt(mimes ...string) string {
+	for _, mime := range mimes {
+		switch mime {
+		case "video/mp4":
+			return ".mp4"
+		case "audio/mp4":
+			return ".m4a"
+		case "video/webm", "audio/webm":
+			return ".webm"
+		}
+	}
+	return ".mp4"
+}
+
+// listSegments reads an explicit SegmentList
+func listSegments(list *segmentList, base *url.URL) (*Segment, []Segment, error) {
+	var init *Segment
+	if in := list.Initialization; in != nil {
+		seg, err := dashSegment(base, in.SourceURL, in.Range)
+		if err != nil {
+			return nil, nil, err
+		}
+		init = &seg
+	}
+	segs := make([]Segment, 0, len(list.URLs))
+	for _, u := range list.URLs {
+		seg, err := dashSegment(base, u.Media, u.MediaRange)
+		if err != nil {
+			return nil, nil, err
+		}
+		segs = append(segs, seg)
+	}
+	return init, segs, nil
+}
+
+// dashSegment resolves a segment link with an optional "first-last" byte range
+func dashSegment(base *url.URL, link, byteRange string) (Segment, error) {
+	u, err := base.Parse(link)
+	if err != nil {
+		return Segment{}, fmt.Errorf("invalid segment URL %q", link)
+	}
+	seg := Segment{URL: u.String()}
+	if byteRange != "" {
+		first, last, ok := strings.Cut(byteRange, "-")
+		f, ferr := strconv.ParseInt(first, 10, 64)
+		l, lerr := strconv.ParseInt(last, 10, 64)
+		if !ok || ferr != nil || lerr != nil || l < f {
+			return Segment{}, fmt.Errorf("invalid byte range %q", byteRange)
+		}
+		seg.Offset, seg.Length = f, l-f+1
+	}
+	return seg, nil
+}
+
+// mergeTemplates fills what a representation's template leaves out from the
+// adaptation set's
+func mergeTemplates(parent, child *segmentTemplate) segmentTemplate {
+	var t segmentTemplate
+	if parent != nil {
+		t = *parent
+	}
+	if child == nil {
+		return t
+	}
+	if child.Media != "" {
+		t.Media = child.Media
+	}
+	if child.Initialization != "" {
+		t.Initialization = child.Initialization
+	}
+	if child.StartNumber != nil {
+		t.StartNumber = child.StartNumber
+	}
+	if child.Timescale != nil {
+		t.Timescale = child.Timescale
+	}
+	if child.Duration != nil {
+		t.Duration = child.Duration
+	}
+	if child.Timeline != nil {
+		t.Timeline = child.Timeline
+	}
+	return t
+}
+
+// templateSegments expands a SegmentTemplate, by its timeline when it has
+// one, else by a fixed duration over the period
+func templateSegments(t segmentTemplate, rep representation, base *url.URL, period time.Duration) (*Segment, []Segment, error) {
+	if t.Media == "" {
+		return nil, nil, fmt.Errorf("%w: SegmentTemplate without media", ErrUnsupported)
+	}
+	number := int64(1)
+	if t.StartNumber != nil {
+		number = *t.StartNumber
+	}
+	timescale := int64(1)
+	if t.Timescale != nil && *t.Timescale > 0 {
+		timescale = *t.Timescale
+	}
+
+	expand := func(tmpl string, num, tm int64) (Segment, error) {
+		return dashSegment(base, expandTemplate(tmpl, rep, num, tm), "")
+	}
+
+	var init *Segment
+	if t.Initialization != "" {
+		seg, err := expand(t.Initialization, 0, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		init = &seg
+	}
+
+	var segs []Segment
+	add := func(tm int64) error {
+		if len(segs) >= maxSegments {
+			return fmt.Errorf("%w: more than %d segments", ErrUnsupported, maxSegments)
+		}
+		seg, err := expand(t.Media, number, tm)
+		if err != nil {
+			return err
+		}
+		segs = append(segs, seg)
+		number++
+		return nil
+	}
+
+	if t.Timeline != nil {
+		end := int64(period.Seconds() * float64(timescale))
+		var tm int64
+		for i, s := range t.Timeline.S {
+			if s.T != nil {
+				tm = *s.T
+			}
+			if s.D <= 0 {
+				return nil, nil, fmt.Errorf("%w: timeline entry without duration", ErrUnsupported)
+			}
+			repeat := s.R
+			if repeat < 0 {
+				// Repeat until the next entry's start, or the end of the period
+				until := end
+				if i+1 < len(t.Timeline.S) && t.Timeline.S[i+1].T != nil {
+					until = *t.Timeline.S[i+1].T
+				}
+				repeat = int64(math.Ceil(float64(until-tm)/float64(s.D))) - 1
+			}
+			for r := int64(0); r <= repeat; r++ {
+				if err := add(tm); err != nil {
+					return nil, nil, err
+				}
+				tm += s.D
+			}
+		}
+		return init, segs, nil
+	}
+
+	if t.Duration == nil || *t.Duration <= 0 {
+		return nil, nil, fmt.Errorf("%w: SegmentTemplate without duration or timeline", ErrUnsupported)
+	}
+	if period <= 0 {
+		return nil, nil, fmt.Errorf("%w: manifest without a duration", ErrUnsupported)
+	}
+	count := int64(math.Ceil(period.Seconds() * float64(timescale) / float64(*t.Duration)))
+	for i := int64(0); i < count; i++ {
+		if err := add(i * *t.Duration); err != nil {
+			return nil, nil, err
+		}
+	}
+	return init, segs, nil
+}
+
+// expandTemplate fills in $RepresentationID$, $Number$, $Bandwidth$ and
+// $Time$, with optional widths such as $Number%05d$
+func expandTemplate(tmpl string, rep representation, number, tm int64) string {
+	out := templateVar.ReplaceAllStringFunc(tmpl, func(m string) string {
+		parts := templateVar.FindStringSubmatch(m)
+		var v string
+		switch parts[1] {
+		case "RepresentationID":
+			return rep.ID
+		case "Number":
+			v = strconv.FormatInt(number, 10)
+		case "Bandwidth":
+			v = strconv.FormatInt(rep.Bandwidth, 10)
+		case "Time":
+			v = strconv.FormatInt(tm, 10)
+		}
+		if width, err := strconv.Atoi(parts[3]); err == nil && len(v) < width {
+			v = strings.Repeat("0", width-len(v)) + v
+		}
+		return v
+	})
+	return strings.ReplaceAll(out, "$$", "$")
+}
+
+// parseISODuration reads an xs:duration such as "PT1H2M3.5S". Years and
+// months count as 365 and 30 days.
+func parseISODuration(s string) (time.Duration, error) {
+	m := isoDuration.FindStringSubmatch(strings.TrimSpace(s))
+	if m == nil || s == "P" || s == "PT" {
+		return 0, fmt.Errorf("invalid duration %q", s)
+	}
+	units := []time.Duration{365 * 24 * time.Hour, 30 * 24 * time.Hour, 7 * 24 * time.Hour, 24 * time.Hour, time.Hour, time.Minute, time.Second}
+	var total float64
+	for i, unit := range units {
+		if m[i+1] == "" {
+			continue
+		}
+		n, err := strconv.ParseFloat(m[i+1], 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid duration %q", s)
+		}
+		total += n * float64(unit)
+	}
+	return time.Duration(total), nil
+}
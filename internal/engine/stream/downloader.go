@@ -0,0 +1,591 @@
+package stream
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/checksum"
+	"github.com/surge-downloader/surge/internal/engine/metrics"
+	"github.com/surge-downloader/surge/internal/engine/ratelimit"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// joinWindow is how many segments per connection may wait on disk for an
+// earlier one, bounding the space used by segments fetched out of order
+const joinWindow = 2
+
+// Downloader fetches the segments of a stream over parallel connections.
+// Each segment is written to its own spool file, and finished spools are
+// appended to the working file in order. Pause keeps the joined prefix, so
+// a resumed download continues with the first segment not yet joined, and
+// the joined prefix is checkpointed while running so a crash resumes too.
+type Downloader struct {
+	ID           string
+	ProgressChan chan<- any           // Channel for events (start/complete/error)
+	State        *types.ProgressState // Shared state for TUI polling
+	Runtime      *types.RuntimeConfig
+	Client       *http.Client
+	Headers      map[string]string  // Custom HTTP headers (cookies, auth, etc.), sent with every segment
+	Checksum     string             // Expected digest of the finished file ("algo:hex"), optional
+	Category     string             // Category name saved with the pause state, optional
+	Limiter      *ratelimit.Limiter // Per-download bandwidth cap shared by all connections, optional
+	Validators   types.Validators   // Version of the manifest, saved for resume checks
+	Variant      string             // Rendition choice saved with the pause state
+
+	keysMu sync.Mutex
+	keys   map[string][]byte // AES-128 keys by URL
+}
+
+// NewDownloader creates a stream downloader with all required parameters
+func NewDownloader(id string, progressCh chan<- any, progState *types.ProgressState, runtime *types.RuntimeConfig) *Downloader {
+	return &Downloader{
+		ID:           id,
+		ProgressChan: progressCh,
+		State:        progState,
+		Runtime:      runtime,
+		Client:       &http.Client{Timeout: 0},
+		keys:         make(map[string][]byte),
+	}
+}
+
+// Download fetches the segments of media, listed by the manifest at rawurl,
+// and joins them into destPath
+func (d *Downloader) Download(ctx context.Context, rawurl string, media *Media, destPath string) error {
+	workingPath := destPath + types.IncompleteSuffix
+	segs := media.All()
+	next, written := d.restore(rawurl, destPath, workingPath, len(segs))
+
+	file, err := os.OpenFile(workingPath, os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to create file: %w", err)
+	}
+	keep := false
+	defer func() {
+		_ = file.Close()
+		if !keep {
+			_ = os.Remove(workingPath)
+		}
+	}()
+	if err := file.Truncate(written); err != nil {
+		return fmt.Errorf("truncate error: %w", err)
+	}
+	if _, err := file.Seek(written, io.SeekStart); err != nil {
+		return fmt.Errorf("seek error: %w", err)
+	}
+
+	start := time.Now()
+	lastCheckpoint, checkpointed := start, false
+	checkpoint := func(next int, written int64) {
+		if d.ID == "" || time.Since(lastCheckpoint) < d.Runtime.GetCheckpointInterval() {
+			return
+		}
+		lastCheckpoint = time.Now()
+		if err := d.checkpoint(rawurl, destPath, file, next, written, start); err != nil {
+			utils.Debug("Checkpoint failed: %v", err)
+			return
+		}
+		checkpointed = true
+	}
+	next, written, err = d.run(ctx, segs, file, workingPath, next, written, checkpoint)
+
+	if d.State != nil && d.State.IsPaused() {
+		keep = true
+		d.savePauseState(rawurl, destPath, file, next, written, start)
+		return types.ErrPaused
+	}
+	if err != nil {
+		// The download was removed; don't leave a checkpoint that would bring it back
+		if checkpointed && ctx.Err() != nil {
+			_ = state.DeleteState(d.ID, rawurl, destPath)
+		}
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	_ = file.Close()
+
+	if d.Checksum != "" {
+		if err := checksum.VerifyFile(workingPath, d.Checksum); err != nil {
+			_ = state.DeleteState(d.ID, rawurl, destPath)
+			return err
+		}
+	}
+	if err := os.Rename(workingPath, destPath); err != nil {
+		return fmt.Errorf("failed to rename completed file: %w", err)
+	}
+	keep = true
+	_ = state.DeleteState(d.ID, rawurl, destPath)
+	if d.State != nil {
+		d.State.SetTotalSize(written)
+	}
+
+	utils.Debug("Stream download of %s finished: %d segments, %d bytes in %v", destPath, len(segs), written, time.Since(start))
+	return nil
+}
+
+// restore returns the first segment to fetch and the bytes already joined
+// for a paused download, or zeroes to start fresh
+func (d *Downloader) restore(rawurl, destPath, workingPath string, total int) (int, int64) {
+	fresh := func() (int, int64) {
+		if d.State != nil {
+			d.State.Downloaded.Store(0)
+			d.State.VerifiedProgress.Store(0)
+			d.State.SyncSessionStart()
+		}
+		return 0, 0
+	}
+
+	saved, err := state.LoadState(rawurl, destPath)
+	if err != nil || saved == nil || saved.Segments <= 0 {
+		return fresh()
+	}
+	if saved.Segments > total {
+		utils.Debug("Stream resume: %d segments joined but the stream has %d, restarting", saved.Segments, total)
+		return fresh()
+	}
+	if info, err := os.Stat(workingPath); err != nil || info.Size() < saved.Downloaded {
+		utils.Debug("Stream resume: working file missing or shorter than saved progress, restarting")
+		return fresh()
+	}
+
+	if d.State != nil {
+		d.State.Downloaded.Store(saved.Downloaded)
+		d.State.VerifiedProgress.Store(saved.Downloaded)
+		d.State.SetSavedElapsed(time.Duration(saved.Elapsed))
+		d.State.SyncSessionStart()
+	}
+	utils.Debug("Stream resume: %d of %d segments, %d bytes joined", saved.Segments, total, saved.Downloaded)
+	return saved.Segments, saved.Downloaded
+}
+
+// connections returns how many segments to fetch at once
+func (d *Downloader) connections(segments int) int {
+	conns := d.Runtime.GetMaxConnectionsPerHost()
+	if segments < conns {
+		conns = segments
+	}
+	if conns < 1 {
+		conns = 1
+	}
+	return conns
+}
+
+// spoolPath is where segment i waits to be joined
+func spoolPath(workingPath string, i int) string {
+	return fmt.Sprintf("%s.%d", workingPath, i)
+}
+
+// run fetches segs[next:] over parallel connections and appends each to file
+// once every segment before it is there, calling checkpoint as the joined
+// prefix grows. It returns how far the joined file got, which on error or
+// cancellation is where a resume starts.
+func (d *Downloader) run(ctx context.Context, segs []Segment, file *os.File, workingPath string, next int, written int64, checkpoint func(next int, written int64)) (int, int64, error) {
+	if next >= len(segs) {
+		return next, written, nil
+	}
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	conns := d.connections(len(segs) - next)
+	queue := make(chan int, len(segs)-next)
+	for i := next; i < len(segs); i++ {
+		queue <- i
+	}
+	close(queue)
+
+	// A worker takes a slot before each segment and the joiner frees it, so
+	// the segments on disk are always the ones right after the joined prefix
+	slots := make(chan struct{}, conns*joinWindow)
+	fetched := make(chan int, len(segs))
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	fail := func(err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		if firstErr == nil {
+			firstErr = err
+			cancel() // Stop the other connections
+		}
+	}
+
+	for i := 0; i < conns; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := d.worker(runCtx, segs, workingPath, queue, slots, fetched); err != nil {
+				fail(err)
+			}
+		}()
+	}
+	go func() {
+		wg.Wait()
+		close(fetched)
+	}()
+
+	ready := make(map[int]bool)
+	for i := range fetched {
+		ready[i] = true
+		if runCtx.Err() != nil {
+			continue // Drain until the workers are gone
+		}
+		for ready[next] {
+			n, err := appendSpool(file, spoolPath(workingPath, next))
+			if err != nil {
+				fail(err)
+				break
+			}
+			delete(ready, next)
+			next++
+			written += n
+			if d.State != nil {
+				d.State.VerifiedProgress.Store(written)
+			}
+			<-slots
+		}
+		if runCtx.Err() == nil {
+			checkpoint(next, written)
+		}
+	}
+	for i := range ready {
+		_ = os.Remove(spoolPath(workingPath, i))
+	}
+
+	if d.State != nil {
+		d.State.Downloaded.Store(written)
+	}
+	if firstErr != nil {
+		return next, written, firstErr
+	}
+	if err := ctx.Err(); err != nil {
+		return next, written, err
+	}
+	return next, written, nil
+}
+
+// worker fetches segments from the queue into their spool files until the
+// queue is empty or the download stops
+func (d *Downloader) worker(ctx context.Context, segs []Segment, workingPath string, queue <-chan int, slots chan struct{}, fetched chan<- int) error {
+	if d.State != nil {
+		d.State.ActiveWorkers.Add(1)
+		defer d.State.ActiveWorkers.Add(-1)
+	}
+	buf := make([]byte, d.Runtime.GetWorkerBufferSize())
+
+	for {
+		select {
+		case slots <- struct{}{}:
+		case <-ctx.Done():
+			return nil
+		}
+		i, ok := <-queue
+		if !ok {
+			return nil
+		}
+
+		spool := spoolPath(workingPath, i)
+		if err := d.fetchWithRetry(ctx, segs[i], spool, buf); err != nil {
+			_ = os.Remove(spool)
+			if ctx.Err() != nil {
+				return nil
+			}
+			return fmt.Errorf("segment %d of %d: %w", i+1, len(segs), err)
+		}
+		fetched <- i
+	}
+}
+
+// fetchWithRetry fetches one segment, retrying with backoff
+func (d *Downloader) fetchWithRetry(ctx context.Context, seg Segment, spool string, buf []byte) error {
+	var lastErr error
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 {
+			if attempt >= d.Runtime.GetMaxTaskRetries() {
+				return fmt.Errorf("failed after %d attempts: %w", attempt, lastErr)
+			}
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(1<<attempt) * types.RetryBaseDelay):
+			}
+		}
+
+		n, err := d.fetch(ctx, seg, spool, buf)
+		if err == nil {
+			return nil
+		}
+		if d.State != nil {
+			d.State.Downloaded.Add(-n) // The retry fetches it again
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		utils.Debug("Stream segment %s failed: %v", seg.URL, err)
+		lastErr = err
+	}
+}
+
+// fetch downloads one segment into its spool file, decrypting it if needed.
+// It returns the bytes received, which count towards progress.
+func (d *Downloader) fetch(ctx context.Context, seg Segment, spool string, buf []byte) (int64, error) {
+	out, err := os.Create(spool)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = out.Close() }()
+
+	var w io.Writer = out
+	var dec *decrypter
+	if seg.Key != "" {
+		key, err := d.key(ctx, seg.Key)
+		if err != nil {
+			return 0, err
+		}
+		if dec, err = newDecrypter(out, key, seg.IV); err != nil {
+			return 0, err
+		}
+		w = dec
+	}
+
+	f := d.fetcher()
+	req, err := f.request(ctx, seg.URL)
+	if err != nil {
+		return 0, err
+	}
+	if seg.Length > 0 {
+		req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", seg.Offset, seg.Offset+seg.Length-1))
+	}
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	want := http.StatusOK
+	if seg.Length > 0 {
+		want = http.StatusPartialContent
+	}
+	if resp.StatusCode != want {
+		return 0, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+
+	var received int64
+	for {
+		// Keep reads short under a bandwidth cap so throttling stays smooth
+		readLen := d.Limiter.ChunkSize(ratelimit.Global().ChunkSize(len(buf)))
+		nr, readErr := resp.Body.Read(buf[:readLen])
+		if nr > 0 {
+			if _, err := w.Write(buf[:nr]); err != nil {
+				return received, fmt.Errorf("write error: %w", err)
+			}
+			received += int64(nr)
+			metrics.BytesDownloaded.Add(int64(nr))
+			if d.State != nil {
+				d.State.Downloaded.Add(int64(nr))
+			}
+			if err := ratelimit.Global().WaitN(ctx, nr); err != nil {
+				return received, err
+			}
+			if err := d.Limiter.WaitN(ctx, nr); err != nil {
+				return received, err
+			}
+		}
+		if readErr == io.EOF {
+			break
+		}
+		if readErr != nil {
+			return received, fmt.Errorf("read error: %w", readErr)
+		}
+	}
+	if resp.ContentLength > 0 && received != resp.ContentLength {
+		return received, fmt.Errorf("read error: %w after %d of %d bytes", io.ErrUnexpectedEOF, received, resp.ContentLength)
+	}
+
+	if dec != nil {
+		if err := dec.Close(); err != nil {
+			return received, err
+		}
+	}
+	return received, out.Close()
+}
+
+func (d *Downloader) fetcher() *fetcher {
+	return &fetcher{client: d.Client, headers: d.Headers, userAgent: d.Runtime.GetUserAgent()}
+}
+
+// key returns the AES-128 key at keyURL, fetching it once per download
+func (d *Downloader) key(ctx context.Context, keyURL string) ([]byte, error) {
+	d.keysMu.Lock()
+	defer d.keysMu.Unlock()
+	if key, ok := d.keys[keyURL]; ok {
+		return key, nil
+	}
+
+	f := d.fetcher()
+	req, err := f.request(ctx, keyURL)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := d.Client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("fetching key: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("fetching key: unexpected status %s", resp.Status)
+	}
+	key, err := io.ReadAll(io.LimitReader(resp.Body, aes.BlockSize+1))
+	if err != nil {
+		return nil, fmt.Errorf("fetching key: %w", err)
+	}
+	if len(key) != aes.BlockSize {
+		return nil, fmt.Errorf("key at %s is %d bytes, want %d", keyURL, len(key), aes.BlockSize)
+	}
+	d.keys[keyURL] = key
+	return key, nil
+}
+
+// appendSpool appends a segment's spool file to the joined file and removes it
+func appendSpool(file *os.File, spool string) (int64, error) {
+	in, err := os.Open(spool)
+	if err != nil {
+		return 0, err
+	}
+	n, err := io.Copy(file, in)
+	_ = in.Close()
+	if err != nil {
+		return 0, fmt.Errorf("joining segment: %w", err)
+	}
+	_ = os.Remove(spool)
+	return n, nil
+}
+
+// savePauseState persists how many segments are joined for resume
+func (d *Downloader) savePauseState(rawurl, destPath string, file *os.File, next int, written int64, start time.Time) {
+	if err := file.Sync(); err != nil {
+		utils.Debug("Failed to sync before pause: %v", err)
+	}
+
+	elapsed := d.elapsed(start)
+	if d.State != nil {
+		d.State.FinalizePause(written, elapsed)
+	}
+	if err := state.SaveState(rawurl, destPath, d.resumeState(rawurl, destPath, next, written, elapsed)); err != nil {
+		utils.Debug("Failed to save stream pause state: %v", err)
+	}
+	utils.Debug("Stream download paused, state saved (Segments=%d, Downloaded=%d)", next, written)
+}
+
+// checkpoint saves the joined prefix of a running download, so it resumes
+// from there after a crash. The file is synced first so every byte the
+// checkpoint counts is on disk.
+func (d *Downloader) checkpoint(rawurl, destPath string, file *os.File, next int, written int64, start time.Time) error {
+	if err := file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync file: %w", err)
+	}
+	return state.SaveCheckpoint(rawurl, destPath, d.resumeState(rawurl, destPath, next, written, d.elapsed(start)))
+}
+
+// elapsed returns the time spent on the download, earlier sessions included
+func (d *Downloader) elapsed(start time.Time) time.Duration {
+	elapsed := time.Since(start)
+	if d.State != nil {
+		elapsed += d.State.GetSavedElapsed()
+	}
+	return elapsed
+}
+
+// resumeState builds the state a later run resumes from
+func (d *Downloader) resumeState(rawurl, destPath string, next int, written int64, elapsed time.Duration) *types.DownloadState {
+	var totalSize int64
+	if d.State != nil {
+		_, totalSize, _, _, _, _ = d.State.GetProgress()
+	}
+	return &types.DownloadState{
+		URL:        rawurl,
+		ID:         d.ID,
+		DestPath:   destPath,
+		TotalSize:  totalSize,
+		Downloaded: written,
+		Filename:   filepath.Base(destPath),
+		Elapsed:    elapsed.Nanoseconds(),
+		Checksum:   d.Checksum,
+		Category:   d.Category,
+		RateLimit:  d.Limiter.Rate(),
+		Validators: d.Validators,
+		Variant:    d.Variant,
+		Segments:   next,
+	}
+}
+
+// errBadPadding means a segment did not decrypt to valid PKCS#7 padding,
+// usually because the key or IV is wrong
+var errBadPadding = errors.New("decryption failed: bad padding")
+
+// decrypter undoes AES-128-CBC as data streams through. The last block is
+// held back until Close, which strips its PKCS#7 padding.
+type decrypter struct {
+	dst  io.Writer
+	mode cipher.BlockMode
+	buf  []byte
+}
+
+func newDecrypter(dst io.Writer, key, iv []byte) (*decrypter, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	if len(iv) != aes.BlockSize {
+		return nil, fmt.Errorf("IV is %d bytes, want %d", len(iv), aes.BlockSize)
+	}
+	return &decrypter{dst: dst, mode: cipher.NewCBCDecrypter(block, iv)}, nil
+}
+
+func (c *decrypter) Write(p []byte) (int, error) {
+	c.buf = append(c.buf, p...)
+	// Keep at least one whole block for Close
+	n := (len(c.buf) - 1) / aes.BlockSize * aes.BlockSize
+	if n > 0 {
+		c.mode.CryptBlocks(c.buf[:n], c.buf[:n])
+		if _, err := c.dst.Write(c.buf[:n]); err != nil {
+			return 0, err
+		}
+		c.buf = append(c.buf[:0], c.buf[n:]...)
+	}
+	return len(p), nil
+}
+
+// Close decrypts the final block and writes it without its padding
+func (c *decrypter) Close() error {
+	if len(c.buf) != aes.BlockSize {
+		return fmt.Errorf("decryption failed: segment is not a whole number of blocks")
+	}
+	c.mode.CryptBlocks(c.buf, c.buf)
+	pad := int(c.buf[aes.BlockSize-1])
+	if pad == 0 || pad > aes.BlockSize {
+		return errBadPadding
+	}
+	for _, b := range c.buf[aes.BlockSize-pad:] {
+		if int(b) != pad {
+			return errBadPadding
+		}
+	}
+	_, err := c.dst.Write(c.buf[:aes.BlockSize-pad])
+	return err
+}
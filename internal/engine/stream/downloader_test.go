@@ -0,0 +1,357 @@
+package stream
+
+import (
+	"bytes"
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/testutil"
+)
+
+func initTestState(t *testing.T) (string, func()) {
+	state.CloseDB() // Ensure any previous DB is closed
+
+	tmpDir, cleanup, err := testutil.TempDir("surge-stream-test")
+	if err != nil {
+		t.Fatalf("Failed to create temp dir: %v", err)
+	}
+	state.Configure(filepath.Join(tmpDir, "surge.db"))
+
+	return tmpDir, func() {
+		state.CloseDB()
+		cleanup()
+	}
+}
+
+var testKey = []byte("0123456789abcdef")
+
+// encrypt applies AES-128-CBC with PKCS#7 padding, as an HLS packager does
+func encrypt(t *testing.T, plain, iv []byte) []byte {
+	t.Helper()
+	block, err := aes.NewCipher(testKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pad := aes.BlockSize - len(plain)%aes.BlockSize
+	out := append(append([]byte(nil), plain...), bytes.Repeat([]byte{byte(pad)}, pad)...)
+	cipher.NewCBCEncrypter(block, iv).CryptBlocks(out, out)
+	return out
+}
+
+// hlsServer serves a master playlist, one media playlist and its segments.
+// Segments from the second on are encrypted. The first slow segments are
+// delayed, so later ones finish first.
+type hlsServer struct {
+	*httptest.Server
+	plain [][]byte // Clear content of each segment
+
+	mu       sync.Mutex
+	requests map[string]int
+	headers  []string // X-Token of every segment request
+}
+
+func newHLSServer(t *testing.T, segments, slow int, delay time.Duration) *hlsServer {
+	s := &hlsServer{requests: make(map[string]int)}
+	body := make(map[string][]byte)
+
+	var media strings.Builder
+	media.WriteString("#EXTM3U\n#EXT-X-TARGETDURATION:2\n#EXT-X-MEDIA-SEQUENCE:0\n")
+	for i := 0; i < segments; i++ {
+		plain := bytes.Repeat([]byte{byte('a' + i%26)}, 1000+i*37)
+		s.plain = append(s.plain, plain)
+		name := fmt.Sprintf("seg%d.ts", i)
+		if i == 1 {
+			media.WriteString("#EXT-X-KEY:METHOD=AES-128,URI=\"/key\"\n")
+		}
+		if i >= 1 {
+			plain = encrypt(t, plain, sequenceIV(uint64(i)))
+		}
+		body["/hi/"+name] = plain
+		media.WriteString("#EXTINF:2.0,\n" + name + "\n")
+	}
+	media.WriteString("#EXT-X-ENDLIST\n")
+	body["/hi/index.m3u8"] = []byte(media.String())
+	body["/master.m3u8"] = []byte("#EXTM3U\n#EXT-X-STREAM-INF:BANDWIDTH=100000,RESOLUTION=320x180\nlo/index.m3u8\n" +
+		"#EXT-X-STREAM-INF:BANDWIDTH=9000000,RESOLUTION=1920x1080\nhi/index.m3u8\n")
+	body["/key"] = testKey
+
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		s.requests[r.URL.Path]++
+		if strings.HasSuffix(r.URL.Path, ".ts") {
+			s.headers = append(s.headers, r.Header.Get("X-Token"))
+		}
+		s.mu.Unlock()
+
+		data, ok := body[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		if n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/hi/seg"), ".ts")); err == nil && n < slow {
+			time.Sleep(delay)
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(data)))
+		_, _ = w.Write(data)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *hlsServer) joined() []byte {
+	return bytes.Join(s.plain, nil)
+}
+
+func (s *hlsServer) count(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[path]
+}
+
+func newTestDownloader() *Downloader {
+	d := NewDownloader("stream-test", nil, types.NewProgressState("stream-test", 0), &types.RuntimeConfig{MaxConnectionsPerHost: 4})
+	d.Headers = map[string]string{"X-Token": "secret"}
+	return d
+}
+
+func assertFile(t *testing.T, path string, want []byte) {
+	t.Helper()
+	got, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("failed to read %s: %v", path, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("%s: got %d bytes, want %d (content differs)", path, len(got), len(want))
+	}
+}
+
+func TestDownloader_HLS(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	srv := newHLSServer(t, 12, 3, 30*time.Millisecond)
+	rawurl := srv.URL + "/master.m3u8"
+	media, err := Load(context.Background(), rawurl, map[string]string{"X-Token": "secret"}, "", "")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if media.Variant.Height != 1080 || media.Ext != ".ts" || media.ContentType != "video/mp2t" || len(media.Segments) != 12 {
+		t.Fatalf("media = %+v", media)
+	}
+	if media.EstimatedSize() != 9000000/8*24 {
+		t.Errorf("EstimatedSize = %d", media.EstimatedSize())
+	}
+
+	d := newTestDownloader()
+	destPath := filepath.Join(tmpDir, "video.ts")
+	if err := d.Download(context.Background(), rawurl, media, destPath); err != nil {
+		t.Fatalf("Download failed: %v", err)
+	}
+	assertFile(t, destPath, srv.joined())
+
+	if n := srv.count("/key"); n != 1 {
+		t.Errorf("key fetched %d times, want once", n)
+	}
+	for _, h := range srv.headers {
+		if h != "secret" {
+			t.Errorf("segment request without the download's headers: %q", h)
+		}
+	}
+	if _, total, _, _, _, _ := d.State.GetProgress(); total != int64(len(srv.joined())) {
+		t.Errorf("total = %d, want %d", total, len(srv.joined()))
+	}
+	matches, _ := filepath.Glob(filepath.Join(tmpDir, "video.ts"+types.IncompleteSuffix+"*"))
+	if len(matches) != 0 {
+		t.Errorf("working files left behind: %v", matches)
+	}
+}
+
+func TestDownloader_SegmentErrorFails(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	srv := newHLSServer(t, 4, 0, 0)
+	media := &Media{Segments: []Segment{{URL: srv.URL + "/hi/seg0.ts"}, {URL: srv.URL + "/hi/missing.ts"}}}
+	d := newTestDownloader()
+	d.Runtime.MaxTaskRetries = 2
+
+	destPath := filepath.Join(tmpDir, "broken.ts")
+	err := d.Download(context.Background(), srv.URL+"/hi/index.m3u8", media, destPath)
+	if err == nil || !strings.Contains(err.Error(), "segment 2 of 2") {
+		t.Fatalf("expected a segment error, got %v", err)
+	}
+	if n := srv.count("/hi/missing.ts"); n != 2 {
+		t.Errorf("missing segment requested %d times, want 2", n)
+	}
+	matches, _ := filepath.Glob(filepath.Join(tmpDir, "broken.ts*"))
+	if len(matches) != 0 {
+		t.Errorf("files left behind after failure: %v", matches)
+	}
+}
+
+func TestDownloader_PauseAndResume(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	srv := newHLSServer(t, 40, 40, 5*time.Millisecond)
+	rawurl := srv.URL + "/hi/index.m3u8"
+	media, err := Load(context.Background(), rawurl, nil, "", "")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	destPath := filepath.Join(tmpDir, "video.ts")
+
+	d := newTestDownloader()
+	d.Runtime.MaxConnectionsPerHost = 1
+	d.Variant = "720p"
+	ctx, cancel := context.WithCancel(context.Background())
+	d.State.SetCancelFunc(cancel)
+	go func() {
+		for d.State.VerifiedProgress.Load() < 10000 {
+			time.Sleep(time.Millisecond)
+		}
+		d.State.Pause()
+	}()
+
+	err = d.Download(ctx, rawurl, media, destPath)
+	if !errors.Is(err, types.ErrPaused) {
+		t.Fatalf("expected ErrPaused, got %v", err)
+	}
+	saved, err := state.LoadState(rawurl, destPath)
+	if err != nil {
+		t.Fatalf("pause state not saved: %v", err)
+	}
+	if saved.Segments <= 0 || saved.Segments >= 40 || saved.Variant != "720p" {
+		t.Fatalf("saved state = %d segments, variant %q; want partial progress", saved.Segments, saved.Variant)
+	}
+	var joined int64
+	for _, p := range srv.plain[:saved.Segments] {
+		joined += int64(len(p))
+	}
+	if saved.Downloaded != joined {
+		t.Errorf("saved %d bytes, want the %d bytes of the joined segments", saved.Downloaded, joined)
+	}
+
+	// Resume with a fresh downloader, as after a restart
+	before := srv.count("/hi/seg0.ts")
+	if err := newTestDownloader().Download(context.Background(), rawurl, media, destPath); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+	assertFile(t, destPath, srv.joined())
+	if srv.count("/hi/seg0.ts") != before {
+		t.Error("resume fetched a segment that was already joined")
+	}
+	if _, err := state.LoadState(rawurl, destPath); err == nil {
+		t.Error("state should be deleted after completion")
+	}
+}
+
+func TestDownloader_ResumeFromCheckpoint(t *testing.T) {
+	tmpDir, cleanup := initTestState(t)
+	defer cleanup()
+
+	srv := newHLSServer(t, 40, 40, 5*time.Millisecond)
+	rawurl := srv.URL + "/hi/index.m3u8"
+	media, err := Load(context.Background(), rawurl, nil, "", "")
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	destPath := filepath.Join(tmpDir, "video.ts")
+	workingPath := destPath + types.IncompleteSuffix
+	if _, err := state.GetDB(); err != nil { // Open it before the downloader and the test poll it
+		t.Fatal(err)
+	}
+
+	d := newTestDownloader()
+	d.Runtime.MaxConnectionsPerHost = 1
+	d.Runtime.CheckpointInterval = 20 * time.Millisecond
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() { errCh <- d.Download(ctx, rawurl, media, destPath) }()
+
+	// Capture what a crash right after a checkpoint would leave on disk
+	var saved *types.DownloadState
+	deadline := time.Now().Add(20 * time.Second)
+	for saved == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("no checkpoint was saved")
+		}
+		select {
+		case err := <-errCh:
+			t.Fatalf("download ended before a checkpoint was seen: %v", err)
+		default:
+		}
+		if s, err := state.LoadState(rawurl, destPath); err == nil && s.Segments > 0 {
+			saved = s
+		}
+		time.Sleep(time.Millisecond)
+	}
+	partial, err := os.ReadFile(workingPath)
+	if err != nil {
+		t.Fatalf("failed to read working file: %v", err)
+	}
+	if saved.Segments >= 40 || int64(len(partial)) < saved.Downloaded {
+		t.Fatalf("checkpoint = %d segments with %d bytes on disk, want partial progress", saved.Segments, len(partial))
+	}
+	if dl, _ := state.GetDownload("stream-test"); dl == nil || dl.Status != "downloading" {
+		t.Errorf("checkpointed entry = %+v, want status 'downloading'", dl)
+	}
+
+	// A plain cancel removes the download, checkpoint included
+	cancel()
+	if err := <-errCh; !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected context.Canceled, got %v", err)
+	}
+	if _, err := state.LoadState(rawurl, destPath); err == nil {
+		t.Error("checkpoint should be removed when the download is cancelled")
+	}
+
+	// Restore the crash leftovers and restart, as the next Surge run would
+	if err := os.WriteFile(workingPath, partial, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.SaveCheckpoint(rawurl, destPath, saved); err != nil {
+		t.Fatal(err)
+	}
+	if n, err := state.RequeueInterrupted(); err != nil || n != 1 {
+		t.Fatalf("RequeueInterrupted = %d, %v; want 1", n, err)
+	}
+
+	before := srv.count("/hi/seg0.ts")
+	if err := newTestDownloader().Download(context.Background(), rawurl, media, destPath); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+	assertFile(t, destPath, srv.joined())
+	if srv.count("/hi/seg0.ts") != before {
+		t.Error("resume fetched a segment that was already joined")
+	}
+}
+
+func TestDecrypterRejectsBadPadding(t *testing.T) {
+	iv := make([]byte, aes.BlockSize)
+	data := encrypt(t, []byte("hello"), iv)
+	var out bytes.Buffer
+	dec, err := newDecrypter(&out, []byte("fedcba9876543210"), iv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _ = dec.Write(data)
+	if err := dec.Close(); !errors.Is(err, errBadPadding) {
+		t.Errorf("wrong key: err = %v, want errBadPadding", err)
+	}
+}
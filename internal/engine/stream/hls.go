@@ -0,0 +1,314 @@
+package stream
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// playlist is a parsed HLS master or media playlist (RFC 8216)
+type playlist struct {
+	variants []Variant // Master playlist
+	segments []Segment // Media playlist
+	init     *Segment
+	duration time.Duration
+	ended    bool // No more segments will be added
+	audio    bool // Master playlist with audio in separate renditions
+}
+
+// loadHLS resolves a master playlist to one of its variants, or takes a
+// media playlist as it is
+func loadHLS(ctx context.Context, f *fetcher, data []byte, base *url.URL, spec VariantSpec) (*Media, error) {
+	pl, err := parseHLS(data, base)
+	if err != nil {
+		return nil, err
+	}
+
+	variant := Variant{URL: base.String()}
+	if len(pl.variants) > 0 {
+		variant = pl.variants[pick(pl.variants, spec)]
+		if pl.audio {
+			utils.Debug("HLS: audio is in a separate rendition and is not included")
+		}
+		data, base, _, err = f.manifest(ctx, variant.URL)
+		if err != nil {
+			return nil, err
+		}
+		if pl, err = parseHLS(data, base); err != nil {
+			return nil, err
+		}
+		if len(pl.variants) > 0 {
+			return nil, fmt.Errorf("%w: variant %s is another master playlist", ErrUnsupported, variant.URL)
+		}
+	}
+	if !pl.ended {
+		return nil, ErrLive
+	}
+
+	media := &Media{
+		Variant:  variant,
+		Init:     pl.init,
+		Segments: pl.segments,
+		Duration: pl.duration,
+		Ext:      ".ts",
+	}
+	if pl.init != nil {
+		media.Ext = ".mp4"
+	} else if len(pl.segments) > 0 {
+		// Packed audio is joined as it is
+		if u, err := url.Parse(pl.segments[0].URL); err == nil {
+			switch ext := strings.ToLower(path.Ext(u.Path)); ext {
+			case ".aac", ".mp3":
+				media.Ext = ext
+			}
+		}
+	}
+	return media, nil
+}
+
+// hlsKey is the encryption in force for the segments that follow it
+type hlsKey struct {
+	uri string
+	iv  []byte // nil to derive from the media sequence number
+}
+
+// parseHLS reads a playlist, resolving its links against base
+func parseHLS(data []byte, base *url.URL) (*playlist, error) {
+	pl := &playlist{}
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(make([]byte, 64*1024), maxManifestSize)
+
+	var (
+		first      = true
+		seq        uint64
+		key        *hlsKey
+		streamInf  map[string]string // Pending until its URI line
+		extinf     time.Duration
+		rangeLen   int64 = -1
+		rangeOff   int64
+		hasOffset  bool
+		lastURL    string
+		lastEnd    int64
+		lineNumber int
+	)
+
+	for sc.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		if first {
+			if !strings.HasPrefix(line, "#EXTM3U") {
+				return nil, fmt.Errorf("%w: not an HLS playlist", ErrUnsupported)
+			}
+			first = false
+			continue
+		}
+
+		if !strings.HasPrefix(line, "#") {
+			link, err := base.Parse(line)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid URI %q", lineNumber, line)
+			}
+			if streamInf != nil {
+				pl.variants = append(pl.variants, variantFromAttributes(link.String(), streamInf))
+				streamInf = nil
+				continue
+			}
+
+			seg := Segment{URL: link.String()}
+			if rangeLen >= 0 {
+				seg.Length = rangeLen
+				seg.Offset = rangeOff
+				if !hasOffset && seg.URL == lastURL {
+					seg.Offset = lastEnd
+				}
+				lastURL, lastEnd = seg.URL, seg.Offset+seg.Length
+				rangeLen = -1
+			}
+			if key != nil {
+				seg.Key, seg.IV = key.uri, key.iv
+				if seg.IV == nil {
+					seg.IV = sequenceIV(seq)
+				}
+			}
+			pl.segments = append(pl.segments, seg)
+			pl.duration += extinf
+			extinf = 0
+			seq++
+			continue
+		}
+
+		tag, value, _ := strings.Cut(line, ":")
+		switch tag {
+		case "#EXT-X-STREAM-INF":
+			streamInf = parseAttributes(value)
+		case "#EXT-X-MEDIA":
+			attrs := parseAttributes(value)
+			if attrs["TYPE"] == "AUDIO" && attrs["URI"] != "" {
+				pl.audio = true
+			}
+		case "#EXT-X-MEDIA-SEQUENCE":
+			n, err := strconv.ParseUint(value, 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: invalid media sequence %q", lineNumber, value)
+			}
+			seq = n
+		case "#EXTINF":
+			secs, _, _ := strings.Cut(value, ",")
+			d, err := strconv.ParseFloat(strings.TrimSpace(secs), 64)
+			if err != nil || d < 0 {
+				return nil, fmt.Errorf("line %d: invalid duration %q", lineNumber, secs)
+			}
+			extinf = time.Duration(d * float64(time.Second))
+		case "#EXT-X-BYTERANGE":
+			var err error
+			if rangeLen, rangeOff, hasOffset, err = parseByteRange(value); err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+		case "#EXT-X-KEY":
+			var err error
+			if key, err = parseKey(parseAttributes(value), base); err != nil {
+				return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+			}
+		case "#EXT-X-MAP":
+			attrs := parseAttributes(value)
+			link, err := base.Parse(attrs["URI"])
+			if attrs["URI"] == "" || err != nil {
+				return nil, fmt.Errorf("line %d: invalid EXT-X-MAP", lineNumber)
+			}
+			if pl.init != nil && pl.init.URL != link.String() {
+				return nil, fmt.Errorf("%w: initialization section changes mid-stream", ErrUnsupported)
+			}
+			init := &Segment{URL: link.String()}
+			if br := attrs["BYTERANGE"]; br != "" {
+				n, off, _, err := parseByteRange(br)
+				if err != nil {
+					return nil, fmt.Errorf("line %d: %w", lineNumber, err)
+				}
+				init.Length, init.Offset = n, off
+			}
+			if key != nil {
+				// Only an explicit IV applies to the initialization section
+				if key.iv == nil {
+					return nil, fmt.Errorf("%w: encrypted initialization section without an IV", ErrUnsupported)
+				}
+				init.Key, init.IV = key.uri, key.iv
+			}
+			pl.init = init
+		case "#EXT-X-ENDLIST":
+			pl.ended = true
+		case "#EXT-X-PLAYLIST-TYPE":
+			if value == "VOD" {
+				pl.ended = true
+			}
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	if first {
+		return nil, fmt.Errorf("%w: empty playlist", ErrUnsupported)
+	}
+	return pl, nil
+}
+
+// variantFromAttributes reads the EXT-X-STREAM-INF of a variant
+func variantFromAttributes(link string, attrs map[string]string) Variant {
+	v := Variant{URL: link, Codecs: attrs["CODECS"]}
+	v.Bandwidth, _ = strconv.ParseInt(attrs["BANDWIDTH"], 10, 64)
+	if w, h, ok := strings.Cut(attrs["RESOLUTION"], "x"); ok {
+		v.Width, _ = strconv.Atoi(w)
+		v.Height, _ = strconv.Atoi(h)
+	}
+	return v
+}
+
+// parseKey reads an EXT-X-KEY. METHOD=NONE returns nil.
+func parseKey(attrs map[string]string, base *url.URL) (*hlsKey, error) {
+	switch method := attrs["METHOD"]; method {
+	case "NONE":
+		return nil, nil
+	case "AES-128":
+	default:
+		return nil, fmt.Errorf("%w: %s encryption", ErrUnsupported, method)
+	}
+	if format := attrs["KEYFORMAT"]; format != "" && format != "identity" {
+		return nil, fmt.Errorf("%w: key format %s", ErrUnsupported, format)
+	}
+	link, err := base.Parse(attrs["URI"])
+	if attrs["URI"] == "" || err != nil {
+		return nil, fmt.Errorf("invalid key URI %q", attrs["URI"])
+	}
+
+	key := &hlsKey{uri: link.String()}
+	if raw := attrs["IV"]; raw != "" {
+		digits := strings.TrimPrefix(strings.TrimPrefix(raw, "0x"), "0X")
+		iv, err := hex.DecodeString(digits)
+		if err != nil || len(iv) > 16 {
+			return nil, fmt.Errorf("invalid IV %q", raw)
+		}
+		key.iv = make([]byte, 16)
+		copy(key.iv[16-len(iv):], iv)
+	}
+	return key, nil
+}
+
+// sequenceIV is the IV of a segment whose key doesn't give one: its media
+// sequence number as a big-endian 128-bit integer
+func sequenceIV(seq uint64) []byte {
+	iv := make([]byte, 16)
+	binary.BigEndian.PutUint64(iv[8:], seq)
+	return iv
+}
+
+// parseByteRange reads "length[@offset]"
+func parseByteRange(s string) (length, offset int64, hasOffset bool, err error) {
+	n, off, hasOffset := strings.Cut(strings.TrimSpace(s), "@")
+	if length, err = strconv.ParseInt(n, 10, 64); err != nil || length < 0 {
+		return 0, 0, false, fmt.Errorf("invalid byte range %q", s)
+	}
+	if hasOffset {
+		if offset, err = strconv.ParseInt(off, 10, 64); err != nil || offset < 0 {
+			return 0, 0, false, fmt.Errorf("invalid byte range %q", s)
+		}
+	}
+	return length, offset, hasOffset, nil
+}
+
+// parseAttributes reads an attribute list such as
+// BANDWIDTH=1280000,CODECS="avc1.4d401f,mp4a.40.2"
+func parseAttributes(s string) map[string]string {
+	attrs := make(map[string]string)
+	for s != "" {
+		key, rest, ok := strings.Cut(s, "=")
+		if !ok {
+			break
+		}
+		var val string
+		if strings.HasPrefix(rest, `"`) {
+			end := strings.IndexByte(rest[1:], '"')
+			if end < 0 {
+				val, rest = rest[1:], ""
+			} else {
+				val, rest = rest[1:end+1], rest[end+2:]
+			}
+		} else {
+			val, rest, _ = strings.Cut(rest, ",")
+		}
+		attrs[strings.ToUpper(strings.TrimSpace(key))] = val
+		s = strings.TrimLeft(rest, ", ")
+	}
+	return attrs
+}
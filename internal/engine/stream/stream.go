@@ -0,0 +1,324 @@
+// Package stream downloads HLS and DASH streams. The manifest is parsed, one
+// rendition picked, and its segments fetched in parallel and joined in order
+// into a single .ts or .mp4 file.
+package stream
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+const (
+	maxManifestSize = 16 << 20 // Manifests are text; anything larger is not one
+	maxHeight       = 4320     // Tallest video in common use (8K)
+)
+
+var (
+	// ErrLive is returned for live streams, which have no fixed list of segments
+	ErrLive = errors.New("live streams are not supported")
+	// ErrUnsupported is returned for manifests using features that can't be downloaded
+	ErrUnsupported = errors.New("unsupported stream")
+)
+
+// Variant is one rendition of a stream
+type Variant struct {
+	URL       string // Media playlist (HLS) or representation ID (DASH)
+	Bandwidth int64  // Bits per second, 0 if unknown
+	Width     int
+	Height    int
+	Codecs    string
+}
+
+// String describes a variant for logs, e.g. "1280x720 2.5 Mbps"
+func (v Variant) String() string {
+	var parts []string
+	if v.Width > 0 && v.Height > 0 {
+		parts = append(parts, fmt.Sprintf("%dx%d", v.Width, v.Height))
+	}
+	if v.Bandwidth > 0 {
+		parts = append(parts, fmt.Sprintf("%.1f Mbps", float64(v.Bandwidth)/1e6))
+	}
+	if len(parts) == 0 {
+		return v.URL
+	}
+	return strings.Join(parts, " ")
+}
+
+// Segment is one piece of a stream. Length is 0 for the whole resource.
+type Segment struct {
+	URL    string
+	Offset int64
+	Length int64
+	Key    string // URL of the AES-128 key, empty for clear segments
+	IV     []byte // 16 bytes when Key is set
+}
+
+// Media is a rendition resolved down to the segments to fetch
+type Media struct {
+	Variant     Variant
+	Init        *Segment // Initialization section written before the segments (fMP4), optional
+	Segments    []Segment
+	Duration    time.Duration
+	Ext         string // Extension of the joined file, e.g. ".ts"
+	ContentType string
+}
+
+// EstimatedSize guesses the joined size from the bandwidth and duration, or 0
+func (m *Media) EstimatedSize() int64 {
+	return int64(m.Duration.Seconds() * float64(m.Variant.Bandwidth) / 8)
+}
+
+// All returns the initialization section, if any, followed by the segments
+func (m *Media) All() []Segment {
+	if m.Init == nil {
+		return m.Segments
+	}
+	return append([]Segment{*m.Init}, m.Segments...)
+}
+
+var contentTypes = map[string]string{
+	".ts":   "video/mp2t",
+	".mp4":  "video/mp4",
+	".m4a":  "audio/mp4",
+	".webm": "video/webm",
+	".aac":  "audio/aac",
+	".mp3":  "audio/mpeg",
+}
+
+var (
+	hlsTypes  = []string{"application/vnd.apple.mpegurl", "application/x-mpegurl", "audio/mpegurl", "audio/x-mpegurl"}
+	dashTypes = []string{"application/dash+xml"}
+)
+
+// IsStream reports whether a URL or the content type it was served with names
+// an HLS playlist or DASH manifest
+func IsStream(rawurl, contentType string) bool {
+	return isHLS(rawurl, contentType) || isDASH(rawurl, contentType)
+}
+
+func isHLS(rawurl, contentType string) bool {
+	return hasType(contentType, hlsTypes) || hasExt(rawurl, ".m3u8")
+}
+
+func isDASH(rawurl, contentType string) bool {
+	return hasType(contentType, dashTypes) || hasExt(rawurl, ".mpd")
+}
+
+func hasType(contentType string, types []string) bool {
+	ct := strings.ToLower(strings.TrimSpace(strings.Split(contentType, ";")[0]))
+	for _, t := range types {
+		if ct == t {
+			return true
+		}
+	}
+	return false
+}
+
+func hasExt(rawurl, ext string) bool {
+	u, err := url.Parse(rawurl)
+	return err == nil && strings.EqualFold(path.Ext(u.Path), ext)
+}
+
+// Filename gives a stream's file the extension of what it holds, e.g.
+// "master.m3u8" becomes "master.ts". Names the user picked with another
+// extension are kept.
+func Filename(name, ext string) string {
+	cur := strings.ToLower(path.Ext(name))
+	switch cur {
+	case "", ".m3u8", ".m3u", ".mpd":
+		name = strings.TrimSuffix(name, path.Ext(name))
+		if name == "" {
+			name = "stream"
+		}
+		return name + ext
+	}
+	return name
+}
+
+// VariantSpec says which rendition to download
+type VariantSpec struct {
+	Worst     bool
+	Height    int   // e.g. 720 for "720p"; the tallest at or below it is picked
+	Width     int   // Set with Height for an exact "1280x720"
+	Bandwidth int64 // Bits per second; the highest at or below it is picked
+}
+
+// ParseVariant reads a rendition choice: "best" (or empty), "worst", a height
+// such as "720p" or "720", a resolution such as "1280x720", or a bandwidth
+// cap in bits per second such as "2500000", "2500k" or "2.5M"
+func ParseVariant(spec string) (VariantSpec, error) {
+	s := strings.ToLower(strings.TrimSpace(spec))
+	switch s {
+	case "", "best", "highest":
+		return VariantSpec{}, nil
+	case "worst", "lowest":
+		return VariantSpec{Worst: true}, nil
+	}
+	if h, ok := strings.CutSuffix(s, "p"); ok {
+		if n, err := strconv.Atoi(h); err == nil && n > 0 {
+			return VariantSpec{Height: n}, nil
+		}
+	}
+	// A bare number this small is a height, not bits per second
+	if n, err := strconv.Atoi(s); err == nil && n > 0 && n <= maxHeight {
+		return VariantSpec{Height: n}, nil
+	}
+	if w, h, ok := strings.Cut(s, "x"); ok {
+		wn, werr := strconv.Atoi(w)
+		hn, herr := strconv.Atoi(h)
+		if werr == nil && herr == nil && wn > 0 && hn > 0 {
+			return VariantSpec{Width: wn, Height: hn}, nil
+		}
+	}
+	mult := 1.0
+	switch {
+	case strings.HasSuffix(s, "k"):
+		mult, s = 1e3, strings.TrimSuffix(s, "k")
+	case strings.HasSuffix(s, "m"):
+		mult, s = 1e6, strings.TrimSuffix(s, "m")
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil && f > 0 {
+		return VariantSpec{Bandwidth: int64(f * mult)}, nil
+	}
+	return VariantSpec{}, fmt.Errorf("invalid variant %q: use best, worst, a height like 720p, a resolution like 1280x720 or a bandwidth like 2500k", spec)
+}
+
+// pick returns the index of the variant the spec asks for. When nothing
+// fits under a height or bandwidth cap, the smallest variant is used.
+func pick(variants []Variant, spec VariantSpec) int {
+	order := make([]int, len(variants))
+	for i := range order {
+		order[i] = i
+	}
+	// Best first: by bandwidth, then by pixels
+	sort.SliceStable(order, func(a, b int) bool {
+		va, vb := variants[order[a]], variants[order[b]]
+		if va.Bandwidth != vb.Bandwidth {
+			return va.Bandwidth > vb.Bandwidth
+		}
+		return va.Width*va.Height > vb.Width*vb.Height
+	})
+
+	switch {
+	case spec.Worst:
+		return order[len(order)-1]
+	case spec.Width > 0:
+		for _, i := range order {
+			if variants[i].Width == spec.Width && variants[i].Height == spec.Height {
+				return i
+			}
+		}
+		fallthrough
+	case spec.Height > 0:
+		best := -1
+		for _, i := range order {
+			h := variants[i].Height
+			if h > 0 && h <= spec.Height && (best < 0 || h > variants[best].Height) {
+				best = i
+			}
+		}
+		if best >= 0 {
+			return best
+		}
+		return order[len(order)-1]
+	case spec.Bandwidth > 0:
+		for _, i := range order {
+			if variants[i].Bandwidth <= spec.Bandwidth {
+				return i
+			}
+		}
+		return order[len(order)-1]
+	}
+	return order[0]
+}
+
+// Load fetches the manifest at rawurl and resolves the rendition named by
+// variant (see ParseVariant) to its segments
+func Load(ctx context.Context, rawurl string, headers map[string]string, userAgent, variant string) (*Media, error) {
+	spec, err := ParseVariant(variant)
+	if err != nil {
+		return nil, err
+	}
+	f := &fetcher{client: &http.Client{Timeout: types.ProbeTimeout}, headers: headers, userAgent: userAgent}
+
+	data, final, contentType, err := f.manifest(ctx, rawurl)
+	if err != nil {
+		return nil, err
+	}
+
+	var media *Media
+	if isDASH(final.String(), contentType) || (!isHLS(final.String(), contentType) && looksLikeMPD(data)) {
+		media, err = loadDASH(data, final, spec)
+	} else {
+		media, err = loadHLS(ctx, f, data, final, spec)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(media.Segments) == 0 {
+		return nil, fmt.Errorf("%w: no segments in %s", ErrUnsupported, rawurl)
+	}
+	media.ContentType = contentTypes[media.Ext]
+	utils.Debug("Stream %s: %s, %d segments, %v", rawurl, media.Variant, len(media.Segments), media.Duration)
+	return media, nil
+}
+
+// fetcher makes requests with the download's headers
+type fetcher struct {
+	client    *http.Client
+	headers   map[string]string
+	userAgent string
+}
+
+// request builds a GET carrying the download's headers
+func (f *fetcher) request(ctx context.Context, rawurl string) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+	for key, val := range f.headers {
+		req.Header.Set(key, val)
+	}
+	if f.userAgent != "" {
+		req.Header.Set("User-Agent", f.userAgent)
+	}
+	return req, nil
+}
+
+// manifest fetches a playlist or manifest and returns it with the URL it was
+// finally served from, which relative links resolve against
+func (f *fetcher) manifest(ctx context.Context, rawurl string) ([]byte, *url.URL, string, error) {
+	req, err := f.request(ctx, rawurl)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, nil, "", fmt.Errorf("fetching %s: unexpected status %s", rawurl, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxManifestSize+1))
+	if err != nil {
+		return nil, nil, "", fmt.Errorf("fetching %s: %w", rawurl, err)
+	}
+	if len(data) > maxManifestSize {
+		return nil, nil, "", fmt.Errorf("%w: manifest %s is too large", ErrUnsupported, rawurl)
+	}
+	return data, resp.Request.URL, resp.Header.Get("Content-Type"), nil
+}
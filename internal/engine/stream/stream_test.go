@@ -0,0 +1,325 @@
+package stream
+
+import (
+	"bytes"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+const master = `#EXTM3U
+#EXT-X-STREAM-INF:BANDWIDTH=800000,RESOLUTION=640x360,CODECS="avc1.4d401e,mp4a.40.2"
+low/index.m3u8
+#EXT-X-STREAM-INF:BANDWIDTH=5000000,RESOLUTION=1920x1080
+hi/index.m3u8
+#EXT-X-I-FRAME-STREAM-INF:BANDWIDTH=100000,URI="iframes.m3u8"
+#EXT-X-STREAM-INF:BANDWIDTH=2500000,RESOLUTION=1280x720
+/mid/index.m3u8
+`
+
+func mustURL(t *testing.T, raw string) *url.URL {
+	t.Helper()
+	u, err := url.Parse(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestParseHLSMaster(t *testing.T) {
+	pl, err := parseHLS([]byte(master), mustURL(t, "https://cdn.example.com/v/master.m3u8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pl.variants) != 3 {
+		t.Fatalf("got %d variants, want 3", len(pl.variants))
+	}
+	v := pl.variants[0]
+	if v.URL != "https://cdn.example.com/v/low/index.m3u8" || v.Bandwidth != 800000 || v.Width != 640 || v.Height != 360 || v.Codecs != "avc1.4d401e,mp4a.40.2" {
+		t.Errorf("variant = %+v", v)
+	}
+	if pl.variants[2].URL != "https://cdn.example.com/mid/index.m3u8" {
+		t.Errorf("absolute-path variant = %s", pl.variants[2].URL)
+	}
+}
+
+func TestParseHLSMedia(t *testing.T) {
+	data := `#EXTM3U
+#EXT-X-TARGETDURATION:10
+#EXT-X-MEDIA-SEQUENCE:7
+#EXTINF:9.5,
+seg0.ts
+#EXT-X-KEY:METHOD=AES-128,URI="key.bin"
+#EXTINF:10.0,title
+seg1.ts
+#EXT-X-KEY:METHOD=AES-128,URI="https://keys.example.com/k2",IV=0x0102
+#EXTINF:10,
+seg2.ts
+#EXT-X-KEY:METHOD=NONE
+#EXT-X-BYTERANGE:1000@500
+#EXTINF:4,
+all.ts
+#EXT-X-BYTERANGE:200
+#EXTINF:2,
+all.ts
+#EXT-X-ENDLIST
+`
+	pl, err := parseHLS([]byte(data), mustURL(t, "https://example.com/v/index.m3u8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pl.ended || len(pl.variants) != 0 || len(pl.segments) != 5 {
+		t.Fatalf("playlist = %+v", pl)
+	}
+	if pl.duration != 35500*time.Millisecond {
+		t.Errorf("duration = %v", pl.duration)
+	}
+
+	s := pl.segments
+	if s[0].URL != "https://example.com/v/seg0.ts" || s[0].Key != "" {
+		t.Errorf("segment 0 = %+v", s[0])
+	}
+	if s[1].Key != "https://example.com/v/key.bin" || !bytes.Equal(s[1].IV, sequenceIV(8)) {
+		t.Errorf("segment 1 should use the sequence number as IV: %+v", s[1])
+	}
+	wantIV := make([]byte, 16)
+	wantIV[14], wantIV[15] = 1, 2
+	if s[2].Key != "https://keys.example.com/k2" || !bytes.Equal(s[2].IV, wantIV) {
+		t.Errorf("segment 2 = %+v", s[2])
+	}
+	if s[3].Key != "" || s[3].Offset != 500 || s[3].Length != 1000 {
+		t.Errorf("segment 3 = %+v", s[3])
+	}
+	if s[4].Offset != 1500 || s[4].Length != 200 {
+		t.Errorf("byte range without offset should follow the previous one: %+v", s[4])
+	}
+}
+
+func TestParseHLSErrors(t *testing.T) {
+	base := mustURL(t, "https://example.com/a.m3u8")
+	tests := map[string]string{
+		"not a playlist": "<html></html>",
+		"sample-aes":     "#EXTM3U\n#EXT-X-KEY:METHOD=SAMPLE-AES,URI=\"k\"\n#EXTINF:1,\na.ts\n",
+		"drm key format": "#EXTM3U\n#EXT-X-KEY:METHOD=AES-128,URI=\"k\",KEYFORMAT=\"com.apple.streamingkeydelivery\"\n",
+	}
+	for name, data := range tests {
+		if _, err := parseHLS([]byte(data), base); !errors.Is(err, ErrUnsupported) {
+			t.Errorf("%s: err = %v, want ErrUnsupported", name, err)
+		}
+	}
+	if _, err := parseHLS([]byte("#EXTM3U\n#EXTINF:abc,\na.ts\n"), base); err == nil {
+		t.Error("bad EXTINF should fail")
+	}
+}
+
+func TestParseAttributes(t *testing.T) {
+	got := parseAttributes(`BANDWIDTH=1280000,CODECS="avc1.4d401f,mp4a.40.2", resolution=640x360,NAME="a=b"`)
+	want := map[string]string{"BANDWIDTH": "1280000", "CODECS": "avc1.4d401f,mp4a.40.2", "RESOLUTION": "640x360", "NAME": "a=b"}
+	if len(got) != len(want) {
+		t.Fatalf("got %v", got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("%s = %q, want %q", k, got[k], v)
+		}
+	}
+}
+
+func TestParseVariant(t *testing.T) {
+	tests := []struct {
+		in   string
+		want VariantSpec
+	}{
+		{"", VariantSpec{}},
+		{"Best", VariantSpec{}},
+		{"worst", VariantSpec{Worst: true}},
+		{"720p", VariantSpec{Height: 720}},
+		{"1080", VariantSpec{Height: 1080}},
+		{"1280x720", VariantSpec{Width: 1280, Height: 720}},
+		{"2500000", VariantSpec{Bandwidth: 2500000}},
+		{"2500k", VariantSpec{Bandwidth: 2500000}},
+		{"2.5M", VariantSpec{Bandwidth: 2500000}},
+	}
+	for _, tt := range tests {
+		got, err := ParseVariant(tt.in)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseVariant(%q) = %+v, %v; want %+v", tt.in, got, err, tt.want)
+		}
+	}
+	for _, bad := range []string{"hd", "0p", "x720", "-5k"} {
+		if _, err := ParseVariant(bad); err == nil {
+			t.Errorf("ParseVariant(%q) should fail", bad)
+		}
+	}
+}
+
+func TestPick(t *testing.T) {
+	pl, err := parseHLS([]byte(master), mustURL(t, "https://example.com/master.m3u8"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		spec string
+		want int // Height of the variant picked
+	}{
+		{"best", 1080},
+		{"worst", 360},
+		{"720p", 720},
+		{"900p", 720},
+		{"240p", 360}, // Nothing that small: the smallest
+		{"640x360", 360},
+		{"1280x719", 360}, // No exact match: tallest under 719
+		{"3M", 720},
+		{"100k", 360},
+	}
+	for _, tt := range tests {
+		spec, _ := ParseVariant(tt.spec)
+		if got := pl.variants[pick(pl.variants, spec)].Height; got != tt.want {
+			t.Errorf("pick(%s) = %dp, want %dp", tt.spec, got, tt.want)
+		}
+	}
+}
+
+const mpdTemplate = `<?xml version="1.0"?>
+<MPD xmlns="urn:mpeg:dash:schema:mpd:2011" type="static" mediaPresentationDuration="PT9.5S">
+  <BaseURL>media/</BaseURL>
+  <Period>
+    <AdaptationSet mimeType="audio/mp4">
+      <Representation id="a1" bandwidth="128000"/>
+    </AdaptationSet>
+    <AdaptationSet contentType="video" mimeType="video/mp4">
+      <SegmentTemplate timescale="1000" duration="4000" startNumber="3" initialization="$RepresentationID$/init.mp4" media="$RepresentationID$/seg-$Number%03d$.m4s"/>
+      <Representation id="v720" bandwidth="2500000" width="1280" height="720"/>
+      <Representation id="v1080" bandwidth="5000000" width="1920" height="1080"/>
+    </AdaptationSet>
+  </Period>
+</MPD>`
+
+func TestLoadDASHTemplate(t *testing.T) {
+	m, err := loadDASH([]byte(mpdTemplate), mustURL(t, "https://example.com/v/manifest.mpd"), VariantSpec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Variant.URL != "v1080" || m.Ext != ".mp4" || m.Duration != 9500*time.Millisecond {
+		t.Errorf("media = %+v", m)
+	}
+	if m.Init == nil || m.Init.URL != "https://example.com/v/media/v1080/init.mp4" {
+		t.Errorf("init = %+v", m.Init)
+	}
+	want := []string{"seg-003.m4s", "seg-004.m4s", "seg-005.m4s"}
+	if len(m.Segments) != len(want) {
+		t.Fatalf("got %d segments, want %d", len(m.Segments), len(want))
+	}
+	for i, name := range want {
+		if m.Segments[i].URL != "https://example.com/v/media/v1080/"+name {
+			t.Errorf("segment %d = %s", i, m.Segments[i].URL)
+		}
+	}
+}
+
+func TestLoadDASHTimeline(t *testing.T) {
+	data := `<MPD type="static" mediaPresentationDuration="PT10S"><Period>
+  <AdaptationSet mimeType="video/mp4">
+    <Representation id="v" bandwidth="1000">
+      <SegmentTemplate timescale="10" media="t/$Time$.m4s" initialization="init.mp4">
+        <SegmentTimeline>
+          <S t="0" d="20" r="1"/>
+          <S d="15"/>
+          <S d="25" r="-1"/>
+        </SegmentTimeline>
+      </SegmentTemplate>
+    </Representation>
+  </AdaptationSet>
+</Period></MPD>`
+	m, err := loadDASH([]byte(data), mustURL(t, "https://example.com/a.mpd"), VariantSpec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 0, 20, 40 (d=15), then d=25 from 55 until 100: 55 and 80
+	want := []string{"0", "20", "40", "55", "80"}
+	if len(m.Segments) != len(want) {
+		t.Fatalf("got %d segments: %+v", len(m.Segments), m.Segments)
+	}
+	for i, tm := range want {
+		if m.Segments[i].URL != "https://example.com/t/"+tm+".m4s" {
+			t.Errorf("segment %d = %s", i, m.Segments[i].URL)
+		}
+	}
+}
+
+func TestLoadDASHSegmentList(t *testing.T) {
+	data := `<MPD type="static"><Period duration="PT1M">
+  <AdaptationSet>
+    <Representation id="v" mimeType="video/webm" bandwidth="1000">
+      <BaseURL>https://media.example.com/v.webm</BaseURL>
+      <SegmentList>
+        <Initialization range="0-99"/>
+        <SegmentURL mediaRange="100-199"/>
+        <SegmentURL media="other.webm" mediaRange="0-9"/>
+      </SegmentList>
+    </Representation>
+  </AdaptationSet>
+</Period></MPD>`
+	m, err := loadDASH([]byte(data), mustURL(t, "https://example.com/a.mpd"), VariantSpec{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Ext != ".webm" || m.Init == nil || m.Init.URL != "https://media.example.com/v.webm" || m.Init.Length != 100 {
+		t.Errorf("media = %+v, init = %+v", m, m.Init)
+	}
+	if len(m.Segments) != 2 || m.Segments[0].Offset != 100 || m.Segments[0].Length != 100 || m.Segments[1].URL != "https://media.example.com/other.webm" {
+		t.Errorf("segments = %+v", m.Segments)
+	}
+}
+
+func TestLoadDASHErrors(t *testing.T) {
+	base := mustURL(t, "https://example.com/a.mpd")
+	if _, err := loadDASH([]byte(`<MPD type="dynamic"><Period/></MPD>`), base, VariantSpec{}); !errors.Is(err, ErrLive) {
+		t.Errorf("dynamic manifest: err = %v, want ErrLive", err)
+	}
+	if _, err := loadDASH([]byte(`<MPD><Period/><Period/></MPD>`), base, VariantSpec{}); !errors.Is(err, ErrUnsupported) {
+		t.Errorf("two periods: err = %v, want ErrUnsupported", err)
+	}
+}
+
+func TestParseISODuration(t *testing.T) {
+	tests := map[string]time.Duration{
+		"PT634.566S":          634566 * time.Millisecond,
+		"PT1H2M3S":            time.Hour + 2*time.Minute + 3*time.Second,
+		"P1DT1S":              24*time.Hour + time.Second,
+		"P0Y0M0DT0H3M30.000S": 3*time.Minute + 30*time.Second,
+	}
+	for in, want := range tests {
+		if got, err := parseISODuration(in); err != nil || got != want {
+			t.Errorf("parseISODuration(%s) = %v, %v; want %v", in, got, err, want)
+		}
+	}
+	for _, bad := range []string{"", "P", "PT", "1H", "PTxS"} {
+		if _, err := parseISODuration(bad); err == nil {
+			t.Errorf("parseISODuration(%q) should fail", bad)
+		}
+	}
+}
+
+func TestIsStreamAndFilename(t *testing.T) {
+	if !IsStream("https://example.com/v/master.m3u8?token=1", "") || !IsStream("https://example.com/manifest", "application/dash+xml") ||
+		!IsStream("https://example.com/play", "application/vnd.apple.mpegurl; charset=utf-8") {
+		t.Error("streams not recognised")
+	}
+	if IsStream("https://example.com/video.mp4", "video/mp4") {
+		t.Error("plain file taken for a stream")
+	}
+
+	tests := map[string]string{
+		"master.m3u8": "master.ts",
+		"manifest":    "manifest.ts",
+		".m3u8":       "stream.ts",
+		"movie.mkv":   "movie.mkv",
+	}
+	for in, want := range tests {
+		if got := Filename(in, ".ts"); got != want {
+			t.Errorf("Filename(%s) = %s, want %s", in, got, want)
+		}
+	}
+}
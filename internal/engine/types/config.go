@@ -1,7 +1,11 @@
 package types
 
 import (
+	"strings"
 	"time"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/engine/ratelimit"
 )
 
 // Size constants
@@ -31,6 +35,9 @@ const (
 // Connection limits
 const (
 	PerHostMax = 64 // Max concurrent connections per host
+
+	DefaultHTTP2Connections = 2  // Connections per multiplexed HTTP/2 or HTTP/3 host
+	MaxHTTP2Connections     = 16 // Upper bound for http2_connections
 )
 
 // HTTP Client Tuning
@@ -52,18 +59,48 @@ const (
 
 // DownloadConfig contains all parameters needed to start a download
 type DownloadConfig struct {
-	URL        string
-	OutputPath string
-	DestPath   string // Full destination path (for resume state lookup)
-	ID         string
-	Filename   string
-	IsResume   bool // True if this is explicitly a resume, not a fresh download
-	ProgressCh chan<- any
-	State      *ProgressState
-	SavedState *DownloadState    // Pre-loaded state for resume optimization
-	Runtime    *RuntimeConfig    // Dynamic settings from user config
-	Mirrors    []string          // List of mirror URLs (including primary)
-	Headers    map[string]string // Custom HTTP headers from browser (cookies, auth, etc.)
+	URL          string
+	OutputPath   string
+	DestPath     string // Full destination path (for resume state lookup)
+	ID           string
+	Filename     string
+	IsResume     bool // True if this is explicitly a resume, not a fresh download
+	ProgressCh   chan<- any
+	State        *ProgressState
+	SavedState   *DownloadState     // Pre-loaded state for resume optimization
+	Runtime      *RuntimeConfig     // Dynamic settings from user config
+	Mirrors      []string           // List of mirror URLs (including primary)
+	Headers      map[string]string  // Custom HTTP headers from browser (cookies, auth, etc.)
+	Checksum     string             // Expected digest of the finished file ("algo:hex"), verified before rename
+	Pieces       *PieceHashes       // Expected per-piece digests, corrupt pieces are refetched
+	ExpectedSize int64              // Size the caller expects (e.g. from a Metalink), 0 if unknown
+	Limiter      *ratelimit.Limiter // Per-download bandwidth cap, shared by all connections and adjustable live
+	Priority     int                // Queue priority, higher starts first (see PriorityHigh)
+	Category     string             // Category chosen by the user, empty to match one by the file
+	Overwrite    bool               // Replace a file already at the destination instead of picking a new name
+	KeepDir      bool               // Save into OutputPath even when it is the default directory and the category has its own
+	Variant      string             // Rendition of an HLS/DASH stream, e.g. "best" or "720p" (see stream.ParseVariant)
+}
+
+// DownloadOptions holds optional per-download parameters beyond URL and destination
+type DownloadOptions struct {
+	Checksum  string       // Expected digest of the finished file ("algo:hex")
+	Pieces    *PieceHashes // Expected per-piece digests
+	Size      int64        // Expected file size in bytes, 0 if unknown
+	RateLimit int64        // Bandwidth cap in bytes per second, 0 for unlimited
+	Priority  int          // Queue priority, higher starts first
+	Category  string       // Category name, empty to match one by the file
+	Overwrite bool         // Replace a file already at the destination
+	KeepDir   bool         // Don't move the download into its category's directory
+	Variant   string       // Rendition of an HLS/DASH stream, empty for the best
+}
+
+// PieceHashes lists digests of consecutive fixed-size pieces of a file.
+// The last piece may be shorter than Length.
+type PieceHashes struct {
+	Algorithm string   `json:"algorithm"`
+	Length    int64    `json:"length"`
+	Hashes    []string `json:"hashes"`
 }
 
 // RuntimeConfig holds dynamic settings that can override defaults
@@ -80,6 +117,17 @@ type RuntimeConfig struct {
 	SlowWorkerGracePeriod time.Duration
 	StallTimeout          time.Duration
 	SpeedEmaAlpha         float64
+	CheckpointInterval    time.Duration // How often active downloads persist their progress
+
+	SSHKeyFiles   []string // Private keys for SFTP, empty uses ~/.ssh defaults
+	SSHKnownHosts string   // known_hosts file for SFTP host keys, empty uses ~/.ssh/known_hosts
+
+	HTTP2Hosts       []string // Hosts downloaded over multiplexed HTTP/2 ("*.example.com" wildcards, "*" for all)
+	HTTP3Hosts       []string // Hosts downloaded over HTTP/3, matched like HTTP2Hosts
+	HTTP2Connections int      // Connections per HTTP/2 or HTTP/3 host
+
+	DefaultDownloadDir string            // Downloads saved here are moved to their category's directory
+	Categories         []config.Category // Matched in order, see config.MatchCategory
 }
 
 // GetUserAgent returns the configured user agent or the default
@@ -98,6 +146,40 @@ func (r *RuntimeConfig) GetMaxConnectionsPerHost() int {
 	return r.MaxConnectionsPerHost
 }
 
+// GetHTTP2Connections returns configured value or default, capped at MaxHTTP2Connections
+func (r *RuntimeConfig) GetHTTP2Connections() int {
+	if r == nil || r.HTTP2Connections <= 0 {
+		return DefaultHTTP2Connections
+	}
+	return min(r.HTTP2Connections, MaxHTTP2Connections)
+}
+
+// UseHTTP2 reports whether host is listed in HTTP2Hosts
+func (r *RuntimeConfig) UseHTTP2(host string) bool {
+	return r != nil && matchHost(r.HTTP2Hosts, host)
+}
+
+// UseHTTP3 reports whether host is listed in HTTP3Hosts
+func (r *RuntimeConfig) UseHTTP3(host string) bool {
+	return r != nil && matchHost(r.HTTP3Hosts, host)
+}
+
+// matchHost reports whether host matches one of patterns: an exact name,
+// a "*.example.com" wildcard or "*"
+func matchHost(patterns []string, host string) bool {
+	host = strings.ToLower(host)
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(pattern)
+		switch {
+		case pattern == "*" || pattern == host:
+			return true
+		case strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]):
+			return true
+		}
+	}
+	return false
+}
+
 // GetMinChunkSize returns configured value or default
 func (r *RuntimeConfig) GetMinChunkSize() int64 {
 	if r == nil || r.MinChunkSize <= 0 {
@@ -124,6 +206,8 @@ const (
 	SlowWorkerGrace     = 5 * time.Second // Grace period before checking speed
 	StallTimeout        = 5 * time.Second // Restart if no data for x seconds
 	SpeedEMAAlpha       = 0.3             // EMA smoothing factor
+
+	CheckpointInterval = 5 * time.Second // How often in-flight progress is persisted
 )
 
 // GetMaxTaskRetries returns configured value or default
@@ -165,3 +249,11 @@ func (r *RuntimeConfig) GetSpeedEmaAlpha() float64 {
 	}
 	return r.SpeedEmaAlpha
 }
+
+// GetCheckpointInterval returns configured value or default
+func (r *RuntimeConfig) GetCheckpointInterval() time.Duration {
+	if r == nil || r.CheckpointInterval <= 0 {
+		return CheckpointInterval
+	}
+	return r.CheckpointInterval
+}
@@ -16,5 +16,13 @@ func ConvertRuntimeConfig(rc *config.RuntimeConfig) *RuntimeConfig {
 		SlowWorkerGracePeriod: rc.SlowWorkerGracePeriod,
 		StallTimeout:          rc.StallTimeout,
 		SpeedEmaAlpha:         rc.SpeedEmaAlpha,
+		CheckpointInterval:    rc.CheckpointInterval,
+		SSHKeyFiles:           rc.SSHKeyFiles,
+		SSHKnownHosts:         rc.SSHKnownHosts,
+		HTTP2Hosts:            rc.HTTP2Hosts,
+		HTTP3Hosts:            rc.HTTP3Hosts,
+		HTTP2Connections:      rc.HTTP2Connections,
+		DefaultDownloadDir:    rc.DefaultDownloadDir,
+		Categories:            rc.Categories,
 	}
 }
@@ -193,3 +193,43 @@ func TestDownloadConfig_Fields(t *testing.T) {
 		t.Error("Runtime not set correctly")
 	}
 }
+
+func TestRuntimeConfig_UseHTTP2(t *testing.T) {
+	r := &RuntimeConfig{HTTP2Hosts: []string{"cdn.example.com", "*.akamaized.net"}}
+	tests := map[string]bool{
+		"cdn.example.com":       true,
+		"CDN.Example.com":       true,
+		"a.b.akamaized.net":     true,
+		"akamaized.net":         false,
+		"example.com":           false,
+		"evilakamaized.net":     false,
+		"download.example.com":  false,
+		"cdn.example.com.evil":  false,
+		"x.cdn.example.com":     false,
+		"files.akamaized.net.x": false,
+	}
+	for host, want := range tests {
+		if got := r.UseHTTP2(host); got != want {
+			t.Errorf("UseHTTP2(%q) = %v, want %v", host, got, want)
+		}
+	}
+
+	if !(&RuntimeConfig{HTTP2Hosts: []string{"*"}}).UseHTTP2("anything.net") {
+		t.Error(`"*" should match every host`)
+	}
+	var nilConfig *RuntimeConfig
+	if nilConfig.UseHTTP2("cdn.example.com") || nilConfig.GetHTTP2Connections() != DefaultHTTP2Connections {
+		t.Error("nil config should use HTTP/1.1 and default connections")
+	}
+	if got := (&RuntimeConfig{HTTP2Connections: 100}).GetHTTP2Connections(); got != MaxHTTP2Connections {
+		t.Errorf("GetHTTP2Connections = %d, want cap %d", got, MaxHTTP2Connections)
+	}
+
+	h3 := &RuntimeConfig{HTTP3Hosts: []string{"*.example.com"}}
+	if !h3.UseHTTP3("cdn.example.com") || h3.UseHTTP3("example.org") || h3.UseHTTP2("cdn.example.com") {
+		t.Error("HTTP3Hosts should be matched on their own, like HTTP2Hosts")
+	}
+	if nilConfig.UseHTTP3("cdn.example.com") {
+		t.Error("nil config should not use HTTP/3")
+	}
+}
@@ -4,5 +4,7 @@ import "errors"
 
 // Common errors
 var (
-	ErrPaused = errors.New("download paused")
+	ErrPaused           = errors.New("download paused")
+	ErrChecksumMismatch = errors.New("checksum mismatch")
+	ErrRemoteChanged    = errors.New("remote file changed")
 )
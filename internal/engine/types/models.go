@@ -1,5 +1,7 @@
 package types
 
+import "strings"
+
 // Task represents a byte range to download
 type Task struct {
 	Offset int64 `json:"offset"`
@@ -26,7 +28,50 @@ type DownloadState struct {
 	ActualChunkSize int64  `json:"actual_chunk_size,omitempty"`
 
 	// Integrity verification
-	FileHash string `json:"file_hash,omitempty"` // SHA-256 hash of the .surge file at pause time
+	FileHash string       `json:"file_hash,omitempty"` // SHA-256 hash of the .surge file at pause time
+	Checksum string       `json:"checksum,omitempty"`  // Expected digest of the finished file ("algo:hex")
+	Pieces   *PieceHashes `json:"pieces,omitempty"`    // Expected per-piece digests
+
+	// Bandwidth cap in bytes/sec (0 = unlimited)
+	RateLimit int64 `json:"rate_limit,omitempty"`
+
+	// Category the download was sorted into
+	Category string `json:"category,omitempty"`
+
+	// HLS/DASH streams: the rendition chosen and how many segments are joined
+	// into the partial file
+	Variant  string `json:"variant,omitempty"`
+	Segments int    `json:"segments,omitempty"`
+
+	// Remote version the partial data came from
+	Validators
+}
+
+// Validators identify one version of a remote file (RFC 9110 section 8.8)
+type Validators struct {
+	ETag         string `json:"etag,omitempty"`
+	LastModified string `json:"last_modified,omitempty"`
+}
+
+// IfRange returns the value for an If-Range header, or "" if there is none.
+// Weak ETags can't be used with If-Range, so Last-Modified is the fallback.
+func (v Validators) IfRange() string {
+	if v.ETag != "" && !strings.HasPrefix(v.ETag, "W/") {
+		return v.ETag
+	}
+	return v.LastModified
+}
+
+// Changed reports whether other describes a different version than v.
+// Only validators known on both sides are compared.
+func (v Validators) Changed(other Validators) bool {
+	if v.ETag != "" && other.ETag != "" {
+		return v.ETag != other.ETag
+	}
+	if v.LastModified != "" && other.LastModified != "" {
+		return v.LastModified != other.LastModified
+	}
+	return false
 }
 
 // DownloadEntry represents a download in the master list
@@ -43,6 +88,8 @@ type DownloadEntry struct {
 	TimeTaken   int64    `json:"time_taken"`   // Duration in milliseconds (for completed)
 	AvgSpeed    float64  `json:"avg_speed"`    // Average speed in bytes/sec (for completed)
 	Mirrors     []string `json:"mirrors,omitempty"`
+	Checksum    string   `json:"checksum,omitempty"` // Expected digest of the finished file ("algo:hex")
+	Category    string   `json:"category,omitempty"` // Category the download was sorted into
 }
 
 // MasterList holds all tracked downloads
@@ -62,9 +109,26 @@ type DownloadStatus struct {
 	Speed       float64 `json:"speed"`    // MB/s
 	Status      string  `json:"status"`   // "queued", "paused", "downloading", "completed", "error"
 	Error       string  `json:"error,omitempty"`
-	ETA         int64   `json:"eta"`         // Estimated seconds remaining
-	Connections int     `json:"connections"` // Active connections
-	AddedAt     int64   `json:"added_at"`    // Unix timestamp when added
-	TimeTaken   int64   `json:"time_taken"`  // Duration in milliseconds (completed only)
-	AvgSpeed    float64 `json:"avg_speed"`   // Average speed in bytes/sec (completed only)
+	ETA         int64   `json:"eta"`                      // Estimated seconds remaining
+	Connections int     `json:"connections"`              // Active connections
+	AddedAt     int64   `json:"added_at"`                 // Unix timestamp when added
+	TimeTaken   int64   `json:"time_taken"`               // Duration in milliseconds (completed only)
+	AvgSpeed    float64 `json:"avg_speed"`                // Average speed in bytes/sec (completed only)
+	RateLimit   int64   `json:"rate_limit,omitempty"`     // Bandwidth cap in bytes/sec, 0 if unlimited
+	Priority    int     `json:"priority,omitempty"`       // Queue priority, higher starts first
+	QueuePos    int     `json:"queue_position,omitempty"` // 1-based place in the queue, 0 if not queued
+	Category    string  `json:"category,omitempty"`       // Category the download was sorted into
+}
+
+// WebhookDelivery records the outcome of sending one event to a webhook
+type WebhookDelivery struct {
+	ID         string `json:"id"` // Also sent as X-Surge-Delivery
+	URL        string `json:"url"`
+	Event      string `json:"event"`
+	DownloadID string `json:"download_id,omitempty"`
+	Attempts   int    `json:"attempts"`
+	StatusCode int    `json:"status_code,omitempty"` // Last HTTP status, 0 if no response
+	Error      string `json:"error,omitempty"`       // Why the last attempt failed, empty once delivered
+	Delivered  bool   `json:"delivered"`
+	Time       int64  `json:"time"` // Unix timestamp of the last attempt
 }
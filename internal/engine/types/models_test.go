@@ -0,0 +1,41 @@
+package types
+
+import "testing"
+
+func TestValidators_IfRange(t *testing.T) {
+	tests := []struct {
+		v    Validators
+		want string
+	}{
+		{Validators{ETag: `"abc"`, LastModified: "Wed, 21 Oct 2015 07:28:00 GMT"}, `"abc"`},
+		{Validators{ETag: `W/"abc"`, LastModified: "Wed, 21 Oct 2015 07:28:00 GMT"}, "Wed, 21 Oct 2015 07:28:00 GMT"},
+		{Validators{ETag: `W/"abc"`}, ""},
+		{Validators{}, ""},
+	}
+	for _, tt := range tests {
+		if got := tt.v.IfRange(); got != tt.want {
+			t.Errorf("%+v.IfRange() = %q, want %q", tt.v, got, tt.want)
+		}
+	}
+}
+
+func TestValidators_Changed(t *testing.T) {
+	v1 := Validators{ETag: `"v1"`, LastModified: "Mon, 01 Jan 2024 00:00:00 GMT"}
+
+	tests := []struct {
+		name  string
+		other Validators
+		want  bool
+	}{
+		{"same", v1, false},
+		{"etag differs", Validators{ETag: `"v2"`, LastModified: v1.LastModified}, true},
+		{"etag wins over date", Validators{ETag: `"v1"`, LastModified: "Tue, 02 Jan 2024 00:00:00 GMT"}, false},
+		{"date differs", Validators{LastModified: "Tue, 02 Jan 2024 00:00:00 GMT"}, true},
+		{"nothing to compare", Validators{}, false},
+	}
+	for _, tt := range tests {
+		if got := v1.Changed(tt.other); got != tt.want {
+			t.Errorf("%s: Changed = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
@@ -15,6 +15,7 @@ type ProgressState struct {
 	TotalSize     int64
 	DestPath      string // Initial destination path
 	Filename      string // Initial filename
+	Category      string // Category the download was sorted into
 	StartTime     time.Time
 	ActiveWorkers atomic.Int32
 	Done          atomic.Bool
@@ -36,7 +37,7 @@ type ProgressState struct {
 	ActualChunkSize int64   // Size of each actual chunk in bytes
 	BitmapWidth     int     // Number of chunks tracked
 
-	mu sync.Mutex // Protects TotalSize, StartTime, SessionStartBytes, SavedElapsed, Mirrors
+	mu sync.Mutex // Protects TotalSize, StartTime, SessionStartBytes, SavedElapsed, Mirrors, DestPath, Filename, Category
 }
 
 type MirrorStatus struct {
@@ -69,6 +70,18 @@ func (ps *ProgressState) GetFilename() string {
 	return ps.Filename
 }
 
+func (ps *ProgressState) SetCategory(category string) {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	ps.Category = category
+}
+
+func (ps *ProgressState) GetCategory() string {
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	return ps.Category
+}
+
 func NewProgressState(id string, totalSize int64) *ProgressState {
 	return &ProgressState{
 		ID:        id,
@@ -415,6 +428,22 @@ func (ps *ProgressState) UpdateChunkStatus(offset, length int64, status ChunkSta
 			if current != ChunkCompleted {
 				ps.setChunkState(i, ChunkDownloading)
 			}
+		case ChunkPending:
+			// Bytes were rejected (e.g. failed piece verification): give them back
+			decrement := overlap
+			if decrement > ps.ChunkProgress[i] {
+				decrement = ps.ChunkProgress[i]
+			}
+			if decrement > 0 {
+				ps.ChunkProgress[i] -= decrement
+				ps.VerifiedProgress.Add(-decrement)
+			}
+
+			if ps.ChunkProgress[i] > 0 {
+				ps.setChunkState(i, ChunkDownloading)
+			} else {
+				ps.setChunkState(i, ChunkPending)
+			}
 		}
 	}
 }
@@ -0,0 +1,67 @@
+package types
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Queue priorities. Higher values start first; any integer is accepted.
+const (
+	PriorityLow    = -1
+	PriorityNormal = 0
+	PriorityHigh   = 1
+)
+
+// QueueMove is a way to reorder a queued download
+type QueueMove string
+
+const (
+	MoveTop    QueueMove = "top"
+	MoveBottom QueueMove = "bottom"
+	MoveUp     QueueMove = "up"
+	MoveDown   QueueMove = "down"
+)
+
+// ParseQueueMove validates a move name such as "top" or "down"
+func ParseQueueMove(raw string) (QueueMove, error) {
+	switch m := QueueMove(strings.ToLower(strings.TrimSpace(raw))); m {
+	case MoveTop, MoveBottom, MoveUp, MoveDown:
+		return m, nil
+	}
+	return "", fmt.Errorf("invalid move %q (want top, bottom, up or down)", raw)
+}
+
+// ParsePriority accepts "high", "normal", "low" or an integer
+func ParsePriority(raw string) (int, error) {
+	s := strings.ToLower(strings.TrimSpace(raw))
+	switch s {
+	case "high":
+		return PriorityHigh, nil
+	case "normal", "":
+		return PriorityNormal, nil
+	case "low":
+		return PriorityLow, nil
+	}
+	p, err := strconv.Atoi(s)
+	if err != nil {
+		return 0, fmt.Errorf("invalid priority %q (want high, normal, low or a number)", raw)
+	}
+	return p, nil
+}
+
+// QueueEntry is a download waiting to start, saved so the queue survives restarts
+type QueueEntry struct {
+	ID         string
+	URL        string
+	OutputPath string
+	Filename   string
+	Mirrors    []string
+	Checksum   string
+	Pieces     *PieceHashes
+	Size       int64
+	RateLimit  int64
+	Priority   int
+	Category   string
+	Variant    string
+}
@@ -0,0 +1,370 @@
+package extract
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/bzip2"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bodgit/sevenzip"
+	"github.com/h2non/filetype"
+	"github.com/klauspost/compress/zstd"
+	"github.com/ulikunitz/xz"
+)
+
+// Format is an archive format Surge can extract
+type Format string
+
+const (
+	Zip      Format = "zip"
+	Tar      Format = "tar"
+	TarGz    Format = "tar.gz"
+	TarBz2   Format = "tar.bz2"
+	TarXz    Format = "tar.xz"
+	TarZst   Format = "tar.zst"
+	SevenZip Format = "7z"
+)
+
+// ErrUnsafePath is returned for archive entries that would land outside the
+// destination directory
+var ErrUnsafePath = errors.New("archive entry escapes the destination directory")
+
+// Progress is called as an archive is extracted. total is 0 when unknown.
+type Progress func(done, total int64)
+
+// sniffSize is enough to see the tar header behind a compression header
+const sniffSize = 512
+
+// Detect returns the archive format of a file from its magic
+// bytes, or "" if it is not an archive Surge extracts. Compressed files only
+// count when they hold a tar, and zip files only when they are named .zip, so
+// application formats built on zip (docx, epub, apk, jar) are left alone.
+func Detect(file string) (Format, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = f.Close() }()
+
+	header := make([]byte, 262)
+	n, err := io.ReadFull(f, header)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", err
+	}
+	kind, _ := filetype.Match(header[:n])
+
+	switch kind.Extension {
+	case "zip":
+		if strings.EqualFold(filepath.Ext(file), ".zip") {
+			return Zip, nil
+		}
+		return "", nil
+	case "7z":
+		return SevenZip, nil
+	case "tar":
+		return Tar, nil
+	}
+
+	compressed := map[string]Format{"gz": TarGz, "bz2": TarBz2, "xz": TarXz, "zst": TarZst}
+	format, ok := compressed[kind.Extension]
+	if !ok {
+		return "", nil
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	r, closeFn, err := decompress(format, bufio.NewReader(f))
+	if err != nil {
+		return "", nil
+	}
+	defer closeFn()
+	inner := make([]byte, sniffSize)
+	n, _ = io.ReadFull(r, inner)
+	if k, _ := filetype.Match(inner[:n]); k.Extension != "tar" {
+		return "", nil
+	}
+	return format, nil
+}
+
+// DirName returns the name of the directory an archive is extracted into:
+// its file name without the archive extensions
+func DirName(archive string) string {
+	name := filepath.Base(archive)
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".tar.gz", ".tar.bz2", ".tar.xz", ".tar.zst", ".tgz", ".tbz2", ".txz", ".tzst", ".zip", ".tar", ".7z"} {
+		if strings.HasSuffix(lower, ext) && len(name) > len(ext) {
+			return name[:len(name)-len(ext)]
+		}
+	}
+	if ext := filepath.Ext(name); ext != "" && len(name) > len(ext) {
+		return name[:len(name)-len(ext)]
+	}
+	return name + ".d"
+}
+
+// Extract unpacks the archive into dest, creating it if needed, and returns
+// the number of files written. Entries that would escape dest fail the
+// extraction; symbolic and hard links are skipped.
+func Extract(ctx context.Context, archive, dest string, format Format, progress Progress) (int, error) {
+	if progress == nil {
+		progress = func(int64, int64) {}
+	}
+	if err := os.MkdirAll(dest, 0o755); err != nil {
+		return 0, err
+	}
+
+	switch format {
+	case Zip:
+		return extractZip(ctx, archive, dest, progress)
+	case SevenZip:
+		return extractSevenZip(ctx, archive, dest, progress)
+	case Tar, TarGz, TarBz2, TarXz, TarZst:
+		return extractTar(ctx, archive, dest, format, progress)
+	}
+	return 0, fmt.Errorf("unsupported archive format %q", format)
+}
+
+// entryPath returns where an archive entry goes inside dest. Absolute names
+// and names climbing out with ".." are rejected, as are reserved device
+// names on Windows.
+func entryPath(dest, name string) (string, error) {
+	clean := path.Clean(strings.ReplaceAll(name, "\\", "/"))
+	if clean == "." {
+		return dest, nil
+	}
+	local := filepath.FromSlash(clean)
+	if !filepath.IsLocal(local) {
+		return "", fmt.Errorf("%w: %s", ErrUnsafePath, name)
+	}
+	return filepath.Join(dest, local), nil
+}
+
+func writeFile(ctx context.Context, target string, mode os.FileMode, r io.Reader, written func(int64)) error {
+	if err := os.MkdirAll(filepath.Dir(target), 0o755); err != nil {
+		return err
+	}
+	// Replace rather than write through whatever is already there
+	if info, err := os.Lstat(target); err == nil && !info.Mode().IsRegular() {
+		if info.IsDir() {
+			return fmt.Errorf("%s is a directory", target)
+		}
+		if err := os.Remove(target); err != nil {
+			return err
+		}
+	}
+	f, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode.Perm()|0o600)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(f, &ctxReader{ctx: ctx, r: r, read: written})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// ctxReader stops a copy when ctx is cancelled and reports bytes read
+type ctxReader struct {
+	ctx  context.Context
+	r    io.Reader
+	read func(int64)
+}
+
+func (c *ctxReader) Read(p []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := c.r.Read(p)
+	if n > 0 && c.read != nil {
+		c.read(int64(n))
+	}
+	return n, err
+}
+
+func extractZip(ctx context.Context, archive, dest string, progress Progress) (int, error) {
+	zr, err := zip.OpenReader(archive)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = zr.Close() }()
+
+	var total, done int64
+	for _, f := range zr.File {
+		total += int64(f.UncompressedSize64)
+	}
+	progress(0, total)
+
+	files := 0
+	for _, f := range zr.File {
+		target, err := entryPath(dest, f.Name)
+		if err != nil {
+			return files, err
+		}
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return files, err
+			}
+			continue
+		case !mode.IsRegular():
+			continue // Links and devices
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return files, err
+		}
+		err = writeFile(ctx, target, mode, rc, func(n int64) {
+			done += n
+			progress(done, total)
+		})
+		_ = rc.Close()
+		if err != nil {
+			return files, err
+		}
+		files++
+	}
+	return files, nil
+}
+
+func extractSevenZip(ctx context.Context, archive, dest string, progress Progress) (int, error) {
+	zr, err := sevenzip.OpenReader(archive)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = zr.Close() }()
+
+	var total, done int64
+	for _, f := range zr.File {
+		total += int64(f.UncompressedSize)
+	}
+	progress(0, total)
+
+	files := 0
+	for _, f := range zr.File {
+		target, err := entryPath(dest, f.Name)
+		if err != nil {
+			return files, err
+		}
+		mode := f.Mode()
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return files, err
+			}
+			continue
+		case !mode.IsRegular():
+			continue
+		}
+
+		rc, err := f.Open()
+		if err != nil {
+			return files, err
+		}
+		err = writeFile(ctx, target, mode, rc, func(n int64) {
+			done += n
+			progress(done, total)
+		})
+		_ = rc.Close()
+		if err != nil {
+			return files, err
+		}
+		files++
+	}
+	return files, nil
+}
+
+func extractTar(ctx context.Context, archive, dest string, format Format, progress Progress) (int, error) {
+	f, err := os.Open(archive)
+	if err != nil {
+		return 0, err
+	}
+	defer func() { _ = f.Close() }()
+
+	// Compressed streams have no index, so progress follows the archive file
+	var total int64
+	if info, err := f.Stat(); err == nil {
+		total = info.Size()
+	}
+	var done int64
+	progress(0, total)
+	counted := &ctxReader{ctx: ctx, r: f, read: func(n int64) {
+		done += n
+		progress(done, total)
+	}}
+
+	r, closeFn, err := decompress(format, bufio.NewReader(counted))
+	if err != nil {
+		return 0, err
+	}
+	defer closeFn()
+
+	tr := tar.NewReader(r)
+	files := 0
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return files, nil
+		}
+		if err != nil {
+			return files, err
+		}
+		target, err := entryPath(dest, hdr.Name)
+		if err != nil {
+			return files, err
+		}
+
+		switch hdr.Typeflag {
+		case tar.TypeDir:
+			if err := os.MkdirAll(target, 0o755); err != nil {
+				return files, err
+			}
+		case tar.TypeReg:
+			if err := writeFile(ctx, target, hdr.FileInfo().Mode(), tr, nil); err != nil {
+				return files, err
+			}
+			files++
+		default:
+			// Links, devices and FIFOs
+		}
+	}
+}
+
+// decompress wraps r in the decompressor for format
+func decompress(format Format, r io.Reader) (io.Reader, func(), error) {
+	switch format {
+	case Tar:
+		return r, func() {}, nil
+	case TarGz:
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return gz, func() { _ = gz.Close() }, nil
+	case TarBz2:
+		return bzip2.NewReader(r), func() {}, nil
+	case TarXz:
+		xr, err := xz.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return xr, func() {}, nil
+	case TarZst:
+		zr, err := zstd.NewReader(r)
+		if err != nil {
+			return nil, nil, err
+		}
+		return zr, zr.Close, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported archive format %q", format)
+}
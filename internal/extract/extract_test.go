@@ -0,0 +1,230 @@
+package extract
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+type entry struct {
+	name, body string
+	link       string // Symlink target
+}
+
+func writeZip(t *testing.T, path string, entries []entry) {
+	t.Helper()
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, e := range entries {
+		w, err := zw.Create(e.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = w.Write([]byte(e.body))
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func tarBytes(t *testing.T, entries []entry) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, e := range entries {
+		hdr := &tar.Header{Name: e.name, Mode: 0o644, Size: int64(len(e.body)), Typeflag: tar.TypeReg}
+		if e.link != "" {
+			hdr = &tar.Header{Name: e.name, Linkname: e.link, Typeflag: tar.TypeSymlink}
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		_, _ = tw.Write([]byte(e.body))
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func writeCompressed(t *testing.T, path string, data []byte, format Format) {
+	t.Helper()
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch format {
+	case TarGz:
+		w = gzip.NewWriter(&buf)
+	case TarZst:
+		zw, err := zstd.NewWriter(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w = zw
+	default:
+		t.Fatalf("unsupported format %s", format)
+	}
+	_, _ = w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDetect(t *testing.T) {
+	dir := t.TempDir()
+	files := []entry{{name: "a.txt", body: "hello"}}
+
+	writeZip(t, filepath.Join(dir, "set.zip"), files)
+	writeZip(t, filepath.Join(dir, "report.docx"), files)
+	writeCompressed(t, filepath.Join(dir, "set.tar.gz"), tarBytes(t, files), TarGz)
+	writeCompressed(t, filepath.Join(dir, "set.tzst"), tarBytes(t, files), TarZst)
+	writeCompressed(t, filepath.Join(dir, "log.gz"), bytes.Repeat([]byte("plain text\n"), 100), TarGz)
+	if err := os.WriteFile(filepath.Join(dir, "set.tar"), tarBytes(t, files), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("hello"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := map[string]Format{
+		"set.zip":     Zip,
+		"report.docx": "", // Zip-based document
+		"set.tar.gz":  TarGz,
+		"set.tzst":    TarZst,
+		"set.tar":     Tar,
+		"log.gz":      "", // Compressed, but not a tar
+		"notes.txt":   "",
+	}
+	for name, want := range tests {
+		got, err := Detect(filepath.Join(dir, name))
+		if err != nil {
+			t.Errorf("Detect(%s): %v", name, err)
+			continue
+		}
+		if got != want {
+			t.Errorf("Detect(%s) = %q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestDirName(t *testing.T) {
+	tests := map[string]string{
+		"/d/linux-6.1.tar.xz": "linux-6.1",
+		"/d/Photos.ZIP":       "Photos",
+		"/d/data.tgz":         "data",
+		"/d/tools.7z":         "tools",
+		"/d/archive":          "archive.d",
+		"/d/.zip":             ".zip.d",
+	}
+	for in, want := range tests {
+		if got := DirName(in); got != want {
+			t.Errorf("DirName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
+
+func TestExtract(t *testing.T) {
+	entries := []entry{
+		{name: "top.txt", body: "top"},
+		{name: "nested/deep/file.txt", body: "deep"},
+	}
+
+	for _, format := range []Format{Zip, Tar, TarGz, TarZst} {
+		t.Run(string(format), func(t *testing.T) {
+			dir := t.TempDir()
+			archive := filepath.Join(dir, "set."+string(format))
+			switch format {
+			case Zip:
+				writeZip(t, archive, entries)
+			case Tar:
+				if err := os.WriteFile(archive, tarBytes(t, entries), 0o644); err != nil {
+					t.Fatal(err)
+				}
+			default:
+				writeCompressed(t, archive, tarBytes(t, entries), format)
+			}
+
+			dest := filepath.Join(dir, "out")
+			var lastDone, lastTotal int64
+			files, err := Extract(context.Background(), archive, dest, format, func(done, total int64) {
+				lastDone, lastTotal = done, total
+			})
+			if err != nil {
+				t.Fatalf("Extract: %v", err)
+			}
+			if files != 2 {
+				t.Errorf("files = %d, want 2", files)
+			}
+			for _, e := range entries {
+				data, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(e.name)))
+				if err != nil || string(data) != e.body {
+					t.Errorf("%s = %q (%v), want %q", e.name, data, err, e.body)
+				}
+			}
+			if lastTotal == 0 || lastDone == 0 {
+				t.Errorf("progress not reported: %d/%d", lastDone, lastTotal)
+			}
+		})
+	}
+}
+
+func TestExtract_RejectsPathTraversal(t *testing.T) {
+	dir := t.TempDir()
+	dest := filepath.Join(dir, "out")
+
+	zipPath := filepath.Join(dir, "evil.zip")
+	writeZip(t, zipPath, []entry{{name: "../evil.txt", body: "x"}})
+	if _, err := Extract(context.Background(), zipPath, dest, Zip, nil); !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("zip with ../ entry: err = %v, want ErrUnsafePath", err)
+	}
+
+	tarPath := filepath.Join(dir, "evil.tar")
+	if err := os.WriteFile(tarPath, tarBytes(t, []entry{{name: "ok.txt", body: "ok"}, {name: "a/../../evil.txt", body: "x"}}), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Extract(context.Background(), tarPath, dest, Tar, nil); !errors.Is(err, ErrUnsafePath) {
+		t.Errorf("tar with a/../../ entry: err = %v, want ErrUnsafePath", err)
+	}
+
+	if _, err := os.Stat(filepath.Join(dir, "evil.txt")); !os.IsNotExist(err) {
+		t.Error("entry was written outside the destination")
+	}
+}
+
+func TestExtract_SkipsLinks(t *testing.T) {
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "links.tar")
+	data := tarBytes(t, []entry{
+		{name: "escape", link: "../../etc"},
+		{name: "file.txt", body: "ok"},
+	})
+	if err := os.WriteFile(archive, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	dest := filepath.Join(dir, "out")
+	files, err := Extract(context.Background(), archive, dest, Tar, nil)
+	if err != nil {
+		t.Fatalf("Extract: %v", err)
+	}
+	if files != 1 {
+		t.Errorf("files = %d, want 1", files)
+	}
+	if _, err := os.Lstat(filepath.Join(dest, "escape")); !os.IsNotExist(err) {
+		t.Error("symlink entry should be skipped")
+	}
+}
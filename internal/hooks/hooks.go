@@ -0,0 +1,91 @@
+package hooks
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// Events a hook can run on
+const (
+	EventComplete = "complete"
+	EventError    = "error"
+)
+
+// maxOutput is how much of a hook's output is kept for the log
+const maxOutput = 4096
+
+// Event describes the download a hook runs for
+type Event struct {
+	Kind       string // EventComplete or EventError
+	ID         string
+	URL        string
+	Path       string // Destination file
+	Filename   string
+	Size       int64
+	Hash       string // "algo:hex", empty if unknown
+	Category   string
+	Error      string // Set for EventError
+	ExtractDir string // Where the archive was extracted, empty if it was not
+}
+
+// Env returns the event as SURGE_* environment variables
+func (e Event) Env() []string {
+	return []string{
+		"SURGE_EVENT=" + e.Kind,
+		"SURGE_ID=" + e.ID,
+		"SURGE_URL=" + e.URL,
+		"SURGE_PATH=" + e.Path,
+		"SURGE_FILENAME=" + e.Filename,
+		"SURGE_SIZE=" + strconv.FormatInt(e.Size, 10),
+		"SURGE_HASH=" + e.Hash,
+		"SURGE_CATEGORY=" + e.Category,
+		"SURGE_ERROR=" + e.Error,
+		"SURGE_EXTRACT_DIR=" + e.ExtractDir,
+	}
+}
+
+// Run runs command through the system shell with the event added to its
+// environment. A positive timeout kills the command when it expires.
+func Run(ctx context.Context, command string, ev Event, timeout time.Duration) error {
+	if timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+		defer cancel()
+	}
+
+	cmd := shellCommand(ctx, command)
+	cmd.Env = append(os.Environ(), ev.Env()...)
+	killGroup(cmd)
+	// Background children of the shell can keep the output pipe open
+	cmd.WaitDelay = 5 * time.Second
+
+	out, err := cmd.CombinedOutput()
+	if len(out) > maxOutput {
+		out = out[:maxOutput]
+	}
+	if output := strings.TrimSpace(string(out)); output != "" {
+		utils.Debug("Hook %s for %s: %s", ev.Kind, ev.ID, output)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return fmt.Errorf("hook timed out after %s", timeout)
+	}
+	if err != nil {
+		return fmt.Errorf("hook failed: %w", err)
+	}
+	return nil
+}
+
+func shellCommand(ctx context.Context, command string) *exec.Cmd {
+	if runtime.GOOS == "windows" {
+		return exec.CommandContext(ctx, "cmd", "/C", command)
+	}
+	return exec.CommandContext(ctx, "sh", "-c", command)
+}
@@ -0,0 +1,66 @@
+package hooks
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRun_PassesEventInEnvironment(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+	out := filepath.Join(t.TempDir(), "env.txt")
+	ev := Event{
+		Kind:     EventComplete,
+		ID:       "abc",
+		URL:      "https://example.com/a.iso",
+		Path:     "/downloads/a b.iso",
+		Filename: "a b.iso",
+		Size:     1234,
+		Hash:     "sha256:ff",
+		Category: "ISOs",
+	}
+
+	command := `printf '%s|%s|%s|%s|%s|%s|%s|%s' "$SURGE_EVENT" "$SURGE_ID" "$SURGE_URL" "$SURGE_PATH" "$SURGE_FILENAME" "$SURGE_SIZE" "$SURGE_HASH" "$SURGE_CATEGORY" > "$OUT"`
+	t.Setenv("OUT", out)
+	if err := Run(context.Background(), command, ev, time.Minute); err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	data, err := os.ReadFile(out)
+	if err != nil {
+		t.Fatalf("hook did not run: %v", err)
+	}
+	want := "complete|abc|https://example.com/a.iso|/downloads/a b.iso|a b.iso|1234|sha256:ff|ISOs"
+	if string(data) != want {
+		t.Errorf("hook saw %q, want %q", data, want)
+	}
+}
+
+func TestRun_Failure(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+	if err := Run(context.Background(), "exit 3", Event{Kind: EventError}, time.Minute); err == nil {
+		t.Error("expected error for a failing command")
+	}
+}
+
+func TestRun_Timeout(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("uses a POSIX shell")
+	}
+	start := time.Now()
+	err := Run(context.Background(), "sleep 10", Event{Kind: EventComplete}, 100*time.Millisecond)
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("err = %v, want timeout", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("timed out hook took %s to stop", elapsed)
+	}
+}
@@ -0,0 +1,6 @@
+package hooks
+
+import "os/exec"
+
+// killGroup leaves cancellation to exec.CommandContext, which kills the shell
+func killGroup(cmd *exec.Cmd) {}
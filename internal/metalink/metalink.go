@@ -0,0 +1,285 @@
+// Package metalink parses Metalink files (RFC 5854 and the older 3.0 format)
+// into downloads with mirrors, size and hashes.
+package metalink
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/checksum"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// Media types for Metalink documents
+const (
+	ContentType   = "application/metalink4+xml" // RFC 5854
+	ContentTypeV3 = "application/metalink+xml"  // Metalink 3.0
+)
+
+// maxDocumentSize bounds how much of a Metalink document is read
+const maxDocumentSize = 16 * 1024 * 1024
+
+// fetchTimeout bounds fetching a remote Metalink document
+const fetchTimeout = 30 * time.Second
+
+// SupportedSchemes lists URL schemes that can be used as mirrors
+var SupportedSchemes = map[string]bool{
+	"http":  true,
+	"https": true,
+}
+
+// Metalink is a parsed Metalink document
+type Metalink struct {
+	Files []File
+}
+
+// File is a single file described by a Metalink document
+type File struct {
+	Name     string
+	Size     int64
+	URLs     []URL
+	Checksum string             // Strongest whole-file hash ("algo:hex"), empty if none
+	Pieces   *types.PieceHashes // Per-piece hashes, nil if none
+}
+
+// URL is a mirror for a file. Lower priority values are preferred.
+type URL struct {
+	URL      string
+	Location string
+	Priority int
+}
+
+// Mirrors returns the usable URLs for the file, most preferred first
+func (f File) Mirrors() []string {
+	urls := make([]URL, 0, len(f.URLs))
+	for _, u := range f.URLs {
+		parsed, err := url.Parse(u.URL)
+		if err != nil || !SupportedSchemes[strings.ToLower(parsed.Scheme)] {
+			continue
+		}
+		urls = append(urls, u)
+	}
+	sort.SliceStable(urls, func(i, j int) bool {
+		return urls[i].Priority < urls[j].Priority
+	})
+
+	out := make([]string, len(urls))
+	for i, u := range urls {
+		out[i] = u.URL
+	}
+	return out
+}
+
+// Options returns the download options described by the file
+func (f File) Options() types.DownloadOptions {
+	return types.DownloadOptions{
+		Checksum: f.Checksum,
+		Pieces:   f.Pieces,
+		Size:     f.Size,
+	}
+}
+
+// IsMetalink reports whether a path or URL names a Metalink document
+func IsMetalink(source string) bool {
+	p := source
+	if u, err := url.Parse(source); err == nil && u.Scheme != "" && u.Host != "" {
+		p = u.Path
+	}
+	ext := strings.ToLower(path.Ext(p))
+	return ext == ".meta4" || ext == ".metalink"
+}
+
+// IsContentType reports whether a media type is a Metalink document
+func IsContentType(contentType string) bool {
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	mediaType = strings.ToLower(strings.TrimSpace(mediaType))
+	return mediaType == ContentType || mediaType == ContentTypeV3
+}
+
+// Load reads a Metalink document from a local path or an http(s) URL
+func Load(ctx context.Context, source string) (*Metalink, error) {
+	if u, err := url.Parse(source); err == nil && (u.Scheme == "http" || u.Scheme == "https") {
+		return fetch(ctx, source)
+	}
+
+	f, err := os.Open(source)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open metalink: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	return Parse(f)
+}
+
+func fetch(ctx context.Context, rawurl string) (*Metalink, error) {
+	ctx, cancel := context.WithTimeout(ctx, fetchTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawurl, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", ContentType+", "+ContentTypeV3+";q=0.9")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch metalink: %w", err)
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch metalink: unexpected status %d", resp.StatusCode)
+	}
+	return Parse(resp.Body)
+}
+
+// Parse decodes a Metalink 4 (RFC 5854) or Metalink 3 document
+func Parse(r io.Reader) (*Metalink, error) {
+	var doc document
+	if err := xml.NewDecoder(io.LimitReader(r, maxDocumentSize)).Decode(&doc); err != nil {
+		return nil, fmt.Errorf("invalid metalink: %w", err)
+	}
+	if doc.XMLName.Local != "metalink" {
+		return nil, fmt.Errorf("invalid metalink: unexpected root element <%s>", doc.XMLName.Local)
+	}
+
+	ml := &Metalink{}
+	for _, df := range append(doc.Files, doc.V3Files...) {
+		f, err := df.file()
+		if err != nil {
+			return nil, err
+		}
+		ml.Files = append(ml.Files, f)
+	}
+	if len(ml.Files) == 0 {
+		return nil, fmt.Errorf("invalid metalink: no files")
+	}
+	return ml, nil
+}
+
+// document covers both formats: Metalink 4 lists <file> under the root,
+// Metalink 3 wraps them in <files> and nests URLs and hashes one level deeper
+type document struct {
+	XMLName xml.Name
+	Files   []docFile `xml:"file"`
+	V3Files []docFile `xml:"files>file"`
+}
+
+type docFile struct {
+	Name   string      `xml:"name,attr"`
+	Size   int64       `xml:"size"`
+	URLs   []docURL    `xml:"url"`
+	Hashes []docHash   `xml:"hash"`
+	Pieces []docPieces `xml:"pieces"`
+
+	// Metalink 3
+	V3URLs   []docURL    `xml:"resources>url"`
+	V3Hashes []docHash   `xml:"verification>hash"`
+	V3Pieces []docPieces `xml:"verification>pieces"`
+}
+
+type docURL struct {
+	Value      string `xml:",chardata"`
+	Location   string `xml:"location,attr"`
+	Priority   int    `xml:"priority,attr"`
+	Preference int    `xml:"preference,attr"` // Metalink 3: 0-100, higher preferred
+}
+
+type docHash struct {
+	Type  string `xml:"type,attr"`
+	Value string `xml:",chardata"`
+}
+
+type docPieces struct {
+	Type   string    `xml:"type,attr"`
+	Length int64     `xml:"length,attr"`
+	Hashes []docHash `xml:"hash"`
+}
+
+func (df docFile) file() (File, error) {
+	name := strings.TrimSpace(df.Name)
+	if name == "" {
+		return File{}, fmt.Errorf("invalid metalink: file without name")
+	}
+	// Names may carry a relative directory; only the base name is used on disk
+	slashed := filepath.ToSlash(name)
+	if strings.HasPrefix(slashed, "/") || filepath.IsAbs(name) {
+		return File{}, fmt.Errorf("invalid metalink: unsafe file name %q", name)
+	}
+	for _, segment := range strings.Split(slashed, "/") {
+		if segment == ".." {
+			return File{}, fmt.Errorf("invalid metalink: unsafe file name %q", name)
+		}
+	}
+
+	f := File{Name: path.Base(slashed), Size: df.Size}
+
+	for _, u := range df.URLs {
+		f.URLs = append(f.URLs, URL{URL: strings.TrimSpace(u.Value), Location: u.Location, Priority: priority(u.Priority)})
+	}
+	for _, u := range df.V3URLs {
+		// Map 3.0 preference (higher is better) onto 4.0 priority (lower is better)
+		f.URLs = append(f.URLs, URL{URL: strings.TrimSpace(u.Value), Location: u.Location, Priority: 101 - u.Preference})
+	}
+	if len(f.Mirrors()) == 0 {
+		return File{}, fmt.Errorf("invalid metalink: no usable URLs for %q", f.Name)
+	}
+
+	var sums []checksum.Checksum
+	for _, h := range append(df.Hashes, df.V3Hashes...) {
+		if c, err := checksum.Parse(h.Type + ":" + strings.TrimSpace(h.Value)); err == nil {
+			sums = append(sums, c)
+		}
+	}
+	if c, ok := checksum.Strongest(sums); ok {
+		f.Checksum = c.String()
+	}
+
+	f.Pieces = strongestPieces(append(df.Pieces, df.V3Pieces...))
+	return f, nil
+}
+
+// priority maps a missing RFC 5854 priority to the lowest preference
+func priority(p int) int {
+	if p <= 0 {
+		return 999999
+	}
+	return p
+}
+
+// strongestPieces returns the piece hashes using the strongest supported algorithm
+func strongestPieces(all []docPieces) *types.PieceHashes {
+	var candidates []*types.PieceHashes
+	var sums []checksum.Checksum
+	for _, dp := range all {
+		p := &types.PieceHashes{Algorithm: dp.Type, Length: dp.Length}
+		for _, h := range dp.Hashes {
+			p.Hashes = append(p.Hashes, h.Value)
+		}
+		if checksum.NormalizePieces(p) != nil {
+			continue
+		}
+		candidates = append(candidates, p)
+		sums = append(sums, checksum.Checksum{Algorithm: p.Algorithm})
+	}
+
+	best, ok := checksum.Strongest(sums)
+	if !ok {
+		return nil
+	}
+	for _, p := range candidates {
+		if p.Algorithm == best.Algorithm {
+			return p
+		}
+	}
+	return nil
+}
@@ -0,0 +1,168 @@
+package metalink
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+const sha256Hex = "0b6e2a3c6fd5b1e8a1e1a8d2e6f9b1c0c3b1f3c8d2e4a6b8c0d2e4f6a8b0c2d4"
+
+const v4Doc = `<?xml version="1.0" encoding="UTF-8"?>
+<metalink xmlns="urn:ietf:params:xml:ns:metalink">
+  <file name="distro.iso">
+    <size>1048576</size>
+    <hash type="md5">d41d8cd98f00b204e9800998ecf8427e</hash>
+    <hash type="sha-256">` + sha256Hex + `</hash>
+    <pieces length="524288" type="sha-1">
+      <hash>da39a3ee5e6b4b0d3255bfef95601890afd80709</hash>
+      <hash>DA39A3EE5E6B4B0D3255BFEF95601890AFD80709</hash>
+    </pieces>
+    <url location="de" priority="2">https://de.example.org/distro.iso</url>
+    <url priority="1">https://us.example.org/distro.iso</url>
+    <url>https://fallback.example.org/distro.iso</url>
+    <url priority="1">rsync://rsync.example.org/distro.iso</url>
+    <metaurl mediatype="torrent" priority="1">https://example.org/distro.torrent</metaurl>
+  </file>
+</metalink>`
+
+const v3Doc = `<?xml version="1.0" encoding="UTF-8"?>
+<metalink version="3.0" xmlns="http://www.metalinker.org/">
+  <files>
+    <file name="tools/app.tar.gz">
+      <size>2048</size>
+      <verification>
+        <hash type="sha256">` + sha256Hex + `</hash>
+      </verification>
+      <resources>
+        <url type="http" preference="50">http://slow.example.org/app.tar.gz</url>
+        <url type="http" preference="100">http://fast.example.org/app.tar.gz</url>
+      </resources>
+    </file>
+  </files>
+</metalink>`
+
+func TestParse_V4(t *testing.T) {
+	ml, err := Parse(strings.NewReader(v4Doc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(ml.Files) != 1 {
+		t.Fatalf("expected 1 file, got %d", len(ml.Files))
+	}
+
+	f := ml.Files[0]
+	if f.Name != "distro.iso" || f.Size != 1048576 {
+		t.Errorf("unexpected file: name=%q size=%d", f.Name, f.Size)
+	}
+	if f.Checksum != "sha256:"+sha256Hex {
+		t.Errorf("Checksum = %q, want strongest (sha256)", f.Checksum)
+	}
+
+	want := []string{
+		"https://us.example.org/distro.iso",
+		"https://de.example.org/distro.iso",
+		"https://fallback.example.org/distro.iso",
+	}
+	got := f.Mirrors()
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Mirrors() = %v, want %v", got, want)
+	}
+
+	if f.Pieces == nil {
+		t.Fatal("expected piece hashes")
+	}
+	if f.Pieces.Algorithm != "sha1" || f.Pieces.Length != 524288 || len(f.Pieces.Hashes) != 2 {
+		t.Errorf("unexpected pieces: %+v", f.Pieces)
+	}
+	if f.Pieces.Hashes[1] != "da39a3ee5e6b4b0d3255bfef95601890afd80709" {
+		t.Errorf("piece hash not normalized: %q", f.Pieces.Hashes[1])
+	}
+
+	opts := f.Options()
+	if opts.Size != f.Size || opts.Checksum != f.Checksum || opts.Pieces != f.Pieces {
+		t.Errorf("Options() = %+v does not match file", opts)
+	}
+}
+
+func TestParse_V3(t *testing.T) {
+	ml, err := Parse(strings.NewReader(v3Doc))
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	f := ml.Files[0]
+	if f.Name != "app.tar.gz" {
+		t.Errorf("Name = %q, want base name", f.Name)
+	}
+	if f.Checksum != "sha256:"+sha256Hex {
+		t.Errorf("Checksum = %q", f.Checksum)
+	}
+	if m := f.Mirrors(); len(m) != 2 || m[0] != "http://fast.example.org/app.tar.gz" {
+		t.Errorf("Mirrors() = %v, want highest preference first", m)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		doc  string
+	}{
+		{"not xml", "https://example.org/file.iso"},
+		{"wrong root", `<feed><file name="a"><url>https://a/a</url></file></feed>`},
+		{"no files", `<metalink xmlns="urn:ietf:params:xml:ns:metalink"></metalink>`},
+		{"no usable urls", `<metalink xmlns="urn:ietf:params:xml:ns:metalink"><file name="a"><url>rsync://a/a</url></file></metalink>`},
+		{"path traversal", `<metalink xmlns="urn:ietf:params:xml:ns:metalink"><file name="../a"><url>https://a/a</url></file></metalink>`},
+		{"absolute path", `<metalink xmlns="urn:ietf:params:xml:ns:metalink"><file name="/etc/a"><url>https://a/a</url></file></metalink>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse(strings.NewReader(tt.doc)); err == nil {
+				t.Error("expected error")
+			}
+		})
+	}
+}
+
+func TestIsMetalink(t *testing.T) {
+	tests := map[string]bool{
+		"distro.meta4":                           true,
+		"/tmp/Distro.METALINK":                   true,
+		"https://example.org/distro.iso.meta4":   true,
+		"https://example.org/get?file=x.meta4":   false,
+		"https://example.org/distro.iso":         false,
+		"https://example.org/distro.iso,mirror2": false,
+	}
+	for source, want := range tests {
+		if got := IsMetalink(source); got != want {
+			t.Errorf("IsMetalink(%q) = %v, want %v", source, got, want)
+		}
+	}
+
+	if !IsContentType("application/metalink4+xml; charset=utf-8") || IsContentType("application/json") {
+		t.Error("IsContentType mismatch")
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "distro.meta4")
+	if err := os.WriteFile(path, []byte(v4Doc), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if ml, err := Load(context.Background(), path); err != nil || len(ml.Files) != 1 {
+		t.Fatalf("Load(file) = %v, %v", ml, err)
+	}
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", ContentType)
+		_, _ = w.Write([]byte(v4Doc))
+	}))
+	defer server.Close()
+
+	if ml, err := Load(context.Background(), server.URL+"/distro.meta4"); err != nil || len(ml.Files) != 1 {
+		t.Fatalf("Load(url) = %v, %v", ml, err)
+	}
+}
@@ -0,0 +1,352 @@
+// Package mirror copies a small static site for offline use: a page, the
+// images, stylesheets and scripts it needs, and the pages it links to within
+// a scope. Every file is an ordinary download in the queue. When a page or
+// stylesheet finishes, its links are rewritten to point at the local copies
+// and the files they name are queued in turn.
+package mirror
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+const (
+	// DefaultMaxFiles keeps a mirror that escapes its scope from filling the queue
+	DefaultMaxFiles = 2000
+
+	maxPageSize = 32 << 20 // Larger pages are left as downloaded
+)
+
+// Options controls how far a mirror reaches
+type Options struct {
+	MaxDepth  int  `json:"max_depth,omitempty"`  // Levels of links to follow from the first page; 0 means no limit
+	SpanHosts bool `json:"span_hosts,omitempty"` // Also fetch assets from other hosts, such as CDNs
+	MaxFiles  int  `json:"max_files,omitempty"`  // 0 means DefaultMaxFiles
+}
+
+// Enqueue queues a download of rawurl into dir as filename and returns its ID.
+// The file must be saved under exactly that name.
+type Enqueue func(rawurl, dir, filename string) (string, error)
+
+// Result sums up a finished mirror
+type Result struct {
+	ID     string // The first page's download ID, which also names the mirror
+	URL    string
+	Index  string // Local copy of the first page
+	Files  int    // Files downloaded
+	Failed int    // Files that failed or were removed from the queue
+}
+
+// Manager tracks the mirrors in progress
+type Manager struct {
+	enqueue Enqueue
+	done    func(Result)
+
+	mu   sync.Mutex
+	jobs map[string]*job // By the download ID of each queued file
+}
+
+// NewManager creates a Manager that queues files with enqueue and calls done
+// when every file of a mirror has finished or failed
+func NewManager(enqueue Enqueue, done func(Result)) *Manager {
+	return &Manager{enqueue: enqueue, done: done, jobs: make(map[string]*job)}
+}
+
+// job is one mirror in progress
+type job struct {
+	id    string
+	root  *url.URL
+	scope string // Path prefix of the pages to follow
+	dir   string
+	opts  Options
+
+	files   map[string]*file // By URL without fragment
+	ids     map[string]*file // Queued files by download ID
+	taken   map[string]bool  // Local paths in use
+	done    int
+	failed  int
+	pending int
+}
+
+// file is a page or asset of a mirror
+type file struct {
+	url   *url.URL
+	local string // Slash-separated, relative to the mirror's directory
+	page  bool
+	depth int // Links followed from the first page
+}
+
+// Start queues the page at rawurl and returns the mirror's ID. Pages are
+// followed when they are on the same host and under the page's folder; files
+// are saved under dir in a folder per host.
+func (m *Manager) Start(rawurl, dir string, opts Options) (string, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", fmt.Errorf("invalid url %q", rawurl)
+	}
+	u.Fragment = ""
+	u.RawFragment = ""
+	if opts.MaxFiles <= 0 {
+		opts.MaxFiles = DefaultMaxFiles
+	}
+
+	scope := u.Path
+	if i := strings.LastIndexByte(scope, '/'); i >= 0 {
+		scope = scope[:i+1]
+	} else {
+		scope = "/"
+	}
+	j := &job{
+		root:  u,
+		scope: scope,
+		dir:   dir,
+		opts:  opts,
+		files: make(map[string]*file),
+		ids:   make(map[string]*file),
+		taken: make(map[string]bool),
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f := j.add(u, true, 0)
+	id, err := m.queue(j, f)
+	if err != nil {
+		return "", err
+	}
+	j.id = id
+	return id, nil
+}
+
+// Completed handles a finished download stored at filePath. Downloads that
+// are not part of a mirror are ignored. A page or stylesheet has its links
+// rewritten and the files they name queued. Called off the event loop, as
+// queuing files raises events of its own.
+func (m *Manager) Completed(id, filePath string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j := m.jobs[id]
+	if j == nil {
+		return
+	}
+	f := j.ids[id]
+	delete(m.jobs, id)
+	j.pending--
+	j.done++
+
+	if filePath == "" {
+		filePath = j.path(f)
+	}
+	var found []*file
+	link := func(target *url.URL, kind linkKind) string {
+		return j.link(f, target, kind, &found)
+	}
+	if err := rewriteFile(filePath, f.url, link); err != nil {
+		utils.Debug("Mirror %s: %v", j.id, err)
+	}
+	for _, nf := range found {
+		if _, err := m.queue(j, nf); err != nil {
+			utils.Debug("Mirror %s: failed to queue %s: %v", j.id, nf.url, err)
+		}
+	}
+	m.finish(j)
+}
+
+// Failed records a download of a mirror that failed or was removed
+func (m *Manager) Failed(id string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	j := m.jobs[id]
+	if j == nil {
+		return
+	}
+	delete(m.jobs, id)
+	j.pending--
+	j.failed++
+	m.finish(j)
+}
+
+// queue hands a file to the download queue. Caller must hold m.mu.
+func (m *Manager) queue(j *job, f *file) (string, error) {
+	id, err := m.enqueue(f.url.String(), filepath.Dir(j.path(f)), path.Base(f.local))
+	if err != nil {
+		j.failed++
+		return "", err
+	}
+	j.ids[id] = f
+	j.pending++
+	m.jobs[id] = j
+	return id, nil
+}
+
+// finish reports a mirror with nothing left to download. Caller must hold m.mu.
+func (m *Manager) finish(j *job) {
+	if j.pending > 0 {
+		return
+	}
+	utils.Debug("Mirror %s of %s done: %d files, %d failed", j.id, j.root, j.done, j.failed)
+	if m.done != nil {
+		m.done(Result{
+			ID:     j.id,
+			URL:    j.root.String(),
+			Index:  j.path(j.files[j.root.String()]),
+			Files:  j.done,
+			Failed: j.failed,
+		})
+	}
+}
+
+// path returns where a file is saved
+func (j *job) path(f *file) string {
+	return filepath.Join(j.dir, filepath.FromSlash(f.local))
+}
+
+// add registers a file of the mirror under a free local path
+func (j *job) add(u *url.URL, page bool, depth int) *file {
+	local := localPath(u, page)
+	if j.taken[local] {
+		// e.g. "/about" saved as about.html when /about.html is also linked
+		ext := path.Ext(local)
+		local = strings.TrimSuffix(local, ext) + "_" + shortHash(u.String()) + ext
+	}
+	j.taken[local] = true
+
+	f := &file{url: u, local: local, page: page, depth: depth}
+	j.files[u.String()] = f
+	return f
+}
+
+// link returns what replaces a link to target in from: the relative path of
+// its local copy if it is, or now will be, part of the mirror, else the
+// absolute URL. Newly added files are appended to found.
+func (j *job) link(from *file, target *url.URL, kind linkKind, found *[]*file) string {
+	bare := *target
+	bare.Fragment = ""
+	bare.RawFragment = ""
+
+	f, ok := j.files[bare.String()]
+	if !ok {
+		if !j.follows(from, &bare, kind) || len(j.files) >= j.opts.MaxFiles {
+			return target.String()
+		}
+		depth := from.depth
+		if kind == pageLink {
+			depth++
+		}
+		f = j.add(&bare, kind == pageLink, depth)
+		*found = append(*found, f)
+	}
+
+	rel := relativeLink(from.local, f.local)
+	if target.Fragment != "" {
+		rel += "#" + target.EscapedFragment()
+	}
+	return rel
+}
+
+// follows reports whether a link from a file is part of the mirror
+func (j *job) follows(from *file, target *url.URL, kind linkKind) bool {
+	sameHost := strings.EqualFold(target.Host, j.root.Host)
+	switch kind {
+	case pageLink:
+		if !sameHost || !strings.HasPrefix(target.Path, j.scope) {
+			return false
+		}
+		return j.opts.MaxDepth <= 0 || from.depth < j.opts.MaxDepth
+	case assetLink:
+		return sameHost || j.opts.SpanHosts
+	}
+	return false
+}
+
+// Pages served by scripts are saved with .html so browsers open them offline
+var scriptExts = map[string]bool{"": true, ".php": true, ".asp": true, ".aspx": true, ".jsp": true, ".cgi": true, ".pl": true}
+
+// localPath maps a URL to a slash-separated path under a folder for its host,
+// e.g. https://example.com/docs/ to example.com/docs/index.html. URLs with a
+// query get a hash of it in the name, so each is kept.
+func localPath(u *url.URL, page bool) string {
+	p := u.Path
+	if p == "" || strings.HasSuffix(p, "/") {
+		p += "index.html"
+	} else if page && scriptExts[strings.ToLower(path.Ext(p))] {
+		p += ".html"
+	}
+	if u.RawQuery != "" {
+		ext := path.Ext(p)
+		p = strings.TrimSuffix(p, ext) + "_" + shortHash(u.RawQuery) + ext
+	}
+	host := strings.ReplaceAll(strings.ToLower(u.Host), ":", "_")
+	return path.Join(host, path.Clean("/"+p))
+}
+
+func shortHash(s string) string {
+	sum := sha1.Sum([]byte(s))
+	return hex.EncodeToString(sum[:4])
+}
+
+// relativeLink returns the link from the file at from to the file at to,
+// both slash-separated paths under the same folder
+func relativeLink(from, to string) string {
+	rel, err := filepath.Rel(filepath.FromSlash(path.Dir(from)), filepath.FromSlash(to))
+	if err != nil {
+		rel = to
+	}
+	segments := strings.Split(filepath.ToSlash(rel), "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	link := strings.Join(segments, "/")
+	if strings.Contains(segments[0], ":") {
+		// Would read as a URL scheme
+		link = "./" + link
+	}
+	return link
+}
+
+// rewriteFile rewrites the links of a downloaded page or stylesheet in place.
+// Other files are left alone.
+func rewriteFile(filePath string, u *url.URL, link rewriter) error {
+	ext := strings.ToLower(filepath.Ext(filePath))
+	isPage := ext == ".html" || ext == ".htm" || ext == ".xhtml"
+	if !isPage && ext != ".css" {
+		return nil
+	}
+	info, err := os.Stat(filePath)
+	if err != nil {
+		return err
+	}
+	if info.Size() > maxPageSize {
+		return fmt.Errorf("not rewriting %s: too large", filePath)
+	}
+	data, err := os.ReadFile(filePath)
+	if err != nil {
+		return err
+	}
+
+	var out []byte
+	if isPage {
+		// A page link can lead to a file served under a page-like name
+		if !strings.HasPrefix(http.DetectContentType(data), "text/") {
+			return nil
+		}
+		out, err = rewriteHTML(data, u, link)
+		if err != nil {
+			return fmt.Errorf("not rewriting %s: %w", filePath, err)
+		}
+	} else {
+		out = rewriteCSS(data, u, link)
+	}
+	return os.WriteFile(filePath, out, info.Mode().Perm())
+}
@@ -0,0 +1,209 @@
+package mirror
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var site = map[string]string{
+	"/site/": `<!DOCTYPE html>
+<html><head>
+<link rel="stylesheet" href="css/style.css">
+<link rel="canonical" href="https://example.org/site/">
+<style>body { background: url('img/bg.png') }</style>
+<script src="/static/app.js?v=3"></script>
+</head><body>
+<a href="about/">About</a>
+<a href="page.php?id=2#top">Page</a>
+<a href="../outside.html">Outside</a>
+<a href="mailto:me@example.com">Mail</a>
+<a href="#local">Here</a>
+<img src="img/logo.png" srcset="img/logo.png 1x, img/logo@2x.png 2x" alt="Logo &amp; name">
+<img src="img/missing.png">
+<img src="https://cdn.example.net/x.png">
+</body></html>`,
+	"/site/css/style.css":   `@import "fonts.css"; .x { background: url(../img/bg.png) }`,
+	"/site/css/fonts.css":   `@font-face { src: url("/fonts/a.woff") }`,
+	"/site/about/":          `<base href="/site/"><a href="about/deep/">Deep</a> <a href="./">Home</a>`,
+	"/site/about/deep/":     `<html><body><a href="more/">More</a></body></html>`,
+	"/site/page.php":        `<html><body><a href="/site/">Home</a></body></html>`,
+	"/static/app.js":        `console.log("hi")`,
+	"/site/img/bg.png":      "png",
+	"/site/img/logo.png":    "png",
+	"/site/img/logo@2x.png": "png",
+	"/fonts/a.woff":         "woff",
+}
+
+// runMirror mirrors the test site, downloading each queued file in turn the
+// way the queue would
+func runMirror(t *testing.T, opts Options) (dir, host string, result Result) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, ok := site[r.URL.Path]
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = io.WriteString(w, body)
+	}))
+	defer server.Close()
+
+	type download struct{ id, url, path string }
+	var queue []download
+	var results []Result
+	m := NewManager(func(rawurl, dir, filename string) (string, error) {
+		id := strings.Repeat("x", len(queue)+1)
+		queue = append(queue, download{id: id, url: rawurl, path: filepath.Join(dir, filename)})
+		return id, nil
+	}, func(r Result) { results = append(results, r) })
+
+	dir = t.TempDir()
+	if _, err := m.Start(server.URL+"/site/", dir, opts); err != nil {
+		t.Fatalf("Start failed: %v", err)
+	}
+	for i := 0; i < len(queue); i++ {
+		d := queue[i]
+		resp, err := http.Get(d.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(resp.Body)
+		_ = resp.Body.Close()
+		if resp.StatusCode != http.StatusOK {
+			m.Failed(d.id)
+			continue
+		}
+		if err := os.MkdirAll(filepath.Dir(d.path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(d.path, body, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		m.Completed(d.id, d.path)
+	}
+
+	if len(results) != 1 {
+		t.Fatalf("done called %d times, want once", len(results))
+	}
+	u, _ := url.Parse(server.URL)
+	return dir, strings.ReplaceAll(u.Host, ":", "_"), results[0]
+}
+
+func read(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("missing %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func TestMirror(t *testing.T) {
+	dir, host, result := runMirror(t, Options{MaxDepth: 2})
+	root := filepath.Join(dir, host)
+	query := shortHash("id=2")
+	js := "app_" + shortHash("v=3") + ".js"
+
+	index := read(t, filepath.Join(root, "site", "index.html"))
+	for _, want := range []string{
+		`href="css/style.css"`,
+		`href="https://example.org/site/"`, // Canonical links are not followed
+		`url('img/bg.png')`,                // Already relative, so left as it was
+		`src="../static/` + js + `"`,
+		`href="about/index.html"`,
+		`href="page.php_` + query + `.html#top"`,
+		`href="http://` + strings.ReplaceAll(host, "_", ":") + `/outside.html"`, // Out of scope
+		`href="mailto:me@example.com"`,
+		`href="#local"`,
+		`srcset="img/logo.png 1x, img/logo@2x.png 2x"`,
+		`alt="Logo &amp; name"`,
+		`src="https://cdn.example.net/x.png"`,
+		"<!DOCTYPE html>",
+	} {
+		if !strings.Contains(index, want) {
+			t.Errorf("index.html lacks %s:\n%s", want, index)
+		}
+	}
+
+	about := read(t, filepath.Join(root, "site", "about", "index.html"))
+	if strings.Contains(about, "<base") || !strings.Contains(about, `href="deep/index.html"`) || !strings.Contains(about, `href="../index.html"`) {
+		t.Errorf("about/index.html not rewritten against its <base>:\n%s", about)
+	}
+	deep := read(t, filepath.Join(root, "site", "about", "deep", "index.html"))
+	if !strings.Contains(deep, `href="http://`) {
+		t.Errorf("links past the depth limit should stay absolute:\n%s", deep)
+	}
+	page := read(t, filepath.Join(root, "site", "page.php_"+query+".html"))
+	if !strings.Contains(page, `href="index.html"`) {
+		t.Errorf("page.php not rewritten:\n%s", page)
+	}
+
+	style := read(t, filepath.Join(root, "site", "css", "style.css"))
+	if style != site["/site/css/style.css"] {
+		t.Errorf("style.css = %s", style)
+	}
+	fonts := read(t, filepath.Join(root, "site", "css", "fonts.css"))
+	if fonts != `@font-face { src: url("../../fonts/a.woff") }` {
+		t.Errorf("fonts.css = %s", fonts)
+	}
+	for _, asset := range []string{"site/img/logo.png", "site/img/logo@2x.png", "site/img/bg.png", "fonts/a.woff", "static/" + js} {
+		read(t, filepath.Join(root, filepath.FromSlash(asset)))
+	}
+
+	if result.Files != 11 || result.Failed != 1 {
+		t.Errorf("result = %+v, want 11 files and 1 failed", result)
+	}
+	if result.Index != filepath.Join(root, "site", "index.html") {
+		t.Errorf("Index = %s", result.Index)
+	}
+}
+
+func TestMirrorMaxFiles(t *testing.T) {
+	_, _, result := runMirror(t, Options{MaxFiles: 3})
+	if result.Files+result.Failed != 3 {
+		t.Errorf("result = %+v, want 3 files in all", result)
+	}
+}
+
+func TestLocalPath(t *testing.T) {
+	tests := []struct {
+		url  string
+		page bool
+		want string
+	}{
+		{"https://example.com", true, "example.com/index.html"},
+		{"https://example.com/docs/", true, "example.com/docs/index.html"},
+		{"https://Example.com:8080/a.css", false, "example.com_8080/a.css"},
+		{"https://example.com/about", true, "example.com/about.html"},
+		{"https://example.com/about", false, "example.com/about"},
+		{"https://example.com/list.php?p=2", true, "example.com/list.php_" + shortHash("p=2") + ".html"},
+		{"https://example.com/../../etc/passwd", false, "example.com/etc/passwd"},
+		{"https://example.com/a%20b.png", false, "example.com/a b.png"},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		if got := localPath(u, tt.page); got != tt.want {
+			t.Errorf("localPath(%s, %v) = %s, want %s", tt.url, tt.page, got, tt.want)
+		}
+	}
+}
+
+func TestRelativeLink(t *testing.T) {
+	tests := []struct{ from, to, want string }{
+		{"h/index.html", "h/a.png", "a.png"},
+		{"h/docs/index.html", "h/img/a b.png", "../img/a%20b.png"},
+		{"h/index.html", "cdn.net/x.js", "../cdn.net/x.js"},
+		{"h/index.html", "h/c:d.html", "./c:d.html"},
+	}
+	for _, tt := range tests {
+		if got := relativeLink(tt.from, tt.to); got != tt.want {
+			t.Errorf("relativeLink(%s, %s) = %s, want %s", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
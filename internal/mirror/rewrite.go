@@ -0,0 +1,211 @@
+package mirror
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// linkKind says what a link points to, which decides whether it is followed
+type linkKind int
+
+const (
+	pageLink  linkKind = iota // Another page, followed within the scope and depth
+	assetLink                 // Needed to show the page: images, styles, scripts
+	otherLink                 // Made absolute, never followed
+)
+
+// rewriter returns the text that replaces a link to an absolute http(s) URL
+type rewriter func(target *url.URL, kind linkKind) string
+
+var (
+	cssURL    = regexp.MustCompile(`(?i)url\(\s*(?:"([^"]*)"|'([^']*)'|([^)'"\s]*))\s*\)`)
+	cssImport = regexp.MustCompile(`(?i)@import\s+(?:"([^"]*)"|'([^']*)')`)
+)
+
+// rewriteHTML passes every link in a page through rw. Tags without links
+// and all other content are copied byte for byte. A <base> element is
+// dropped, as the rewritten links are relative to the file itself.
+func rewriteHTML(data []byte, page *url.URL, rw rewriter) ([]byte, error) {
+	var out bytes.Buffer
+	out.Grow(len(data))
+	base := page
+	inStyle := false
+
+	z := html.NewTokenizer(bytes.NewReader(data))
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			if err := z.Err(); err != io.EOF {
+				return nil, err
+			}
+			return out.Bytes(), nil
+		case html.TextToken:
+			if inStyle {
+				out.Write(rewriteCSS(z.Raw(), base, rw))
+				continue
+			}
+		case html.StartTagToken, html.SelfClosingTagToken:
+			raw := append([]byte(nil), z.Raw()...)
+			tok := z.Token()
+			switch tok.DataAtom {
+			case atom.Base:
+				if href, ok := attr(tok, "href"); ok {
+					if u, err := base.Parse(strings.TrimSpace(href)); err == nil {
+						base = u
+					}
+				}
+				continue
+			case atom.Style:
+				inStyle = tt == html.StartTagToken
+			}
+			if rewriteTag(&tok, base, rw) {
+				out.WriteString(tok.String())
+			} else {
+				out.Write(raw)
+			}
+			continue
+		case html.EndTagToken:
+			out.Write(z.Raw())
+			if name, _ := z.TagName(); string(name) == "style" {
+				inStyle = false
+			}
+			continue
+		}
+		out.Write(z.Raw())
+	}
+}
+
+// rewriteTag rewrites the links in a tag's attributes and reports whether
+// any changed
+func rewriteTag(tok *html.Token, base *url.URL, rw rewriter) bool {
+	changed := false
+	for i, a := range tok.Attr {
+		if a.Namespace != "" {
+			continue
+		}
+		var v string
+		switch {
+		case a.Key == "style":
+			v = string(rewriteCSS([]byte(a.Val), base, rw))
+		case a.Key == "srcset" && (tok.DataAtom == atom.Img || tok.DataAtom == atom.Source):
+			v = rewriteSrcset(a.Val, base, rw)
+		default:
+			kind, ok := linkAttr(*tok, a.Key)
+			if !ok {
+				continue
+			}
+			v = rewriteLink(a.Val, base, kind, rw)
+		}
+		if v != a.Val {
+			tok.Attr[i].Val = v
+			changed = true
+		}
+	}
+	return changed
+}
+
+// linkAttr reports whether an attribute of a tag holds a link, and of what kind
+func linkAttr(tok html.Token, key string) (linkKind, bool) {
+	switch tok.DataAtom {
+	case atom.A, atom.Area:
+		return pageLink, key == "href"
+	case atom.Iframe, atom.Frame:
+		return pageLink, key == "src"
+	case atom.Link:
+		if key != "href" {
+			return 0, false
+		}
+		rel, _ := attr(tok, "rel")
+		for _, r := range strings.Fields(strings.ToLower(rel)) {
+			switch r {
+			case "stylesheet", "icon", "apple-touch-icon", "preload", "modulepreload", "manifest":
+				return assetLink, true
+			}
+		}
+		return otherLink, true
+	case atom.Img, atom.Script, atom.Embed, atom.Track, atom.Audio, atom.Source, atom.Input:
+		return assetLink, key == "src"
+	case atom.Video:
+		return assetLink, key == "src" || key == "poster"
+	case atom.Object:
+		return assetLink, key == "data"
+	case atom.Body, atom.Table, atom.Td, atom.Th:
+		return assetLink, key == "background"
+	case atom.Form:
+		return otherLink, key == "action"
+	}
+	return 0, false
+}
+
+func attr(tok html.Token, key string) (string, bool) {
+	for _, a := range tok.Attr {
+		if a.Namespace == "" && a.Key == key {
+			return a.Val, true
+		}
+	}
+	return "", false
+}
+
+// rewriteLink resolves a link against base and passes it through rw.
+// Fragments, and schemes other than http and https, are left alone.
+func rewriteLink(raw string, base *url.URL, kind linkKind, rw rewriter) string {
+	v := strings.TrimSpace(raw)
+	if v == "" || strings.HasPrefix(v, "#") {
+		return raw
+	}
+	target, err := base.Parse(v)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") {
+		return raw
+	}
+	return rw(target, kind)
+}
+
+// rewriteSrcset rewrites each image candidate of a srcset, e.g.
+// "a.png 1x, b.png 2x"
+func rewriteSrcset(raw string, base *url.URL, rw rewriter) string {
+	candidates := strings.Split(raw, ",")
+	for i, c := range candidates {
+		fields := strings.Fields(c)
+		if len(fields) == 0 {
+			continue
+		}
+		fields[0] = rewriteLink(fields[0], base, assetLink, rw)
+		candidates[i] = strings.Join(fields, " ")
+	}
+	return strings.Join(candidates, ", ")
+}
+
+// rewriteCSS rewrites the url() and @import references of a stylesheet, which
+// are all assets
+func rewriteCSS(data []byte, base *url.URL, rw rewriter) []byte {
+	replace := func(re *regexp.Regexp, format string) {
+		data = re.ReplaceAllFunc(data, func(m []byte) []byte {
+			var raw string
+			for _, group := range re.FindSubmatch(m)[1:] {
+				if len(group) > 0 {
+					raw = string(group)
+					break
+				}
+			}
+			if raw == "" {
+				return m
+			}
+			link := rewriteLink(raw, base, assetLink, rw)
+			if link == raw {
+				return m
+			}
+			return []byte(fmt.Sprintf(format, link))
+		})
+	}
+	replace(cssURL, `url("%s")`)
+	replace(cssImport, `@import "%s"`)
+	return data
+}
@@ -0,0 +1,152 @@
+package multipart
+
+import (
+	"math"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Volume naming schemes, checked in order
+var (
+	rarPart   = regexp.MustCompile(`(?i)^(.+)\.part(\d+)\.rar$`) // movie.part1.rar
+	rarOld    = regexp.MustCompile(`(?i)^(.+)\.r(\d{2})$`)       // movie.rar, movie.r00, movie.r01
+	zipSplit  = regexp.MustCompile(`(?i)^(.+)\.z(\d{2})$`)       // movie.z01, movie.z02, movie.zip
+	numbered  = regexp.MustCompile(`^(.+\.[^.]+)\.(\d{3})$`)     // movie.7z.001, movie.mkv.001
+	singleEnd = regexp.MustCompile(`(?i)\.(rar|zip)$`)
+)
+
+// Part is one volume of a multi-part archive
+type Part struct {
+	Set   string // Name of the whole set, e.g. "movie.7z" for movie.7z.001
+	Index int    // Position in the set; only the order matters
+}
+
+// Parse reports whether filename looks like a volume of a multi-part
+// archive. A plain .rar or .zip parses too, as it can be the first or last
+// volume of an old-style set, but it only forms a set with other volumes.
+func Parse(filename string) (Part, bool) {
+	if m := rarPart.FindStringSubmatch(filename); m != nil {
+		n, _ := strconv.Atoi(m[2])
+		return Part{Set: m[1] + ".rar", Index: n}, true
+	}
+	if m := rarOld.FindStringSubmatch(filename); m != nil {
+		n, _ := strconv.Atoi(m[2])
+		return Part{Set: m[1] + ".rar", Index: n + 1}, true // After the .rar
+	}
+	if m := zipSplit.FindStringSubmatch(filename); m != nil {
+		n, _ := strconv.Atoi(m[2])
+		return Part{Set: m[1] + ".zip", Index: n}, true
+	}
+	if m := numbered.FindStringSubmatch(filename); m != nil {
+		n, _ := strconv.Atoi(m[2])
+		return Part{Set: m[1], Index: n}, true
+	}
+	if m := singleEnd.FindStringSubmatch(filename); m != nil {
+		if strings.EqualFold(m[1], "rar") {
+			return Part{Set: filename, Index: 0}, true // First volume
+		}
+		return Part{Set: filename, Index: math.MaxInt32}, true // Last volume
+	}
+	return Part{}, false
+}
+
+// Key identifies a set by directory and set name, so sets with the same name
+// in different directories stay apart
+func Key(dir, set string) string {
+	return dir + "\x00" + strings.ToLower(set)
+}
+
+// Set is a multi-part archive found in a list of files
+type Set struct {
+	Name  string
+	Parts []int // Indices into the list, in volume order
+}
+
+// Group finds the multi-part sets among filenames. Only sets with at least
+// two volumes are returned, in the order their first volume appears.
+func Group(filenames []string) []Set {
+	byName := make(map[string]*Set)
+	var order []string
+	index := make(map[int]int)
+	for i, name := range filenames {
+		p, ok := Parse(name)
+		if !ok {
+			continue
+		}
+		key := strings.ToLower(p.Set)
+		set, seen := byName[key]
+		if !seen {
+			set = &Set{Name: p.Set}
+			byName[key] = set
+			order = append(order, key)
+		}
+		set.Parts = append(set.Parts, i)
+		index[i] = p.Index
+	}
+
+	var sets []Set
+	for _, key := range order {
+		set := byName[key]
+		if len(set.Parts) < 2 {
+			continue
+		}
+		sort.SliceStable(set.Parts, func(a, b int) bool { return index[set.Parts[a]] < index[set.Parts[b]] })
+		sets = append(sets, *set)
+	}
+	return sets
+}
+
+// URLFilename returns the file name at the end of a URL's path
+func URLFilename(raw string) string {
+	if u, err := url.Parse(raw); err == nil {
+		return path.Base(u.Path)
+	}
+	return path.Base(raw)
+}
+
+// GroupURLs is Group for a batch of download URLs
+func GroupURLs(urls []string) []Set {
+	names := make([]string, len(urls))
+	for i, u := range urls {
+		names[i] = URLFilename(u)
+	}
+	return Group(names)
+}
+
+// OrderURLs moves the volumes of each set in a batch next to each other, in
+// volume order, where the set's first listed volume was. Other URLs keep
+// their place.
+func OrderURLs(urls []string) []string {
+	sets := GroupURLs(urls)
+	if len(sets) == 0 {
+		return urls
+	}
+
+	setOf := make(map[int]int) // URL index -> set
+	for s, set := range sets {
+		for _, i := range set.Parts {
+			setOf[i] = s
+		}
+	}
+	placed := make(map[int]bool)
+	ordered := make([]string, 0, len(urls))
+	for i, u := range urls {
+		s, inSet := setOf[i]
+		if !inSet {
+			ordered = append(ordered, u)
+			continue
+		}
+		if placed[s] {
+			continue
+		}
+		placed[s] = true
+		for _, part := range sets[s].Parts {
+			ordered = append(ordered, urls[part])
+		}
+	}
+	return ordered
+}
@@ -0,0 +1,85 @@
+package multipart
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name  string
+		want  Part
+		valid bool
+	}{
+		{"movie.part1.rar", Part{Set: "movie.rar", Index: 1}, true},
+		{"Movie.Part02.RAR", Part{Set: "Movie.rar", Index: 2}, true},
+		{"movie.rar", Part{Set: "movie.rar", Index: 0}, true},
+		{"movie.r00", Part{Set: "movie.rar", Index: 1}, true},
+		{"movie.r11", Part{Set: "movie.rar", Index: 12}, true},
+		{"movie.z01", Part{Set: "movie.zip", Index: 1}, true},
+		{"movie.7z.001", Part{Set: "movie.7z", Index: 1}, true},
+		{"disk.img.012", Part{Set: "disk.img", Index: 12}, true},
+		{"movie.mkv", Part{}, false},
+		{"readme.001", Part{}, false}, // No extension before the number
+		{"movie.7z", Part{}, false},
+	}
+	for _, tt := range tests {
+		got, ok := Parse(tt.name)
+		if ok != tt.valid || (ok && got != tt.want) {
+			t.Errorf("Parse(%q) = %+v, %v; want %+v, %v", tt.name, got, ok, tt.want, tt.valid)
+		}
+	}
+	if last, _ := Parse("movie.zip"); last.Set != "movie.zip" || last.Index <= 99 {
+		t.Errorf("a .zip should sort after its .zNN volumes, got %+v", last)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	names := []string{
+		"notes.txt",
+		"movie.part2.rar",
+		"backup.zip", // Lone zip, not a set
+		"movie.part1.rar",
+		"old.r00",
+		"old.rar",
+		"split.zip",
+		"split.z01",
+		"data.7z.002",
+		"data.7z.001",
+	}
+	got := Group(names)
+	want := []Set{
+		{Name: "movie.rar", Parts: []int{3, 1}},
+		{Name: "old.rar", Parts: []int{5, 4}},
+		{Name: "split.zip", Parts: []int{7, 6}},
+		{Name: "data.7z", Parts: []int{9, 8}},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Group = %+v, want %+v", got, want)
+	}
+}
+
+func TestOrderURLs(t *testing.T) {
+	urls := []string{
+		"https://example.com/files/movie.7z.002",
+		"https://example.com/readme.txt",
+		"https://example.com/files/movie.7z.001?token=abc",
+		"https://example.com/files/movie.7z.003",
+		"https://example.com/other.iso",
+	}
+	want := []string{
+		"https://example.com/files/movie.7z.001?token=abc",
+		"https://example.com/files/movie.7z.002",
+		"https://example.com/files/movie.7z.003",
+		"https://example.com/readme.txt",
+		"https://example.com/other.iso",
+	}
+	if got := OrderURLs(urls); !reflect.DeepEqual(got, want) {
+		t.Errorf("OrderURLs = %v, want %v", got, want)
+	}
+
+	plain := []string{"https://example.com/a.iso", "https://example.com/b.iso"}
+	if got := OrderURLs(plain); !reflect.DeepEqual(got, plain) {
+		t.Errorf("OrderURLs changed a batch without sets: %v", got)
+	}
+}
@@ -0,0 +1,204 @@
+// Package scheduler applies time-of-day bandwidth profiles and download
+// windows to a running worker pool.
+package scheduler
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/engine/ratelimit"
+)
+
+// Action is what a rule does while it is in effect
+type Action struct {
+	Pause     bool  // Pause all downloads
+	RateLimit int64 // Global bandwidth cap in bytes/sec, 0 = unlimited
+}
+
+// Rule applies an action on some weekdays between two times of day.
+// A window whose end is before its start runs past midnight and belongs to
+// the day it starts on.
+type Rule struct {
+	Days   [7]bool // Indexed by time.Weekday
+	Start  int     // Minutes after midnight
+	End    int     // Minutes after midnight, 24*60 for end of day
+	Action Action
+}
+
+// Schedule is an ordered list of rules; the first matching rule wins
+type Schedule []Rule
+
+var dayNames = map[string]time.Weekday{
+	"sun": time.Sunday, "mon": time.Monday, "tue": time.Tuesday, "wed": time.Wednesday,
+	"thu": time.Thursday, "fri": time.Friday, "sat": time.Saturday,
+}
+
+// Parse reads a schedule such as
+//
+//	mon-fri 09:00-18:00 pause; 01:00-07:00 unlimited; 2M
+//
+// Rules are separated by ";" or newlines. Each rule is an optional day list
+// (mon-fri, sat,sun, weekdays, weekends, daily), an optional HH:MM-HH:MM
+// window and an action: "pause", "unlimited", or a rate like "512K".
+// Omitted days or window mean every day and all day.
+func Parse(s string) (Schedule, error) {
+	var schedule Schedule
+	for _, line := range strings.FieldsFunc(s, func(r rune) bool { return r == ';' || r == '\n' }) {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		rule, err := parseRule(fields)
+		if err != nil {
+			return nil, fmt.Errorf("invalid schedule rule %q: %w", strings.TrimSpace(line), err)
+		}
+		schedule = append(schedule, rule)
+	}
+	return schedule, nil
+}
+
+func parseRule(fields []string) (Rule, error) {
+	rule := Rule{Start: 0, End: 24 * 60}
+	haveDays, haveWindow := false, false
+
+	action, err := parseAction(fields[len(fields)-1])
+	if err != nil {
+		return Rule{}, err
+	}
+	rule.Action = action
+
+	for _, field := range fields[:len(fields)-1] {
+		field = strings.ToLower(field)
+		if strings.Contains(field, ":") {
+			if haveWindow {
+				return Rule{}, fmt.Errorf("more than one time window")
+			}
+			if rule.Start, rule.End, err = parseWindow(field); err != nil {
+				return Rule{}, err
+			}
+			haveWindow = true
+			continue
+		}
+		if haveDays {
+			return Rule{}, fmt.Errorf("more than one day list")
+		}
+		if rule.Days, err = parseDays(field); err != nil {
+			return Rule{}, err
+		}
+		haveDays = true
+	}
+
+	if !haveDays {
+		for i := range rule.Days {
+			rule.Days[i] = true
+		}
+	}
+	return rule, nil
+}
+
+func parseAction(s string) (Action, error) {
+	switch strings.ToLower(s) {
+	case "pause", "paused", "stop":
+		return Action{Pause: true}, nil
+	case "unlimited", "none":
+		return Action{}, nil
+	}
+	rate, err := ratelimit.ParseRate(s)
+	if err != nil {
+		return Action{}, fmt.Errorf("unknown action %q", s)
+	}
+	return Action{RateLimit: rate}, nil
+}
+
+func parseWindow(s string) (int, int, error) {
+	from, to, ok := strings.Cut(s, "-")
+	if !ok {
+		return 0, 0, fmt.Errorf("time window %q must be HH:MM-HH:MM", s)
+	}
+	start, err := parseClock(from)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := parseClock(to)
+	if err != nil {
+		return 0, 0, err
+	}
+	if start == end {
+		return 0, 0, fmt.Errorf("empty time window %q", s)
+	}
+	return start, end, nil
+}
+
+func parseClock(s string) (int, error) {
+	var h, m int
+	if _, err := fmt.Sscanf(s, "%d:%d", &h, &m); err != nil || m < 0 || m > 59 || h < 0 || h > 24 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("invalid time %q", s)
+	}
+	return h*60 + m, nil
+}
+
+func parseDays(s string) ([7]bool, error) {
+	var days [7]bool
+	switch s {
+	case "daily", "*":
+		for i := range days {
+			days[i] = true
+		}
+		return days, nil
+	case "weekdays":
+		s = "mon-fri"
+	case "weekends":
+		s = "sat,sun"
+	}
+
+	for _, part := range strings.Split(s, ",") {
+		from, to, isRange := strings.Cut(part, "-")
+		first, ok := dayNames[from]
+		if !ok {
+			return days, fmt.Errorf("unknown day %q", from)
+		}
+		last := first
+		if isRange {
+			if last, ok = dayNames[to]; !ok {
+				return days, fmt.Errorf("unknown day %q", to)
+			}
+		}
+		// Ranges may wrap around the week (e.g. fri-mon)
+		for d := first; ; d = (d + 1) % 7 {
+			days[d] = true
+			if d == last {
+				break
+			}
+		}
+	}
+	return days, nil
+}
+
+// Matches reports whether the rule is in effect at t
+func (r Rule) Matches(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	day := t.Weekday()
+
+	if r.Start < r.End {
+		return r.Days[day] && minute >= r.Start && minute < r.End
+	}
+	// Overnight window: the late part belongs to today, the early part to yesterday
+	if minute >= r.Start {
+		return r.Days[day]
+	}
+	if minute < r.End {
+		return r.Days[(day+6)%7]
+	}
+	return false
+}
+
+// At returns the action of the first rule in effect at t
+func (s Schedule) At(t time.Time) (Action, bool) {
+	for _, r := range s {
+		if r.Matches(t) {
+			return r.Action, true
+		}
+	}
+	return Action{}, false
+}
@@ -0,0 +1,144 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+)
+
+// at returns a time on the given weekday of a fixed week (2024-01-07 is a Sunday)
+func at(day time.Weekday, hour, minute int) time.Time {
+	return time.Date(2024, 1, 7+int(day), hour, minute, 0, 0, time.Local)
+}
+
+func TestParse_Valid(t *testing.T) {
+	s, err := Parse("mon-fri 09:00-18:00 pause; 01:00-07:00 unlimited\n2M")
+	if err != nil {
+		t.Fatalf("Parse failed: %v", err)
+	}
+	if len(s) != 3 {
+		t.Fatalf("expected 3 rules, got %d", len(s))
+	}
+
+	if !s[0].Action.Pause || s[0].Start != 9*60 || s[0].End != 18*60 {
+		t.Errorf("rule 0 = %+v", s[0])
+	}
+	if s[0].Days[time.Sunday] || s[0].Days[time.Saturday] || !s[0].Days[time.Wednesday] {
+		t.Errorf("rule 0 days = %v, want mon-fri", s[0].Days)
+	}
+	if s[1].Action.Pause || s[1].Action.RateLimit != 0 {
+		t.Errorf("rule 1 action = %+v, want unlimited", s[1].Action)
+	}
+	if s[2].Action.RateLimit != 2*1024*1024 || s[2].Start != 0 || s[2].End != 24*60 {
+		t.Errorf("rule 2 = %+v", s[2])
+	}
+	for d, ok := range s[2].Days {
+		if !ok {
+			t.Errorf("rule 2 should apply on day %d", d)
+		}
+	}
+}
+
+func TestParse_Empty(t *testing.T) {
+	s, err := Parse("  ; \n")
+	if err != nil || len(s) != 0 {
+		t.Errorf("Parse(empty) = %v, %v", s, err)
+	}
+}
+
+func TestParse_Invalid(t *testing.T) {
+	for _, input := range []string{
+		"fast",
+		"mon-fri 09:00-18:00",
+		"09:00 pause",
+		"25:00-26:00 pause",
+		"09:00-09:00 pause",
+		"funday pause",
+		"mon 09:00-10:00 10:00-11:00 pause",
+		"mon tue pause",
+	} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("Parse(%q) should fail", input)
+		}
+	}
+}
+
+func TestParseDays_Wraparound(t *testing.T) {
+	days, err := parseDays("fri-mon")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := [7]bool{true, true, false, false, false, true, true}
+	if days != want {
+		t.Errorf("fri-mon = %v, want %v", days, want)
+	}
+}
+
+func TestRule_Matches(t *testing.T) {
+	s, err := Parse("weekdays 09:00-18:00 pause")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := s[0]
+
+	tests := []struct {
+		when time.Time
+		want bool
+	}{
+		{at(time.Monday, 9, 0), true},
+		{at(time.Friday, 17, 59), true},
+		{at(time.Friday, 18, 0), false},
+		{at(time.Tuesday, 8, 59), false},
+		{at(time.Saturday, 12, 0), false},
+	}
+	for _, tt := range tests {
+		if got := r.Matches(tt.when); got != tt.want {
+			t.Errorf("Matches(%v) = %v, want %v", tt.when, got, tt.want)
+		}
+	}
+}
+
+func TestRule_MatchesOvernight(t *testing.T) {
+	s, err := Parse("fri 22:00-06:00 unlimited")
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := s[0]
+
+	tests := []struct {
+		when time.Time
+		want bool
+	}{
+		{at(time.Friday, 23, 0), true},
+		{at(time.Saturday, 5, 59), true}, // Early part belongs to Friday
+		{at(time.Saturday, 6, 0), false},
+		{at(time.Friday, 5, 0), false}, // Thursday night is not scheduled
+		{at(time.Saturday, 23, 0), false},
+	}
+	for _, tt := range tests {
+		if got := r.Matches(tt.when); got != tt.want {
+			t.Errorf("Matches(%v) = %v, want %v", tt.when, got, tt.want)
+		}
+	}
+}
+
+func TestSchedule_FirstMatchWins(t *testing.T) {
+	s, err := Parse("mon-fri 09:00-18:00 pause; 01:00-07:00 unlimited; 2M")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a, ok := s.At(at(time.Monday, 10, 0)); !ok || !a.Pause {
+		t.Errorf("Monday 10:00 = %+v, %v; want pause", a, ok)
+	}
+	if a, ok := s.At(at(time.Saturday, 10, 0)); !ok || a.Pause || a.RateLimit != 2*1024*1024 {
+		t.Errorf("Saturday 10:00 = %+v, %v; want 2M", a, ok)
+	}
+	if a, ok := s.At(at(time.Monday, 3, 0)); !ok || a.Pause || a.RateLimit != 0 {
+		t.Errorf("Monday 03:00 = %+v, %v; want unlimited", a, ok)
+	}
+
+	partial, _ := Parse("sat pause")
+	if _, ok := partial.At(at(time.Monday, 3, 0)); ok {
+		t.Error("no rule should match on Monday")
+	}
+}
@@ -0,0 +1,150 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/engine/ratelimit"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+// CheckInterval is how often the schedule is evaluated
+const CheckInterval = 15 * time.Second
+
+// Pool is the part of download.WorkerPool the scheduler drives
+type Pool interface {
+	GetAll() []types.DownloadConfig
+	Pause(downloadID string) bool
+	Resume(downloadID string) bool
+	GetStatus(id string) *types.DownloadStatus
+	Hold(on bool)
+}
+
+// Scheduler pauses, resumes and throttles downloads according to the
+// schedule in the network settings.
+type Scheduler struct {
+	pool     Pool
+	limiter  *ratelimit.Limiter
+	settings func() *config.Settings
+	now      func() time.Time
+
+	mu       sync.Mutex
+	held     map[string]bool // Downloads paused by the scheduler, resumed when the window ends
+	lastRate int64           // Last rate applied, -1 before the first evaluation
+	holding  bool            // Inside a pause window
+}
+
+// New creates a scheduler for pool. settings is called on every check so
+// edits to the settings file take effect without a restart.
+func New(pool Pool, limiter *ratelimit.Limiter, settings func() *config.Settings) *Scheduler {
+	return &Scheduler{
+		pool:     pool,
+		limiter:  limiter,
+		settings: settings,
+		now:      time.Now,
+		held:     make(map[string]bool),
+		lastRate: -1,
+	}
+}
+
+// Run evaluates the schedule immediately and then every CheckInterval until ctx is done
+func (s *Scheduler) Run(ctx context.Context) {
+	ticker := time.NewTicker(CheckInterval)
+	defer ticker.Stop()
+
+	for {
+		s.Check()
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Holding reports whether downloads are currently held back by the schedule
+func (s *Scheduler) Holding() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.holding || len(s.held) > 0
+}
+
+// Check applies the rule in effect now. A rate rule is enforced on every
+// check, undoing limits set live through the API or the TUI while its window
+// lasts. Outside rate windows global_rate_limit is only applied when it
+// changes, so a live limit lasts until the next boundary.
+func (s *Scheduler) Check() {
+	settings := s.settings()
+	if settings == nil {
+		settings = config.DefaultSettings()
+	}
+
+	schedule, err := Parse(settings.Network.Schedule)
+	if err != nil {
+		utils.Debug("Scheduler: %v", err)
+		schedule = nil
+	}
+
+	action, matched := schedule.At(s.now())
+	rate := settings.Network.GlobalRateLimit
+	inRateWindow := matched && !action.Pause
+	if inRateWindow {
+		rate = action.RateLimit
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if rate != s.lastRate || (inRateWindow && s.limiter.Rate() != rate) {
+		utils.Debug("Scheduler: global rate limit %d B/s", rate)
+		s.limiter.SetRate(rate)
+		s.lastRate = rate
+	}
+
+	s.holding = matched && action.Pause
+	// Queued downloads must not start during a pause window, and are
+	// released before held ones are resumed
+	s.pool.Hold(s.holding)
+	if s.holding {
+		s.pauseAll()
+	} else {
+		s.resumeHeld()
+	}
+}
+
+// pauseAll pauses every running download, including ones started since the
+// last check. Queued ones are left to the hold: pausing a download no worker
+// runs would leave it pausing for good.
+func (s *Scheduler) pauseAll() {
+	for _, cfg := range s.pool.GetAll() {
+		st := cfg.State
+		if st == nil || st.Done.Load() || st.IsPaused() || st.IsPausing() {
+			continue
+		}
+		if status := s.pool.GetStatus(cfg.ID); status != nil && status.Status == "queued" {
+			continue
+		}
+		if s.pool.Pause(cfg.ID) {
+			utils.Debug("Scheduler: paused %s", cfg.ID)
+			s.held[cfg.ID] = true
+		}
+	}
+}
+
+// resumeHeld resumes downloads the schedule paused. Ones still pausing are retried on the next check.
+func (s *Scheduler) resumeHeld() {
+	for id := range s.held {
+		if s.pool.Resume(id) {
+			utils.Debug("Scheduler: resumed %s", id)
+			delete(s.held, id)
+			continue
+		}
+		if st := s.pool.GetStatus(id); st == nil || st.Status != "pausing" {
+			// Removed or finished meanwhile
+			delete(s.held, id)
+		}
+	}
+}
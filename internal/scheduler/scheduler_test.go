@@ -0,0 +1,260 @@
+package scheduler
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/download"
+	"github.com/surge-downloader/surge/internal/engine/ratelimit"
+	"github.com/surge-downloader/surge/internal/engine/state"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/testutil"
+)
+
+// fakePool records pauses and resumes without running downloads
+type fakePool struct {
+	downloads []types.DownloadConfig
+	paused    map[string]bool
+	held      bool
+}
+
+func newFakePool(ids ...string) *fakePool {
+	p := &fakePool{paused: make(map[string]bool)}
+	for _, id := range ids {
+		p.downloads = append(p.downloads, types.DownloadConfig{ID: id, State: types.NewProgressState(id, 1000)})
+	}
+	return p
+}
+
+func (p *fakePool) GetAll() []types.DownloadConfig { return p.downloads }
+
+func (p *fakePool) Hold(on bool) { p.held = on }
+
+func (p *fakePool) Pause(id string) bool {
+	for _, cfg := range p.downloads {
+		if cfg.ID == id {
+			cfg.State.Pause()
+			p.paused[id] = true
+			return true
+		}
+	}
+	return false
+}
+
+func (p *fakePool) Resume(id string) bool {
+	for _, cfg := range p.downloads {
+		if cfg.ID == id && cfg.State.IsPaused() {
+			cfg.State.Resume()
+			delete(p.paused, id)
+			return true
+		}
+	}
+	return false
+}
+
+func (p *fakePool) GetStatus(id string) *types.DownloadStatus {
+	for _, cfg := range p.downloads {
+		if cfg.ID == id {
+			return &types.DownloadStatus{ID: id, Status: "paused"}
+		}
+	}
+	return nil
+}
+
+func newTestScheduler(pool Pool, schedule string, globalRate int64) (*Scheduler, *ratelimit.Limiter, *time.Time) {
+	settings := config.DefaultSettings()
+	settings.Network.Schedule = schedule
+	settings.Network.GlobalRateLimit = globalRate
+
+	limiter := ratelimit.New(0)
+	now := at(time.Monday, 8, 0)
+	s := New(pool, limiter, func() *config.Settings { return settings })
+	s.now = func() time.Time { return now }
+	return s, limiter, &now
+}
+
+func TestScheduler_PauseWindow(t *testing.T) {
+	pool := newFakePool("a", "b")
+	s, _, now := newTestScheduler(pool, "mon-fri 09:00-18:00 pause", 0)
+
+	s.Check()
+	if len(pool.paused) != 0 || s.Holding() {
+		t.Fatal("nothing should be paused before the window")
+	}
+
+	*now = at(time.Monday, 9, 0)
+	s.Check()
+	if !pool.paused["a"] || !pool.paused["b"] || !s.Holding() {
+		t.Fatalf("downloads should be paused inside the window, paused=%v", pool.paused)
+	}
+	if !pool.held {
+		t.Error("queued downloads should be held inside the window")
+	}
+
+	*now = at(time.Monday, 18, 0)
+	s.Check()
+	if len(pool.paused) != 0 || s.Holding() {
+		t.Fatalf("downloads should be resumed after the window, paused=%v", pool.paused)
+	}
+	if pool.held {
+		t.Error("queued downloads should be released after the window")
+	}
+}
+
+func TestScheduler_HoldsEmptyPool(t *testing.T) {
+	pool := newFakePool()
+	s, _, now := newTestScheduler(pool, "09:00-18:00 pause", 0)
+	*now = at(time.Monday, 10, 0)
+	s.Check()
+	if !pool.held || !s.Holding() {
+		t.Error("a pause window should hold the queue even with nothing running")
+	}
+}
+
+func TestScheduler_LeavesManualPausesAlone(t *testing.T) {
+	pool := newFakePool("a", "b")
+	pool.downloads[1].State.Pause() // Paused by the user before the window
+
+	s, _, now := newTestScheduler(pool, "09:00-18:00 pause", 0)
+	*now = at(time.Monday, 10, 0)
+	s.Check()
+
+	*now = at(time.Monday, 19, 0)
+	s.Check()
+	if pool.downloads[0].State.IsPaused() {
+		t.Error("download paused by the schedule should be resumed")
+	}
+	if !pool.downloads[1].State.IsPaused() {
+		t.Error("download paused by the user should stay paused")
+	}
+}
+
+// waitForStatus polls the pool until the download reports want
+func waitForStatus(t *testing.T, pool *download.WorkerPool, id, want string) {
+	t.Helper()
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		st := pool.GetStatus(id)
+		if st != nil && st.Status == want {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("download status = %+v, want %s", st, want)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestScheduler_ResumedInsideWindowRunsAfter(t *testing.T) {
+	dir := t.TempDir()
+	state.CloseDB()
+	state.Configure(filepath.Join(dir, "surge.db"))
+	t.Cleanup(state.CloseDB)
+
+	server := testutil.NewStreamingMockServerT(t, 256*types.MB,
+		testutil.WithRangeSupport(true),
+		testutil.WithLatency(5*time.Millisecond),
+	)
+	pool := download.NewWorkerPool(nil, 1)
+	defer pool.GracefulShutdown()
+
+	progress := types.NewProgressState("dl", 256*types.MB)
+	pool.Add(types.DownloadConfig{
+		ID:         "dl",
+		URL:        server.URL(),
+		OutputPath: dir,
+		Filename:   "file.bin",
+		State:      progress,
+		Runtime:    &types.RuntimeConfig{},
+	})
+	waitForStatus(t, pool, "dl", "downloading")
+
+	s, _, now := newTestScheduler(pool, "09:00-18:00 pause", 0)
+	*now = at(time.Monday, 10, 0)
+	s.Check()
+	waitForStatus(t, pool, "dl", "paused")
+
+	// Resumed by the user inside the window, it waits in the held queue
+	if !pool.Resume("dl") {
+		t.Fatal("Resume failed")
+	}
+	s.Check()
+	waitForStatus(t, pool, "dl", "queued")
+
+	*now = at(time.Monday, 19, 0)
+	s.Check()
+	waitForStatus(t, pool, "dl", "downloading")
+	before := progress.Downloaded.Load()
+	deadline := time.Now().Add(10 * time.Second)
+	for progress.Downloaded.Load() <= before {
+		if time.Now().After(deadline) {
+			t.Fatal("download did not make progress after the window")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestScheduler_RateProfiles(t *testing.T) {
+	pool := newFakePool()
+	s, limiter, now := newTestScheduler(pool, "01:00-07:00 unlimited; 2M", 512*1024)
+
+	*now = at(time.Monday, 3, 0)
+	s.Check()
+	if got := limiter.Rate(); got != 0 {
+		t.Errorf("rate at 03:00 = %d, want unlimited", got)
+	}
+
+	*now = at(time.Monday, 12, 0)
+	s.Check()
+	if got := limiter.Rate(); got != 2*1024*1024 {
+		t.Errorf("rate at 12:00 = %d, want 2M", got)
+	}
+
+	// A live change inside a window is undone on the next check
+	limiter.SetRate(100 * 1024)
+	s.Check()
+	if got := limiter.Rate(); got != 2*1024*1024 {
+		t.Errorf("rate after a live change = %d, want the window's 2M", got)
+	}
+
+	*now = at(time.Tuesday, 2, 0)
+	s.Check()
+	if got := limiter.Rate(); got != 0 {
+		t.Errorf("rate at next boundary = %d, want unlimited", got)
+	}
+}
+
+func TestScheduler_LiveRateOutsideWindows(t *testing.T) {
+	s, limiter, now := newTestScheduler(newFakePool(), "01:00-07:00 unlimited", 512*1024)
+	*now = at(time.Monday, 12, 0)
+	s.Check()
+
+	// With no window in effect, a live change lasts until the next boundary
+	limiter.SetRate(100 * 1024)
+	s.Check()
+	if got := limiter.Rate(); got != 100*1024 {
+		t.Errorf("live rate outside any window overridden: %d", got)
+	}
+
+	*now = at(time.Tuesday, 2, 0)
+	s.Check()
+	if got := limiter.Rate(); got != 0 {
+		t.Errorf("rate inside the window = %d, want unlimited", got)
+	}
+}
+
+func TestScheduler_FallsBackToGlobalRate(t *testing.T) {
+	s, limiter, _ := newTestScheduler(newFakePool(), "sat pause", 512*1024)
+	s.Check()
+	if got := limiter.Rate(); got != 512*1024 {
+		t.Errorf("rate = %d, want global_rate_limit", got)
+	}
+
+	bad, limiter, _ := newTestScheduler(newFakePool(), "nonsense", 256*1024)
+	bad.Check()
+	if got := limiter.Rate(); got != 256*1024 {
+		t.Errorf("rate with invalid schedule = %d, want global_rate_limit", got)
+	}
+}
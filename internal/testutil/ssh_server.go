@@ -0,0 +1,209 @@
+package testutil
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/pem"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/pkg/sftp"
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+// SSHServer is an in-process SSH server offering the SFTP subsystem over the
+// local filesystem. Clients log in with ClientKey or Password as any user.
+type SSHServer struct {
+	Addr       string // host:port to connect to
+	HostKey    ssh.PublicKey
+	ClientKey  ssh.Signer // Key accepted for public key auth
+	KeyFile    string     // ClientKey as an OpenSSH private key file
+	KnownHosts string     // known_hosts file listing HostKey for Addr
+	Password   string     // Password accepted for password auth
+
+	// Tracking
+	Logins       atomic.Int64 // Authenticated connections
+	Channels     atomic.Int64 // SFTP sessions opened
+	OpenChannels atomic.Int64 // SFTP sessions currently open
+	PeakChannels atomic.Int64 // Most SFTP sessions open at once
+
+	writeDelay time.Duration
+	listener   net.Listener
+}
+
+// SSHServerOption is a function that configures an SSHServer.
+type SSHServerOption func(*SSHServer)
+
+// WithSSHWriteDelay slows each write of SFTP replies, so transfers take long enough to interrupt.
+func WithSSHWriteDelay(d time.Duration) SSHServerOption {
+	return func(s *SSHServer) {
+		s.writeDelay = d
+	}
+}
+
+// NewSSHServerT starts an SSH server on 127.0.0.1 and writes its client key and
+// known_hosts file into a temp dir. It is stopped when the test ends.
+func NewSSHServerT(t *testing.T, opts ...SSHServerOption) *SSHServer {
+	t.Helper()
+
+	hostSigner := newTestSigner(t)
+	_, clientPriv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate client key: %v", err)
+	}
+	clientSigner, err := ssh.NewSignerFromKey(clientPriv)
+	if err != nil {
+		t.Fatalf("failed to create client signer: %v", err)
+	}
+
+	ln, err := net.Listen("tcp4", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("tcp4 listener unavailable: %v", err)
+		return nil
+	}
+
+	s := &SSHServer{
+		Addr:      ln.Addr().String(),
+		HostKey:   hostSigner.PublicKey(),
+		ClientKey: clientSigner,
+		Password:  "secret",
+		listener:  ln,
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	dir := t.TempDir()
+	block, err := ssh.MarshalPrivateKey(clientPriv, "")
+	if err != nil {
+		t.Fatalf("failed to marshal client key: %v", err)
+	}
+	s.KeyFile = filepath.Join(dir, "id_ed25519")
+	if err := os.WriteFile(s.KeyFile, pem.EncodeToMemory(block), 0o600); err != nil {
+		t.Fatalf("failed to write client key: %v", err)
+	}
+	s.KnownHosts = filepath.Join(dir, "known_hosts")
+	line := knownhosts.Line([]string{knownhosts.Normalize(s.Addr)}, s.HostKey) + "\n"
+	if err := os.WriteFile(s.KnownHosts, []byte(line), 0o600); err != nil {
+		t.Fatalf("failed to write known_hosts: %v", err)
+	}
+
+	config := &ssh.ServerConfig{
+		PublicKeyCallback: func(_ ssh.ConnMetadata, key ssh.PublicKey) (*ssh.Permissions, error) {
+			if string(key.Marshal()) == string(s.ClientKey.PublicKey().Marshal()) {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+		PasswordCallback: func(_ ssh.ConnMetadata, password []byte) (*ssh.Permissions, error) {
+			if string(password) == s.Password {
+				return nil, nil
+			}
+			return nil, ssh.ErrNoAuth
+		},
+	}
+	config.AddHostKey(hostSigner)
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serveConn(conn, config)
+		}
+	}()
+	t.Cleanup(func() { _ = ln.Close() })
+	return s
+}
+
+// newTestSigner generates an ed25519 key pair for tests
+func newTestSigner(t *testing.T) ssh.Signer {
+	t.Helper()
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate key: %v", err)
+	}
+	signer, err := ssh.NewSignerFromKey(priv)
+	if err != nil {
+		t.Fatalf("failed to create signer: %v", err)
+	}
+	return signer
+}
+
+func (s *SSHServer) serveConn(conn net.Conn, config *ssh.ServerConfig) {
+	sconn, chans, reqs, err := ssh.NewServerConn(conn, config)
+	if err != nil {
+		_ = conn.Close()
+		return
+	}
+	defer func() { _ = sconn.Close() }()
+	s.Logins.Add(1)
+	go ssh.DiscardRequests(reqs)
+
+	for newChannel := range chans {
+		if newChannel.ChannelType() != "session" {
+			_ = newChannel.Reject(ssh.UnknownChannelType, "only session channels are supported")
+			continue
+		}
+		channel, requests, err := newChannel.Accept()
+		if err != nil {
+			continue
+		}
+		go s.serveSession(channel, requests)
+	}
+}
+
+// serveSession runs the SFTP subsystem when the client asks for it
+func (s *SSHServer) serveSession(channel ssh.Channel, requests <-chan *ssh.Request) {
+	defer func() { _ = channel.Close() }()
+
+	for req := range requests {
+		// Payload is a length-prefixed subsystem name
+		if req.Type != "subsystem" || len(req.Payload) < 4 || string(req.Payload[4:]) != "sftp" {
+			_ = req.Reply(false, nil)
+			continue
+		}
+		_ = req.Reply(true, nil)
+		go ssh.DiscardRequests(requests)
+
+		s.Channels.Add(1)
+		open := s.OpenChannels.Add(1)
+		for {
+			peak := s.PeakChannels.Load()
+			if open <= peak || s.PeakChannels.CompareAndSwap(peak, open) {
+				break
+			}
+		}
+		defer s.OpenChannels.Add(-1)
+
+		var rw io.ReadWriteCloser = channel
+		if s.writeDelay > 0 {
+			rw = slowWriter{ReadWriteCloser: channel, delay: s.writeDelay}
+		}
+		server, err := sftp.NewServer(rw)
+		if err != nil {
+			return
+		}
+		_ = server.Serve()
+		_ = server.Close()
+		return
+	}
+}
+
+// slowWriter delays every write to simulate a slow link
+type slowWriter struct {
+	io.ReadWriteCloser
+	delay time.Duration
+}
+
+func (w slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(w.delay)
+	return w.ReadWriteCloser.Write(p)
+}
@@ -0,0 +1,129 @@
+package tlscert
+
+import (
+	"bufio"
+	"crypto/tls"
+	"errors"
+	"net"
+	"sync"
+	"time"
+)
+
+// handshakeTimeout bounds how long a new connection may take to send its
+// first byte, so a silent client cannot hold a goroutine forever
+const handshakeTimeout = 10 * time.Second
+
+// recordTypeHandshake is the first byte of every TLS connection
+const recordTypeHandshake = 0x16
+
+// plainRejection is sent to a remote client speaking plain HTTP, as
+// net/http does for a TLS-only server
+const plainRejection = "HTTP/1.0 400 Bad Request\r\n\r\nClient sent an HTTP request to an HTTPS server.\n"
+
+// Listener serves TLS and plain HTTP on the same port. Plain connections are
+// accepted from loopback only, so local tools and the browser extension keep
+// using http://127.0.0.1 while remote clients must use https.
+type Listener struct {
+	net.Listener
+	config *tls.Config
+
+	conns     chan net.Conn
+	errs      chan error
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewListener wraps inner, serving TLS with config
+func NewListener(inner net.Listener, config *tls.Config) *Listener {
+	l := &Listener{
+		Listener: inner,
+		config:   config,
+		conns:    make(chan net.Conn),
+		errs:     make(chan error),
+		done:     make(chan struct{}),
+	}
+	go l.acceptLoop()
+	return l
+}
+
+func (l *Listener) acceptLoop() {
+	for {
+		c, err := l.Listener.Accept()
+		if err != nil {
+			select {
+			case l.errs <- err:
+			case <-l.done:
+				return
+			}
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			continue
+		}
+		go l.sniff(c)
+	}
+}
+
+// sniff reads the first byte of c to tell TLS from plain HTTP
+func (l *Listener) sniff(c net.Conn) {
+	_ = c.SetReadDeadline(time.Now().Add(handshakeTimeout))
+	pc := &peekedConn{Conn: c, r: bufio.NewReader(c)}
+	first, err := pc.r.Peek(1)
+	if err != nil {
+		_ = c.Close()
+		return
+	}
+	_ = c.SetReadDeadline(time.Time{})
+
+	var conn net.Conn
+	switch {
+	case first[0] == recordTypeHandshake:
+		conn = tls.Server(pc, l.config)
+	case isLoopback(c.RemoteAddr()):
+		conn = pc
+	default:
+		_ = c.SetWriteDeadline(time.Now().Add(handshakeTimeout))
+		_, _ = c.Write([]byte(plainRejection))
+		_ = c.Close()
+		return
+	}
+
+	select {
+	case l.conns <- conn:
+	case <-l.done:
+		_ = c.Close()
+	}
+}
+
+// Accept returns the next connection, already identified as TLS or plain
+func (l *Listener) Accept() (net.Conn, error) {
+	select {
+	case c := <-l.conns:
+		return c, nil
+	case err := <-l.errs:
+		return nil, err
+	case <-l.done:
+		return nil, net.ErrClosed
+	}
+}
+
+// Close stops the listener
+func (l *Listener) Close() error {
+	l.closeOnce.Do(func() { close(l.done) })
+	return l.Listener.Close()
+}
+
+// peekedConn is a connection whose first bytes were read into r
+type peekedConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+func (c *peekedConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func isLoopback(addr net.Addr) bool {
+	tcp, ok := addr.(*net.TCPAddr)
+	return ok && tcp.IP.IsLoopback()
+}
@@ -0,0 +1,173 @@
+// Package tlscert provides TLS for the daemon API: a self-signed certificate
+// kept in the state directory, SHA-256 fingerprints for pinning it on the
+// client side, and a listener serving TLS and loopback plain HTTP on one port.
+package tlscert
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// File names of the self-signed certificate in the state directory
+const (
+	CertFile = "tls-cert.pem"
+	KeyFile  = "tls-key.pem"
+)
+
+// validity is how long a generated certificate lasts. Clients pin its
+// fingerprint, so it should rarely change.
+const validity = 10 * 365 * 24 * time.Hour
+
+// LoadOrCreate returns the self-signed certificate in dir, generating it on
+// first use or when the saved one has expired
+func LoadOrCreate(dir string) (tls.Certificate, error) {
+	certPath := filepath.Join(dir, CertFile)
+	keyPath := filepath.Join(dir, KeyFile)
+
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err == nil && cert.Leaf != nil && time.Now().Before(cert.Leaf.NotAfter) {
+		return cert, nil
+	}
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return tls.Certificate{}, fmt.Errorf("failed to load %s: %w", certPath, err)
+	}
+
+	certPEM, keyPEM, err := generate()
+	if err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return tls.Certificate{}, fmt.Errorf("failed to create certificate directory: %w", err)
+	}
+	if err := os.WriteFile(keyPath, keyPEM, 0o600); err != nil {
+		return tls.Certificate{}, err
+	}
+	if err := os.WriteFile(certPath, certPEM, 0o644); err != nil {
+		return tls.Certificate{}, err
+	}
+	return tls.X509KeyPair(certPEM, keyPEM)
+}
+
+// generate creates a self-signed ECDSA certificate for this machine's names
+// and addresses, returned PEM encoded
+func generate() (certPEM, keyPEM []byte, err error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate key: %w", err)
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
+	now := time.Now()
+	tmpl := &x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: "Surge"},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		DNSNames:              []string{"localhost"},
+		IPAddresses:           []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
+	}
+	if host, err := os.Hostname(); err == nil && host != "" && host != "localhost" {
+		tmpl.DNSNames = append(tmpl.DNSNames, host)
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLoopback() && !ipNet.IP.IsLinkLocalUnicast() {
+				tmpl.IPAddresses = append(tmpl.IPAddresses, ipNet.IP)
+			}
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create certificate: %w", err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	certPEM = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM = pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	return certPEM, keyPEM, nil
+}
+
+// Fingerprint returns the SHA-256 fingerprint of a DER certificate as
+// colon-separated uppercase hex, the form printed by openssl
+func Fingerprint(der []byte) string {
+	sum := sha256.Sum256(der)
+	return formatSum(sum[:])
+}
+
+// CertificateFingerprint returns the fingerprint of the leaf of cert
+func CertificateFingerprint(cert tls.Certificate) string {
+	if len(cert.Certificate) == 0 {
+		return ""
+	}
+	return Fingerprint(cert.Certificate[0])
+}
+
+// ParseFingerprint normalizes a SHA-256 fingerprint given with or without
+// colons, in any case, optionally prefixed with "sha256:"
+func ParseFingerprint(s string) (string, error) {
+	raw := strings.TrimSpace(s)
+	if len(raw) >= 7 && strings.EqualFold(raw[:7], "sha256:") {
+		raw = raw[7:]
+	}
+	raw = strings.NewReplacer(":", "", " ", "").Replace(raw)
+	b, err := hex.DecodeString(raw)
+	if err != nil || len(b) != sha256.Size {
+		return "", fmt.Errorf("invalid SHA-256 fingerprint %q", s)
+	}
+	return formatSum(b), nil
+}
+
+func formatSum(sum []byte) string {
+	parts := make([]string, len(sum))
+	for i, b := range sum {
+		parts[i] = fmt.Sprintf("%02X", b)
+	}
+	return strings.Join(parts, ":")
+}
+
+// PinnedConfig returns a client TLS config that accepts only a server whose
+// certificate has the given fingerprint. The usual chain and name checks are
+// skipped, so a self-signed certificate works.
+func PinnedConfig(fingerprint string) (*tls.Config, error) {
+	want, err := ParseFingerprint(fingerprint)
+	if err != nil {
+		return nil, err
+	}
+	return &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: true, // Replaced by the fingerprint check below
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("server sent no certificate")
+			}
+			if got := Fingerprint(cs.PeerCertificates[0].Raw); got != want {
+				return fmt.Errorf("server certificate fingerprint %s does not match the pinned %s", got, want)
+			}
+			return nil
+		},
+	}, nil
+}
@@ -0,0 +1,154 @@
+package tlscert
+
+import (
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadOrCreate(t *testing.T) {
+	dir := t.TempDir()
+
+	cert, err := LoadOrCreate(dir)
+	if err != nil {
+		t.Fatalf("LoadOrCreate failed: %v", err)
+	}
+	if info, err := os.Stat(filepath.Join(dir, KeyFile)); err != nil || info.Mode().Perm() != 0o600 {
+		t.Errorf("key file: %v, %v", info, err)
+	}
+	if cert.Leaf == nil || cert.Leaf.VerifyHostname("127.0.0.1") != nil || cert.Leaf.VerifyHostname("localhost") != nil {
+		t.Errorf("certificate should cover loopback, got %v / %v", cert.Leaf.DNSNames, cert.Leaf.IPAddresses)
+	}
+
+	again, err := LoadOrCreate(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if CertificateFingerprint(again) != CertificateFingerprint(cert) {
+		t.Error("the saved certificate should be reused")
+	}
+}
+
+func TestParseFingerprint(t *testing.T) {
+	cert, err := LoadOrCreate(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp := CertificateFingerprint(cert)
+	if len(fp) != 95 || strings.ToUpper(fp) != fp {
+		t.Fatalf("fingerprint %q should be 32 uppercase hex pairs", fp)
+	}
+
+	bare := strings.ToLower(strings.ReplaceAll(fp, ":", ""))
+	for _, in := range []string{fp, bare, "SHA256:" + bare, " " + strings.ToLower(fp) + " "} {
+		if got, err := ParseFingerprint(in); err != nil || got != fp {
+			t.Errorf("ParseFingerprint(%q) = %q, %v", in, got, err)
+		}
+	}
+	for _, in := range []string{"", "abc", bare[:62], bare + "00", strings.Replace(bare, bare[:1], "z", 1)} {
+		if _, err := ParseFingerprint(in); err == nil {
+			t.Errorf("ParseFingerprint(%q) should fail", in)
+		}
+	}
+}
+
+// startServer serves a greeting through a Listener on loopback
+func startServer(t *testing.T, cert tls.Certificate) string {
+	t.Helper()
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln := NewListener(inner, &tls.Config{Certificates: []tls.Certificate{cert}})
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.TLS != nil {
+			_, _ = io.WriteString(w, "tls")
+		} else {
+			_, _ = io.WriteString(w, "plain")
+		}
+	})}
+	go func() { _ = srv.Serve(ln) }()
+	t.Cleanup(func() { _ = srv.Close() })
+	return inner.Addr().String()
+}
+
+func get(client *http.Client, url string) (string, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return "", err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(resp.Body)
+	return string(body), err
+}
+
+func TestListener_PinnedTLSAndLoopbackPlain(t *testing.T) {
+	cert, err := LoadOrCreate(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := startServer(t, cert)
+
+	pinned, err := PinnedConfig(CertificateFingerprint(cert))
+	if err != nil {
+		t.Fatal(err)
+	}
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: pinned}}
+	if body, err := get(client, "https://"+addr+"/"); err != nil || body != "tls" {
+		t.Errorf("pinned https = %q, %v", body, err)
+	}
+
+	// A plain request from loopback is still served
+	if body, err := get(http.DefaultClient, "http://"+addr+"/"); err != nil || body != "plain" {
+		t.Errorf("loopback http = %q, %v", body, err)
+	}
+
+	// The self-signed certificate is rejected without a pin
+	if _, err := get(&http.Client{Transport: &http.Transport{}}, "https://"+addr+"/"); err == nil {
+		t.Error("unpinned https to a self-signed certificate should fail")
+	}
+
+	// And with the wrong pin
+	other, err := LoadOrCreate(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	wrong, _ := PinnedConfig(CertificateFingerprint(other))
+	_, err = get(&http.Client{Transport: &http.Transport{TLSClientConfig: wrong}}, "https://"+addr+"/")
+	if err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("wrong pin error = %v", err)
+	}
+}
+
+func TestIsLoopback(t *testing.T) {
+	for addr, want := range map[string]bool{"127.0.0.1:1700": true, "[::1]:1700": true, "192.168.1.10:1700": false, "10.0.0.1:80": false} {
+		tcp, err := net.ResolveTCPAddr("tcp", addr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := isLoopback(tcp); got != want {
+			t.Errorf("isLoopback(%s) = %v, want %v", addr, got, want)
+		}
+	}
+}
+
+func TestListener_RejectsRemotePlain(t *testing.T) {
+	l := &Listener{done: make(chan struct{})}
+	client, server := net.Pipe() // Not a loopback TCP address, so treated as remote
+	defer func() { _ = client.Close() }()
+	go l.sniff(server)
+
+	go func() { _, _ = io.WriteString(client, "GET / HTTP/1.1\r\nHost: x\r\n\r\n") }()
+	resp, err := io.ReadAll(client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(string(resp), "HTTP/1.0 400") {
+		t.Errorf("response = %q, want a 400", resp)
+	}
+}
@@ -0,0 +1,46 @@
+package tui
+
+import "strings"
+
+// categoryNames lists the categories to filter by: the configured ones in
+// order, then any other category found on a download
+func (m RootModel) categoryNames() []string {
+	var names []string
+	seen := make(map[string]bool)
+	add := func(name string) {
+		if name != "" && !seen[strings.ToLower(name)] {
+			seen[strings.ToLower(name)] = true
+			names = append(names, name)
+		}
+	}
+	if m.Settings != nil {
+		for _, c := range m.Settings.Categories {
+			add(c.Name)
+		}
+	}
+	for _, d := range m.downloads {
+		add(d.category)
+	}
+	return names
+}
+
+// cycleCategoryFilter moves the list filter to the next category, wrapping
+// back to showing every download
+func (m *RootModel) cycleCategoryFilter() {
+	names := m.categoryNames()
+	next := ""
+	if m.categoryFilter == "" {
+		if len(names) > 0 {
+			next = names[0]
+		}
+	} else {
+		for i, name := range names {
+			if strings.EqualFold(name, m.categoryFilter) && i+1 < len(names) {
+				next = names[i+1]
+				break
+			}
+		}
+	}
+	m.categoryFilter = next
+	m.UpdateListItems()
+}
@@ -18,21 +18,30 @@ type KeyMap struct {
 
 // DashboardKeyMap defines keybindings for the main dashboard
 type DashboardKeyMap struct {
-	TabQueued   key.Binding
-	TabActive   key.Binding
-	TabDone     key.Binding
-	NextTab     key.Binding
-	Add         key.Binding
-	BatchImport key.Binding
-	Search      key.Binding
-	Pause       key.Binding
-	Delete      key.Binding
-	Settings    key.Binding
-	Log         key.Binding
-	History     key.Binding
-	OpenFile    key.Binding
-	Quit        key.Binding
-	ForceQuit   key.Binding
+	TabQueued     key.Binding
+	TabActive     key.Binding
+	TabDone       key.Binding
+	NextTab       key.Binding
+	Add           key.Binding
+	BatchImport   key.Binding
+	Search        key.Binding
+	Category      key.Binding
+	Pause         key.Binding
+	SpeedLimit    key.Binding
+	MoveUp        key.Binding
+	MoveDown      key.Binding
+	MoveTop       key.Binding
+	MoveBottom    key.Binding
+	RaisePriority key.Binding
+	LowerPriority key.Binding
+	Delete        key.Binding
+	Settings      key.Binding
+	Log           key.Binding
+	History       key.Binding
+	OpenFile      key.Binding
+	ExpandSet     key.Binding
+	Quit          key.Binding
+	ForceQuit     key.Binding
 	// Navigation
 	Up   key.Binding
 	Down key.Binding
@@ -152,10 +161,42 @@ var Keys = KeyMap{
 			key.WithKeys("f"),
 			key.WithHelp("f", "search"),
 		),
+		Category: key.NewBinding(
+			key.WithKeys("c"),
+			key.WithHelp("c", "category filter"),
+		),
 		Pause: key.NewBinding(
 			key.WithKeys("p"),
 			key.WithHelp("p", "pause/resume"),
 		),
+		SpeedLimit: key.NewBinding(
+			key.WithKeys("r"),
+			key.WithHelp("r", "speed limit"),
+		),
+		MoveUp: key.NewBinding(
+			key.WithKeys("["),
+			key.WithHelp("[", "move up"),
+		),
+		MoveDown: key.NewBinding(
+			key.WithKeys("]"),
+			key.WithHelp("]", "move down"),
+		),
+		MoveTop: key.NewBinding(
+			key.WithKeys("{"),
+			key.WithHelp("{", "move to top"),
+		),
+		MoveBottom: key.NewBinding(
+			key.WithKeys("}"),
+			key.WithHelp("}", "move to bottom"),
+		),
+		RaisePriority: key.NewBinding(
+			key.WithKeys("+", "="),
+			key.WithHelp("+", "raise priority"),
+		),
+		LowerPriority: key.NewBinding(
+			key.WithKeys("-"),
+			key.WithHelp("-", "lower priority"),
+		),
 		Delete: key.NewBinding(
 			key.WithKeys("x"),
 			key.WithHelp("x", "delete"),
@@ -176,6 +217,10 @@ var Keys = KeyMap{
 			key.WithKeys("o"),
 			key.WithHelp("o", "open file"),
 		),
+		ExpandSet: key.NewBinding(
+			key.WithKeys("enter"),
+			key.WithHelp("enter", "show/hide parts"),
+		),
 		Quit: key.NewBinding(
 			key.WithKeys("ctrl+c", "ctrl+q"),
 			key.WithHelp("ctrl+q", "quit"),
@@ -406,8 +451,9 @@ func (k DashboardKeyMap) ShortHelp() []key.Binding {
 func (k DashboardKeyMap) FullHelp() [][]key.Binding {
 	return [][]key.Binding{
 		{k.TabQueued, k.TabActive, k.TabDone, k.NextTab},
-		{k.Add, k.Search, k.Pause, k.Delete, k.Settings},
-		{k.Log, k.History, k.Quit},
+		{k.Add, k.Search, k.Category, k.Pause, k.SpeedLimit, k.Delete, k.Settings},
+		{k.MoveUp, k.MoveDown, k.MoveTop, k.MoveBottom, k.RaisePriority, k.LowerPriority},
+		{k.ExpandSet, k.Log, k.History, k.Quit},
 	}
 }
 
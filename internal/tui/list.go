@@ -17,15 +17,42 @@ import (
 // DownloadItem implements list.Item interface for downloads
 type DownloadItem struct {
 	download *DownloadModel
+	set      *partSet // Set when the row is a whole multi-part archive
+	volume   bool     // A volume listed under its expanded set
+}
+
+// itemID identifies the row across list updates
+func (i DownloadItem) itemID() string {
+	if i.set != nil {
+		return "set:" + i.set.key
+	}
+	return i.download.ID
 }
 
 func (i DownloadItem) Title() string {
+	if i.set != nil {
+		return fmt.Sprintf("%s (%d parts)", i.set.name, len(i.set.members))
+	}
+	if i.volume {
+		return "  └ " + i.download.Filename
+	}
 	return i.download.Filename
 }
 
 func (i DownloadItem) Description() string {
+	if i.set != nil {
+		return i.setDescription()
+	}
 	d := i.download
 
+	if d.extracting {
+		pct := 0.0
+		if d.extractTotal > 0 {
+			pct = float64(d.extracted) / float64(d.extractTotal) * 100
+		}
+		return fmt.Sprintf("%s • %.0f%% • %s", components.StatusExtracting.Render(), pct, utils.ConvertBytesToHumanReadable(d.Total))
+	}
+
 	// Get styled status using the shared component
 	var styledStatus string
 	if d.pausing {
@@ -54,7 +81,32 @@ func (i DownloadItem) Description() string {
 	return fmt.Sprintf("%s • %.0f%%%s • %s", styledStatus, pct, speedInfo, sizeInfo)
 }
 
+// setDescription shows the progress of a whole multi-part archive, e.g.
+// "⬇ Downloading • 40% • 2.5 MB/s • 2/5 parts • 400 MB / 1 GB"
+func (i DownloadItem) setDescription() string {
+	s := i.set
+	_, downloaded, total := s.progress()
+	done, paused, failed := s.status()
+	_, speed, _ := s.activity()
+
+	styledStatus := components.DetermineStatus(done, paused, failed, speed, downloaded).Render()
+	pct := 0.0
+	if total > 0 {
+		pct = float64(downloaded) / float64(total) * 100
+	}
+	speedInfo := ""
+	if speed > 0 {
+		speedInfo = fmt.Sprintf(" • %.2f MB/s", speed/Megabyte)
+	}
+	return fmt.Sprintf("%s • %.0f%%%s • %s • %s / %s", styledStatus, pct, speedInfo, s.summary(),
+		utils.ConvertBytesToHumanReadable(downloaded),
+		utils.ConvertBytesToHumanReadable(total))
+}
+
 func (i DownloadItem) FilterValue() string {
+	if i.set != nil {
+		return i.set.name
+	}
 	return i.download.Filename
 }
 
@@ -192,15 +244,12 @@ func NewDownloadList(width, height int) list.Model {
 
 // UpdateListItems updates the list with filtered downloads based on active tab
 func (m *RootModel) UpdateListItems() {
+	m.groupPartSets()
+
 	// If the user manually switched tabs, don't try to preserve/follow selection
 	if m.ManualTabSwitch {
 		m.ManualTabSwitch = false
-		filtered := m.getFilteredDownloads()
-		items := make([]list.Item, len(filtered))
-		for i, d := range filtered {
-			items[i] = DownloadItem{download: d}
-		}
-		m.list.SetItems(items)
+		m.list.SetItems(m.listItems())
 		// Reset cursor to top when manually switching tabs (standard behavior)
 		m.list.Select(0)
 		return
@@ -209,29 +258,35 @@ func (m *RootModel) UpdateListItems() {
 	// Capture currently selected ID if we don't have a forced one
 	targetID := m.SelectedDownloadID
 	if targetID == "" {
-		if d := m.GetSelectedDownload(); d != nil {
-			targetID = d.ID
+		if item, ok := m.list.SelectedItem().(DownloadItem); ok {
+			targetID = item.itemID()
 		}
 	}
 
-	filtered := m.getFilteredDownloads()
-	items := make([]list.Item, len(filtered))
-	for i, d := range filtered {
-		items[i] = DownloadItem{download: d}
-	}
+	items := m.listItems()
 	m.list.SetItems(items)
 
-	// Restore selection
+	// Restore selection, falling back to the set row of a collapsed volume
 	found := false
 	if targetID != "" {
+		setRow := -1
 		for i, item := range items {
-			if di, ok := item.(DownloadItem); ok {
-				if di.download.ID == targetID {
-					m.list.Select(i)
-					found = true
-					break
-				}
+			di, ok := item.(DownloadItem)
+			if !ok {
+				continue
+			}
+			if di.itemID() == targetID {
+				m.list.Select(i)
+				found = true
+				break
 			}
+			if setRow < 0 && di.set != nil && di.set.contains(targetID) {
+				setRow = i
+			}
+		}
+		if !found && setRow >= 0 {
+			m.list.Select(setRow)
+			found = true
 		}
 
 		// If we wanted to select something but it's not here, it might be in another tab
@@ -239,10 +294,14 @@ func (m *RootModel) UpdateListItems() {
 			// Find the download globally
 			for _, d := range m.downloads {
 				if d.ID == targetID {
+					done, speed := d.done, d.Speed
+					if d.set != nil {
+						done, speed, _ = d.set.activity()
+					}
 					var newTab int
-					if d.done {
+					if done {
 						newTab = TabDone
-					} else if d.Speed > 0 {
+					} else if speed > 0 {
 						newTab = TabActive
 					} else {
 						newTab = TabQueued
@@ -270,7 +329,32 @@ func (m *RootModel) UpdateListItems() {
 	m.SelectedDownloadID = ""
 }
 
-// GetSelectedDownload returns the currently selected download from the list
+// listItems returns the rows of the active tab. The volumes of a multi-part
+// archive share one row, followed by a row per volume when it is expanded.
+func (m *RootModel) listItems() []list.Item {
+	var items []list.Item
+	listed := make(map[*partSet]bool)
+	for _, d := range m.getFilteredDownloads() {
+		if d.set == nil {
+			items = append(items, DownloadItem{download: d})
+			continue
+		}
+		if listed[d.set] {
+			continue
+		}
+		listed[d.set] = true
+		items = append(items, DownloadItem{download: d.set.lead(), set: d.set})
+		if m.expandedSets[d.set.key] {
+			for _, v := range d.set.members {
+				items = append(items, DownloadItem{download: v, volume: true})
+			}
+		}
+	}
+	return items
+}
+
+// GetSelectedDownload returns the currently selected download from the list.
+// For a multi-part archive it is the volume being worked on.
 func (m *RootModel) GetSelectedDownload() *DownloadModel {
 	if item := m.list.SelectedItem(); item != nil {
 		if di, ok := item.(DownloadItem); ok {
@@ -3,6 +3,7 @@ package tui
 import (
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 	"time"
 
@@ -70,6 +71,15 @@ type DownloadModel struct {
 	paused        bool
 	pausing       bool // UI state: transitioning to pause
 	pendingResume bool // UI state: waiting for async resume
+	queuePos      int  // 1-based place in the start queue, 0 if not queued
+	priority      int
+	category      string
+
+	extracting   bool // Archive extraction after the download is running
+	extracted    int64
+	extractTotal int64
+
+	set *partSet // Multi-part archive this download is a volume of, if any
 }
 
 type RootModel struct {
@@ -104,7 +114,8 @@ type RootModel struct {
 	pendingFilename string   // Filename pending confirmation
 	pendingMirrors  []string // Mirrors pending confirmation
 	pendingHeaders  map[string]string
-	duplicateInfo   string // Info about the duplicate
+	pendingOptions  types.DownloadOptions // Per-download options pending confirmation
+	duplicateInfo   string                // Info about the duplicate
 
 	// Graph Data
 	SpeedHistory           []float64 // Stores the last ~60 ticks of speed data
@@ -132,6 +143,15 @@ type RootModel struct {
 	searchActive bool            // Whether search mode is active
 	searchQuery  string          // Current search query
 
+	categoryFilter string // Only downloads in this category are listed, empty for all
+
+	expandedSets map[string]bool // Multi-part archives listing their volumes, by set key
+
+	// Per-download speed limit prompt
+	limitInput     textinput.Model // Text input for the limit (e.g. "512K", "0" for none)
+	limitActive    bool            // Whether the limit prompt is open
+	limitTargetIDs []string        // Downloads the limit applies to
+
 	// Batch import
 	pendingBatchURLs []string // URLs pending batch import
 	batchFilePath    string   // Path to the batch file
@@ -232,6 +252,9 @@ func InitialRootModel(serverPort int, currentVersion string, service core.Downlo
 			for _, s := range statuses {
 				dm := NewDownloadModel(s.ID, s.URL, s.Filename, s.TotalSize)
 				dm.Downloaded = s.Downloaded
+				dm.queuePos = s.QueuePos
+				dm.priority = s.Priority
+				dm.category = s.Category
 				if s.DestPath != "" {
 					dm.Destination = s.DestPath
 				} else {
@@ -293,6 +316,12 @@ func InitialRootModel(serverPort int, currentVersion string, service core.Downlo
 	searchInput.Width = 30
 	searchInput.Prompt = ""
 
+	// Initialize speed limit input
+	limitInput := textinput.New()
+	limitInput.Placeholder = "e.g. 512K, 2M, 0 = unlimited"
+	limitInput.Width = 30
+	limitInput.Prompt = ""
+
 	m := RootModel{
 		downloads:             downloads,
 		inputs:                []textinput.Model{urlInput, mirrorsInput, pathInput, filenameInput},
@@ -308,6 +337,7 @@ func InitialRootModel(serverPort int, currentVersion string, service core.Downlo
 		Settings:              settings,
 		SettingsInput:         settingsInput,
 		searchInput:           searchInput,
+		limitInput:            limitInput,
 		keys:                  Keys,
 		ServerPort:            serverPort,
 		CurrentVersion:        currentVersion,
@@ -383,22 +413,30 @@ func (m RootModel) getFilteredDownloads() []*DownloadModel {
 	searchLower := strings.ToLower(m.searchQuery)
 
 	for _, d := range m.downloads {
-		// Apply tab filter first
+		// Apply tab filter first; a multi-part archive is placed as a whole
+		done, speed, connections := d.done, d.Speed, d.Connections
+		if d.set != nil {
+			done, speed, connections = d.set.activity()
+		}
 		switch m.activeTab {
 		case TabQueued:
-			if d.done || d.Speed > 0 {
+			if done || speed > 0 {
 				continue
 			}
 		case TabActive:
-			if d.done || (d.Speed == 0 && d.Connections == 0) {
+			if done || (speed == 0 && connections == 0) {
 				continue
 			}
 		case TabDone:
-			if !d.done {
+			if !done {
 				continue
 			}
 		}
 
+		if m.categoryFilter != "" && !strings.EqualFold(d.category, m.categoryFilter) {
+			continue
+		}
+
 		// Apply search filter if query is set
 		if m.searchQuery != "" {
 			if !strings.Contains(strings.ToLower(d.FilenameLower), searchLower) {
@@ -408,6 +446,13 @@ func (m RootModel) getFilteredDownloads() []*DownloadModel {
 
 		filtered = append(filtered, d)
 	}
+
+	// Queued downloads are shown in the order they will start
+	if m.activeTab == TabQueued {
+		sort.SliceStable(filtered, func(i, j int) bool {
+			return queueLess(filtered[i], filtered[j])
+		})
+	}
 	return filtered
 }
 
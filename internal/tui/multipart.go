@@ -0,0 +1,178 @@
+package tui
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/surge-downloader/surge/internal/multipart"
+)
+
+// maxBatchSets is how many multi-part archives the batch confirmation names
+const maxBatchSets = 3
+
+// partSet is a multi-part archive. Its volumes are separate downloads, listed
+// as one row that expands into a row per volume.
+type partSet struct {
+	key     string // multipart.Key of the set, stable across regrouping
+	name    string
+	members []*DownloadModel // In volume order
+}
+
+// progress returns the finished volumes and the bytes done across the set
+func (s *partSet) progress() (done int, downloaded, total int64) {
+	for _, d := range s.members {
+		if d.done && d.err == nil {
+			done++
+		}
+		downloaded += d.Downloaded
+		total += d.Total
+	}
+	return done, downloaded, total
+}
+
+// summary describes the set, e.g. "2/5 parts"
+func (s *partSet) summary() string {
+	done, _, _ := s.progress()
+	return fmt.Sprintf("%d/%d parts", done, len(s.members))
+}
+
+// activity returns what places the set in a tab: whether every volume is
+// done, and the speed and connections of the volumes still running
+func (s *partSet) activity() (done bool, speed float64, connections int) {
+	done = true
+	for _, d := range s.members {
+		if d.done {
+			continue
+		}
+		done = false
+		speed += d.Speed
+		connections += d.Connections
+	}
+	return done, speed, connections
+}
+
+// status returns the state the set's row shows: done once every volume is,
+// failed if one failed, and paused only when every unfinished volume is
+func (s *partSet) status() (done, paused, failed bool) {
+	done, paused = true, true
+	for _, d := range s.members {
+		if d.err != nil {
+			failed = true
+		}
+		if d.done {
+			continue
+		}
+		done = false
+		if !d.paused {
+			paused = false
+		}
+	}
+	return done, paused && !done, failed
+}
+
+// contains reports whether the download with id is a volume of the set
+func (s *partSet) contains(id string) bool {
+	for _, d := range s.members {
+		if d.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+// lead is the volume the set's row stands for in the details pane: the
+// first one not finished yet, or the first volume once all are
+func (s *partSet) lead() *DownloadModel {
+	for _, d := range s.members {
+		if !d.done {
+			return d
+		}
+	}
+	return s.members[0]
+}
+
+// groupPartSets links the volumes of each multi-part archive in the same
+// directory, so they are listed as one row
+func (m *RootModel) groupPartSets() {
+	byDir := make(map[string][]*DownloadModel)
+	for _, d := range m.downloads {
+		d.set = nil
+		dir := ""
+		if d.Destination != "" {
+			dir = filepath.Dir(d.Destination)
+		}
+		byDir[dir] = append(byDir[dir], d)
+	}
+
+	for dir, downloads := range byDir {
+		names := make([]string, len(downloads))
+		for i, d := range downloads {
+			names[i] = d.Filename
+			if names[i] == "" {
+				names[i] = multipart.URLFilename(d.URL)
+			}
+		}
+		for _, group := range multipart.Group(names) {
+			set := &partSet{key: multipart.Key(dir, group.Name), name: group.Name}
+			for _, i := range group.Parts {
+				set.members = append(set.members, downloads[i])
+				downloads[i].set = set
+			}
+		}
+	}
+}
+
+// toggleSet expands or collapses the volumes of the selected set
+func (m *RootModel) toggleSet() {
+	item, ok := m.list.SelectedItem().(DownloadItem)
+	if !ok || item.set == nil {
+		return
+	}
+	if m.expandedSets == nil {
+		m.expandedSets = make(map[string]bool)
+	}
+	if m.expandedSets[item.set.key] {
+		delete(m.expandedSets, item.set.key)
+	} else {
+		m.expandedSets[item.set.key] = true
+	}
+	m.SelectedDownloadID = item.itemID()
+	m.UpdateListItems()
+}
+
+// selectedVolumes returns the downloads the selected row stands for: every
+// volume of a set, or the one download
+func (m *RootModel) selectedVolumes() []*DownloadModel {
+	item, ok := m.list.SelectedItem().(DownloadItem)
+	if !ok {
+		return nil
+	}
+	if item.set != nil {
+		return item.set.members
+	}
+	return []*DownloadModel{item.download}
+}
+
+// batchMessage is the batch confirmation question, naming the multi-part
+// archives that will be listed as one entry each
+func batchMessage(urls []string) (string, int) {
+	sets := multipart.GroupURLs(urls)
+	if len(sets) == 0 {
+		return fmt.Sprintf("Add %d downloads?", len(urls)), 1
+	}
+
+	volumes := 0
+	for _, set := range sets {
+		volumes += len(set.Parts)
+	}
+	lines := []string{fmt.Sprintf("Add %d downloads as %d entries?", len(urls), len(urls)-volumes+len(sets))}
+	for i, set := range sets {
+		if i == maxBatchSets {
+			lines = append(lines, fmt.Sprintf("and %d more multi-part archives", len(sets)-i))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("%s: %d parts", truncateString(set.Name, 40), len(set.Parts)))
+	}
+	return strings.Join(lines, "\n"), len(lines)
+}
@@ -0,0 +1,119 @@
+package tui
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+)
+
+func newVolume(id, filename string) *DownloadModel {
+	d := NewDownloadModel(id, "http://example.com/"+filename, filename, 100)
+	d.Destination = filepath.Join("/downloads", filename)
+	return d
+}
+
+func listedTitles(m *RootModel) []string {
+	var titles []string
+	for _, item := range m.list.Items() {
+		titles = append(titles, item.(DownloadItem).Title())
+	}
+	return titles
+}
+
+func TestPartSetListedAsOneRow(t *testing.T) {
+	part1 := newVolume("p1", "movie.part1.rar")
+	part1.done = true
+	part1.Downloaded = 100
+	part2 := newVolume("p2", "movie.part2.rar")
+	part2.Speed = 1024
+	part2.Downloaded = 50
+	part3 := newVolume("p3", "movie.part3.rar")
+	other := newVolume("o", "other.bin")
+
+	m := &RootModel{
+		downloads: []*DownloadModel{part1, other, part2, part3},
+		list:      NewDownloadList(80, 20),
+		activeTab: TabActive,
+	}
+	m.UpdateListItems()
+
+	// The running volume puts the whole set in the active tab, as one row
+	titles := listedTitles(m)
+	if len(titles) != 1 || titles[0] != "movie.rar (3 parts)" {
+		t.Fatalf("active tab rows = %q, want the set only", titles)
+	}
+	item := m.list.SelectedItem().(DownloadItem)
+	if got := m.GetSelectedDownload(); got != part2 {
+		t.Errorf("selected download = %v, want the running volume", got.Filename)
+	}
+	if vols := m.selectedVolumes(); len(vols) != 3 || vols[0] != part1 || vols[2] != part3 {
+		t.Errorf("selectedVolumes = %d downloads, want the set in volume order", len(vols))
+	}
+	if _, downloaded, total := item.set.progress(); downloaded != 150 || total != 300 {
+		t.Errorf("set progress = %d / %d, want 150 / 300", downloaded, total)
+	}
+	if item.set.summary() != "1/3 parts" {
+		t.Errorf("summary = %q", item.set.summary())
+	}
+
+	// Expanding lists the volumes under the set and keeps the set selected
+	m.toggleSet()
+	titles = listedTitles(m)
+	want := []string{"movie.rar (3 parts)", "  └ movie.part1.rar", "  └ movie.part2.rar", "  └ movie.part3.rar"}
+	if len(titles) != len(want) {
+		t.Fatalf("expanded rows = %q, want %q", titles, want)
+	}
+	for i := range want {
+		if titles[i] != want[i] {
+			t.Errorf("row %d = %q, want %q", i, titles[i], want[i])
+		}
+	}
+	if m.list.Index() != 0 {
+		t.Errorf("selection moved to row %d after expanding", m.list.Index())
+	}
+
+	// A volume row stays selected across updates
+	m.list.Select(3)
+	m.UpdateListItems()
+	if item := m.list.SelectedItem().(DownloadItem); !item.volume || item.download != part3 {
+		t.Errorf("selected row = %q, want the third volume", item.Title())
+	}
+
+	// The set row stands for the next volume once one finishes
+	m.list.Select(0)
+	part2.done, part3.Speed = true, 1024
+	m.UpdateListItems()
+	if got := m.GetSelectedDownload(); m.list.Index() != 0 || got != part3 {
+		t.Errorf("selected download = %v at row %d, want the third volume on the set row", got.Filename, m.list.Index())
+	}
+
+	m.toggleSet()
+	if titles := listedTitles(m); len(titles) != 1 {
+		t.Errorf("collapsed rows = %q, want the set only", titles)
+	}
+
+	// The other download is alone in the queued tab
+	m.activeTab = TabQueued
+	m.ManualTabSwitch = true
+	m.UpdateListItems()
+	if titles := listedTitles(m); len(titles) != 1 || titles[0] != "other.bin" {
+		t.Errorf("queued tab rows = %q, want other.bin", titles)
+	}
+}
+
+func TestBatchMessage(t *testing.T) {
+	msg, lines := batchMessage([]string{"http://a/one.bin", "http://a/two.bin"})
+	if msg != "Add 2 downloads?" || lines != 1 {
+		t.Errorf("batchMessage without sets = %q, %d", msg, lines)
+	}
+
+	urls := []string{"http://a/movie.7z.001", "http://a/movie.7z.002", "http://a/movie.7z.003", "http://a/notes.txt"}
+	for i := 1; i <= 4; i++ {
+		urls = append(urls, fmt.Sprintf("http://a/set%d.z01", i), fmt.Sprintf("http://a/set%d.zip", i))
+	}
+	msg, lines = batchMessage(urls)
+	want := "Add 12 downloads as 6 entries?\nmovie.7z: 3 parts\nset1.zip: 2 parts\nset2.zip: 2 parts\nand 2 more multi-part archives"
+	if msg != want || lines != 5 {
+		t.Errorf("batchMessage = %q, %d\nwant %q, 5", msg, lines, want)
+	}
+}
@@ -0,0 +1,110 @@
+package tui
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/charmbracelet/bubbles/key"
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/surge-downloader/surge/internal/engine/types"
+)
+
+// queueLess orders queued downloads by their place in the queue,
+// ahead of paused ones
+func queueLess(a, b *DownloadModel) bool {
+	if a.queuePos == 0 || b.queuePos == 0 {
+		return a.queuePos != 0 && b.queuePos == 0
+	}
+	return a.queuePos < b.queuePos
+}
+
+// queueMoveFor returns the queue move bound to msg, if any
+func (m RootModel) queueMoveFor(msg tea.KeyMsg) (types.QueueMove, bool) {
+	switch {
+	case key.Matches(msg, m.keys.Dashboard.MoveUp):
+		return types.MoveUp, true
+	case key.Matches(msg, m.keys.Dashboard.MoveDown):
+		return types.MoveDown, true
+	case key.Matches(msg, m.keys.Dashboard.MoveTop):
+		return types.MoveTop, true
+	case key.Matches(msg, m.keys.Dashboard.MoveBottom):
+		return types.MoveBottom, true
+	}
+	return "", false
+}
+
+// moveInQueue reorders the queued downloads of the selected row, keeping the
+// volumes of a multi-part archive together, and keeps the row selected
+func (m *RootModel) moveInQueue(downloads []*DownloadModel, move types.QueueMove) {
+	if m.Service == nil {
+		m.addLogEntry(LogStyleError.Render("✖ Service unavailable"))
+		return
+	}
+	var queued []*DownloadModel
+	for _, d := range downloads {
+		if d.queuePos > 0 {
+			queued = append(queued, d)
+		}
+	}
+	sort.Slice(queued, func(i, j int) bool { return queued[i].queuePos < queued[j].queuePos })
+	// Down and top start from the last one, so the downloads keep their order
+	if move == types.MoveDown || move == types.MoveTop {
+		for i, j := 0, len(queued)-1; i < j; i, j = i+1, j-1 {
+			queued[i], queued[j] = queued[j], queued[i]
+		}
+	}
+
+	for _, d := range queued {
+		if err := m.Service.Move(d.ID, move); err != nil {
+			m.addLogEntry(LogStyleError.Render("✖ Move failed: " + err.Error()))
+			break
+		}
+	}
+	m.refreshQueueOrder()
+	m.UpdateListItems()
+}
+
+// setPriority changes the queue priority of the unfinished downloads of the
+// selected row
+func (m *RootModel) setPriority(downloads []*DownloadModel, priority int) {
+	if m.Service == nil {
+		m.addLogEntry(LogStyleError.Render("✖ Service unavailable"))
+		return
+	}
+	for _, d := range downloads {
+		if d.done {
+			continue
+		}
+		if err := m.Service.SetPriority(d.ID, priority); err != nil {
+			m.addLogEntry(LogStyleError.Render("✖ Priority change failed: " + err.Error()))
+			break
+		}
+		d.priority = priority
+		m.addLogEntry(LogStyleStarted.Render(fmt.Sprintf("⇅ Priority %+d: %s", priority, d.Filename)))
+	}
+	m.refreshQueueOrder()
+	m.UpdateListItems()
+}
+
+// refreshQueueOrder copies queue positions and priorities from the service
+func (m *RootModel) refreshQueueOrder() {
+	if m.Service == nil {
+		return
+	}
+	statuses, err := m.Service.List()
+	if err != nil {
+		return
+	}
+	byID := make(map[string]types.DownloadStatus, len(statuses))
+	for _, s := range statuses {
+		byID[s.ID] = s
+	}
+	for _, d := range m.downloads {
+		s, ok := byID[d.ID]
+		if !ok {
+			continue
+		}
+		d.queuePos = s.QueuePos
+		d.priority = s.Priority
+	}
+}
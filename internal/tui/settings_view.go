@@ -8,6 +8,7 @@ import (
 	"time"
 
 	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/scheduler"
 	"github.com/surge-downloader/surge/internal/tui/components"
 
 	"github.com/charmbracelet/lipgloss"
@@ -257,6 +258,12 @@ func (m RootModel) getSettingsValues(category string) map[string]interface{} {
 		values["clipboard_monitor"] = m.Settings.General.ClipboardMonitor
 		values["theme"] = m.Settings.General.Theme
 		values["log_retention_count"] = m.Settings.General.LogRetentionCount
+		values["on_complete_command"] = m.Settings.General.OnCompleteCommand
+		values["on_error_command"] = m.Settings.General.OnErrorCommand
+		values["hook_timeout"] = m.Settings.General.HookTimeout
+		values["extract_archives"] = m.Settings.General.ExtractArchives
+		values["extract_dir"] = m.Settings.General.ExtractDir
+		values["extract_delete_archive"] = m.Settings.General.ExtractDeleteArchive
 
 	case "Network":
 		values["max_connections_per_host"] = m.Settings.Network.MaxConnectionsPerHost
@@ -266,12 +273,20 @@ func (m RootModel) getSettingsValues(category string) map[string]interface{} {
 		values["sequential_download"] = m.Settings.Network.SequentialDownload
 		values["min_chunk_size"] = m.Settings.Network.MinChunkSize
 		values["worker_buffer_size"] = m.Settings.Network.WorkerBufferSize
+		values["global_rate_limit"] = m.Settings.Network.GlobalRateLimit
+		values["schedule"] = m.Settings.Network.Schedule
+		values["http2_hosts"] = m.Settings.Network.HTTP2Hosts
+		values["http3_hosts"] = m.Settings.Network.HTTP3Hosts
+		values["http2_connections"] = m.Settings.Network.HTTP2Connections
+		values["ssh_key_files"] = m.Settings.Network.SSHKeyFiles
+		values["ssh_known_hosts"] = m.Settings.Network.SSHKnownHosts
 	case "Performance":
 		values["max_task_retries"] = m.Settings.Performance.MaxTaskRetries
 		values["slow_worker_threshold"] = m.Settings.Performance.SlowWorkerThreshold
 		values["slow_worker_grace_period"] = m.Settings.Performance.SlowWorkerGracePeriod
 		values["stall_timeout"] = m.Settings.Performance.StallTimeout
 		values["speed_ema_alpha"] = m.Settings.Performance.SpeedEmaAlpha
+		values["checkpoint_interval"] = m.Settings.Performance.CheckpointInterval
 	}
 
 	return values
@@ -348,6 +363,24 @@ func (m *RootModel) setGeneralSetting(key, value, typ string) error {
 			}
 			m.Settings.General.LogRetentionCount = v
 		}
+	case "on_complete_command":
+		m.Settings.General.OnCompleteCommand = strings.TrimSpace(value)
+	case "on_error_command":
+		m.Settings.General.OnErrorCommand = strings.TrimSpace(value)
+	case "hook_timeout":
+		// Check if it's just a number, if so add "s"
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			value += "s"
+		}
+		if v, err := time.ParseDuration(value); err == nil && v >= 0 {
+			m.Settings.General.HookTimeout = v
+		}
+	case "extract_archives":
+		m.Settings.General.ExtractArchives = !m.Settings.General.ExtractArchives
+	case "extract_dir":
+		m.Settings.General.ExtractDir = strings.TrimSpace(value)
+	case "extract_delete_archive":
+		m.Settings.General.ExtractDeleteArchive = !m.Settings.General.ExtractDeleteArchive
 	}
 	return nil
 }
@@ -389,6 +422,29 @@ func (m *RootModel) setNetworkSetting(key, value, typ string) error {
 		if v, err := strconv.ParseFloat(value, 64); err == nil {
 			m.Settings.Network.WorkerBufferSize = int(v * 1024)
 		}
+	case "schedule":
+		// Keep the previous schedule if the new one does not parse
+		if _, err := scheduler.Parse(value); err != nil {
+			return err
+		}
+		m.Settings.Network.Schedule = strings.TrimSpace(value)
+	case "http2_hosts":
+		m.Settings.Network.HTTP2Hosts = strings.TrimSpace(value)
+	case "http3_hosts":
+		m.Settings.Network.HTTP3Hosts = strings.TrimSpace(value)
+	case "http2_connections":
+		if v, err := strconv.Atoi(value); err == nil {
+			m.Settings.Network.HTTP2Connections = max(1, min(v, 16))
+		}
+	case "ssh_key_files":
+		m.Settings.Network.SSHKeyFiles = strings.TrimSpace(value)
+	case "ssh_known_hosts":
+		m.Settings.Network.SSHKnownHosts = strings.TrimSpace(value)
+	case "global_rate_limit":
+		// Edited in KB/s, stored in bytes/sec
+		if v, err := strconv.ParseFloat(value, 64); err == nil && v >= 0 {
+			m.Settings.Network.GlobalRateLimit = int64(v * 1024)
+		}
 	}
 	return nil
 }
@@ -435,6 +491,14 @@ func (m *RootModel) setPerformanceSetting(key, value, typ string) error {
 			}
 			m.Settings.Performance.SpeedEmaAlpha = v
 		}
+	case "checkpoint_interval":
+		// Check if it's just a number, if so add "s"
+		if _, err := strconv.ParseFloat(value, 64); err == nil {
+			value += "s"
+		}
+		if v, err := time.ParseDuration(value); err == nil {
+			m.Settings.Performance.CheckpointInterval = v
+		}
 	}
 	return nil
 }
@@ -499,10 +563,14 @@ func (m RootModel) getSettingUnit() string {
 		return " MB"
 	case "worker_buffer_size":
 		return " KB"
+	case "global_rate_limit":
+		return " KB/s (0 = unlimited)"
 	case "max_task_retries":
 		return " retries"
-	case "slow_worker_grace_period", "stall_timeout":
+	case "slow_worker_grace_period", "stall_timeout", "checkpoint_interval":
 		return " seconds"
+	case "hook_timeout":
+		return " seconds (0 = no limit)"
 	case "slow_worker_threshold", "speed_ema_alpha":
 		return " (0.0-1.0)"
 	default:
@@ -524,7 +592,27 @@ func formatSettingValueForEdit(value interface{}, typ, key string) string {
 			kb := float64(v.Int()) / 1024
 			return fmt.Sprintf("%.0f", kb)
 		}
-	case "slow_worker_grace_period", "stall_timeout":
+	case "global_rate_limit":
+		if v, ok := value.(int64); ok {
+			return fmt.Sprintf("%.0f", float64(v)/1024)
+		}
+	case "schedule":
+		if v, ok := value.(string); ok && v == "" {
+			return "(none)"
+		}
+	case "ssh_key_files", "ssh_known_hosts":
+		if v, ok := value.(string); ok && v == "" {
+			return "(default)"
+		}
+	case "http2_hosts", "http3_hosts", "on_complete_command", "on_error_command":
+		if v, ok := value.(string); ok && v == "" {
+			return "(none)"
+		}
+	case "extract_dir":
+		if v, ok := value.(string); ok && v == "" {
+			return "(next to archive)"
+		}
+	case "slow_worker_grace_period", "stall_timeout", "hook_timeout", "checkpoint_interval":
 		// Show duration as plain seconds number (e.g., "5" instead of "5s")
 		if d, ok := value.(time.Duration); ok {
 			return fmt.Sprintf("%.0f", d.Seconds())
@@ -626,6 +714,18 @@ func (m *RootModel) resetSettingToDefault(category, key string, defaults *config
 			m.Settings.General.Theme = defaults.General.Theme
 		case "log_retention_count":
 			m.Settings.General.LogRetentionCount = defaults.General.LogRetentionCount
+		case "on_complete_command":
+			m.Settings.General.OnCompleteCommand = defaults.General.OnCompleteCommand
+		case "on_error_command":
+			m.Settings.General.OnErrorCommand = defaults.General.OnErrorCommand
+		case "hook_timeout":
+			m.Settings.General.HookTimeout = defaults.General.HookTimeout
+		case "extract_archives":
+			m.Settings.General.ExtractArchives = defaults.General.ExtractArchives
+		case "extract_dir":
+			m.Settings.General.ExtractDir = defaults.General.ExtractDir
+		case "extract_delete_archive":
+			m.Settings.General.ExtractDeleteArchive = defaults.General.ExtractDeleteArchive
 		}
 
 	case "Network":
@@ -644,6 +744,20 @@ func (m *RootModel) resetSettingToDefault(category, key string, defaults *config
 			m.Settings.Network.MinChunkSize = defaults.Network.MinChunkSize
 		case "worker_buffer_size":
 			m.Settings.Network.WorkerBufferSize = defaults.Network.WorkerBufferSize
+		case "global_rate_limit":
+			m.Settings.Network.GlobalRateLimit = defaults.Network.GlobalRateLimit
+		case "schedule":
+			m.Settings.Network.Schedule = defaults.Network.Schedule
+		case "http2_hosts":
+			m.Settings.Network.HTTP2Hosts = defaults.Network.HTTP2Hosts
+		case "http3_hosts":
+			m.Settings.Network.HTTP3Hosts = defaults.Network.HTTP3Hosts
+		case "http2_connections":
+			m.Settings.Network.HTTP2Connections = defaults.Network.HTTP2Connections
+		case "ssh_key_files":
+			m.Settings.Network.SSHKeyFiles = defaults.Network.SSHKeyFiles
+		case "ssh_known_hosts":
+			m.Settings.Network.SSHKnownHosts = defaults.Network.SSHKnownHosts
 		}
 	case "Performance":
 		switch key {
@@ -657,6 +771,8 @@ func (m *RootModel) resetSettingToDefault(category, key string, defaults *config
 			m.Settings.Performance.StallTimeout = defaults.Performance.StallTimeout
 		case "speed_ema_alpha":
 			m.Settings.Performance.SpeedEmaAlpha = defaults.Performance.SpeedEmaAlpha
+		case "checkpoint_interval":
+			m.Settings.Performance.CheckpointInterval = defaults.Performance.CheckpointInterval
 		}
 	}
 }
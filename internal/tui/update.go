@@ -2,7 +2,9 @@ package tui
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"net/url"
 	"os"
 	"os/exec"
 	"path/filepath"
@@ -13,8 +15,10 @@ import (
 	"github.com/surge-downloader/surge/internal/clipboard"
 	"github.com/surge-downloader/surge/internal/config"
 	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/ratelimit"
 	"github.com/surge-downloader/surge/internal/engine/state"
 	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/multipart"
 	"github.com/surge-downloader/surge/internal/utils"
 	"github.com/surge-downloader/surge/internal/version"
 
@@ -68,7 +72,8 @@ func openFile(path string) error {
 	return cmd.Start()
 }
 
-// readURLsFromFile reads URLs from a file, one per line (skips empty lines, comments, and duplicates)
+// readURLsFromFile reads URLs from a file, one per line (skips empty lines, comments, and duplicates).
+// Volumes of multi-part archives are kept together, in order.
 func readURLsFromFile(filepath string) ([]string, error) {
 	file, err := os.Open(filepath)
 	if err != nil {
@@ -104,7 +109,7 @@ func readURLsFromFile(filepath string) ([]string, error) {
 		return nil, fmt.Errorf("no URLs found in file")
 	}
 
-	return urls, nil
+	return multipart.OrderURLs(urls), nil
 }
 
 // addLogEntry adds a log entry to the log viewport
@@ -136,6 +141,39 @@ func (m *RootModel) removeDownloadByID(id string) bool {
 	return false
 }
 
+// applySpeedLimit parses a rate such as "512K" and applies it to downloads
+func (m *RootModel) applySpeedLimit(ids []string, value string) {
+	if m.Service == nil {
+		m.addLogEntry(LogStyleError.Render("✖ Service unavailable"))
+		return
+	}
+	rate, err := ratelimit.ParseRate(value)
+	if err != nil {
+		m.addLogEntry(LogStyleError.Render("✖ " + err.Error()))
+		return
+	}
+
+	for _, id := range ids {
+		if err := m.Service.SetRateLimit(id, rate); err != nil {
+			m.addLogEntry(LogStyleError.Render("✖ Speed limit failed: " + err.Error()))
+			return
+		}
+
+		name := id
+		for _, d := range m.downloads {
+			if d.ID == id {
+				name = d.Filename
+				break
+			}
+		}
+		if rate == 0 {
+			m.addLogEntry(LogStyleStarted.Render("⇡ Speed limit removed: " + name))
+		} else {
+			m.addLogEntry(LogStyleStarted.Render(fmt.Sprintf("⇣ Limited to %s/s: %s", utils.ConvertBytesToHumanReadable(rate), name)))
+		}
+	}
+}
+
 // checkForDuplicate checks if a compatible download already exists
 func (m RootModel) checkForDuplicate(url string) *DownloadModel {
 	if !m.Settings.General.WarnOnDuplicate {
@@ -157,6 +195,11 @@ func (m RootModel) checkForDuplicate(url string) *DownloadModel {
 
 // startDownload initiates a new download
 func (m RootModel) startDownload(url string, mirrors []string, headers map[string]string, path, filename, id string) (RootModel, tea.Cmd) {
+	return m.startDownloadWithOptions(url, mirrors, headers, path, filename, id, types.DownloadOptions{})
+}
+
+// startDownloadWithOptions initiates a new download with optional per-download parameters
+func (m RootModel) startDownloadWithOptions(url string, mirrors []string, headers map[string]string, path, filename, id string, opts types.DownloadOptions) (RootModel, tea.Cmd) {
 	if m.Service == nil {
 		m.addLogEntry(LogStyleError.Render("✖ Service unavailable"))
 		return m, nil
@@ -175,7 +218,7 @@ func (m RootModel) startDownload(url string, mirrors []string, headers map[strin
 	// We rely on the event stream to update the UI, OR we add it optimistically.
 	// Optimistic addition gives better UX.
 
-	newID, err := m.Service.Add(url, path, finalFilename, mirrors, headers)
+	newID, err := m.Service.AddWithOptions(url, path, finalFilename, mirrors, headers, opts)
 	if err != nil {
 		m.addLogEntry(LogStyleError.Render("✖ Failed to add download: " + err.Error()))
 		return m, nil
@@ -236,6 +279,7 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.pendingURL = msg.URL
 			m.pendingMirrors = msg.Mirrors
 			m.pendingHeaders = msg.Headers
+			m.pendingOptions = msg.Options
 			m.pendingPath = path
 			m.pendingFilename = msg.Filename
 			m.duplicateInfo = duplicate.Filename
@@ -247,13 +291,14 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.pendingURL = msg.URL
 			m.pendingMirrors = msg.Mirrors
 			m.pendingHeaders = msg.Headers
+			m.pendingOptions = msg.Options
 			m.pendingPath = path
 			m.pendingFilename = msg.Filename
 			m.state = ExtensionConfirmationState
 			return m, nil
 		}
 
-		return m.startDownload(msg.URL, msg.Mirrors, msg.Headers, path, msg.Filename, msg.ID)
+		return m.startDownloadWithOptions(msg.URL, msg.Mirrors, msg.Headers, path, msg.Filename, msg.ID, msg.Options)
 
 	case events.DownloadStartedMsg:
 		found := false
@@ -267,6 +312,8 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				d.paused = false
 				d.pausing = false
 				d.pendingResume = false
+				d.queuePos = 0
+				d.category = msg.Category
 				// Update progress bar
 				if d.Total > 0 {
 					d.progress.SetPercent(0)
@@ -285,6 +332,7 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if !found {
 			newDownload := NewDownloadModel(msg.DownloadID, msg.URL, msg.Filename, msg.Total)
 			newDownload.Destination = msg.DestPath
+			newDownload.category = msg.Category
 			if msg.State != nil {
 				newDownload.state = msg.State
 			}
@@ -334,13 +382,59 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if d.ID == msg.DownloadID {
 				d.err = msg.Err
 				d.done = true
-				m.addLogEntry(LogStyleError.Render("✖ Error: " + d.Filename))
+				if errors.Is(msg.Err, types.ErrChecksumMismatch) {
+					m.addLogEntry(LogStyleError.Render("✖ Checksum mismatch: " + d.Filename))
+				} else {
+					m.addLogEntry(LogStyleError.Render("✖ Error: " + d.Filename))
+				}
 				break
 			}
 		}
 		m.UpdateListItems()
 		return m, tea.Batch(cmds...)
 
+	case events.ExtractProgressMsg:
+		for _, d := range m.downloads {
+			if d.ID == msg.DownloadID {
+				if !d.extracting {
+					m.addLogEntry(LogStyleStarted.Render("⇲ Extracting: " + d.Filename))
+				}
+				d.extracting = true
+				d.extracted = msg.Extracted
+				d.extractTotal = msg.Total
+				break
+			}
+		}
+		m.UpdateListItems()
+		return m, nil
+
+	case events.ExtractDoneMsg:
+		for _, d := range m.downloads {
+			if d.ID == msg.DownloadID {
+				d.extracting = false
+				if msg.Err != "" {
+					m.addLogEntry(LogStyleError.Render("✖ Extract failed: " + d.Filename))
+				} else {
+					m.addLogEntry(LogStyleComplete.Render(fmt.Sprintf("✔ Extracted: %s (%d files)", d.Filename, msg.Files)))
+				}
+				break
+			}
+		}
+		m.UpdateListItems()
+		return m, nil
+
+	case events.MirrorDoneMsg:
+		host := msg.URL
+		if u, err := url.Parse(msg.URL); err == nil && u.Host != "" {
+			host = u.Host
+		}
+		if msg.Failed > 0 {
+			m.addLogEntry(LogStyleError.Render(fmt.Sprintf("✖ Mirrored: %s (%d files, %d failed)", host, msg.Files, msg.Failed)))
+		} else {
+			m.addLogEntry(LogStyleComplete.Render(fmt.Sprintf("✔ Mirrored: %s (%d files)", host, msg.Files)))
+		}
+		return m, nil
+
 	case events.DownloadPausedMsg:
 		for _, d := range m.downloads {
 			if d.ID == msg.DownloadID {
@@ -382,8 +476,9 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			// Add placeholder
 			newDownload := NewDownloadModel(msg.DownloadID, "", msg.Filename, 0)
 			m.downloads = append(m.downloads, newDownload)
-			m.UpdateListItems()
 		}
+		m.refreshQueueOrder()
+		m.UpdateListItems()
 		return m, tea.Batch(cmds...)
 
 	case events.DownloadRemovedMsg:
@@ -513,6 +608,71 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 			}
 
+			// Speed limit prompt intercepts all keys while open
+			if m.limitActive {
+				switch msg.String() {
+				case "esc":
+					m.limitActive = false
+					m.limitInput.Blur()
+					return m, nil
+				case "enter":
+					m.limitActive = false
+					m.limitInput.Blur()
+					m.applySpeedLimit(m.limitTargetIDs, m.limitInput.Value())
+					return m, nil
+				default:
+					var cmd tea.Cmd
+					m.limitInput, cmd = m.limitInput.Update(msg)
+					return m, cmd
+				}
+			}
+
+			// Set a speed limit for the selected download, or every unfinished volume of a set
+			if key.Matches(msg, m.keys.Dashboard.SpeedLimit) {
+				var ids []string
+				for _, d := range m.selectedVolumes() {
+					if !d.done {
+						ids = append(ids, d.ID)
+					}
+				}
+				if len(ids) > 0 {
+					m.limitActive = true
+					m.limitTargetIDs = ids
+					m.limitInput.SetValue("")
+					m.limitInput.Focus()
+				}
+				return m, nil
+			}
+
+			// Reorder the queue
+			if move, ok := m.queueMoveFor(msg); ok {
+				if d := m.GetSelectedDownload(); d != nil && d.queuePos > 0 {
+					m.moveInQueue(m.selectedVolumes(), move)
+				}
+				return m, nil
+			}
+			if key.Matches(msg, m.keys.Dashboard.RaisePriority, m.keys.Dashboard.LowerPriority) {
+				if d := m.GetSelectedDownload(); d != nil && !d.done {
+					delta := 1
+					if key.Matches(msg, m.keys.Dashboard.LowerPriority) {
+						delta = -1
+					}
+					m.setPriority(m.selectedVolumes(), d.priority+delta)
+				}
+				return m, nil
+			}
+
+			// Show or hide the volumes of a multi-part archive
+			if key.Matches(msg, m.keys.Dashboard.ExpandSet) {
+				m.toggleSet()
+				return m, nil
+			}
+
+			if key.Matches(msg, m.keys.Dashboard.Category) {
+				m.cycleCategoryFilter()
+				return m, nil
+			}
+
 			// Toggle search with F
 			if key.Matches(msg, m.keys.Dashboard.Search) {
 				if m.searchQuery != "" {
@@ -608,17 +768,19 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if key.Matches(msg, m.keys.Dashboard.Delete) {
 				if m.list.FilterState() == list.Filtering {
 					// Fall through
-				} else if d := m.GetSelectedDownload(); d != nil {
+				} else if volumes := m.selectedVolumes(); len(volumes) > 0 {
 					if m.Service == nil {
 						m.addLogEntry(LogStyleError.Render("✖ Service unavailable"))
 						return m, nil
 					}
-					targetID := d.ID
 
-					// Call Service Delete
-					if err := m.Service.Delete(targetID); err != nil {
-						m.addLogEntry(LogStyleError.Render("✖ Delete failed: " + err.Error()))
-					} else {
+					// Call Service Delete, for every volume of a set
+					for _, d := range volumes {
+						targetID := d.ID
+						if err := m.Service.Delete(targetID); err != nil {
+							m.addLogEntry(LogStyleError.Render("✖ Delete failed: " + err.Error()))
+							break
+						}
 						m.removeDownloadByID(targetID)
 					}
 					m.UpdateListItems()
@@ -644,22 +806,32 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, nil
 			}
 
-			// Pause/Resume toggle
+			// Pause/Resume toggle. A set resumes once every unfinished volume is paused,
+			// and pauses otherwise.
 			if key.Matches(msg, m.keys.Dashboard.Pause) {
-				if d := m.GetSelectedDownload(); d != nil {
+				if volumes := m.selectedVolumes(); len(volumes) > 0 {
 					if m.Service == nil {
 						m.addLogEntry(LogStyleError.Render("✖ Service unavailable"))
 						return m, nil
 					}
-					if !d.done {
-						if d.paused {
+					resume := true
+					for _, d := range volumes {
+						if !d.done && !d.paused {
+							resume = false
+						}
+					}
+					for _, d := range volumes {
+						if d.done {
+							continue
+						}
+						if resume {
 							// Resume
 							d.paused = false
 							if err := m.Service.Resume(d.ID); err != nil {
 								m.addLogEntry(LogStyleError.Render("✖ Resume failed: " + err.Error()))
 								d.paused = true // Revert
 							}
-						} else {
+						} else if !d.paused {
 							// Pause
 							if err := m.Service.Pause(d.ID); err != nil {
 								m.addLogEntry(LogStyleError.Render("✖ Pause failed: " + err.Error()))
@@ -834,6 +1006,7 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					m.pendingURL = url
 					m.pendingMirrors = mirrors
 					m.pendingHeaders = nil
+					m.pendingOptions = types.DownloadOptions{}
 					m.pendingPath = path
 					m.pendingFilename = filename
 					m.duplicateInfo = d.Filename
@@ -959,7 +1132,7 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if key.Matches(msg, m.keys.Duplicate.Continue) {
 				// Continue anyway - startDownload handles unique filename generation
 				m.state = DashboardState
-				return m.startDownload(m.pendingURL, m.pendingMirrors, m.pendingHeaders, m.pendingPath, m.pendingFilename, "")
+				return m.startDownloadWithOptions(m.pendingURL, m.pendingMirrors, m.pendingHeaders, m.pendingPath, m.pendingFilename, "", m.pendingOptions)
 			}
 			if key.Matches(msg, m.keys.Duplicate.Cancel) {
 				// Cancel - don't add
@@ -967,10 +1140,11 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, nil
 			}
 			if key.Matches(msg, m.keys.Duplicate.Focus) {
-				// Focus existing download - find it and select in list
-				for i, d := range m.getFilteredDownloads() {
+				// Focus existing download - find it and select in list, or its set's row
+				for _, d := range m.getFilteredDownloads() {
 					if d.URL == m.pendingURL {
-						m.list.Select(i)
+						m.SelectedDownloadID = d.ID
+						m.UpdateListItems()
 						break
 					}
 				}
@@ -991,7 +1165,7 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 				// No duplicate (or warning disabled) - add to queue
 				m.state = DashboardState
-				return m.startDownload(m.pendingURL, nil, m.pendingHeaders, m.pendingPath, m.pendingFilename, "")
+				return m.startDownloadWithOptions(m.pendingURL, nil, m.pendingHeaders, m.pendingPath, m.pendingFilename, "", m.pendingOptions)
 			}
 			if key.Matches(msg, m.keys.Extension.No) {
 				// Cancelled
@@ -1129,6 +1303,11 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			if key.Matches(msg, m.keys.Settings.Close) {
 				// Save settings and exit
 				_ = config.SaveSettings(m.Settings)
+				// The global speed limit and download count apply right away
+				if m.Service != nil {
+					_ = m.Service.SetGlobalRateLimit(m.Settings.Network.GlobalRateLimit)
+					_ = m.Service.SetMaxConcurrentDownloads(m.Settings.Network.MaxConcurrentDownloads)
+				}
 				m.state = DashboardState
 				return m, nil
 			}
@@ -1232,7 +1411,12 @@ func (m RootModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 					categories := config.CategoryOrder()
 					currentCategory := categories[m.SettingsActiveTab]
 					values := m.getSettingsValues(currentCategory)
-					m.SettingsInput.SetValue(formatSettingValueForEdit(values[key], typ, key))
+					if str, ok := values[key].(string); ok && typ == "string" {
+						// Edit the full text, not the truncated display form
+						m.SettingsInput.SetValue(str)
+					} else {
+						m.SettingsInput.SetValue(formatSettingValueForEdit(values[key], typ, key))
+					}
 					m.SettingsInput.Focus()
 				}
 				return m, nil
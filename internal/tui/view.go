@@ -162,16 +162,16 @@ func (m RootModel) View() string {
 	}
 
 	if m.state == BatchConfirmState {
-		urlCount := len(m.pendingBatchURLs)
+		message, lines := batchMessage(m.pendingBatchURLs)
 		modal := components.ConfirmationModal{
 			Title:       "Batch Import",
-			Message:     fmt.Sprintf("Add %d downloads?", urlCount),
+			Message:     message,
 			Detail:      truncateString(m.batchFilePath, 50),
 			Keys:        m.keys.BatchConfirm,
 			Help:        m.help,
 			BorderColor: ColorNeonCyan,
 			Width:       60,
-			Height:      10,
+			Height:      9 + lines, // One line per multi-part archive named
 		}
 		box := modal.RenderWithBtopBox(renderBtopBox, PaneTitleStyle)
 		return m.renderModalWithOverlay(box)
@@ -608,7 +608,12 @@ func (m RootModel) View() string {
 
 	// Search bar (shown when search is active or has a query)
 	var leftTitle string
-	if m.searchActive || m.searchQuery != "" {
+	if m.limitActive {
+		limitIcon := lipgloss.NewStyle().Foreground(ColorNeonCyan).Render("Speed limit: ")
+		limitDisplay := m.limitInput.View() +
+			lipgloss.NewStyle().Foreground(ColorGray).Render(" [enter apply, esc cancel]")
+		leftTitle = " " + lipgloss.JoinHorizontal(lipgloss.Left, limitIcon, limitDisplay) + " "
+	} else if m.searchActive || m.searchQuery != "" {
 		searchIcon := lipgloss.NewStyle().Foreground(ColorNeonCyan).Render("> ")
 		var searchDisplay string
 		if m.searchActive {
@@ -621,6 +626,11 @@ func (m RootModel) View() string {
 		}
 		// Pad the search bar to look like a title block
 		leftTitle = " " + lipgloss.JoinHorizontal(lipgloss.Left, searchIcon, searchDisplay) + " "
+	} else if m.categoryFilter != "" {
+		categoryIcon := lipgloss.NewStyle().Foreground(ColorNeonCyan).Render("Category: ")
+		categoryDisplay := lipgloss.NewStyle().Foreground(ColorNeonPink).Render(m.categoryFilter) +
+			lipgloss.NewStyle().Foreground(ColorGray).Render(" [c to change]")
+		leftTitle = " " + lipgloss.JoinHorizontal(lipgloss.Left, categoryIcon, categoryDisplay) + " "
 	}
 
 	// Render the bubbles list or centered empty message
@@ -633,7 +643,7 @@ func (m RootModel) View() string {
 			listContentWidth = 0
 		}
 
-		if m.searchQuery != "" {
+		if m.searchQuery != "" || m.categoryFilter != "" {
 			listContent = lipgloss.Place(listContentWidth, listContentHeight, lipgloss.Center, lipgloss.Center,
 				lipgloss.NewStyle().Foreground(ColorNeonCyan).Render("No matching downloads"))
 		} else {
@@ -929,6 +939,9 @@ func renderFocusedDetails(d *DownloadModel, w int) string {
 }
 
 func getDownloadStatus(d *DownloadModel) string {
+	if d.extracting {
+		return components.StatusExtracting.Render()
+	}
 	status := components.DetermineStatus(d.done, d.paused, d.err != nil, d.Speed, d.Downloaded)
 	return status.Render()
 }
@@ -1,7 +1,9 @@
 package utils
 
 import (
+	"os"
 	"path/filepath"
+	"strings"
 )
 
 // EnsureAbsPath takes a clean path and forces it to be absolute.
@@ -16,3 +18,13 @@ func EnsureAbsPath(path string) string {
 	}
 	return path
 }
+
+// ExpandHome replaces a leading ~/ with the home directory
+func ExpandHome(path string) string {
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, rest)
+		}
+	}
+	return path
+}
@@ -0,0 +1,274 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/engine/events"
+	"github.com/surge-downloader/surge/internal/engine/types"
+	"github.com/surge-downloader/surge/internal/utils"
+)
+
+const (
+	// QueueSize is how many events can wait for one endpoint before new ones are dropped
+	QueueSize = 256
+	// LogSize is how many deliveries Deliveries keeps
+	LogSize = 100
+	// RequestTimeout bounds each POST
+	RequestTimeout = 10 * time.Second
+	// drainTimeout is how long Close waits for queued events to go out
+	drainTimeout = 5 * time.Second
+)
+
+// DefaultBackoff is the wait before each retry of a failed delivery
+var DefaultBackoff = []time.Duration{time.Second, 5 * time.Second, 30 * time.Second}
+
+// Payload is the JSON body POSTed to webhooks
+type Payload struct {
+	ID    string          `json:"id"`    // Delivery ID, the same for every retry
+	Event string          `json:"event"` // Event name, as on the SSE stream
+	Time  int64           `json:"time"`  // Unix timestamp of the event
+	Data  json.RawMessage `json:"data"`  // The event, as on the SSE stream
+}
+
+type job struct {
+	hook       config.Webhook
+	delivery   types.WebhookDelivery
+	body       []byte
+	enqueuedAt time.Time
+}
+
+// Dispatcher sends download events to the webhooks in the settings. Each
+// endpoint gets its own queue, so events reach it in order and a slow
+// endpoint does not hold up the others.
+type Dispatcher struct {
+	webhooks func() []config.Webhook
+	client   *http.Client
+	backoff  []time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+
+	mu     sync.Mutex
+	queues map[string]chan job // By endpoint URL
+	closed bool
+	log    []types.WebhookDelivery
+}
+
+// NewDispatcher creates a dispatcher. webhooks is called for every event so
+// edits to the settings take effect without a restart.
+func NewDispatcher(webhooks func() []config.Webhook) *Dispatcher {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Dispatcher{
+		webhooks: webhooks,
+		client:   &http.Client{Timeout: RequestTimeout},
+		backoff:  DefaultBackoff,
+		ctx:      ctx,
+		cancel:   cancel,
+		queues:   make(map[string]chan job),
+	}
+}
+
+// SetBackoff replaces the waits between retries; the number of retries is len(backoff)
+func (d *Dispatcher) SetBackoff(backoff []time.Duration) {
+	d.mu.Lock()
+	d.backoff = backoff
+	d.mu.Unlock()
+}
+
+// Send queues msg for every webhook subscribed to its event. It never blocks.
+func (d *Dispatcher) Send(msg interface{}) {
+	event := events.Name(msg)
+	if event == "" {
+		return
+	}
+
+	var hooks []config.Webhook
+	for _, h := range d.webhooks() {
+		if h.URL != "" && h.Wants(event) {
+			hooks = append(hooks, h)
+		}
+	}
+	if len(hooks) == 0 {
+		return
+	}
+
+	data, err := json.Marshal(msg)
+	if err != nil {
+		utils.Debug("Webhook: failed to encode %s event: %v", event, err)
+		return
+	}
+	var ids struct{ DownloadID string }
+	_ = json.Unmarshal(data, &ids)
+
+	now := time.Now()
+	for _, h := range hooks {
+		id := uuid.New().String()
+		body, err := json.Marshal(Payload{ID: id, Event: event, Time: now.Unix(), Data: data})
+		if err != nil {
+			continue
+		}
+		d.enqueue(job{
+			hook:       h,
+			delivery:   types.WebhookDelivery{ID: id, URL: h.URL, Event: event, DownloadID: ids.DownloadID},
+			body:       body,
+			enqueuedAt: now,
+		})
+	}
+}
+
+func (d *Dispatcher) enqueue(j job) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if d.closed {
+		return
+	}
+
+	queue, ok := d.queues[j.hook.URL]
+	if !ok {
+		queue = make(chan job, QueueSize)
+		d.queues[j.hook.URL] = queue
+		d.wg.Add(1)
+		go d.worker(queue)
+	}
+
+	select {
+	case queue <- j:
+	default:
+		j.delivery.Error = "queue full, event dropped"
+		j.delivery.Time = j.enqueuedAt.Unix()
+		d.record(j.delivery)
+	}
+}
+
+func (d *Dispatcher) worker(queue chan job) {
+	defer d.wg.Done()
+	for j := range queue {
+		d.deliver(j)
+	}
+}
+
+// deliver POSTs one event, retrying network errors, 5xx, 408 and 429 responses
+func (d *Dispatcher) deliver(j job) {
+	d.mu.Lock()
+	backoff := d.backoff
+	d.mu.Unlock()
+
+	delivery := j.delivery
+	for attempt := 0; ; attempt++ {
+		delivery.Attempts = attempt + 1
+		delivery.Time = time.Now().Unix()
+		status, err := d.post(j)
+		delivery.StatusCode = status
+		if err == nil {
+			delivery.Delivered = true
+			delivery.Error = ""
+			break
+		}
+		delivery.Error = err.Error()
+
+		retryable := status == 0 || status >= 500 || status == http.StatusRequestTimeout || status == http.StatusTooManyRequests
+		if !retryable || attempt >= len(backoff) {
+			break
+		}
+		select {
+		case <-d.ctx.Done():
+			d.record(delivery)
+			return
+		case <-time.After(backoff[attempt]):
+		}
+	}
+
+	if !delivery.Delivered {
+		utils.Debug("Webhook: %s event for %s to %s failed after %d attempts: %s",
+			delivery.Event, delivery.DownloadID, delivery.URL, delivery.Attempts, delivery.Error)
+	}
+	d.record(delivery)
+}
+
+func (d *Dispatcher) post(j job) (int, error) {
+	req, err := http.NewRequestWithContext(d.ctx, http.MethodPost, j.hook.URL, bytes.NewReader(j.body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Surge-Webhook")
+	req.Header.Set("X-Surge-Event", j.delivery.Event)
+	req.Header.Set("X-Surge-Delivery", j.delivery.ID)
+	if j.hook.Secret != "" {
+		req.Header.Set("X-Surge-Signature", Sign(j.hook.Secret, j.body))
+	}
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the X-Surge-Signature value for body: "sha256=" and the hex
+// HMAC-SHA256 of the body keyed with secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+func (d *Dispatcher) record(delivery types.WebhookDelivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.log = append(d.log, delivery)
+	if len(d.log) > LogSize {
+		d.log = d.log[len(d.log)-LogSize:]
+	}
+}
+
+// Deliveries returns the most recent deliveries, oldest first
+func (d *Dispatcher) Deliveries() []types.WebhookDelivery {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]types.WebhookDelivery(nil), d.log...)
+}
+
+// Close stops accepting events and gives queued ones a few seconds to go
+// out before cancelling them
+func (d *Dispatcher) Close() {
+	d.mu.Lock()
+	if d.closed {
+		d.mu.Unlock()
+		return
+	}
+	d.closed = true
+	for _, queue := range d.queues {
+		close(queue)
+	}
+	d.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		d.wg.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(drainTimeout):
+		d.cancel()
+		<-done
+	}
+	d.cancel()
+}
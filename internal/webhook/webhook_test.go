@@ -0,0 +1,166 @@
+package webhook
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/surge-downloader/surge/internal/config"
+	"github.com/surge-downloader/surge/internal/engine/events"
+)
+
+type received struct {
+	header http.Header
+	body   []byte
+}
+
+// recorder is an endpoint that answers with the next status in statuses,
+// then 200 once they run out
+type recorder struct {
+	mu       sync.Mutex
+	statuses []int
+	got      []received
+}
+
+func (rec *recorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+	rec.mu.Lock()
+	rec.got = append(rec.got, received{header: r.Header.Clone(), body: body})
+	status := http.StatusOK
+	if len(rec.statuses) > 0 {
+		status = rec.statuses[0]
+		rec.statuses = rec.statuses[1:]
+	}
+	rec.mu.Unlock()
+	w.WriteHeader(status)
+}
+
+func (rec *recorder) requests() []received {
+	rec.mu.Lock()
+	defer rec.mu.Unlock()
+	return append([]received(nil), rec.got...)
+}
+
+func newTestDispatcher(hooks ...config.Webhook) *Dispatcher {
+	d := NewDispatcher(func() []config.Webhook { return hooks })
+	d.SetBackoff([]time.Duration{time.Millisecond, time.Millisecond})
+	return d
+}
+
+func TestDispatcher_SignsPayload(t *testing.T) {
+	rec := &recorder{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	d := newTestDispatcher(config.Webhook{URL: srv.URL, Secret: "s3cret"})
+	d.Send(events.DownloadCompleteMsg{DownloadID: "abc", Filename: "a.iso", Total: 10})
+	d.Close()
+
+	got := rec.requests()
+	if len(got) != 1 {
+		t.Fatalf("got %d requests, want 1", len(got))
+	}
+	req := got[0]
+	if sig := req.header.Get("X-Surge-Signature"); sig != Sign("s3cret", req.body) {
+		t.Errorf("signature = %q, want %q", sig, Sign("s3cret", req.body))
+	}
+	if ev := req.header.Get("X-Surge-Event"); ev != "complete" {
+		t.Errorf("X-Surge-Event = %q, want complete", ev)
+	}
+
+	var payload Payload
+	if err := json.Unmarshal(req.body, &payload); err != nil {
+		t.Fatalf("payload is not JSON: %v", err)
+	}
+	if payload.Event != "complete" || payload.ID != req.header.Get("X-Surge-Delivery") {
+		t.Errorf("unexpected payload %+v", payload)
+	}
+	var data events.DownloadCompleteMsg
+	if err := json.Unmarshal(payload.Data, &data); err != nil || data.DownloadID != "abc" || data.Filename != "a.iso" {
+		t.Errorf("data = %s, want the complete event", payload.Data)
+	}
+
+	log := d.Deliveries()
+	if len(log) != 1 || !log[0].Delivered || log[0].DownloadID != "abc" || log[0].StatusCode != http.StatusOK {
+		t.Errorf("unexpected delivery log %+v", log)
+	}
+}
+
+func TestDispatcher_RetriesServerErrors(t *testing.T) {
+	rec := &recorder{statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests}}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	d := newTestDispatcher(config.Webhook{URL: srv.URL})
+	d.Send(events.DownloadStartedMsg{DownloadID: "abc"})
+	d.Close()
+
+	got := rec.requests()
+	if len(got) != 3 {
+		t.Fatalf("got %d requests, want 3", len(got))
+	}
+	if got[0].header.Get("X-Surge-Delivery") != got[2].header.Get("X-Surge-Delivery") {
+		t.Error("retries should reuse the delivery ID")
+	}
+	if got[0].header.Get("X-Surge-Signature") != "" {
+		t.Error("unsigned webhook should not send a signature")
+	}
+	log := d.Deliveries()
+	if len(log) != 1 || !log[0].Delivered || log[0].Attempts != 3 {
+		t.Errorf("unexpected delivery log %+v", log)
+	}
+}
+
+func TestDispatcher_GivesUp(t *testing.T) {
+	rec := &recorder{statuses: []int{http.StatusBadRequest}}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	failing := &recorder{statuses: []int{500, 500, 500, 500}}
+	failingSrv := httptest.NewServer(failing)
+	defer failingSrv.Close()
+
+	d := newTestDispatcher(config.Webhook{URL: srv.URL}, config.Webhook{URL: failingSrv.URL})
+	d.Send(events.DownloadErrorMsg{DownloadID: "abc"})
+	d.Close()
+
+	if n := len(rec.requests()); n != 1 {
+		t.Errorf("client errors should not be retried, got %d requests", n)
+	}
+	if n := len(failing.requests()); n != 3 {
+		t.Errorf("got %d requests, want 3 (one try and two retries)", n)
+	}
+	for _, delivery := range d.Deliveries() {
+		if delivery.Delivered || delivery.Error == "" || delivery.StatusCode == 0 {
+			t.Errorf("failed delivery should be logged with its error: %+v", delivery)
+		}
+	}
+}
+
+func TestDispatcher_FiltersEvents(t *testing.T) {
+	rec := &recorder{}
+	srv := httptest.NewServer(rec)
+	defer srv.Close()
+
+	d := newTestDispatcher(config.Webhook{URL: srv.URL, Events: "complete"})
+	d.Send(events.ProgressMsg{DownloadID: "abc"})
+	d.Send(events.DownloadStartedMsg{DownloadID: "abc"})
+	d.Send(events.DownloadCompleteMsg{DownloadID: "abc"})
+	d.Send(events.DownloadRemovedMsg{DownloadID: "abc"})
+	d.Close()
+
+	got := rec.requests()
+	if len(got) != 1 || got[0].header.Get("X-Surge-Event") != "complete" {
+		t.Fatalf("want only the complete event, got %d requests", len(got))
+	}
+
+	// Sends after Close are ignored
+	d.Send(events.DownloadCompleteMsg{DownloadID: "abc"})
+	if n := len(d.Deliveries()); n != 1 {
+		t.Errorf("got %d deliveries after Close, want 1", n)
+	}
+}